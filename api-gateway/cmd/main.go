@@ -7,13 +7,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/billing"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
 	consul_client "github.com/dante-gpu/dante-backend/api-gateway/internal/consul"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/handlers"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/loadbalancer"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/metrics"
 	customMiddleware "github.com/dante-gpu/dante-backend/api-gateway/internal/middleware" // Alias to avoid conflict
 	nats_client "github.com/dante-gpu/dante-backend/api-gateway/internal/nats"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware" // Import consul api
 	"github.com/nats-io/nats.go"
@@ -60,9 +63,13 @@ func main() {
 	// I should add basic middleware.
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(metrics.Middleware)
 	r.Use(NewStructuredLogger(logger))
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(cfg.RequestTimeout))
+	if cfg.Compression.Enabled {
+		r.Use(customMiddleware.NewCompressor(cfg.Compression).Middleware)
+	}
 
 	// Create billing client
 	billingConfig := &billing.Config{
@@ -72,12 +79,37 @@ func main() {
 	billingClient := billing.NewClient(billingConfig, logger)
 
 	// I need to create instances of my handlers.
-	authHandler := handlers.NewAuthHandler(logger, cfg)
-	jobHandler := handlers.NewJobHandler(logger, cfg, nc)
-	billingHandler := handlers.NewBillingHandler(billingClient, logger)
+	refreshTokenBucket, err := nats_client.KeyValue(nc, cfg.RefreshTokenBucket, cfg.RefreshTokenExpiration)
+	if err != nil {
+		logger.Fatal("Failed to open refresh token bucket", zap.Error(err))
+	}
+	refreshTokens := auth.NewRefreshTokens(auth.NewKVRefreshTokenStore(refreshTokenBucket), cfg.RefreshTokenExpiration)
+	authHandler := handlers.NewAuthHandler(logger, cfg, refreshTokens)
 	// Create load balancer and proxy handler (even if Consul connection failed, to avoid nil pointers)
-	lb := loadbalancer.NewRoundRobin()
+	var lb loadbalancer.LoadBalancer = loadbalancer.NewRoundRobin()
+	if cfg.CircuitBreaker.Enabled {
+		lb = loadbalancer.NewCircuitBreaker(lb, cfg.CircuitBreaker.FailureThreshold, cfg.CircuitBreaker.Cooldown)
+	}
 	proxyHandler := handlers.NewProxyHandler(logger, cfg, consulClient, lb)
+	webhookWatches, err := nats_client.KeyValue(nc, cfg.Webhooks.WatchBucket, cfg.Webhooks.MaxWatch)
+	if err != nil {
+		logger.Fatal("Failed to open webhook watch bucket", zap.Error(err))
+	}
+	webhooks := webhook.NewDispatcher(cfg.Webhooks, nc, webhook.NewKVWatchStore(webhookWatches), logger)
+	if err := webhooks.Start(); err != nil {
+		logger.Fatal("Failed to start webhook dispatcher", zap.Error(err))
+	}
+	submissions, err := nats_client.KeyValue(nc, cfg.JobLimits.SubmissionsBucket, handlers.PendingSubmissionTTL)
+	if err != nil {
+		logger.Fatal("Failed to open job submissions bucket", zap.Error(err))
+	}
+	idempotencyKeys, err := nats_client.KeyValue(nc, cfg.IdempotencyBucket, cfg.IdempotencyKeyTTL)
+	if err != nil {
+		logger.Fatal("Failed to open idempotency key bucket", zap.Error(err))
+	}
+	jobHandler := handlers.NewJobHandler(logger, cfg, nc, webhooks, billingClient, proxyHandler, submissions, idempotencyKeys)
+	billingHandler := handlers.NewBillingHandler(billingClient, logger)
+	adminHandler := handlers.NewAdminHandler(logger, proxyHandler, billingClient)
 
 	// == Public Routes ==
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -121,10 +153,15 @@ func main() {
 		fmt.Fprintf(w, strings.TrimSpace(healthMsg))
 	})
 
+	// I expose Prometheus metrics unauthenticated, like the health check.
+	r.Handle("/metrics", metrics.Handler())
+
 	// == Authentication Routes ==
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/login", authHandler.Login)
 		r.Post("/register", authHandler.Register)
+		r.Post("/refresh", authHandler.Refresh)
+		r.Post("/logout", authHandler.Logout)
 
 		// Routes requiring authentication
 		r.Group(func(r chi.Router) {
@@ -136,11 +173,19 @@ func main() {
 	// == API V1 Routes (Protected) ==
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Use(customMiddleware.Authenticator(logger, cfg.JwtSecret))
+		if cfg.RateLimit.Enabled {
+			r.Use(customMiddleware.NewRateLimiter(cfg.RateLimit, logger).Middleware)
+		}
 
 		// Job submission routes
-		r.Post("/jobs", jobHandler.SubmitJob)
+		r.With(jobHandler.Idempotency).Post("/jobs", jobHandler.SubmitJob)
+		r.With(jobHandler.Idempotency).Post("/jobs/batch", jobHandler.SubmitJobBatch)
 		r.Get("/jobs/{jobID}", jobHandler.GetJobStatus)
+		r.Get("/jobs/{jobID}/stream", jobHandler.StreamJobStatus)
+		r.Get("/jobs/{jobID}/logs", jobHandler.GetJobLogs)
+		r.Get("/jobs/{jobID}/exec", jobHandler.ExecJob)
 		r.Delete("/jobs/{jobID}", jobHandler.CancelJob)
+		r.Get("/webhooks/secret", jobHandler.GetWebhookSecret)
 
 		// Billing and wallet endpoints
 		r.Route("/billing", func(r chi.Router) {
@@ -162,11 +207,13 @@ func main() {
 			r.Get("/marketplace", billingHandler.GetGPUMarketplace)
 		})
 
-		// Admin routes (placeholder)
-		// r.Group(func(r chi.Router) {
-		//    r.Use(customMiddleware.RequireRole("admin")) // Role checking middleware needed
-		//    r.Get("/admin-stats", handlers.GetAdminStats)
-		// })
+		// Admin-only routes
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(customMiddleware.RequireRole(logger, "admin"))
+			r.Get("/providers", adminHandler.ListProviders)
+			r.Post("/jobs/{jobID}/cancel", jobHandler.ForceCancelJob)
+			r.Get("/platform-fees", adminHandler.GetPlatformFees)
+		})
 	})
 
 	// == Service Proxy Route ==
@@ -174,13 +221,6 @@ func main() {
 	// The "*" in the pattern is crucial for matching subpaths.
 	r.HandleFunc("/services/{serviceName}/*", proxyHandler.ServeHTTP)
 
-	// == Admin Dashboard Route (Example - protected) ==
-	// r.Group(func(r chi.Router) {
-	//     r.Use(customMiddleware.Authenticator(logger, cfg.JwtSecret))
-	//     r.Use(customMiddleware.RequireRole("admin")) // Role checking middleware needed
-	//     r.Get("/admin", handlers.AdminDashboard)
-	// })
-
 	// I need to start the HTTP server.
 	logger.Info("Starting API Gateway", zap.String("port", cfg.Port))
 	if err := http.ListenAndServe(cfg.Port, r); err != nil {
@@ -0,0 +1,127 @@
+// Package apierror writes the gateway's error responses. Every error is answered with
+// the same JSON envelope, {"code", "message", "details"}, where code is one of a fixed
+// set that clients can branch on; message is for people and may change.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Code identifies the kind of error in an error response.
+type Code string
+
+// Error codes. They are part of the API: new ones may be added, existing ones don't change.
+const (
+	CodeInvalidRequest       Code = "INVALID_REQUEST"
+	CodeValidation           Code = "VALIDATION_ERROR"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeConflict             Code = "CONFLICT"
+	CodeIdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeConcurrentJobLimit   Code = "CONCURRENT_JOB_LIMIT"
+	CodeInsufficientFunds    Code = "INSUFFICIENT_FUNDS"
+	CodeSpendingLimit        Code = "SPENDING_LIMIT_EXCEEDED"
+	CodeNoProviderAvailable  Code = "NO_PROVIDER_AVAILABLE"
+	CodeUpstreamUnavailable  Code = "UPSTREAM_UNAVAILABLE"
+	CodeUpstreamError        Code = "UPSTREAM_ERROR"
+	CodeInternal             Code = "INTERNAL_ERROR"
+)
+
+// Response is the body of every error response.
+type Response struct {
+	Code    Code                   `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Write sends an error response with the given status.
+func Write(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Error replies with message and the status's default code, like http.Error.
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, Response{Code: CodeForStatus(status), Message: message})
+}
+
+// CodeForStatus returns the code used for errors with the given status when nothing
+// more specific applies.
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPaymentRequired:
+		return CodeInsufficientFunds
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstreamError
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// billingCodes maps the billing service's error codes to the gateway's, with the status
+// they are answered with.
+var billingCodes = map[string]struct {
+	code   Code
+	status int
+}{
+	"INSUFFICIENT_FUNDS":     {CodeInsufficientFunds, http.StatusPaymentRequired},
+	"LIMIT_EXCEEDED":         {CodeSpendingLimit, http.StatusForbidden},
+	"PROVIDER_NOT_AVAILABLE": {CodeNoProviderAvailable, http.StatusServiceUnavailable},
+	"INSUFFICIENT_VRAM":      {CodeNoProviderAvailable, http.StatusServiceUnavailable},
+	"VALIDATION_FAILED":      {CodeValidation, http.StatusBadRequest},
+	"MISSING_REQUIRED_FIELD": {CodeValidation, http.StatusBadRequest},
+	"INVALID_FIELD_VALUE":    {CodeValidation, http.StatusBadRequest},
+	"INVALID_AMOUNT":         {CodeValidation, http.StatusBadRequest},
+	"MINIMUM_PAYOUT_AMOUNT":  {CodeValidation, http.StatusBadRequest},
+	"INVALID_SOLANA_ADDRESS": {CodeValidation, http.StatusBadRequest},
+	"WALLET_NOT_FOUND":       {CodeNotFound, http.StatusNotFound},
+	"SESSION_NOT_FOUND":      {CodeNotFound, http.StatusNotFound},
+	"TRANSACTION_NOT_FOUND":  {CodeNotFound, http.StatusNotFound},
+	"WALLET_ALREADY_EXISTS":  {CodeConflict, http.StatusConflict},
+	"RATE_LIMITED":           {CodeRateLimited, http.StatusTooManyRequests},
+	"UNAUTHORIZED":           {CodeForbidden, http.StatusForbidden},
+	"FORBIDDEN":              {CodeForbidden, http.StatusForbidden},
+}
+
+// FromBilling builds the response for an error the billing service answered with its
+// status, code, message and details. Known codes map to the gateway's; for others the
+// status decides, and failures of the billing service itself are upstream errors. The
+// billing code is kept in the details as billing_code.
+func FromBilling(status int, billingCode, message string, details map[string]interface{}) (int, Response) {
+	resp := Response{Message: message, Details: make(map[string]interface{}, len(details)+1)}
+	for k, v := range details {
+		resp.Details[k] = v
+	}
+	if billingCode != "" {
+		resp.Details["billing_code"] = billingCode
+	}
+
+	if mapped, ok := billingCodes[billingCode]; ok {
+		resp.Code = mapped.code
+		return mapped.status, resp
+	}
+	if status >= 500 || status < 400 {
+		status = http.StatusBadGateway
+	}
+	resp.Code = CodeForStatus(status)
+	return status, resp
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for refresh tokens that are unknown, expired or revoked.
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is
+	// presented again. Every token descended from the same login is revoked, since either
+	// the client or an attacker is holding a stolen copy.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is the stored record of an issued refresh token. I only keep a hash of
+// the token itself, so a leaked store can't be used to mint sessions.
+type RefreshToken struct {
+	Hash      string    `json:"hash"`
+	FamilyID  string    `json:"family_id"` // Shared by every token rotated from the same login
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Rotated   bool      `json:"rotated"` // Set once the token has been exchanged for a new one
+}
+
+// RefreshTokenStore persists refresh tokens so they can be rotated and revoked.
+type RefreshTokenStore interface {
+	// Save stores a newly issued token.
+	Save(token *RefreshToken) error
+	// Consume atomically marks the token as rotated and returns it. It returns
+	// ErrRefreshTokenReused, after revoking the token's family, if the token was
+	// already rotated, and ErrRefreshTokenInvalid if it is unknown or expired.
+	Consume(hash string, now time.Time) (*RefreshToken, error)
+	// RevokeFamily invalidates every token of the token's family. Unknown tokens are ignored.
+	RevokeFamily(hash string) error
+}
+
+// MemoryRefreshTokenStore keeps refresh tokens in memory. Tokens don't survive a
+// restart, which only means users have to log in again.
+type MemoryRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+// NewMemoryRefreshTokenStore creates an empty in-memory refresh token store.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{tokens: make(map[string]*RefreshToken)}
+}
+
+// Save stores a newly issued token and drops expired ones.
+func (s *MemoryRefreshTokenStore) Save(token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+
+	stored := *token
+	s.tokens[token.Hash] = &stored
+	return nil
+}
+
+// Consume marks the token as rotated and returns a copy of it.
+func (s *MemoryRefreshTokenStore) Consume(hash string, now time.Time) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok || now.After(token.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if token.Rotated {
+		s.revokeFamilyLocked(token.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	token.Rotated = true
+	consumed := *token
+	return &consumed, nil
+}
+
+// RevokeFamily removes every token of the token's family.
+func (s *MemoryRefreshTokenStore) RevokeFamily(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.tokens[hash]; ok {
+		s.revokeFamilyLocked(token.FamilyID)
+	}
+	return nil
+}
+
+// revokeFamilyLocked removes every token of a family. Caller must hold s.mu.
+func (s *MemoryRefreshTokenStore) revokeFamilyLocked(familyID string) {
+	for hash, t := range s.tokens {
+		if t.FamilyID == familyID {
+			delete(s.tokens, hash)
+		}
+	}
+}
+
+// KVRefreshTokenStore keeps refresh tokens in a NATS key-value bucket, shared by every
+// gateway instance, so logins survive restarts and work on any replica. Tokens are
+// rotated with revision checks, so two instances can't both exchange the same token.
+// A revoked family is recorded under its own key rather than by finding and deleting
+// its tokens. The bucket's TTL should be the refresh token expiration.
+type KVRefreshTokenStore struct {
+	kv nats.KeyValue
+}
+
+// NewKVRefreshTokenStore creates a refresh token store backed by kv.
+func NewKVRefreshTokenStore(kv nats.KeyValue) *KVRefreshTokenStore {
+	return &KVRefreshTokenStore{kv: kv}
+}
+
+func refreshTokenKey(hash string) string {
+	return "token." + hash
+}
+
+func revokedFamilyKey(familyID string) string {
+	return "family." + familyID
+}
+
+// Save stores a newly issued token.
+func (s *KVRefreshTokenStore) Save(token *RefreshToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+	if _, err := s.kv.Put(refreshTokenKey(token.Hash), data); err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return nil
+}
+
+// Consume marks the token as rotated and returns it. A token consumed concurrently by
+// another instance counts as reused.
+func (s *KVRefreshTokenStore) Consume(hash string, now time.Time) (*RefreshToken, error) {
+	token, revision, err := s.get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || now.After(token.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	revoked, err := s.familyRevoked(token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if token.Rotated {
+		return nil, s.reused(token.FamilyID)
+	}
+
+	token.Rotated = true
+	data, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+	if _, err := s.kv.Update(refreshTokenKey(hash), data, revision); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return nil, s.reused(token.FamilyID)
+		}
+		return nil, fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeFamily records the token's family as revoked.
+func (s *KVRefreshTokenStore) RevokeFamily(hash string) error {
+	token, _, err := s.get(hash)
+	if err != nil || token == nil {
+		return err
+	}
+	return s.revokeFamily(token.FamilyID)
+}
+
+// get returns the token and its revision, or nil if the token is unknown.
+func (s *KVRefreshTokenStore) get(hash string) (*RefreshToken, uint64, error) {
+	entry, err := s.kv.Get(refreshTokenKey(hash))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	var token RefreshToken
+	if err := json.Unmarshal(entry.Value(), &token); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+	}
+	return &token, entry.Revision(), nil
+}
+
+func (s *KVRefreshTokenStore) familyRevoked(familyID string) (bool, error) {
+	_, err := s.kv.Get(revokedFamilyKey(familyID))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+	return true, nil
+}
+
+func (s *KVRefreshTokenStore) revokeFamily(familyID string) error {
+	if _, err := s.kv.Put(revokedFamilyKey(familyID), []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+// reused revokes the family of a token presented again and returns ErrRefreshTokenReused.
+func (s *KVRefreshTokenStore) reused(familyID string) error {
+	if err := s.revokeFamily(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RefreshTokens issues, rotates and revokes refresh tokens.
+type RefreshTokens struct {
+	store      RefreshTokenStore
+	expiration time.Duration
+}
+
+// NewRefreshTokens creates a refresh token manager backed by store.
+func NewRefreshTokens(store RefreshTokenStore, expiration time.Duration) *RefreshTokens {
+	return &RefreshTokens{store: store, expiration: expiration}
+}
+
+// Issue creates the first refresh token of a new login.
+func (rt *RefreshTokens) Issue(user *User) (string, time.Time, error) {
+	return rt.issue(user.ID, user.Username, uuid.New().String())
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. The old token
+// can't be used again; presenting it again revokes the whole family.
+func (rt *RefreshTokens) Rotate(token string) (*RefreshToken, string, time.Time, error) {
+	old, err := rt.store.Consume(hashRefreshToken(token), time.Now())
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	newToken, expiresAt, err := rt.issue(old.UserID, old.Username, old.FamilyID)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return old, newToken, expiresAt, nil
+}
+
+// Revoke invalidates the refresh token and every token rotated from the same login.
+func (rt *RefreshTokens) Revoke(token string) error {
+	return rt.store.RevokeFamily(hashRefreshToken(token))
+}
+
+func (rt *RefreshTokens) issue(userID, username, familyID string) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(rt.expiration)
+
+	err := rt.store.Save(&RefreshToken{
+		Hash:      hashRefreshToken(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Username:  username,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -10,6 +10,10 @@ type User struct {
 	Username string `json:"username"`
 	Password string `json:"-"` // Password hash - should not be in JWT or responses
 	Role     string `json:"role"`
+
+	// MaxConcurrentJobs overrides the concurrent job limit of the user's role when
+	// non-zero; negative means no limit.
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty"`
 }
 
 // Mock user store for demonstration purposes.
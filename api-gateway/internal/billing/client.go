@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +16,63 @@ import (
 	"go.uber.org/zap"
 )
 
+// ErrBadRequest is returned when the billing service rejects a request as invalid.
+var ErrBadRequest = errors.New("billing service rejected the request")
+
+// ErrInsufficientFunds is returned when the user's wallet can't cover a reservation.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Error is returned when the billing service answers with an error status. Code is the
+// billing service's error code, if it sent one. errors.Is matches ErrBadRequest and
+// ErrInsufficientFunds against it.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("billing service returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("billing service returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether the error is one of the sentinel errors above.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInsufficientFunds:
+		// Older billing services only say so in the message
+		return e.Code == "INSUFFICIENT_FUNDS" || (e.Code == "" && e.Message == "Insufficient funds")
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	}
+	return false
+}
+
+// errorFromResponse reads the billing service's error response into an *Error. The
+// underlying error the billing service reports for client errors is kept as the reason.
+func errorFromResponse(resp *http.Response) error {
+	var body struct {
+		Error   string                 `json:"error"`
+		Code    string                 `json:"code"`
+		Details interface{}            `json:"details"`
+		Context map[string]interface{} `json:"context"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(data, &body)
+
+	billingErr := &Error{StatusCode: resp.StatusCode, Code: body.Code, Message: body.Error, Details: body.Context}
+	if reason, ok := body.Details.(string); ok && reason != "" && resp.StatusCode < 500 {
+		if billingErr.Details == nil {
+			billingErr.Details = make(map[string]interface{})
+		}
+		billingErr.Details["reason"] = reason
+	}
+	return billingErr
+}
+
 // Client represents a client for the billing service
 type Client struct {
 	baseURL    string
@@ -129,7 +189,7 @@ func (c *Client) CreateWallet(ctx context.Context, req *WalletCreateRequest) (*W
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var walletResp WalletResponse
@@ -157,7 +217,7 @@ func (c *Client) GetWalletBalance(ctx context.Context, walletID uuid.UUID) (*Bal
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var balanceResp BalanceResponse
@@ -197,7 +257,7 @@ func (c *Client) DepositTokens(ctx context.Context, walletID uuid.UUID, req *Dep
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var txnResp TransactionResponse
@@ -239,7 +299,7 @@ func (c *Client) WithdrawTokens(ctx context.Context, walletID uuid.UUID, req *Wi
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var txnResp TransactionResponse
@@ -267,7 +327,7 @@ func (c *Client) GetPricingRates(ctx context.Context) (map[string]interface{}, e
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var rates map[string]interface{}
@@ -300,7 +360,7 @@ func (c *Client) CalculatePricing(ctx context.Context, req map[string]interface{
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("billing service returned status %d", resp.StatusCode)
+		return nil, errorFromResponse(resp)
 	}
 
 	var pricing map[string]interface{}
@@ -310,3 +370,158 @@ func (c *Client) CalculatePricing(ctx context.Context, req map[string]interface{
 
 	return pricing, nil
 }
+
+// GetPlatformFees gets the platform fees collected, since the given RFC 3339 time if not empty
+func (c *Client) GetPlatformFees(ctx context.Context, since string) (map[string]interface{}, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/billing/platform-fees", c.baseURL)
+	if since != "" {
+		endpoint += "?since=" + url.QueryEscape(since)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get platform fees: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	var fees map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&fees); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return fees, nil
+}
+
+// SearchMarketplace searches rentable GPUs with their current pricing. The query
+// parameters are passed through to the billing service.
+func (c *Client) SearchMarketplace(ctx context.Context, query url.Values) (map[string]interface{}, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/marketplace", c.baseURL)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search marketplace: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result, nil
+}
+
+// JobReservation is one job's share of a funds reservation. The billing service prices
+// it from the GPU model and duration and fills in Amount.
+type JobReservation struct {
+	JobID         string          `json:"job_id"`
+	GPUModel      string          `json:"gpu_model,omitempty"`
+	DurationHours decimal.Decimal `json:"duration_hours"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+// FundsReservationRequest reserves funds for a set of jobs, all or nothing
+type FundsReservationRequest struct {
+	UserID    string           `json:"user_id"`
+	Reference string           `json:"reference,omitempty"`
+	Jobs      []JobReservation `json:"jobs"`
+}
+
+// FundsReservationResponse reports the funds reserved for each job
+type FundsReservationResponse struct {
+	WalletID         uuid.UUID        `json:"wallet_id"`
+	Reference        string           `json:"reference,omitempty"`
+	Jobs             []JobReservation `json:"jobs"`
+	TotalAmount      decimal.Decimal  `json:"total_amount"`
+	AvailableBalance decimal.Decimal  `json:"available_balance"`
+}
+
+// ReserveFunds locks the funds for all of the given jobs on the user's wallet in one
+// step. It returns ErrInsufficientFunds, and reserves nothing, if the wallet can't
+// cover every job.
+func (c *Client) ReserveFunds(ctx context.Context, req *FundsReservationRequest) (*FundsReservationResponse, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal funds reservation request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/reserve-funds", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve funds: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	var reservation FundsReservationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reservation); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	c.logger.Info("Funds reserved",
+		zap.String("user_id", req.UserID),
+		zap.String("reference", req.Reference),
+		zap.String("amount", reservation.TotalAmount.String()),
+	)
+	return &reservation, nil
+}
+
+// ReleaseFunds releases funds reserved for jobs that won't run
+func (c *Client) ReleaseFunds(ctx context.Context, userID string, amount decimal.Decimal, reference string) error {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"user_id":   userID,
+		"amount":    amount,
+		"reference": reference,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal funds release request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/release-funds", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to release funds: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errorFromResponse(resp)
+	}
+	return nil
+}
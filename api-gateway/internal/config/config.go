@@ -18,6 +18,105 @@ type Config struct {
 	JwtSecret      string        `yaml:"jwt_secret"`
 	JwtExpiration  time.Duration `yaml:"jwt_expiration"`  // I'll store this as duration
 	RequestTimeout time.Duration `yaml:"request_timeout"` // Adding the request timeout here
+
+	// RefreshTokenExpiration is how long a refresh token stays valid if it isn't rotated.
+	RefreshTokenExpiration time.Duration `yaml:"refresh_token_expiration"`
+	// RefreshTokenBucket is the NATS key-value bucket refresh tokens are kept in, shared
+	// by every gateway instance so that sessions survive restarts.
+	RefreshTokenBucket string `yaml:"refresh_token_bucket"`
+
+	// MaxJobBatchSize caps how many jobs a single batch submission may contain.
+	MaxJobBatchSize int `yaml:"max_job_batch_size"`
+
+	// ExecSessionTimeout ends interactive exec sessions into job containers; providers
+	// enforce their own limit as well.
+	ExecSessionTimeout time.Duration `yaml:"exec_session_timeout"`
+
+	// IdempotencyKeyTTL is how long the response to a job submission made with an
+	// Idempotency-Key is replayed for repeats of the key.
+	IdempotencyKeyTTL time.Duration `yaml:"idempotency_key_ttl"`
+	// IdempotencyBucket is the NATS key-value bucket the responses are kept in, shared
+	// by every gateway instance.
+	IdempotencyBucket string `yaml:"idempotency_bucket"`
+
+	// MaxSubmissionBodySize caps the size of a job submission's request body, in bytes.
+	MaxSubmissionBodySize int64 `yaml:"max_submission_body_size"`
+
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Webhooks    WebhookConfig     `yaml:"webhooks"`
+	Compression CompressionConfig `yaml:"compression"`
+	JobLimits   JobLimitConfig    `yaml:"job_limits"`
+
+	// CircuitBreaker keeps the proxy from routing to backend instances that keep failing.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig controls the per-instance circuit breaker of the service proxy.
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold"` // Consecutive failures that open an instance's circuit
+	Cooldown         time.Duration `yaml:"cooldown"`          // How long an open instance is skipped before it is probed
+}
+
+// JobLimitConfig caps how many unfinished jobs a user may have at once. A negative
+// limit means no limit.
+type JobLimitConfig struct {
+	MaxConcurrentJobs int            `yaml:"max_concurrent_jobs"` // Default for every user
+	Roles             map[string]int `yaml:"roles"`               // Limits for users with these roles
+	SubmissionsBucket string         `yaml:"submissions_bucket"`  // NATS key-value bucket of jobs the scheduler may not have recorded yet
+}
+
+// Limit returns the concurrent job limit for a user with the given role. A user's own
+// limit, if non-zero, takes precedence over their role's and the default.
+func (c JobLimitConfig) Limit(role string, userLimit int) int {
+	if userLimit != 0 {
+		return userLimit
+	}
+	if limit, ok := c.Roles[role]; ok {
+		return limit
+	}
+	return c.MaxConcurrentJobs
+}
+
+// CompressionConfig controls gzip compression of responses for clients that accept it.
+type CompressionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Level        int      `yaml:"level"`         // gzip level 1-9; 0 picks the default
+	MinSize      int      `yaml:"min_size"`      // Smaller responses aren't worth compressing
+	ContentTypes []string `yaml:"content_types"` // Media types to compress; "text/*" matches every text type
+}
+
+// WebhookConfig controls delivery of job lifecycle notifications to the webhook URL
+// given at submission.
+type WebhookConfig struct {
+	SigningSecret     string        `yaml:"signing_secret"` // Per-user signing secrets are derived from this
+	Timeout           time.Duration `yaml:"timeout"`        // Per delivery attempt
+	MaxAttempts       int           `yaml:"max_attempts"`
+	InitialBackoff    time.Duration `yaml:"initial_backoff"` // Doubled after every failed attempt
+	MaxBackoff        time.Duration `yaml:"max_backoff"`
+	MaxWatch          time.Duration `yaml:"max_watch"`           // How long I follow a job that never finishes
+	DeadLetterSubject string        `yaml:"dead_letter_subject"` // NATS subject for notifications that couldn't be delivered
+	WatchBucket       string        `yaml:"watch_bucket"`        // NATS key-value bucket holding the watched jobs
+	// AllowPrivateTargets permits webhooks on loopback, private and link-local
+	// addresses, for development against a local receiver.
+	AllowPrivateTargets bool `yaml:"allow_private_targets"`
+}
+
+// RateLimitConfig holds the token bucket limits for /api/v1, applied per user (or per IP
+// for unauthenticated requests).
+type RateLimitConfig struct {
+	Enabled           bool             `yaml:"enabled"`
+	RequestsPerMinute int              `yaml:"requests_per_minute"` // Default limit for every route
+	Burst             int              `yaml:"burst"`
+	Routes            []RouteRateLimit `yaml:"routes"` // Stricter or looser limits for specific routes
+}
+
+// RouteRateLimit overrides the default limit for requests whose path starts with PathPrefix.
+type RouteRateLimit struct {
+	Method            string `yaml:"method"` // Empty matches every method
+	PathPrefix        string `yaml:"path_prefix"`
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+	Burst             int    `yaml:"burst"`
 }
 
 // LoadConfig reads configuration from the given YAML file path.
@@ -32,6 +131,52 @@ func LoadConfig(path string) (*Config, error) {
 		JwtSecret:      "default-very-secure-jwt-secret-key-change-in-production",
 		JwtExpiration:  60 * time.Minute, // Defaulting to 60 minutes
 		RequestTimeout: 60 * time.Second, // Defaulting to 60 seconds
+
+		RefreshTokenExpiration: 7 * 24 * time.Hour,
+		RefreshTokenBucket:     "refresh_tokens",
+		MaxJobBatchSize:        100,
+		ExecSessionTimeout:     30 * time.Minute,
+		IdempotencyKeyTTL:      24 * time.Hour,
+		IdempotencyBucket:      "job_idempotency",
+		MaxSubmissionBodySize:  4 << 20,
+		RateLimit: RateLimitConfig{
+			Enabled:           true,
+			RequestsPerMinute: 120,
+			Burst:             30,
+			Routes: []RouteRateLimit{
+				{Method: "POST", PathPrefix: "/api/v1/jobs", RequestsPerMinute: 20, Burst: 5},
+			},
+		},
+		Webhooks: WebhookConfig{
+			SigningSecret:     "default-webhook-signing-secret-change-in-production",
+			Timeout:           10 * time.Second,
+			MaxAttempts:       5,
+			InitialBackoff:    2 * time.Second,
+			MaxBackoff:        2 * time.Minute,
+			MaxWatch:          72 * time.Hour,
+			DeadLetterSubject: "jobs.webhooks.dead_letter",
+			WatchBucket:       "webhook_watches",
+		},
+		Compression: CompressionConfig{
+			Enabled: true,
+			MinSize: 1024,
+			ContentTypes: []string{
+				"application/json",
+				"application/javascript",
+				"application/xml",
+				"text/*",
+			},
+		},
+		JobLimits: JobLimitConfig{
+			MaxConcurrentJobs: 10,
+			Roles:             map[string]int{"admin": -1},
+			SubmissionsBucket: "job_submissions",
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: 5,
+			Cooldown:         30 * time.Second,
+		},
 	}
 
 	// I need to check if the config file exists.
@@ -101,6 +246,81 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	if cfg.RequestTimeout == 0 {
 		cfg.RequestTimeout = defaults.RequestTimeout
 	}
+	if cfg.RefreshTokenExpiration == 0 {
+		cfg.RefreshTokenExpiration = defaults.RefreshTokenExpiration
+	}
+	if cfg.RefreshTokenBucket == "" {
+		cfg.RefreshTokenBucket = defaults.RefreshTokenBucket
+	}
+	if cfg.MaxJobBatchSize == 0 {
+		cfg.MaxJobBatchSize = defaults.MaxJobBatchSize
+	}
+	if cfg.ExecSessionTimeout == 0 {
+		cfg.ExecSessionTimeout = defaults.ExecSessionTimeout
+	}
+	if cfg.IdempotencyKeyTTL == 0 {
+		cfg.IdempotencyKeyTTL = defaults.IdempotencyKeyTTL
+	}
+	if cfg.IdempotencyBucket == "" {
+		cfg.IdempotencyBucket = defaults.IdempotencyBucket
+	}
+	if cfg.MaxSubmissionBodySize == 0 {
+		cfg.MaxSubmissionBodySize = defaults.MaxSubmissionBodySize
+	}
+	if cfg.RateLimit.RequestsPerMinute == 0 {
+		cfg.RateLimit.RequestsPerMinute = defaults.RateLimit.RequestsPerMinute
+	}
+	if cfg.RateLimit.Burst == 0 {
+		cfg.RateLimit.Burst = defaults.RateLimit.Burst
+	}
+	if cfg.Webhooks.SigningSecret == "" {
+		cfg.Webhooks.SigningSecret = defaults.Webhooks.SigningSecret
+	}
+	if cfg.Webhooks.Timeout == 0 {
+		cfg.Webhooks.Timeout = defaults.Webhooks.Timeout
+	}
+	if cfg.Webhooks.MaxAttempts == 0 {
+		cfg.Webhooks.MaxAttempts = defaults.Webhooks.MaxAttempts
+	}
+	if cfg.Webhooks.InitialBackoff == 0 {
+		cfg.Webhooks.InitialBackoff = defaults.Webhooks.InitialBackoff
+	}
+	if cfg.Webhooks.MaxBackoff == 0 {
+		cfg.Webhooks.MaxBackoff = defaults.Webhooks.MaxBackoff
+	}
+	if cfg.Webhooks.MaxWatch == 0 {
+		cfg.Webhooks.MaxWatch = defaults.Webhooks.MaxWatch
+	}
+	if cfg.Webhooks.DeadLetterSubject == "" {
+		cfg.Webhooks.DeadLetterSubject = defaults.Webhooks.DeadLetterSubject
+	}
+	if cfg.Webhooks.WatchBucket == "" {
+		cfg.Webhooks.WatchBucket = defaults.Webhooks.WatchBucket
+	}
+	if cfg.Compression.MinSize == 0 {
+		cfg.Compression.MinSize = defaults.Compression.MinSize
+	}
+	if len(cfg.Compression.ContentTypes) == 0 {
+		cfg.Compression.ContentTypes = defaults.Compression.ContentTypes
+	}
+	if cfg.JobLimits.MaxConcurrentJobs == 0 {
+		cfg.JobLimits.MaxConcurrentJobs = defaults.JobLimits.MaxConcurrentJobs
+	}
+	if cfg.JobLimits.Roles == nil {
+		cfg.JobLimits.Roles = defaults.JobLimits.Roles
+	}
+	if cfg.JobLimits.SubmissionsBucket == "" {
+		cfg.JobLimits.SubmissionsBucket = defaults.JobLimits.SubmissionsBucket
+	}
+	if cfg.CircuitBreaker == (CircuitBreakerConfig{}) {
+		cfg.CircuitBreaker = defaults.CircuitBreaker
+	}
+	if cfg.CircuitBreaker.FailureThreshold <= 0 {
+		cfg.CircuitBreaker.FailureThreshold = defaults.CircuitBreaker.FailureThreshold
+	}
+	if cfg.CircuitBreaker.Cooldown <= 0 {
+		cfg.CircuitBreaker.Cooldown = defaults.CircuitBreaker.Cooldown
+	}
 }
 
 // Helper function to create the config directory if it doesn't exist
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/billing"
+	"go.uber.org/zap"
+)
+
+// providerRegistryService is the Consul name of the provider registry.
+const providerRegistryService = "provider-registry"
+
+// AdminHandler serves the admin-only routes under /api/v1/admin.
+// Routes must be protected with the RequireRole middleware.
+type AdminHandler struct {
+	Logger        *zap.Logger
+	Proxy         *ProxyHandler
+	BillingClient *billing.Client
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(logger *zap.Logger, proxy *ProxyHandler, billingClient *billing.Client) *AdminHandler {
+	return &AdminHandler{Logger: logger, Proxy: proxy, BillingClient: billingClient}
+}
+
+// ListProviders returns the registered providers from the provider registry. Query
+// parameters, such as status filters, are passed through.
+func (h *AdminHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	h.Proxy.Forward(w, r, providerRegistryService, "/providers")
+}
+
+// GetPlatformFees returns the platform fees collected, optionally since the RFC 3339
+// time in the since query parameter.
+func (h *AdminHandler) GetPlatformFees(w http.ResponseWriter, r *http.Request) {
+	fees, err := h.BillingClient.GetPlatformFees(r.Context(), r.URL.Query().Get("since"))
+	if err != nil {
+		h.Logger.Error("Failed to get platform fees", zap.Error(err))
+		writeBillingError(w, err, "Failed to get platform fees")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fees); err != nil {
+		h.Logger.Error("Failed to encode platform fees response", zap.Error(err))
+	}
+}
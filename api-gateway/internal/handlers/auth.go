@@ -2,25 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
 	"go.uber.org/zap"
 )
 
 // AuthHandler holds dependencies for authentication handlers.
-// I need the logger and config (for JWT secret/expiration).
+// I need the logger, config (for JWT secret/expiration) and the refresh token manager.
 type AuthHandler struct {
-	Logger *zap.Logger
-	Config *config.Config
+	Logger        *zap.Logger
+	Config        *config.Config
+	RefreshTokens *auth.RefreshTokens
 }
 
 // NewAuthHandler creates a new AuthHandler.
-func NewAuthHandler(logger *zap.Logger, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{Logger: logger, Config: cfg}
+func NewAuthHandler(logger *zap.Logger, cfg *config.Config, refreshTokens *auth.RefreshTokens) *AuthHandler {
+	return &AuthHandler{Logger: logger, Config: cfg, RefreshTokens: refreshTokens}
 }
 
 // LoginRequest defines the structure for the login request body.
@@ -29,13 +32,20 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// LoginResponse defines the structure for the login response body.
+// LoginResponse defines the structure for the login and refresh response bodies.
 type LoginResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	UserID    string    `json:"user_id"`
-	Username  string    `json:"username"`
-	Role      string    `json:"role"`
+	Token                 string    `json:"token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	UserID                string    `json:"user_id"`
+	Username              string    `json:"username"`
+	Role                  string    `json:"role"`
+}
+
+// RefreshRequest defines the structure for the refresh and logout request bodies.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 // Login handles user login requests.
@@ -45,13 +55,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// I need to decode the request body.
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.Logger.Error("Failed to decode login request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// I should validate the input (basic validation here).
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		apierror.Error(w, "Username and password are required", http.StatusBadRequest)
 		return
 	}
 
@@ -59,7 +69,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	user, found := auth.FindUserByUsername(req.Username)
 	if !found {
 		h.Logger.Warn("Login attempt for non-existent user", zap.String("username", req.Username))
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		apierror.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
@@ -67,25 +77,33 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// In a real app, I'd use bcrypt.CompareHashAndPassword.
 	if user.Password != req.Password {
 		h.Logger.Warn("Incorrect password attempt", zap.String("username", req.Username))
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		apierror.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
-	// If credentials are valid, I should generate a JWT.
+	// If credentials are valid, I should generate a JWT and start a new refresh token family.
 	tokenString, expiresAt, err := auth.GenerateJWT(user, h.Config.JwtSecret, h.Config.JwtExpiration)
 	if err != nil {
 		h.Logger.Error("Failed to generate JWT", zap.Error(err))
-		http.Error(w, "Failed to process login", http.StatusInternalServerError)
+		apierror.Error(w, "Failed to process login", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, refreshExpiresAt, err := h.RefreshTokens.Issue(user)
+	if err != nil {
+		h.Logger.Error("Failed to issue refresh token", zap.Error(err))
+		apierror.Error(w, "Failed to process login", http.StatusInternalServerError)
 		return
 	}
 
 	// I need to build the response.
 	resp := LoginResponse{
-		Token:     tokenString,
-		ExpiresAt: expiresAt,
-		UserID:    user.ID,
-		Username:  user.Username,
-		Role:      user.Role,
+		Token:                 tokenString,
+		ExpiresAt:             expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+		UserID:                user.ID,
+		Username:              user.Username,
+		Role:                  user.Role,
 	}
 
 	// I should send the response back as JSON.
@@ -97,13 +115,91 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Refresh exchanges a refresh token for a new JWT and a new refresh token.
+// The presented refresh token is invalidated, so each one can be used only once.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		apierror.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	old, refreshToken, refreshExpiresAt, err := h.RefreshTokens.Rotate(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			// Someone replayed a rotated token; I've revoked the whole login to be safe.
+			h.Logger.Warn("Refresh token reuse detected, revoked the login's tokens")
+		} else if !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+			h.Logger.Error("Failed to rotate refresh token", zap.Error(err))
+			apierror.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+			return
+		}
+		apierror.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// I look the user up again so that removed users can't keep refreshing and role changes apply.
+	user, found := auth.FindUserByUsername(old.Username)
+	if !found || user.ID != old.UserID {
+		h.RefreshTokens.Revoke(refreshToken)
+		h.Logger.Warn("Refresh for unknown user", zap.String("user_id", old.UserID))
+		apierror.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	tokenString, expiresAt, err := auth.GenerateJWT(user, h.Config.JwtSecret, h.Config.JwtExpiration)
+	if err != nil {
+		h.Logger.Error("Failed to generate JWT", zap.Error(err))
+		apierror.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	resp := LoginResponse{
+		Token:                 tokenString,
+		ExpiresAt:             expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+		UserID:                user.ID,
+		Username:              user.Username,
+		Role:                  user.Role,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Error("Failed to encode refresh response", zap.Error(err))
+	}
+}
+
+// Logout revokes the given refresh token, along with every token rotated from the same login.
+// Access tokens already issued stay valid until they expire.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		apierror.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.RefreshTokens.Revoke(req.RefreshToken); err != nil {
+		h.Logger.Error("Failed to revoke refresh token", zap.Error(err))
+		apierror.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // RegisterRequest defines the structure for the registration request body.
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Role     string `json:"role"` // Allowing role specification for simplicity, maybe restrict this.
+	Role     string `json:"role"` // Optional; self-registration only creates "user" accounts
 }
 
+// registeredRole is the role of every self-registered account. Other roles, such as
+// admin, are never granted through registration.
+const registeredRole = "user"
+
 // RegisterResponse defines the structure for the registration response body.
 type RegisterResponse struct {
 	Message string `json:"message"`
@@ -116,25 +212,26 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// I need to decode the request body.
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.Logger.Error("Failed to decode register request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// I should perform basic validation.
 	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		apierror.Error(w, "Username and password are required", http.StatusBadRequest)
 		return
 	}
-	// Maybe validate the role?
-	if req.Role == "" {
-		req.Role = "user" // Default role
+	if req.Role != "" && req.Role != registeredRole {
+		h.Logger.Warn("Registration requested a privileged role", zap.String("username", req.Username), zap.String("role", req.Role))
+		apierror.Error(w, "Only user accounts can be registered", http.StatusBadRequest)
+		return
 	}
 
 	// Create a new user object (in reality, hash the password first!)
 	newUser := &auth.User{
 		Username: req.Username,
 		Password: req.Password, // Store plain text temporarily (INSECURE)
-		Role:     req.Role,
+		Role:     registeredRole,
 	}
 
 	// Attempt to add the user (using mock function)
@@ -142,9 +239,9 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Warn("Failed to register user", zap.String("username", req.Username), zap.Error(err))
 		if strings.Contains(err.Error(), "already exists") {
-			http.Error(w, err.Error(), http.StatusConflict) // 409 Conflict
+			apierror.Error(w, err.Error(), http.StatusConflict) // 409 Conflict
 		} else {
-			http.Error(w, "Failed to register user", http.StatusInternalServerError)
+			apierror.Error(w, "Failed to register user", http.StatusInternalServerError)
 		}
 		return
 	}
@@ -167,6 +264,8 @@ type ProfileResponse struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// MaxConcurrentJobs is how many unfinished jobs the user may have; omitted if unlimited
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty"`
 }
 
 // Profile handles requests to get the current user's profile.
@@ -177,7 +276,7 @@ func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	if !ok || claims == nil {
 		h.Logger.Error("Claims not found in context for profile request")
 		// This should ideally not happen if the middleware is correctly applied.
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierror.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 
@@ -187,6 +286,9 @@ func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 		Username: claims.Username,
 		Role:     claims.Role,
 	}
+	if limit := concurrentJobLimit(h.Config, claims); limit > 0 {
+		resp.MaxConcurrentJobs = limit
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
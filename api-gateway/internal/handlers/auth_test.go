@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// postJSON sends body to the handler and returns the response
+func postJSON(handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/", bytes.NewReader(data)))
+	return rec
+}
+
+func TestRegisterNeverGrantsAdmin(t *testing.T) {
+	cfg := &config.Config{JwtSecret: "test-secret", JwtExpiration: time.Hour}
+	h := NewAuthHandler(zap.NewNop(), cfg, auth.NewRefreshTokens(auth.NewMemoryRefreshTokenStore(), time.Hour))
+
+	for _, role := range []string{"admin", "Admin", "provider"} {
+		username := "register-" + uuid.NewString()
+		rec := postJSON(h.Register, RegisterRequest{Username: username, Password: "secret", Role: role})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("registering with role %q: status %d, want 400", role, rec.Code)
+		}
+		if _, found := auth.FindUserByUsername(username); found {
+			t.Errorf("account created with role %q", role)
+		}
+	}
+
+	// Without a role, or asking for user, the account is a user
+	for _, role := range []string{"", "user"} {
+		username := "register-" + uuid.NewString()
+		if rec := postJSON(h.Register, RegisterRequest{Username: username, Password: "secret", Role: role}); rec.Code != http.StatusCreated {
+			t.Fatalf("registering with role %q: status %d, want 201", role, rec.Code)
+		}
+		rec := postJSON(h.Login, LoginRequest{Username: username, Password: "secret"})
+		var login LoginResponse
+		if err := json.NewDecoder(rec.Body).Decode(&login); err != nil {
+			t.Fatalf("login: status %d: %v", rec.Code, err)
+		}
+		claims, err := auth.ValidateJWT(login.Token, cfg.JwtSecret)
+		if err != nil {
+			t.Fatalf("ValidateJWT: %v", err)
+		}
+		if claims.Role != "user" || login.Role != "user" {
+			t.Errorf("registered with role %q: token role %q, response role %q; want user", role, claims.Role, login.Role)
+		}
+	}
+}
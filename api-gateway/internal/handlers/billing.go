@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/billing"
 )
 
@@ -31,14 +33,14 @@ func (h *BillingHandler) CreateWallet(w http.ResponseWriter, r *http.Request) {
 	var req billing.WalletCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("Failed to decode wallet creation request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	wallet, err := h.billingClient.CreateWallet(r.Context(), &req)
 	if err != nil {
 		h.logger.Error("Failed to create wallet", zap.Error(err))
-		http.Error(w, "Failed to create wallet", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to create wallet")
 		return
 	}
 
@@ -53,14 +55,14 @@ func (h *BillingHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request
 	walletID, err := uuid.Parse(walletIDStr)
 	if err != nil {
 		h.logger.Error("Invalid wallet ID", zap.String("wallet_id", walletIDStr), zap.Error(err))
-		http.Error(w, "Invalid wallet ID", http.StatusBadRequest)
+		apierror.Error(w, "Invalid wallet ID", http.StatusBadRequest)
 		return
 	}
 
 	balance, err := h.billingClient.GetWalletBalance(r.Context(), walletID)
 	if err != nil {
 		h.logger.Error("Failed to get wallet balance", zap.String("wallet_id", walletIDStr), zap.Error(err))
-		http.Error(w, "Failed to get wallet balance", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to get wallet balance")
 		return
 	}
 
@@ -74,21 +76,21 @@ func (h *BillingHandler) DepositTokens(w http.ResponseWriter, r *http.Request) {
 	walletID, err := uuid.Parse(walletIDStr)
 	if err != nil {
 		h.logger.Error("Invalid wallet ID", zap.String("wallet_id", walletIDStr), zap.Error(err))
-		http.Error(w, "Invalid wallet ID", http.StatusBadRequest)
+		apierror.Error(w, "Invalid wallet ID", http.StatusBadRequest)
 		return
 	}
 
 	var req billing.DepositRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("Failed to decode deposit request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	transaction, err := h.billingClient.DepositTokens(r.Context(), walletID, &req)
 	if err != nil {
 		h.logger.Error("Failed to process deposit", zap.Error(err))
-		http.Error(w, "Failed to process deposit", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to process deposit")
 		return
 	}
 
@@ -102,21 +104,21 @@ func (h *BillingHandler) WithdrawTokens(w http.ResponseWriter, r *http.Request)
 	walletID, err := uuid.Parse(walletIDStr)
 	if err != nil {
 		h.logger.Error("Invalid wallet ID", zap.String("wallet_id", walletIDStr), zap.Error(err))
-		http.Error(w, "Invalid wallet ID", http.StatusBadRequest)
+		apierror.Error(w, "Invalid wallet ID", http.StatusBadRequest)
 		return
 	}
 
 	var req billing.WithdrawalRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("Failed to decode withdrawal request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	transaction, err := h.billingClient.WithdrawTokens(r.Context(), walletID, &req)
 	if err != nil {
 		h.logger.Error("Failed to process withdrawal", zap.Error(err))
-		http.Error(w, "Failed to process withdrawal", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to process withdrawal")
 		return
 	}
 
@@ -129,7 +131,7 @@ func (h *BillingHandler) GetPricingRates(w http.ResponseWriter, r *http.Request)
 	rates, err := h.billingClient.GetPricingRates(r.Context())
 	if err != nil {
 		h.logger.Error("Failed to get pricing rates", zap.Error(err))
-		http.Error(w, "Failed to get pricing rates", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to get pricing rates")
 		return
 	}
 
@@ -142,14 +144,14 @@ func (h *BillingHandler) CalculatePricing(w http.ResponseWriter, r *http.Request
 	var req map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("Failed to decode pricing request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	pricing, err := h.billingClient.CalculatePricing(r.Context(), req)
 	if err != nil {
 		h.logger.Error("Failed to calculate pricing", zap.Error(err))
-		http.Error(w, "Failed to calculate pricing", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to calculate pricing")
 		return
 	}
 
@@ -161,7 +163,7 @@ func (h *BillingHandler) CalculatePricing(w http.ResponseWriter, r *http.Request
 func (h *BillingHandler) GetUserWallet(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "userID")
 	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		apierror.Error(w, "User ID is required", http.StatusBadRequest)
 		return
 	}
 
@@ -180,7 +182,7 @@ func (h *BillingHandler) GetUserWallet(w http.ResponseWriter, r *http.Request) {
 func (h *BillingHandler) GetUserBalance(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "userID")
 	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		apierror.Error(w, "User ID is required", http.StatusBadRequest)
 		return
 	}
 
@@ -198,55 +200,18 @@ func (h *BillingHandler) GetUserBalance(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetGPUMarketplace gets available GPUs with pricing
+// GetGPUMarketplace searches available GPUs with their live pricing. Filters, sorting
+// and pagination are passed through to the billing service.
 func (h *BillingHandler) GetGPUMarketplace(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	gpuType := r.URL.Query().Get("gpu_type")
-	minVRAM := r.URL.Query().Get("min_vram")
-	maxPrice := r.URL.Query().Get("max_price")
-
-	h.logger.Info("Getting GPU marketplace",
-		zap.String("gpu_type", gpuType),
-		zap.String("min_vram", minVRAM),
-		zap.String("max_price", maxPrice),
-	)
-
-	// This would integrate with provider registry and pricing service
-	// For now, return a placeholder response
-	response := map[string]interface{}{
-		"gpus": []map[string]interface{}{
-			{
-				"provider_id":      "provider-1",
-				"gpu_model":        "NVIDIA RTX 4090",
-				"vram_total":       24576,
-				"vram_available":   24576,
-				"hourly_rate":      "0.50",
-				"vram_rate_per_gb": "0.02",
-				"power_rate":       "0.001",
-				"location":         "US-East",
-				"availability":     "available",
-			},
-			{
-				"provider_id":      "provider-2",
-				"gpu_model":        "NVIDIA A100",
-				"vram_total":       81920,
-				"vram_available":   81920,
-				"hourly_rate":      "2.00",
-				"vram_rate_per_gb": "0.025",
-				"power_rate":       "0.001",
-				"location":         "US-West",
-				"availability":     "available",
-			},
-		},
-		"filters": map[string]interface{}{
-			"gpu_type":  gpuType,
-			"min_vram":  minVRAM,
-			"max_price": maxPrice,
-		},
+	results, err := h.billingClient.SearchMarketplace(r.Context(), r.URL.Query())
+	if err != nil {
+		h.logger.Error("Failed to search GPU marketplace", zap.Error(err))
+		writeBillingError(w, err, "Failed to search GPU marketplace")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(results)
 }
 
 // EstimateJobCost estimates the cost of a GPU rental job
@@ -256,32 +221,36 @@ func (h *BillingHandler) EstimateJobCost(w http.ResponseWriter, r *http.Request)
 		VRAMRequired    uint64  `json:"vram_required_mb"`
 		EstimatedHours  float64 `json:"estimated_hours"`
 		EstimatedPowerW uint32  `json:"estimated_power_w"`
+		Location        string  `json:"location,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("Failed to decode cost estimation request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Calculate estimated cost using pricing service
 	pricingReq := map[string]interface{}{
 		"gpu_model":         req.GPUModel,
-		"requested_vram":    req.VRAMRequired,
+		"requested_vram_mb": req.VRAMRequired,
 		"duration_hours":    req.EstimatedHours,
 		"estimated_power_w": req.EstimatedPowerW,
+		"location":          req.Location,
 	}
 
 	pricing, err := h.billingClient.CalculatePricing(r.Context(), pricingReq)
 	if err != nil {
 		h.logger.Error("Failed to calculate pricing", zap.Error(err))
-		http.Error(w, "Failed to calculate pricing", http.StatusInternalServerError)
+		writeBillingError(w, err, "Failed to calculate pricing")
 		return
 	}
 
 	response := map[string]interface{}{
-		"estimated_cost": pricing,
-		"currency":       "dGPU",
+		"estimated_cost":       pricing,
+		"currency":             "dGPU",
+		"estimated_energy_kwh": pricing["estimated_energy_kwh"],
+		"carbon_footprint_kg":  pricing["carbon_footprint_kg"],
 		"breakdown": map[string]interface{}{
 			"base_cost":    "calculated from pricing service",
 			"vram_cost":    "calculated from pricing service",
@@ -300,7 +269,7 @@ func (h *BillingHandler) GetTransactionHistory(w http.ResponseWriter, r *http.Re
 	walletID, err := uuid.Parse(walletIDStr)
 	if err != nil {
 		h.logger.Error("Invalid wallet ID", zap.String("wallet_id", walletIDStr), zap.Error(err))
-		http.Error(w, "Invalid wallet ID", http.StatusBadRequest)
+		apierror.Error(w, "Invalid wallet ID", http.StatusBadRequest)
 		return
 	}
 
@@ -341,3 +310,19 @@ func (h *BillingHandler) GetTransactionHistory(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// writeBillingError answers a request the billing client failed, passing the billing
+// service's error through as the matching gateway error. Failures to reach the billing
+// service are answered with 502 and message.
+func writeBillingError(w http.ResponseWriter, err error, message string) {
+	var billingErr *billing.Error
+	if !errors.As(err, &billingErr) {
+		apierror.Error(w, message, http.StatusBadGateway)
+		return
+	}
+	status, resp := apierror.FromBilling(billingErr.StatusCode, billingErr.Code, billingErr.Message, billingErr.Details)
+	if resp.Message == "" || status >= 500 {
+		resp.Message = message
+	}
+	apierror.Write(w, status, resp)
+}
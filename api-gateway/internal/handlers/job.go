@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/billing"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/metrics"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 )
 
@@ -21,11 +29,71 @@ type JobHandler struct {
 	Config   *config.Config
 	NatsConn *nats.Conn
 	// NatsJS nats.JetStreamContext // I might need JetStream later for guaranteed delivery
+	Webhooks *webhook.Dispatcher
+	Billing  *billing.Client // Reserves funds for batch submissions
+	Proxy    *ProxyHandler   // Fetches job logs from the storage-service
+
+	// Submissions holds the jobs each user submitted that the scheduler may not have
+	// recorded yet, so they count against the user's concurrent job limit.
+	Submissions SubmissionStore
+
+	// countActiveJobs asks the scheduler about a user's jobs; requestActiveJobs unless
+	// replaced in tests.
+	countActiveJobs func(ctx context.Context, userID string, jobIDs []string) (*activeJobs, error)
+	// requestScheduler makes a NATS request to the scheduler and returns the reply's
+	// data; replaced in tests.
+	requestScheduler func(ctx context.Context, subject string, data []byte) ([]byte, error)
+
+	// IdempotencyKeys holds the responses to submissions made with an Idempotency-Key.
+	IdempotencyKeys IdempotencyStore
+}
+
+const (
+	// streamWriteWait is how long I allow a single WebSocket write to take.
+	streamWriteWait = 10 * time.Second
+	// streamPongWait is how long I wait for a pong before treating the client as gone.
+	streamPongWait = 60 * time.Second
+	// streamPingPeriod must be shorter than streamPongWait.
+	streamPingPeriod = (streamPongWait * 9) / 10
+)
+
+// streamUpgrader upgrades job status stream requests to WebSocket connections.
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// terminalJobStatuses are the task statuses after which no further updates are sent.
+var terminalJobStatuses = map[string]bool{
+	"completed": true,
+	"failed":    true,
+	"canceled":  true,
+	"cancelled": true,
+	"timeout":   true,
 }
 
 // NewJobHandler creates a new JobHandler.
-func NewJobHandler(logger *zap.Logger, cfg *config.Config, nc *nats.Conn) *JobHandler {
-	return &JobHandler{Logger: logger, Config: cfg, NatsConn: nc}
+func NewJobHandler(logger *zap.Logger, cfg *config.Config, nc *nats.Conn, webhooks *webhook.Dispatcher, billingClient *billing.Client, proxy *ProxyHandler, submissions SubmissionStore, idempotencyKeys IdempotencyStore) *JobHandler {
+	h := &JobHandler{
+		Logger:      logger,
+		Config:      cfg,
+		NatsConn:    nc,
+		Webhooks:    webhooks,
+		Billing:     billingClient,
+		Proxy:       proxy,
+		Submissions: submissions,
+
+		IdempotencyKeys: idempotencyKeys,
+	}
+	h.countActiveJobs = h.requestActiveJobs
+	h.requestScheduler = func(ctx context.Context, subject string, data []byte) ([]byte, error) {
+		reply, err := nc.RequestWithContext(ctx, subject, data)
+		if err != nil {
+			return nil, err
+		}
+		return reply.Data, nil
+	}
+	return h
 }
 
 // SubmitJobRequest defines the structure for the job submission request body.
@@ -39,10 +107,40 @@ type SubmitJobRequest struct {
 	Priority    int                    `json:"priority,omitempty"`
 	Params      map[string]interface{} `json:"params"`
 	Tags        []string               `json:"tags,omitempty"`
+	// GPU architecture the job's code targets, by name ("Hopper") or CUDA target ("sm_90"),
+	// and the minimum CUDA compute capability; the scheduler only places the job on matching GPUs
+	GPUArchitecture      string  `json:"gpu_architecture,omitempty"`
+	MinComputeCapability float64 `json:"min_compute_capability,omitempty"`
+	// Placement preferences, enforced by the scheduler
+	PreferredProviders []string `json:"preferred_providers,omitempty"`
+	ExcludedProviders  []string `json:"excluded_providers,omitempty"`
+	PreferredLocation  string   `json:"preferred_location,omitempty"`
+	// Maximum run time in minutes, used for cost estimates
+	MaxDurationMinutes int `json:"max_duration_minutes,omitempty"`
+	// DryRun asks the scheduler for a placement decision and cost estimate only;
+	// no funds are reserved and nothing is dispatched
+	DryRun bool `json:"dry_run,omitempty"`
+	// NotificationWebhook is POSTed a signed event when the job starts running and when it finishes
+	NotificationWebhook string `json:"notification_webhook,omitempty"`
+	// Execution spec as sent by the rental client: docker, script, python, bash or wasm,
+	// and the image, script or module the execution type needs
+	ExecutionType string `json:"execution_type,omitempty"`
+	DockerImage   string `json:"docker_image,omitempty"`
+	Script        string `json:"script,omitempty"`
+	WASMModule    string `json:"wasm_module,omitempty"`
+	// Most the user is willing to pay for the job, in dGPU
+	MaxCostDGPU  decimal.Decimal  `json:"max_cost_dgpu"`
+	Requirements *JobRequirements `json:"requirements,omitempty"`
 	// I might add UserID from context later
 	UserID string `json:"-"` // Added internally from JWT
 }
 
+// JobRequirements holds the job's VRAM requirements, in MB.
+type JobRequirements struct {
+	GPUMemoryMB    int64 `json:"gpu_memory_mb,omitempty"`
+	MinGPUMemoryMB int64 `json:"min_gpu_memory_mb,omitempty"`
+}
+
 // SubmitJobResponse defines the structure for the job submission response body.
 type SubmitJobResponse struct {
 	JobID     string    `json:"job_id"`
@@ -58,13 +156,13 @@ func (h *JobHandler) SubmitJob(w http.ResponseWriter, r *http.Request) {
 	// I need to decode the request body.
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.Logger.Error("Failed to decode job submission request", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// I should perform basic validation.
-	if req.Type == "" || req.Name == "" || len(req.Params) == 0 {
-		http.Error(w, "Type, name, and params are required fields", http.StatusBadRequest)
+	// I should validate the job before anything is reserved or published for it.
+	if errs := req.Validate(); len(errs) > 0 {
+		h.writeValidationErrors(w, errs)
 		return
 	}
 
@@ -72,7 +170,7 @@ func (h *JobHandler) SubmitJob(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(auth.ContextKeyClaims).(*auth.Claims)
 	if !ok || claims == nil {
 		h.Logger.Error("Claims not found in context for job submission")
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		apierror.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 	req.UserID = claims.UserID
@@ -80,80 +178,241 @@ func (h *JobHandler) SubmitJob(w http.ResponseWriter, r *http.Request) {
 	// I need to generate a unique Job ID.
 	jobID := uuid.New().String()
 
+	if req.DryRun {
+		h.dryRunJob(w, r, req, jobID)
+		return
+	}
+
+	if err := h.reserveJobSlots(r.Context(), claims, []string{jobID}); err != nil {
+		h.writeJobLimitError(w, claims, err)
+		return
+	}
+
+	if err := h.publishJob(req, jobID, decimal.Zero); err != nil {
+		h.releaseJobSlots(claims.UserID, []string{jobID})
+		if errors.Is(err, errWebhookRegistration) {
+			apierror.Error(w, "Failed to register notification webhook", http.StatusInternalServerError)
+			return
+		}
+		apierror.Error(w, "Failed to submit job via message queue", http.StatusInternalServerError)
+		return
+	}
+
+	// Respond with success message.
+	resp := SubmitJobResponse{
+		JobID:     jobID,
+		Status:    "queued", // Initial status
+		Timestamp: time.Now(),
+		Message:   "Job submitted successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted) // 202 Accepted for async processing
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Error("Failed to encode job submission response", zap.Error(err))
+	}
+}
+
+// writeValidationErrors rejects an invalid submission with 400, listing its problems
+// in the details' validation_errors.
+func (h *JobHandler) writeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	apierror.Write(w, http.StatusBadRequest, apierror.Response{
+		Code:    apierror.CodeValidation,
+		Message: "Job submission is invalid",
+		Details: map[string]interface{}{"validation_errors": []string(errs)},
+	})
+}
+
+// errWebhookRegistration is returned by publishJob when the job's notification webhook
+// can't be watched; the job is not published then.
+var errWebhookRegistration = errors.New("failed to register notification webhook")
+
+// publishJob publishes a validated job to the scheduler, together with the funds
+// reserved for it, if any. The job ID doubles as the JetStream message ID so a
+// retried publish is de-duplicated by the scheduler's job stream.
+func (h *JobHandler) publishJob(req SubmitJobRequest, jobID string, reservedFunds decimal.Decimal) error {
 	// I should marshal the job request (including UserID and JobID) into JSON for NATS.
 	jobData, err := json.Marshal(struct {
 		SubmitJobRequest
-		JobID string `json:"job_id"`
-	}{SubmitJobRequest: req, JobID: jobID})
-
+		JobID         string          `json:"job_id"`
+		ReservedFunds decimal.Decimal `json:"reserved_funds"`
+	}{SubmitJobRequest: req, JobID: jobID, ReservedFunds: reservedFunds})
 	if err != nil {
 		h.Logger.Error("Failed to marshal job data for NATS", zap.Error(err))
-		http.Error(w, "Failed to process job submission", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("marshalling job: %w", err)
+	}
+
+	// I need to start watching for status updates before the job is published so the
+	// webhook can't miss the first one.
+	stopWatching := func() {}
+	if req.NotificationWebhook != "" {
+		stop, err := h.Webhooks.Watch(jobID, req.UserID, req.NotificationWebhook)
+		if err != nil {
+			h.Logger.Error("Failed to watch job for webhook notifications", zap.String("job_id", jobID), zap.Error(err))
+			return fmt.Errorf("%w: %v", errWebhookRegistration, err)
+		}
+		stopWatching = stop
 	}
 
 	// I need to determine the NATS subject (e.g., based on job type or priority).
 	// Using a simple subject for now.
 	natsSubject := "jobs.submitted"
 
-	// I should publish the job data to NATS.
-	if err := h.NatsConn.Publish(natsSubject, jobData); err != nil {
+	msg := &nats.Msg{
+		Subject: natsSubject,
+		Data:    jobData,
+		Header:  nats.Header{},
+	}
+	msg.Header.Set(nats.MsgIdHdr, jobID)
+	if err := h.NatsConn.PublishMsg(msg); err != nil {
 		h.Logger.Error("Failed to publish job to NATS",
 			zap.String("subject", natsSubject),
 			zap.Error(err))
-		http.Error(w, "Failed to submit job via message queue", http.StatusInternalServerError)
-		return
+		stopWatching()
+		metrics.JobsSubmitted.WithLabelValues("failed").Inc()
+		return fmt.Errorf("publishing job: %w", err)
 	}
 
+	metrics.JobsSubmitted.WithLabelValues("queued").Inc()
+
 	h.Logger.Info("Job submitted successfully to NATS",
 		zap.String("job_id", jobID),
 		zap.String("subject", natsSubject),
 		zap.String("user_id", req.UserID),
 	)
+	return nil
+}
 
-	// Respond with success message.
-	resp := SubmitJobResponse{
-		JobID:     jobID,
-		Status:    "queued", // Initial status
-		Timestamp: time.Now(),
-		Message:   "Job submitted successfully",
+// dryRunTimeout bounds how long I wait for the scheduler to answer a dry run.
+const dryRunTimeout = 10 * time.Second
+
+// dryRunJob asks the scheduler where the job would be placed and what it would cost,
+// via NATS request-reply, and relays the preview to the client.
+func (h *JobHandler) dryRunJob(w http.ResponseWriter, r *http.Request, req SubmitJobRequest, jobID string) {
+	jobData, err := json.Marshal(struct {
+		SubmitJobRequest
+		JobID string `json:"job_id"`
+	}{SubmitJobRequest: req, JobID: jobID})
+	if err != nil {
+		h.Logger.Error("Failed to marshal dry-run job", zap.Error(err))
+		apierror.Error(w, "Failed to process job submission", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dryRunTimeout)
+	defer cancel()
+
+	natsSubject := "jobs.dryrun"
+	reply, err := h.NatsConn.RequestWithContext(ctx, natsSubject, jobData)
+	if err != nil {
+		h.Logger.Error("Dry-run request to scheduler failed",
+			zap.String("subject", natsSubject),
+			zap.Error(err))
+		apierror.Error(w, "Scheduler did not answer the dry run", http.StatusServiceUnavailable)
+		return
 	}
 
+	var preview map[string]interface{}
+	if err := json.Unmarshal(reply.Data, &preview); err != nil {
+		h.Logger.Error("Invalid dry-run reply from scheduler", zap.Error(err))
+		apierror.Error(w, "Invalid dry-run reply from scheduler", http.StatusBadGateway)
+		return
+	}
+	preview["dry_run"] = true
+	preview["status"] = "dry_run"
+	if placeable, _ := preview["placeable"].(bool); !placeable {
+		preview["code"] = apierror.CodeNoProviderAvailable
+	}
+	preview["timestamp"] = time.Now()
+
+	h.Logger.Info("Job dry run answered",
+		zap.String("job_id", jobID),
+		zap.String("user_id", req.UserID),
+		zap.Any("placeable", preview["placeable"]),
+	)
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted) // 202 Accepted for async processing
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		h.Logger.Error("Failed to encode job submission response", zap.Error(err))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		h.Logger.Error("Failed to encode dry-run response", zap.Error(err))
 	}
 }
 
+// jobStatusTimeout bounds how long I wait for the scheduler to report a job's status.
+const jobStatusTimeout = 5 * time.Second
+
+// schedulerJobStatus is the scheduler's reply to a queue status request.
+type schedulerJobStatus struct {
+	JobID              string     `json:"job_id"`
+	UserID             string     `json:"user_id,omitempty"`
+	Found              bool       `json:"found"`
+	State              string     `json:"state,omitempty"`
+	ProviderID         string     `json:"provider_id,omitempty"`
+	QueuePosition      int        `json:"queue_position,omitempty"`
+	EstimatedStart     *time.Time `json:"estimated_start,omitempty"`
+	AvailableProviders int        `json:"available_providers"`
+	WaitingSeconds     float64    `json:"waiting_seconds,omitempty"`
+	MaxWaitSeconds     float64    `json:"max_wait_seconds,omitempty"`
+	Reason             string     `json:"reason,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
 // GetJobStatus handles requests to get the status of a specific job.
-// NOTE: This is a placeholder. The API Gateway might not be the ideal place
-// to query job status directly. This might involve querying the
-// scheduler-orchestrator-service or a dedicated job status service via REST/gRPC,
-// or potentially using NATS request-reply if the responsible service listens.
-// For now, it just returns a mock response.
+// It asks the scheduler over NATS request-reply, which works out the job's queue
+// position and estimated start afresh on every request, so clients polling this
+// endpoint see both move as the jobs ahead are placed.
 func (h *JobHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 	h.Logger.Info("Received request for job status", zap.String("jobID", jobID))
 
-	// --- Placeholder Logic ---
-	// In a real implementation:
-	// 1. Extract jobID from URL.
-	// 2. Make a request (e.g., gRPC) to the scheduler/job service to get the status.
-	// 3. Handle potential errors (not found, service unavailable).
-	// 4. Return the actual status.
-	// --- End Placeholder ---
+	status, ok := h.lookupJob(w, r, jobID)
+	if !ok {
+		return
+	}
 
-	mockStatus := "processing" // Or "queued", "completed", "failed", "cancelled"
-	if jobID == "known-completed-id" {
-		mockStatus = "completed"
+	// Jobs still waiting for a provider are "queued" to clients, as on submission
+	jobStatus := status.State
+	if jobStatus == "pending" || jobStatus == "searching" {
+		jobStatus = "queued"
 	}
 
-	resp := map[string]interface{}{ // Using a map for flexibility in mock response
-		"job_id":    jobID,
-		"status":    mockStatus,
-		"timestamp": time.Now(),
-		"message":   fmt.Sprintf("Mock status for job %s is %s", jobID, mockStatus),
+	resp := map[string]interface{}{
+		"job_id":              jobID,
+		"status":              jobStatus,
+		"stage":               status.State,
+		"available_providers": status.AvailableProviders,
+		"timestamp":           time.Now(),
+	}
+	if status.ProviderID != "" {
+		resp["provider_id"] = status.ProviderID
+	}
+	if status.QueuePosition > 0 {
+		resp["queue_position"] = status.QueuePosition
+	}
+	switch {
+	case status.State == "no_provider_available":
+		// The scheduler keeps retrying placement until the job has waited max_wait_seconds
+		resp["message"] = fmt.Sprintf("No provider is available for the job yet; waited %s of %s",
+			secondsDuration(status.WaitingSeconds), secondsDuration(status.MaxWaitSeconds))
+	case status.QueuePosition > 0:
+		resp["message"] = fmt.Sprintf("Job is queued at position %d", status.QueuePosition)
+	default:
+		resp["message"] = fmt.Sprintf("Job is %s", status.State)
+	}
+	if status.EstimatedStart != nil {
+		resp["estimated_start"] = status.EstimatedStart
+	}
+	if status.WaitingSeconds > 0 {
+		resp["waiting_seconds"] = int64(status.WaitingSeconds)
+	}
+	if status.MaxWaitSeconds > 0 {
+		resp["max_wait_seconds"] = int64(status.MaxWaitSeconds)
+	}
+	if status.Reason != "" {
+		resp["reason"] = status.Reason
+		if status.State == "failed" {
+			resp["error"] = status.Reason
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -163,22 +422,248 @@ func (h *JobHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// secondsDuration formats a number of seconds as a duration, to the second.
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
+
+// lookupJob asks the scheduler for a job's state, making sure it belongs to the caller.
+// On failure it writes the error response and reports false.
+func (h *JobHandler) lookupJob(w http.ResponseWriter, r *http.Request, jobID string) (*schedulerJobStatus, bool) {
+	reqData, err := json.Marshal(map[string]string{"job_id": jobID})
+	if err != nil {
+		h.Logger.Error("Failed to marshal job status request", zap.Error(err))
+		apierror.Error(w, "Failed to get job status", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), jobStatusTimeout)
+	defer cancel()
+
+	natsSubject := "jobs.queue.status"
+	reply, err := h.requestScheduler(ctx, natsSubject, reqData)
+	if err != nil {
+		h.Logger.Error("Job status request to scheduler failed",
+			zap.String("subject", natsSubject),
+			zap.String("job_id", jobID),
+			zap.Error(err))
+		apierror.Error(w, "Scheduler did not answer the status request", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	var status schedulerJobStatus
+	if err := json.Unmarshal(reply, &status); err != nil {
+		h.Logger.Error("Invalid job status reply from scheduler", zap.Error(err))
+		apierror.Error(w, "Invalid job status reply from scheduler", http.StatusBadGateway)
+		return nil, false
+	}
+	if status.Error != "" && !status.Found {
+		h.Logger.Error("Scheduler failed to look up job", zap.String("job_id", jobID), zap.String("error", status.Error))
+		apierror.Error(w, "Failed to get job status", http.StatusBadGateway)
+		return nil, false
+	}
+
+	// Other users' jobs look the same as unknown ones
+	userID := userIDFromContext(r)
+	if !status.Found || (status.UserID != "" && userID != "" && status.UserID != userID) {
+		apierror.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &status, true
+}
+
+// lookupOwnJob is lookupJob for requests that act on the job or read its data, such as
+// cancelling it, fetching its log or opening a shell in it. lookupJob lets jobs without a recorded owner through; these
+// need the caller to be the job's known owner.
+func (h *JobHandler) lookupOwnJob(w http.ResponseWriter, r *http.Request, jobID string) (*schedulerJobStatus, bool) {
+	status, ok := h.lookupJob(w, r, jobID)
+	if !ok {
+		return nil, false
+	}
+	userID := userIDFromContext(r)
+	if userID == "" || status.UserID != userID {
+		apierror.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return status, true
+}
+
+// authorizeJobStream checks that the caller submitted the job. A job submitted moments
+// ago may still be waiting for the scheduler, so the caller's pending submissions are
+// checked before asking the scheduler. On failure it writes the error response.
+func (h *JobHandler) authorizeJobStream(w http.ResponseWriter, r *http.Request, jobID string) bool {
+	userID := userIDFromContext(r)
+	if userID == "" {
+		apierror.Error(w, "Job not found", http.StatusNotFound)
+		return false
+	}
+	pending, _, err := h.pendingSubmissions(userID)
+	if err != nil {
+		h.Logger.Warn("Failed to check pending submissions", zap.String("user_id", userID), zap.Error(err))
+	} else if _, ok := pending.Jobs[jobID]; ok {
+		return true
+	}
+	_, ok := h.lookupOwnJob(w, r, jobID)
+	return ok
+}
+
+// StreamJobStatus upgrades the request to a WebSocket and forwards every status
+// update published on task.status.<job_id> to the client as it arrives.
+// The socket is closed once the job reaches a terminal state.
+func (h *JobHandler) StreamJobStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if _, err := uuid.Parse(jobID); err != nil {
+		apierror.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	// I should only let the submitting user watch the job; unknown jobs look the same
+	// as other users' jobs so I don't leak which job IDs exist.
+	if !h.authorizeJobStream(w, r, jobID) {
+		return
+	}
+	userID := userIDFromContext(r)
+
+	// I need to subscribe before upgrading so no update published in between is missed.
+	updates := make(chan *nats.Msg, 64)
+	natsSubject := fmt.Sprintf("task.status.%s", jobID)
+	sub, err := h.NatsConn.ChanSubscribe(natsSubject, updates)
+	if err != nil {
+		h.Logger.Error("Failed to subscribe to job status updates",
+			zap.String("subject", natsSubject),
+			zap.Error(err))
+		apierror.Error(w, "Failed to stream job status", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		h.Logger.Warn("Failed to upgrade job status stream", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	h.Logger.Info("Job status stream opened", zap.String("job_id", jobID), zap.String("user_id", userID))
+
+	// The stream outlives the router's request timeout, so I detach from its deadline
+	// and instead stop when the client goes away.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+	go h.readStreamControl(conn, cancel)
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.Logger.Info("Job status stream closed by client", zap.String("job_id", jobID))
+			return
+
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case msg := <-updates:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg.Data); err != nil {
+				h.Logger.Warn("Failed to forward job status update", zap.String("job_id", jobID), zap.Error(err))
+				return
+			}
+
+			var update struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(msg.Data, &update); err == nil && terminalJobStatuses[update.Status] {
+				closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job "+update.Status)
+				conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(streamWriteWait))
+				h.Logger.Info("Job status stream finished",
+					zap.String("job_id", jobID),
+					zap.String("status", update.Status))
+				return
+			}
+		}
+	}
+}
+
+// readStreamControl drains client frames so pongs and close frames are processed,
+// and calls cancel once the client disconnects.
+func (h *JobHandler) readStreamControl(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+
+	conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
 // CancelJob handles requests to cancel a running job.
-// NOTE: Similar to GetJobStatus, this is a placeholder.
-// Cancellation likely involves sending a command via NATS or gRPC
-// to the scheduler/orchestrator or the daemon running the job.
+// It publishes a cancel request on task.cancel.<job_id>; the provider running
+// the job stops it and reports the canceled status asynchronously.
+// Only the job's owner can cancel it; other users' jobs look the same as unknown ones.
 func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 	h.Logger.Info("Received request to cancel job", zap.String("jobID", jobID))
 
-	// --- Placeholder Logic ---
-	// In a real implementation:
-	// 1. Extract jobID.
-	// 2. Send a cancellation request (e.g., NATS message `jobs.cancel` with jobID)
-	//    to the scheduler/orchestrator.
-	// 3. The scheduler would then attempt to stop the job.
-	// 4. Return an appropriate response (e.g., "cancellation requested").
-	// --- End Placeholder ---
+	if _, err := uuid.Parse(jobID); err != nil {
+		apierror.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	status, ok := h.lookupOwnJob(w, r, jobID)
+	if !ok {
+		return
+	}
+	h.requestCancel(w, jobID, status.UserID, false)
+}
+
+// ForceCancelJob lets an admin cancel any user's job. The cancel request is marked as
+// forced so that providers and audit logs can tell it apart from the owner canceling.
+func (h *JobHandler) ForceCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	h.Logger.Warn("Admin force-canceling job", zap.String("jobID", jobID), zap.String("admin_id", userIDFromContext(r)))
+
+	if _, err := uuid.Parse(jobID); err != nil {
+		apierror.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	h.requestCancel(w, jobID, userIDFromContext(r), true)
+}
+
+// requestCancel publishes a cancel request on task.cancel.<job_id> and responds with 202 Accepted.
+func (h *JobHandler) requestCancel(w http.ResponseWriter, jobID, requestedBy string, force bool) {
+	// I should include who requested the cancellation for auditing on the provider side.
+	cancelData, err := json.Marshal(map[string]interface{}{
+		"job_id":       jobID,
+		"requested_by": requestedBy,
+		"force":        force,
+		"timestamp":    time.Now(),
+	})
+	if err != nil {
+		h.Logger.Error("Failed to marshal cancel request", zap.Error(err))
+		apierror.Error(w, "Failed to process cancellation", http.StatusInternalServerError)
+		return
+	}
+
+	natsSubject := fmt.Sprintf("task.cancel.%s", jobID)
+	if err := h.NatsConn.Publish(natsSubject, cancelData); err != nil {
+		h.Logger.Error("Failed to publish cancel request to NATS",
+			zap.String("subject", natsSubject),
+			zap.Error(err))
+		apierror.Error(w, "Failed to request job cancellation", http.StatusInternalServerError)
+		return
+	}
 
 	resp := map[string]interface{}{ // Using a map for flexibility
 		"job_id":    jobID,
@@ -193,3 +678,34 @@ func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
 		h.Logger.Error("Failed to encode job cancellation response", zap.Error(err))
 	}
 }
+
+// GetWebhookSecret returns the caller's webhook signing secret, for verifying the
+// signature header on job notifications.
+func (h *JobHandler) GetWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r)
+	if userID == "" {
+		apierror.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"secret":           h.Webhooks.UserSecret(userID),
+		"signature_header": webhook.SignatureHeader,
+		"timestamp_header": webhook.TimestampHeader,
+		"algorithm":        "HMAC-SHA256 of \"<timestamp>.<body>\"",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Error("Failed to encode webhook secret response", zap.Error(err))
+	}
+}
+
+// userIDFromContext returns the authenticated user's ID, or an empty string.
+func userIDFromContext(r *http.Request) string {
+	if claims, ok := r.Context().Value(auth.ContextKeyClaims).(*auth.Claims); ok && claims != nil {
+		return claims.UserID
+	}
+	return ""
+}
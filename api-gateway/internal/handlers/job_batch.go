@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/billing"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// SubmitJobBatchRequest is the body of a batch submission. Each entry in Jobs is
+// applied over Template: fields it sets replace the template's, and its params are
+// merged into the template's params, so a sweep only needs to list what differs.
+// A bare JSON array of jobs is accepted too.
+type SubmitJobBatchRequest struct {
+	Template *SubmitJobRequest `json:"template,omitempty"`
+	Jobs     []json.RawMessage `json:"jobs"`
+}
+
+// BatchJobResult reports what happened to one job of a batch.
+type BatchJobResult struct {
+	Index         int             `json:"index"`
+	JobID         string          `json:"job_id,omitempty"`
+	Status        string          `json:"status"` // queued, invalid, failed or not_submitted
+	ReservedFunds decimal.Decimal `json:"reserved_funds"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// SubmitJobBatchResponse is the response to a batch submission.
+type SubmitJobBatchResponse struct {
+	BatchID       string           `json:"batch_id"`
+	Submitted     int              `json:"submitted"`
+	ReservedFunds decimal.Decimal  `json:"reserved_funds"`
+	Jobs          []BatchJobResult `json:"jobs"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Message       string           `json:"message"`
+	// Code is set when the batch was refused
+	Code apierror.Code `json:"code,omitempty"`
+}
+
+// batchReservationTimeout bounds the funds reservation for a batch.
+const batchReservationTimeout = 15 * time.Second
+
+// SubmitJobBatch handles requests to submit many jobs at once, e.g. for a hyperparameter
+// sweep. Every job is validated and the funds for the whole batch are reserved in one
+// step before anything is published, so an invalid job or a wallet that can't cover
+// the batch leaves nothing submitted.
+func (h *JobHandler) SubmitJobBatch(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(auth.ContextKeyClaims).(*auth.Claims)
+	if !ok || claims == nil {
+		h.Logger.Error("Claims not found in context for batch job submission")
+		apierror.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	batch, err := decodeJobBatch(r)
+	if err != nil {
+		h.Logger.Error("Failed to decode batch job submission", zap.Error(err))
+		apierror.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Jobs) == 0 {
+		apierror.Error(w, "At least one job is required", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Jobs) > h.Config.MaxJobBatchSize {
+		apierror.Error(w, fmt.Sprintf("A batch may contain at most %d jobs", h.Config.MaxJobBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	batchID := uuid.New().String()
+	resp := SubmitJobBatchResponse{BatchID: batchID, Jobs: make([]BatchJobResult, len(batch.Jobs))}
+	jobs := make([]SubmitJobRequest, len(batch.Jobs))
+	invalid := 0
+	for i, raw := range batch.Jobs {
+		resp.Jobs[i] = BatchJobResult{Index: i, Status: "not_submitted"}
+		job, err := mergeBatchJob(batch.Template, raw)
+		if err == nil {
+			err = validateJobRequest(&job)
+		}
+		if err == nil && job.DryRun {
+			err = errors.New("dry runs can't be submitted in a batch")
+		}
+		if err != nil {
+			resp.Jobs[i].Status = "invalid"
+			resp.Jobs[i].Error = err.Error()
+			invalid++
+			continue
+		}
+		job.UserID = claims.UserID
+		jobs[i] = job
+		resp.Jobs[i].JobID = uuid.New().String()
+	}
+	if invalid > 0 {
+		resp.Code = apierror.CodeValidation
+		resp.Message = fmt.Sprintf("%d of %d jobs are invalid; nothing was submitted", invalid, len(jobs))
+		h.writeBatchResponse(w, http.StatusBadRequest, &resp)
+		return
+	}
+	jobIDs := make([]string, len(jobs))
+	for i := range jobs {
+		jobIDs[i] = resp.Jobs[i].JobID
+	}
+	if err := h.reserveJobSlots(r.Context(), claims, jobIDs); err != nil {
+		h.writeJobLimitError(w, claims, err)
+		return
+	}
+
+	// The whole batch is reserved at once; the scheduler hands each job's share to its
+	// billing session when the job is placed
+	reservationReq := &billing.FundsReservationRequest{UserID: claims.UserID, Reference: batchID}
+	for i, job := range jobs {
+		durationHours := decimal.Zero
+		if job.MaxDurationMinutes > 0 {
+			durationHours = decimal.NewFromInt(int64(job.MaxDurationMinutes)).Div(decimal.NewFromInt(60))
+		}
+		reservationReq.Jobs = append(reservationReq.Jobs, billing.JobReservation{
+			JobID:         resp.Jobs[i].JobID,
+			GPUModel:      job.GPUType,
+			DurationHours: durationHours,
+		})
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), batchReservationTimeout)
+	defer cancel()
+	reservation, err := h.Billing.ReserveFunds(ctx, reservationReq)
+	if err != nil {
+		h.Logger.Warn("Failed to reserve funds for job batch",
+			zap.String("batch_id", batchID),
+			zap.String("user_id", claims.UserID),
+			zap.Error(err))
+		h.releaseJobSlots(claims.UserID, jobIDs)
+		writeBillingError(w, err, "Failed to reserve funds for the batch")
+		return
+	}
+	shares := make(map[string]decimal.Decimal, len(reservation.Jobs))
+	for _, share := range reservation.Jobs {
+		shares[share.JobID] = share.Amount
+	}
+
+	// Should publishing fail partway, the jobs that weren't published get their
+	// share of the reservation back
+	unpublished := decimal.Zero
+	var unpublishedIDs []string
+	for i, job := range jobs {
+		result := &resp.Jobs[i]
+		result.ReservedFunds = shares[result.JobID]
+		if err := h.publishJob(job, result.JobID, result.ReservedFunds); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			result.ReservedFunds = decimal.Zero
+			unpublished = unpublished.Add(shares[result.JobID])
+			unpublishedIDs = append(unpublishedIDs, result.JobID)
+			continue
+		}
+		result.Status = "queued"
+		resp.Submitted++
+		resp.ReservedFunds = resp.ReservedFunds.Add(result.ReservedFunds)
+	}
+	if len(unpublishedIDs) > 0 {
+		h.releaseJobSlots(claims.UserID, unpublishedIDs)
+	}
+	if unpublished.IsPositive() {
+		if err := h.Billing.ReleaseFunds(context.Background(), claims.UserID, unpublished, batchID); err != nil {
+			h.Logger.Error("Failed to release funds of unpublished batch jobs",
+				zap.String("batch_id", batchID),
+				zap.String("amount", unpublished.String()),
+				zap.Error(err))
+		}
+	}
+
+	h.Logger.Info("Job batch submitted",
+		zap.String("batch_id", batchID),
+		zap.String("user_id", claims.UserID),
+		zap.Int("jobs", len(jobs)),
+		zap.Int("submitted", resp.Submitted),
+		zap.String("reserved_funds", resp.ReservedFunds.String()),
+	)
+
+	status := http.StatusAccepted
+	switch resp.Submitted {
+	case len(jobs):
+		resp.Message = "Batch submitted successfully"
+	case 0:
+		status = http.StatusInternalServerError
+		resp.Code = apierror.CodeInternal
+		resp.Message = "Failed to submit the batch via message queue"
+	default:
+		resp.Message = fmt.Sprintf("%d of %d jobs were submitted", resp.Submitted, len(jobs))
+	}
+	h.writeBatchResponse(w, status, &resp)
+}
+
+// decodeJobBatch reads a batch body, either an object with a template and jobs or a
+// bare array of jobs.
+func decodeJobBatch(r *http.Request) (*SubmitJobBatchRequest, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var batch SubmitJobBatchRequest
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &batch.Jobs); err != nil {
+			return nil, err
+		}
+		return &batch, nil
+	}
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// mergeBatchJob applies one job's fields over the batch template.
+func mergeBatchJob(template *SubmitJobRequest, raw json.RawMessage) (SubmitJobRequest, error) {
+	var job SubmitJobRequest
+	if template != nil {
+		job = *template
+		// Unmarshalling reuses maps and slices, so the template's are copied to keep one
+		// job's fields from leaking into the next
+		job.Params = make(map[string]interface{}, len(template.Params))
+		for k, v := range template.Params {
+			job.Params[k] = v
+		}
+		job.Tags = append([]string(nil), template.Tags...)
+		job.PreferredProviders = append([]string(nil), template.PreferredProviders...)
+		job.ExcludedProviders = append([]string(nil), template.ExcludedProviders...)
+		if template.Requirements != nil {
+			requirements := *template.Requirements
+			job.Requirements = &requirements
+		}
+	}
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return SubmitJobRequest{}, fmt.Errorf("invalid job: %w", err)
+	}
+	return job, nil
+}
+
+func (h *JobHandler) writeBatchResponse(w http.ResponseWriter, status int, resp *SubmitJobBatchResponse) {
+	resp.Timestamp = time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Error("Failed to encode batch job submission response", zap.Error(err))
+	}
+}
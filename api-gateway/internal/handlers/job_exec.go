@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// execRequestTimeout bounds how long the provider running a job has to open an exec session.
+const execRequestTimeout = 15 * time.Second
+
+// execRequest is the request published on task.exec.<job_id>; see the provider daemon.
+type execRequest struct {
+	SessionID string   `json:"session_id"`
+	UserID    string   `json:"user_id"`
+	Command   []string `json:"command,omitempty"`
+	TTY       bool     `json:"tty"`
+	Cols      uint     `json:"cols,omitempty"`
+	Rows      uint     `json:"rows,omitempty"`
+}
+
+// execControlMessage is a JSON text frame of an exec session: resize from the client,
+// exit from the gateway when the session ends.
+type execControlMessage struct {
+	Type     string `json:"type"`
+	Cols     uint   `json:"cols,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ExecJob opens an interactive session in a running job's container for the job's owner
+// and relays it over a WebSocket. Binary frames carry stdin from the client and the
+// session's output to it; text frames are JSON control messages. The session itself runs
+// on the provider, which is reached over NATS: the request goes to task.exec.<job_id>,
+// which only the provider running the job answers, and the session's streams to
+// exec.<session_id>.*.
+func (h *JobHandler) ExecJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if _, err := uuid.Parse(jobID); err != nil {
+		apierror.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	status, ok := h.lookupOwnJob(w, r, jobID)
+	if !ok {
+		return
+	}
+	userID := status.UserID
+	if status.State != "running" {
+		apierror.Error(w, fmt.Sprintf("Job is %s, not running", status.State), http.StatusConflict)
+		return
+	}
+
+	req, err := parseExecRequest(r)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.SessionID = uuid.New().String()
+	req.UserID = userID
+
+	// Subscribe before the session opens so none of its output is missed
+	output := make(chan *nats.Msg, 256)
+	sub, err := h.NatsConn.ChanSubscribe(fmt.Sprintf("exec.%s.*", req.SessionID), output)
+	if err != nil {
+		h.Logger.Error("Failed to subscribe to exec session", zap.Error(err))
+		apierror.Error(w, "Failed to open exec session", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	if err := h.openExecSession(r.Context(), jobID, req); err != nil {
+		h.Logger.Warn("Exec session rejected",
+			zap.String("job_id", jobID),
+			zap.String("user_id", userID),
+			zap.Error(err))
+		if errors.Is(err, nats.ErrNoResponders) || errors.Is(err, context.DeadlineExceeded) {
+			apierror.Error(w, "The job's provider did not answer", http.StatusServiceUnavailable)
+			return
+		}
+		apierror.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		h.Logger.Warn("Failed to upgrade exec session", zap.String("job_id", jobID), zap.Error(err))
+		h.NatsConn.Publish(fmt.Sprintf("exec.%s.in.close", req.SessionID), nil)
+		return
+	}
+	defer conn.Close()
+
+	h.Logger.Info("Exec session opened",
+		zap.String("job_id", jobID),
+		zap.String("session_id", req.SessionID),
+		zap.String("user_id", userID),
+		zap.Strings("command", req.Command))
+
+	// The session outlives the router's request timeout, so it is detached from the
+	// request's deadline and bounded by its own
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.Config.ExecSessionTimeout)
+	defer cancel()
+	go h.readExecInput(conn, req.SessionID, cancel)
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Tell the provider to end the session, whether the client left or it timed out
+			h.NatsConn.Publish(fmt.Sprintf("exec.%s.in.close", req.SessionID), nil)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				h.writeExecExit(conn, execControlMessage{Type: "exit", Error: "session timed out"})
+			}
+			h.Logger.Info("Exec session closed", zap.String("session_id", req.SessionID), zap.Error(ctx.Err()))
+			return
+
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case msg := <-output:
+			switch {
+			case strings.HasSuffix(msg.Subject, ".out"):
+				conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+				if err := conn.WriteMessage(websocket.BinaryMessage, msg.Data); err != nil {
+					h.NatsConn.Publish(fmt.Sprintf("exec.%s.in.close", req.SessionID), nil)
+					return
+				}
+			case strings.HasSuffix(msg.Subject, ".exit"):
+				exit := execControlMessage{Type: "exit"}
+				if err := json.Unmarshal(msg.Data, &exit); err != nil {
+					h.Logger.Warn("Invalid exec exit message", zap.Error(err))
+				}
+				exit.Type = "exit"
+				h.writeExecExit(conn, exit)
+				h.Logger.Info("Exec session finished", zap.String("session_id", req.SessionID))
+				return
+			}
+		}
+	}
+}
+
+// parseExecRequest reads the session options from the query string: command (repeatable,
+// /bin/sh by default), tty (true by default), cols and rows.
+func parseExecRequest(r *http.Request) (execRequest, error) {
+	query := r.URL.Query()
+	req := execRequest{Command: query["command"], TTY: true}
+	if tty := query.Get("tty"); tty != "" {
+		value, err := strconv.ParseBool(tty)
+		if err != nil {
+			return req, fmt.Errorf("invalid tty: %w", err)
+		}
+		req.TTY = value
+	}
+	for name, target := range map[string]*uint{"cols": &req.Cols, "rows": &req.Rows} {
+		if raw := query.Get(name); raw != "" {
+			value, err := strconv.ParseUint(raw, 10, 16)
+			if err != nil {
+				return req, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*target = uint(value)
+		}
+	}
+	return req, nil
+}
+
+// openExecSession asks the provider running the job to open the session.
+func (h *JobHandler) openExecSession(ctx context.Context, jobID string, req execRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal exec request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, execRequestTimeout)
+	defer cancel()
+	reply, err := h.NatsConn.RequestWithContext(ctx, fmt.Sprintf("task.exec.%s", jobID), data)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(reply.Data, &response); err != nil {
+		return fmt.Errorf("invalid exec reply from provider: %w", err)
+	}
+	if !response.OK {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+// readExecInput forwards the client's frames to the provider, binary frames as stdin and
+// resize messages as resizes, and calls cancel once the client disconnects.
+func (h *JobHandler) readExecInput(conn *websocket.Conn, sessionID string, cancel context.CancelFunc) {
+	defer cancel()
+
+	conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(streamPongWait))
+
+		switch messageType {
+		case websocket.BinaryMessage:
+			h.NatsConn.Publish(fmt.Sprintf("exec.%s.in.stdin", sessionID), data)
+		case websocket.TextMessage:
+			var control execControlMessage
+			if err := json.Unmarshal(data, &control); err != nil || control.Type != "resize" {
+				continue
+			}
+			resize, _ := json.Marshal(map[string]uint{"cols": control.Cols, "rows": control.Rows})
+			h.NatsConn.Publish(fmt.Sprintf("exec.%s.in.resize", sessionID), resize)
+		}
+	}
+}
+
+// writeExecExit sends the exit message and closes the WebSocket.
+func (h *JobHandler) writeExecExit(conn *websocket.Conn, exit execControlMessage) {
+	if data, err := json.Marshal(exit); err == nil {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended")
+	conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(streamWriteWait))
+}
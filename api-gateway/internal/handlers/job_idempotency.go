@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make job submissions safe
+// to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayHeader marks a response replayed for a repeated Idempotency-Key.
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+// idempotencyPollInterval is how often a repeated submission checks whether the first
+// one with its key has been answered.
+var idempotencyPollInterval = 100 * time.Millisecond
+
+// IdempotencyStore is the part of a NATS key-value bucket I keep the submissions made
+// with an Idempotency-Key in, so a key is honoured by every gateway instance and
+// survives restarts. Writes are conditional on the revision read, so only one request
+// with a key is ever handled at a time. The bucket's TTL is how long responses are
+// replayed.
+type IdempotencyStore interface {
+	Get(key string) (nats.KeyValueEntry, error)
+	Create(key string, value []byte) (uint64, error)
+	Update(key string, value []byte, last uint64) (uint64, error)
+	Delete(key string, opts ...nats.DeleteOpt) error
+}
+
+// idempotentSubmission is a submission made with an Idempotency-Key. While the first
+// request with the key is being handled it is pending, and another request may take
+// it over once LeaseUntil has passed, in case the instance handling it went away. Its
+// response is kept only if it succeeded, so a failed submission can be retried with
+// the same key.
+type idempotentSubmission struct {
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the request body
+	Pending     bool      `json:"pending"`
+	LeaseUntil  time.Time `json:"lease_until,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+}
+
+// idempotencyStoreKey returns the key a user's submission to path with key is stored
+// under. Clients choose the key freely, so it is hashed into the characters NATS keys
+// allow.
+func idempotencyStoreKey(userID, path, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + path + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// getSubmission returns the submission stored under key and its revision, or nil if
+// there is none.
+func (h *JobHandler) getSubmission(key string) (*idempotentSubmission, uint64, error) {
+	entry, err := h.IdempotencyKeys.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get idempotent submission: %w", err)
+	}
+	var submission idempotentSubmission
+	if err := json.Unmarshal(entry.Value(), &submission); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal idempotent submission: %w", err)
+	}
+	return &submission, entry.Revision(), nil
+}
+
+// claimSubmission stores a pending submission under key, replacing the one at revision
+// last, or creating it if last is 0. It reports false if another request got there first.
+func (h *JobHandler) claimSubmission(key, fingerprint string, last uint64, now time.Time) (uint64, bool, error) {
+	data, err := json.Marshal(&idempotentSubmission{
+		Fingerprint: fingerprint,
+		Pending:     true,
+		LeaseUntil:  now.Add(h.idempotencyLease()),
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to marshal idempotent submission: %w", err)
+	}
+	var revision uint64
+	if last == 0 {
+		revision, err = h.IdempotencyKeys.Create(key, data)
+	} else {
+		revision, err = h.IdempotencyKeys.Update(key, data, last)
+	}
+	if errors.Is(err, nats.ErrKeyExists) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to store idempotent submission: %w", err)
+	}
+	return revision, true, nil
+}
+
+// finishSubmission records the response to the submission claimed at revision;
+// unsuccessful ones are forgotten.
+func (h *JobHandler) finishSubmission(key, fingerprint string, revision uint64, rec *responseRecorder) error {
+	if rec.status < 200 || rec.status >= 300 {
+		if err := h.IdempotencyKeys.Delete(key, nats.LastRevision(revision)); err != nil && !errors.Is(err, nats.ErrKeyExists) {
+			return fmt.Errorf("failed to delete idempotent submission: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(&idempotentSubmission{
+		Fingerprint: fingerprint,
+		Status:      rec.status,
+		ContentType: rec.Header().Get("Content-Type"),
+		Body:        rec.body.Bytes(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotent submission: %w", err)
+	}
+	if _, err := h.IdempotencyKeys.Update(key, data, revision); err != nil {
+		return fmt.Errorf("failed to store idempotent submission: %w", err)
+	}
+	return nil
+}
+
+// idempotencyLease is how long a submission may be handled before another request
+// with its key takes over.
+func (h *JobHandler) idempotencyLease() time.Duration {
+	if h.Config.RequestTimeout > 0 {
+		return 2 * h.Config.RequestTimeout
+	}
+	return 2 * time.Minute
+}
+
+// responseRecorder passes a response through while keeping a copy of it. status stays 0
+// if nothing was written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// Idempotency is middleware that makes a submission route safe to retry. When the
+// request carries an Idempotency-Key, the first request with that key from the user is
+// handled and, if it succeeds, its response is replayed for every repeat within the
+// bucket's TTL instead of submitting again. Repeats arriving while the first is still
+// being handled wait for it. Reusing a key for a different request body is refused
+// with 422. Request bodies are limited to MaxSubmissionBodySize.
+func (h *JobHandler) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Config.MaxSubmissionBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, h.Config.MaxSubmissionBodySize)
+		}
+		key := r.Header.Get(IdempotencyKeyHeader)
+		userID := userIDFromContext(r)
+		if key == "" || userID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Error(w, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			apierror.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		storeKey := idempotencyStoreKey(userID, r.URL.Path, key)
+
+		for {
+			submission, revision, err := h.getSubmission(storeKey)
+			if err != nil {
+				h.Logger.Error("Failed to look up idempotency key", zap.String("user_id", userID), zap.Error(err))
+				apierror.Error(w, "Idempotency keys are unavailable, retry later", http.StatusServiceUnavailable)
+				return
+			}
+
+			now := time.Now()
+			if submission == nil || (submission.Pending && now.After(submission.LeaseUntil)) {
+				claimed, ok, err := h.claimSubmission(storeKey, fingerprint, revision, now)
+				if err != nil {
+					h.Logger.Error("Failed to claim idempotency key", zap.String("user_id", userID), zap.Error(err))
+					apierror.Error(w, "Idempotency keys are unavailable, retry later", http.StatusServiceUnavailable)
+					return
+				}
+				if !ok {
+					continue // Another request with the key got in first
+				}
+				rec := &responseRecorder{ResponseWriter: w}
+				defer func() {
+					if err := h.finishSubmission(storeKey, fingerprint, claimed, rec); err != nil {
+						h.Logger.Error("Failed to record idempotent submission", zap.String("user_id", userID), zap.Error(err))
+					}
+				}()
+				next.ServeHTTP(rec, r)
+				return
+			}
+
+			if submission.Pending {
+				select {
+				case <-time.After(idempotencyPollInterval):
+				case <-r.Context().Done():
+					return
+				}
+				continue
+			}
+			if submission.Fingerprint != fingerprint {
+				apierror.Write(w, http.StatusUnprocessableEntity, apierror.Response{
+					Code:    apierror.CodeIdempotencyKeyReused,
+					Message: "Idempotency-Key was already used for a different request",
+				})
+				return
+			}
+
+			h.Logger.Info("Replaying response for repeated idempotency key",
+				zap.String("user_id", userID),
+				zap.String("path", r.URL.Path))
+			if submission.ContentType != "" {
+				w.Header().Set("Content-Type", submission.ContentType)
+			}
+			w.Header().Set(idempotentReplayHeader, "true")
+			w.WriteHeader(submission.Status)
+			w.Write(submission.Body)
+			return
+		}
+	})
+}
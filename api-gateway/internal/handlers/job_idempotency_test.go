@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"go.uber.org/zap"
+)
+
+// submitCounter is a submission route that counts the submissions it handles
+type submitCounter struct {
+	calls  atomic.Int32
+	status int
+	delay  time.Duration
+}
+
+func (s *submitCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.calls.Add(1)
+	time.Sleep(s.delay)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s.status)
+	w.Write([]byte(`{"submission":` + strconv.Itoa(int(n)) + `}`))
+}
+
+// newIdempotencyTestHandler returns a gateway instance keeping idempotency keys in kv
+func newIdempotencyTestHandler(kv *memKV) *JobHandler {
+	return &JobHandler{
+		Logger:          zap.NewNop(),
+		Config:          &config.Config{RequestTimeout: time.Minute, MaxSubmissionBodySize: 64},
+		IdempotencyKeys: kv,
+	}
+}
+
+// submit sends a submission with an Idempotency-Key as user-1
+func submit(h *JobHandler, next http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := requestAs("user-1")
+	r = httptest.NewRequest("POST", "/api/v1/jobs", strings.NewReader(body)).WithContext(r.Context())
+	r.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	h.Idempotency(next).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestIdempotencyReplaysSuccessfulSubmission(t *testing.T) {
+	h := newIdempotencyTestHandler(newMemKV())
+	next := &submitCounter{status: http.StatusAccepted}
+
+	first := submit(h, next, "key-1", `{"name":"a"}`)
+	repeat := submit(h, next, "key-1", `{"name":"a"}`)
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("submitted %d times, want once", got)
+	}
+	if repeat.Code != http.StatusAccepted || repeat.Body.String() != first.Body.String() {
+		t.Errorf("repeat answered %d %q, want the first response %d %q", repeat.Code, repeat.Body, first.Code, first.Body)
+	}
+	if repeat.Header().Get(idempotentReplayHeader) != "true" {
+		t.Error("repeat isn't marked as replayed")
+	}
+
+	if rec := submit(h, next, "key-1", `{"name":"b"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another body: status %d, want 422", rec.Code)
+	}
+	if rec := submit(h, next, "key-2", `{"name":"b"}`); rec.Code != http.StatusAccepted || next.calls.Load() != 2 {
+		t.Errorf("new key: status %d after %d submissions, want a second submission", rec.Code, next.calls.Load())
+	}
+}
+
+func TestIdempotencyRetriesFailedSubmission(t *testing.T) {
+	h := newIdempotencyTestHandler(newMemKV())
+	failing := &submitCounter{status: http.StatusInternalServerError}
+	if rec := submit(h, failing, "key-1", `{}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+
+	next := &submitCounter{status: http.StatusAccepted}
+	if rec := submit(h, next, "key-1", `{}`); rec.Code != http.StatusAccepted || next.calls.Load() != 1 {
+		t.Errorf("retry after a failure: status %d after %d submissions, want it submitted", rec.Code, next.calls.Load())
+	}
+}
+
+func TestIdempotencyAcrossInstances(t *testing.T) {
+	defer func(interval time.Duration) { idempotencyPollInterval = interval }(idempotencyPollInterval)
+	idempotencyPollInterval = time.Millisecond
+	kv := newMemKV()
+	instances := []*JobHandler{newIdempotencyTestHandler(kv), newIdempotencyTestHandler(kv)}
+	next := &submitCounter{status: http.StatusAccepted, delay: 20 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 8)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := submit(instances[i%2], next, "key-1", `{}`)
+			if rec.Code != http.StatusAccepted {
+				t.Errorf("status %d, want 202", rec.Code)
+			}
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("submitted %d times through two instances, want once", got)
+	}
+	for _, body := range bodies {
+		if body != bodies[0] {
+			t.Errorf("got responses %q and %q, want the same", bodies[0], body)
+		}
+	}
+}
+
+func TestIdempotencyTakesOverAbandonedSubmission(t *testing.T) {
+	kv := newMemKV()
+	h := newIdempotencyTestHandler(kv)
+	// An instance claimed the key and went away before answering
+	key := idempotencyStoreKey("user-1", "/api/v1/jobs", "key-1")
+	if _, _, err := h.claimSubmission(key, "fingerprint", 0, time.Now().Add(-3*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	next := &submitCounter{status: http.StatusAccepted}
+	if rec := submit(h, next, "key-1", `{}`); rec.Code != http.StatusAccepted || next.calls.Load() != 1 {
+		t.Errorf("status %d after %d submissions, want the abandoned submission taken over", rec.Code, next.calls.Load())
+	}
+}
+
+func TestIdempotencyLimitsBodySize(t *testing.T) {
+	h := newIdempotencyTestHandler(newMemKV())
+	next := &submitCounter{status: http.StatusAccepted}
+
+	if rec := submit(h, next, "key-1", strings.Repeat("x", 65)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status %d, want 413", rec.Code)
+	}
+	if got := next.calls.Load(); got != 0 {
+		t.Errorf("oversized body submitted %d times", got)
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// activeJobsTimeout bounds how long I wait for the scheduler to count a user's jobs.
+const activeJobsTimeout = 5 * time.Second
+
+// ConcurrentJobLimitError is returned when a submission would take a user over their
+// concurrent job limit.
+type ConcurrentJobLimitError struct {
+	Limit  int
+	Active int
+}
+
+func (e *ConcurrentJobLimitError) Error() string {
+	return fmt.Sprintf("concurrent job limit reached: %d of %d jobs still running or queued", e.Active, e.Limit)
+}
+
+// concurrentJobLimit returns how many unfinished jobs the user may have, negative if
+// unlimited. A limit set on the user's profile takes precedence over their role's.
+func concurrentJobLimit(cfg *config.Config, claims *auth.Claims) int {
+	userLimit := 0
+	if user, ok := auth.FindUserByUsername(claims.Username); ok && user.ID == claims.UserID {
+		userLimit = user.MaxConcurrentJobs
+	}
+	return cfg.JobLimits.Limit(claims.Role, userLimit)
+}
+
+// PendingSubmissionTTL is how long a submitted job counts against its user's limit
+// before the scheduler has recorded it. Jobs wait in the job stream only while the
+// scheduler is behind or down. The submissions bucket expires users' entries after it.
+const PendingSubmissionTTL = 10 * time.Minute
+
+// maxJobSlotAttempts bounds how often I retry reserving job slots when other
+// submissions of the same user keep getting in first.
+const maxJobSlotAttempts = 5
+
+// errJobSlotContention is returned when job slots couldn't be reserved because the
+// user's submissions kept racing each other.
+var errJobSlotContention = errors.New("too many concurrent submissions")
+
+// SubmissionStore is the part of a NATS key-value bucket I keep each user's pending
+// submissions in. Updates are conditional on the revision read, so submissions made
+// through different gateway instances at the same time can't both take the last slot.
+type SubmissionStore interface {
+	Get(key string) (nats.KeyValueEntry, error)
+	Create(key string, value []byte) (uint64, error)
+	Update(key string, value []byte, last uint64) (uint64, error)
+}
+
+// pendingSubmissions are a user's jobs published to the scheduler, by submission time
+type pendingSubmissions struct {
+	Jobs map[string]time.Time `json:"jobs"`
+}
+
+// activeJobs is the scheduler's reply to an active jobs request
+type activeJobs struct {
+	ActiveJobs  int      `json:"active_jobs"`
+	KnownJobIDs []string `json:"known_job_ids"`
+	Error       string   `json:"error"`
+}
+
+// reserveJobSlots returns a *ConcurrentJobLimitError if submitting the jobs would take
+// the user over their limit, and otherwise records them as pending until the scheduler
+// has recorded them. The scheduler counts the user's unfinished jobs; pending jobs it
+// doesn't know about yet are counted on top. Jobs of users without a limit are
+// recorded as pending too, since they tell whose a job is before the scheduler knows.
+func (h *JobHandler) reserveJobSlots(ctx context.Context, claims *auth.Claims, jobIDs []string) error {
+	limit := concurrentJobLimit(h.Config, claims)
+
+	for attempt := 0; attempt < maxJobSlotAttempts; attempt++ {
+		pending, revision, err := h.pendingSubmissions(claims.UserID)
+		if err != nil {
+			return err
+		}
+
+		if limit >= 0 {
+			pendingIDs := make([]string, 0, len(pending.Jobs))
+			for jobID := range pending.Jobs {
+				pendingIDs = append(pendingIDs, jobID)
+			}
+			active, err := h.countActiveJobs(ctx, claims.UserID, pendingIDs)
+			if err != nil {
+				return err
+			}
+			for _, jobID := range active.KnownJobIDs {
+				delete(pending.Jobs, jobID)
+			}
+			count := active.ActiveJobs + len(pending.Jobs)
+			if count+len(jobIDs) > limit {
+				return &ConcurrentJobLimitError{Limit: limit, Active: count}
+			}
+		}
+
+		now := time.Now()
+		for _, jobID := range jobIDs {
+			pending.Jobs[jobID] = now
+		}
+		err = h.storePendingSubmissions(claims.UserID, pending, revision)
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return err
+		}
+		// Another submission of the user got in first; count again
+	}
+	return errJobSlotContention
+}
+
+// releaseJobSlots drops jobs that weren't published after all from the user's pending
+// submissions.
+func (h *JobHandler) releaseJobSlots(userID string, jobIDs []string) {
+	for attempt := 0; attempt < maxJobSlotAttempts; attempt++ {
+		pending, revision, err := h.pendingSubmissions(userID)
+		if err == nil {
+			for _, jobID := range jobIDs {
+				delete(pending.Jobs, jobID)
+			}
+			err = h.storePendingSubmissions(userID, pending, revision)
+		}
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, nats.ErrKeyExists) {
+			h.Logger.Error("Failed to release job slots", zap.String("user_id", userID), zap.Error(err))
+			return
+		}
+	}
+	h.Logger.Warn("Gave up releasing job slots; they expire on their own", zap.String("user_id", userID))
+}
+
+// pendingSubmissions loads the user's unexpired pending submissions and the revision
+// they were read at, zero if the user has none stored.
+func (h *JobHandler) pendingSubmissions(userID string) (*pendingSubmissions, uint64, error) {
+	pending := &pendingSubmissions{Jobs: make(map[string]time.Time)}
+	entry, err := h.Submissions.Get(userID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return pending, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("loading pending submissions: %w", err)
+	}
+	if err := json.Unmarshal(entry.Value(), pending); err != nil {
+		return nil, 0, fmt.Errorf("invalid pending submissions: %w", err)
+	}
+	if pending.Jobs == nil {
+		pending.Jobs = make(map[string]time.Time)
+	}
+	for jobID, submittedAt := range pending.Jobs {
+		if time.Since(submittedAt) > PendingSubmissionTTL {
+			delete(pending.Jobs, jobID)
+		}
+	}
+	return pending, entry.Revision(), nil
+}
+
+// storePendingSubmissions writes the user's pending submissions if they are still at
+// revision, and fails with nats.ErrKeyExists otherwise.
+func (h *JobHandler) storePendingSubmissions(userID string, pending *pendingSubmissions, revision uint64) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("marshalling pending submissions: %w", err)
+	}
+	if revision == 0 {
+		_, err = h.Submissions.Create(userID, data)
+	} else {
+		_, err = h.Submissions.Update(userID, data, revision)
+	}
+	if err != nil && !errors.Is(err, nats.ErrKeyExists) {
+		return fmt.Errorf("storing pending submissions: %w", err)
+	}
+	return err
+}
+
+// requestActiveJobs asks the scheduler how many of the user's jobs are unfinished and
+// which of jobIDs it has recorded.
+func (h *JobHandler) requestActiveJobs(ctx context.Context, userID string, jobIDs []string) (*activeJobs, error) {
+	reqData, err := json.Marshal(map[string]interface{}{"user_id": userID, "job_ids": jobIDs})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling active jobs request: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, activeJobsTimeout)
+	defer cancel()
+	reply, err := h.requestScheduler(ctx, "jobs.user.active", reqData)
+	if err != nil {
+		return nil, fmt.Errorf("active jobs request to scheduler: %w", err)
+	}
+
+	var active activeJobs
+	if err := json.Unmarshal(reply, &active); err != nil {
+		return nil, fmt.Errorf("invalid active jobs reply from scheduler: %w", err)
+	}
+	if active.Error != "" {
+		return nil, fmt.Errorf("scheduler failed to count active jobs: %s", active.Error)
+	}
+	return &active, nil
+}
+
+// writeJobLimitError answers a submission reserveJobSlots refused: 429 if the user is
+// at their limit, 503 if their jobs couldn't be counted.
+func (h *JobHandler) writeJobLimitError(w http.ResponseWriter, claims *auth.Claims, err error) {
+	var limitErr *ConcurrentJobLimitError
+	if errors.As(err, &limitErr) {
+		h.Logger.Info("Job submission over concurrent job limit",
+			zap.String("user_id", claims.UserID),
+			zap.Int("limit", limitErr.Limit),
+			zap.Int("active", limitErr.Active))
+		apierror.Write(w, http.StatusTooManyRequests, apierror.Response{
+			Code:    apierror.CodeConcurrentJobLimit,
+			Message: limitErr.Error(),
+			Details: map[string]interface{}{"limit": limitErr.Limit, "active": limitErr.Active},
+		})
+		return
+	}
+	h.Logger.Error("Failed to check concurrent job limit", zap.String("user_id", claims.UserID), zap.Error(err))
+	apierror.Error(w, "Failed to check concurrent job limit", http.StatusServiceUnavailable)
+}
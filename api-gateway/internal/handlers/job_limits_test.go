@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// kvEntry is a stored value of memKV
+type kvEntry struct {
+	nats.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e *kvEntry) Value() []byte    { return e.value }
+func (e *kvEntry) Revision() uint64 { return e.revision }
+
+// memKV is an in-memory key-value bucket with the revision checks of a NATS one
+type memKV struct {
+	mu       sync.Mutex
+	entries  map[string]*kvEntry
+	revision uint64
+}
+
+func newMemKV() *memKV {
+	return &memKV{entries: make(map[string]*kvEntry)}
+}
+
+func (m *memKV) Get(key string) (nats.KeyValueEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+func (m *memKV) Create(key string, value []byte) (uint64, error) {
+	return m.Update(key, value, 0)
+}
+
+func (m *memKV) Update(key string, value []byte, last uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current uint64
+	if entry, ok := m.entries[key]; ok {
+		current = entry.revision
+	}
+	if current != last {
+		return 0, nats.ErrKeyExists
+	}
+	m.revision++
+	m.entries[key] = &kvEntry{value: value, revision: m.revision}
+	return m.revision, nil
+}
+
+// Delete removes key; revision checks aren't applied, the options being opaque
+func (m *memKV) Delete(key string, opts ...nats.DeleteOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// fakeScheduler answers active jobs requests from the jobs it has recorded
+type fakeScheduler struct {
+	mu       sync.Mutex
+	recorded map[string]bool // Job ID to whether it is unfinished
+}
+
+func (s *fakeScheduler) record(jobID string, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded[jobID] = active
+}
+
+func (s *fakeScheduler) countActiveJobs(ctx context.Context, userID string, jobIDs []string) (*activeJobs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply := &activeJobs{}
+	for _, jobID := range jobIDs {
+		if _, ok := s.recorded[jobID]; ok {
+			reply.KnownJobIDs = append(reply.KnownJobIDs, jobID)
+		}
+	}
+	for _, active := range s.recorded {
+		if active {
+			reply.ActiveJobs++
+		}
+	}
+	return reply, nil
+}
+
+func newLimitTestHandler(limit int) (*JobHandler, *fakeScheduler, *auth.Claims) {
+	scheduler := &fakeScheduler{recorded: make(map[string]bool)}
+	h := &JobHandler{
+		Logger:      zap.NewNop(),
+		Config:      &config.Config{JobLimits: config.JobLimitConfig{MaxConcurrentJobs: limit}},
+		Submissions: newMemKV(),
+	}
+	h.countActiveJobs = scheduler.countActiveJobs
+	return h, scheduler, &auth.Claims{UserID: "user-1", Role: "user"}
+}
+
+func assertLimitError(t *testing.T, err error, active int) {
+	t.Helper()
+	var limitErr *ConcurrentJobLimitError
+	if !errors.As(err, &limitErr) || limitErr.Active != active {
+		t.Errorf("reserveJobSlots error %v, want the limit reached with %d active", err, active)
+	}
+}
+
+func TestReserveJobSlotsCountsQueuedJobs(t *testing.T) {
+	h, scheduler, claims := newLimitTestHandler(3)
+	ctx := context.Background()
+
+	// Published jobs the scheduler hasn't picked up yet count against the limit
+	if err := h.reserveJobSlots(ctx, claims, []string{"job-1", "job-2"}); err != nil {
+		t.Fatalf("reserveJobSlots: %v", err)
+	}
+	assertLimitError(t, h.reserveJobSlots(ctx, claims, []string{"job-3", "job-4"}), 2)
+
+	// Once recorded they are counted by the scheduler, and not twice
+	scheduler.record("job-1", true)
+	scheduler.record("job-2", true)
+	if err := h.reserveJobSlots(ctx, claims, []string{"job-3"}); err != nil {
+		t.Fatalf("reserveJobSlots: %v", err)
+	}
+	assertLimitError(t, h.reserveJobSlots(ctx, claims, []string{"job-4"}), 3)
+
+	// Finished jobs free their slot
+	scheduler.record("job-1", false)
+	if err := h.reserveJobSlots(ctx, claims, []string{"job-4"}); err != nil {
+		t.Errorf("reserveJobSlots after a job finished: %v", err)
+	}
+}
+
+func TestReserveJobSlotsConcurrent(t *testing.T) {
+	h, _, claims := newLimitTestHandler(3)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved, refused := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := h.reserveJobSlots(context.Background(), claims, []string{string(rune('a' + i))})
+			mu.Lock()
+			defer mu.Unlock()
+			var limitErr *ConcurrentJobLimitError
+			switch {
+			case err == nil:
+				reserved++
+			case errors.As(err, &limitErr), errors.Is(err, errJobSlotContention):
+				refused++
+			default:
+				t.Errorf("reserveJobSlots: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if reserved != 3 {
+		t.Errorf("%d concurrent submissions reserved a slot, want the limit of 3", reserved)
+	}
+	pending, _, err := h.pendingSubmissions(claims.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending.Jobs) != 3 {
+		t.Errorf("%d jobs pending, want 3", len(pending.Jobs))
+	}
+}
+
+func TestReleaseJobSlots(t *testing.T) {
+	h, _, claims := newLimitTestHandler(1)
+	ctx := context.Background()
+
+	if err := h.reserveJobSlots(ctx, claims, []string{"job-1"}); err != nil {
+		t.Fatalf("reserveJobSlots: %v", err)
+	}
+	h.releaseJobSlots(claims.UserID, []string{"job-1"})
+	if err := h.reserveJobSlots(ctx, claims, []string{"job-2"}); err != nil {
+		t.Errorf("reserveJobSlots after the first job wasn't published: %v", err)
+	}
+}
+
+func TestPendingSubmissionsExpire(t *testing.T) {
+	h, _, claims := newLimitTestHandler(1)
+	stale := &pendingSubmissions{Jobs: map[string]time.Time{"lost-job": time.Now().Add(-PendingSubmissionTTL - time.Minute)}}
+	if err := h.storePendingSubmissions(claims.UserID, stale, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.reserveJobSlots(context.Background(), claims, []string{"job-1"}); err != nil {
+		t.Errorf("reserveJobSlots with only an expired pending job: %v", err)
+	}
+}
+
+func TestUnlimitedUsersSkipTheCount(t *testing.T) {
+	h, _, claims := newLimitTestHandler(-1)
+	h.countActiveJobs = func(context.Context, string, []string) (*activeJobs, error) {
+		return nil, errors.New("scheduler unreachable")
+	}
+	if err := h.reserveJobSlots(context.Background(), claims, []string{"job-1"}); err != nil {
+		t.Errorf("reserveJobSlots for an unlimited user: %v", err)
+	}
+}
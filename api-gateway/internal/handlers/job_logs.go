@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// storageService is the Consul name of the storage-service.
+const storageService = "storage-service"
+
+// jobBucket is the storage-service bucket providers upload job logs and outputs to.
+const jobBucket = "jobs"
+
+// GetJobLogs streams the output log a provider uploads to the storage-service when a
+// job ends. Range headers are passed through, so a client can tail a log by asking
+// for its last bytes (e.g. "Range: bytes=-4096"). Until the job has ended there is no
+// log and the storage-service answers 404.
+func (h *JobHandler) GetJobLogs(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	h.Logger.Info("Received request for job logs", zap.String("jobID", jobID))
+
+	if _, ok := h.lookupOwnJob(w, r, jobID); !ok {
+		return
+	}
+
+	// The storage-service doesn't know our users, so the caller's token stays here
+	r.Header.Del("Authorization")
+	h.Proxy.Forward(w, r, storageService, "/objects/"+jobBucket+"/"+jobID+"/output.log")
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// requestAs returns a request made by the given user
+func requestAs(userID string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	return r.WithContext(context.WithValue(r.Context(), auth.ContextKeyClaims, &auth.Claims{UserID: userID, Role: "user"}))
+}
+
+func TestAuthorizeJobStream(t *testing.T) {
+	h, _, claims := newLimitTestHandler(10)
+	// The scheduler has recorded job-1 for user-1 and job-2 for user-2
+	owners := map[string]string{"job-1": "user-1", "job-2": "user-2"}
+	h.requestScheduler = func(ctx context.Context, subject string, data []byte) ([]byte, error) {
+		var req struct {
+			JobID string `json:"job_id"`
+		}
+		json.Unmarshal(data, &req)
+		owner, ok := owners[req.JobID]
+		return json.Marshal(schedulerJobStatus{JobID: req.JobID, UserID: owner, Found: ok})
+	}
+	// job-3 was just submitted by user-1 and is still waiting for the scheduler
+	if err := h.reserveJobSlots(context.Background(), claims, []string{"job-3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user  string
+		jobID string
+		want  bool
+	}{
+		{"user-1", "job-1", true},
+		{"user-1", "job-2", false},
+		{"user-1", "job-3", true},
+		{"user-2", "job-3", false},
+		{"user-1", "unknown", false},
+		{"", "job-1", false},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if got := h.authorizeJobStream(rec, requestAs(tt.user), tt.jobID); got != tt.want {
+			t.Errorf("%q streaming %s: allowed %v, want %v", tt.user, tt.jobID, got, tt.want)
+		}
+		if !tt.want && rec.Code != http.StatusNotFound {
+			t.Errorf("%q streaming %s: status %d, want 404", tt.user, tt.jobID, rec.Code)
+		}
+	}
+}
+
+func TestGetJobLogsOnlyForOwner(t *testing.T) {
+	h, _, _ := newLimitTestHandler(10)
+	// job-1 belongs to user-1; job-2 has no recorded owner
+	owners := map[string]string{"job-1": "user-1", "job-2": ""}
+	h.requestScheduler = func(ctx context.Context, subject string, data []byte) ([]byte, error) {
+		var req struct {
+			JobID string `json:"job_id"`
+		}
+		json.Unmarshal(data, &req)
+		owner, ok := owners[req.JobID]
+		return json.Marshal(schedulerJobStatus{JobID: req.JobID, UserID: owner, Found: ok})
+	}
+
+	for _, tt := range []struct{ user, jobID string }{
+		{"user-2", "job-1"},
+		{"user-1", "job-2"},
+		{"user-2", "job-2"},
+	} {
+		r := requestAs(tt.user)
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("jobID", tt.jobID)
+		rec := httptest.NewRecorder()
+		h.GetJobLogs(rec, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s fetching the log of %s: status %d, want 404", tt.user, tt.jobID, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/webhook"
+)
+
+// maxGPUMemoryMB is the most VRAM a job may ask for; no GPU offered has more.
+const maxGPUMemoryMB = 512 * 1024
+
+// scriptExecutionTypes are the execution types that run a script on the provider host.
+var scriptExecutionTypes = map[string]bool{
+	"script": true,
+	"python": true,
+	"bash":   true,
+}
+
+// ValidationErrors lists everything wrong with a job submission, one problem per entry.
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// Validate checks a job submission before anything is reserved or published for it and
+// returns every problem found, or nil if the job is valid. Jobs without an execution type
+// only carry params and skip the execution checks.
+func (req *SubmitJobRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if req.Type == "" {
+		addf("type is required")
+	}
+	if req.Name == "" {
+		addf("name is required")
+	}
+	if len(req.Params) == 0 {
+		addf("params is required")
+	}
+
+	switch executionType := req.ExecutionType; {
+	case executionType == "":
+	case executionType == "docker":
+		if strings.TrimSpace(req.DockerImage) == "" {
+			addf("docker_image is required for docker jobs")
+		}
+	case scriptExecutionTypes[executionType]:
+		if strings.TrimSpace(req.Script) == "" {
+			addf("script is required for %s jobs", executionType)
+		}
+	case executionType == "wasm":
+		if strings.TrimSpace(req.WASMModule) == "" {
+			addf("wasm_module is required for wasm jobs")
+		}
+	default:
+		addf("execution_type must be one of docker, script, python, bash or wasm, not %q", executionType)
+	}
+
+	if req.GPUCount < 0 {
+		addf("gpu_count must not be negative")
+	}
+	if req.MinComputeCapability < 0 {
+		addf("min_compute_capability must not be negative")
+	}
+	if req.MaxDurationMinutes < 0 {
+		addf("max_duration_minutes must not be negative")
+	}
+	if req.MaxCostDGPU.IsNegative() {
+		addf("max_cost_dgpu must not be negative")
+	}
+	if req.Requirements != nil {
+		errs = append(errs, req.Requirements.validate()...)
+	}
+
+	if req.NotificationWebhook != "" {
+		if err := webhook.ValidateURL(req.NotificationWebhook); err != nil {
+			addf("notification_webhook: %v", err)
+		}
+	}
+	return errs
+}
+
+// validate checks that the VRAM a job asks for is one a GPU can have.
+func (r *JobRequirements) validate() ValidationErrors {
+	var errs ValidationErrors
+	for _, field := range []struct {
+		name  string
+		value int64
+	}{
+		{"requirements.gpu_memory_mb", r.GPUMemoryMB},
+		{"requirements.min_gpu_memory_mb", r.MinGPUMemoryMB},
+	} {
+		switch {
+		case field.value < 0:
+			errs = append(errs, fmt.Sprintf("%s must not be negative", field.name))
+		case field.value > maxGPUMemoryMB:
+			errs = append(errs, fmt.Sprintf("%s must be at most %d", field.name, maxGPUMemoryMB))
+		}
+	}
+	if r.GPUMemoryMB > 0 && r.MinGPUMemoryMB > r.GPUMemoryMB {
+		errs = append(errs, "requirements.min_gpu_memory_mb must not exceed requirements.gpu_memory_mb")
+	}
+	return errs
+}
+
+// validateJobRequest validates a job submission, returning its ValidationErrors as an error.
+func validateJobRequest(req *SubmitJobRequest) error {
+	if errs := req.Validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
+	pathpkg "path"
 	"strings"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
 	consul_client "github.com/dante-gpu/dante-backend/api-gateway/internal/consul"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/loadbalancer"
@@ -40,23 +46,107 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	serviceName := chi.URLParam(r, "serviceName")
 	if serviceName == "" {
 		h.Logger.Error("Missing service name in proxy request path", zap.String("path", r.URL.Path))
-		http.Error(w, "Service name missing in path", http.StatusBadRequest)
+		apierror.Error(w, "Service name missing in path", http.StatusBadRequest)
 		return
 	}
 
+	// I should modify the request path before proxying.
+	// Remove the "/services/{serviceName}" prefix.
+	// Example: /services/my-cool-service/some/path -> /some/path
+	path := strings.TrimPrefix(r.URL.Path, "/services/"+serviceName)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // Ensure leading slash
+	}
+
+	// Job logs and outputs are served to the job's owner only, through the job routes
+	if strings.EqualFold(serviceName, storageService) {
+		blocked, err := namesJobBucket(r, path)
+		if errors.Is(err, errStorageBodyTooLarge) {
+			apierror.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			apierror.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if blocked {
+			h.Logger.Warn("Refused proxying a request for the job bucket", zap.String("path", r.URL.Path), zap.String("query", r.URL.RawQuery))
+			apierror.Error(w, "Job logs and outputs are only available through /api/v1/jobs", http.StatusForbidden)
+			return
+		}
+	}
+
+	h.Forward(w, r, serviceName, path)
+}
+
+// maxStorageRequestBody bounds the storage-service request bodies namesJobBucket reads.
+// Its JSON requests are small; completing a 10,000 part upload stays well inside it.
+const maxStorageRequestBody = 2 << 20
+
+var errStorageBodyTooLarge = errors.New("storage request body too large")
+
+// namesJobBucket reports whether a storage-service request refers to the job bucket:
+// by its path, a bucket query parameter or the bucket field of a POSTed JSON body, the
+// places the storage-service reads a bucket from. A body it reads is put back for the
+// proxy to send on.
+func namesJobBucket(r *http.Request, path string) (bool, error) {
+	// The bucket follows the route name, e.g. /objects/{bucketName}/key
+	segments := strings.Split(strings.TrimPrefix(pathpkg.Clean(path), "/"), "/")
+	if len(segments) >= 2 && segments[1] == jobBucket {
+		switch segments[0] {
+		case "objects", "presigned-url", "buckets":
+			return true, nil
+		}
+	}
+	for _, bucket := range r.URL.Query()["bucket"] {
+		if bucket == jobBucket {
+			return true, nil
+		}
+	}
+
+	if r.Method != http.MethodPost || r.Body == nil {
+		return false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStorageRequestBody+1))
+	if err != nil {
+		return false, err
+	}
+	if len(body) > maxStorageRequestBody {
+		return false, errStorageBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Decoded as the storage-service does, so that both see the same bucket
+	var req struct {
+		Bucket string `json:"bucket"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+		return false, nil // Not JSON, so it names no bucket
+	}
+	return req.Bucket == jobBucket, nil
+}
+
+// Forward proxies the request to a healthy instance of serviceName, replacing its path.
+// Gateway routes that front a backend service use this directly.
+func (h *ProxyHandler) Forward(w http.ResponseWriter, r *http.Request, serviceName, path string) {
 	// I need to discover healthy instances of the service using Consul.
 	serviceEntries, err := consul_client.DiscoverService(h.ConsulClient, serviceName, h.Logger)
 	if err != nil {
 		// Log the error (already done in DiscoverService)
-		http.Error(w, fmt.Sprintf("Service '%s' not found or unhealthy: %v", serviceName, err), http.StatusBadGateway) // 502
+		apierror.Error(w, fmt.Sprintf("Service '%s' not found or unhealthy: %v", serviceName, err), http.StatusBadGateway) // 502
 		return
 	}
 
 	// I should select a backend instance using the load balancer.
 	targetURL, err := h.Balancer.Next(serviceEntries)
+	if errors.Is(err, loadbalancer.ErrAllCircuitsOpen) {
+		h.Logger.Warn("All instances of service are failing, not proxying", zap.String("service", serviceName), zap.Int("instances", len(serviceEntries)))
+		apierror.Error(w, fmt.Sprintf("All instances of service '%s' are failing; try again shortly", serviceName), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		h.Logger.Error("Load balancer failed to select a service instance", zap.String("service", serviceName), zap.Error(err))
-		http.Error(w, fmt.Sprintf("Failed to select instance for service '%s'", serviceName), http.StatusBadGateway)
+		apierror.Error(w, fmt.Sprintf("Failed to select instance for service '%s'", serviceName), http.StatusBadGateway)
 		return
 	}
 
@@ -69,14 +159,34 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// I need to create the reverse proxy.
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
-	// I should modify the request path before proxying.
-	// Remove the "/services/{serviceName}" prefix.
-	// Example: /services/my-cool-service/some/path -> /some/path
-	originalPath := r.URL.Path
-	r.URL.Path = strings.TrimPrefix(originalPath, "/services/"+serviceName)
-	if !strings.HasPrefix(r.URL.Path, "/") {
-		r.URL.Path = "/" + r.URL.Path // Ensure leading slash
+	// I report how the instance answered so the load balancer can stop routing to it
+	// if it keeps failing. Failures to get a response and 5xx responses count; a request
+	// the client gave up on says nothing about the instance.
+	tracker, tracked := h.Balancer.(loadbalancer.FailureTracker)
+	if tracked {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode >= http.StatusInternalServerError {
+				tracker.RecordFailure(targetURL)
+			} else {
+				tracker.RecordSuccess(targetURL)
+			}
+			return nil
+		}
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if tracked && r.Context().Err() == nil {
+			tracker.RecordFailure(targetURL)
+		}
+		h.Logger.Warn("Service instance failed to respond",
+			zap.String("service", serviceName),
+			zap.String("target_url", targetURL.String()),
+			zap.Error(err),
+		)
+		apierror.Error(w, fmt.Sprintf("Service '%s' failed to respond", serviceName), http.StatusBadGateway)
 	}
+
+	originalPath := r.URL.Path
+	r.URL.Path = path
 	// Also clear RawPath to prevent conflicts
 	r.URL.RawPath = ""
 
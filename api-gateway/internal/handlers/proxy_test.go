@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/loadbalancer"
+	"github.com/go-chi/chi/v5"
+	consulapi "github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// fakeConsul answers health queries for one service with the given instance
+func fakeConsul(t *testing.T, service string, instance *httptest.Server) *consulapi.Client {
+	t.Helper()
+	u, err := url.Parse(instance.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/"+service {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode([]*consulapi.ServiceEntry{{
+			Node:    &consulapi.Node{Address: host},
+			Service: &consulapi.AgentService{Service: service, Address: host, Port: port},
+		}})
+	}))
+	t.Cleanup(consul.Close)
+
+	client, err := consulapi.NewClient(&consulapi.Config{Address: consul.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// forward proxies a request to the service and returns the status it got
+func forward(h *ProxyHandler, service string) int {
+	rec := httptest.NewRecorder()
+	h.Forward(rec, httptest.NewRequest("GET", "/api/v1/things", nil), service, "/things")
+	return rec.Code
+}
+
+func TestForwardOpensCircuitOnServerErrors(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	var calls atomic.Int32
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer instance.Close()
+
+	breaker := loadbalancer.NewCircuitBreaker(loadbalancer.NewRoundRobin(), 3, 50*time.Millisecond)
+	h := NewProxyHandler(zap.NewNop(), nil, fakeConsul(t, "things", instance), breaker)
+
+	for i := 0; i < 3; i++ {
+		if code := forward(h, "things"); code != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: status %d, want the instance's 503", i+1, code)
+		}
+	}
+	if code := forward(h, "things"); code != http.StatusServiceUnavailable || calls.Load() != 3 {
+		t.Fatalf("after three 503s: status %d with %d calls, want the instance skipped", code, calls.Load())
+	}
+
+	// The instance recovers; after the cooldown a probe finds out and closes the circuit
+	status.Store(http.StatusOK)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if code := forward(h, "things"); code != http.StatusOK {
+			t.Fatalf("request %d after recovery: status %d, want 200", i+1, code)
+		}
+	}
+	if calls.Load() != 6 {
+		t.Errorf("instance called %d times, want 6", calls.Load())
+	}
+}
+
+func TestForwardCountsClientErrorsAsSuccess(t *testing.T) {
+	var calls atomic.Int32
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer instance.Close()
+
+	breaker := loadbalancer.NewCircuitBreaker(loadbalancer.NewRoundRobin(), 1, time.Minute)
+	h := NewProxyHandler(zap.NewNop(), nil, fakeConsul(t, "things", instance), breaker)
+	for i := 0; i < 3; i++ {
+		if code := forward(h, "things"); code != http.StatusNotFound {
+			t.Fatalf("request %d: status %d, want the instance's 404", i+1, code)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("instance called %d times, want every 404 passed through", calls.Load())
+	}
+}
+
+func TestForwardOpensCircuitWhenUnreachable(t *testing.T) {
+	instance := httptest.NewServer(http.NotFoundHandler())
+	consul := fakeConsul(t, "things", instance)
+	instance.Close()
+
+	breaker := loadbalancer.NewCircuitBreaker(loadbalancer.NewRoundRobin(), 2, time.Minute)
+	h := NewProxyHandler(zap.NewNop(), nil, consul, breaker)
+	for i := 0; i < 2; i++ {
+		if code := forward(h, "things"); code != http.StatusBadGateway {
+			t.Fatalf("request %d: status %d, want 502", i+1, code)
+		}
+	}
+	if code := forward(h, "things"); code != http.StatusServiceUnavailable {
+		t.Errorf("after two failures: status %d, want 503", code)
+	}
+}
+
+func TestServeHTTPRefusesJobBucket(t *testing.T) {
+	var calls atomic.Int32
+	var lastBody atomic.Value
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+	}))
+	defer instance.Close()
+
+	h := NewProxyHandler(zap.NewNop(), nil, fakeConsul(t, storageService, instance), loadbalancer.NewRoundRobin())
+	router := chi.NewRouter()
+	router.HandleFunc("/services/{serviceName}/*", h.ServeHTTP)
+
+	tests := []struct {
+		method, target, body string
+		wantProxied          bool
+	}{
+		{"GET", "/objects/jobs/job-1/output.log", "", false},
+		{"GET", "/objects//jobs/job-1/output.log", "", false},
+		{"GET", "/objects/%6Aobs/job-1/output.log", "", false},
+		{"GET", "/objects/datasets/../jobs/job-1/output.log", "", false},
+		{"HEAD", "/objects/jobs/job-1/output.log", "", false},
+		{"GET", "/objects/jobs/list?prefix=job-1/", "", false},
+		{"POST", "/presigned-url/jobs/job-1/output.log", "", false},
+		{"GET", "/presign/download?bucket=datasets&bucket=jobs&key=job-1/output.log", "", false},
+		{"DELETE", "/objects?bucket=jobs&prefix=job-1/", "", false},
+		{"POST", "/upload/multipart/initiate", `{"bucket":"jobs","key":"job-1/output.log"}`, false},
+		{"POST", "/presign/upload", `{"Bucket":"jobs","key":"job-1/output.log"} trailing`, false},
+		{"GET", "/objects/datasets/jobs/a.csv", "", true},
+		{"GET", "/objects/jobs-archive/a.csv", "", true},
+		{"POST", "/upload/multipart/initiate", `{"bucket":"datasets","key":"a.csv"}`, true},
+	}
+	for _, tt := range tests {
+		before := calls.Load()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, "/services/"+storageService+tt.target, strings.NewReader(tt.body)))
+		proxied := calls.Load() > before
+		if proxied != tt.wantProxied {
+			t.Errorf("%s %s: proxied %v (status %d), want %v", tt.method, tt.target, proxied, rec.Code, tt.wantProxied)
+		}
+		if !tt.wantProxied && rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want 403", tt.method, tt.target, rec.Code)
+		}
+		if proxied && lastBody.Load() != tt.body {
+			t.Errorf("%s %s: storage-service got body %q, want %q", tt.method, tt.target, lastBody.Load(), tt.body)
+		}
+	}
+}
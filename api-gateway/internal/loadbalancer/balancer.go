@@ -45,13 +45,6 @@ func (rr *RoundRobin) Next(services []*consulapi.ServiceEntry) (*url.URL, error)
 	// Modulo operation to wrap around the list of services.
 	selected := services[idx%uint64(len(services))]
 
-	// I need to construct the URL for the selected service.
-	address := selected.Service.Address
-	if address == "" {
-		address = selected.Node.Address // Fallback to node address
-	}
-	port := selected.Service.Port
-
 	// --- Determine Scheme (http/https) ---
 	// I will check Service Meta first, then Tags.
 	scheme := DefaultScheme // Default to http
@@ -77,7 +70,8 @@ func (rr *RoundRobin) Next(services []*consulapi.ServiceEntry) (*url.URL, error)
 	}
 	// --- End Scheme Determination ---
 
-	targetURL := fmt.Sprintf("%s://%s:%d", scheme, address, port)
+	// I need to construct the URL for the selected service.
+	targetURL := fmt.Sprintf("%s://%s", scheme, instanceHost(selected))
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		// Maybe log this error with more context?
@@ -88,6 +82,15 @@ func (rr *RoundRobin) Next(services []*consulapi.ServiceEntry) (*url.URL, error)
 	return parsedURL, nil
 }
 
+// instanceHost returns the host:port a service instance is reached at.
+func instanceHost(entry *consulapi.ServiceEntry) string {
+	address := entry.Service.Address
+	if address == "" {
+		address = entry.Node.Address // Fallback to node address
+	}
+	return fmt.Sprintf("%s:%d", address, entry.Service.Port)
+}
+
 // // Future: Implement other load balancing strategies
 // type Random struct {}
 // type LeastConnections struct {}
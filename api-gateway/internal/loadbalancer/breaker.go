@@ -0,0 +1,178 @@
+package loadbalancer
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// ErrAllCircuitsOpen is returned when every instance of a service has failed recently
+// and none may be tried until its cooldown is over.
+var ErrAllCircuitsOpen = errors.New("all service instances are failing")
+
+// FailureTracker is implemented by load balancers that want to know how the instance
+// they selected answered.
+type FailureTracker interface {
+	RecordSuccess(target *url.URL)
+	RecordFailure(target *url.URL)
+}
+
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Requests go through
+	circuitOpen                         // Skipped until the cooldown is over
+	circuitHalfOpen                     // One probe request may go through
+)
+
+// staleCircuitCooldowns is how many cooldowns an instance's circuit is kept after the
+// instance was last offered for selection or reported on. By then the instance has
+// deregistered or kept failing its health checks, and it starts afresh should it
+// come back.
+const staleCircuitCooldowns = 10
+
+// circuit tracks one instance. Instances without a circuit are healthy.
+type circuit struct {
+	state    circuitState
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+	probeAt  time.Time // When the half-open probe was let through
+	seenAt   time.Time // When the instance was last offered for selection or reported on
+}
+
+// CircuitBreaker wraps a load balancer to keep it from selecting instances that keep
+// failing. After threshold consecutive failures an instance's circuit opens and the
+// instance is skipped for the cooldown. Then one request is let through to probe it:
+// the circuit closes if it succeeds and opens for another cooldown if it fails. A probe
+// that never reports back is given up on after a cooldown, and another is let through.
+// Circuits of instances that are no longer offered for selection are dropped after
+// staleCircuitCooldowns cooldowns.
+type CircuitBreaker struct {
+	next      LoadBalancer
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit // Keyed by instance host:port
+	prunedAt time.Time           // When stale circuits were last dropped
+}
+
+// NewCircuitBreaker creates a CircuitBreaker selecting among the instances it doesn't
+// skip with next.
+func NewCircuitBreaker(next LoadBalancer, threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// Next implements the LoadBalancer interface, passing the instances that may be tried
+// to the wrapped load balancer. It returns ErrAllCircuitsOpen if there are none.
+func (cb *CircuitBreaker) Next(services []*consulapi.ServiceEntry) (*url.URL, error) {
+	if len(services) == 0 {
+		return cb.next.Next(services)
+	}
+
+	// I hold the lock while selecting so that a half-open instance gets one probe only.
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	cb.prune(now)
+	available := make([]*consulapi.ServiceEntry, 0, len(services))
+	for _, entry := range services {
+		c := cb.circuits[instanceHost(entry)]
+		if c != nil {
+			c.seenAt = now
+		}
+		if cb.allows(c, now) {
+			available = append(available, entry)
+		}
+	}
+	if len(available) == 0 {
+		return nil, ErrAllCircuitsOpen
+	}
+
+	target, err := cb.next.Next(available)
+	if err != nil {
+		return nil, err
+	}
+	if c := cb.circuits[target.Host]; c != nil && c.state != circuitClosed {
+		c.state = circuitHalfOpen
+		c.probeAt = now
+	}
+	return target, nil
+}
+
+// prune drops the circuits of instances that haven't been seen for staleCircuitCooldowns
+// cooldowns, checking at most once a cooldown.
+func (cb *CircuitBreaker) prune(now time.Time) {
+	if now.Sub(cb.prunedAt) < cb.cooldown {
+		return
+	}
+	cb.prunedAt = now
+	for host, c := range cb.circuits {
+		if now.Sub(c.seenAt) >= staleCircuitCooldowns*cb.cooldown {
+			delete(cb.circuits, host)
+		}
+	}
+}
+
+// allows reports whether an instance with the circuit may be selected.
+func (cb *CircuitBreaker) allows(c *circuit, now time.Time) bool {
+	switch {
+	case c == nil || c.state == circuitClosed:
+		return true
+	case c.state == circuitOpen:
+		return now.Sub(c.openedAt) >= cb.cooldown
+	default:
+		return now.Sub(c.probeAt) >= cb.cooldown
+	}
+}
+
+// RecordSuccess implements FailureTracker. A success closes the instance's circuit,
+// unless it is open: requests sent before it opened may still be answering.
+func (cb *CircuitBreaker) RecordSuccess(target *url.URL) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c := cb.circuits[target.Host]; c != nil && c.state != circuitOpen {
+		delete(cb.circuits, target.Host)
+	}
+}
+
+// RecordFailure implements FailureTracker. It opens the instance's circuit once the
+// threshold is reached, or right away if the failure was a half-open probe.
+func (cb *CircuitBreaker) RecordFailure(target *url.URL) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	c := cb.circuits[target.Host]
+	if c == nil {
+		c = &circuit{}
+		cb.circuits[target.Host] = c
+	}
+	c.seenAt = now
+	switch c.state {
+	case circuitClosed:
+		c.failures++
+		if c.failures >= cb.threshold {
+			c.state = circuitOpen
+			c.openedAt = now
+		}
+	case circuitHalfOpen:
+		c.state = circuitOpen
+		c.openedAt = now
+	}
+}
@@ -0,0 +1,158 @@
+package loadbalancer
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// testClock is a clock tests move forward by hand
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestBreaker returns a circuit breaker over round robin that opens after two
+// failures, with a one-minute cooldown on the returned clock
+func newTestBreaker() (*CircuitBreaker, *testClock) {
+	clock := &testClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker(NewRoundRobin(), 2, time.Minute)
+	cb.now = clock.now
+	return cb, clock
+}
+
+// instances returns service entries listening on 10.0.0.1 at the given ports
+func instances(ports ...int) []*consulapi.ServiceEntry {
+	entries := make([]*consulapi.ServiceEntry, len(ports))
+	for i, port := range ports {
+		entries[i] = &consulapi.ServiceEntry{
+			Node:    &consulapi.Node{},
+			Service: &consulapi.AgentService{Address: "10.0.0.1", Port: port},
+		}
+	}
+	return entries
+}
+
+func target(port int) *url.URL {
+	return &url.URL{Scheme: "http", Host: "10.0.0.1:" + strconv.Itoa(port)}
+}
+
+// selected returns the hosts picked by n selections among services
+func selected(t *testing.T, cb *CircuitBreaker, services []*consulapi.ServiceEntry, n int) map[string]int {
+	t.Helper()
+	hosts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		u, err := cb.Next(services)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		hosts[u.Host]++
+	}
+	return hosts
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	cb, _ := newTestBreaker()
+	services := instances(8001, 8002)
+
+	cb.RecordFailure(target(8001))
+	if hosts := selected(t, cb, services, 4); hosts["10.0.0.1:8001"] == 0 {
+		t.Errorf("instance skipped after one failure, below the threshold: %v", hosts)
+	}
+	cb.RecordFailure(target(8001))
+	if hosts := selected(t, cb, services, 4); hosts["10.0.0.1:8001"] != 0 {
+		t.Errorf("instance selected %d times after reaching the threshold", hosts["10.0.0.1:8001"])
+	}
+
+	cb.RecordFailure(target(8002))
+	cb.RecordSuccess(target(8002))
+	cb.RecordFailure(target(8002))
+	if _, err := cb.Next(services); err != nil {
+		t.Errorf("a success in between didn't reset the failure count: %v", err)
+	}
+	cb.RecordFailure(target(8002))
+	if _, err := cb.Next(services); !errors.Is(err, ErrAllCircuitsOpen) {
+		t.Errorf("every instance open: %v, want ErrAllCircuitsOpen", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenRecovery(t *testing.T) {
+	cb, clock := newTestBreaker()
+	services := instances(8001)
+	cb.RecordFailure(target(8001))
+	cb.RecordFailure(target(8001))
+
+	clock.advance(59 * time.Second)
+	if _, err := cb.Next(services); !errors.Is(err, ErrAllCircuitsOpen) {
+		t.Fatalf("before the cooldown: %v, want ErrAllCircuitsOpen", err)
+	}
+
+	// One probe goes through after the cooldown, and fails
+	clock.advance(time.Second)
+	if _, err := cb.Next(services); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if _, err := cb.Next(services); !errors.Is(err, ErrAllCircuitsOpen) {
+		t.Fatalf("second request during the probe: %v, want ErrAllCircuitsOpen", err)
+	}
+	cb.RecordFailure(target(8001))
+	clock.advance(30 * time.Second)
+	if _, err := cb.Next(services); !errors.Is(err, ErrAllCircuitsOpen) {
+		t.Fatalf("after a failed probe: %v, want another cooldown", err)
+	}
+
+	// The next probe succeeds and closes the circuit
+	clock.advance(30 * time.Second)
+	if _, err := cb.Next(services); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	cb.RecordSuccess(target(8001))
+	if hosts := selected(t, cb, services, 3); hosts["10.0.0.1:8001"] != 3 {
+		t.Errorf("after a successful probe: %v, want the instance back in rotation", hosts)
+	}
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	cb, clock := newTestBreaker()
+	services := instances(8001)
+	cb.RecordFailure(target(8001))
+	cb.RecordFailure(target(8001))
+	clock.advance(time.Minute)
+	if _, err := cb.Next(services); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	// The probe never reports back
+	clock.advance(time.Minute)
+	if _, err := cb.Next(services); err != nil {
+		t.Errorf("a cooldown after an abandoned probe: %v, want another probe", err)
+	}
+}
+
+func TestCircuitBreakerPrunesDeregisteredInstances(t *testing.T) {
+	cb, clock := newTestBreaker()
+	for _, port := range []int{8001, 8002} {
+		cb.RecordFailure(target(port))
+		cb.RecordFailure(target(port))
+	}
+
+	// 8001 deregistered; 8002 is still offered, though skipped
+	for i := 0; i < staleCircuitCooldowns; i++ {
+		clock.advance(time.Minute)
+		cb.Next(instances(8002))
+		cb.RecordFailure(target(8002))
+	}
+	cb.Next(instances(8002))
+
+	if _, ok := cb.circuits["10.0.0.1:8001"]; ok {
+		t.Error("circuit of a deregistered instance kept")
+	}
+	if _, ok := cb.circuits["10.0.0.1:8002"]; !ok {
+		t.Error("circuit of a registered instance dropped")
+	}
+}
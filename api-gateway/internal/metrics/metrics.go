@@ -0,0 +1,75 @@
+// Package metrics holds the gateway's Prometheus collectors and the /metrics handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "dante"
+	subsystem = "api_gateway"
+)
+
+var (
+	// RequestDuration observes request latency by method, route pattern and status code.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// JobsSubmitted counts job submissions by result: "queued" or "failed".
+	JobsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "jobs_submitted_total",
+		Help:      "Jobs submitted through the gateway by result.",
+	}, []string{"result"})
+)
+
+var registerOnce sync.Once
+
+// Register adds the gateway's collectors to the default registry, which already holds
+// the Go runtime and process collectors. Only the first call registers anything, so
+// tests building several routers don't panic on duplicate registration.
+func Register() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(RequestDuration, JobsSubmitted)
+	})
+}
+
+// Handler serves the default registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	Register()
+	return promhttp.Handler()
+}
+
+// Middleware records RequestDuration for every request. Requests are labeled with the
+// matched chi route pattern rather than the path, so IDs in URLs don't become labels.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+		RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
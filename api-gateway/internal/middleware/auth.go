@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
 	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
 	"go.uber.org/zap"
 )
@@ -18,7 +19,7 @@ func Authenticator(logger *zap.Logger, jwtSecret string) func(next http.Handler)
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				logger.Warn("Missing Authorization header")
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				apierror.Error(w, "Authorization header required", http.StatusUnauthorized)
 				return
 			}
 
@@ -26,7 +27,7 @@ func Authenticator(logger *zap.Logger, jwtSecret string) func(next http.Handler)
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 				logger.Warn("Invalid Authorization header format", zap.String("header", authHeader))
-				http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+				apierror.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
 				return
 			}
 
@@ -36,7 +37,7 @@ func Authenticator(logger *zap.Logger, jwtSecret string) func(next http.Handler)
 			claims, err := auth.ValidateJWT(tokenString, jwtSecret)
 			if err != nil {
 				logger.Warn("Invalid JWT token", zap.Error(err))
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				apierror.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
 
@@ -49,3 +50,35 @@ func Authenticator(logger *zap.Logger, jwtSecret string) func(next http.Handler)
 		return http.HandlerFunc(fn)
 	}
 }
+
+// RequireRole only lets through requests whose JWT role is one of roles. It reads the
+// claims set by Authenticator, so it must be mounted after it.
+func RequireRole(logger *zap.Logger, roles ...string) func(next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(auth.ContextKeyClaims).(*auth.Claims)
+			if !ok || claims == nil {
+				// Authenticator didn't run; I shouldn't let the request through.
+				apierror.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !allowed[claims.Role] {
+				logger.Warn("Forbidden request for role",
+					zap.String("user_id", claims.UserID),
+					zap.String("role", claims.Role),
+					zap.String("path", r.URL.Path))
+				apierror.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+)
+
+// Compressor gzips responses for clients that accept it. A response is compressed
+// only if it reaches the minimum size, its content type is on the allowlist and it
+// isn't encoded already (e.g. by a proxied service).
+type Compressor struct {
+	minSize      int
+	contentTypes []string // Media types; entries ending in "/*" match a whole type
+	pool         sync.Pool
+}
+
+// NewCompressor creates a compressor from the gateway configuration.
+func NewCompressor(cfg config.CompressionConfig) *Compressor {
+	level := cfg.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	c := &Compressor{minSize: cfg.MinSize}
+	for _, contentType := range cfg.ContentTypes {
+		c.contentTypes = append(c.contentTypes, strings.ToLower(strings.TrimSpace(contentType)))
+	}
+	c.pool.New = func() interface{} {
+		gz, _ := gzip.NewWriterLevel(nil, level) // level is valid
+		return gz
+	}
+	return c
+}
+
+// Middleware compresses the responses of the wrapped handler.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebSocket upgrades hijack the connection, and HEAD responses have no body
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Header.Get("Upgrade") != "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: c}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressible reports whether a response with the given content type may be compressed.
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		return false
+	}
+	for _, allowed := range c.contentTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether the
+// response is worth compressing, then either gzips it or passes it through.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status) // Informational responses go straight out
+		return
+	}
+	cw.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.compressor.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide writes the headers, compressing if the response qualifies, and sends what
+// has been buffered so far.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if cw.compressor.compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if len(cw.buf) >= cw.compressor.minSize && len(cw.buf) > 0 &&
+		h.Get("Content-Encoding") == "" &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified &&
+		cw.status != http.StatusPartialContent && // Byte ranges refer to the unencoded body
+		cw.compressor.compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag) // The compressed body isn't byte-identical
+		}
+		cw.gz = cw.compressor.pool.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.gz != nil {
+		_, err := cw.gz.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends everything written so far, so streamed responses aren't held back.
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.status != 0 {
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	cw.decided = true // The connection is no longer ours to write to
+	return hijacker.Hijack()
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.status != 0 {
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Close()
+		cw.gz.Reset(nil)
+		cw.compressor.pool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/apierror"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"go.uber.org/zap"
+)
+
+// idleBucketSweepInterval is how often buckets that have refilled completely are dropped.
+const idleBucketSweepInterval = time.Minute
+
+// rateLimit is a token bucket limit: rate tokens per second up to burst tokens.
+type rateLimit struct {
+	method     string
+	pathPrefix string
+	rate       float64
+	burst      float64
+}
+
+// tokenBucket holds the tokens left for one client under one limit.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter enforces token bucket limits per client and route.
+type RateLimiter struct {
+	logger       *zap.Logger
+	defaultLimit rateLimit
+	routeLimits  []rateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a rate limiter from the gateway configuration.
+func NewRateLimiter(cfg config.RateLimitConfig, logger *zap.Logger) *RateLimiter {
+	rl := &RateLimiter{
+		logger:       logger,
+		defaultLimit: newRateLimit("", "", cfg.RequestsPerMinute, cfg.Burst),
+		buckets:      make(map[string]*tokenBucket),
+		lastSweep:    time.Now(),
+	}
+	for _, route := range cfg.Routes {
+		rl.routeLimits = append(rl.routeLimits, newRateLimit(route.Method, route.PathPrefix, route.RequestsPerMinute, route.Burst))
+	}
+	return rl
+}
+
+func newRateLimit(method, pathPrefix string, requestsPerMinute, burst int) rateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	return rateLimit{
+		method:     strings.ToUpper(method),
+		pathPrefix: pathPrefix,
+		rate:       float64(requestsPerMinute) / 60,
+		burst:      float64(burst),
+	}
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests and a Retry-After
+// header. Clients are identified by their authenticated user ID, falling back to their IP
+// address, so it must be mounted after Authenticator and chi's RealIP middleware.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limitIndex, limit := rl.limitFor(r)
+		client := clientKey(r)
+
+		allowed, remaining, retryAfter := rl.take(strconv.Itoa(limitIndex)+"|"+client, limit, time.Now())
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(limit.burst)))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			rl.logger.Warn("Rate limit exceeded",
+				zap.String("client", client),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("retry_after_seconds", seconds),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			apierror.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitFor returns the first route limit matching the request, or the default limit.
+// The index identifies the limit so that each route gets its own buckets.
+func (rl *RateLimiter) limitFor(r *http.Request) (int, rateLimit) {
+	for i, limit := range rl.routeLimits {
+		if limit.method != "" && limit.method != r.Method {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, limit.pathPrefix) {
+			return i + 1, limit
+		}
+	}
+	return 0, rl.defaultLimit
+}
+
+// take refills the bucket for the elapsed time and consumes one token if available. It
+// returns whether the request is allowed, the whole tokens left and, when rejected, how
+// long until a token is available.
+func (rl *RateLimiter) take(key string, limit rateLimit, now time.Time) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastSweep) >= idleBucketSweepInterval {
+		rl.sweepIdle(now)
+	}
+
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(limit.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, int(bucket.tokens), 0
+	}
+
+	if limit.rate <= 0 {
+		return false, 0, time.Minute // No refill configured; ask the client to back off
+	}
+	wait := time.Duration((1 - bucket.tokens) / limit.rate * float64(time.Second))
+	return false, 0, wait
+}
+
+// sweepIdle drops buckets that haven't been used for long enough to have refilled,
+// since a new bucket starts full anyway. Caller must hold rl.mu.
+func (rl *RateLimiter) sweepIdle(now time.Time) {
+	maxIdle := idleBucketSweepInterval
+	limits := append([]rateLimit{rl.defaultLimit}, rl.routeLimits...)
+	for _, limit := range limits {
+		if limit.rate > 0 {
+			if refill := time.Duration(limit.burst / limit.rate * float64(time.Second)); refill > maxIdle {
+				maxIdle = refill
+			}
+		}
+	}
+
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) > maxIdle {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// clientKey identifies the client by authenticated user ID, or by IP address otherwise.
+func clientKey(r *http.Request) string {
+	if claims, ok := r.Context().Value(auth.ContextKeyClaims).(*auth.Claims); ok && claims.UserID != "" {
+		return "user:" + claims.UserID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr // RealIP sets RemoteAddr without a port
+	}
+	return "ip:" + host
+}
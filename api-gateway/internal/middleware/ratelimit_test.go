@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/auth"
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestTakeRefillsBucket(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 60, Burst: 3}, zap.NewNop())
+	limit := rl.defaultLimit
+	now := time.Now()
+
+	// The bucket starts full
+	for i := 2; i >= 0; i-- {
+		allowed, remaining, _ := rl.take("client", limit, now)
+		if !allowed || remaining != i {
+			t.Fatalf("request %d: allowed %v with %d left, want allowed with %d", 3-i, allowed, remaining, i)
+		}
+	}
+	allowed, _, retryAfter := rl.take("client", limit, now)
+	if allowed || retryAfter != time.Second {
+		t.Fatalf("empty bucket: allowed %v, retry after %s; want rejected for 1s", allowed, retryAfter)
+	}
+
+	// 60 a minute refills one token a second
+	if allowed, _, retryAfter := rl.take("client", limit, now.Add(500*time.Millisecond)); allowed || retryAfter != 500*time.Millisecond {
+		t.Errorf("half a token refilled: allowed %v, retry after %s; want rejected for 500ms", allowed, retryAfter)
+	}
+	if allowed, remaining, _ := rl.take("client", limit, now.Add(time.Second)); !allowed || remaining != 0 {
+		t.Errorf("a token refilled: allowed %v with %d left, want allowed with none", allowed, remaining)
+	}
+
+	// Refilling stops at the burst
+	if _, remaining, _ := rl.take("client", limit, now.Add(time.Hour)); remaining != 2 {
+		t.Errorf("%d left after an hour idle, want the burst of 3 less this request", remaining)
+	}
+
+	// Other clients have their own buckets
+	if allowed, _, _ := rl.take("other", limit, now); !allowed {
+		t.Error("another client was rejected")
+	}
+}
+
+func TestTakeWithoutRefill(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 0, Burst: 1}, zap.NewNop())
+	now := time.Now()
+	rl.take("client", rl.defaultLimit, now)
+	if allowed, _, retryAfter := rl.take("client", rl.defaultLimit, now.Add(30*time.Second)); allowed || retryAfter != time.Minute {
+		t.Errorf("allowed %v, retry after %s; want rejected for a minute", allowed, retryAfter)
+	}
+}
+
+func TestSweepIdleDropsRefilledBuckets(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 6, Burst: 30}, zap.NewNop())
+	now := time.Now()
+	rl.take("idle", rl.defaultLimit, now)
+	rl.take("busy", rl.defaultLimit, now.Add(4*time.Minute))
+
+	// 30 tokens at 6 a minute take 5 minutes to refill
+	rl.take("other", rl.defaultLimit, now.Add(5*time.Minute+time.Second))
+	if _, ok := rl.buckets["idle"]; ok {
+		t.Error("bucket idle long enough to refill was kept")
+	}
+	if _, ok := rl.buckets["busy"]; !ok {
+		t.Error("bucket still refilling was dropped")
+	}
+}
+
+// limited sends a request through the middleware, as the user if set and otherwise
+// from the remote address
+func limited(rl *RateLimiter, method, path, userID, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r.RemoteAddr = remoteAddr
+	if userID != "" {
+		r = r.WithContext(context.WithValue(r.Context(), auth.ContextKeyClaims, &auth.Claims{UserID: userID}))
+	}
+	rec := httptest.NewRecorder()
+	rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		RequestsPerMinute: 60,
+		Burst:             2,
+		Routes: []config.RouteRateLimit{
+			{Method: "POST", PathPrefix: "/api/v1/jobs", RequestsPerMinute: 1, Burst: 1},
+		},
+	}, zap.NewNop())
+
+	for i := 0; i < 2; i++ {
+		if rec := limited(rl, "GET", "/api/v1/jobs", "user-1", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := limited(rl, "GET", "/api/v1/jobs", "user-1", "10.0.0.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Limit") != "2" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("rate limit headers %v", rec.Header())
+	}
+
+	// The route limit keeps its own buckets, and is only used for its method
+	if rec := limited(rl, "POST", "/api/v1/jobs", "user-1", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("first submission: status %d, want 200", rec.Code)
+	}
+	rec = limited(rl, "POST", "/api/v1/jobs", "user-1", "10.0.0.1:1234")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("second submission: status %d, Retry-After %q; want 429 for 60s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Users are limited apart from each other and from their IP address
+	if rec := limited(rl, "GET", "/api/v1/jobs", "user-2", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("another user from the same address: status %d, want 200", rec.Code)
+	}
+	if rec := limited(rl, "GET", "/api/v1/jobs", "", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("unauthenticated request: status %d, want 200", rec.Code)
+	}
+	limited(rl, "GET", "/api/v1/jobs", "", "10.0.0.1:5678")
+	if rec := limited(rl, "GET", "/api/v1/jobs", "", "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("third unauthenticated request from the address: status %d, want 429 whatever the port", rec.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package nats_client
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -39,6 +40,23 @@ func Connect(natsAddress string, logger *zap.Logger) (*nats.Conn, error) {
 	return nc, nil
 }
 
+// KeyValue binds to a JetStream key-value bucket, creating it if it doesn't exist yet.
+// Entries expire after ttl; zero keeps them until they are deleted.
+func KeyValue(nc *nats.Conn, bucket string, ttl time.Duration) (nats.KeyValue, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, TTL: ttl})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind key-value bucket %s: %w", bucket, err)
+	}
+	return kv, nil
+}
+
 // // Optional: Function to connect to NATS JetStream for persistent messaging
 // func ConnectJetStream(nc *nats.Conn, logger *zap.Logger) (nats.JetStreamContext, error) {
 // 	logger.Info("Attempting to connect to NATS JetStream")
@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JobWatch is a job whose lifecycle events are delivered to a webhook.
+type JobWatch struct {
+	JobID           string    `json:"job_id"`
+	UserID          string    `json:"user_id"`
+	URL             string    `json:"url"`
+	NotifiedRunning bool      `json:"notified_running"` // The running event was claimed for delivery
+	ExpiresAt       time.Time `json:"expires_at"`       // The job is no longer followed after this
+}
+
+// WatchStore keeps the jobs being watched, shared by every gateway instance so that
+// any of them can deliver a job's events and none is lost to a restart.
+type WatchStore interface {
+	// Add starts watching a job.
+	Add(watch *JobWatch) error
+	// Get returns the job's watch, or nil if the job isn't watched.
+	Get(jobID string) (*JobWatch, error)
+	// ClaimRunning marks the job's running event as delivered. It reports false if the
+	// job isn't watched or the event was already claimed.
+	ClaimRunning(jobID string) (bool, error)
+	// Remove stops watching a job. It reports false if the job wasn't watched, so only
+	// one caller claims the job's final event.
+	Remove(jobID string) (bool, error)
+}
+
+// MemoryWatchStore keeps watches in memory, for a single gateway instance.
+type MemoryWatchStore struct {
+	mu      sync.Mutex
+	watches map[string]JobWatch
+}
+
+// NewMemoryWatchStore creates an empty in-memory watch store.
+func NewMemoryWatchStore() *MemoryWatchStore {
+	return &MemoryWatchStore{watches: make(map[string]JobWatch)}
+}
+
+// Add starts watching a job and drops expired watches.
+func (s *MemoryWatchStore) Add(watch *JobWatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for jobID, w := range s.watches {
+		if now.After(w.ExpiresAt) {
+			delete(s.watches, jobID)
+		}
+	}
+	s.watches[watch.JobID] = *watch
+	return nil
+}
+
+// Get returns a copy of the job's watch.
+func (s *MemoryWatchStore) Get(jobID string) (*JobWatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watch, ok := s.watches[jobID]
+	if !ok {
+		return nil, nil
+	}
+	return &watch, nil
+}
+
+// ClaimRunning marks the job's running event as delivered.
+func (s *MemoryWatchStore) ClaimRunning(jobID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watch, ok := s.watches[jobID]
+	if !ok || watch.NotifiedRunning {
+		return false, nil
+	}
+	watch.NotifiedRunning = true
+	s.watches[jobID] = watch
+	return true, nil
+}
+
+// Remove stops watching a job.
+func (s *MemoryWatchStore) Remove(jobID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.watches[jobID]
+	delete(s.watches, jobID)
+	return ok, nil
+}
+
+// KVWatchStore keeps watches in a NATS key-value bucket. Claims are made with
+// revision checks, so concurrent gateway instances never both deliver an event. The
+// bucket's TTL should be at least the watch duration.
+type KVWatchStore struct {
+	kv nats.KeyValue
+}
+
+// NewKVWatchStore creates a watch store backed by kv.
+func NewKVWatchStore(kv nats.KeyValue) *KVWatchStore {
+	return &KVWatchStore{kv: kv}
+}
+
+// Add starts watching a job.
+func (s *KVWatchStore) Add(watch *JobWatch) error {
+	data, err := json.Marshal(watch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job watch: %w", err)
+	}
+	if _, err := s.kv.Put(watch.JobID, data); err != nil {
+		return fmt.Errorf("failed to store job watch: %w", err)
+	}
+	return nil
+}
+
+// Get returns the job's watch.
+func (s *KVWatchStore) Get(jobID string) (*JobWatch, error) {
+	watch, _, err := s.get(jobID)
+	return watch, err
+}
+
+// get returns the job's watch and its revision.
+func (s *KVWatchStore) get(jobID string) (*JobWatch, uint64, error) {
+	entry, err := s.kv.Get(jobID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get job watch: %w", err)
+	}
+	var watch JobWatch
+	if err := json.Unmarshal(entry.Value(), &watch); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal job watch: %w", err)
+	}
+	return &watch, entry.Revision(), nil
+}
+
+// ClaimRunning marks the job's running event as delivered, unless another instance
+// got there first.
+func (s *KVWatchStore) ClaimRunning(jobID string) (bool, error) {
+	watch, revision, err := s.get(jobID)
+	if err != nil || watch == nil || watch.NotifiedRunning {
+		return false, err
+	}
+	watch.NotifiedRunning = true
+	data, err := json.Marshal(watch)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal job watch: %w", err)
+	}
+	if _, err := s.kv.Update(jobID, data, revision); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update job watch: %w", err)
+	}
+	return true, nil
+}
+
+// Remove stops watching a job, unless another instance already did.
+func (s *KVWatchStore) Remove(jobID string) (bool, error) {
+	watch, revision, err := s.get(jobID)
+	if err != nil || watch == nil {
+		return false, err
+	}
+	if err := s.kv.Delete(jobID, nats.LastRevision(revision)); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete job watch: %w", err)
+	}
+	return true, nil
+}
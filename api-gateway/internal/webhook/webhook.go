@@ -0,0 +1,439 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex>", the HMAC-SHA256 of "<timestamp>.<body>"
+	// keyed with the user's webhook secret.
+	SignatureHeader = "X-Dante-Signature"
+	// TimestampHeader carries the Unix time the delivery was signed at, so receivers can reject replays.
+	TimestampHeader = "X-Dante-Timestamp"
+	// EventIDHeader lets receivers de-duplicate retried deliveries.
+	EventIDHeader = "X-Dante-Event-ID"
+)
+
+// Job lifecycle event types.
+const (
+	EventJobRunning   = "job.running"
+	EventJobCompleted = "job.completed"
+	EventJobFailed    = "job.failed"
+	EventJobCanceled  = "job.canceled"
+)
+
+// eventTypes maps the task statuses published by providers to the events I notify about.
+var eventTypes = map[string]string{
+	"running":   EventJobRunning,
+	"completed": EventJobCompleted,
+	"failed":    EventJobFailed,
+	"timeout":   EventJobFailed,
+	"canceled":  EventJobCanceled,
+	"cancelled": EventJobCanceled,
+}
+
+// Event is the JSON payload POSTed to a job's notification webhook.
+type Event struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	JobID           string    `json:"job_id"`
+	Status          string    `json:"status"`
+	ProviderID      string    `json:"provider_id,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	ExitCode        *int      `json:"exit_code,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// taskStatusUpdate holds the fields of a task.status.<job_id> update that I pass on.
+type taskStatusUpdate struct {
+	JobID           string  `json:"job_id"`
+	ProviderID      string  `json:"provider_id"`
+	Status          string  `json:"status"`
+	Message         string  `json:"message"`
+	Error           string  `json:"error"`
+	ExitCode        *int    `json:"exit_code"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// deadLetter is published when a notification couldn't be delivered after every attempt.
+type deadLetter struct {
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Event     Event     `json:"event"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// errPrivateTarget is returned for webhook URLs, or the addresses their hosts resolve
+// to, that point into a private network.
+var errPrivateTarget = errors.New("webhook URL must not point at a loopback, private or link-local address")
+
+// blockedPrefixes are the non-public ranges the net.IP predicates don't cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT, also used for some cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// isPublicIP reports whether ip is an address webhooks may be delivered to.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// refusePrivateDial is a net.Dialer Control function that refuses connections to
+// non-public addresses. It runs after the host is resolved, for every connection
+// including redirects, so a hostname can't be pointed at an internal address after it
+// was validated.
+func refusePrivateDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errPrivateTarget, address)
+	}
+	return nil
+}
+
+// Dispatcher delivers signed lifecycle events of jobs submitted with a notification
+// webhook. The watched jobs are kept in a WatchStore shared by every gateway instance.
+type Dispatcher struct {
+	cfg        config.WebhookConfig
+	nc         *nats.Conn
+	watches    WatchStore
+	httpClient *http.Client
+	logger     *zap.Logger
+
+	// Events waiting for delivery, per job. A job is in the map while its events are
+	// being delivered.
+	mu      sync.Mutex
+	pending map[string][]pendingEvent
+}
+
+// pendingEvent is an event waiting to be delivered to its job's webhook.
+type pendingEvent struct {
+	watch JobWatch
+	event Event
+}
+
+// NewDispatcher creates a webhook dispatcher. Deliveries to addresses that aren't
+// public are refused unless cfg.AllowPrivateTargets is set.
+func NewDispatcher(cfg config.WebhookConfig, nc *nats.Conn, watches WatchStore, logger *zap.Logger) *Dispatcher {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = refusePrivateDial
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection on my behalf, out of reach of the dial check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		cfg:        cfg,
+		nc:         nc,
+		watches:    watches,
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		logger:     logger.Named("webhooks"),
+		pending:    make(map[string][]pendingEvent),
+	}
+}
+
+// ValidateURL checks that a webhook URL is an absolute http(s) URL whose host isn't a
+// loopback, private or link-local address. Hostnames are checked again when they are
+// resolved for delivery.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL must be an absolute http or https URL")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return errPrivateTarget
+	}
+	return nil
+}
+
+// UserSecret returns the user's webhook signing secret. It is derived from the
+// configured signing secret, so nothing has to be stored per user.
+func (d *Dispatcher) UserSecret(userID string) string {
+	mac := hmac.New(sha256.New, []byte(d.cfg.SigningSecret))
+	mac.Write([]byte("webhook:" + userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the SignatureHeader value for body signed at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start subscribes to the status updates of every job. The subscription is shared by
+// the gateway instances, so each update is handled once.
+func (d *Dispatcher) Start() error {
+	if _, err := d.nc.QueueSubscribe("task.status.*", "api-gateway-webhooks", d.handleStatus); err != nil {
+		return fmt.Errorf("failed to subscribe to job status: %w", err)
+	}
+	return nil
+}
+
+// Watch notifies webhookURL when the job starts running and when it finishes. It must
+// be called before the job is published so that no update is missed. The returned
+// function stops watching, for when the submission fails.
+func (d *Dispatcher) Watch(jobID, userID, webhookURL string) (func(), error) {
+	watch := &JobWatch{
+		JobID:     jobID,
+		UserID:    userID,
+		URL:       webhookURL,
+		ExpiresAt: time.Now().Add(d.cfg.MaxWatch),
+	}
+	if err := d.watches.Add(watch); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := d.watches.Remove(jobID); err != nil {
+			d.logger.Error("Failed to stop watching job", zap.String("job_id", jobID), zap.Error(err))
+		}
+	}, nil
+}
+
+// handleStatus turns a job's status update into an event for its webhook, if the job
+// is watched. The running event is sent once; a final event ends the watch.
+func (d *Dispatcher) handleStatus(msg *nats.Msg) {
+	var update taskStatusUpdate
+	if err := json.Unmarshal(msg.Data, &update); err != nil {
+		return
+	}
+	jobID := update.JobID
+	if jobID == "" {
+		jobID = strings.TrimPrefix(msg.Subject, "task.status.")
+	}
+	eventType, ok := eventTypes[update.Status]
+	if !ok {
+		return
+	}
+
+	watch, err := d.watches.Get(jobID)
+	if err != nil {
+		d.logger.Error("Failed to look up job watch", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+	if watch == nil {
+		return
+	}
+	if time.Now().After(watch.ExpiresAt) {
+		d.logger.Warn("Stopped watching job for webhook events", zap.String("job_id", jobID), zap.Duration("max_watch", d.cfg.MaxWatch))
+		d.watches.Remove(jobID)
+		return
+	}
+
+	// Claiming the event in the store makes sure only one instance delivers it
+	var claimed bool
+	if eventType == EventJobRunning {
+		claimed, err = d.watches.ClaimRunning(jobID)
+	} else {
+		claimed, err = d.watches.Remove(jobID)
+	}
+	if err != nil {
+		d.logger.Error("Failed to claim webhook event", zap.String("job_id", jobID), zap.String("type", eventType), zap.Error(err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	d.enqueue(*watch, Event{
+		ID:              uuid.New().String(),
+		Type:            eventType,
+		JobID:           jobID,
+		Status:          update.Status,
+		ProviderID:      update.ProviderID,
+		Message:         update.Message,
+		Error:           update.Error,
+		ExitCode:        update.ExitCode,
+		DurationSeconds: update.DurationSeconds,
+		Timestamp:       time.Now().UTC(),
+	})
+}
+
+// enqueue queues an event for delivery. I deliver a job's events from a single
+// goroutine so the receiver sees them in order.
+func (d *Dispatcher) enqueue(watch JobWatch, event Event) {
+	d.mu.Lock()
+	queued, delivering := d.pending[watch.JobID]
+	d.pending[watch.JobID] = append(queued, pendingEvent{watch: watch, event: event})
+	d.mu.Unlock()
+
+	if !delivering {
+		go d.deliverPending(watch.JobID)
+	}
+}
+
+// deliverPending delivers the job's queued events until none are left.
+func (d *Dispatcher) deliverPending(jobID string) {
+	for {
+		d.mu.Lock()
+		queued := d.pending[jobID]
+		if len(queued) == 0 {
+			delete(d.pending, jobID)
+			d.mu.Unlock()
+			return
+		}
+		next := queued[0]
+		d.pending[jobID] = queued[1:]
+		d.mu.Unlock()
+
+		d.Deliver(context.Background(), next.watch.URL, next.watch.UserID, next.event)
+	}
+}
+
+// Deliver POSTs the signed event to webhookURL, retrying with exponential backoff on
+// network errors and non-2xx responses. Events that still can't be delivered after
+// MaxAttempts are published to the dead-letter subject.
+func (d *Dispatcher) Deliver(ctx context.Context, webhookURL, userID string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+	secret := d.UserSecret(userID)
+
+	backoff := d.cfg.InitialBackoff
+	var lastErr error
+attempts:
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		if lastErr = d.post(ctx, webhookURL, secret, event.ID, body); lastErr == nil {
+			d.logger.Info("Webhook delivered",
+				zap.String("job_id", event.JobID),
+				zap.String("type", event.Type),
+				zap.Int("attempt", attempt))
+			return nil
+		}
+
+		d.logger.Warn("Webhook delivery failed",
+			zap.String("job_id", event.JobID),
+			zap.String("type", event.Type),
+			zap.Int("attempt", attempt),
+			zap.Error(lastErr))
+
+		if attempt == d.cfg.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			break attempts
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > d.cfg.MaxBackoff {
+			backoff = d.cfg.MaxBackoff
+		}
+	}
+
+	d.deadLetter(webhookURL, userID, event, lastErr)
+	return fmt.Errorf("webhook delivery failed: %w", lastErr)
+}
+
+// post makes a single delivery attempt.
+func (d *Dispatcher) post(ctx context.Context, webhookURL, secret, eventID string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dante-webhooks/1.0")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	req.Header.Set(EventIDHeader, eventID)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// deadLetter records an undeliverable event on the dead-letter subject.
+func (d *Dispatcher) deadLetter(webhookURL, userID string, event Event, lastErr error) {
+	d.logger.Error("Webhook dead-lettered",
+		zap.String("job_id", event.JobID),
+		zap.String("type", event.Type),
+		zap.String("user_id", userID),
+		zap.Error(lastErr))
+
+	letter := deadLetter{
+		UserID:   userID,
+		URL:      webhookURL,
+		Event:    event,
+		Attempts: d.cfg.MaxAttempts,
+		FailedAt: time.Now().UTC(),
+	}
+	if lastErr != nil {
+		letter.LastError = lastErr.Error()
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return
+	}
+	if err := d.nc.Publish(d.cfg.DeadLetterSubject, data); err != nil {
+		d.logger.Error("Failed to publish dead-lettered webhook", zap.Error(err))
+	}
+}
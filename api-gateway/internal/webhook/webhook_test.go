@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/api-gateway/internal/config"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+func testConfig() config.WebhookConfig {
+	return config.WebhookConfig{
+		SigningSecret:  "secret",
+		Timeout:        5 * time.Second,
+		MaxAttempts:    1,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxWatch:       time.Hour,
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://hooks.example.com/dante", false},
+		{"http://203.0.113.10:8080/hook", false},
+		{"ftp://hooks.example.com", true},
+		{"/relative", true},
+		{"http://localhost:8080/hook", true},
+		{"http://api.localhost/hook", true},
+		{"http://127.0.0.1/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://10.0.0.5/hook", true},
+		{"http://172.16.3.4/hook", true},
+		{"http://192.168.1.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://100.100.100.200/hook", true},
+		{"http://0.0.0.0/hook", true},
+		{"http://[fe80::1]/hook", true},
+		{"http://[::ffff:127.0.0.1]/hook", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateURL(%s) = %v, want error: %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDeliveryRefusesPrivateAddresses(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+	d := NewDispatcher(testConfig(), nil, NewMemoryWatchStore(), zap.NewNop())
+
+	// The listener is on loopback, whether it's dialed by IP or by a name that
+	// resolves to it
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		err := d.post(context.Background(), url, "secret", "event", []byte(`{}`))
+		if !errors.Is(err, errPrivateTarget) {
+			t.Errorf("delivery to %s: error %v, want the private target refused", url, err)
+		}
+	}
+	if hits != 0 {
+		t.Errorf("receiver got %d requests, want none", hits)
+	}
+}
+
+// receiver records the events delivered to it
+type receiver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event Event
+	json.NewDecoder(r.Body).Decode(&event)
+	rc.mu.Lock()
+	rc.events = append(rc.events, event)
+	rc.mu.Unlock()
+}
+
+func (rc *receiver) types() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var types []string
+	for _, event := range rc.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func status(jobID, status string) *nats.Msg {
+	data, _ := json.Marshal(taskStatusUpdate{JobID: jobID, Status: status})
+	return &nats.Msg{Subject: "task.status." + jobID, Data: data}
+}
+
+func TestWatchIsSharedBetweenDispatchers(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.AllowPrivateTargets = true
+	watches := NewMemoryWatchStore()
+	// The job is watched by one gateway instance, and its updates reach others, e.g.
+	// after the first one restarted
+	submitted := NewDispatcher(cfg, nil, watches, zap.NewNop())
+	if _, err := submitted.Watch("job-1", "user-1", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	first := NewDispatcher(cfg, nil, watches, zap.NewNop())
+	second := NewDispatcher(cfg, nil, watches, zap.NewNop())
+
+	first.handleStatus(status("job-1", "running"))
+	second.handleStatus(status("job-1", "running"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rc.types()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	second.handleStatus(status("job-1", "completed"))
+	first.handleStatus(status("job-1", "completed"))
+	first.handleStatus(status("other-job", "completed"))
+
+	for len(rc.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := rc.types(); len(got) != 2 || got[0] != EventJobRunning || got[1] != EventJobCompleted {
+		t.Errorf("delivered %v, want running then completed, once each", got)
+	}
+	if watch, _ := watches.Get("job-1"); watch != nil {
+		t.Errorf("job still watched after it finished: %+v", watch)
+	}
+}
+
+func TestExpiredWatchIsDropped(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.AllowPrivateTargets = true
+	cfg.MaxWatch = -time.Second
+	d := NewDispatcher(cfg, nil, NewMemoryWatchStore(), zap.NewNop())
+	if _, err := d.Watch("job-1", "user-1", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	d.handleStatus(status("job-1", "completed"))
+
+	time.Sleep(20 * time.Millisecond)
+	if got := rc.types(); len(got) != 0 {
+		t.Errorf("delivered %v after the watch expired", got)
+	}
+	if watch, _ := d.watches.Get("job-1"); watch != nil {
+		t.Errorf("expired watch kept: %+v", watch)
+	}
+}
@@ -13,12 +13,14 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
 
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/config"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/handlers"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/metrics"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/service"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana"
@@ -62,28 +64,61 @@ func main() {
 	defer solanaClient.Close()
 
 	// Setup pricing engine
-	pricingEngine := pricing.NewEngine(&cfg.Pricing, logger)
+	pricingEngine := pricing.NewEngine(&cfg.Pricing, store, logger)
+
+	// Setup NATS for billing events and job cancellation
+	var events service.EventPublisher
+	natsConn, err := setupNATS(&cfg.NATS, logger)
+	if err != nil {
+		logger.Warn("Failed to connect to NATS, continuing without billing events", zap.Error(err))
+	} else {
+		defer natsConn.Close()
+		events = natsConn
+	}
+
+	// Payout rules live in their own config section
+	cfg.Billing.MinimumPayoutAmount = cfg.Payouts.MinimumPayoutAmount
+	cfg.Billing.PayoutFeePercent = cfg.Payouts.PayoutFeePercent
 
 	// Setup billing service
 	billingService := service.NewBillingService(
 		store,
 		solanaClient,
 		pricingEngine,
+		events,
 		&cfg.Billing,
 		logger,
 	)
+	billingService.StartUsageFlusher()
+	billingService.StartTransferReconciler()
+	billingService.StartGraceSweeper()
+
+	// Providers can stream usage updates over NATS instead of POSTing each one
+	var usageSub *nats.Subscription
+	if natsConn != nil {
+		usageSub, err = handlers.SubscribeUsageUpdates(natsConn, &cfg.NATS, billingService, logger)
+		if err != nil {
+			logger.Warn("Failed to subscribe to usage updates, accepting them over HTTP only", zap.Error(err))
+			usageSub = nil
+		} else {
+			logger.Info("Consuming usage updates", zap.String("subject", usageSub.Subject))
+		}
+	}
 
 	// Setup HTTP server
 	server := setupHTTPServer(cfg, billingService, logger)
 
 	// Setup graceful shutdown
-	setupGracefulShutdown(server, logger)
+	shutdownDone := setupGracefulShutdown(server, usageSub, billingService, logger)
 
 	// Start server
 	logger.Info("Starting HTTP server", zap.String("address", fmt.Sprintf(":%d", cfg.Server.Port)))
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Fatal("Failed to start HTTP server", zap.Error(err))
 	}
+
+	// Wait for buffered usage to be written before the database pool is closed
+	<-shutdownDone
 }
 
 // loadConfig loads configuration from file
@@ -166,6 +201,25 @@ func setupSolanaClient(cfg *solana.Config, logger *zap.Logger) (*solana.Client,
 	return client, nil
 }
 
+// setupNATS connects to NATS, reconnecting in the background if the connection drops
+func setupNATS(cfg *config.NATSConfig, logger *zap.Logger) (*nats.Conn, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("NATS address not configured")
+	}
+
+	nc, err := nats.Connect(cfg.Address,
+		nats.Name(cfg.ClientID),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS at %s: %w", cfg.Address, err)
+	}
+
+	logger.Info("Connected to NATS", zap.String("address", cfg.Address))
+	return nc, nil
+}
+
 // setupHTTPServer configures and returns the HTTP server
 func setupHTTPServer(cfg *config.Config, billingService *service.BillingService, logger *zap.Logger) *http.Server {
 	r := chi.NewRouter()
@@ -173,6 +227,9 @@ func setupHTTPServer(cfg *config.Config, billingService *service.BillingService,
 	// Middleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	if cfg.Monitoring.MetricsEnabled {
+		r.Use(metrics.Middleware)
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(cfg.Server.ReadTimeout))
@@ -200,12 +257,19 @@ func setupHTTPServer(cfg *config.Config, billingService *service.BillingService,
 		w.Write([]byte(`{"status":"healthy","service":"billing-payment-service"}`))
 	})
 
+	// Prometheus scrape endpoint
+	if cfg.Monitoring.MetricsEnabled {
+		metrics.Register(cfg.Monitoring.Prometheus.Namespace, cfg.Monitoring.Prometheus.Subsystem, billingService, logger)
+		r.Handle("/metrics", metrics.Handler())
+	}
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Wallet management
 		r.Route("/wallet", func(r chi.Router) {
 			r.Post("/", handlers.CreateWallet(billingService, logger))
 			r.Get("/{walletID}/balance", handlers.GetWalletBalance(billingService, logger))
+			r.Put("/{walletID}/limits", handlers.UpdateSpendLimits(billingService, logger))
 			r.Post("/{walletID}/deposit", handlers.DepositTokens(billingService, logger))
 			r.Post("/{walletID}/withdraw", handlers.WithdrawTokens(billingService, logger))
 			r.Get("/{walletID}/transactions", handlers.GetTransactionHistory(billingService, logger))
@@ -215,17 +279,27 @@ func setupHTTPServer(cfg *config.Config, billingService *service.BillingService,
 		r.Route("/billing", func(r chi.Router) {
 			r.Post("/start-session", handlers.StartRentalSession(billingService, logger))
 			r.Post("/end-session", handlers.EndRentalSession(billingService, logger))
+			r.Post("/pause-session", handlers.PauseRentalSession(billingService, logger))
+			r.Post("/resume-session", handlers.ResumeRentalSession(billingService, logger))
+			r.Post("/refund-session", handlers.RefundRentalSession(billingService, logger))
+			r.Post("/reserve-funds", handlers.ReserveFunds(billingService, logger))
+			r.Post("/release-funds", handlers.ReleaseFunds(billingService, logger))
 			r.Post("/usage-update", handlers.ProcessUsageUpdate(billingService, logger))
 			r.Get("/current-usage/{sessionID}", handlers.GetCurrentUsage(billingService, logger))
 			r.Get("/history", handlers.GetBillingHistory(billingService, logger))
+			r.Get("/platform-fees", handlers.GetPlatformFees(billingService, logger))
 		})
 
 		// Pricing
 		r.Route("/pricing", func(r chi.Router) {
 			r.Post("/calculate", handlers.CalculatePricing(billingService, logger))
+			r.Post("/estimate", handlers.CalculatePricing(billingService, logger))
 			r.Get("/rates", handlers.GetPricingRates(billingService, logger))
 		})
 
+		// Marketplace
+		r.Get("/marketplace", handlers.SearchMarketplace(billingService, logger))
+
 		// Provider operations
 		r.Route("/provider", func(r chi.Router) {
 			r.Get("/{providerID}/earnings", handlers.GetProviderEarnings(billingService, logger))
@@ -244,12 +318,16 @@ func setupHTTPServer(cfg *config.Config, billingService *service.BillingService,
 	}
 }
 
-// setupGracefulShutdown configures graceful shutdown handling
-func setupGracefulShutdown(server *http.Server, logger *zap.Logger) {
+// setupGracefulShutdown configures graceful shutdown handling. The returned channel is
+// closed once the server and the usage update subscription, if any, have stopped and
+// the billing service has written its buffered usage.
+func setupGracefulShutdown(server *http.Server, usageSub *nats.Subscription, billingService *service.BillingService, logger *zap.Logger) <-chan struct{} {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		<-c
 		logger.Info("Received shutdown signal, shutting down gracefully...")
 
@@ -261,5 +339,39 @@ func setupGracefulShutdown(server *http.Server, logger *zap.Logger) {
 		} else {
 			logger.Info("Server shutdown completed")
 		}
+
+		// Updates already delivered are processed before the buffer is written; the
+		// rest stay in the stream for the next instance
+		if usageSub != nil {
+			if err := drainSubscription(ctx, usageSub); err != nil {
+				logger.Error("Failed to stop consuming usage updates", zap.Error(err))
+			}
+		}
+
+		// Usage reported by requests that have just completed is still buffered
+		if err := billingService.Stop(ctx); err != nil {
+			logger.Error("Failed to write buffered usage on shutdown", zap.Error(err))
+		} else {
+			logger.Info("Buffered usage written")
+		}
 	}()
+	return done
+}
+
+// drainSubscription stops a subscription, waiting until the messages it has already
+// received have been handled.
+func drainSubscription(ctx context.Context, sub *nats.Subscription) error {
+	if err := sub.Drain(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for sub.IsValid() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
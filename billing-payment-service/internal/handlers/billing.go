@@ -4,16 +4,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/service"
 )
 
+// IdempotencyKeyHeader is the request header clients use to make session starts safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 // StartRentalSession handles rental session start requests
 func StartRentalSession(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +27,8 @@ func StartRentalSession(billingService *service.BillingService, logger *zap.Logg
 			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
 			return
 		}
+		// Retries carrying the same key get the original session instead of a new one
+		req.IdempotencyKey = r.Header.Get(IdempotencyKeyHeader)
 
 		session, err := billingService.StartRentalSession(r.Context(), &req)
 		if err != nil {
@@ -76,6 +82,147 @@ func EndRentalSession(billingService *service.BillingService, logger *zap.Logger
 	}
 }
 
+// RefundRentalSession handles requests to refund a session whose job failed during setup
+func RefundRentalSession(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.SessionRefundRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode session refund request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		session, err := billingService.RefundSession(r.Context(), req.SessionID, req.Reason)
+		if err != nil {
+			logger.Error("Failed to refund rental session", zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to refund rental session", err)
+			}
+			return
+		}
+
+		logger.Info("Rental session refunded successfully",
+			zap.String("session_id", req.SessionID.String()),
+			zap.String("reason", req.Reason),
+		)
+
+		writeJSONResponse(w, http.StatusOK, session)
+	}
+}
+
+// ReserveFunds handles requests to reserve funds for submitted jobs
+func ReserveFunds(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.FundsReservationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode funds reservation request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		reservation, err := billingService.ReserveFunds(r.Context(), &req)
+		if err != nil {
+			logger.Error("Failed to reserve funds", zap.String("user_id", req.UserID), zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to reserve funds", err)
+			}
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, reservation)
+	}
+}
+
+// ReleaseFunds handles requests to release funds reserved for jobs that won't run
+func ReleaseFunds(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.FundsReleaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode funds release request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		released, err := billingService.ReleaseFunds(r.Context(), &req)
+		if err != nil {
+			logger.Error("Failed to release funds", zap.String("user_id", req.UserID), zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to release funds", err)
+			}
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, released)
+	}
+}
+
+// PauseRentalSession handles requests to pause billing for a rental session
+func PauseRentalSession(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.SessionPauseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode session pause request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		session, err := billingService.PauseRentalSession(r.Context(), &req)
+		if err != nil {
+			logger.Error("Failed to pause rental session", zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to pause rental session", err)
+			}
+			return
+		}
+
+		logger.Info("Rental session paused successfully",
+			zap.String("session_id", req.SessionID.String()),
+			zap.String("reason", req.Reason),
+			zap.String("accrued_cost", session.CurrentCost.String()),
+		)
+
+		writeJSONResponse(w, http.StatusOK, session)
+	}
+}
+
+// ResumeRentalSession handles requests to resume a paused rental session
+func ResumeRentalSession(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.SessionResumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode session resume request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		session, err := billingService.ResumeRentalSession(r.Context(), &req)
+		if err != nil {
+			logger.Error("Failed to resume rental session", zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to resume rental session", err)
+			}
+			return
+		}
+
+		logger.Info("Rental session resumed successfully",
+			zap.String("session_id", req.SessionID.String()),
+			zap.String("estimated_hourly_cost", session.EstimatedHourlyCost.String()),
+		)
+
+		writeJSONResponse(w, http.StatusOK, session)
+	}
+}
+
 // ProcessUsageUpdate handles real-time usage updates from provider daemons
 func ProcessUsageUpdate(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -183,15 +330,7 @@ func GetBillingHistory(billingService *service.BillingService, logger *zap.Logge
 // CalculatePricing handles pricing calculation requests
 func CalculatePricing(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			GPUModel        string          `json:"gpu_model"`
-			RequestedVRAM   uint64          `json:"requested_vram_mb"`
-			TotalVRAM       uint64          `json:"total_vram_mb"`
-			EstimatedPowerW uint32          `json:"estimated_power_w"`
-			DurationHours   decimal.Decimal `json:"duration_hours"`
-			ProviderID      *uuid.UUID      `json:"provider_id,omitempty"`
-			UserID          *string         `json:"user_id,omitempty"`
-		}
+		var req pricing.PricingRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			logger.Error("Failed to decode pricing calculation request", zap.Error(err))
@@ -200,14 +339,14 @@ func CalculatePricing(billingService *service.BillingService, logger *zap.Logger
 		}
 
 		// Use the pricing engine to calculate costs
-		pricing, err := billingService.CalculatePricing(r.Context(), &req)
+		estimate, err := billingService.CalculatePricing(r.Context(), &req)
 		if err != nil {
 			logger.Error("Failed to calculate pricing", zap.Error(err))
 			writeErrorResponse(w, http.StatusInternalServerError, "Failed to calculate pricing", err)
 			return
 		}
 
-		writeJSONResponse(w, http.StatusOK, pricing)
+		writeJSONResponse(w, http.StatusOK, estimate)
 	}
 }
 
@@ -225,6 +364,31 @@ func GetPricingRates(billingService *service.BillingService, logger *zap.Logger)
 	}
 }
 
+// GetPlatformFees handles requests for the platform fees collected, optionally since
+// the RFC 3339 time in the since query parameter
+func GetPlatformFees(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since *time.Time
+		if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+			parsed, err := time.Parse(time.RFC3339, sinceStr)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "Invalid since, expected RFC 3339", err)
+				return
+			}
+			since = &parsed
+		}
+
+		fees, err := billingService.GetPlatformFees(r.Context(), since)
+		if err != nil {
+			logger.Error("Failed to get platform fees", zap.Error(err))
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to get platform fees", err)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, fees)
+	}
+}
+
 // GetProviderEarnings handles provider earnings requests
 func GetProviderEarnings(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -236,27 +400,21 @@ func GetProviderEarnings(billingService *service.BillingService, logger *zap.Log
 			return
 		}
 
-		// TODO: Implement provider earnings retrieval
-		// earnings, err := billingService.GetProviderEarnings(r.Context(), providerID)
-		// if err != nil {
-		//     logger.Error("Failed to get provider earnings", zap.String("provider_id", providerIDStr), zap.Error(err))
-		//     writeErrorResponse(w, http.StatusInternalServerError, "Failed to get provider earnings", err)
-		//     return
-		// }
+		groupBy := r.URL.Query().Get("group_by")
+		if groupBy != "" && !models.ValidEarningsGroupBy(groupBy) {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid group_by, expected gpu_model, day, week or month",
+				models.NewValidationError("group_by", "unsupported earnings breakdown"))
+			return
+		}
 
-		// Placeholder response
-		response := &models.ProviderEarningsResponse{
-			ProviderID:      providerID,
-			TotalEarnings:   decimal.Zero,
-			PendingEarnings: decimal.Zero,
-			PaidEarnings:    decimal.Zero,
-			TotalSessions:   0,
-			TotalHours:      decimal.Zero,
-			AvgHourlyRate:   decimal.Zero,
-			Period:          "all_time",
+		earnings, err := billingService.GetProviderEarnings(r.Context(), &models.ProviderEarningsRequest{ProviderID: providerID, GroupBy: groupBy})
+		if err != nil {
+			logger.Error("Failed to get provider earnings", zap.String("provider_id", providerIDStr), zap.Error(err))
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to get provider earnings", err)
+			return
 		}
 
-		writeJSONResponse(w, http.StatusOK, response)
+		writeJSONResponse(w, http.StatusOK, earnings)
 	}
 }
 
@@ -278,35 +436,27 @@ func RequestPayout(billingService *service.BillingService, logger *zap.Logger) h
 			return
 		}
 
-		req.ProviderWalletID = providerID // This should be the wallet ID, not provider ID
-
-		// TODO: Implement payout processing
-		// payout, err := billingService.ProcessPayout(r.Context(), &req)
-		// if err != nil {
-		//     logger.Error("Failed to process payout", zap.Error(err))
-		//     writeErrorResponse(w, http.StatusInternalServerError, "Failed to process payout", err)
-		//     return
-		// }
-
-		response := map[string]interface{}{
-			"message":     "Payout request received",
-			"provider_id": providerID,
-			"amount":      req.Amount,
-			"to_address":  req.ToAddress,
-			"status":      "pending",
+		payout, err := billingService.RequestPayout(r.Context(), providerID, &req)
+		if err != nil {
+			logger.Error("Failed to process payout", zap.String("provider_id", providerIDStr), zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to process payout", err)
+			}
+			return
 		}
 
-		logger.Info("Payout requested",
-			zap.String("provider_id", providerIDStr),
-			zap.String("amount", req.Amount.String()),
-			zap.String("to_address", req.ToAddress),
-		)
-
-		writeJSONResponse(w, http.StatusAccepted, response)
+		// A transfer that hasn't confirmed yet is settled in the background
+		status := http.StatusOK
+		if payout.Status == models.TransactionStatusPending {
+			status = http.StatusAccepted
+		}
+		writeJSONResponse(w, status, payout)
 	}
 }
 
-// GetProviderRates handles provider rates requests
+// GetProviderRates handles requests for a provider's rate schedules
 func GetProviderRates(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		providerIDStr := chi.URLParam(r, "providerID")
@@ -317,18 +467,18 @@ func GetProviderRates(billingService *service.BillingService, logger *zap.Logger
 			return
 		}
 
-		// TODO: Implement provider rates retrieval
-		response := map[string]interface{}{
-			"message":     "Provider rates endpoint not yet implemented",
-			"provider_id": providerID,
-			"status":      "coming_soon",
+		rates, err := billingService.GetProviderRates(r.Context(), providerID)
+		if err != nil {
+			logger.Error("Failed to get provider rates", zap.String("provider_id", providerIDStr), zap.Error(err))
+			writeErrorResponse(w, http.StatusInternalServerError, "Failed to get provider rates", err)
+			return
 		}
 
-		writeJSONResponse(w, http.StatusNotImplemented, response)
+		writeJSONResponse(w, http.StatusOK, rates)
 	}
 }
 
-// SetProviderRates handles provider rates update requests
+// SetProviderRates handles requests to set a provider's rate schedule for a GPU model
 func SetProviderRates(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		providerIDStr := chi.URLParam(r, "providerID")
@@ -339,13 +489,25 @@ func SetProviderRates(billingService *service.BillingService, logger *zap.Logger
 			return
 		}
 
-		// TODO: Implement provider rates update
-		response := map[string]interface{}{
-			"message":     "Provider rates update endpoint not yet implemented",
-			"provider_id": providerID,
-			"status":      "coming_soon",
+		var schedule models.ProviderRateSchedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			logger.Error("Failed to decode provider rates request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+		schedule.ProviderID = providerID
+
+		updated, err := billingService.SetProviderRates(r.Context(), &schedule)
+		if err != nil {
+			logger.Error("Failed to set provider rates", zap.String("provider_id", providerIDStr), zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to set provider rates", err)
+			}
+			return
 		}
 
-		writeJSONResponse(w, http.StatusNotImplemented, response)
+		writeJSONResponse(w, http.StatusOK, updated)
 	}
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/service"
+)
+
+// maxMarketplacePageSize caps the number of GPUs returned in a single page
+const maxMarketplacePageSize = 500
+
+// SearchMarketplace handles marketplace search requests
+func SearchMarketplace(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseMarketplaceFilter(r.URL.Query())
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid marketplace filter", err)
+			return
+		}
+
+		results, err := billingService.SearchMarketplace(r.Context(), filter)
+		if err != nil {
+			logger.Error("Failed to search marketplace", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadGateway, "Failed to search marketplace", err)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, results)
+	}
+}
+
+// parseMarketplaceFilter parses and validates marketplace filters from query
+// parameters. The parameter names match the provider registry's listing.
+func parseMarketplaceFilter(params url.Values) (*models.MarketplaceFilter, error) {
+	filter := &models.MarketplaceFilter{
+		Location: params.Get("location"),
+		GPUModel: params.Get("gpu_model"),
+		SortBy:   "price",
+	}
+
+	if v := params.Get("min_vram"); v != "" {
+		vram, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_vram: %s", v)
+		}
+		filter.MinVRAM = vram
+	}
+
+	if v := params.Get("max_price_per_hour"); v != "" {
+		price, err := decimal.NewFromString(v)
+		if err != nil || price.IsNegative() {
+			return nil, fmt.Errorf("invalid max_price_per_hour: %s", v)
+		}
+		filter.MaxPricePerHour = price
+	}
+
+	if v := params.Get("min_rating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 {
+			return nil, fmt.Errorf("invalid min_rating: %s", v)
+		}
+		filter.MinRating = rating
+	}
+
+	for name, dst := range map[string]**bool{"online": &filter.IsOnline, "has_capacity": &filter.HasCapacity} {
+		if v := params.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			*dst = &b
+		}
+	}
+
+	if v := params.Get("sort_by"); v != "" {
+		switch v {
+		case "price", "rating", "capacity", "location":
+			filter.SortBy = v
+		default:
+			return nil, fmt.Errorf("invalid sort_by: %s", v)
+		}
+	}
+
+	switch order := params.Get("sort_order"); order {
+	case "", "asc", "desc":
+		filter.SortOrder = order
+	default:
+		return nil, fmt.Errorf("invalid sort_order: %s", order)
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit > maxMarketplacePageSize {
+			limit = maxMarketplacePageSize
+		}
+		filter.Limit = limit
+	}
+
+	if v := params.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %s", v)
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
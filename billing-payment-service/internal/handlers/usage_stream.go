@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/config"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/service"
+)
+
+const (
+	// usageQueueGroup shares usage updates between billing service instances
+	usageQueueGroup = "billing-usage"
+
+	// usageRetryDelay is how long a usage update that failed for a transient reason,
+	// such as the database being unreachable, waits before it is delivered again
+	usageRetryDelay = 5 * time.Second
+
+	// usageMaxDeliver bounds redeliveries of a usage update that keeps failing
+	usageMaxDeliver = 10
+)
+
+// SubscribeUsageUpdates consumes the usage updates providers publish to
+// <usage_updates>.<session_id> instead of POSTing them to /billing/usage-update. The
+// messages are the same UsageUpdateRequest the HTTP endpoint takes. With JetStream
+// enabled the updates are kept in a stream, so updates published while no billing
+// service is running are processed once one is back; otherwise they are consumed
+// as they arrive.
+func SubscribeUsageUpdates(nc *nats.Conn, cfg *config.NATSConfig, billingService *service.BillingService, logger *zap.Logger) (*nats.Subscription, error) {
+	prefix := cfg.Subjects.UsageUpdates
+	if prefix == "" {
+		return nil, fmt.Errorf("usage updates subject not configured")
+	}
+	subject := prefix + ".*"
+
+	if !cfg.JetStream.Enabled {
+		return nc.QueueSubscribe(subject, usageQueueGroup, func(msg *nats.Msg) {
+			processUsageMessage(msg, billingService, logger)
+		})
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+	if err := ensureUsageStream(js, cfg, subject); err != nil {
+		return nil, err
+	}
+	if err := ensureUsageConsumer(js, cfg, subject); err != nil {
+		return nil, err
+	}
+
+	return js.QueueSubscribe(subject, usageQueueGroup, func(msg *nats.Msg) {
+		if err := processUsageMessage(msg, billingService, logger); err != nil && !isPermanentUsageError(err) {
+			if nakErr := msg.NakWithDelay(usageRetryDelay); nakErr != nil {
+				logger.Error("Failed to NAK usage update", zap.String("subject", msg.Subject), zap.Error(nakErr))
+			}
+			return
+		}
+		if ackErr := msg.Ack(); ackErr != nil {
+			logger.Error("Failed to ACK usage update", zap.String("subject", msg.Subject), zap.Error(ackErr))
+		}
+	}, nats.Bind(cfg.JetStream.StreamName, usageQueueGroup), nats.ManualAck())
+}
+
+// ensureUsageStream creates the stream usage updates are kept in, or adds the usage
+// subject to it if it already exists.
+func ensureUsageStream(js nats.JetStreamContext, cfg *config.NATSConfig, subject string) error {
+	info, err := js.StreamInfo(cfg.JetStream.StreamName)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     cfg.JetStream.StreamName,
+			Subjects: []string{subject},
+			MaxAge:   cfg.JetStream.MaxAge,
+			MaxMsgs:  cfg.JetStream.MaxMsgs,
+			Storage:  nats.FileStorage,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create stream %s: %w", cfg.JetStream.StreamName, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up stream %s: %w", cfg.JetStream.StreamName, err)
+	}
+
+	for _, existing := range info.Config.Subjects {
+		if existing == subject {
+			return nil
+		}
+	}
+	streamCfg := info.Config
+	streamCfg.Subjects = append(streamCfg.Subjects, subject)
+	if _, err := js.UpdateStream(&streamCfg); err != nil {
+		return fmt.Errorf("failed to add %s to stream %s: %w", subject, cfg.JetStream.StreamName, err)
+	}
+	return nil
+}
+
+// ensureUsageConsumer creates the durable consumer the billing service instances share.
+// It is created here rather than by the subscription so that unsubscribing on shutdown
+// leaves it, and its position in the stream, in place.
+func ensureUsageConsumer(js nats.JetStreamContext, cfg *config.NATSConfig, subject string) error {
+	_, err := js.ConsumerInfo(cfg.JetStream.StreamName, usageQueueGroup)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("failed to look up consumer %s: %w", usageQueueGroup, err)
+	}
+
+	_, err = js.AddConsumer(cfg.JetStream.StreamName, &nats.ConsumerConfig{
+		Durable:        usageQueueGroup,
+		DeliverSubject: nats.NewInbox(),
+		DeliverGroup:   usageQueueGroup,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		FilterSubject:  subject,
+		AckPolicy:      nats.AckExplicitPolicy,
+		MaxDeliver:     usageMaxDeliver,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer %s: %w", usageQueueGroup, err)
+	}
+	return nil
+}
+
+// processUsageMessage processes one usage update message. Malformed messages are
+// logged and reported as permanent failures.
+func processUsageMessage(msg *nats.Msg, billingService *service.BillingService, logger *zap.Logger) error {
+	var req models.UsageUpdateRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		logger.Warn("Invalid usage update message", zap.String("subject", msg.Subject), zap.Error(err))
+		return models.NewBillingError(models.ErrCodeValidationFailed, "Invalid usage update", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := billingService.ProcessUsageUpdate(ctx, &req); err != nil {
+		logger.Error("Failed to process usage update message",
+			zap.String("session_id", req.SessionID.String()),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	logger.Debug("Usage update message processed successfully",
+		zap.String("session_id", req.SessionID.String()),
+		zap.Uint8("gpu_utilization", req.GPUUtilization),
+		zap.Uint32("power_draw", req.PowerDraw),
+	)
+	return nil
+}
+
+// isPermanentUsageError reports whether redelivering a usage update that failed with
+// err would fail the same way, e.g. because its session has ended.
+func isPermanentUsageError(err error) bool {
+	var billingErr *models.BillingError
+	return errors.As(err, &billingErr) || errors.Is(err, models.ErrSessionNotFound)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/service"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/store"
+)
+
+// testDatabaseEnv names the PostgreSQL database the handler tests run against; they
+// are skipped when it isn't set. Tests use their own users and sessions, so it can be
+// shared.
+const testDatabaseEnv = "BILLING_TEST_DATABASE_URL"
+
+// newTestBillingService returns a billing service against the test database, with no
+// Solana client
+func newTestBillingService(t *testing.T) (*service.BillingService, *store.PostgresStore) {
+	t.Helper()
+	databaseURL := os.Getenv(testDatabaseEnv)
+	if databaseURL == "" {
+		t.Skipf("%s not set", testDatabaseEnv)
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	logger := zap.NewNop()
+	billingStore := store.NewPostgresStore(db, logger)
+	if err := billingStore.Initialize(ctx); err != nil {
+		t.Fatalf("failed to initialize the test database: %v", err)
+	}
+	engine := pricing.NewEngine(&pricing.Config{}, billingStore, logger)
+	billingService := service.NewBillingService(billingStore, nil, engine, nil, &service.Config{BillingInterval: time.Minute}, logger)
+	t.Cleanup(func() { billingService.Stop(context.Background()) })
+	return billingService, billingStore
+}
+
+// createActiveSession stores an active session for a new user with a funded wallet
+func createActiveSession(t *testing.T, s *store.PostgresStore) *models.RentalSession {
+	t.Helper()
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet, err := s.CreateWallet(ctx, &models.WalletCreateRequest{
+		UserID:        userID,
+		WalletType:    models.WalletTypeUser,
+		SolanaAddress: "11111111111111111111111111111111",
+	})
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	if _, err := s.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+		w.Balance = decimal.NewFromInt(1000)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to fund wallet: %v", err)
+	}
+
+	now := time.Now().UTC()
+	session := &models.RentalSession{
+		ID:              uuid.New(),
+		UserID:          userID,
+		ProviderID:      uuid.New(),
+		Status:          models.SessionStatusActive,
+		GPUModel:        "RTX 4090",
+		AllocatedVRAM:   24576,
+		TotalVRAM:       24576,
+		VRAMPercentage:  decimal.NewFromInt(100),
+		HourlyRate:      decimal.NewFromInt(6),
+		VRAMRate:        decimal.Zero,
+		PowerRate:       decimal.Zero,
+		PlatformFeeRate: decimal.NewFromInt(10),
+		EstimatedPowerW: 450,
+		StartedAt:       now.Add(-time.Hour),
+		LastBilledAt:    now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.CreateRentalSession(ctx, session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	return session
+}
+
+// usageMessage returns a usage update as the provider publishes it
+func usageMessage(t *testing.T, update *models.UsageUpdateRequest) *nats.Msg {
+	t.Helper()
+	data, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nats.Msg{Subject: "billing.usage." + update.SessionID.String(), Data: data}
+}
+
+func TestUsageMessageProducesUsageRecord(t *testing.T) {
+	billingService, billingStore := newTestBillingService(t)
+	ctx := context.Background()
+	session := createActiveSession(t, billingStore)
+
+	msg := usageMessage(t, &models.UsageUpdateRequest{
+		UpdateID:       uuid.New(),
+		SessionID:      session.ID,
+		GPUUtilization: 80,
+		PowerDraw:      300,
+		Temperature:    70,
+		Timestamp:      time.Now().UTC(),
+	})
+	// The ack of the first delivery was lost, so JetStream delivers it again after the
+	// usage was written
+	for i := 0; i < 2; i++ {
+		if err := processUsageMessage(msg, billingService, zap.NewNop()); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+		if err := billingService.FlushUsage(ctx); err != nil {
+			t.Fatalf("FlushUsage: %v", err)
+		}
+	}
+
+	records, err := billingStore.GetUsageRecordsBySession(ctx, session.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d usage records, want 1", len(records))
+	}
+	if records[0].GPUUtilization != 80 || records[0].PowerDraw != 300 {
+		t.Errorf("recorded %d%% at %dW, want 80%% at 300W", records[0].GPUUtilization, records[0].PowerDraw)
+	}
+	stored, err := billingStore.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := decimal.NewFromFloat(0.1); !stored.TotalCost.Equal(want) {
+		t.Errorf("session cost %s, want one minute at 6 an hour, %s", stored.TotalCost, want)
+	}
+}
+
+func TestUsageMessageFailures(t *testing.T) {
+	err := processUsageMessage(&nats.Msg{Subject: "billing.usage.x", Data: []byte("{")}, nil, zap.NewNop())
+	if err == nil || !isPermanentUsageError(err) {
+		t.Errorf("malformed message: %v, want a permanent failure", err)
+	}
+	if isPermanentUsageError(context.DeadlineExceeded) {
+		t.Error("a timeout is permanent, want it redelivered")
+	}
+	if !isPermanentUsageError(models.ErrSessionNotFound) {
+		t.Error("a missing session isn't permanent, want it dropped")
+	}
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -64,6 +66,39 @@ func GetWalletBalance(billingService *service.BillingService, logger *zap.Logger
 	}
 }
 
+// UpdateSpendLimits handles requests to set a wallet's daily and monthly spending limits
+func UpdateSpendLimits(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		walletIDStr := chi.URLParam(r, "walletID")
+		walletID, err := uuid.Parse(walletIDStr)
+		if err != nil {
+			logger.Error("Invalid wallet ID", zap.String("wallet_id", walletIDStr), zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid wallet ID", err)
+			return
+		}
+
+		var req models.SpendLimitsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Error("Failed to decode spend limits request", zap.Error(err))
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+
+		wallet, err := billingService.UpdateSpendLimits(r.Context(), walletID, &req)
+		if err != nil {
+			logger.Error("Failed to update spend limits", zap.String("wallet_id", walletIDStr), zap.Error(err))
+			if billingErr, ok := err.(*models.BillingError); ok {
+				writeErrorResponse(w, getHTTPStatusFromBillingError(billingErr), billingErr.Message, err)
+			} else {
+				writeErrorResponse(w, http.StatusInternalServerError, "Failed to update spend limits", err)
+			}
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, wallet)
+	}
+}
+
 // DepositTokens handles token deposit requests
 func DepositTokens(billingService *service.BillingService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -136,6 +171,17 @@ func WithdrawTokens(billingService *service.BillingService, logger *zap.Logger)
 			return
 		}
 
+		// A transfer that hasn't confirmed yet is settled in the background; the funds
+		// stay reserved until then
+		if transaction.Status == models.TransactionStatusPending {
+			logger.Info("Withdrawal sent, awaiting confirmation",
+				zap.String("wallet_id", walletID.String()),
+				zap.String("transaction_id", transaction.ID.String()),
+			)
+			writeJSONResponse(w, http.StatusAccepted, transaction)
+			return
+		}
+
 		logger.Info("Withdrawal processed successfully",
 			zap.String("wallet_id", walletID.String()),
 			zap.String("amount", req.Amount.String()),
@@ -178,6 +224,35 @@ func GetTransactionHistory(billingService *service.BillingService, logger *zap.L
 			}
 		}
 
+		// Optional filters
+		if typeStr := r.URL.Query().Get("type"); typeStr != "" {
+			txnType := models.TransactionType(typeStr)
+			req.Type = &txnType
+		}
+
+		if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+			status := models.TransactionStatus(statusStr)
+			req.Status = &status
+		}
+
+		if startStr := r.URL.Query().Get("start_date"); startStr != "" {
+			startDate, err := time.Parse(time.RFC3339, startStr)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "Invalid start_date, expected RFC 3339", err)
+				return
+			}
+			req.StartDate = &startDate
+		}
+
+		if endStr := r.URL.Query().Get("end_date"); endStr != "" {
+			endDate, err := time.Parse(time.RFC3339, endStr)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "Invalid end_date, expected RFC 3339", err)
+				return
+			}
+			req.EndDate = &endDate
+		}
+
 		history, err := billingService.GetTransactionHistory(r.Context(), req)
 		if err != nil {
 			logger.Error("Failed to get transaction history", zap.Error(err))
@@ -216,6 +291,14 @@ func writeErrorResponse(w http.ResponseWriter, statusCode int, message string, e
 	if err != nil {
 		errorResponse["details"] = err.Error()
 	}
+	// Structured errors also carry their code and context, for clients to act on
+	var billingErr *models.BillingError
+	if errors.As(err, &billingErr) {
+		errorResponse["code"] = billingErr.Code
+		if len(billingErr.Details) > 0 {
+			errorResponse["context"] = billingErr.Details
+		}
+	}
 
 	if encodeErr := json.NewEncoder(w).Encode(errorResponse); encodeErr != nil {
 		zap.L().Error("Failed to encode error response", zap.Error(encodeErr))
@@ -227,13 +310,14 @@ func getHTTPStatusFromBillingError(err *models.BillingError) int {
 	switch err.Code {
 	case models.ErrCodeWalletNotFound, models.ErrCodeTransactionNotFound, models.ErrCodeSessionNotFound:
 		return http.StatusNotFound
-	case models.ErrCodeWalletExists, models.ErrCodeSessionActive:
+	case models.ErrCodeWalletExists, models.ErrCodeSessionActive, models.ErrCodeSessionNotActive, models.ErrCodeSessionNotPaused,
+		models.ErrCodePayoutInProgress, models.ErrCodeSessionConflict:
 		return http.StatusConflict
-	case models.ErrCodeInsufficientFunds, models.ErrCodeInvalidAmount, models.ErrCodeValidationFailed:
+	case models.ErrCodeInsufficientFunds, models.ErrCodeInvalidAmount, models.ErrCodeValidationFailed, models.ErrCodeMinimumPayout:
 		return http.StatusBadRequest
 	case models.ErrCodeUnauthorized:
 		return http.StatusUnauthorized
-	case models.ErrCodeForbidden:
+	case models.ErrCodeForbidden, models.ErrCodeLimitExceeded:
 		return http.StatusForbidden
 	case models.ErrCodeRateLimited:
 		return http.StatusTooManyRequests
@@ -0,0 +1,156 @@
+// Package metrics holds the billing service's Prometheus collectors and the /metrics handler
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// statsTimeout bounds the database queries behind each scrape
+const statsTimeout = 5 * time.Second
+
+var (
+	// RequestDuration observes request latency by method, route pattern and status code
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// SessionsStarted counts rental sessions started
+	SessionsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sessions_started_total",
+		Help: "Rental sessions started.",
+	})
+
+	// SessionsEnded counts rental sessions closed, by outcome: "completed" or "refunded"
+	SessionsEnded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sessions_ended_total",
+		Help: "Rental sessions ended by outcome.",
+	}, []string{"outcome"})
+
+	// TokensBilled totals the dGPU charged for completed sessions
+	TokensBilled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tokens_billed_total",
+		Help: "dGPU tokens charged for completed rental sessions.",
+	})
+)
+
+// StatsSource reports the platform totals exported on every scrape
+type StatsSource interface {
+	GetStats(ctx context.Context) (*models.BillingStats, error)
+}
+
+var registerOnce sync.Once
+
+// Register adds the billing collectors to the default registry, which already holds the
+// Go runtime and process collectors. Metric names are prefixed with namespace and
+// subsystem. Only the first call registers anything, so tests can call it repeatedly
+// without panicking on duplicate registration.
+func Register(namespace, subsystem string, stats StatsSource, logger *zap.Logger) {
+	registerOnce.Do(func() {
+		registerer := prometheus.WrapRegistererWithPrefix(metricPrefix(namespace, subsystem), prometheus.DefaultRegisterer)
+		registerer.MustRegister(RequestDuration, SessionsStarted, SessionsEnded, TokensBilled, newStatsCollector(stats, logger))
+	})
+}
+
+// metricPrefix joins the namespace and subsystem, e.g. "dante_billing_payment_service_"
+func metricPrefix(namespace, subsystem string) string {
+	var parts []string
+	for _, part := range []string{namespace, subsystem} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"dante", "billing"}
+	}
+	return strings.Join(parts, "_") + "_"
+}
+
+// Handler serves the default registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records RequestDuration for every request. Requests are labeled with the
+// matched chi route pattern rather than the path, so IDs in URLs don't become labels.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+		RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statsCollector exports the database totals, read fresh on every scrape
+type statsCollector struct {
+	source StatsSource
+	logger *zap.Logger
+
+	activeSessions *prometheus.Desc
+	walletBalance  *prometheus.Desc
+	lockedBalance  *prometheus.Desc
+}
+
+func newStatsCollector(source StatsSource, logger *zap.Logger) *statsCollector {
+	return &statsCollector{
+		source: source,
+		logger: logger,
+		activeSessions: prometheus.NewDesc("active_sessions",
+			"Rental sessions currently active.", nil, nil),
+		walletBalance: prometheus.NewDesc("wallet_balance",
+			"Total dGPU balance held in wallets, by wallet type.", []string{"wallet_type"}, nil),
+		lockedBalance: prometheus.NewDesc("wallet_locked_balance",
+			"Total dGPU locked for active sessions, by wallet type.", []string{"wallet_type"}, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeSessions
+	ch <- c.walletBalance
+	ch <- c.lockedBalance
+}
+
+// Collect queries the totals. A failed query leaves them out of the scrape rather than
+// failing it, so the request and session metrics are still reported.
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.source.GetStats(ctx)
+	if err != nil {
+		c.logger.Warn("Failed to collect billing stats for metrics", zap.Error(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.activeSessions, prometheus.GaugeValue, float64(stats.ActiveSessions))
+	for walletType, balance := range stats.WalletBalances {
+		ch <- prometheus.MustNewConstMetric(c.walletBalance, prometheus.GaugeValue, balance.InexactFloat64(), string(walletType))
+	}
+	for walletType, locked := range stats.LockedBalances {
+		ch <- prometheus.MustNewConstMetric(c.lockedBalance, prometheus.GaugeValue, locked.InexactFloat64(), string(walletType))
+	}
+}
@@ -12,6 +12,7 @@ type SessionStatus string
 
 const (
 	SessionStatusActive     SessionStatus = "active"
+	SessionStatusPaused     SessionStatus = "paused"
 	SessionStatusCompleted  SessionStatus = "completed"
 	SessionStatusCancelled  SessionStatus = "cancelled"
 	SessionStatusSuspended  SessionStatus = "suspended"
@@ -25,6 +26,7 @@ type RentalSession struct {
 	ProviderID        uuid.UUID       `json:"provider_id" db:"provider_id"`
 	JobID             *string         `json:"job_id,omitempty" db:"job_id"`
 	Status            SessionStatus   `json:"status" db:"status"`
+	IdempotencyKey    *string         `json:"idempotency_key,omitempty" db:"idempotency_key"` // Client key that started the session
 	
 	// GPU allocation details
 	GPUModel          string          `json:"gpu_model" db:"gpu_model"`
@@ -46,11 +48,15 @@ type RentalSession struct {
 	StartedAt         time.Time       `json:"started_at" db:"started_at"`
 	EndedAt           *time.Time      `json:"ended_at,omitempty" db:"ended_at"`
 	LastBilledAt      time.Time       `json:"last_billed_at" db:"last_billed_at"`
+	PausedAt          *time.Time      `json:"paused_at,omitempty" db:"paused_at"`  // Set while the session is paused
+	PausedSeconds     int64           `json:"paused_seconds" db:"paused_seconds"` // Total length of completed pauses
 	
 	// Financial tracking
 	TotalCost         decimal.Decimal `json:"total_cost" db:"total_cost"`               // Total cost in dGPU tokens
 	PlatformFee       decimal.Decimal `json:"platform_fee" db:"platform_fee"`          // Platform fee amount
 	ProviderEarnings  decimal.Decimal `json:"provider_earnings" db:"provider_earnings"` // Provider earnings
+	LockedAmount      decimal.Decimal `json:"locked_amount" db:"locked_amount"`         // User funds locked while the session is active
+	Version           int             `json:"version" db:"version"`                     // Incremented on every update, for optimistic locking
 	
 	// Metadata
 	Metadata          map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
@@ -66,36 +72,84 @@ func (rs *RentalSession) Duration() time.Duration {
 	return time.Since(rs.StartedAt)
 }
 
-// DurationHours returns the duration in hours
+// PausedDuration returns the total time the session has spent paused, including
+// the current pause if the session is paused now
+func (rs *RentalSession) PausedDuration() time.Duration {
+	paused := time.Duration(rs.PausedSeconds) * time.Second
+	if rs.PausedAt != nil {
+		end := time.Now()
+		if rs.EndedAt != nil {
+			end = *rs.EndedAt
+		}
+		paused += end.Sub(*rs.PausedAt)
+	}
+	return paused
+}
+
+// BilledDuration returns the duration of the session excluding paused intervals
+func (rs *RentalSession) BilledDuration() time.Duration {
+	billed := rs.Duration() - rs.PausedDuration()
+	if billed < 0 {
+		return 0
+	}
+	return billed
+}
+
+// DurationHours returns the billed duration in hours
 func (rs *RentalSession) DurationHours() decimal.Decimal {
-	duration := rs.Duration()
+	duration := rs.BilledDuration()
 	hours := decimal.NewFromFloat(duration.Hours())
 	return hours
 }
 
-// CalculateCurrentCost calculates the current cost of the session
-func (rs *RentalSession) CalculateCurrentCost() decimal.Decimal {
-	hours := rs.DurationHours()
-	
+// CostForPeriod calculates the cost of running the session for the given number of hours
+// at the given power draw: base rate, plus VRAM rate per allocated GB, plus power rate per kW.
+// Usage records and the final bill are both priced with it so that they agree.
+func (rs *RentalSession) CostForPeriod(hours decimal.Decimal, powerW uint32) decimal.Decimal {
 	// Base cost from hourly rate
 	baseCost := rs.HourlyRate.Mul(hours)
-	
+
 	// VRAM cost
 	vramGB := decimal.NewFromInt(int64(rs.AllocatedVRAM)).Div(decimal.NewFromInt(1024))
 	vramCost := rs.VRAMRate.Mul(vramGB).Mul(hours)
-	
+
 	// Power cost
-	powerCost := decimal.Zero
+	powerKW := decimal.NewFromInt(int64(powerW)).Div(decimal.NewFromInt(1000))
+	powerCost := rs.PowerRate.Mul(powerKW).Mul(hours)
+
+	return baseCost.Add(vramCost).Add(powerCost)
+}
+
+// UnbilledDuration returns the billable time since LastBilledAt that no usage record covers yet.
+// Time after the session was paused or ended is not billable.
+func (rs *RentalSession) UnbilledDuration() time.Duration {
+	end := time.Now()
+	if rs.EndedAt != nil {
+		end = *rs.EndedAt
+	}
+	if rs.PausedAt != nil && rs.PausedAt.Before(end) {
+		end = *rs.PausedAt
+	}
+	if unbilled := end.Sub(rs.LastBilledAt); unbilled > 0 {
+		return unbilled
+	}
+	return 0
+}
+
+// CalculateCurrentCost calculates the current cost of the session: the cost already
+// accumulated from usage records plus the unbilled time since the last record, priced
+// at the last reported power draw (or the estimate if none was reported).
+func (rs *RentalSession) CalculateCurrentCost() decimal.Decimal {
+	hours := decimal.NewFromFloat(rs.UnbilledDuration().Hours())
+	return rs.TotalCost.Add(rs.CostForPeriod(hours, rs.PowerDrawW()))
+}
+
+// PowerDrawW returns the last reported power draw, or the estimate if none was reported
+func (rs *RentalSession) PowerDrawW() uint32 {
 	if rs.ActualPowerW != nil {
-		powerKW := decimal.NewFromInt(int64(*rs.ActualPowerW)).Div(decimal.NewFromInt(1000))
-		powerCost = rs.PowerRate.Mul(powerKW).Mul(hours)
-	} else {
-		powerKW := decimal.NewFromInt(int64(rs.EstimatedPowerW)).Div(decimal.NewFromInt(1000))
-		powerCost = rs.PowerRate.Mul(powerKW).Mul(hours)
+		return *rs.ActualPowerW
 	}
-	
-	totalCost := baseCost.Add(vramCost).Add(powerCost)
-	return totalCost
+	return rs.EstimatedPowerW
 }
 
 // UsageRecord represents detailed usage tracking for billing
@@ -158,6 +212,21 @@ type SessionStartRequest struct {
 	EstimatedPowerW  uint32          `json:"estimated_power_w" validate:"required,gt=0"`
 	MaxHourlyRate    *decimal.Decimal `json:"max_hourly_rate,omitempty"`
 	MaxDurationHours *int            `json:"max_duration_hours,omitempty"`
+	// ReservedAmount was reserved for the job when it was submitted; it is released as
+	// the session locks its own funds
+	ReservedAmount   decimal.Decimal `json:"reserved_amount,omitempty"`
+	IdempotencyKey   string          `json:"-"` // From the Idempotency-Key header
+}
+
+// SessionPauseRequest represents a request to pause billing for a rental session
+type SessionPauseRequest struct {
+	SessionID uuid.UUID `json:"session_id" validate:"required"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// SessionResumeRequest represents a request to resume a paused rental session
+type SessionResumeRequest struct {
+	SessionID uuid.UUID `json:"session_id" validate:"required"`
 }
 
 // SessionEndRequest represents a request to end a rental session
@@ -166,8 +235,50 @@ type SessionEndRequest struct {
 	Reason    string    `json:"reason,omitempty"`
 }
 
+// FundsReservationRequest reserves funds for jobs that have been submitted but not yet
+// placed. Either every job's funds are reserved or none are.
+type FundsReservationRequest struct {
+	UserID    string           `json:"user_id" validate:"required"`
+	Reference string           `json:"reference,omitempty"` // e.g. the batch the jobs were submitted in
+	Jobs      []JobReservation `json:"jobs" validate:"required,min=1"`
+}
+
+// JobReservation is one job's share of a funds reservation. Amount is priced by the
+// billing service from the GPU model and duration.
+type JobReservation struct {
+	JobID         string          `json:"job_id" validate:"required"`
+	GPUModel      string          `json:"gpu_model,omitempty"`
+	DurationHours decimal.Decimal `json:"duration_hours"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+// FundsReservationResponse reports the funds reserved for each job
+type FundsReservationResponse struct {
+	WalletID         uuid.UUID        `json:"wallet_id"`
+	Reference        string           `json:"reference,omitempty"`
+	Jobs             []JobReservation `json:"jobs"`
+	TotalAmount      decimal.Decimal  `json:"total_amount"`
+	AvailableBalance decimal.Decimal  `json:"available_balance"`
+}
+
+// FundsReleaseRequest releases funds reserved for jobs that will not run
+type FundsReleaseRequest struct {
+	UserID    string          `json:"user_id" validate:"required"`
+	Amount    decimal.Decimal `json:"amount" validate:"required"`
+	Reference string          `json:"reference,omitempty"`
+}
+
+// SessionRefundRequest represents a request to refund a session whose job failed during setup
+type SessionRefundRequest struct {
+	SessionID uuid.UUID `json:"session_id" validate:"required"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
 // UsageUpdateRequest represents real-time usage data from provider daemon
 type UsageUpdateRequest struct {
+	// UpdateID identifies the update, so one delivered more than once is recorded once.
+	// Updates without one get a new ID.
+	UpdateID         uuid.UUID `json:"update_id"`
 	SessionID        uuid.UUID `json:"session_id" validate:"required"`
 	GPUUtilization   uint8     `json:"gpu_utilization_percent" validate:"max=100"`
 	VRAMUtilization  uint8     `json:"vram_utilization_percent" validate:"max=100"`
@@ -208,6 +319,41 @@ type ProviderEarningsRequest struct {
 	ProviderID uuid.UUID  `json:"provider_id" validate:"required"`
 	StartDate  *time.Time `json:"start_date,omitempty"`
 	EndDate    *time.Time `json:"end_date,omitempty"`
+
+	// Breaks the earnings down by one of the EarningsGroupBy values; empty for totals only
+	GroupBy string `json:"group_by,omitempty"`
+}
+
+// Ways provider earnings can be broken down: by GPU model, or by the day, week or
+// month (UTC) sessions ended in
+const (
+	EarningsGroupByGPUModel = "gpu_model"
+	EarningsGroupByDay      = "day"
+	EarningsGroupByWeek     = "week"
+	EarningsGroupByMonth    = "month"
+)
+
+// ValidEarningsGroupBy reports whether groupBy is a supported earnings breakdown
+func ValidEarningsGroupBy(groupBy string) bool {
+	switch groupBy {
+	case EarningsGroupByGPUModel, EarningsGroupByDay, EarningsGroupByWeek, EarningsGroupByMonth:
+		return true
+	}
+	return false
+}
+
+// EarningsBreakdown is a provider's earnings from the sessions in one group of a
+// breakdown, i.e. one GPU model or one window. Hours are the time its GPUs were rented,
+// utilization hours the part of it they were busy, and energy what was billed for the
+// power they drew.
+type EarningsBreakdown struct {
+	GPUModel         string          `json:"gpu_model,omitempty"`
+	Window           string          `json:"window,omitempty"` // Date the window starts, e.g. 2026-10-12
+	Sessions         int             `json:"sessions"`
+	Earnings         decimal.Decimal `json:"earnings"`
+	Hours            decimal.Decimal `json:"hours"`
+	UtilizationHours decimal.Decimal `json:"utilization_hours"`
+	EnergyKWh        decimal.Decimal `json:"energy_kwh"`
 }
 
 // ProviderEarningsResponse represents provider earnings response
@@ -220,4 +366,70 @@ type ProviderEarningsResponse struct {
 	TotalHours       decimal.Decimal `json:"total_hours"`
 	AvgHourlyRate    decimal.Decimal `json:"avg_hourly_rate"`
 	Period           string          `json:"period"`
+
+	// Set when the earnings were broken down, ordered by GPU model or window
+	GroupBy   string              `json:"group_by,omitempty"`
+	Breakdown []EarningsBreakdown `json:"breakdown,omitempty"`
+}
+
+// PlatformFeesResponse summarizes the fees the platform has collected
+type PlatformFeesResponse struct {
+	SessionFees  decimal.Decimal `json:"session_fees"`
+	PayoutFees   decimal.Decimal `json:"payout_fees"`
+	TotalFees    decimal.Decimal `json:"total_fees"`
+	SessionCount int             `json:"session_count"`
+	Since        *time.Time      `json:"since,omitempty"`
+}
+
+// BillingStats holds platform-wide totals exported for monitoring
+type BillingStats struct {
+	ActiveSessions int64
+	WalletBalances map[WalletType]decimal.Decimal
+	LockedBalances map[WalletType]decimal.Decimal
+}
+
+// MarketplaceFilter selects and orders marketplace GPUs. It accepts the same
+// parameters as the provider registry's listing, with prices in effective terms
+type MarketplaceFilter struct {
+	Location        string          `json:"location,omitempty"`
+	GPUModel        string          `json:"gpu_model,omitempty"`
+	MinVRAM         uint64          `json:"min_vram_mb,omitempty"`
+	MaxPricePerHour decimal.Decimal `json:"max_price_per_hour,omitempty"`
+	MinRating       float64         `json:"min_rating,omitempty"`
+	IsOnline        *bool           `json:"is_online,omitempty"`
+	HasCapacity     *bool           `json:"has_capacity,omitempty"`
+	SortBy          string          `json:"sort_by,omitempty"`    // price, rating, capacity, location
+	SortOrder       string          `json:"sort_order,omitempty"` // asc, desc
+	Limit           int             `json:"limit,omitempty"`
+	Offset          int             `json:"offset,omitempty"`
+}
+
+// MarketplaceGPU is a single rentable GPU with its current pricing
+type MarketplaceGPU struct {
+	ProviderID   uuid.UUID `json:"provider_id"`
+	ProviderName string    `json:"provider_name"`
+	GPUIndex     int       `json:"gpu_index"`
+	GPUModel     string    `json:"gpu_model"`
+	VRAMTotalMB  uint64    `json:"vram_total_mb"`
+	Location     string    `json:"location,omitempty"`
+	Status       string    `json:"status"`
+	Available    bool      `json:"available"`
+	Rating       float64   `json:"rating"`
+
+	// Hourly pricing for the whole GPU. EffectiveHourlyRate includes the platform fee
+	// and is what the renter pays
+	HourlyRate          decimal.Decimal `json:"hourly_rate"`
+	PlatformFee         decimal.Decimal `json:"platform_fee"`
+	EffectiveHourlyRate decimal.Decimal `json:"effective_hourly_rate"`
+}
+
+// MarketplaceResponse is one page of marketplace search results
+type MarketplaceResponse struct {
+	GPUs               []MarketplaceGPU `json:"gpus"`
+	Total              int              `json:"total"`
+	Limit              int              `json:"limit,omitempty"`
+	Offset             int              `json:"offset"`
+	PlatformFeePercent decimal.Decimal  `json:"platform_fee_percent"`
+	Currency           string           `json:"currency"`
+	PricedAt           time.Time        `json:"priced_at"`
 }
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// pricedSession is a session billing base, VRAM and power rates
+func pricedSession(now time.Time) *RentalSession {
+	return &RentalSession{
+		HourlyRate:      decimal.NewFromInt(2),
+		VRAMRate:        decimal.NewFromFloat(0.05), // Per GB-hour
+		PowerRate:       decimal.NewFromFloat(0.3),  // Per kWh
+		AllocatedVRAM:   8192,
+		EstimatedPowerW: 400,
+		StartedAt:       now.Add(-time.Hour),
+		LastBilledAt:    now,
+	}
+}
+
+func TestCostForPeriod(t *testing.T) {
+	session := pricedSession(time.Now())
+	// 2/h base + 8GB * 0.05/GB-h + 0.25kW * 0.3/kWh, for half an hour
+	got := session.CostForPeriod(decimal.NewFromFloat(0.5), 250)
+	if want := decimal.NewFromFloat(1.2375); !got.Equal(want) {
+		t.Errorf("CostForPeriod = %s, want %s", got, want)
+	}
+}
+
+func TestCalculateCurrentCostMatchesUsageRecords(t *testing.T) {
+	now := time.Now()
+	session := pricedSession(now)
+	minute := decimal.NewFromInt(1).Div(decimal.NewFromInt(60))
+
+	// An hour of per-minute usage records at a varying power draw, accumulated as
+	// usage updates do
+	records := decimal.Zero
+	var power uint32
+	for i := 0; i < 60; i++ {
+		power = uint32(200 + 5*i)
+		periodCost := session.CostForPeriod(minute, power)
+		records = records.Add(periodCost)
+		session.TotalCost = session.TotalCost.Add(periodCost)
+		session.ActualPowerW = &power
+	}
+	session.LastBilledAt = now.Add(-45 * time.Second)
+	session.EndedAt = &now
+
+	// The final bill is the records plus the 45s since the last one, at the last power draw
+	unbilled := session.CostForPeriod(decimal.NewFromFloat((45 * time.Second).Hours()), power)
+	got := session.CalculateCurrentCost()
+	if diff := got.Sub(records.Add(unbilled)).Abs(); diff.GreaterThan(decimal.NewFromFloat(1e-9)) {
+		t.Errorf("final cost %s, want the usage records' %s plus %s unbilled", got, records, unbilled)
+	}
+
+	// Ended right at the last record, the bill is exactly the records
+	session.LastBilledAt = now
+	if got := session.CalculateCurrentCost(); !got.Equal(records) {
+		t.Errorf("final cost %s with nothing unbilled, want the usage records' %s", got, records)
+	}
+}
+
+func TestCalculateCurrentCostUnbilledTime(t *testing.T) {
+	now := time.Now()
+	tenMinutes := decimal.NewFromFloat((10 * time.Minute).Hours())
+
+	// Without reported usage the estimated power draw is billed
+	session := pricedSession(now)
+	session.LastBilledAt = now.Add(-10 * time.Minute)
+	session.EndedAt = &now
+	want := session.CostForPeriod(tenMinutes, session.EstimatedPowerW)
+	if diff := session.CalculateCurrentCost().Sub(want).Abs(); diff.GreaterThan(decimal.NewFromFloat(1e-9)) {
+		t.Errorf("cost %s, want %s at the estimated power draw", session.CalculateCurrentCost(), want)
+	}
+
+	// Time after a pause isn't billed
+	pausedAt := now.Add(-5 * time.Minute)
+	session.PausedAt = &pausedAt
+	want = session.CostForPeriod(decimal.NewFromFloat((5 * time.Minute).Hours()), session.EstimatedPowerW)
+	if diff := session.CalculateCurrentCost().Sub(want).Abs(); diff.GreaterThan(decimal.NewFromFloat(1e-9)) {
+		t.Errorf("cost %s of a paused session, want %s up to the pause", session.CalculateCurrentCost(), want)
+	}
+
+	// Nor is time before the last usage record
+	session.PausedAt = nil
+	session.LastBilledAt = now.Add(time.Minute)
+	if got := session.CalculateCurrentCost(); !got.IsZero() {
+		t.Errorf("cost %s with the last record after the end, want 0", got)
+	}
+}
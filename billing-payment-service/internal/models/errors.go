@@ -14,6 +14,7 @@ var (
 	ErrInsufficientFunds   = errors.New("insufficient funds")
 	ErrInvalidWalletType   = errors.New("invalid wallet type")
 	ErrInvalidSolanaAddress = errors.New("invalid Solana address")
+	ErrLimitExceeded        = errors.New("spending limit exceeded")
 
 	// Transaction errors
 	ErrTransactionNotFound    = errors.New("transaction not found")
@@ -27,9 +28,12 @@ var (
 	ErrSessionNotFound        = errors.New("session not found")
 	ErrSessionAlreadyActive   = errors.New("session already active")
 	ErrSessionNotActive       = errors.New("session not active")
+	ErrSessionNotPaused       = errors.New("session not paused")
 	ErrInvalidSessionStatus   = errors.New("invalid session status")
 	ErrSessionExpired         = errors.New("session expired")
 	ErrMaxSessionDuration     = errors.New("maximum session duration exceeded")
+	ErrDuplicateIdempotencyKey = errors.New("idempotency key already used")
+	ErrSessionConflict        = errors.New("session was modified concurrently")
 
 	// Provider errors
 	ErrProviderNotFound       = errors.New("provider not found")
@@ -58,6 +62,7 @@ var (
 	ErrPayoutFailed           = errors.New("payout failed")
 	ErrMinimumPayoutAmount    = errors.New("amount below minimum payout threshold")
 	ErrPayoutAlreadyProcessed = errors.New("payout already processed")
+	ErrPayoutInProgress       = errors.New("payout already in progress")
 
 	// Validation errors
 	ErrValidationFailed       = errors.New("validation failed")
@@ -133,6 +138,7 @@ const (
 	ErrCodeInsufficientFunds   = "INSUFFICIENT_FUNDS"
 	ErrCodeInvalidWalletType   = "INVALID_WALLET_TYPE"
 	ErrCodeInvalidSolanaAddr   = "INVALID_SOLANA_ADDRESS"
+	ErrCodeLimitExceeded       = "LIMIT_EXCEEDED"
 
 	// Transaction error codes
 	ErrCodeTransactionNotFound = "TRANSACTION_NOT_FOUND"
@@ -146,9 +152,11 @@ const (
 	ErrCodeSessionNotFound     = "SESSION_NOT_FOUND"
 	ErrCodeSessionActive       = "SESSION_ALREADY_ACTIVE"
 	ErrCodeSessionNotActive    = "SESSION_NOT_ACTIVE"
+	ErrCodeSessionNotPaused    = "SESSION_NOT_PAUSED"
 	ErrCodeInvalidSessionStatus = "INVALID_SESSION_STATUS"
 	ErrCodeSessionExpired      = "SESSION_EXPIRED"
 	ErrCodeMaxSessionDuration  = "MAX_SESSION_DURATION"
+	ErrCodeSessionConflict     = "SESSION_CONFLICT"
 
 	// Provider error codes
 	ErrCodeProviderNotFound    = "PROVIDER_NOT_FOUND"
@@ -177,6 +185,7 @@ const (
 	ErrCodePayoutFailed        = "PAYOUT_FAILED"
 	ErrCodeMinimumPayout       = "MINIMUM_PAYOUT_AMOUNT"
 	ErrCodePayoutProcessed     = "PAYOUT_ALREADY_PROCESSED"
+	ErrCodePayoutInProgress    = "PAYOUT_IN_PROGRESS"
 
 	// Validation error codes
 	ErrCodeValidationFailed    = "VALIDATION_FAILED"
@@ -204,6 +213,22 @@ func NewInsufficientFundsError(required, available string) *BillingError {
 		WithDetail("available", available)
 }
 
+// NewLimitExceededError reports that a reservation would take spending over the daily or monthly limit
+func NewLimitExceededError(period, limit, spent, requested string) *BillingError {
+	return NewBillingError(ErrCodeLimitExceeded, "Spending limit exceeded", ErrLimitExceeded).
+		WithDetail("period", period).
+		WithDetail("limit", limit).
+		WithDetail("spent", spent).
+		WithDetail("requested", requested)
+}
+
+// NewMinimumPayoutError rejects a payout below the configured minimum
+func NewMinimumPayoutError(minimum, requested string) *BillingError {
+	return NewBillingError(ErrCodeMinimumPayout, "Payout is below the minimum amount", ErrMinimumPayoutAmount).
+		WithDetail("minimum", minimum).
+		WithDetail("requested", requested)
+}
+
 func NewSessionNotFoundError(sessionID string) *BillingError {
 	return NewBillingError(ErrCodeSessionNotFound, "Session not found", ErrSessionNotFound).
 		WithDetail("session_id", sessionID)
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AllGPUModels is the gpu_model stored for a schedule covering every GPU of a provider
+const AllGPUModels = "*"
+
+// ProviderRateSchedule is a provider's own pricing for one GPU model, or for all of
+// its GPUs when GPUModel is empty
+type ProviderRateSchedule struct {
+	ProviderID  uuid.UUID        `json:"provider_id"`
+	GPUModel    string           `json:"gpu_model,omitempty"`
+	HourlyRate  decimal.Decimal  `json:"hourly_rate"`           // Replaces the platform base rate when positive
+	Timezone    string           `json:"timezone"`              // IANA zone the windows are in, e.g. "Europe/Berlin"
+	Multipliers []RateMultiplier `json:"multipliers,omitempty"` // First matching window wins
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// RateMultiplier scales the base rate during a weekly time window in the provider's
+// local time, e.g. 1.5 on weekdays from 18:00 to 23:00
+type RateMultiplier struct {
+	Days       []string        `json:"days,omitempty"` // "mon" to "sun"; empty means every day
+	StartHour  int             `json:"start_hour"`     // 0-23, inclusive
+	EndHour    int             `json:"end_hour"`       // 1-24, exclusive; at or before StartHour the window runs past midnight
+	Multiplier decimal.Decimal `json:"multiplier"`
+}
+
+// weekdayNames maps the day names used in RateMultiplier.Days to weekdays
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWeekday parses a RateMultiplier day name
+func ParseWeekday(day string) (time.Weekday, bool) {
+	weekday, ok := weekdayNames[strings.ToLower(strings.TrimSpace(day))]
+	return weekday, ok
+}
+
+// Location returns the schedule's timezone, defaulting to UTC
+func (s *ProviderRateSchedule) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// MultiplierAt returns the multiplier of the first window containing t in the
+// provider's local time, or 1 outside every window
+func (s *ProviderRateSchedule) MultiplierAt(t time.Time) decimal.Decimal {
+	local := t.In(s.Location())
+	for _, m := range s.Multipliers {
+		if m.contains(local) {
+			return m.Multiplier
+		}
+	}
+	return decimal.NewFromInt(1)
+}
+
+// contains reports whether the local time falls in the window. A window running past
+// midnight belongs to the day it starts on.
+func (m *RateMultiplier) contains(local time.Time) bool {
+	hour := local.Hour()
+	weekday := local.Weekday()
+
+	if m.StartHour < m.EndHour {
+		return m.StartHour <= hour && hour < m.EndHour && m.onDay(weekday)
+	}
+	if hour >= m.StartHour {
+		return m.onDay(weekday)
+	}
+	if hour < m.EndHour {
+		return m.onDay((weekday + 6) % 7) // Started the day before
+	}
+	return false
+}
+
+// onDay reports whether the window starts on weekday
+func (m *RateMultiplier) onDay(weekday time.Weekday) bool {
+	if len(m.Days) == 0 {
+		return true
+	}
+	for _, day := range m.Days {
+		if d, ok := ParseWeekday(day); ok && d == weekday {
+			return true
+		}
+	}
+	return false
+}
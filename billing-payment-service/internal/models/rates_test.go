@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// at returns the time in the zone, which must load
+func at(t *testing.T, zone string, year int, month time.Month, day, hour, min int) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatalf("load %s: %v", zone, err)
+	}
+	return time.Date(year, month, day, hour, min, 0, 0, loc)
+}
+
+func TestMultiplierAt(t *testing.T) {
+	peak := decimal.NewFromFloat(1.5)
+	night := decimal.NewFromFloat(0.5)
+
+	tests := []struct {
+		name     string
+		schedule ProviderRateSchedule
+		at       time.Time
+		want     decimal.Decimal
+	}{
+		// 2026-01-05 is a Monday
+		{"before a weekday window", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"mon", "fri"}, StartHour: 9, EndHour: 17, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 8, 59), decimal.NewFromInt(1)},
+		{"window start is inclusive", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"mon", "fri"}, StartHour: 9, EndHour: 17, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 9, 0), peak},
+		{"last minute of a window", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"mon", "fri"}, StartHour: 9, EndHour: 17, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 16, 59), peak},
+		{"window end is exclusive", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"mon", "fri"}, StartHour: 9, EndHour: 17, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 17, 0), decimal.NewFromInt(1)},
+		{"day not listed", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"mon", "fri"}, StartHour: 9, EndHour: 17, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 6, 10, 0), decimal.NewFromInt(1)},
+		{"window running to midnight", ProviderRateSchedule{Multipliers: []RateMultiplier{{StartHour: 20, EndHour: 24, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 23, 59), peak},
+		{"midnight after a window ending at 24", ProviderRateSchedule{Multipliers: []RateMultiplier{{StartHour: 20, EndHour: 24, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 6, 0, 0), decimal.NewFromInt(1)},
+
+		// A Friday night window runs into Saturday morning
+		{"before a wrapping window", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 9, 21, 59), decimal.NewFromInt(1)},
+		{"wrapping window start", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 9, 22, 0), night},
+		{"past midnight on the next day", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 10, 0, 0), night},
+		{"last minute after midnight", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 10, 5, 59), night},
+		{"wrapping window end", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 10, 6, 0), decimal.NewFromInt(1)},
+		{"early hours belong to the previous day's window", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 9, 3, 0), decimal.NewFromInt(1)},
+		{"wrapping window on a day not listed", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"fri"}, StartHour: 22, EndHour: 6, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 10, 22, 0), decimal.NewFromInt(1)},
+		{"wrapping from Sunday into Monday", ProviderRateSchedule{Multipliers: []RateMultiplier{{Days: []string{"sun"}, StartHour: 23, EndHour: 1, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 5, 0, 30), night},
+
+		// Windows are in the provider's local time, whatever zone the time is given in
+		{"local winter peak", ProviderRateSchedule{Timezone: "Europe/Berlin", Multipliers: []RateMultiplier{{StartHour: 18, EndHour: 23, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 17, 0), peak},
+		{"before the local winter peak", ProviderRateSchedule{Timezone: "Europe/Berlin", Multipliers: []RateMultiplier{{StartHour: 18, EndHour: 23, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 16, 59), decimal.NewFromInt(1)},
+		{"local summer peak", ProviderRateSchedule{Timezone: "Europe/Berlin", Multipliers: []RateMultiplier{{StartHour: 18, EndHour: 23, Multiplier: peak}}},
+			at(t, "UTC", 2026, 7, 6, 16, 0), peak},
+		{"after the local summer peak", ProviderRateSchedule{Timezone: "Europe/Berlin", Multipliers: []RateMultiplier{{StartHour: 18, EndHour: 23, Multiplier: peak}}},
+			at(t, "UTC", 2026, 7, 6, 21, 0), decimal.NewFromInt(1)},
+		{"local Monday night on a UTC Tuesday", ProviderRateSchedule{Timezone: "America/New_York", Multipliers: []RateMultiplier{{Days: []string{"mon"}, StartHour: 22, EndHour: 2, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 6, 6, 59), night},
+		{"local window end on a UTC Tuesday", ProviderRateSchedule{Timezone: "America/New_York", Multipliers: []RateMultiplier{{Days: []string{"mon"}, StartHour: 22, EndHour: 2, Multiplier: night}}},
+			at(t, "UTC", 2026, 1, 6, 7, 0), decimal.NewFromInt(1)},
+		{"time given in another zone", ProviderRateSchedule{Timezone: "Asia/Tokyo", Multipliers: []RateMultiplier{{StartHour: 9, EndHour: 10, Multiplier: peak}}},
+			at(t, "Europe/Berlin", 2026, 1, 5, 1, 30), peak},
+		{"unknown zone is UTC", ProviderRateSchedule{Timezone: "Mars/Olympus", Multipliers: []RateMultiplier{{StartHour: 9, EndHour: 10, Multiplier: peak}}},
+			at(t, "UTC", 2026, 1, 5, 9, 30), peak},
+
+		{"first matching window wins", ProviderRateSchedule{Multipliers: []RateMultiplier{
+			{Days: []string{"mon"}, StartHour: 18, EndHour: 23, Multiplier: peak},
+			{StartHour: 22, EndHour: 6, Multiplier: night},
+		}}, at(t, "UTC", 2026, 1, 5, 22, 0), peak},
+		{"later window where the first doesn't match", ProviderRateSchedule{Multipliers: []RateMultiplier{
+			{Days: []string{"mon"}, StartHour: 18, EndHour: 23, Multiplier: peak},
+			{StartHour: 22, EndHour: 6, Multiplier: night},
+		}}, at(t, "UTC", 2026, 1, 5, 23, 0), night},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.MultiplierAt(tt.at); !got.Equal(tt.want) {
+				t.Errorf("MultiplierAt(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
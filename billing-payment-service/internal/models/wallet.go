@@ -18,17 +18,20 @@ const (
 
 // Wallet represents a dGPU token wallet for users and providers
 type Wallet struct {
-	ID              uuid.UUID       `json:"id" db:"id"`
-	UserID          string          `json:"user_id" db:"user_id"`
-	WalletType      WalletType      `json:"wallet_type" db:"wallet_type"`
-	SolanaAddress   string          `json:"solana_address" db:"solana_address"`
-	Balance         decimal.Decimal `json:"balance" db:"balance"`
-	LockedBalance   decimal.Decimal `json:"locked_balance" db:"locked_balance"`   // Funds locked for active sessions
-	PendingBalance  decimal.Decimal `json:"pending_balance" db:"pending_balance"` // Pending deposits/withdrawals
-	IsActive        bool            `json:"is_active" db:"is_active"`
-	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time       `json:"updated_at" db:"updated_at"`
-	LastActivityAt  *time.Time      `json:"last_activity_at,omitempty" db:"last_activity_at"`
+	ID                uuid.UUID       `json:"id" db:"id"`
+	UserID            string          `json:"user_id" db:"user_id"`
+	WalletType        WalletType      `json:"wallet_type" db:"wallet_type"`
+	SolanaAddress     string          `json:"solana_address" db:"solana_address"`
+	Balance           decimal.Decimal `json:"balance" db:"balance"`
+	LockedBalance     decimal.Decimal `json:"locked_balance" db:"locked_balance"`           // Funds locked for active sessions
+	PendingBalance    decimal.Decimal `json:"pending_balance" db:"pending_balance"`         // Pending deposits/withdrawals
+	DailySpendLimit   decimal.Decimal `json:"daily_spend_limit" db:"daily_spend_limit"`     // Zero means no limit
+	MonthlySpendLimit decimal.Decimal `json:"monthly_spend_limit" db:"monthly_spend_limit"` // Zero means no limit
+	Timezone          string          `json:"timezone" db:"timezone"`                       // Owner's profile timezone; spend limit days and months follow it
+	IsActive          bool            `json:"is_active" db:"is_active"`
+	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at" db:"updated_at"`
+	LastActivityAt    *time.Time      `json:"last_activity_at,omitempty" db:"last_activity_at"`
 }
 
 // AvailableBalance returns the balance available for spending
@@ -36,6 +39,18 @@ func (w *Wallet) AvailableBalance() decimal.Decimal {
 	return w.Balance.Sub(w.LockedBalance)
 }
 
+// Location returns the wallet owner's timezone, falling back to UTC when it is unset or unknown
+func (w *Wallet) Location() *time.Location {
+	if w.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 // TotalBalance returns the total balance including locked and pending
 func (w *Wallet) TotalBalance() decimal.Decimal {
 	return w.Balance.Add(w.PendingBalance)
@@ -158,9 +173,19 @@ type BalanceResponse struct {
 	PendingBalance   decimal.Decimal `json:"pending_balance"`
 	AvailableBalance decimal.Decimal `json:"available_balance"`
 	TotalBalance     decimal.Decimal `json:"total_balance"`
+	DailySpent       decimal.Decimal `json:"daily_spent"`
+	MonthlySpent     decimal.Decimal `json:"monthly_spent"`
 	LastUpdated      time.Time       `json:"last_updated"`
 }
 
+// SpendLimitsRequest represents a request to set a wallet's spending limits.
+// A zero limit removes it.
+type SpendLimitsRequest struct {
+	DailySpendLimit   decimal.Decimal `json:"daily_spend_limit" validate:"gte=0"`
+	MonthlySpendLimit decimal.Decimal `json:"monthly_spend_limit" validate:"gte=0"`
+	Timezone          string          `json:"timezone,omitempty"` // IANA name from the user's profile, e.g. "Europe/Istanbul"
+}
+
 // TransactionHistoryRequest represents a request for transaction history
 type TransactionHistoryRequest struct {
 	WalletID    *uuid.UUID         `json:"wallet_id,omitempty"`
@@ -194,9 +219,22 @@ type WithdrawalRequest struct {
 	ToAddress     string          `json:"to_address" validate:"required"`
 }
 
-// PayoutRequest represents a request for provider payout
+// PayoutRequest represents a request for provider payout. Amount is taken from the
+// provider's earnings; the payout fee is deducted from it before the transfer.
 type PayoutRequest struct {
-	ProviderWalletID uuid.UUID       `json:"provider_wallet_id" validate:"required"`
-	Amount           decimal.Decimal `json:"amount" validate:"required,gt=0"`
-	ToAddress        string          `json:"to_address" validate:"required"`
+	Amount decimal.Decimal `json:"amount" validate:"required,gt=0"`
+}
+
+// PayoutResponse represents a completed provider payout
+type PayoutResponse struct {
+	ProviderID          uuid.UUID         `json:"provider_id"`
+	Amount              decimal.Decimal   `json:"amount"`
+	Fee                 decimal.Decimal   `json:"fee"`
+	NetAmount           decimal.Decimal   `json:"net_amount"`
+	ToAddress           string            `json:"to_address"`
+	Status              TransactionStatus `json:"status"` // Pending until the transfer confirms
+	SolanaSignature     string            `json:"solana_signature"`
+	PayoutTransactionID uuid.UUID         `json:"payout_transaction_id"`
+	FeeTransactionID    *uuid.UUID        `json:"fee_transaction_id,omitempty"`
+	RemainingEarnings   decimal.Decimal   `json:"remaining_earnings"`
 }
@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaultCarbonIntensityKey is the grid carbon intensity used for unknown or missing locations
+const defaultCarbonIntensityKey = "default"
+
+// DefaultGridCarbonIntensity holds average grid carbon intensities in gCO2/kWh by region.
+// Keys are lower case location prefixes; the longest matching prefix of a provider's
+// location wins (e.g. "us-west" matches "us-west-2" before "us" does).
+var DefaultGridCarbonIntensity = map[string]float64{
+	"us":                      370,
+	"us-east":                 360,
+	"us-west":                 240,
+	"ca":                      120,
+	"eu":                      250,
+	"eu-west":                 230,
+	"eu-north":                40,
+	"uk":                      200,
+	"de":                      380,
+	"fr":                      60,
+	"se":                      30,
+	"no":                      30,
+	"pl":                      650,
+	"in":                      630,
+	"cn":                      550,
+	"jp":                      460,
+	"kr":                      420,
+	"ap-southeast":            480,
+	"au":                      500,
+	"br":                      100,
+	"za":                      700,
+	defaultCarbonIntensityKey: 440,
+}
+
+// buildCarbonIntensity merges configured intensities over the defaults
+func buildCarbonIntensity(overrides map[string]float64) map[string]decimal.Decimal {
+	intensity := make(map[string]decimal.Decimal, len(DefaultGridCarbonIntensity)+len(overrides))
+	for region, gPerKWh := range DefaultGridCarbonIntensity {
+		intensity[region] = decimal.NewFromFloat(gPerKWh)
+	}
+	for region, gPerKWh := range overrides {
+		intensity[strings.ToLower(strings.TrimSpace(region))] = decimal.NewFromFloat(gPerKWh)
+	}
+	return intensity
+}
+
+// GridCarbonIntensity returns the grid carbon intensity in gCO2/kWh for a provider location,
+// matching the longest configured region prefix and falling back to the default intensity
+func (e *Engine) GridCarbonIntensity(location string) decimal.Decimal {
+	region := strings.ToLower(strings.TrimSpace(location))
+	for region != "" {
+		if gPerKWh, exists := e.carbonIntensity[region]; exists {
+			return gPerKWh
+		}
+		i := strings.LastIndexAny(region, "-_/ ")
+		if i < 0 {
+			break
+		}
+		region = region[:i]
+	}
+	return e.carbonIntensity[defaultCarbonIntensityKey]
+}
+
+// estimateEmissions returns the energy a session uses in kWh and its carbon footprint in kg CO2
+func (e *Engine) estimateEmissions(powerW uint32, durationHours decimal.Decimal, location string) (energyKWh, intensity, carbonKg decimal.Decimal) {
+	energyKWh = decimal.NewFromInt(int64(powerW)).Mul(durationHours).Div(decimal.NewFromInt(1000))
+	intensity = e.GridCarbonIntensity(location)
+	carbonKg = energyKWh.Mul(intensity).Div(decimal.NewFromInt(1000))
+	return energyKWh, intensity, carbonKg
+}
@@ -2,6 +2,7 @@ package pricing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,13 +10,23 @@ import (
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
 )
 
 // Engine handles dynamic pricing calculations for GPU rentals
 type Engine struct {
-	logger    *zap.Logger
-	config    *Config
-	baseRates map[string]decimal.Decimal
+	logger          *zap.Logger
+	config          *Config
+	rates           RateStore
+	baseRates       map[string]decimal.Decimal
+	carbonIntensity map[string]decimal.Decimal // gCO2/kWh by region
+}
+
+// RateStore looks up the rate schedules providers set for their GPUs
+type RateStore interface {
+	// GetProviderRateSchedule returns models.ErrRateNotFound when the provider has none
+	GetProviderRateSchedule(ctx context.Context, providerID uuid.UUID, gpuModel string) (*models.ProviderRateSchedule, error)
 }
 
 // Config represents pricing engine configuration
@@ -39,19 +50,25 @@ type Config struct {
 	// Dynamic pricing factors
 	DemandMultiplierMax decimal.Decimal `yaml:"demand_multiplier_max"`
 	SupplyBonusMax      decimal.Decimal `yaml:"supply_bonus_max"`
+
+	// Grid carbon intensity overrides (gCO2/kWh) by region, merged over DefaultGridCarbonIntensity
+	GridCarbonIntensity map[string]float64 `yaml:"grid_carbon_intensity"`
 }
 
-// NewEngine creates a new pricing engine
-func NewEngine(config *Config, logger *zap.Logger) *Engine {
+// NewEngine creates a new pricing engine. rates may be nil, in which case every
+// provider is priced at the platform rates.
+func NewEngine(config *Config, rates RateStore, logger *zap.Logger) *Engine {
 	baseRates := make(map[string]decimal.Decimal)
 	for model, rate := range config.BaseRates {
 		baseRates[strings.ToLower(model)] = decimal.NewFromFloat(rate)
 	}
 
 	return &Engine{
-		logger:    logger,
-		config:    config,
-		baseRates: baseRates,
+		logger:          logger,
+		config:          config,
+		rates:           rates,
+		baseRates:       baseRates,
+		carbonIntensity: buildCarbonIntensity(config.GridCarbonIntensity),
 	}
 }
 
@@ -62,8 +79,10 @@ type PricingRequest struct {
 	TotalVRAM       uint64          `json:"total_vram_mb"`
 	EstimatedPowerW uint32          `json:"estimated_power_w"`
 	DurationHours   decimal.Decimal `json:"duration_hours"`
+	Location        string          `json:"location,omitempty"` // Provider location, used for carbon intensity
 	ProviderID      *uuid.UUID      `json:"provider_id,omitempty"`
 	UserID          *string         `json:"user_id,omitempty"`
+	At              *time.Time      `json:"at,omitempty"` // When the rental starts; defaults to now
 }
 
 // PricingResponse represents the calculated pricing
@@ -84,13 +103,20 @@ type PricingResponse struct {
 	ProviderEarnings decimal.Decimal `json:"provider_earnings"`
 
 	// Dynamic pricing factors
-	DemandMultiplier decimal.Decimal `json:"demand_multiplier"`
-	SupplyBonus      decimal.Decimal `json:"supply_bonus"`
+	DemandMultiplier    decimal.Decimal `json:"demand_multiplier"`
+	SupplyBonus         decimal.Decimal `json:"supply_bonus"`
+	TimeOfDayMultiplier decimal.Decimal `json:"time_of_day_multiplier"`
+	ProviderRateApplied bool            `json:"provider_rate_applied"` // The provider's own rate schedule was used
 
 	// VRAM allocation details
 	VRAMPercentage  decimal.Decimal `json:"vram_percentage"`
 	AllocatedVRAMGB decimal.Decimal `json:"allocated_vram_gb"`
 
+	// Sustainability
+	EstimatedEnergyKWh     decimal.Decimal `json:"estimated_energy_kwh"`
+	CarbonIntensityGPerKWh decimal.Decimal `json:"carbon_intensity_g_per_kwh"`
+	CarbonFootprintKg      decimal.Decimal `json:"carbon_footprint_kg"`
+
 	// Metadata
 	CalculatedAt time.Time `json:"calculated_at"`
 	ValidUntil   time.Time `json:"valid_until"`
@@ -105,12 +131,29 @@ func (e *Engine) CalculatePricing(ctx context.Context, req *PricingRequest) (*Pr
 		zap.String("duration_hours", req.DurationHours.String()),
 	)
 
-	// Get base rate for GPU model
-	baseRate, err := e.getBaseRate(req.GPUModel)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get base rate: %w", err)
+	at := time.Now()
+	if req.At != nil {
+		at = *req.At
 	}
 
+	// A provider's own hourly rate replaces the platform rate for the model, and its
+	// time-of-day multipliers scale whichever applies
+	schedule := e.providerSchedule(ctx, req)
+	timeMultiplier := decimal.NewFromInt(1)
+	var baseRate decimal.Decimal
+	if schedule != nil {
+		baseRate = schedule.HourlyRate
+		timeMultiplier = schedule.MultiplierAt(at)
+	}
+	if !baseRate.IsPositive() {
+		var err error
+		baseRate, err = e.getBaseRate(req.GPUModel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get base rate: %w", err)
+		}
+	}
+	baseRate = baseRate.Mul(timeMultiplier)
+
 	// Calculate VRAM allocation
 	vramPercentage := decimal.NewFromInt(int64(req.RequestedVRAM)).Div(decimal.NewFromInt(int64(req.TotalVRAM)))
 	allocatedVRAMGB := decimal.NewFromInt(int64(req.RequestedVRAM)).Div(decimal.NewFromInt(1024))
@@ -151,6 +194,9 @@ func (e *Engine) CalculatePricing(ctx context.Context, req *PricingRequest) (*Pr
 	totalCost := subtotalCost.Add(platformFee)
 	providerEarnings := subtotalCost.Sub(platformFee)
 
+	// Estimate energy use and emissions from the provider's regional grid
+	energyKWh, carbonIntensity, carbonKg := e.estimateEmissions(req.EstimatedPowerW, req.DurationHours, req.Location)
+
 	now := time.Now().UTC()
 	response := &PricingResponse{
 		BaseHourlyRate:   adjustedBaseRate,
@@ -168,8 +214,16 @@ func (e *Engine) CalculatePricing(ctx context.Context, req *PricingRequest) (*Pr
 		SupplyBonus:      supplyBonus,
 		VRAMPercentage:   vramPercentage,
 		AllocatedVRAMGB:  allocatedVRAMGB,
-		CalculatedAt:     now,
-		ValidUntil:       now.Add(5 * time.Minute), // Pricing valid for 5 minutes
+
+		TimeOfDayMultiplier: timeMultiplier,
+		ProviderRateApplied: schedule != nil,
+
+		EstimatedEnergyKWh:     energyKWh,
+		CarbonIntensityGPerKWh: carbonIntensity,
+		CarbonFootprintKg:      carbonKg,
+
+		CalculatedAt: now,
+		ValidUntil:   now.Add(5 * time.Minute), // Pricing valid for 5 minutes
 	}
 
 	e.logger.Debug("Pricing calculated",
@@ -181,6 +235,26 @@ func (e *Engine) CalculatePricing(ctx context.Context, req *PricingRequest) (*Pr
 	return response, nil
 }
 
+// providerSchedule returns the provider's rate schedule for the requested GPU model,
+// or nil if it has none. Lookup failures fall back to the platform rates.
+func (e *Engine) providerSchedule(ctx context.Context, req *PricingRequest) *models.ProviderRateSchedule {
+	if e.rates == nil || req.ProviderID == nil {
+		return nil
+	}
+
+	schedule, err := e.rates.GetProviderRateSchedule(ctx, *req.ProviderID, req.GPUModel)
+	if err != nil {
+		if !errors.Is(err, models.ErrRateNotFound) {
+			e.logger.Warn("Failed to get provider rate schedule, using platform rates",
+				zap.String("provider_id", req.ProviderID.String()),
+				zap.Error(err),
+			)
+		}
+		return nil
+	}
+	return schedule
+}
+
 // getBaseRate gets the base hourly rate for a GPU model
 func (e *Engine) getBaseRate(gpuModel string) (decimal.Decimal, error) {
 	normalizedModel := strings.ToLower(strings.TrimSpace(gpuModel))
@@ -0,0 +1,151 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// fakeRates holds one rate schedule per provider
+type fakeRates struct {
+	schedules map[uuid.UUID]*models.ProviderRateSchedule
+	err       error
+}
+
+func (f *fakeRates) GetProviderRateSchedule(ctx context.Context, providerID uuid.UUID, gpuModel string) (*models.ProviderRateSchedule, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	schedule, ok := f.schedules[providerID]
+	if !ok {
+		return nil, models.ErrRateNotFound
+	}
+	return schedule, nil
+}
+
+// newTestEngine prices only the base rate: no VRAM, power or platform fee
+func newTestEngine(rates RateStore) *Engine {
+	return NewEngine(&Config{BaseRates: map[string]float64{"rtx4090": 1}}, rates, zap.NewNop())
+}
+
+// pricingRequestAt asks for an hour on provider's RTX 4090 starting at at
+func pricingRequestAt(provider uuid.UUID, at time.Time) *PricingRequest {
+	return &PricingRequest{
+		GPUModel:        "rtx4090",
+		RequestedVRAM:   24576,
+		TotalVRAM:       24576,
+		EstimatedPowerW: 450,
+		DurationHours:   decimal.NewFromInt(1),
+		ProviderID:      &provider,
+		At:              &at,
+	}
+}
+
+func TestCalculatePricingTimeOfDay(t *testing.T) {
+	provider := uuid.New()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newTestEngine(&fakeRates{schedules: map[uuid.UUID]*models.ProviderRateSchedule{
+		provider: {
+			ProviderID: provider,
+			GPUModel:   "rtx4090",
+			HourlyRate: decimal.NewFromInt(2),
+			Timezone:   "Europe/Berlin",
+			Multipliers: []models.RateMultiplier{
+				{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartHour: 18, EndHour: 22, Multiplier: decimal.NewFromFloat(1.5)},
+				{StartHour: 22, EndHour: 6, Multiplier: decimal.NewFromFloat(0.5)},
+			},
+		},
+	}})
+
+	// 2026-01-09 is a Friday
+	tests := []struct {
+		name       string
+		at         time.Time
+		multiplier string
+		baseRate   string
+	}{
+		{"off-peak afternoon", time.Date(2026, 1, 9, 17, 59, 0, 0, berlin), "1", "2"},
+		{"peak start", time.Date(2026, 1, 9, 18, 0, 0, 0, berlin), "1.5", "3"},
+		{"peak start in UTC", time.Date(2026, 1, 9, 17, 0, 0, 0, time.UTC), "1.5", "3"},
+		{"last minute of peak", time.Date(2026, 1, 9, 21, 59, 0, 0, berlin), "1.5", "3"},
+		{"night start", time.Date(2026, 1, 9, 22, 0, 0, 0, berlin), "0.5", "1"},
+		{"night past midnight", time.Date(2026, 1, 10, 0, 30, 0, 0, berlin), "0.5", "1"},
+		{"last minute of night", time.Date(2026, 1, 10, 5, 59, 0, 0, berlin), "0.5", "1"},
+		{"morning", time.Date(2026, 1, 10, 6, 0, 0, 0, berlin), "1", "2"},
+		{"weekend evening", time.Date(2026, 1, 10, 19, 0, 0, 0, berlin), "1", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := engine.CalculatePricing(context.Background(), pricingRequestAt(provider, tt.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.ProviderRateApplied {
+				t.Error("provider rate not applied")
+			}
+			if want := decimal.RequireFromString(tt.multiplier); !resp.TimeOfDayMultiplier.Equal(want) {
+				t.Errorf("time of day multiplier %s, want %s", resp.TimeOfDayMultiplier, want)
+			}
+			if want := decimal.RequireFromString(tt.baseRate); !resp.BaseHourlyRate.Equal(want) || !resp.BaseCost.Equal(want) {
+				t.Errorf("base rate %s, cost %s, want %s", resp.BaseHourlyRate, resp.BaseCost, want)
+			}
+		})
+	}
+}
+
+func TestCalculatePricingPlatformRate(t *testing.T) {
+	provider := uuid.New()
+	at := time.Date(2026, 1, 9, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		rates RateStore
+	}{
+		{"no rate store", nil},
+		{"no schedule", &fakeRates{}},
+		{"lookup failure", &fakeRates{err: errors.New("database is down")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newTestEngine(tt.rates).CalculatePricing(context.Background(), pricingRequestAt(provider, at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ProviderRateApplied || !resp.TimeOfDayMultiplier.Equal(decimal.NewFromInt(1)) {
+				t.Errorf("provider rate applied %v with multiplier %s, want the platform rate", resp.ProviderRateApplied, resp.TimeOfDayMultiplier)
+			}
+			if !resp.BaseHourlyRate.Equal(decimal.NewFromInt(1)) {
+				t.Errorf("base rate %s, want the platform's 1", resp.BaseHourlyRate)
+			}
+		})
+	}
+}
+
+func TestCalculatePricingScalesPlatformRate(t *testing.T) {
+	// A schedule without its own hourly rate scales the platform rate
+	provider := uuid.New()
+	engine := newTestEngine(&fakeRates{schedules: map[uuid.UUID]*models.ProviderRateSchedule{
+		provider: {
+			ProviderID:  provider,
+			GPUModel:    "rtx4090",
+			Multipliers: []models.RateMultiplier{{StartHour: 0, EndHour: 6, Multiplier: decimal.NewFromFloat(0.8)}},
+		},
+	}})
+
+	resp, err := engine.CalculatePricing(context.Background(), pricingRequestAt(provider, time.Date(2026, 1, 9, 3, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := decimal.NewFromFloat(0.8); !resp.BaseHourlyRate.Equal(want) {
+		t.Errorf("base rate %s, want %s", resp.BaseHourlyRate, want)
+	}
+}
@@ -2,13 +2,18 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/metrics"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
 	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana"
@@ -20,8 +25,24 @@ type BillingService struct {
 	store         *store.PostgresStore
 	solanaClient  *solana.Client
 	pricingEngine *pricing.Engine
+	events        EventPublisher // Optional; nil disables event publishing
+	httpClient    *http.Client   // For low balance webhooks
 	logger        *zap.Logger
 	config        *Config
+
+	lowBalanceMu sync.Mutex
+	lowBalance   map[uuid.UUID]*lowBalanceState // Keyed by session ID
+
+	// Usage updates are buffered and written every billing interval, see usage_buffer.go
+	usageMu        sync.Mutex
+	pendingUsage   map[uuid.UUID]*pendingUsage // Keyed by session ID
+	flushDone      chan struct{}
+	flusherStarted atomic.Bool
+
+	// Closed by Stop to end the usage flusher and the loops started with runEvery
+	stop       chan struct{}
+	stopOnce   sync.Once
+	background sync.WaitGroup
 }
 
 // Config represents billing service configuration
@@ -34,6 +55,13 @@ type Config struct {
 	DailyWithdrawalLimit   decimal.Decimal `yaml:"daily_withdrawal_limit"`
 	MinimumPayoutAmount    decimal.Decimal `yaml:"minimum_payout_amount"`
 	PayoutFeePercent       decimal.Decimal `yaml:"payout_fee_percent"`
+
+	// Low balance notifications
+	LowBalanceEventSubject string `yaml:"low_balance_event_subject"`
+	LowBalanceWebhookURL   string `yaml:"low_balance_webhook_url"`
+
+	// Provider registry, queried for marketplace availability
+	ProviderRegistryURL string `yaml:"provider_registry_url"`
 }
 
 // NewBillingService creates a new billing service
@@ -41,6 +69,7 @@ func NewBillingService(
 	store *store.PostgresStore,
 	solanaClient *solana.Client,
 	pricingEngine *pricing.Engine,
+	events EventPublisher,
 	config *Config,
 	logger *zap.Logger,
 ) *BillingService {
@@ -48,8 +77,15 @@ func NewBillingService(
 		store:         store,
 		solanaClient:  solanaClient,
 		pricingEngine: pricingEngine,
+		events:        events,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
 		config:        config,
 		logger:        logger,
+		lowBalance:    make(map[uuid.UUID]*lowBalanceState),
+
+		pendingUsage: make(map[uuid.UUID]*pendingUsage),
+		flushDone:    make(chan struct{}),
+		stop:         make(chan struct{}),
 	}
 }
 
@@ -64,8 +100,8 @@ func (s *BillingService) CreateWallet(ctx context.Context, req *models.WalletCre
 	)
 
 	// Validate Solana address format
-	if !s.isValidSolanaAddress(req.SolanaAddress) {
-		return nil, models.NewValidationError("solana_address", "invalid Solana address format")
+	if err := solana.ValidateWalletAddress(req.SolanaAddress); err != nil {
+		return nil, models.NewValidationError("solana_address", err.Error())
 	}
 
 	// Check if wallet already exists for this user and type
@@ -110,14 +146,22 @@ func (s *BillingService) GetWalletBalance(ctx context.Context, walletID uuid.UUI
 
 	// Update database balance if there's a significant difference
 	if solanaBalance.Sub(wallet.Balance).Abs().GreaterThan(decimal.NewFromFloat(0.001)) {
-		err = s.store.UpdateWalletBalance(ctx, walletID, solanaBalance, wallet.LockedBalance)
+		updated, err := s.store.UpdateWallet(ctx, walletID, func(w *models.Wallet) error {
+			w.Balance = solanaBalance
+			return nil
+		})
 		if err != nil {
 			s.logger.Warn("Failed to update wallet balance", zap.Error(err))
 		} else {
-			wallet.Balance = solanaBalance
+			wallet = updated
 		}
 	}
 
+	dailySpent, monthlySpent, err := s.walletSpending(ctx, wallet)
+	if err != nil {
+		s.logger.Warn("Failed to get wallet spending", zap.Error(err))
+	}
+
 	return &models.BalanceResponse{
 		WalletID:         wallet.ID,
 		Balance:          wallet.Balance,
@@ -125,6 +169,8 @@ func (s *BillingService) GetWalletBalance(ctx context.Context, walletID uuid.UUI
 		PendingBalance:   wallet.PendingBalance,
 		AvailableBalance: wallet.AvailableBalance(),
 		TotalBalance:     wallet.TotalBalance(),
+		DailySpent:       dailySpent,
+		MonthlySpent:     monthlySpent,
 		LastUpdated:      wallet.UpdatedAt,
 	}, nil
 }
@@ -140,17 +186,30 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 		zap.Uint64("requested_vram_mb", req.RequestedVRAM),
 	)
 
+	// A retried request returns the session the original request created
+	if req.IdempotencyKey != "" {
+		existing, err := s.existingSessionForKey(ctx, req.UserID, req.IdempotencyKey)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+	}
+
 	// Get user wallet
 	userWallet, err := s.store.GetWalletByUserID(ctx, req.UserID, models.WalletTypeUser)
 	if err != nil {
 		return nil, err
 	}
 
+	// Funds reserved for this job at submission count as available; they are
+	// released below as the session locks its own
+	reserved := decimal.Max(req.ReservedAmount, decimal.Zero)
+	available := userWallet.AvailableBalance().Add(reserved)
+
 	// Check minimum balance
-	if userWallet.AvailableBalance().LessThan(s.config.MinimumBalance) {
+	if available.LessThan(s.config.MinimumBalance) {
 		return nil, models.NewInsufficientFundsError(
 			s.config.MinimumBalance.String(),
-			userWallet.AvailableBalance().String(),
+			available.String(),
 		)
 	}
 
@@ -171,23 +230,39 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 	}
 
 	// Check if user can afford at least one hour
-	if userWallet.AvailableBalance().LessThan(pricing.TotalHourlyRate) {
+	if available.LessThan(pricing.TotalHourlyRate) {
 		return nil, models.NewInsufficientFundsError(
 			pricing.TotalHourlyRate.String(),
-			userWallet.AvailableBalance().String(),
+			available.String(),
 		)
 	}
 
-	// Lock funds for initial hour
-	err = userWallet.LockFunds(pricing.TotalHourlyRate)
+	// Lock funds for initial hour, re-checking the balance and enforcing the user's
+	// daily and monthly spending limits under the wallet's row lock, so that concurrent
+	// sessions can't lock the same funds or spend the same allowance
+	userWallet, err = s.store.UpdateWalletWithSpending(ctx, userWallet.ID, func(w *models.Wallet, spentSince store.WalletSpending) error {
+		w.UnlockFunds(reserved)
+		if w.AvailableBalance().LessThan(pricing.TotalHourlyRate) {
+			return models.NewInsufficientFundsError(
+				pricing.TotalHourlyRate.String(),
+				w.AvailableBalance().String(),
+			)
+		}
+		if err := s.checkSpendLimits(w, pricing.TotalHourlyRate, spentSince); err != nil {
+			return err
+		}
+		return w.LockFunds(pricing.TotalHourlyRate)
+	})
 	if err != nil {
-		return nil, err
+		if _, ok := err.(*models.BillingError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock funds: %w", err)
 	}
 
-	// Update wallet in database
-	err = s.store.UpdateWalletBalance(ctx, userWallet.ID, userWallet.Balance, userWallet.LockedBalance)
-	if err != nil {
-		return nil, fmt.Errorf("failed to lock funds: %w", err)
+	var idempotencyKey *string
+	if req.IdempotencyKey != "" {
+		idempotencyKey = &req.IdempotencyKey
 	}
 
 	// Create rental session
@@ -197,6 +272,7 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 		ProviderID:       req.ProviderID,
 		JobID:            req.JobID,
 		Status:           models.SessionStatusActive,
+		IdempotencyKey:   idempotencyKey,
 		GPUModel:         req.GPUModel,
 		AllocatedVRAM:    req.RequestedVRAM,
 		TotalVRAM:        req.RequestedVRAM,       // This should come from provider registry
@@ -211,12 +287,30 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 		TotalCost:        decimal.Zero,
 		PlatformFee:      decimal.Zero,
 		ProviderEarnings: decimal.Zero,
+		LockedAmount:     pricing.TotalHourlyRate,
 		CreatedAt:        time.Now().UTC(),
 		UpdatedAt:        time.Now().UTC(),
 	}
 
 	// Save session to database
 	err = s.store.CreateRentalSession(ctx, session)
+	if errors.Is(err, models.ErrDuplicateIdempotencyKey) {
+		// A concurrent request with the same key won the race; release the funds
+		// locked above, restore the job's reservation (the winner released it too)
+		// and return its session instead
+		if _, err := s.store.UpdateWallet(ctx, userWallet.ID, func(w *models.Wallet) error {
+			w.UnlockFunds(pricing.TotalHourlyRate)
+			w.LockedBalance = w.LockedBalance.Add(reserved)
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to release locked funds: %w", err)
+		}
+		existing, err := s.existingSessionForKey(ctx, req.UserID, req.IdempotencyKey)
+		if err == nil && existing == nil {
+			err = models.ErrSessionNotFound
+		}
+		return existing, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create rental session: %w", err)
 	}
@@ -247,6 +341,7 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 		EstimatedRuntime:    estimatedRuntime,
 	}
 
+	metrics.SessionsStarted.Inc()
 	s.logger.Info("Rental session started successfully",
 		zap.String("session_id", session.ID.String()),
 		zap.String("estimated_runtime_hours", estimatedRuntime.String()),
@@ -255,6 +350,26 @@ func (s *BillingService) StartRentalSession(ctx context.Context, req *models.Ses
 	return response, nil
 }
 
+// existingSessionForKey returns the session the user previously started with the given
+// idempotency key, or nil if there is none. Keys are scoped to the user, so another
+// user's key never returns their session.
+func (s *BillingService) existingSessionForKey(ctx context.Context, userID, key string) (*models.SessionResponse, error) {
+	sessionID, err := s.store.GetRentalSessionIDByIdempotencyKey(ctx, userID, key)
+	if errors.Is(err, models.ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Returning existing rental session for repeated idempotency key",
+		zap.String("session_id", sessionID.String()),
+		zap.String("user_id", userID),
+		zap.String("idempotency_key", key),
+	)
+	return s.GetCurrentUsage(ctx, sessionID)
+}
+
 // ProcessUsageUpdate processes real-time usage data from provider daemon
 func (s *BillingService) ProcessUsageUpdate(ctx context.Context, req *models.UsageUpdateRequest) error {
 	s.logger.Debug("Processing usage update",
@@ -269,25 +384,24 @@ func (s *BillingService) ProcessUsageUpdate(ctx context.Context, req *models.Usa
 		return err
 	}
 
-	// Calculate period cost based on current session rates
-	periodHours := decimal.NewFromInt(1).Div(decimal.NewFromInt(60)) // 1 minute = 1/60 hour
-
-	// Base cost for this period
-	baseCost := session.HourlyRate.Mul(periodHours)
-
-	// VRAM cost for this period
-	vramGB := decimal.NewFromInt(int64(session.AllocatedVRAM)).Div(decimal.NewFromInt(1024))
-	vramCost := session.VRAMRate.Mul(vramGB).Mul(periodHours)
-
-	// Power cost for this period (use actual power if available, otherwise estimated)
-	powerW := decimal.NewFromInt(int64(req.PowerDraw))
-	powerCost := session.PowerRate.Mul(powerW).Div(decimal.NewFromInt(1000)).Mul(periodHours) // Convert W to kW
+	// Paused and ended sessions accrue nothing
+	if session.Status != models.SessionStatusActive {
+		return models.NewBillingError(models.ErrCodeSessionNotActive, "Session is not active", models.ErrSessionNotActive).
+			WithDetail("status", session.Status)
+	}
 
-	periodCost := baseCost.Add(vramCost).Add(powerCost)
+	// Calculate period cost based on current session rates and the reported power draw
+	periodHours := decimal.NewFromInt(1).Div(decimal.NewFromInt(60)) // 1 minute = 1/60 hour
+	periodCost := session.CostForPeriod(periodHours, req.PowerDraw)
 
-	// Create usage record
+	// Create usage record. It is stored under the update's ID, so an update delivered
+	// again is recognised and recorded once.
+	recordID := req.UpdateID
+	if recordID == uuid.Nil {
+		recordID = uuid.New()
+	}
 	usageRecord := &models.UsageRecord{
-		ID:              uuid.New(),
+		ID:              recordID,
 		SessionID:       req.SessionID,
 		RecordedAt:      req.Timestamp,
 		GPUUtilization:  req.GPUUtilization,
@@ -299,24 +413,24 @@ func (s *BillingService) ProcessUsageUpdate(ctx context.Context, req *models.Usa
 		CreatedAt:       time.Now().UTC(),
 	}
 
-	// Save usage record
-	err = s.store.CreateUsageRecord(ctx, usageRecord)
-	if err != nil {
-		return fmt.Errorf("failed to create usage record: %w", err)
+	// The record is buffered and written with the period added to the session total
+	// at the next flush, so the final bill still equals the sum of its usage records.
+	// The funds check sees the usage that hasn't been written yet.
+	actualPower := req.PowerDraw
+	unwrittenCost, lastBilledAt, buffered := s.bufferUsage(*usageRecord, time.Now().UTC())
+	if !buffered {
+		s.logger.Debug("Dropped repeated usage update",
+			zap.String("session_id", req.SessionID.String()),
+			zap.String("update_id", recordID.String()),
+		)
+		return nil
 	}
+	session.ActualPowerW = &actualPower
+	session.TotalCost = session.TotalCost.Add(unwrittenCost)
+	session.LastBilledAt = lastBilledAt
 
-	// Update session with actual power consumption and total cost
-	if session.ActualPowerW == nil || *session.ActualPowerW != req.PowerDraw {
-		actualPower := req.PowerDraw
-		session.ActualPowerW = &actualPower
-		session.TotalCost = session.TotalCost.Add(periodCost)
-		session.UpdatedAt = time.Now().UTC()
-
-		err = s.store.UpdateRentalSession(ctx, session)
-		if err != nil {
-			s.logger.Warn("Failed to update session with actual power", zap.Error(err))
-		}
-	}
+	// Warn on low funds and start the grace period if the next interval can't be paid for
+	s.checkSessionFunds(ctx, session)
 
 	s.logger.Debug("Usage update processed successfully")
 	return nil
@@ -324,90 +438,391 @@ func (s *BillingService) ProcessUsageUpdate(ctx context.Context, req *models.Usa
 
 // Helper methods
 
+// sessionUpdateAttempts bounds how often a session update that lost a race with another
+// update is retried
+const sessionUpdateAttempts = 5
+
+// updateRentalSession reads a session, applies change to it and writes it back. If
+// another update got in between, the read and change are repeated on the new version,
+// so change may run more than once and should only modify the session. An error from
+// change aborts the update and is returned unchanged.
+func (s *BillingService) updateRentalSession(ctx context.Context, sessionID uuid.UUID, change func(session *models.RentalSession) error) (*models.RentalSession, error) {
+	return s.writeRentalSession(ctx, sessionID, change, func(ctx context.Context, session *models.RentalSession) error {
+		err := s.store.UpdateRentalSession(ctx, session)
+		if err != nil && !errors.Is(err, models.ErrSessionConflict) {
+			return fmt.Errorf("failed to update session: %w", err)
+		}
+		return err
+	})
+}
+
+// writeRentalSession is updateRentalSession with the changed session written by write,
+// which must fail with models.ErrSessionConflict if the session changed since it was
+// read. Any other error from write is returned unchanged.
+func (s *BillingService) writeRentalSession(ctx context.Context, sessionID uuid.UUID, change func(session *models.RentalSession) error, write func(ctx context.Context, session *models.RentalSession) error) (*models.RentalSession, error) {
+	for attempt := 1; ; attempt++ {
+		session, err := s.getRentalSession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if err := change(session); err != nil {
+			return nil, err
+		}
+
+		err = write(ctx, session)
+		if err == nil {
+			return session, nil
+		}
+		if !errors.Is(err, models.ErrSessionConflict) {
+			return nil, err
+		}
+		if attempt >= sessionUpdateAttempts {
+			return nil, models.NewBillingError(models.ErrCodeSessionConflict, "Session is being updated concurrently, please retry", err).
+				WithDetail("attempts", attempt)
+		}
+		s.logger.Debug("Session changed while being updated, retrying",
+			zap.String("session_id", sessionID.String()),
+			zap.Int("attempt", attempt))
+	}
+}
+
 // EndRentalSession ends a rental session and processes final billing
 func (s *BillingService) EndRentalSession(ctx context.Context, req *models.SessionEndRequest) (*models.SessionResponse, error) {
 	s.logger.Info("Ending rental session", zap.String("session_id", req.SessionID.String()))
 
-	// Get session
-	session, err := s.store.GetRentalSession(ctx, req.SessionID)
+	session, userWallet, err := s.endRentalSession(ctx, req.SessionID, models.SessionStatusCompleted, false)
+	if errors.Is(err, models.ErrInsufficientFunds) {
+		s.logger.Error("Failed to deduct final session cost", zap.Error(err))
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
+	totalCost := session.TotalCost
 
-	if session.Status != models.SessionStatusActive {
-		return nil, models.NewBillingError(models.ErrCodeSessionNotActive, "Session is not active", models.ErrSessionNotActive)
+	response := &models.SessionResponse{
+		Session:             *session,
+		CurrentCost:         totalCost,
+		EstimatedHourlyCost: decimal.Zero,
+		RemainingBalance:    userWallet.AvailableBalance(),
+		EstimatedRuntime:    decimal.Zero,
 	}
 
-	// Calculate final costs
-	now := time.Now().UTC()
-	session.EndedAt = &now
-	session.Status = models.SessionStatusCompleted
+	metrics.SessionsEnded.WithLabelValues("completed").Inc()
+	metrics.TokensBilled.Add(totalCost.InexactFloat64())
+	s.logger.Info("Rental session ended successfully",
+		zap.String("session_id", session.ID.String()),
+		zap.String("total_cost", totalCost.String()),
+		zap.String("duration", session.Duration().String()),
+	)
+
+	return response, nil
+}
 
-	// Calculate total session cost
-	totalCost := session.CalculateCurrentCost()
-	platformFee := totalCost.Mul(session.PlatformFeeRate).Div(decimal.NewFromInt(100))
-	providerEarnings := totalCost.Sub(platformFee)
+// endRentalSession moves an active or paused session to status and pays for it in one
+// database transaction. The cost is deducted from the user's wallet; if it can't be
+// paid in full, models.ErrInsufficientFunds is returned and the session stays open,
+// unless collectAvailable is set, in which case the user's available funds are taken
+// and the rest is recorded on the session as unpaid_cost.
+func (s *BillingService) endRentalSession(ctx context.Context, sessionID uuid.UUID, status models.SessionStatus, collectAvailable bool) (*models.RentalSession, *models.Wallet, error) {
+	var unlocked decimal.Decimal
+	var userWallet *models.Wallet
+	end := func(session *models.RentalSession) error {
+		if session.Status != models.SessionStatusActive && session.Status != models.SessionStatusPaused {
+			return models.NewBillingError(models.ErrCodeSessionNotActive, "Session is not active", models.ErrSessionNotActive)
+		}
 
-	session.TotalCost = totalCost
-	session.PlatformFee = platformFee
-	session.ProviderEarnings = providerEarnings
-	session.UpdatedAt = now
+		// A paused session's locked funds were already released when it was paused
+		unlocked = decimal.Zero
+		if session.Status == models.SessionStatusActive {
+			unlocked = session.LockedAmount
+		}
 
-	// Update session in database
-	err = s.store.UpdateRentalSession(ctx, session)
+		// Calculate final costs
+		now := time.Now().UTC()
+		if session.PausedAt != nil {
+			// Ending a paused session closes the pause; it is not billed
+			session.PausedSeconds += int64(now.Sub(*session.PausedAt).Seconds())
+			session.PausedAt = nil
+			session.LastBilledAt = now
+		}
+		session.EndedAt = &now
+		session.Status = status
+
+		// Calculate total session cost
+		session.TotalCost = session.CalculateCurrentCost()
+		session.PlatformFee = session.TotalCost.Mul(session.PlatformFeeRate).Div(decimal.NewFromInt(100))
+		session.ProviderEarnings = session.TotalCost.Sub(session.PlatformFee)
+		session.UpdatedAt = now
+		return nil
+	}
+	pay := func(ctx context.Context, session *models.RentalSession) error {
+		wallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
+		if err != nil {
+			return err
+		}
+
+		txnReq := &models.TransactionCreateRequest{
+			FromWalletID: &wallet.ID,
+			Type:         models.TransactionTypeSessionEnd,
+			Amount:       session.TotalCost,
+			Description:  fmt.Sprintf("Session end - final payment for %s", session.GPUModel),
+			SessionID:    &session.ID,
+		}
+
+		// Unlock the funds locked for this session, leaving those of the user's other
+		// sessions and pending withdrawals, and deduct the actual cost
+		settle := func(w *models.Wallet) error {
+			w.UnlockFunds(unlocked)
+			charged := session.TotalCost
+			if collectAvailable && w.AvailableBalance().LessThan(charged) {
+				charged = decimal.Max(w.AvailableBalance(), decimal.Zero)
+				unpaid := session.TotalCost.Sub(charged)
+				if session.Metadata == nil {
+					session.Metadata = make(map[string]interface{})
+				}
+				session.Metadata["unpaid_cost"] = unpaid.String()
+				txnReq.Amount = charged
+				txnReq.Metadata = map[string]interface{}{"unpaid_cost": unpaid.String()}
+			}
+			if err := w.DeductFunds(charged); err != nil {
+				return models.NewInsufficientFundsError(charged.String(), w.Balance.String())
+			}
+			return nil
+		}
+		userWallet, err = s.store.EndRentalSession(ctx, session, wallet.ID, settle, txnReq)
+		return err
+	}
+
+	session, err := s.writeRentalSession(ctx, sessionID, end, pay)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update session: %w", err)
+		return nil, nil, err
 	}
+	s.clearLowBalanceState(ctx, session.ID)
+	return session, userWallet, nil
+}
 
-	// Get user wallet to process final payment
-	userWallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
+// RefundSession cancels a session whose job failed before doing any useful work, so
+// that the user isn't charged for it. Funds locked for an open session are released;
+// if the session was already ended, what the user actually paid for it is given back
+// with a refund transaction, which may be less than its cost if it ended unpaid.
+// Provider earnings and platform fees are counted from completed sessions, so
+// cancelling the session takes back its provider's share and the platform's fee; a
+// provider that was already paid it out has it deducted from later earnings. All of
+// it is written in one database transaction.
+func (s *BillingService) RefundSession(ctx context.Context, sessionID uuid.UUID, reason string) (*models.SessionResponse, error) {
+	s.logger.Info("Refunding rental session",
+		zap.String("session_id", sessionID.String()),
+		zap.String("reason", reason),
+	)
+
+	var unlocked, refunded decimal.Decimal
+	var userWallet *models.Wallet
+	cancel := func(session *models.RentalSession) error {
+		unlocked = decimal.Zero
+		switch session.Status {
+		case models.SessionStatusActive:
+			unlocked = session.LockedAmount
+		case models.SessionStatusPaused:
+			// Locked funds were released when the session was paused and nothing has been deducted
+		case models.SessionStatusCompleted, models.SessionStatusTerminated:
+			// Paid when the session ended, refunded from its payments below
+		default:
+			return models.NewBillingError(models.ErrCodeInvalidSessionStatus, "Session cannot be refunded", models.ErrInvalidSessionStatus).
+				WithDetail("status", session.Status)
+		}
+
+		if session.ProviderEarnings.IsPositive() || session.PlatformFee.IsPositive() {
+			if session.Metadata == nil {
+				session.Metadata = make(map[string]interface{})
+			}
+			session.Metadata["reversed_provider_earnings"] = session.ProviderEarnings.String()
+			session.Metadata["reversed_platform_fee"] = session.PlatformFee.String()
+		}
+
+		now := time.Now().UTC()
+		if session.EndedAt == nil {
+			session.EndedAt = &now
+		}
+		session.PausedAt = nil
+		session.Status = models.SessionStatusCancelled
+		session.TotalCost = decimal.Zero
+		session.PlatformFee = decimal.Zero
+		session.ProviderEarnings = decimal.Zero
+		session.UpdatedAt = now
+		return nil
+	}
+	refund := func(ctx context.Context, session *models.RentalSession) error {
+		wallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
+		if err != nil {
+			return err
+		}
+
+		// Reverses the session payment; the amount is what was paid
+		txnReq := &models.TransactionCreateRequest{
+			ToWalletID:  &wallet.ID,
+			Type:        models.TransactionTypeRefund,
+			Description: fmt.Sprintf("Refund for %s session - job failed during setup", session.GPUModel),
+			SessionID:   &session.ID,
+			JobID:       session.JobID,
+			Metadata:    map[string]interface{}{"reason": reason},
+		}
+		userWallet, refunded, err = s.store.RefundRentalSession(ctx, session, wallet.ID, unlocked, txnReq)
+		return err
+	}
+
+	session, err := s.writeRentalSession(ctx, sessionID, cancel, refund)
+	if err != nil {
+		return nil, err
+	}
+	s.clearLowBalanceState(ctx, session.ID)
+
+	metrics.SessionsEnded.WithLabelValues("refunded").Inc()
+	s.logger.Info("Rental session refunded",
+		zap.String("session_id", session.ID.String()),
+		zap.String("unlocked", unlocked.String()),
+		zap.String("refunded", refunded.String()),
+	)
+
+	return &models.SessionResponse{
+		Session:             *session,
+		CurrentCost:         decimal.Zero,
+		EstimatedHourlyCost: decimal.Zero,
+		RemainingBalance:    userWallet.AvailableBalance(),
+		EstimatedRuntime:    decimal.Zero,
+	}, nil
+}
+
+// PauseRentalSession stops billing for an active session. The cost accrued so far is
+// finalized and the session's locked funds are released until it is resumed.
+func (s *BillingService) PauseRentalSession(ctx context.Context, req *models.SessionPauseRequest) (*models.SessionResponse, error) {
+	s.logger.Info("Pausing rental session",
+		zap.String("session_id", req.SessionID.String()),
+		zap.String("reason", req.Reason),
+	)
+
+	session, err := s.updateRentalSession(ctx, req.SessionID, func(session *models.RentalSession) error {
+		if session.Status != models.SessionStatusActive {
+			return models.NewBillingError(models.ErrCodeSessionNotActive, "Only active sessions can be paused", models.ErrSessionNotActive).
+				WithDetail("status", session.Status)
+		}
+
+		now := time.Now().UTC()
+		session.TotalCost = session.CalculateCurrentCost()
+		session.LastBilledAt = now
+		session.PausedAt = &now
+		session.Status = models.SessionStatusPaused
+		session.UpdatedAt = now
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	// Nothing accrues while paused, so there is nothing to run out of funds for
+	s.clearLowBalanceState(ctx, session.ID)
 
-	// Unlock any remaining locked funds and deduct actual cost
-	userWallet.UnlockFunds(userWallet.LockedBalance)
-	err = userWallet.DeductFunds(totalCost)
+	userWallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
 	if err != nil {
-		s.logger.Error("Failed to deduct final session cost", zap.Error(err))
 		return nil, err
 	}
 
-	// Update wallet balance
-	err = s.store.UpdateWalletBalance(ctx, userWallet.ID, userWallet.Balance, userWallet.LockedBalance)
+	// Release the session's locked funds while it is paused
+	if session.LockedAmount.GreaterThan(decimal.Zero) {
+		if _, err := s.store.UpdateWallet(ctx, userWallet.ID, func(w *models.Wallet) error {
+			w.UnlockFunds(session.LockedAmount)
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to unlock funds: %w", err)
+		}
+	}
+
+	s.logger.Info("Rental session paused",
+		zap.String("session_id", session.ID.String()),
+		zap.String("accrued_cost", session.TotalCost.String()),
+	)
+
+	return s.GetCurrentUsage(ctx, session.ID)
+}
+
+// ResumeRentalSession re-locks funds for a paused session and continues billing it.
+func (s *BillingService) ResumeRentalSession(ctx context.Context, req *models.SessionResumeRequest) (*models.SessionResponse, error) {
+	s.logger.Info("Resuming rental session", zap.String("session_id", req.SessionID.String()))
+
+	session, err := s.getRentalSession(ctx, req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+		return nil, err
 	}
 
-	// Create final transaction
-	txnReq := &models.TransactionCreateRequest{
-		FromWalletID: &userWallet.ID,
-		Type:         models.TransactionTypeSessionEnd,
-		Amount:       totalCost,
-		Description:  fmt.Sprintf("Session end - final payment for %s", session.GPUModel),
-		SessionID:    &session.ID,
+	if session.Status != models.SessionStatusPaused || session.PausedAt == nil {
+		return nil, models.NewBillingError(models.ErrCodeSessionNotPaused, "Session is not paused", models.ErrSessionNotPaused).
+			WithDetail("status", session.Status)
 	}
 
-	_, err = s.store.CreateTransaction(ctx, txnReq)
+	userWallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
 	if err != nil {
-		s.logger.Error("Failed to create final transaction", zap.Error(err))
+		return nil, err
 	}
 
-	response := &models.SessionResponse{
-		Session:             *session,
-		CurrentCost:         totalCost,
-		EstimatedHourlyCost: decimal.Zero,
-		RemainingBalance:    userWallet.AvailableBalance(),
-		EstimatedRuntime:    decimal.Zero,
+	// Re-lock the same amount that was locked when the session started, within the
+	// user's spending limits
+	if session.LockedAmount.GreaterThan(decimal.Zero) {
+		_, err := s.store.UpdateWalletWithSpending(ctx, userWallet.ID, func(w *models.Wallet, spentSince store.WalletSpending) error {
+			if w.AvailableBalance().LessThan(session.LockedAmount) {
+				return models.NewInsufficientFundsError(
+					session.LockedAmount.String(),
+					w.AvailableBalance().String(),
+				)
+			}
+			if err := s.checkSpendLimits(w, session.LockedAmount, spentSince); err != nil {
+				return err
+			}
+			return w.LockFunds(session.LockedAmount)
+		})
+		if err != nil {
+			if _, ok := err.(*models.BillingError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to lock funds: %w", err)
+		}
 	}
 
-	s.logger.Info("Rental session ended successfully",
+	// Should the session be resumed or ended in the meantime, the funds just locked
+	// are released again
+	lockedAmount := session.LockedAmount
+	session, err = s.updateRentalSession(ctx, req.SessionID, func(session *models.RentalSession) error {
+		if session.Status != models.SessionStatusPaused || session.PausedAt == nil {
+			return models.NewBillingError(models.ErrCodeSessionNotPaused, "Session is not paused", models.ErrSessionNotPaused).
+				WithDetail("status", session.Status)
+		}
+
+		now := time.Now().UTC()
+		session.PausedSeconds += int64(now.Sub(*session.PausedAt).Seconds())
+		session.PausedAt = nil
+		session.LastBilledAt = now
+		session.Status = models.SessionStatusActive
+		session.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if lockedAmount.GreaterThan(decimal.Zero) {
+			if _, unlockErr := s.store.UpdateWallet(ctx, userWallet.ID, func(w *models.Wallet) error {
+				w.UnlockFunds(lockedAmount)
+				return nil
+			}); unlockErr != nil {
+				s.logger.Error("Failed to release funds locked for a session that wasn't resumed",
+					zap.String("session_id", req.SessionID.String()),
+					zap.Error(unlockErr))
+			}
+		}
+		return nil, err
+	}
+
+	s.logger.Info("Rental session resumed",
 		zap.String("session_id", session.ID.String()),
-		zap.String("total_cost", totalCost.String()),
-		zap.String("duration", session.Duration().String()),
+		zap.Int64("paused_seconds_total", session.PausedSeconds),
 	)
 
-	return response, nil
+	return s.GetCurrentUsage(ctx, session.ID)
 }
 
 // GetCurrentUsage gets current usage and cost for an active session
@@ -416,6 +831,7 @@ func (s *BillingService) GetCurrentUsage(ctx context.Context, sessionID uuid.UUI
 	if err != nil {
 		return nil, err
 	}
+	s.applyPendingUsage(session)
 
 	currentCost := session.CalculateCurrentCost()
 
@@ -460,6 +876,16 @@ func (s *BillingService) GetProviderEarnings(ctx context.Context, req *models.Pr
 	return s.store.GetProviderEarnings(ctx, req)
 }
 
+// GetStats returns the platform-wide totals exported as metrics
+func (s *BillingService) GetStats(ctx context.Context) (*models.BillingStats, error) {
+	return s.store.GetBillingStats(ctx)
+}
+
+// GetPlatformFees summarizes the fees the platform has collected
+func (s *BillingService) GetPlatformFees(ctx context.Context, since *time.Time) (*models.PlatformFeesResponse, error) {
+	return s.store.GetPlatformFees(ctx, since)
+}
+
 // ProcessDeposit processes a dGPU token deposit
 func (s *BillingService) ProcessDeposit(ctx context.Context, req *models.DepositRequest) (*models.Transaction, error) {
 	s.logger.Info("Processing deposit",
@@ -480,35 +906,24 @@ func (s *BillingService) ProcessDeposit(ctx context.Context, req *models.Deposit
 		return nil, err
 	}
 
-	// Add funds to wallet
-	wallet.AddFunds(req.Amount)
-
-	// Update wallet balance
-	err = s.store.UpdateWalletBalance(ctx, wallet.ID, wallet.Balance, wallet.LockedBalance)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
-	}
-
-	// Create transaction record
-	txnReq := &models.TransactionCreateRequest{
-		ToWalletID:  &wallet.ID,
-		Type:        models.TransactionTypeDeposit,
-		Amount:      req.Amount,
-		Description: "dGPU token deposit",
-		Metadata: map[string]interface{}{
-			"solana_signature": req.SolanaSignature,
-		},
-	}
-
-	transaction, err := s.store.CreateTransaction(ctx, txnReq)
+	// Record the deposit and credit the wallet together, once per signature
+	transaction, duplicate, err := s.store.CreditDeposit(ctx, wallet.ID, req.Amount, req.SolanaSignature, map[string]interface{}{
+		"solana_signature": req.SolanaSignature,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction: %w", err)
+		return nil, fmt.Errorf("failed to credit deposit: %w", err)
 	}
 
-	// Update transaction with confirmed status
-	err = s.store.UpdateTransactionStatus(ctx, transaction.ID, models.TransactionStatusConfirmed, &req.SolanaSignature)
-	if err != nil {
-		s.logger.Warn("Failed to update transaction status", zap.Error(err))
+	if duplicate {
+		if transaction.ToWalletID == nil || *transaction.ToWalletID != wallet.ID {
+			return nil, models.NewValidationError("solana_signature", "already deposited to another wallet")
+		}
+		s.logger.Info("Deposit already processed, returning existing transaction",
+			zap.String("wallet_id", wallet.ID.String()),
+			zap.String("transaction_id", transaction.ID.String()),
+			zap.String("signature", req.SolanaSignature),
+		)
+		return transaction, nil
 	}
 
 	s.logger.Info("Deposit processed successfully",
@@ -527,22 +942,37 @@ func (s *BillingService) ProcessWithdrawal(ctx context.Context, req *models.With
 		zap.String("to_address", req.ToAddress),
 	)
 
+	// Validate destination address before anything is recorded
+	if err := solana.ValidateWalletAddress(req.ToAddress); err != nil {
+		return nil, models.NewValidationError("to_address", err.Error())
+	}
+
 	// Get wallet
 	wallet, err := s.store.GetWallet(ctx, req.WalletID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if wallet has sufficient funds
-	if !wallet.CanSpend(req.Amount) {
-		return nil, models.NewInsufficientFundsError(req.Amount.String(), wallet.AvailableBalance().String())
-	}
-
 	// Check daily withdrawal limit
 	if req.Amount.GreaterThan(s.config.DailyWithdrawalLimit) {
 		return nil, models.NewValidationError("amount", "exceeds daily withdrawal limit")
 	}
 
+	// Reserve the amount under the wallet's row lock so that concurrent withdrawals and
+	// sessions can't spend the same funds while the transfer is in flight
+	_, err = s.store.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+		if !w.CanSpend(req.Amount) {
+			return models.NewInsufficientFundsError(req.Amount.String(), w.AvailableBalance().String())
+		}
+		return w.LockFunds(req.Amount)
+	})
+	if err != nil {
+		if _, ok := err.(*models.BillingError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to reserve withdrawal funds: %w", err)
+	}
+
 	// Create transaction record first
 	txnReq := &models.TransactionCreateRequest{
 		FromWalletID: &wallet.ID,
@@ -556,36 +986,30 @@ func (s *BillingService) ProcessWithdrawal(ctx context.Context, req *models.With
 
 	transaction, err := s.store.CreateTransaction(ctx, txnReq)
 	if err != nil {
+		s.releaseWithdrawal(ctx, wallet.ID, req.Amount)
 		return nil, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
 	// Execute Solana transfer
 	signature, err := s.solanaClient.TransferTokens(ctx, wallet.SolanaAddress, req.ToAddress, req.Amount)
-	if err != nil {
-		// Update transaction as failed
-		s.store.UpdateTransactionStatus(ctx, transaction.ID, models.TransactionStatusFailed, nil)
-		return nil, models.NewSolanaError("transfer_tokens", err)
-	}
-
-	// Deduct funds from wallet
-	err = wallet.DeductFunds(req.Amount)
-	if err != nil {
-		s.logger.Error("Failed to deduct funds after successful transfer", zap.Error(err))
-		return nil, err
+	var pending *solana.PendingTransferError
+	if errors.As(err, &pending) {
+		// The transfer may still land, so the funds stay reserved until the transfer
+		// reconciler finds out whether it did
+		s.markTransferPending(transaction, pending)
+		return transaction, nil
 	}
-
-	// Update wallet balance
-	err = s.store.UpdateWalletBalance(ctx, wallet.ID, wallet.Balance, wallet.LockedBalance)
 	if err != nil {
-		s.logger.Error("Failed to update wallet balance after withdrawal", zap.Error(err))
-		return nil, err
+		// Nothing was transferred
+		s.settleWithdrawal(ctx, transaction, models.TransactionStatusFailed)
+		return nil, models.NewSolanaError("transfer_tokens", err)
 	}
 
-	// Update transaction with confirmed status and signature
-	err = s.store.UpdateTransactionStatus(ctx, transaction.ID, models.TransactionStatusConfirmed, &signature)
-	if err != nil {
-		s.logger.Warn("Failed to update transaction status", zap.Error(err))
+	transaction.SolanaSignature = &signature
+	if !s.settleWithdrawal(ctx, transaction, models.TransactionStatusConfirmed) {
+		return nil, fmt.Errorf("withdrawal %s was transferred but not settled", transaction.ID)
 	}
+	transaction.Status = models.TransactionStatusConfirmed
 
 	s.logger.Info("Withdrawal processed successfully",
 		zap.String("wallet_id", wallet.ID.String()),
@@ -596,42 +1020,28 @@ func (s *BillingService) ProcessWithdrawal(ctx context.Context, req *models.With
 	return transaction, nil
 }
 
+// releaseWithdrawal unlocks funds reserved for a withdrawal that didn't go through
+func (s *BillingService) releaseWithdrawal(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal) {
+	_, err := s.store.UpdateWallet(ctx, walletID, func(w *models.Wallet) error {
+		w.UnlockFunds(amount)
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to release reserved withdrawal funds",
+			zap.String("wallet_id", walletID.String()),
+			zap.String("amount", amount.String()),
+			zap.Error(err),
+		)
+	}
+}
+
 // GetTransactionHistory retrieves transaction history for a wallet
 func (s *BillingService) GetTransactionHistory(ctx context.Context, req *models.TransactionHistoryRequest) (*models.TransactionHistoryResponse, error) {
-	// This would need to be implemented in the store
-	// For now, return empty response
-	return &models.TransactionHistoryResponse{
-		Transactions: []models.Transaction{},
-		Total:        0,
-		Limit:        req.Limit,
-		Offset:       req.Offset,
-	}, nil
+	return s.store.GetTransactionHistory(ctx, req)
 }
 
 // CalculatePricing calculates pricing for GPU rental requirements
-func (s *BillingService) CalculatePricing(ctx context.Context, req interface{}) (*pricing.PricingResponse, error) {
-	// Convert the interface{} to proper pricing request
-	pricingReq := &pricing.PricingRequest{}
-
-	// This is a simplified conversion - in production, use proper type assertion or JSON marshaling
-	if reqMap, ok := req.(map[string]interface{}); ok {
-		if gpuModel, ok := reqMap["gpu_model"].(string); ok {
-			pricingReq.GPUModel = gpuModel
-		}
-		if requestedVRAM, ok := reqMap["requested_vram_mb"].(uint64); ok {
-			pricingReq.RequestedVRAM = requestedVRAM
-		}
-		if totalVRAM, ok := reqMap["total_vram_mb"].(uint64); ok {
-			pricingReq.TotalVRAM = totalVRAM
-		}
-		if estimatedPowerW, ok := reqMap["estimated_power_w"].(uint32); ok {
-			pricingReq.EstimatedPowerW = estimatedPowerW
-		}
-		if durationHours, ok := reqMap["duration_hours"].(decimal.Decimal); ok {
-			pricingReq.DurationHours = durationHours
-		}
-	}
-
+func (s *BillingService) CalculatePricing(ctx context.Context, pricingReq *pricing.PricingRequest) (*pricing.PricingResponse, error) {
 	// Set defaults if not provided
 	if pricingReq.TotalVRAM == 0 {
 		pricingReq.TotalVRAM = pricingReq.RequestedVRAM
@@ -664,9 +1074,3 @@ func (s *BillingService) GetPricingRates(ctx context.Context) (map[string]interf
 
 	return response, nil
 }
-
-// isValidSolanaAddress validates a Solana address format
-func (s *BillingService) isValidSolanaAddress(address string) bool {
-	// Basic validation - in production, use proper Solana address validation
-	return len(address) >= 32 && len(address) <= 44
-}
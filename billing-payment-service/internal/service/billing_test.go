@@ -0,0 +1,437 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// lockFunds locks amount of a wallet's balance, as a session start or withdrawal would
+func (e *testEnv) lockFunds(t *testing.T, walletID uuid.UUID, amount int64) {
+	t.Helper()
+	_, err := e.store.UpdateWallet(context.Background(), walletID, func(w *models.Wallet) error {
+		return w.LockFunds(decimal.NewFromInt(amount))
+	})
+	if err != nil {
+		t.Fatalf("failed to lock funds: %v", err)
+	}
+}
+
+func TestEndRentalSessionUnlocksOnlyItsFunds(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+
+	// Two active sessions lock 10 each and a pending withdrawal locks 5; the paused
+	// session's 10 were released when it was paused
+	active := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	paused := env.createSession(t, userID, uuid.New(), models.SessionStatusPaused, decimal.Zero, decimal.NewFromInt(10))
+	env.lockFunds(t, wallet.ID, 25)
+
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: active.ID}); err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+	if locked := env.wallet(t, wallet.ID).LockedBalance; !locked.Equal(decimal.NewFromInt(15)) {
+		t.Errorf("locked balance after ending an active session = %s, want 15", locked)
+	}
+
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: paused.ID}); err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+	if locked := env.wallet(t, wallet.ID).LockedBalance; !locked.Equal(decimal.NewFromInt(15)) {
+		t.Errorf("locked balance after ending a paused session = %s, want 15", locked)
+	}
+}
+
+// setSessionCost makes a session's cost so far cost, with nothing accruing from now on
+func (e *testEnv) setSessionCost(t *testing.T, sessionID uuid.UUID, cost int64) {
+	t.Helper()
+	_, err := e.db.Exec(context.Background(),
+		`UPDATE rental_sessions SET total_cost = $2, hourly_rate = 0, vram_rate = 0, power_rate = 0 WHERE id = $1`,
+		sessionID, decimal.NewFromInt(cost))
+	if err != nil {
+		t.Fatalf("failed to set session cost: %v", err)
+	}
+}
+
+func TestEndRentalSessionConcurrent(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+
+	var sessions []*models.RentalSession
+	for _, cost := range []int64{20, 10, 5} {
+		session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+		env.setSessionCost(t, session.ID, cost)
+		sessions = append(sessions, session)
+	}
+	env.lockFunds(t, wallet.ID, 30)
+
+	// Every session is ended several times at once, racing the others for the wallet
+	const enders = 4
+	ended := make([]int, len(sessions))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		for n := 0; n < enders; n++ {
+			wg.Add(1)
+			go func(i int, sessionID uuid.UUID) {
+				defer wg.Done()
+				if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: sessionID}); err == nil {
+					mu.Lock()
+					ended[i]++
+					mu.Unlock()
+				}
+			}(i, session.ID)
+		}
+	}
+	wg.Wait()
+
+	for i, session := range sessions {
+		if ended[i] != 1 {
+			t.Errorf("session %d ended %d times, want once", i, ended[i])
+		}
+		var payments int
+		err := env.db.QueryRow(ctx, `SELECT COUNT(*) FROM transactions WHERE session_id = $1 AND type = $2`,
+			session.ID, models.TransactionTypeSessionEnd).Scan(&payments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payments != 1 {
+			t.Errorf("session %d has %d final payments, want 1", i, payments)
+		}
+	}
+	assertBalances(t, env, wallet.ID, 65, 0)
+}
+
+func TestEndRentalSessionInsufficientFundsLeavesSessionOpen(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(10))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.setSessionCost(t, session.ID, 20)
+	env.lockFunds(t, wallet.ID, 10)
+
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: session.ID}); err == nil {
+		t.Fatal("session that can't be paid for ended")
+	}
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.SessionStatusActive {
+		t.Errorf("session is %s after its payment failed, want active", stored.Status)
+	}
+	assertBalances(t, env, wallet.ID, 10, 10)
+}
+
+// streamUsage reports and writes usage for a session continuously, as its provider and
+// the usage flusher would, until the returned function is first called
+func (e *testEnv) streamUsage(sessionID uuid.UUID) (stop func()) {
+	ctx := context.Background()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// Paused sessions refuse usage
+			e.service.ProcessUsageUpdate(ctx, &models.UsageUpdateRequest{
+				UpdateID:  uuid.New(),
+				SessionID: sessionID,
+				PowerDraw: 300,
+				Timestamp: time.Now().UTC(),
+			})
+			e.service.FlushUsage(ctx)
+			time.Sleep(time.Millisecond) // Leaves the session updates room to retry
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}
+}
+
+func TestSessionUpdatesKeepUsageCost(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(1000))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.lockFunds(t, wallet.ID, 10)
+
+	stopUsage := env.streamUsage(session.ID)
+	defer stopUsage()
+	const cycles = 10
+	for i := 0; i < cycles; i++ {
+		if _, err := env.service.PauseRentalSession(ctx, &models.SessionPauseRequest{SessionID: session.ID}); err != nil {
+			t.Fatalf("pause %d: %v", i+1, err)
+		}
+		if _, err := env.service.ResumeRentalSession(ctx, &models.SessionResumeRequest{SessionID: session.ID}); err != nil {
+			t.Fatalf("resume %d: %v", i+1, err)
+		}
+	}
+	stopUsage()
+
+	records, err := env.store.GetUsageRecordsBySession(ctx, session.ID, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatal("no usage was written alongside the session updates")
+	}
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pausing bills the time since the last usage on top, so the total is never less
+	usageCost := decimal.Zero
+	for _, record := range records {
+		usageCost = usageCost.Add(record.PeriodCost)
+	}
+	if stored.TotalCost.LessThan(usageCost) {
+		t.Errorf("total cost %s after %d pauses and resumes is less than its %d usage records' %s", stored.TotalCost, cycles, len(records), usageCost)
+	}
+}
+
+func TestPauseRentalSessionConcurrent(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.lockFunds(t, wallet.ID, 10)
+
+	const pausers = 4
+	var paused int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for n := 0; n < pausers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := env.service.PauseRentalSession(ctx, &models.SessionPauseRequest{SessionID: session.ID}); err == nil {
+				mu.Lock()
+				paused++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if paused != 1 {
+		t.Errorf("session paused %d times, want once", paused)
+	}
+	// The session's funds are released once
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+func TestRefundSessionReleasesLockedFunds(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.lockFunds(t, wallet.ID, 10)
+
+	resp, err := env.service.RefundSession(ctx, session.ID, "image pull failed")
+	if err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	if resp.Session.Status != models.SessionStatusCancelled || !resp.Session.TotalCost.IsZero() {
+		t.Errorf("session %s costing %s, want cancelled at no cost", resp.Session.Status, resp.Session.TotalCost)
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+func TestRefundSessionReversesPayment(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.setSessionCost(t, session.ID, 15)
+	env.lockFunds(t, wallet.ID, 10)
+
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 85, 0)
+
+	if _, err := env.service.RefundSession(ctx, session.ID, "container failed to start"); err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+
+	if refunds, refunded := env.refundTransactions(t, session.ID); refunds != 1 || !refunded.Equal(decimal.NewFromInt(15)) {
+		t.Errorf("%d refund transactions for %s, want one for 15", refunds, refunded)
+	}
+}
+
+func TestRefundSessionOnce(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.Zero)
+	env.setSessionCost(t, session.ID, 20)
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+
+	if _, err := env.service.RefundSession(ctx, session.ID, "setup failed"); err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	if _, err := env.service.RefundSession(ctx, session.ID, "setup failed"); !errors.Is(err, models.ErrInvalidSessionStatus) {
+		t.Errorf("second refund returned %v, want ErrInvalidSessionStatus", err)
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+// refundTransactions returns the number and total of the session's refund transactions
+func (e *testEnv) refundTransactions(t *testing.T, sessionID uuid.UUID) (int, decimal.Decimal) {
+	t.Helper()
+	var refunds int
+	var refunded decimal.Decimal
+	err := e.db.QueryRow(context.Background(), `SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM transactions WHERE session_id = $1 AND type = $2`,
+		sessionID, models.TransactionTypeRefund).Scan(&refunds, &refunded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refunds, refunded
+}
+
+func TestRefundUnderfundedTerminatedSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(10))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.NewFromInt(10))
+	env.lockFunds(t, wallet.ID, 10)
+	env.setSessionCost(t, session.ID, 25)
+
+	// Terminated for lack of funds: 10 is collected and 15 left unpaid
+	if _, _, err := env.service.endRentalSession(ctx, session.ID, models.SessionStatusTerminated, true); err != nil {
+		t.Fatalf("endRentalSession: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 0, 0)
+
+	// Only what was collected is refunded
+	if _, err := env.service.RefundSession(ctx, session.ID, "setup failed"); err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 10, 0)
+	if refunds, refunded := env.refundTransactions(t, session.ID); refunds != 1 || !refunded.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("%d refund transactions for %s, want one for 10", refunds, refunded)
+	}
+}
+
+func TestRefundSessionReversesProviderEarnings(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	providerID := uuid.New()
+	env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	session := env.createSession(t, userID, providerID, models.SessionStatusActive, decimal.Zero, decimal.Zero)
+	env.setSessionCost(t, session.ID, 20)
+	if _, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: session.ID}); err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+	// 10% platform fee
+	if earned, err := env.store.GetProviderEarnedTotal(ctx, providerID); err != nil || !earned.Equal(decimal.NewFromInt(18)) {
+		t.Fatalf("provider earned %s, %v before the refund; want 18", earned, err)
+	}
+
+	resp, err := env.service.RefundSession(ctx, session.ID, "setup failed")
+	if err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	if earned, err := env.store.GetProviderEarnedTotal(ctx, providerID); err != nil || !earned.IsZero() {
+		t.Errorf("provider earned %s, %v after the refund; want 0", earned, err)
+	}
+	if !resp.Session.PlatformFee.IsZero() || resp.Session.Metadata["reversed_platform_fee"] != "2" || resp.Session.Metadata["reversed_provider_earnings"] != "18" {
+		t.Errorf("refunded session's platform fee %s, metadata %v; want the fee and earnings reversed", resp.Session.PlatformFee, resp.Session.Metadata)
+	}
+}
+
+func TestRefundPausedSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	// Its locked funds were released when it was paused
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusPaused, decimal.Zero, decimal.NewFromInt(10))
+
+	if _, err := env.service.RefundSession(ctx, session.ID, "setup failed"); err != nil {
+		t.Fatalf("RefundSession: %v", err)
+	}
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.SessionStatusCancelled || stored.PausedAt != nil {
+		t.Errorf("session %s, paused at %v; want cancelled", stored.Status, stored.PausedAt)
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+func TestEndRentalSessionBillsUsageRecords(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(1000))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.Zero)
+	_, err := env.db.Exec(ctx, `UPDATE rental_sessions SET vram_rate = 0.05, power_rate = 0.3 WHERE id = $1`, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, power := range []uint32{250, 300, 450, 400, 350} {
+		err := env.service.ProcessUsageUpdate(ctx, &models.UsageUpdateRequest{
+			UpdateID:  uuid.New(),
+			SessionID: session.ID,
+			PowerDraw: power,
+			Timestamp: time.Now().UTC().Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("ProcessUsageUpdate: %v", err)
+		}
+	}
+	if err := env.service.FlushUsage(ctx); err != nil {
+		t.Fatalf("FlushUsage: %v", err)
+	}
+
+	ended, err := env.service.EndRentalSession(ctx, &models.SessionEndRequest{SessionID: session.ID})
+	if err != nil {
+		t.Fatalf("EndRentalSession: %v", err)
+	}
+	var records decimal.Decimal
+	err = env.db.QueryRow(ctx, `SELECT COALESCE(SUM(period_cost), 0) FROM usage_records WHERE session_id = $1`, session.ID).Scan(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records.IsZero() {
+		t.Fatal("no usage was recorded")
+	}
+	// Only the moment between the last flush and the end is billed on top of the records
+	if diff := ended.Session.TotalCost.Sub(records).Abs(); diff.GreaterThan(decimal.NewFromFloat(0.001)) {
+		t.Errorf("final cost %s, want the usage records' %s", ended.Session.TotalCost, records)
+	}
+}
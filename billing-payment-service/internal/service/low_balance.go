@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/metrics"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+const (
+	// defaultInsufficientFundsGrace applies when no grace period is configured
+	defaultInsufficientFundsGrace = 5 * time.Minute
+
+	// defaultLowBalanceEventSubject applies when no event subject is configured
+	defaultLowBalanceEventSubject = "dante.billing.sessions.low_balance"
+
+	// taskCancelSubjectFormat is the subject provider daemons listen on to stop a job
+	taskCancelSubjectFormat = "task.cancel.%s"
+
+	// graceSweepInterval is how often sessions whose grace period ran out are looked for
+	graceSweepInterval = 15 * time.Second
+)
+
+// Low balance event types
+const (
+	LowBalanceEventWarning           = "low_balance"
+	LowBalanceEventInsufficientFunds = "insufficient_funds"
+	LowBalanceEventFundsRestored     = "funds_restored"
+	LowBalanceEventTerminated        = "session_terminated"
+)
+
+// EventPublisher publishes messages to the platform message bus. It is satisfied by *nats.Conn.
+type EventPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// LowBalanceEvent notifies users and other services that a session is running out of funds
+type LowBalanceEvent struct {
+	Type             string          `json:"type"`
+	SessionID        uuid.UUID       `json:"session_id"`
+	JobID            *string         `json:"job_id,omitempty"`
+	UserID           string          `json:"user_id"`
+	RemainingBalance decimal.Decimal `json:"remaining_balance"`
+	NextIntervalCost decimal.Decimal `json:"next_interval_cost"`
+	GraceEndsAt      *time.Time      `json:"grace_ends_at,omitempty"`
+	Timestamp        time.Time       `json:"timestamp"`
+}
+
+// lowBalanceState tracks the low balance warning sent for a session. The insufficient
+// funds grace period is stored with the session, so that it outlives restarts and any
+// instance can end it.
+type lowBalanceState struct {
+	warned bool
+}
+
+// checkSessionFunds compares the funds left for a session with the projected cost of the
+// next billing interval. Below LowBalanceThreshold the user is warned once; when the next
+// interval can't be paid for, the InsufficientFundsGrace period starts and the session is
+// terminated by the grace sweeper when it elapses unless the wallet is topped up first.
+func (s *BillingService) checkSessionFunds(ctx context.Context, session *models.RentalSession) {
+	remaining, nextCost, err := s.sessionFunds(ctx, session)
+	if err != nil {
+		s.logger.Warn("Failed to check session funds", zap.String("session_id", session.ID.String()), zap.Error(err))
+		return
+	}
+
+	if remaining.LessThan(nextCost) {
+		grace := s.config.InsufficientFundsGrace
+		if grace <= 0 {
+			grace = defaultInsufficientFundsGrace
+		}
+		graceEndsAt := time.Now().UTC().Add(grace)
+		started, err := s.store.StartSessionGrace(ctx, session.ID, graceEndsAt)
+		if err != nil {
+			s.logger.Warn("Failed to start grace period", zap.String("session_id", session.ID.String()), zap.Error(err))
+			return
+		}
+		if !started {
+			return // Grace period already running
+		}
+
+		s.logger.Warn("Insufficient funds for next billing interval, grace period started",
+			zap.String("session_id", session.ID.String()),
+			zap.String("remaining_balance", remaining.String()),
+			zap.String("next_interval_cost", nextCost.String()),
+			zap.Duration("grace", grace),
+		)
+		s.notifyLowBalance(session, LowBalanceEventInsufficientFunds, remaining, nextCost, &graceEndsAt)
+		return
+	}
+
+	restored, err := s.store.ClearSessionGrace(ctx, session.ID)
+	if err != nil {
+		s.logger.Warn("Failed to clear grace period", zap.String("session_id", session.ID.String()), zap.Error(err))
+	}
+	if restored {
+		s.notifyLowBalance(session, LowBalanceEventFundsRestored, remaining, nextCost, nil)
+	}
+
+	s.lowBalanceMu.Lock()
+	defer s.lowBalanceMu.Unlock()
+	if s.config.LowBalanceThreshold.IsPositive() && remaining.LessThan(s.config.LowBalanceThreshold) {
+		state := s.lowBalance[session.ID]
+		if state == nil {
+			state = &lowBalanceState{}
+			s.lowBalance[session.ID] = state
+		}
+		if !state.warned {
+			state.warned = true
+			s.notifyLowBalance(session, LowBalanceEventWarning, remaining, nextCost, nil)
+		}
+		return
+	}
+	delete(s.lowBalance, session.ID)
+}
+
+// clearLowBalanceState forgets a session's warnings and cancels its grace period
+func (s *BillingService) clearLowBalanceState(ctx context.Context, sessionID uuid.UUID) {
+	s.lowBalanceMu.Lock()
+	delete(s.lowBalance, sessionID)
+	s.lowBalanceMu.Unlock()
+
+	if _, err := s.store.ClearSessionGrace(ctx, sessionID); err != nil {
+		s.logger.Warn("Failed to clear grace period", zap.String("session_id", sessionID.String()), zap.Error(err))
+	}
+}
+
+// sessionFunds returns what the user can still spend on the session (their available balance,
+// plus the funds locked for the session, less the cost accrued so far) and the projected cost
+// of the next billing interval.
+func (s *BillingService) sessionFunds(ctx context.Context, session *models.RentalSession) (remaining, nextCost decimal.Decimal, err error) {
+	interval := s.config.BillingInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	nextCost = session.CostForPeriod(decimal.NewFromFloat(interval.Hours()), session.PowerDrawW())
+
+	userWallet, err := s.store.GetWalletByUserID(ctx, session.UserID, models.WalletTypeUser)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	remaining = userWallet.AvailableBalance()
+	if session.Status == models.SessionStatusActive {
+		remaining = remaining.Add(session.LockedAmount)
+	}
+	remaining = remaining.Sub(session.CalculateCurrentCost())
+
+	return remaining, nextCost, nil
+}
+
+// StartGraceSweeper terminates sessions whose insufficient funds grace period ran out,
+// until Stop is called
+func (s *BillingService) StartGraceSweeper() {
+	s.runEvery(graceSweepInterval, func(ctx context.Context) {
+		if err := s.SweepExpiredGrace(ctx); err != nil {
+			s.logger.Error("Failed to sweep sessions past their grace period", zap.Error(err))
+		}
+	})
+}
+
+// SweepExpiredGrace terminates the sessions whose grace period ran out without the
+// wallet being topped up
+func (s *BillingService) SweepExpiredGrace(ctx context.Context) error {
+	sessionIDs, err := s.store.GetSessionsPastGrace(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		s.handleGraceExpired(ctx, sessionID)
+	}
+	return nil
+}
+
+// handleGraceExpired terminates a session whose grace period ran out without the wallet
+// being topped up. The cost accrued is charged from what the user has left.
+func (s *BillingService) handleGraceExpired(ctx context.Context, sessionID uuid.UUID) {
+	session, err := s.getRentalSession(ctx, sessionID)
+	if err != nil {
+		s.logger.Error("Failed to load session after grace period expired", zap.String("session_id", sessionID.String()), zap.Error(err))
+		return
+	}
+	if session.Status != models.SessionStatusActive {
+		return
+	}
+
+	remaining, nextCost, err := s.sessionFunds(ctx, session)
+	if err != nil {
+		s.logger.Error("Failed to check session funds after grace period expired", zap.String("session_id", sessionID.String()), zap.Error(err))
+		return
+	}
+	if !remaining.LessThan(nextCost) {
+		s.logger.Info("Funds topped up before grace period expired", zap.String("session_id", sessionID.String()))
+		if restored, err := s.store.ClearSessionGrace(ctx, sessionID); err == nil && restored {
+			s.notifyLowBalance(session, LowBalanceEventFundsRestored, remaining, nextCost, nil)
+		}
+		return
+	}
+
+	s.logger.Warn("Insufficient funds grace period expired, terminating session",
+		zap.String("session_id", sessionID.String()),
+		zap.String("remaining_balance", remaining.String()),
+	)
+
+	// Only the instance that terminates the session stops its job and notifies the user
+	session, _, err = s.endRentalSession(ctx, sessionID, models.SessionStatusTerminated, true)
+	if errors.Is(err, models.ErrSessionNotActive) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to end unfunded session", zap.String("session_id", sessionID.String()), zap.Error(err))
+		return
+	}
+	metrics.SessionsEnded.WithLabelValues("terminated").Inc()
+
+	// Stop the job so the provider doesn't keep doing work nobody pays for
+	if session.JobID != nil && s.events != nil {
+		cancelData, _ := json.Marshal(map[string]interface{}{
+			"job_id":       *session.JobID,
+			"requested_by": "billing-payment-service",
+			"reason":       "insufficient_funds",
+			"timestamp":    time.Now().UTC(),
+		})
+		if err := s.events.Publish(fmt.Sprintf(taskCancelSubjectFormat, *session.JobID), cancelData); err != nil {
+			s.logger.Error("Failed to publish job cancel for unfunded session", zap.String("job_id", *session.JobID), zap.Error(err))
+		}
+	}
+
+	s.notifyLowBalance(session, LowBalanceEventTerminated, remaining, nextCost, nil)
+}
+
+// notifyLowBalance publishes a low balance event to NATS and the configured webhook
+func (s *BillingService) notifyLowBalance(session *models.RentalSession, eventType string, remaining, nextCost decimal.Decimal, graceEndsAt *time.Time) {
+	event := LowBalanceEvent{
+		Type:             eventType,
+		SessionID:        session.ID,
+		JobID:            session.JobID,
+		UserID:           session.UserID,
+		RemainingBalance: remaining,
+		NextIntervalCost: nextCost,
+		GraceEndsAt:      graceEndsAt,
+		Timestamp:        time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("Failed to marshal low balance event", zap.Error(err))
+		return
+	}
+
+	if s.events != nil {
+		subject := s.config.LowBalanceEventSubject
+		if subject == "" {
+			subject = defaultLowBalanceEventSubject
+		}
+		if err := s.events.Publish(subject, data); err != nil {
+			s.logger.Warn("Failed to publish low balance event", zap.String("type", eventType), zap.Error(err))
+		}
+	}
+
+	if s.config.LowBalanceWebhookURL != "" {
+		go s.postLowBalanceWebhook(data, eventType)
+	}
+}
+
+func (s *BillingService) postLowBalanceWebhook(data []byte, eventType string) {
+	resp, err := s.httpClient.Post(s.config.LowBalanceWebhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		s.logger.Warn("Failed to deliver low balance webhook", zap.String("type", eventType), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		s.logger.Warn("Low balance webhook rejected", zap.String("type", eventType), zap.Int("status_code", resp.StatusCode))
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// graceEndsAt returns the end of a session's grace period, or nil if none is running
+func (e *testEnv) graceEndsAt(t *testing.T, sessionID uuid.UUID) *time.Time {
+	t.Helper()
+	var endsAt *time.Time
+	if err := e.db.QueryRow(context.Background(), `SELECT grace_ends_at FROM rental_sessions WHERE id = $1`, sessionID).Scan(&endsAt); err != nil {
+		t.Fatalf("failed to get grace period: %v", err)
+	}
+	return endsAt
+}
+
+// expireGrace makes a session's grace period look like it ended a minute ago
+func (e *testEnv) expireGrace(t *testing.T, sessionID uuid.UUID) {
+	t.Helper()
+	_, err := e.db.Exec(context.Background(), `UPDATE rental_sessions SET grace_ends_at = $2 WHERE id = $1`,
+		sessionID, time.Now().UTC().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("failed to expire grace period: %v", err)
+	}
+}
+
+// count returns how often subject was published to
+func count(subjects []string, subject string) int {
+	n := 0
+	for _, s := range subjects {
+		if s == subject {
+			n++
+		}
+	}
+	return n
+}
+
+// unfundedSession creates an active session costing 20 so far for a user with balance
+func unfundedSession(t *testing.T, env *testEnv, balance int64) (*models.Wallet, *models.RentalSession) {
+	t.Helper()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(balance))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.Zero)
+	_, err := env.db.Exec(context.Background(), `UPDATE rental_sessions SET job_id = $2, total_cost = 20 WHERE id = $1`,
+		session.ID, "job-"+uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err = env.store.GetRentalSession(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet, session
+}
+
+func TestGracePeriodStartsOnce(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	_, session := unfundedSession(t, env, 5)
+
+	env.service.checkSessionFunds(ctx, session)
+	first := env.graceEndsAt(t, session.ID)
+	if first == nil {
+		t.Fatal("no grace period started for a session that can't pay for the next interval")
+	}
+
+	// Another instance seeing the same shortfall leaves the grace period running
+	other := newTestEnv(t)
+	other.service.checkSessionFunds(ctx, session)
+	if second := env.graceEndsAt(t, session.ID); second == nil || !second.Equal(*first) {
+		t.Errorf("grace period ends at %v after a second check, want %v", second, first)
+	}
+	warnings := count(env.events.published(), defaultLowBalanceEventSubject) + count(other.events.published(), defaultLowBalanceEventSubject)
+	if warnings != 1 {
+		t.Errorf("%d insufficient funds events, want 1", warnings)
+	}
+}
+
+func TestSweepTerminatesUnfundedSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	wallet, session := unfundedSession(t, env, 5)
+	env.service.checkSessionFunds(ctx, session)
+
+	// The grace period ends while no instance is keeping a timer for it
+	env.expireGrace(t, session.ID)
+	restarted := newTestEnv(t)
+	if err := restarted.service.SweepExpiredGrace(ctx); err != nil {
+		t.Fatalf("SweepExpiredGrace: %v", err)
+	}
+
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.SessionStatusTerminated {
+		t.Fatalf("session is %s, want terminated", stored.Status)
+	}
+	unpaid, _ := stored.Metadata["unpaid_cost"].(string)
+	if want := stored.TotalCost.Sub(decimal.NewFromInt(5)); unpaid == "" || decimal.RequireFromString(unpaid).Sub(want).Abs().GreaterThan(decimal.New(1, -6)) {
+		t.Errorf("unpaid cost %q of a total %s, want the total less the 5 collected", unpaid, stored.TotalCost)
+	}
+	// What the user had left was charged
+	assertBalances(t, env, wallet.ID, 0, 0)
+
+	var charged decimal.Decimal
+	err = env.db.QueryRow(ctx, `SELECT amount FROM transactions WHERE session_id = $1 AND type = $2`,
+		session.ID, models.TransactionTypeSessionEnd).Scan(&charged)
+	if err != nil {
+		t.Fatalf("no final payment for the terminated session: %v", err)
+	}
+	if !charged.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("final payment %s, want 5", charged)
+	}
+	if n := count(restarted.events.published(), fmt.Sprintf(taskCancelSubjectFormat, *session.JobID)); n != 1 {
+		t.Errorf("job cancelled %d times, want once", n)
+	}
+
+	// A later sweep finds nothing left to do
+	if err := restarted.service.SweepExpiredGrace(ctx); err != nil {
+		t.Fatalf("SweepExpiredGrace: %v", err)
+	}
+	if n := count(restarted.events.published(), fmt.Sprintf(taskCancelSubjectFormat, *session.JobID)); n != 1 {
+		t.Errorf("job cancelled %d times after a second sweep, want once", n)
+	}
+}
+
+func TestSweepKeepsToppedUpSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	wallet, session := unfundedSession(t, env, 5)
+	env.service.checkSessionFunds(ctx, session)
+	env.expireGrace(t, session.ID)
+
+	if _, err := env.store.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+		w.AddFunds(decimal.NewFromInt(1000))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.service.SweepExpiredGrace(ctx); err != nil {
+		t.Fatalf("SweepExpiredGrace: %v", err)
+	}
+
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.SessionStatusActive {
+		t.Errorf("topped up session is %s, want active", stored.Status)
+	}
+	if endsAt := env.graceEndsAt(t, session.ID); endsAt != nil {
+		t.Errorf("grace period still ends at %v after the wallet was topped up", endsAt)
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
+)
+
+// registryProvider holds the provider registry fields the marketplace needs
+type registryProvider struct {
+	ID       uuid.UUID              `json:"id"`
+	Name     string                 `json:"name"`
+	Status   string                 `json:"status"`
+	Location string                 `json:"location"`
+	GPUs     []registryGPU          `json:"gpus"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// registryGPU holds the provider registry GPU fields the marketplace needs
+type registryGPU struct {
+	ModelName        string `json:"model_name"`
+	VRAM             uint64 `json:"vram_mb"`
+	PowerConsumption uint32 `json:"power_consumption_w"`
+	IsHealthy        bool   `json:"is_healthy"`
+}
+
+// SearchMarketplace lists rentable GPUs from the provider registry, each priced at
+// the provider's current rates for a whole GPU. Filters on the GPU itself are passed on to the
+// registry to narrow the lookup, then re-checked per GPU, since the registry
+// matches a provider if any one of its GPUs does.
+func (s *BillingService) SearchMarketplace(ctx context.Context, filter *models.MarketplaceFilter) (*models.MarketplaceResponse, error) {
+	providers, err := s.listRegistryProviders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	oneHour := decimal.NewFromInt(1)
+	gpus := make([]models.MarketplaceGPU, 0)
+	for _, p := range providers {
+		rating, _ := metadataFloat(p.Metadata, "rating")
+		for i, gpu := range p.GPUs {
+			if gpu.VRAM == 0 {
+				continue
+			}
+
+			quote, err := s.pricingEngine.CalculatePricing(ctx, &pricing.PricingRequest{
+				GPUModel:        gpu.ModelName,
+				RequestedVRAM:   gpu.VRAM,
+				TotalVRAM:       gpu.VRAM,
+				EstimatedPowerW: gpu.PowerConsumption,
+				DurationHours:   oneHour,
+				Location:        p.Location,
+				ProviderID:      &p.ID,
+			})
+			if err != nil {
+				// Unpriced GPUs can't be rented, so they aren't listed
+				s.logger.Debug("Skipping unpriced GPU",
+					zap.String("provider_id", p.ID.String()),
+					zap.String("gpu_model", gpu.ModelName),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			entry := models.MarketplaceGPU{
+				ProviderID:          p.ID,
+				ProviderName:        p.Name,
+				GPUIndex:            i,
+				GPUModel:            gpu.ModelName,
+				VRAMTotalMB:         gpu.VRAM,
+				Location:            p.Location,
+				Status:              p.Status,
+				Available:           p.Status == "idle" && gpu.IsHealthy,
+				Rating:              rating,
+				HourlyRate:          quote.SubtotalCost,
+				PlatformFee:         quote.PlatformFee,
+				EffectiveHourlyRate: quote.TotalCost,
+			}
+			if marketplaceMatches(filter, &entry) {
+				gpus = append(gpus, entry)
+			}
+		}
+	}
+
+	sortMarketplace(gpus, filter)
+
+	total := len(gpus)
+	start := filter.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if filter.Limit > 0 && start+filter.Limit < total {
+		end = start + filter.Limit
+	}
+
+	return &models.MarketplaceResponse{
+		GPUs:               gpus[start:end],
+		Total:              total,
+		Limit:              filter.Limit,
+		Offset:             filter.Offset,
+		PlatformFeePercent: s.pricingEngine.GetPlatformFeePercent(),
+		Currency:           "dGPU",
+		PricedAt:           time.Now().UTC(),
+	}, nil
+}
+
+// listRegistryProviders fetches the providers that may have matching GPUs
+func (s *BillingService) listRegistryProviders(ctx context.Context, filter *models.MarketplaceFilter) ([]registryProvider, error) {
+	if s.config.ProviderRegistryURL == "" {
+		return nil, fmt.Errorf("provider registry URL is not configured")
+	}
+
+	query := url.Values{}
+	if filter.GPUModel != "" {
+		query.Set("gpu_model", filter.GPUModel)
+	}
+	if filter.MinVRAM > 0 {
+		query.Set("min_vram", strconv.FormatUint(filter.MinVRAM, 10))
+	}
+	if filter.Location != "" {
+		query.Set("location", filter.Location)
+	}
+	if filter.IsOnline != nil && *filter.IsOnline {
+		query.Set("online", "true")
+	}
+
+	endpoint := strings.TrimSuffix(s.config.ProviderRegistryURL, "/") + "/providers"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider registry request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query provider registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider registry returned status %d", resp.StatusCode)
+	}
+
+	var providers []registryProvider
+	if err := json.NewDecoder(resp.Body).Decode(&providers); err != nil {
+		return nil, fmt.Errorf("failed to decode provider registry response: %w", err)
+	}
+	return providers, nil
+}
+
+// marketplaceMatches reports whether a priced GPU passes the filter
+func marketplaceMatches(filter *models.MarketplaceFilter, gpu *models.MarketplaceGPU) bool {
+	if filter.GPUModel != "" && !strings.Contains(strings.ToLower(gpu.GPUModel), strings.ToLower(filter.GPUModel)) {
+		return false
+	}
+	if gpu.VRAMTotalMB < filter.MinVRAM {
+		return false
+	}
+	if filter.Location != "" && !strings.Contains(strings.ToLower(gpu.Location), strings.ToLower(filter.Location)) {
+		return false
+	}
+	if filter.MaxPricePerHour.IsPositive() && gpu.EffectiveHourlyRate.GreaterThan(filter.MaxPricePerHour) {
+		return false
+	}
+	if gpu.Rating < filter.MinRating {
+		return false
+	}
+	if filter.IsOnline != nil && *filter.IsOnline == (gpu.Status == "offline") {
+		return false
+	}
+	if filter.HasCapacity != nil && *filter.HasCapacity != gpu.Available {
+		return false
+	}
+	return true
+}
+
+// sortMarketplace orders GPUs by the filter's sort key, cheapest first by default.
+// Ties fall back to provider name, provider ID and GPU index so pages are stable.
+func sortMarketplace(gpus []models.MarketplaceGPU, filter *models.MarketplaceFilter) {
+	less := func(a, b *models.MarketplaceGPU) bool {
+		switch filter.SortBy {
+		case "rating":
+			if a.Rating != b.Rating {
+				return a.Rating < b.Rating
+			}
+		case "capacity":
+			if a.VRAMTotalMB != b.VRAMTotalMB {
+				return a.VRAMTotalMB < b.VRAMTotalMB
+			}
+		case "location":
+			if a.Location != b.Location {
+				return a.Location < b.Location
+			}
+		default:
+			if !a.EffectiveHourlyRate.Equal(b.EffectiveHourlyRate) {
+				return a.EffectiveHourlyRate.LessThan(b.EffectiveHourlyRate)
+			}
+		}
+		if a.ProviderName != b.ProviderName {
+			return a.ProviderName < b.ProviderName
+		}
+		if a.ProviderID != b.ProviderID {
+			return a.ProviderID.String() < b.ProviderID.String()
+		}
+		return a.GPUIndex < b.GPUIndex
+	}
+
+	descending := filter.SortOrder == "desc"
+	sort.SliceStable(gpus, func(i, j int) bool {
+		if descending {
+			return less(&gpus[j], &gpus[i])
+		}
+		return less(&gpus[i], &gpus[j])
+	})
+}
+
+// metadataFloat reads a numeric provider metadata value, which may be stored as a
+// JSON number or as a decimal string
+func metadataFloat(metadata map[string]interface{}, key string) (float64, bool) {
+	switch v := metadata[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana"
+)
+
+// payoutFee returns the fee deducted from a payout of amount
+func payoutFee(amount, feePercent decimal.Decimal) decimal.Decimal {
+	return amount.Mul(feePercent).Div(decimal.NewFromInt(100)).Round(9)
+}
+
+// RequestPayout pays out part of a provider's earnings from the platform wallet to the
+// provider wallet's address. The payout fee is deducted from the requested amount and
+// recorded as a separate platform fee transaction. Payouts are recorded under the
+// provider wallet's row lock before transferring, so concurrent requests can't pay out
+// the same earnings twice. A transfer not confirmed in time is left pending with its
+// signature, still counting as paid out, until the transfer reconciler settles it.
+func (s *BillingService) RequestPayout(ctx context.Context, providerID uuid.UUID, req *models.PayoutRequest) (*models.PayoutResponse, error) {
+	s.logger.Info("Processing payout",
+		zap.String("provider_id", providerID.String()),
+		zap.String("amount", req.Amount.String()),
+	)
+
+	if !req.Amount.IsPositive() {
+		return nil, models.NewValidationError("amount", "must be positive")
+	}
+	if req.Amount.LessThan(s.config.MinimumPayoutAmount) {
+		return nil, models.NewMinimumPayoutError(s.config.MinimumPayoutAmount.String(), req.Amount.String())
+	}
+
+	wallet, err := s.store.GetWalletByUserID(ctx, providerID.String(), models.WalletTypeProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Payouts only go to the address the provider registered its wallet with
+	toAddress := wallet.SolanaAddress
+	if err := solana.ValidateWalletAddress(toAddress); err != nil {
+		return nil, models.NewValidationError("to_address", err.Error())
+	}
+
+	fee := payoutFee(req.Amount, s.config.PayoutFeePercent)
+	netAmount := req.Amount.Sub(fee)
+
+	payoutReq := &models.TransactionCreateRequest{
+		FromWalletID: &wallet.ID,
+		Type:         models.TransactionTypePayout,
+		Amount:       netAmount,
+		Description:  fmt.Sprintf("Provider payout to %s", toAddress),
+		Metadata: map[string]interface{}{
+			"provider_id":      providerID.String(),
+			"to_address":       toAddress,
+			"requested_amount": req.Amount.String(),
+			"fee":              fee.String(),
+		},
+	}
+	var feeReq *models.TransactionCreateRequest
+	if fee.IsPositive() {
+		feeReq = &models.TransactionCreateRequest{
+			FromWalletID: &wallet.ID,
+			Type:         models.TransactionTypePlatformFee,
+			Amount:       fee,
+			Description:  fmt.Sprintf("Payout fee (%s%%)", s.config.PayoutFeePercent.String()),
+			Metadata: map[string]interface{}{
+				"provider_id": providerID.String(),
+			},
+		}
+	}
+
+	// Record the payout before transferring, so the earnings it pays out count as
+	// spent even if the service stops midway
+	payoutTxn, feeTxn, available, err := s.store.RecordPayout(ctx, providerID, wallet.ID, func(available decimal.Decimal) error {
+		if req.Amount.GreaterThan(available) {
+			return models.NewInsufficientFundsError(req.Amount.String(), available.String())
+		}
+		return nil
+	}, payoutReq, feeReq)
+	if err != nil {
+		if _, ok := err.(*models.BillingError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record payout: %w", err)
+	}
+
+	response := &models.PayoutResponse{
+		ProviderID:          providerID,
+		Amount:              req.Amount,
+		Fee:                 fee,
+		NetAmount:           netAmount,
+		ToAddress:           toAddress,
+		Status:              models.TransactionStatusConfirmed,
+		PayoutTransactionID: payoutTxn.ID,
+		RemainingEarnings:   available.Sub(req.Amount),
+	}
+	if feeTxn != nil {
+		response.FeeTransactionID = &feeTxn.ID
+	}
+
+	signature, err := s.solanaClient.TransferTokens(ctx, s.solanaClient.PlatformWalletAddress(), toAddress, netAmount)
+	var pending *solana.PendingTransferError
+	if errors.As(err, &pending) {
+		s.markTransferPending(payoutTxn, pending)
+		response.Status = models.TransactionStatusPending
+		response.SolanaSignature = pending.Signature
+		return response, nil
+	}
+	if err != nil {
+		// Nothing was transferred, so the earnings are available again
+		s.settlePayout(ctx, payoutTxn, models.TransactionStatusFailed)
+		return nil, models.NewSolanaError("payout_transfer", err)
+	}
+
+	payoutTxn.SolanaSignature = &signature
+	response.SolanaSignature = signature
+	if !s.settlePayout(ctx, payoutTxn, models.TransactionStatusConfirmed) {
+		response.Status = models.TransactionStatusPending
+	}
+
+	s.logger.Info("Payout processed successfully",
+		zap.String("provider_id", providerID.String()),
+		zap.String("net_amount", netAmount.String()),
+		zap.String("fee", fee.String()),
+		zap.String("signature", signature),
+	)
+
+	return response, nil
+}
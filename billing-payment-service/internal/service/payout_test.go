@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana/solanatest"
+)
+
+func TestPayoutFee(t *testing.T) {
+	tests := []struct {
+		amount, percent, want string
+	}{
+		{"100", "2", "2"},
+		{"10", "0", "0"},
+		{"0.000000001", "50", "0.000000001"},
+		{"33.333333333", "2.5", "0.833333333"},
+	}
+	for _, tt := range tests {
+		got := payoutFee(decimal.RequireFromString(tt.amount), decimal.RequireFromString(tt.percent))
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("payoutFee(%s, %s%%) = %s, want %s", tt.amount, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestPayoutRequestIgnoresAddress(t *testing.T) {
+	var req models.PayoutRequest
+	body := `{"amount":"10","to_address":"9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM"}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := json.Marshal(req)
+	if string(encoded) != `{"amount":"10"}` {
+		t.Errorf("payout request decoded to %s; it must not carry an address", encoded)
+	}
+}
+
+// newPayoutProvider creates a provider wallet with earnings from completed sessions
+func newPayoutProvider(t *testing.T, env *testEnv, earnings int64) (uuid.UUID, *models.Wallet) {
+	t.Helper()
+	providerID := uuid.New()
+	wallet := env.createWallet(t, providerID.String(), models.WalletTypeProvider, decimal.Zero)
+	env.createSession(t, "user-"+uuid.NewString(), providerID, models.SessionStatusCompleted, decimal.NewFromInt(earnings), decimal.Zero)
+	return providerID, wallet
+}
+
+func TestRequestPayoutPaysRegisteredAddress(t *testing.T) {
+	env := newTestEnv(t)
+	providerID, wallet := newPayoutProvider(t, env, 100)
+
+	payout, err := env.service.RequestPayout(context.Background(), providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(50)})
+	if err != nil {
+		t.Fatalf("RequestPayout: %v", err)
+	}
+	if payout.ToAddress != wallet.SolanaAddress {
+		t.Errorf("paid out to %s, want the provider wallet's %s", payout.ToAddress, wallet.SolanaAddress)
+	}
+	if payout.Status != models.TransactionStatusConfirmed || payout.SolanaSignature == "" {
+		t.Errorf("payout status %s, signature %q", payout.Status, payout.SolanaSignature)
+	}
+	if !payout.Fee.Equal(decimal.NewFromInt(1)) || !payout.RemainingEarnings.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("fee %s, remaining %s; want 1 and 50", payout.Fee, payout.RemainingEarnings)
+	}
+	if txn := env.transaction(t, *payout.FeeTransactionID); txn.Status != models.TransactionStatusConfirmed {
+		t.Errorf("fee transaction is %s, want confirmed", txn.Status)
+	}
+}
+
+func TestRequestPayoutConcurrent(t *testing.T) {
+	env := newTestEnv(t)
+	providerID, _ := newPayoutProvider(t, env, 100)
+
+	// Each request alone could be paid out; together they exceed the earnings
+	const requests = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.service.RequestPayout(context.Background(), providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(60)})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			t.Errorf("RequestPayout error = %v, want insufficient funds", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent payouts succeeded, want 1", succeeded)
+	}
+}
+
+func TestRequestPayoutPendingUntilSettled(t *testing.T) {
+	env := newTestEnv(t)
+	providerID, _ := newPayoutProvider(t, env, 100)
+	ctx := context.Background()
+
+	// The transfer isn't confirmed in time
+	env.node.SetStatuses(solanatest.NotSeen)
+	payout, err := env.service.RequestPayout(ctx, providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(60)})
+	if err != nil {
+		t.Fatalf("RequestPayout: %v", err)
+	}
+	if payout.Status != models.TransactionStatusPending || payout.SolanaSignature == "" {
+		t.Fatalf("payout status %s, signature %q; want pending with a signature", payout.Status, payout.SolanaSignature)
+	}
+	txn := env.transaction(t, payout.PayoutTransactionID)
+	if txn.Status != models.TransactionStatusPending || txn.SolanaSignature == nil || *txn.SolanaSignature != payout.SolanaSignature {
+		t.Fatalf("payout transaction %+v; want pending with the signature", txn)
+	}
+
+	// While pending it still counts as paid out
+	_, err = env.service.RequestPayout(ctx, providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(60)})
+	if !errors.Is(err, models.ErrInsufficientFunds) {
+		t.Errorf("second payout error = %v, want insufficient funds", err)
+	}
+
+	// Still not seen, but may land: left alone
+	env.ageTransaction(t, payout.PayoutTransactionID, 2*time.Minute)
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	if txn := env.transaction(t, payout.PayoutTransactionID); txn.Status != models.TransactionStatusPending {
+		t.Fatalf("payout that may still land is %s", txn.Status)
+	}
+
+	// Expired without landing: the payout failed and the earnings are available again
+	env.node.SetBlockHeight(solanatest.LastValidBlockHeight + 1)
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	if txn := env.transaction(t, payout.PayoutTransactionID); txn.Status != models.TransactionStatusFailed {
+		t.Fatalf("expired payout is %s, want failed", txn.Status)
+	}
+	if txn := env.transaction(t, *payout.FeeTransactionID); txn.Status != models.TransactionStatusFailed {
+		t.Errorf("fee of expired payout is %s, want failed", txn.Status)
+	}
+
+	env.node.SetStatuses(solanatest.Confirmed)
+	retry, err := env.service.RequestPayout(ctx, providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(60)})
+	if err != nil {
+		t.Fatalf("retried payout: %v", err)
+	}
+	if retry.Status != models.TransactionStatusConfirmed {
+		t.Errorf("retried payout is %s, want confirmed", retry.Status)
+	}
+}
+
+func TestReconcileConfirmsPendingPayout(t *testing.T) {
+	env := newTestEnv(t)
+	providerID, _ := newPayoutProvider(t, env, 100)
+	ctx := context.Background()
+
+	env.node.SetStatuses(solanatest.NotSeen)
+	payout, err := env.service.RequestPayout(ctx, providerID, &models.PayoutRequest{Amount: decimal.NewFromInt(60)})
+	if err != nil || payout.Status != models.TransactionStatusPending {
+		t.Fatalf("RequestPayout = %+v, %v; want pending", payout, err)
+	}
+
+	env.node.SetStatuses(solanatest.Confirmed)
+	env.ageTransaction(t, payout.PayoutTransactionID, 2*time.Minute)
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	txn := env.transaction(t, payout.PayoutTransactionID)
+	if txn.Status != models.TransactionStatusConfirmed || txn.ConfirmedAt == nil {
+		t.Errorf("landed payout is %s, want confirmed", txn.Status)
+	}
+	if txn := env.transaction(t, *payout.FeeTransactionID); txn.Status != models.TransactionStatusConfirmed {
+		t.Errorf("fee of landed payout is %s, want confirmed", txn.Status)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// GetProviderRates returns the rate schedules a provider has set
+func (s *BillingService) GetProviderRates(ctx context.Context, providerID uuid.UUID) ([]models.ProviderRateSchedule, error) {
+	return s.store.ListProviderRateSchedules(ctx, providerID)
+}
+
+// SetProviderRates creates or replaces a provider's rate schedule for a GPU model, or
+// for all of its GPUs when no model is given. New sessions are priced with it; running
+// sessions keep the rate they started with.
+func (s *BillingService) SetProviderRates(ctx context.Context, schedule *models.ProviderRateSchedule) (*models.ProviderRateSchedule, error) {
+	schedule.GPUModel = strings.TrimSpace(schedule.GPUModel)
+	if schedule.GPUModel == models.AllGPUModels {
+		schedule.GPUModel = ""
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if err := validateRateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	schedule.UpdatedAt = time.Now().UTC()
+
+	if err := s.store.UpsertProviderRateSchedule(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Provider rates updated",
+		zap.String("provider_id", schedule.ProviderID.String()),
+		zap.String("gpu_model", schedule.GPUModel),
+		zap.String("hourly_rate", schedule.HourlyRate.String()),
+		zap.String("timezone", schedule.Timezone),
+		zap.Int("multipliers", len(schedule.Multipliers)),
+	)
+	return schedule, nil
+}
+
+// validateRateSchedule checks a schedule's rate, timezone and windows
+func validateRateSchedule(schedule *models.ProviderRateSchedule) error {
+	if schedule.HourlyRate.IsNegative() {
+		return models.NewValidationError("hourly_rate", "must not be negative")
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return models.NewValidationError("timezone", "unknown timezone")
+	}
+
+	for i, m := range schedule.Multipliers {
+		field := fmt.Sprintf("multipliers[%d]", i)
+		if m.StartHour < 0 || m.StartHour > 23 {
+			return models.NewValidationError(field+".start_hour", "must be between 0 and 23")
+		}
+		if m.EndHour < 1 || m.EndHour > 24 {
+			return models.NewValidationError(field+".end_hour", "must be between 1 and 24")
+		}
+		if !m.Multiplier.IsPositive() {
+			return models.NewValidationError(field+".multiplier", "must be greater than 0")
+		}
+		for _, day := range m.Days {
+			if _, ok := models.ParseWeekday(day); !ok {
+				return models.NewValidationError(field+".days", fmt.Sprintf("unknown day %q, expected mon to sun", day))
+			}
+		}
+	}
+	return nil
+}
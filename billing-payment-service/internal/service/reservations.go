@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
+)
+
+// ReserveFunds prices each job and locks the total on the user's wallet in one update,
+// so a batch of jobs either has all of its funds reserved or none. Each job's share is
+// released when its rental session starts, or through ReleaseFunds if it never does.
+func (s *BillingService) ReserveFunds(ctx context.Context, req *models.FundsReservationRequest) (*models.FundsReservationResponse, error) {
+	if req.UserID == "" {
+		return nil, models.NewValidationError("user_id", "is required")
+	}
+	if len(req.Jobs) == 0 {
+		return nil, models.NewValidationError("jobs", "at least one job is required")
+	}
+
+	total := decimal.Zero
+	for i := range req.Jobs {
+		job := &req.Jobs[i]
+		if job.JobID == "" {
+			return nil, models.NewValidationError(fmt.Sprintf("jobs[%d].job_id", i), "is required")
+		}
+		if job.DurationHours.IsNegative() {
+			return nil, models.NewValidationError(fmt.Sprintf("jobs[%d].duration_hours", i), "must not be negative")
+		}
+		if job.DurationHours.IsZero() {
+			job.DurationHours = decimal.NewFromInt(1) // What a session locks when it starts
+		}
+		gpuModel := job.GPUModel
+		if gpuModel == "" {
+			gpuModel = "default"
+		}
+
+		// The provider, and so the VRAM and power draw, is only known at placement;
+		// the reservation covers the GPU's base rate and the platform fee
+		estimate, err := s.pricingEngine.CalculatePricing(ctx, &pricing.PricingRequest{
+			GPUModel:      gpuModel,
+			TotalVRAM:     1,
+			DurationHours: job.DurationHours,
+			UserID:        &req.UserID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to price job %s: %w", job.JobID, err)
+		}
+		job.Amount = estimate.TotalCost
+		total = total.Add(job.Amount)
+	}
+
+	wallet, err := s.store.GetWalletByUserID(ctx, req.UserID, models.WalletTypeUser)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err = s.store.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+		if w.AvailableBalance().LessThan(total) {
+			return models.NewInsufficientFundsError(total.String(), w.AvailableBalance().String())
+		}
+		return w.LockFunds(total)
+	})
+	if err != nil {
+		if _, ok := err.(*models.BillingError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to reserve funds: %w", err)
+	}
+
+	s.logger.Info("Funds reserved for jobs",
+		zap.String("user_id", req.UserID),
+		zap.String("reference", req.Reference),
+		zap.Int("jobs", len(req.Jobs)),
+		zap.String("amount", total.String()),
+	)
+	return &models.FundsReservationResponse{
+		WalletID:         wallet.ID,
+		Reference:        req.Reference,
+		Jobs:             req.Jobs,
+		TotalAmount:      total,
+		AvailableBalance: wallet.AvailableBalance(),
+	}, nil
+}
+
+// ReleaseFunds unlocks funds reserved for jobs that will not be placed
+func (s *BillingService) ReleaseFunds(ctx context.Context, req *models.FundsReleaseRequest) (*models.FundsReservationResponse, error) {
+	if req.UserID == "" {
+		return nil, models.NewValidationError("user_id", "is required")
+	}
+	if !req.Amount.IsPositive() {
+		return nil, models.NewValidationError("amount", "must be greater than 0")
+	}
+
+	wallet, err := s.store.GetWalletByUserID(ctx, req.UserID, models.WalletTypeUser)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err = s.store.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+		w.UnlockFunds(req.Amount)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to release funds: %w", err)
+	}
+
+	s.logger.Info("Reserved funds released",
+		zap.String("user_id", req.UserID),
+		zap.String("reference", req.Reference),
+		zap.String("amount", req.Amount.String()),
+	)
+	return &models.FundsReservationResponse{
+		WalletID:         wallet.ID,
+		Reference:        req.Reference,
+		TotalAmount:      req.Amount,
+		AvailableBalance: wallet.AvailableBalance(),
+	}, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mr-tron/base58"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/pricing"
+	billingsolana "github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana/solanatest"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/store"
+)
+
+// testDatabaseEnv names the PostgreSQL database the service tests run against. Tests
+// that need one are skipped when it isn't set. Every test uses its own wallets and
+// sessions, so the database can be shared and reused.
+const testDatabaseEnv = "BILLING_TEST_DATABASE_URL"
+
+// testEnv is a billing service backed by the test database and a fake Solana node
+type testEnv struct {
+	service *BillingService
+	store   *store.PostgresStore
+	db      *pgxpool.Pool
+	node    *solanatest.Node
+	events  *eventRecorder
+}
+
+// eventRecorder is an EventPublisher that keeps what was published
+type eventRecorder struct {
+	mu       sync.Mutex
+	subjects []string
+	data     [][]byte
+}
+
+func (r *eventRecorder) Publish(subject string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subjects = append(r.subjects, subject)
+	r.data = append(r.data, data)
+	return nil
+}
+
+// published returns the subjects published to so far
+func (r *eventRecorder) published() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.subjects...)
+}
+
+// newTestEnv returns a billing service against the test database. Transfers confirm
+// right away unless the node is told otherwise, and give up confirming after half a
+// second.
+func newTestEnv(t testing.TB) *testEnv {
+	t.Helper()
+	databaseURL := os.Getenv(testDatabaseEnv)
+	if databaseURL == "" {
+		t.Skipf("%s not set", testDatabaseEnv)
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	logger := zap.NewNop()
+	billingStore := store.NewPostgresStore(db, logger)
+	if err := billingStore.Initialize(ctx); err != nil {
+		t.Fatalf("failed to initialize the test database: %v", err)
+	}
+
+	node := solanatest.NewNode(10, solanatest.Confirmed)
+	keyPath := filepath.Join(t.TempDir(), "solana_private_key")
+	if err := os.WriteFile(keyPath, []byte(base58.Encode(solana.NewWallet().PrivateKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	solanaClient, err := billingsolana.NewClient(&billingsolana.Config{
+		RPCURL:         node.Start(t),
+		TokenAddress:   solana.NewWallet().PublicKey().String(),
+		PlatformWallet: solana.NewWallet().PublicKey().String(),
+		PrivateKeyPath: keyPath,
+		Commitment:     "confirmed",
+		Timeout:        500 * time.Millisecond,
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create the Solana client: %v", err)
+	}
+	t.Cleanup(func() { solanaClient.Close() })
+
+	config := &Config{
+		MinimumBalance:       decimal.NewFromInt(1),
+		BillingInterval:      time.Minute,
+		MaxTransactionAmount: decimal.NewFromInt(1000000),
+		DailyWithdrawalLimit: decimal.NewFromInt(1000000),
+		MinimumPayoutAmount:  decimal.NewFromInt(1),
+		PayoutFeePercent:     decimal.NewFromInt(2),
+	}
+	engine := pricing.NewEngine(&pricing.Config{}, billingStore, logger)
+	events := &eventRecorder{}
+	service := NewBillingService(billingStore, solanaClient, engine, events, config, logger)
+	t.Cleanup(func() { service.Stop(context.Background()) })
+
+	return &testEnv{service: service, store: billingStore, db: db, node: node, events: events}
+}
+
+// createWallet creates a wallet with the given balance for a new user or provider ID
+func (e *testEnv) createWallet(t testing.TB, userID string, walletType models.WalletType, balance decimal.Decimal) *models.Wallet {
+	t.Helper()
+	ctx := context.Background()
+	wallet, err := e.store.CreateWallet(ctx, &models.WalletCreateRequest{
+		UserID:        userID,
+		WalletType:    walletType,
+		SolanaAddress: solana.NewWallet().PublicKey().String(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	if balance.IsPositive() {
+		wallet, err = e.store.UpdateWallet(ctx, wallet.ID, func(w *models.Wallet) error {
+			w.Balance = balance
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to fund wallet: %v", err)
+		}
+	}
+	return wallet
+}
+
+// wallet reads a wallet back
+func (e *testEnv) wallet(t *testing.T, walletID uuid.UUID) *models.Wallet {
+	t.Helper()
+	wallet, err := e.store.GetWallet(context.Background(), walletID)
+	if err != nil {
+		t.Fatalf("failed to get wallet: %v", err)
+	}
+	return wallet
+}
+
+// transaction reads a transaction back
+func (e *testEnv) transaction(t *testing.T, transactionID uuid.UUID) *models.Transaction {
+	t.Helper()
+	transaction, err := e.store.GetTransaction(context.Background(), transactionID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	return transaction
+}
+
+// createSession records a rental session for the user on the provider
+func (e *testEnv) createSession(t testing.TB, userID string, providerID uuid.UUID, status models.SessionStatus, earnings, locked decimal.Decimal) *models.RentalSession {
+	t.Helper()
+	now := time.Now().UTC()
+	session := &models.RentalSession{
+		ID:               uuid.New(),
+		UserID:           userID,
+		ProviderID:       providerID,
+		Status:           status,
+		GPUModel:         "RTX 4090",
+		AllocatedVRAM:    24576,
+		TotalVRAM:        24576,
+		VRAMPercentage:   decimal.NewFromInt(100),
+		HourlyRate:       decimal.NewFromInt(10),
+		VRAMRate:         decimal.Zero,
+		PowerRate:        decimal.Zero,
+		PlatformFeeRate:  decimal.NewFromInt(10),
+		EstimatedPowerW:  450,
+		StartedAt:        now.Add(-time.Hour),
+		LastBilledAt:     now,
+		ProviderEarnings: earnings,
+		LockedAmount:     locked,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if status == models.SessionStatusCompleted {
+		session.EndedAt = &now
+	}
+	if err := e.store.CreateRentalSession(context.Background(), session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	return session
+}
+
+// ageTransaction makes a transaction look last updated d ago, so the reconciler picks it up
+func (e *testEnv) ageTransaction(t *testing.T, transactionID uuid.UUID, d time.Duration) {
+	t.Helper()
+	_, err := e.db.Exec(context.Background(),
+		`UPDATE transactions SET updated_at = $2 WHERE id = $1`, transactionID, time.Now().UTC().Add(-d))
+	if err != nil {
+		t.Fatalf("failed to age transaction: %v", err)
+	}
+}
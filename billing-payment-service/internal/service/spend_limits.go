@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/store"
+)
+
+// spendWindowStarts returns the start of the current day and month in the wallet
+// owner's timezone, so that limits reset at the user's local midnight
+func spendWindowStarts(wallet *models.Wallet, now time.Time) (dayStart, monthStart time.Time) {
+	local := now.In(wallet.Location())
+	dayStart = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	monthStart = time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+	return dayStart, monthStart
+}
+
+// walletSpending returns what the wallet has spent today and this month
+func (s *BillingService) walletSpending(ctx context.Context, wallet *models.Wallet) (daily, monthly decimal.Decimal, err error) {
+	return spendingInWindows(wallet, func(since time.Time) (decimal.Decimal, error) {
+		return s.store.GetWalletSpending(ctx, wallet.ID, since)
+	})
+}
+
+// spendingInWindows returns what the wallet has spent today and this month, read with spentSince
+func spendingInWindows(wallet *models.Wallet, spentSince store.WalletSpending) (daily, monthly decimal.Decimal, err error) {
+	dayStart, monthStart := spendWindowStarts(wallet, time.Now())
+
+	daily, err = spentSince(dayStart)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	monthly, err = spentSince(monthStart)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return daily, monthly, nil
+}
+
+// checkSpendLimits rejects a reservation that would take the wallet over its daily or
+// monthly spending limit. Funds already locked by other sessions count towards the
+// limits, since they are committed to being spent. It must be called from
+// UpdateWalletWithSpending, under the wallet's row lock, so that the locked balance and
+// spending it checks are current.
+func (s *BillingService) checkSpendLimits(wallet *models.Wallet, amount decimal.Decimal, spentSince store.WalletSpending) error {
+	if !wallet.DailySpendLimit.IsPositive() && !wallet.MonthlySpendLimit.IsPositive() {
+		return nil
+	}
+
+	daily, monthly, err := spendingInWindows(wallet, spentSince)
+	if err != nil {
+		return fmt.Errorf("failed to check spending limits: %w", err)
+	}
+
+	limits := []struct {
+		period string
+		limit  decimal.Decimal
+		spent  decimal.Decimal
+	}{
+		{"daily", wallet.DailySpendLimit, daily.Add(wallet.LockedBalance)},
+		{"monthly", wallet.MonthlySpendLimit, monthly.Add(wallet.LockedBalance)},
+	}
+	for _, l := range limits {
+		if l.limit.IsPositive() && l.spent.Add(amount).GreaterThan(l.limit) {
+			s.logger.Warn("Spending limit exceeded",
+				zap.String("wallet_id", wallet.ID.String()),
+				zap.String("period", l.period),
+				zap.String("limit", l.limit.String()),
+				zap.String("spent", l.spent.String()),
+				zap.String("requested", amount.String()),
+			)
+			return models.NewLimitExceededError(l.period, l.limit.String(), l.spent.String(), amount.String())
+		}
+	}
+
+	return nil
+}
+
+// UpdateSpendLimits sets a wallet's daily and monthly spending limits. The timezone,
+// taken from the user's profile, decides when the day and month roll over.
+func (s *BillingService) UpdateSpendLimits(ctx context.Context, walletID uuid.UUID, req *models.SpendLimitsRequest) (*models.Wallet, error) {
+	if req.DailySpendLimit.IsNegative() {
+		return nil, models.NewValidationError("daily_spend_limit", "must not be negative")
+	}
+	if req.MonthlySpendLimit.IsNegative() {
+		return nil, models.NewValidationError("monthly_spend_limit", "must not be negative")
+	}
+
+	wallet, err := s.store.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	timezone := wallet.Timezone
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return nil, models.NewValidationError("timezone", "unknown timezone")
+		}
+		timezone = req.Timezone
+	}
+
+	if err := s.store.UpdateWalletSpendLimits(ctx, walletID, req.DailySpendLimit, req.MonthlySpendLimit, timezone); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Wallet spending limits updated",
+		zap.String("wallet_id", walletID.String()),
+		zap.String("daily_limit", req.DailySpendLimit.String()),
+		zap.String("monthly_limit", req.MonthlySpendLimit.String()),
+		zap.String("timezone", timezone),
+	)
+
+	wallet.DailySpendLimit = req.DailySpendLimit
+	wallet.MonthlySpendLimit = req.MonthlySpendLimit
+	wallet.Timezone = timezone
+	return wallet, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+func TestSpendWindowStarts(t *testing.T) {
+	wallet := &models.Wallet{Timezone: "Europe/Istanbul"} // UTC+3
+	dayStart, monthStart := spendWindowStarts(wallet, time.Date(2026, 3, 31, 22, 30, 0, 0, time.UTC))
+
+	// 22:30 UTC on the 31st is already 1 April in Istanbul
+	if want := time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC); !dayStart.Equal(want) {
+		t.Errorf("day start %s, want %s", dayStart.UTC(), want)
+	}
+	if want := time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC); !monthStart.Equal(want) {
+		t.Errorf("month start %s, want %s", monthStart.UTC(), want)
+	}
+}
+
+func TestResumeRentalSessionSpendLimitConcurrent(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	wallet := env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(100))
+	if _, err := env.service.UpdateSpendLimits(ctx, wallet.ID, &models.SpendLimitsRequest{DailySpendLimit: decimal.NewFromInt(15)}); err != nil {
+		t.Fatalf("UpdateSpendLimits: %v", err)
+	}
+
+	// Either session fits the daily limit on its own, but not both
+	var sessions []*models.RentalSession
+	for i := 0; i < 2; i++ {
+		session := env.createSession(t, userID, uuid.New(), models.SessionStatusPaused, decimal.Zero, decimal.NewFromInt(10))
+		if _, err := env.db.Exec(ctx, `UPDATE rental_sessions SET paused_at = NOW() WHERE id = $1`, session.ID); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(sessions))
+	for i, session := range sessions {
+		wg.Add(1)
+		go func(i int, sessionID uuid.UUID) {
+			defer wg.Done()
+			_, errs[i] = env.service.ResumeRentalSession(ctx, &models.SessionResumeRequest{SessionID: sessionID})
+		}(i, session.ID)
+	}
+	wg.Wait()
+
+	resumed := 0
+	for _, err := range errs {
+		if err == nil {
+			resumed++
+		} else if billingErr, ok := err.(*models.BillingError); !ok || billingErr.Code != models.ErrCodeLimitExceeded {
+			t.Errorf("ResumeRentalSession: %v, want the spending limit exceeded", err)
+		}
+	}
+	if resumed != 1 {
+		t.Errorf("%d sessions resumed, want 1 within the limit", resumed)
+	}
+	assertBalances(t, env, wallet.ID, 100, 10)
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana"
+)
+
+const (
+	// transferReconcileInterval is how often transfers left pending are looked up on chain
+	transferReconcileInterval = time.Minute
+
+	// pendingTransferMinAge keeps the reconciler away from transfers whose request may
+	// still be waiting for them to confirm
+	pendingTransferMinAge = time.Minute
+
+	// settleTimeout bounds recording the outcome of a transfer. It isn't bound by the
+	// request, which may have given up while the transfer was confirming.
+	settleTimeout = 10 * time.Second
+)
+
+// reconciledTransferTypes are the transaction types whose transfers are settled by the
+// reconciler when their request couldn't wait for them
+var reconciledTransferTypes = []models.TransactionType{
+	models.TransactionTypeWithdrawal,
+	models.TransactionTypePayout,
+}
+
+// StartTransferReconciler settles transfers left pending by requests that stopped
+// waiting for them, until Stop is called
+func (s *BillingService) StartTransferReconciler() {
+	s.runEvery(transferReconcileInterval, func(ctx context.Context) {
+		if err := s.ReconcileTransfers(ctx); err != nil {
+			s.logger.Error("Failed to reconcile pending transfers", zap.Error(err))
+		}
+	})
+}
+
+// ReconcileTransfers looks up the transfers that are still pending on chain and settles
+// the ones that have confirmed, failed or expired. Transfers that may still land are
+// left for the next run.
+func (s *BillingService) ReconcileTransfers(ctx context.Context) error {
+	transfers, err := s.store.GetPendingTransfers(ctx, reconciledTransferTypes, time.Now().UTC().Add(-pendingTransferMinAge))
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transfers {
+		status, err := s.solanaClient.GetTransferStatus(ctx, *transaction.SolanaSignature, lastValidBlockHeight(transaction))
+		logger := s.logger.With(
+			zap.String("transaction_id", transaction.ID.String()),
+			zap.String("type", string(transaction.Type)),
+			zap.String("signature", *transaction.SolanaSignature),
+			zap.Stringer("status", status),
+		)
+
+		switch status {
+		case solana.TransferPending:
+			if err != nil {
+				logger.Warn("Failed to look up pending transfer", zap.Error(err))
+			}
+			continue
+		case solana.TransferConfirmed:
+			logger.Info("Pending transfer confirmed")
+			s.settleTransfer(ctx, transaction, models.TransactionStatusConfirmed)
+		default:
+			logger.Warn("Pending transfer did not land", zap.Error(err))
+			s.settleTransfer(ctx, transaction, models.TransactionStatusFailed)
+		}
+	}
+	return nil
+}
+
+// lastValidBlockHeight returns the block height recorded for a pending transfer. Without
+// one the transfer is never taken to have expired, only to have confirmed or failed.
+func lastValidBlockHeight(transaction *models.Transaction) uint64 {
+	if height, ok := transaction.Metadata["last_valid_block_height"].(float64); ok && height > 0 {
+		return uint64(height)
+	}
+	return math.MaxUint64
+}
+
+// settleTransfer settles a pending transfer of any reconciled type
+func (s *BillingService) settleTransfer(ctx context.Context, transaction *models.Transaction, status models.TransactionStatus) {
+	switch transaction.Type {
+	case models.TransactionTypeWithdrawal:
+		s.settleWithdrawal(ctx, transaction, status)
+	case models.TransactionTypePayout:
+		s.settlePayout(ctx, transaction, status)
+	}
+}
+
+// markTransferPending records the signature of a transfer that wasn't confirmed in time,
+// so the reconciler can settle it once its outcome is known
+func (s *BillingService) markTransferPending(transaction *models.Transaction, pending *solana.PendingTransferError) {
+	transaction.SolanaSignature = &pending.Signature
+
+	ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+	defer cancel()
+	if err := s.store.MarkTransferPending(ctx, transaction.ID, pending.Signature, pending.LastValidBlockHeight); err != nil {
+		// Without the signature the transfer has to be reconciled by hand
+		s.logger.Error("Failed to record pending transfer",
+			zap.String("transaction_id", transaction.ID.String()),
+			zap.String("signature", pending.Signature),
+			zap.Uint64("last_valid_block_height", pending.LastValidBlockHeight),
+			zap.Error(err),
+		)
+		return
+	}
+
+	s.logger.Warn("Transfer left pending until it confirms or expires",
+		zap.String("transaction_id", transaction.ID.String()),
+		zap.String("type", string(transaction.Type)),
+		zap.String("signature", pending.Signature),
+		zap.Error(pending.Err),
+	)
+}
+
+// settleWithdrawal records how a withdrawal's transfer ended and settles the funds
+// reserved for it: they are deducted if it was confirmed and released otherwise. It
+// reports whether the withdrawal is settled, by this call or an earlier one. If a
+// confirmed withdrawal can't be settled it is left pending with its signature for the
+// reconciler.
+func (s *BillingService) settleWithdrawal(ctx context.Context, transaction *models.Transaction, status models.TransactionStatus) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+	defer cancel()
+
+	amount := transaction.Amount
+	_, err := s.store.SettleTransfer(ctx, transaction.ID, status, transaction.SolanaSignature, transaction.FromWalletID, func(w *models.Wallet) error {
+		w.UnlockFunds(amount)
+		if status == models.TransactionStatusConfirmed {
+			return w.DeductFunds(amount)
+		}
+		return nil
+	})
+	if err == nil {
+		return true
+	}
+
+	s.logger.Error("Failed to settle withdrawal",
+		zap.String("transaction_id", transaction.ID.String()),
+		zap.String("status", string(status)),
+		zap.Error(err),
+	)
+	if status == models.TransactionStatusConfirmed && transaction.SolanaSignature != nil {
+		s.markTransferPending(transaction, &solana.PendingTransferError{Signature: *transaction.SolanaSignature, Err: err})
+	}
+	return false
+}
+
+// settlePayout records how a payout's transfer ended, together with its fee. A failed
+// payout no longer counts as paid out, so its earnings can be paid out again. It
+// reports whether the payout is settled; if a confirmed payout can't be, it is left
+// pending with its signature for the reconciler.
+func (s *BillingService) settlePayout(ctx context.Context, transaction *models.Transaction, status models.TransactionStatus) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+	defer cancel()
+
+	_, err := s.store.SettleTransfer(ctx, transaction.ID, status, transaction.SolanaSignature, nil, nil)
+	if err == nil {
+		return true
+	}
+
+	s.logger.Error("Failed to settle payout",
+		zap.String("transaction_id", transaction.ID.String()),
+		zap.String("status", string(status)),
+		zap.Error(err),
+	)
+	if status == models.TransactionStatusConfirmed && transaction.SolanaSignature != nil {
+		s.markTransferPending(transaction, &solana.PendingTransferError{Signature: *transaction.SolanaSignature, Err: err})
+	}
+	return false
+}
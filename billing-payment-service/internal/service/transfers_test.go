@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mr-tron/base58"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana/solanatest"
+)
+
+func TestLastValidBlockHeight(t *testing.T) {
+	tests := []struct {
+		metadata map[string]interface{}
+		want     uint64
+	}{
+		{map[string]interface{}{"last_valid_block_height": float64(1000)}, 1000},
+		{map[string]interface{}{"last_valid_block_height": float64(0)}, math.MaxUint64},
+		{map[string]interface{}{"last_valid_block_height": "1000"}, math.MaxUint64},
+		{nil, math.MaxUint64},
+	}
+	for _, tt := range tests {
+		if got := lastValidBlockHeight(&models.Transaction{Metadata: tt.metadata}); got != tt.want {
+			t.Errorf("lastValidBlockHeight(%v) = %d, want %d", tt.metadata, got, tt.want)
+		}
+	}
+}
+
+// withdraw withdraws amount from a new user wallet holding 100 and returns the wallet
+// and the withdrawal
+func withdraw(t *testing.T, env *testEnv, amount int64) (*models.Wallet, *models.Transaction) {
+	t.Helper()
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.NewFromInt(100))
+	transaction, err := env.service.ProcessWithdrawal(context.Background(), &models.WithdrawalRequest{
+		WalletID:  wallet.ID,
+		Amount:    decimal.NewFromInt(amount),
+		ToAddress: env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero).SolanaAddress,
+	})
+	if err != nil {
+		t.Fatalf("ProcessWithdrawal: %v", err)
+	}
+	return wallet, transaction
+}
+
+// assertBalances checks a wallet's balance and locked balance
+func assertBalances(t *testing.T, env *testEnv, walletID uuid.UUID, balance, locked int64) {
+	t.Helper()
+	wallet := env.wallet(t, walletID)
+	if !wallet.Balance.Equal(decimal.NewFromInt(balance)) || !wallet.LockedBalance.Equal(decimal.NewFromInt(locked)) {
+		t.Errorf("wallet balance %s, locked %s; want %d and %d", wallet.Balance, wallet.LockedBalance, balance, locked)
+	}
+}
+
+func TestProcessWithdrawalConfirmed(t *testing.T) {
+	env := newTestEnv(t)
+	wallet, transaction := withdraw(t, env, 40)
+
+	if transaction.Status != models.TransactionStatusConfirmed || transaction.SolanaSignature == nil {
+		t.Fatalf("withdrawal %s, signature %v; want confirmed with a signature", transaction.Status, transaction.SolanaSignature)
+	}
+	stored := env.transaction(t, transaction.ID)
+	if stored.Status != models.TransactionStatusConfirmed || stored.SolanaSignature == nil {
+		t.Errorf("stored withdrawal %s, signature %v", stored.Status, stored.SolanaSignature)
+	}
+	assertBalances(t, env, wallet.ID, 60, 0)
+}
+
+func TestProcessWithdrawalFailedReleasesFunds(t *testing.T) {
+	env := newTestEnv(t)
+	env.node.SetStatuses(solanatest.Failed)
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.NewFromInt(100))
+
+	_, err := env.service.ProcessWithdrawal(context.Background(), &models.WithdrawalRequest{
+		WalletID:  wallet.ID,
+		Amount:    decimal.NewFromInt(40),
+		ToAddress: env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero).SolanaAddress,
+	})
+	if err == nil {
+		t.Fatal("withdrawal that failed on chain succeeded")
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+func TestProcessWithdrawalPendingUntilConfirmed(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	// The transfer isn't confirmed in time: the funds stay reserved
+	env.node.SetStatuses(solanatest.NotSeen)
+	wallet, transaction := withdraw(t, env, 40)
+	if transaction.Status != models.TransactionStatusPending || transaction.SolanaSignature == nil {
+		t.Fatalf("withdrawal %s, signature %v; want pending with a signature", transaction.Status, transaction.SolanaSignature)
+	}
+	stored := env.transaction(t, transaction.ID)
+	if stored.Status != models.TransactionStatusPending || stored.SolanaSignature == nil || *stored.SolanaSignature != *transaction.SolanaSignature {
+		t.Fatalf("stored withdrawal %+v; want pending with the signature", stored)
+	}
+	assertBalances(t, env, wallet.ID, 100, 40)
+
+	// Recently sent transfers are left to their request
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 100, 40)
+
+	env.node.SetStatuses(solanatest.Confirmed)
+	env.ageTransaction(t, transaction.ID, 2*time.Minute)
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	if stored := env.transaction(t, transaction.ID); stored.Status != models.TransactionStatusConfirmed {
+		t.Errorf("landed withdrawal is %s, want confirmed", stored.Status)
+	}
+	assertBalances(t, env, wallet.ID, 60, 0)
+
+	// Settling is done once, however often the reconciler runs
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 60, 0)
+}
+
+func TestProcessWithdrawalPendingUntilExpired(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	env.node.SetStatuses(solanatest.NotSeen)
+	wallet, transaction := withdraw(t, env, 40)
+	env.ageTransaction(t, transaction.ID, 2*time.Minute)
+
+	// Not seen but still valid: it may land, so nothing is released
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	assertBalances(t, env, wallet.ID, 100, 40)
+
+	env.node.SetBlockHeight(solanatest.LastValidBlockHeight + 1)
+	if err := env.service.ReconcileTransfers(ctx); err != nil {
+		t.Fatalf("ReconcileTransfers: %v", err)
+	}
+	if stored := env.transaction(t, transaction.ID); stored.Status != models.TransactionStatusFailed {
+		t.Errorf("expired withdrawal is %s, want failed", stored.Status)
+	}
+	assertBalances(t, env, wallet.ID, 100, 0)
+}
+
+// depositSignature returns a new Solana transaction signature
+func depositSignature(t *testing.T) string {
+	t.Helper()
+	sig := make([]byte, 64)
+	if _, err := rand.Read(sig); err != nil {
+		t.Fatal(err)
+	}
+	return base58.Encode(sig)
+}
+
+// deposits counts the deposits recorded for a signature
+func (e *testEnv) deposits(t *testing.T, signature string) int {
+	t.Helper()
+	var count int
+	err := e.db.QueryRow(context.Background(), `SELECT COUNT(*) FROM transactions WHERE solana_signature = $1 AND type = $2`,
+		signature, models.TransactionTypeDeposit).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestProcessDepositCreditsSignatureOnce(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero)
+	req := &models.DepositRequest{WalletID: wallet.ID, Amount: decimal.NewFromInt(25), SolanaSignature: depositSignature(t)}
+
+	first, err := env.service.ProcessDeposit(ctx, req)
+	if err != nil {
+		t.Fatalf("ProcessDeposit: %v", err)
+	}
+	repeat, err := env.service.ProcessDeposit(ctx, req)
+	if err != nil {
+		t.Fatalf("repeated ProcessDeposit: %v", err)
+	}
+	if repeat.ID != first.ID {
+		t.Errorf("repeated deposit returned transaction %s, want the first one %s", repeat.ID, first.ID)
+	}
+	assertBalances(t, env, wallet.ID, 25, 0)
+	if got := env.deposits(t, req.SolanaSignature); got != 1 {
+		t.Errorf("%d deposits recorded for the signature, want 1", got)
+	}
+}
+
+func TestProcessDepositConcurrentSubmissions(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero)
+	req := &models.DepositRequest{WalletID: wallet.ID, Amount: decimal.NewFromInt(25), SolanaSignature: depositSignature(t)}
+
+	ids := make([]uuid.UUID, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			transaction, err := env.service.ProcessDeposit(ctx, req)
+			if err != nil {
+				t.Errorf("ProcessDeposit: %v", err)
+				return
+			}
+			ids[i] = transaction.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("concurrent deposits returned transactions %s and %s, want the same", ids[0], id)
+		}
+	}
+	assertBalances(t, env, wallet.ID, 25, 0)
+	if got := env.deposits(t, req.SolanaSignature); got != 1 {
+		t.Errorf("%d deposits recorded for the signature, want 1", got)
+	}
+}
+
+func TestProcessDepositSignatureOfAnotherWallet(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero)
+	other := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero)
+	signature := depositSignature(t)
+
+	if _, err := env.service.ProcessDeposit(ctx, &models.DepositRequest{
+		WalletID: wallet.ID, Amount: decimal.NewFromInt(25), SolanaSignature: signature,
+	}); err != nil {
+		t.Fatalf("ProcessDeposit: %v", err)
+	}
+	_, err := env.service.ProcessDeposit(ctx, &models.DepositRequest{
+		WalletID: other.ID, Amount: decimal.NewFromInt(25), SolanaSignature: signature,
+	})
+	if !errors.Is(err, models.ErrValidationFailed) {
+		t.Errorf("signature deposited again to another wallet: %v, want a validation error", err)
+	}
+	assertBalances(t, env, wallet.ID, 25, 0)
+	assertBalances(t, env, other.ID, 0, 0)
+}
+
+func TestProcessDepositUnconfirmed(t *testing.T) {
+	env := newTestEnv(t)
+	wallet := env.createWallet(t, "user-"+uuid.NewString(), models.WalletTypeUser, decimal.Zero)
+	env.node.SetStatuses(solanatest.Failed)
+
+	req := &models.DepositRequest{WalletID: wallet.ID, Amount: decimal.NewFromInt(25), SolanaSignature: depositSignature(t)}
+	if _, err := env.service.ProcessDeposit(context.Background(), req); err == nil {
+		t.Error("failed transaction was deposited")
+	}
+	assertBalances(t, env, wallet.ID, 0, 0)
+	if got := env.deposits(t, req.SolanaSignature); got != 0 {
+		t.Errorf("%d deposits recorded for a failed transaction", got)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/store"
+)
+
+// pendingUsage is the usage reported for a session since it was last written
+type pendingUsage struct {
+	records      []models.UsageRecord
+	cost         decimal.Decimal
+	lastBilledAt time.Time
+	powerDraw    uint32
+}
+
+// merge adds usage that was taken for a write which failed back in front of usage
+// reported since, leaving out records reported again in between
+func (p *pendingUsage) merge(later *pendingUsage) {
+	seen := make(map[uuid.UUID]bool, len(p.records))
+	for _, record := range p.records {
+		seen[record.ID] = true
+	}
+	for _, record := range later.records {
+		if !seen[record.ID] {
+			p.records = append(p.records, record)
+			p.cost = p.cost.Add(record.PeriodCost)
+		}
+	}
+	if later.lastBilledAt.After(p.lastBilledAt) {
+		p.lastBilledAt = later.lastBilledAt
+		p.powerDraw = later.powerDraw
+	}
+}
+
+// bufferUsage holds a usage record until the next flush and returns the session's
+// unwritten cost and billing time, including this record. It reports false, buffering
+// nothing, if a record with the same ID is already buffered; one already written is
+// skipped when the buffer is.
+func (s *BillingService) bufferUsage(record models.UsageRecord, now time.Time) (decimal.Decimal, time.Time, bool) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	pending, ok := s.pendingUsage[record.SessionID]
+	if !ok {
+		pending = &pendingUsage{}
+		s.pendingUsage[record.SessionID] = pending
+	}
+	for i := range pending.records {
+		if pending.records[i].ID == record.ID {
+			return pending.cost, pending.lastBilledAt, false
+		}
+	}
+	pending.records = append(pending.records, record)
+	pending.cost = pending.cost.Add(record.PeriodCost)
+	pending.lastBilledAt = now
+	pending.powerDraw = record.PowerDraw
+	return pending.cost, pending.lastBilledAt, true
+}
+
+// StartUsageFlusher writes buffered usage to the database every billing interval until
+// Stop is called. Usage updates are only held in memory in between, so the service
+// writes once per interval however many sessions report.
+func (s *BillingService) StartUsageFlusher() {
+	interval := s.config.BillingInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s.flusherStarted.Store(true)
+	go func() {
+		defer close(s.flushDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				if err := s.FlushUsage(ctx); err != nil {
+					s.logger.Error("Failed to flush buffered usage, retrying next interval", zap.Error(err))
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the usage flusher and the other background loops, and writes whatever
+// usage is still buffered, so none is lost on shutdown.
+func (s *BillingService) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	if s.flusherStarted.Load() {
+		select {
+		case <-s.flushDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	backgroundDone := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(backgroundDone)
+	}()
+	select {
+	case <-backgroundDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.FlushUsage(ctx)
+}
+
+// runEvery runs fn every interval in the background until Stop is called. Each run's
+// context expires after interval.
+func (s *BillingService) runEvery(interval time.Duration, fn func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				fn(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// FlushUsage writes all buffered usage in one transaction. Usage that fails to be
+// written stays buffered for the next flush.
+func (s *BillingService) FlushUsage(ctx context.Context) error {
+	s.usageMu.Lock()
+	pending := s.pendingUsage
+	s.pendingUsage = make(map[uuid.UUID]*pendingUsage)
+	s.usageMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := s.saveUsage(ctx, pending); err != nil {
+		s.requeueUsage(pending)
+		return err
+	}
+	return nil
+}
+
+// flushSessionUsage writes the usage buffered for one session, so that reading the
+// session afterwards sees its full cost
+func (s *BillingService) flushSessionUsage(ctx context.Context, sessionID uuid.UUID) error {
+	s.usageMu.Lock()
+	pending, ok := s.pendingUsage[sessionID]
+	delete(s.pendingUsage, sessionID)
+	s.usageMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	batch := map[uuid.UUID]*pendingUsage{sessionID: pending}
+	if err := s.saveUsage(ctx, batch); err != nil {
+		s.requeueUsage(batch)
+		return err
+	}
+	return nil
+}
+
+// getRentalSession reads a session after writing its buffered usage. Anything that
+// changes a session reads it this way.
+func (s *BillingService) getRentalSession(ctx context.Context, sessionID uuid.UUID) (*models.RentalSession, error) {
+	if err := s.flushSessionUsage(ctx, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to write buffered usage: %w", err)
+	}
+	return s.store.GetRentalSession(ctx, sessionID)
+}
+
+// applyPendingUsage adds a session's unwritten usage to a session read from the store,
+// for reporting its cost without writing first
+func (s *BillingService) applyPendingUsage(session *models.RentalSession) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	pending, ok := s.pendingUsage[session.ID]
+	if !ok {
+		return
+	}
+	powerDraw := pending.powerDraw
+	session.ActualPowerW = &powerDraw
+	session.TotalCost = session.TotalCost.Add(pending.cost)
+	if pending.lastBilledAt.After(session.LastBilledAt) {
+		session.LastBilledAt = pending.lastBilledAt
+	}
+}
+
+func (s *BillingService) saveUsage(ctx context.Context, pending map[uuid.UUID]*pendingUsage) error {
+	var records []models.UsageRecord
+	sessions := make([]store.SessionUsage, 0, len(pending))
+	for sessionID, usage := range pending {
+		records = append(records, usage.records...)
+		sessions = append(sessions, store.SessionUsage{
+			SessionID:    sessionID,
+			LastBilledAt: usage.lastBilledAt,
+			PowerDraw:    usage.powerDraw,
+		})
+	}
+
+	start := time.Now()
+	if err := s.store.SaveUsage(ctx, records, sessions); err != nil {
+		return err
+	}
+	s.logger.Debug("Buffered usage written",
+		zap.Int("sessions", len(sessions)),
+		zap.Int("records", len(records)),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
+
+func (s *BillingService) requeueUsage(pending map[uuid.UUID]*pendingUsage) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	for sessionID, usage := range pending {
+		if later, ok := s.pendingUsage[sessionID]; ok {
+			usage.merge(later)
+		}
+		s.pendingUsage[sessionID] = usage
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+func TestBufferUsageDropsRepeatedRecord(t *testing.T) {
+	s := &BillingService{pendingUsage: make(map[uuid.UUID]*pendingUsage)}
+	sessionID := uuid.New()
+	record := models.UsageRecord{ID: uuid.New(), SessionID: sessionID, PeriodCost: decimal.NewFromInt(2)}
+	now := time.Now()
+
+	if cost, _, ok := s.bufferUsage(record, now); !ok || !cost.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("first delivery: buffered %v with cost %s, want buffered at 2", ok, cost)
+	}
+	if cost, billedAt, ok := s.bufferUsage(record, now.Add(time.Minute)); ok || !cost.Equal(decimal.NewFromInt(2)) || !billedAt.Equal(now) {
+		t.Errorf("repeat: buffered %v with cost %s billed at %v, want it dropped", ok, cost, billedAt)
+	}
+	record.ID = uuid.New()
+	if cost, _, ok := s.bufferUsage(record, now); !ok || !cost.Equal(decimal.NewFromInt(4)) {
+		t.Errorf("next update: buffered %v with cost %s, want buffered at 4", ok, cost)
+	}
+	if n := len(s.pendingUsage[sessionID].records); n != 2 {
+		t.Errorf("%d records buffered, want 2", n)
+	}
+}
+
+func TestPendingUsageMergeSkipsRepeatedRecords(t *testing.T) {
+	first := models.UsageRecord{ID: uuid.New(), PeriodCost: decimal.NewFromInt(1)}
+	second := models.UsageRecord{ID: uuid.New(), PeriodCost: decimal.NewFromInt(3)}
+	failed := &pendingUsage{records: []models.UsageRecord{first}, cost: first.PeriodCost}
+	// The first update was delivered again while its write was failing
+	later := &pendingUsage{records: []models.UsageRecord{first, second}, cost: first.PeriodCost.Add(second.PeriodCost)}
+
+	failed.merge(later)
+	if len(failed.records) != 2 || !failed.cost.Equal(decimal.NewFromInt(4)) {
+		t.Errorf("merged %d records costing %s, want 2 costing 4", len(failed.records), failed.cost)
+	}
+}
+
+func TestProcessUsageUpdateRecordsRedeliveryOnce(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	userID := "user-" + uuid.NewString()
+	env.createWallet(t, userID, models.WalletTypeUser, decimal.NewFromInt(1000))
+	session := env.createSession(t, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.Zero)
+
+	update := &models.UsageUpdateRequest{
+		UpdateID:  uuid.New(),
+		SessionID: session.ID,
+		PowerDraw: 300,
+		Timestamp: time.Now().UTC(),
+	}
+	// Delivered again before the buffer is written, and again after
+	for i := 0; i < 3; i++ {
+		if err := env.service.ProcessUsageUpdate(ctx, update); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+		if i > 0 {
+			if err := env.service.FlushUsage(ctx); err != nil {
+				t.Fatalf("FlushUsage: %v", err)
+			}
+		}
+	}
+
+	records, err := env.store.GetUsageRecordsBySession(ctx, session.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != update.UpdateID {
+		t.Fatalf("got %d usage records, want the update recorded once", len(records))
+	}
+	stored, err := env.store.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.TotalCost.Equal(records[0].PeriodCost) {
+		t.Errorf("session cost %s, want one period's %s", stored.TotalCost, records[0].PeriodCost)
+	}
+}
+
+// BenchmarkUsageWrites compares writing every usage update as it arrives with
+// buffering updates and writing them once per billing interval. Each interval brings
+// one update from every session.
+func BenchmarkUsageWrites(b *testing.B) {
+	const sessionCount = 100
+	env := newTestEnv(b)
+	userID := "user-" + uuid.NewString()
+	env.createWallet(b, userID, models.WalletTypeUser, decimal.NewFromInt(1000))
+	sessions := make([]uuid.UUID, sessionCount)
+	for i := range sessions {
+		sessions[i] = env.createSession(b, userID, uuid.New(), models.SessionStatusActive, decimal.Zero, decimal.Zero).ID
+	}
+	ctx := context.Background()
+
+	usage := func(i int) models.UsageRecord {
+		now := time.Now().UTC()
+		return models.UsageRecord{
+			ID:            uuid.New(),
+			SessionID:     sessions[i%sessionCount],
+			RecordedAt:    now,
+			PowerDraw:     300,
+			PeriodMinutes: 1,
+			PeriodCost:    decimal.NewFromFloat(0.01),
+			CreatedAt:     now,
+		}
+	}
+
+	b.Run("per_update", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			record := usage(i)
+			batch := map[uuid.UUID]*pendingUsage{record.SessionID: {
+				records:      []models.UsageRecord{record},
+				cost:         record.PeriodCost,
+				lastBilledAt: record.RecordedAt,
+				powerDraw:    record.PowerDraw,
+			}}
+			if err := env.service.saveUsage(ctx, batch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			record := usage(i)
+			env.service.bufferUsage(record, record.RecordedAt)
+			if (i+1)%sessionCount == 0 {
+				if err := env.service.FlushUsage(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		if err := env.service.FlushUsage(ctx); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package solana
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// ValidateWalletAddress checks that address is a base58 encoded 32 byte public key on the
+// ed25519 curve, i.e. a key that can sign rather than a program derived address. The
+// returned error describes what is wrong with the address.
+func ValidateWalletAddress(address string) error {
+	if strings.TrimSpace(address) == "" {
+		return errors.New("address is required")
+	}
+
+	pubKey, err := solana.PublicKeyFromBase58(address)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "decode:") {
+			return errors.New("address is not valid base58")
+		}
+		return fmt.Errorf("address must decode to %d bytes", solana.PublicKeyLength)
+	}
+
+	if !pubKey.IsOnCurve() {
+		return errors.New("address is not on the ed25519 curve")
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package solana
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/mr-tron/base58"
+)
+
+func TestValidateWalletAddress(t *testing.T) {
+	programDerived, _, err := solana.FindProgramAddress([][]byte{[]byte("escrow")}, solana.SystemProgramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := solana.NewWallet().PublicKey().String()
+
+	tests := []struct {
+		name    string
+		address string
+		wantErr string // Substring of the error, empty if the address is valid
+	}{
+		{"wallet", wallet, ""},
+		{"empty", "", "address is required"},
+		{"blank", "   ", "address is required"},
+		{"zero in base58", "0" + wallet[1:], "not valid base58"},
+		{"upper case O in base58", "O" + wallet[1:], "not valid base58"},
+		{"lower case l in base58", wallet[:10] + "l" + wallet[11:], "not valid base58"},
+		{"31 bytes", base58.Encode(make([]byte, 31)), "must decode to 32 bytes"},
+		{"33 bytes", base58.Encode(append([]byte{1}, make([]byte, 32)...)), "must decode to 32 bytes"},
+		{"64 byte private key", solana.NewWallet().PrivateKey.String(), "must decode to 32 bytes"},
+		{"program derived address", programDerived.String(), "not on the ed25519 curve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWalletAddress(tt.address)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateWalletAddress(%q) = %v, want valid", tt.address, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateWalletAddress(%q) = %v, want an error saying %q", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
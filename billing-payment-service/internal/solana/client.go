@@ -2,6 +2,7 @@ package solana
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -9,8 +10,10 @@ import (
 
 	"github.com/gagliardetto/solana-go"
 	associatedtokenaccount "github.com/gagliardetto/solana-go/programs/associated-token-account"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
 	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"github.com/gagliardetto/solana-go/rpc/ws"
 	"github.com/mr-tron/base58"
 	"github.com/shopspring/decimal"
@@ -29,9 +32,15 @@ type Client struct {
 	privateKey     solana.PrivateKey
 
 	// Configuration
-	commitment rpc.CommitmentType
-	timeout    time.Duration
-	maxRetries int
+	commitment   rpc.CommitmentType
+	timeout      time.Duration
+	maxRetries   int
+	pollInterval time.Duration // Between signature status checks while confirming
+
+	// Priority fees (micro-lamports per compute unit); zero disables them
+	priorityFee      uint64
+	maxPriorityFee   uint64
+	computeUnitLimit uint32
 }
 
 // Config represents Solana client configuration
@@ -43,7 +52,56 @@ type Config struct {
 	PrivateKeyPath string        `yaml:"private_key_path"`
 	Commitment     string        `yaml:"commitment"`
 	Timeout        time.Duration `yaml:"timeout"`
-	MaxRetries     int           `yaml:"max_retries"`
+	MaxRetries     int           `yaml:"max_retries"` // Resends with a fresh blockhash when a transfer's blockhash expires
+
+	// Compute budget priority fee for transfers, in micro-lamports per compute unit.
+	// Each retry doubles the fee up to MaxPriorityFeeMicroLamports.
+	PriorityFeeMicroLamports    uint64 `yaml:"priority_fee_micro_lamports"`
+	MaxPriorityFeeMicroLamports uint64 `yaml:"max_priority_fee_micro_lamports"`
+	ComputeUnitLimit            uint32 `yaml:"compute_unit_limit"` // 0 keeps the runtime default
+}
+
+// errBlockhashExpired means a transaction can no longer land because its blockhash expired
+var errBlockhashExpired = errors.New("transaction blockhash expired")
+
+// PendingTransferError is returned by TransferTokens when a transfer was sent but it
+// isn't known whether it landed, e.g. because it wasn't confirmed within the client's
+// timeout. The transfer may still land until its last valid block height has passed,
+// so it must be treated as paid until GetTransferStatus says otherwise.
+type PendingTransferError struct {
+	Signature            string
+	LastValidBlockHeight uint64
+	Err                  error
+}
+
+func (e *PendingTransferError) Error() string {
+	return fmt.Sprintf("transfer %s not confirmed yet: %v", e.Signature, e.Err)
+}
+
+func (e *PendingTransferError) Unwrap() error {
+	return e.Err
+}
+
+// TransferStatus is what the chain says about a sent transfer
+type TransferStatus int
+
+const (
+	TransferPending   TransferStatus = iota // Not confirmed yet, but may still land
+	TransferConfirmed                       // Landed at the client's commitment level
+	TransferFailed                          // Landed with an error; nothing was transferred
+	TransferExpired                         // Never landed and no longer can; nothing was transferred
+)
+
+func (s TransferStatus) String() string {
+	switch s {
+	case TransferConfirmed:
+		return "confirmed"
+	case TransferFailed:
+		return "failed"
+	case TransferExpired:
+		return "expired"
+	}
+	return "pending"
 }
 
 // NewClient creates a new Solana client for dGPU token operations
@@ -97,6 +155,14 @@ func NewClient(cfg *Config, logger *zap.Logger) (*Client, error) {
 		commitment:     commitment,
 		timeout:        cfg.Timeout,
 		maxRetries:     cfg.MaxRetries,
+		pollInterval:   time.Second,
+
+		priorityFee:      cfg.PriorityFeeMicroLamports,
+		maxPriorityFee:   cfg.MaxPriorityFeeMicroLamports,
+		computeUnitLimit: cfg.ComputeUnitLimit,
+	}
+	if client.maxPriorityFee < client.priorityFee {
+		client.maxPriorityFee = client.priorityFee
 	}
 
 	// Test connection
@@ -162,7 +228,11 @@ func (c *Client) GetTokenBalance(ctx context.Context, walletAddress string) (dec
 	return amount.Div(divisor), nil
 }
 
-// TransferTokens transfers dGPU tokens between wallets
+// TransferTokens transfers dGPU tokens between wallets. Once a transfer is sent it is
+// no longer bound by ctx: confirmation is awaited for up to the client's timeout even if
+// the caller gives up, since a transfer abandoned midway may still land. If it isn't
+// confirmed by then a *PendingTransferError carrying its signature is returned, and the
+// transfer must be settled later with GetTransferStatus.
 func (c *Client) TransferTokens(ctx context.Context, fromAddress, toAddress string, amount decimal.Decimal) (string, error) {
 	fromPubKey, err := solana.PublicKeyFromBase58(fromAddress)
 	if err != nil {
@@ -198,50 +268,266 @@ func (c *Client) TransferTokens(ctx context.Context, fromAddress, toAddress stri
 		[]solana.PublicKey{},
 	).Build()
 
-	// Get recent blockhash
-	recent, err := c.rpcClient.GetRecentBlockhash(ctx, c.commitment)
+	// Resend with a fresh blockhash (and a higher priority fee) whenever the previous
+	// attempt's blockhash expires before it lands, which happens under congestion
+	ctx = context.WithoutCancel(ctx)
+	for attempt := 0; ; attempt++ {
+		fee := c.priorityFeeForAttempt(attempt)
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		signature, lastValidBlockHeight, err := c.sendTransfer(attemptCtx, transferInstruction, fromPubKey, fee)
+		if err == nil {
+			err = c.waitForConfirmation(attemptCtx, signature, lastValidBlockHeight)
+		}
+		cancel()
+		if err == nil {
+			c.logger.Info("Token transfer confirmed",
+				zap.String("signature", signature.String()),
+				zap.String("from", fromAddress),
+				zap.String("to", toAddress),
+				zap.String("amount", amount.String()),
+				zap.Uint64("priority_fee_micro_lamports", fee),
+				zap.Int("attempt", attempt+1),
+			)
+			return signature.String(), nil
+		}
+
+		// A transfer that may have been sent and hasn't been seen to fail or expire
+		// is left for the caller to settle
+		if !signature.IsZero() && (errors.Is(err, context.DeadlineExceeded) || isAmbiguousSendError(err)) {
+			c.logger.Warn("Token transfer not confirmed in time, leaving it pending",
+				zap.String("signature", signature.String()),
+				zap.String("from", fromAddress),
+				zap.String("to", toAddress),
+				zap.String("amount", amount.String()),
+				zap.Error(err),
+			)
+			return "", &PendingTransferError{
+				Signature:            signature.String(),
+				LastValidBlockHeight: lastValidBlockHeight,
+				Err:                  err,
+			}
+		}
+
+		if !isBlockhashError(err) || attempt >= c.maxRetries {
+			return "", err
+		}
+
+		c.logger.Warn("Token transfer blockhash expired, retrying with a fresh blockhash",
+			zap.String("from", fromAddress),
+			zap.String("to", toAddress),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", c.maxRetries),
+			zap.Error(err),
+		)
+	}
+}
+
+// isAmbiguousSendError reports whether a transaction may have reached the network
+// although sending it failed: anything but an error response from the RPC node, such
+// as a dropped connection, leaves that unknown.
+func isAmbiguousSendError(err error) bool {
+	var sendErr *sendError
+	if !errors.As(err, &sendErr) {
+		return false
+	}
+	var rpcErr *jsonrpc.RPCError
+	return !errors.As(sendErr.err, &rpcErr)
+}
+
+// sendError wraps the error from sending a signed transaction
+type sendError struct {
+	err error
+}
+
+func (e *sendError) Error() string {
+	return fmt.Sprintf("failed to send transaction: %v", e.err)
+}
+
+func (e *sendError) Unwrap() error {
+	return e.err
+}
+
+// sendTransfer builds, signs and sends a transfer with a fresh blockhash. It returns the
+// signature and the last block height at which the transaction can still land.
+func (c *Client) sendTransfer(ctx context.Context, transferInstruction solana.Instruction, payer solana.PublicKey, priorityFee uint64) (solana.Signature, uint64, error) {
+	instructions := make([]solana.Instruction, 0, 3)
+	if c.computeUnitLimit > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitLimitInstruction(c.computeUnitLimit).Build())
+	}
+	if priorityFee > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitPriceInstruction(priorityFee).Build())
+	}
+	instructions = append(instructions, transferInstruction)
+
+	// Get latest blockhash
+	latest, err := c.rpcClient.GetLatestBlockhash(ctx, c.commitment)
 	if err != nil {
-		return "", fmt.Errorf("failed to get recent blockhash: %w", err)
+		return solana.Signature{}, 0, fmt.Errorf("failed to get latest blockhash: %w", err)
 	}
 
 	// Create transaction
 	tx, err := solana.NewTransaction(
-		[]solana.Instruction{transferInstruction},
-		recent.Value.Blockhash,
-		solana.TransactionPayer(fromPubKey),
+		instructions,
+		latest.Value.Blockhash,
+		solana.TransactionPayer(payer),
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to create transaction: %w", err)
+		return solana.Signature{}, 0, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
 	// Sign transaction
 	_, err = tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
-		if key.Equals(fromPubKey) {
+		if key.Equals(payer) {
 			return &c.privateKey
 		}
 		return nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction: %w", err)
+		return solana.Signature{}, 0, fmt.Errorf("failed to sign transaction: %w", err)
 	}
 
-	// Send transaction
+	// Send transaction. Retries are handled here with a fresh blockhash, not by the RPC node.
+	// The signature is returned even if sending fails, since the transaction may have
+	// reached the node anyway.
+	maxRetries := uint(0)
 	signature, err := c.rpcClient.SendTransactionWithOpts(ctx, tx, rpc.TransactionOpts{
 		SkipPreflight:       false,
 		PreflightCommitment: c.commitment,
+		MaxRetries:          &maxRetries,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to send transaction: %w", err)
+		return tx.Signatures[0], latest.Value.LastValidBlockHeight, &sendError{err: err}
 	}
 
-	c.logger.Info("Token transfer transaction sent",
+	c.logger.Debug("Token transfer transaction sent",
 		zap.String("signature", signature.String()),
-		zap.String("from", fromAddress),
-		zap.String("to", toAddress),
-		zap.String("amount", amount.String()),
+		zap.Uint64("last_valid_block_height", latest.Value.LastValidBlockHeight),
 	)
 
-	return signature.String(), nil
+	return signature, latest.Value.LastValidBlockHeight, nil
+}
+
+// waitForConfirmation polls until the transaction reaches the configured commitment. It
+// returns errBlockhashExpired once the chain passes lastValidBlockHeight without the
+// transaction landing, at which point it can safely be re-signed and resent.
+func (c *Client) waitForConfirmation(ctx context.Context, signature solana.Signature, lastValidBlockHeight uint64) error {
+	for {
+		status, err := c.transferStatus(ctx, signature, lastValidBlockHeight)
+		switch status {
+		case TransferConfirmed:
+			return nil
+		case TransferFailed:
+			return err
+		case TransferExpired:
+			return errBlockhashExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction confirmation interrupted: %w", ctx.Err())
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// GetTransferStatus reports whether a transfer that TransferTokens left pending has
+// landed. lastValidBlockHeight is the one in its PendingTransferError. For
+// TransferFailed the error describes the failure; otherwise an error means the status
+// couldn't be determined and TransferPending is returned.
+func (c *Client) GetTransferStatus(ctx context.Context, signature string, lastValidBlockHeight uint64) (TransferStatus, error) {
+	sig, err := solana.SignatureFromBase58(signature)
+	if err != nil {
+		return TransferPending, fmt.Errorf("invalid signature: %w", err)
+	}
+	return c.transferStatus(ctx, sig, lastValidBlockHeight)
+}
+
+// transferStatus looks up a sent transaction. It is only reported expired once the
+// chain is past its last valid block height and it still isn't found: it is looked up
+// again after the block height check, since it may have landed in between.
+func (c *Client) transferStatus(ctx context.Context, signature solana.Signature, lastValidBlockHeight uint64) (TransferStatus, error) {
+	status, found, err := c.signatureStatus(ctx, signature)
+	if err != nil || found {
+		return status, err
+	}
+
+	height, err := c.rpcClient.GetBlockHeight(ctx, c.commitment)
+	if err != nil {
+		return TransferPending, fmt.Errorf("failed to get block height: %w", err)
+	}
+	if height <= lastValidBlockHeight {
+		return TransferPending, nil
+	}
+
+	status, found, err = c.signatureStatus(ctx, signature)
+	if err != nil || found {
+		return status, err
+	}
+	return TransferExpired, nil
+}
+
+// signatureStatus returns the status of a transaction the chain has seen, and whether
+// it has seen it
+func (c *Client) signatureStatus(ctx context.Context, signature solana.Signature) (TransferStatus, bool, error) {
+	result, err := c.rpcClient.GetSignatureStatuses(ctx, true, signature)
+	if errors.Is(err, rpc.ErrNotFound) {
+		return TransferPending, false, nil
+	}
+	if err != nil {
+		return TransferPending, false, fmt.Errorf("failed to get signature status: %w", err)
+	}
+	if len(result.Value) == 0 || result.Value[0] == nil {
+		return TransferPending, false, nil
+	}
+
+	status := result.Value[0]
+	if status.Err != nil {
+		return TransferFailed, true, fmt.Errorf("transaction failed: %v", status.Err)
+	}
+	if c.meetsCommitment(status.ConfirmationStatus) {
+		return TransferConfirmed, true, nil
+	}
+	return TransferPending, true, nil
+}
+
+// priorityFeeForAttempt doubles the configured priority fee on each retry, up to the maximum
+func (c *Client) priorityFeeForAttempt(attempt int) uint64 {
+	fee := c.priorityFee
+	for i := 0; i < attempt && fee > 0 && fee < c.maxPriorityFee; i++ {
+		fee *= 2
+	}
+	if fee > c.maxPriorityFee {
+		fee = c.maxPriorityFee
+	}
+	return fee
+}
+
+// meetsCommitment reports whether a confirmation status satisfies the client's commitment level
+func (c *Client) meetsCommitment(status rpc.ConfirmationStatusType) bool {
+	switch status {
+	case rpc.ConfirmationStatusProcessed:
+		return c.commitment == rpc.CommitmentProcessed
+	case rpc.ConfirmationStatusConfirmed:
+		return c.commitment == rpc.CommitmentConfirmed || c.commitment == rpc.CommitmentProcessed
+	case rpc.ConfirmationStatusFinalized:
+		return true
+	}
+	return false
+}
+
+// isBlockhashError reports whether err means the transaction's blockhash was unknown or expired
+func isBlockhashError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, errBlockhashExpired) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "BlockhashNotFound") ||
+		strings.Contains(msg, "Blockhash not found") ||
+		strings.Contains(msg, "block height exceeded")
 }
 
 // ConfirmTransaction waits for transaction confirmation
@@ -272,16 +558,7 @@ func (c *Client) ConfirmTransaction(ctx context.Context, signature string) error
 				}
 
 				// Check confirmation status
-				switch status.Value[0].ConfirmationStatus {
-				case rpc.ConfirmationStatusProcessed:
-					if c.commitment == rpc.CommitmentProcessed {
-						return nil
-					}
-				case rpc.ConfirmationStatusConfirmed:
-					if c.commitment == rpc.CommitmentConfirmed || c.commitment == rpc.CommitmentProcessed {
-						return nil
-					}
-				case rpc.ConfirmationStatusFinalized:
+				if c.meetsCommitment(status.Value[0].ConfirmationStatus) {
 					return nil
 				}
 			}
@@ -368,6 +645,11 @@ func (c *Client) CreateAssociatedTokenAccount(ctx context.Context, walletAddress
 	return ata.String(), nil
 }
 
+// PlatformWalletAddress returns the platform wallet that provider payouts are paid from
+func (c *Client) PlatformWalletAddress() string {
+	return c.platformWallet.String()
+}
+
 // Close closes the Solana client connections
 func (c *Client) Close() error {
 	if c.wsClient != nil {
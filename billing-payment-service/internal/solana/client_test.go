@@ -0,0 +1,178 @@
+package solana
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/solana/solanatest"
+)
+
+func newTestClient(t *testing.T, node *solanatest.Node, timeout time.Duration, maxRetries int) *Client {
+	t.Helper()
+	return &Client{
+		rpcClient:    rpc.New(node.Start(t)),
+		logger:       zap.NewNop(),
+		tokenMint:    solana.NewWallet().PublicKey(),
+		privateKey:   solana.NewWallet().PrivateKey,
+		commitment:   rpc.CommitmentConfirmed,
+		timeout:      timeout,
+		maxRetries:   maxRetries,
+		pollInterval: 10 * time.Millisecond,
+	}
+}
+
+func (c *Client) transferForTest(ctx context.Context) (string, error) {
+	return c.TransferTokens(ctx, c.privateKey.PublicKey().String(), solana.NewWallet().PublicKey().String(), decimal.NewFromInt(5))
+}
+
+func TestTransferTokensConfirmed(t *testing.T) {
+	node := solanatest.NewNode(10, solanatest.NotSeen, solanatest.Processed, solanatest.Confirmed)
+	client := newTestClient(t, node, time.Second, 2)
+
+	signature, err := client.transferForTest(context.Background())
+	if err != nil {
+		t.Fatalf("TransferTokens: %v", err)
+	}
+	if signature == "" {
+		t.Error("no signature returned")
+	}
+	if sends := node.Sends(); sends != 1 {
+		t.Errorf("sent %d times, want 1", sends)
+	}
+}
+
+func TestTransferTokensOutlivesCallerContext(t *testing.T) {
+	node := solanatest.NewNode(10, solanatest.NotSeen)
+	client := newTestClient(t, node, 200*time.Millisecond, 2)
+
+	// A caller that has already given up must not make an unconfirmed transfer look
+	// failed: it may still land
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := time.Now()
+	_, err := client.transferForTest(ctx)
+
+	var pending *PendingTransferError
+	if !errors.As(err, &pending) {
+		t.Fatalf("TransferTokens error = %v, want a PendingTransferError", err)
+	}
+	if pending.Signature == "" || pending.LastValidBlockHeight != solanatest.LastValidBlockHeight {
+		t.Errorf("pending transfer = %+v", pending)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("gave up confirming after %v, want the client's timeout", elapsed)
+	}
+	if sends := node.Sends(); sends != 1 {
+		t.Errorf("sent %d times, want 1", sends)
+	}
+}
+
+func TestTransferTokensRechecksBeforeResending(t *testing.T) {
+	// The chain passes the last valid block height, but the transaction turns out to
+	// have landed just before
+	node := solanatest.NewNode(solanatest.LastValidBlockHeight+1, solanatest.NotSeen, solanatest.Confirmed)
+	client := newTestClient(t, node, time.Second, 2)
+
+	if _, err := client.transferForTest(context.Background()); err != nil {
+		t.Fatalf("TransferTokens: %v", err)
+	}
+	if sends := node.Sends(); sends != 1 {
+		t.Errorf("sent %d times, want 1", sends)
+	}
+}
+
+func TestTransferTokensResendsExpired(t *testing.T) {
+	node := solanatest.NewNode(solanatest.LastValidBlockHeight+1, solanatest.NotSeen)
+	client := newTestClient(t, node, time.Second, 2)
+
+	_, err := client.transferForTest(context.Background())
+	if !errors.Is(err, errBlockhashExpired) {
+		t.Fatalf("TransferTokens error = %v, want errBlockhashExpired", err)
+	}
+	var pending *PendingTransferError
+	if errors.As(err, &pending) {
+		t.Error("an expired transfer was reported pending")
+	}
+	sends, statusChecks := node.Sends(), node.StatusChecks()
+	if sends != 3 {
+		t.Errorf("sent %d times, want 3", sends)
+	}
+	if statusChecks != 2*sends {
+		t.Errorf("checked status %d times for %d sends, want two checks per send", statusChecks, sends)
+	}
+}
+
+func TestTransferTokensFailedOnChain(t *testing.T) {
+	node := solanatest.NewNode(10, solanatest.Failed)
+	client := newTestClient(t, node, time.Second, 2)
+
+	_, err := client.transferForTest(context.Background())
+	var pending *PendingTransferError
+	if err == nil || errors.As(err, &pending) {
+		t.Fatalf("TransferTokens error = %v, want a failure", err)
+	}
+	if sends := node.Sends(); sends != 1 {
+		t.Errorf("sent %d times, want 1", sends)
+	}
+}
+
+func TestTransferTokensSendFailures(t *testing.T) {
+	// The node rejecting the transaction means it wasn't sent
+	node := solanatest.NewNode(10, solanatest.NotSeen)
+	node.FailSends("rpc")
+	client := newTestClient(t, node, time.Second, 2)
+	_, err := client.transferForTest(context.Background())
+	var pending *PendingTransferError
+	if err == nil || errors.As(err, &pending) {
+		t.Errorf("rejected send: error = %v, want a failure", err)
+	}
+
+	// A dropped connection may have delivered it
+	node = solanatest.NewNode(10, solanatest.NotSeen)
+	node.FailSends("drop")
+	client = newTestClient(t, node, time.Second, 2)
+	_, err = client.transferForTest(context.Background())
+	if !errors.As(err, &pending) || pending.Signature == "" {
+		t.Errorf("dropped send: error = %v, want a PendingTransferError", err)
+	}
+}
+
+func TestGetTransferStatus(t *testing.T) {
+	signature := solana.SignatureFromBytes(make([]byte, 64)).String()
+	tests := []struct {
+		name        string
+		blockHeight uint64
+		lastValid   uint64
+		statuses    []*rpc.SignatureStatusesResult
+		want        TransferStatus
+	}{
+		{"confirmed", 10, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.Confirmed}, TransferConfirmed},
+		{"processed only", 10, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.Processed}, TransferPending},
+		{"failed", 10, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.Failed}, TransferFailed},
+		{"not seen, still valid", 10, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.NotSeen}, TransferPending},
+		{"not seen, expired", solanatest.LastValidBlockHeight + 1, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.NotSeen}, TransferExpired},
+		{"landed while expiring", solanatest.LastValidBlockHeight + 1, solanatest.LastValidBlockHeight, []*rpc.SignatureStatusesResult{solanatest.NotSeen, solanatest.Confirmed}, TransferConfirmed},
+		{"not seen, unknown height", 1 << 40, ^uint64(0), []*rpc.SignatureStatusesResult{solanatest.NotSeen}, TransferPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := solanatest.NewNode(tt.blockHeight, tt.statuses...)
+			client := newTestClient(t, node, time.Second, 0)
+
+			got, err := client.GetTransferStatus(context.Background(), signature, tt.lastValid)
+			if got != tt.want {
+				t.Errorf("GetTransferStatus = %v (%v), want %v", got, err, tt.want)
+			}
+			if (got == TransferFailed) != (err != nil) {
+				t.Errorf("GetTransferStatus error = %v for status %v", err, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Package solanatest provides a fake Solana JSON-RPC node for tests of code that sends
+// transfers.
+package solanatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// LastValidBlockHeight is the last valid block height of every blockhash the node hands out
+const LastValidBlockHeight = 1000
+
+// Signature statuses a Node can report
+var (
+	NotSeen   *rpc.SignatureStatusesResult
+	Processed = &rpc.SignatureStatusesResult{Slot: 1, ConfirmationStatus: rpc.ConfirmationStatusProcessed}
+	Confirmed = &rpc.SignatureStatusesResult{Slot: 1, ConfirmationStatus: rpc.ConfirmationStatusConfirmed}
+	Failed    = &rpc.SignatureStatusesResult{
+		Slot:               1,
+		ConfirmationStatus: rpc.ConfirmationStatusConfirmed,
+		Err:                map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}},
+	}
+)
+
+// Node serves the RPC calls a transfer makes. Each signature status lookup returns the
+// next of Statuses, repeating the last one.
+type Node struct {
+	mu          sync.Mutex
+	blockHeight uint64
+	statuses    []*rpc.SignatureStatusesResult
+	sendFailure string
+
+	sends        int
+	statusChecks int
+}
+
+// NewNode returns a node at the given block height reporting statuses
+func NewNode(blockHeight uint64, statuses ...*rpc.SignatureStatusesResult) *Node {
+	if len(statuses) == 0 {
+		statuses = []*rpc.SignatureStatusesResult{NotSeen}
+	}
+	return &Node{blockHeight: blockHeight, statuses: statuses}
+}
+
+// Start serves the node until the test ends and returns its URL
+func (n *Node) Start(t testing.TB) string {
+	t.Helper()
+	server := httptest.NewServer(n)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// FailSends makes sendTransaction fail: "rpc" answers it with an error response, after
+// which the transaction is known not to have been sent, and "drop" closes the
+// connection without answering.
+func (n *Node) FailSends(mode string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sendFailure = mode
+}
+
+// SetStatuses replaces the statuses reported from the next lookup on
+func (n *Node) SetStatuses(statuses ...*rpc.SignatureStatusesResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.statuses = statuses
+	n.statusChecks = 0
+}
+
+// SetBlockHeight sets the node's current block height
+func (n *Node) SetBlockHeight(height uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.blockHeight = height
+}
+
+// Sends returns the number of sendTransaction calls
+func (n *Node) Sends() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sends
+}
+
+// StatusChecks returns the number of signature status lookups since the statuses were set
+func (n *Node) StatusChecks() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.statusChecks
+}
+
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var result interface{}
+	switch req.Method {
+	case "getHealth":
+		result = "ok"
+	case "getLatestBlockhash":
+		result = map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value": map[string]interface{}{
+				"blockhash":            solana.HashFromBytes(make([]byte, 32)).String(),
+				"lastValidBlockHeight": LastValidBlockHeight,
+			},
+		}
+	case "sendTransaction":
+		n.sends++
+		switch n.sendFailure {
+		case "rpc":
+			writeResponse(w, req.ID, nil, map[string]interface{}{"code": -32002, "message": "Transaction simulation failed"})
+			return
+		case "drop":
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		result = solana.SignatureFromBytes(append(make([]byte, 63), byte(n.sends))).String()
+	case "getSignatureStatuses":
+		status := n.statuses[len(n.statuses)-1]
+		if n.statusChecks < len(n.statuses) {
+			status = n.statuses[n.statusChecks]
+		}
+		n.statusChecks++
+		result = map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   []*rpc.SignatureStatusesResult{status},
+		}
+	case "getBlockHeight":
+		result = n.blockHeight
+	default:
+		http.Error(w, "unexpected method "+req.Method, http.StatusBadRequest)
+		return
+	}
+	writeResponse(w, req.ID, result, nil)
+}
+
+func writeResponse(w http.ResponseWriter, id json.RawMessage, result, rpcErr interface{}) {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
@@ -22,6 +25,12 @@ type PostgresStore struct {
 	logger *zap.Logger
 }
 
+// querier runs queries on the pool or within a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // NewPostgresStore creates a new PostgreSQL store
 func NewPostgresStore(db *pgxpool.Pool, logger *zap.Logger) *PostgresStore {
 	return &PostgresStore{
@@ -36,9 +45,15 @@ func (s *PostgresStore) Initialize(ctx context.Context) error {
 		createWalletsTable,
 		createTransactionsTable,
 		createRentalSessionsTable,
+		migrateRentalSessionsIdempotencyKey,
+		migrateRentalSessionsPause,
+		migrateRentalSessionsVersion,
+		migrateRentalSessionsGrace,
+		migrateWalletsSpendLimits,
 		createUsageRecordsTable,
 		createBillingRecordsTable,
 		createProviderRatesTable,
+		migrateProviderRatesSchedule,
 		createIndexes,
 	}
 
@@ -64,6 +79,7 @@ func (s *PostgresStore) CreateWallet(ctx context.Context, req *models.WalletCrea
 		Balance:        decimal.Zero,
 		LockedBalance:  decimal.Zero,
 		PendingBalance: decimal.Zero,
+		Timezone:       "UTC",
 		IsActive:       true,
 		CreatedAt:      time.Now().UTC(),
 		UpdatedAt:      time.Now().UTC(),
@@ -87,19 +103,33 @@ func (s *PostgresStore) CreateWallet(ctx context.Context, req *models.WalletCrea
 	return wallet, nil
 }
 
+// walletColumns are the wallet columns read by scanWallet
+const walletColumns = `
+	id, user_id, wallet_type, solana_address, balance, locked_balance, pending_balance,
+	daily_spend_limit, monthly_spend_limit, timezone,
+	is_active, created_at, updated_at, last_activity_at
+`
+
 // GetWallet retrieves a wallet by ID
 func (s *PostgresStore) GetWallet(ctx context.Context, walletID uuid.UUID) (*models.Wallet, error) {
-	wallet := &models.Wallet{}
-	query := `
-		SELECT id, user_id, wallet_type, solana_address, balance, locked_balance, pending_balance,
-		       is_active, created_at, updated_at, last_activity_at
-		FROM wallets WHERE id = $1
-	`
+	query := `SELECT ` + walletColumns + ` FROM wallets WHERE id = $1`
+	return scanWallet(s.db.QueryRow(ctx, query, walletID))
+}
 
+// GetWalletByUserID retrieves a wallet by user ID and type
+func (s *PostgresStore) GetWalletByUserID(ctx context.Context, userID string, walletType models.WalletType) (*models.Wallet, error) {
+	query := `SELECT ` + walletColumns + ` FROM wallets WHERE user_id = $1 AND wallet_type = $2`
+	return scanWallet(s.db.QueryRow(ctx, query, userID, walletType))
+}
+
+// scanWallet scans a row of walletColumns
+func scanWallet(row pgx.Row) (*models.Wallet, error) {
+	wallet := &models.Wallet{}
 	var lastActivityAt sql.NullTime
-	err := s.db.QueryRow(ctx, query, walletID).Scan(
+	err := row.Scan(
 		&wallet.ID, &wallet.UserID, &wallet.WalletType, &wallet.SolanaAddress,
 		&wallet.Balance, &wallet.LockedBalance, &wallet.PendingBalance,
+		&wallet.DailySpendLimit, &wallet.MonthlySpendLimit, &wallet.Timezone,
 		&wallet.IsActive, &wallet.CreatedAt, &wallet.UpdatedAt, &lastActivityAt,
 	)
 	if err != nil {
@@ -116,46 +146,104 @@ func (s *PostgresStore) GetWallet(ctx context.Context, walletID uuid.UUID) (*mod
 	return wallet, nil
 }
 
-// GetWalletByUserID retrieves a wallet by user ID and type
-func (s *PostgresStore) GetWalletByUserID(ctx context.Context, userID string, walletType models.WalletType) (*models.Wallet, error) {
-	wallet := &models.Wallet{}
-	query := `
-		SELECT id, user_id, wallet_type, solana_address, balance, locked_balance, pending_balance,
-		       is_active, created_at, updated_at, last_activity_at
-		FROM wallets WHERE user_id = $1 AND wallet_type = $2
-	`
-
-	var lastActivityAt sql.NullTime
-	err := s.db.QueryRow(ctx, query, userID, walletType).Scan(
-		&wallet.ID, &wallet.UserID, &wallet.WalletType, &wallet.SolanaAddress,
-		&wallet.Balance, &wallet.LockedBalance, &wallet.PendingBalance,
-		&wallet.IsActive, &wallet.CreatedAt, &wallet.UpdatedAt, &lastActivityAt,
-	)
+// WithTx runs fn in a database transaction, committing if it returns nil and rolling
+// back otherwise. fn's error is returned unchanged.
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, models.ErrWalletNotFound
-		}
-		return nil, fmt.Errorf("failed to get wallet: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx) // No-op once committed
 
-	if lastActivityAt.Valid {
-		wallet.LastActivityAt = &lastActivityAt.Time
+	if err := fn(tx); err != nil {
+		return err
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UpdateWallet changes a wallet's balance and locked balance atomically. The wallet row
+// is locked with SELECT ... FOR UPDATE and passed to mutate, and whatever balances it
+// leaves are written back in the same transaction, so concurrent updates to a wallet
+// apply one after the other instead of overwriting each other. If mutate returns an
+// error nothing is written and the error is returned unchanged. The updated wallet is
+// returned.
+func (s *PostgresStore) UpdateWallet(ctx context.Context, walletID uuid.UUID, mutate func(wallet *models.Wallet) error) (*models.Wallet, error) {
+	var wallet *models.Wallet
+	err := s.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		wallet, err = updateWalletTx(ctx, tx, walletID, mutate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// WalletSpending returns what the wallet being updated has spent since the given time
+type WalletSpending func(since time.Time) (decimal.Decimal, error)
+
+// UpdateWalletWithSpending is UpdateWallet for changes that depend on what the wallet
+// has spent, like locking funds under a spending limit. mutate runs under the wallet's
+// row lock and reads the spending in the same transaction, so concurrent updates can't
+// both pass a limit on the same spending.
+func (s *PostgresStore) UpdateWalletWithSpending(ctx context.Context, walletID uuid.UUID, mutate func(wallet *models.Wallet, spentSince WalletSpending) error) (*models.Wallet, error) {
+	var wallet *models.Wallet
+	err := s.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		wallet, err = updateWalletTx(ctx, tx, walletID, func(w *models.Wallet) error {
+			return mutate(w, func(since time.Time) (decimal.Decimal, error) {
+				return getWalletSpending(ctx, tx, walletID, since)
+			})
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 	return wallet, nil
 }
 
-// UpdateWalletBalance updates wallet balance and locked balance
-func (s *PostgresStore) UpdateWalletBalance(ctx context.Context, walletID uuid.UUID, balance, lockedBalance decimal.Decimal) error {
+// updateWalletTx is UpdateWallet within an existing database transaction
+func updateWalletTx(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, mutate func(wallet *models.Wallet) error) (*models.Wallet, error) {
+	wallet, err := scanWallet(tx.QueryRow(ctx, `SELECT `+walletColumns+` FROM wallets WHERE id = $1 FOR UPDATE`, walletID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mutate(wallet); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
 	query := `
 		UPDATE wallets
 		SET balance = $2, locked_balance = $3, updated_at = $4, last_activity_at = $4
 		WHERE id = $1
 	`
+	if _, err := tx.Exec(ctx, query, walletID, wallet.Balance, wallet.LockedBalance, now); err != nil {
+		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+	wallet.UpdatedAt = now
+	wallet.LastActivityAt = &now
+	return wallet, nil
+}
+
+// UpdateWalletSpendLimits sets a wallet's daily and monthly spending limits and the timezone they follow
+func (s *PostgresStore) UpdateWalletSpendLimits(ctx context.Context, walletID uuid.UUID, daily, monthly decimal.Decimal, timezone string) error {
+	query := `
+		UPDATE wallets
+		SET daily_spend_limit = $2, monthly_spend_limit = $3, timezone = $4, updated_at = $5
+		WHERE id = $1
+	`
 
-	result, err := s.db.Exec(ctx, query, walletID, balance, lockedBalance, time.Now().UTC())
+	result, err := s.db.Exec(ctx, query, walletID, daily, monthly, timezone, time.Now().UTC())
 	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
+		return fmt.Errorf("failed to update wallet spend limits: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
@@ -165,10 +253,166 @@ func (s *PostgresStore) UpdateWalletBalance(ctx context.Context, walletID uuid.U
 	return nil
 }
 
+// GetWalletSpending returns what a wallet has spent on GPU time since the given time:
+// settled session charges and payments, less refunds. Failed and cancelled
+// transactions are ignored.
+func (s *PostgresStore) GetWalletSpending(ctx context.Context, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	return getWalletSpending(ctx, s.db, walletID, since)
+}
+
+func getWalletSpending(ctx context.Context, q querier, walletID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE from_wallet_id = $1 AND type IN ('session_end', 'session_billing', 'payment')), 0) -
+			COALESCE(SUM(amount) FILTER (WHERE to_wallet_id = $1 AND type = 'refund'), 0)
+		FROM transactions
+		WHERE (from_wallet_id = $1 OR to_wallet_id = $1)
+		  AND status IN ('pending', 'confirmed')
+		  AND created_at >= $2
+	`
+
+	var spent decimal.Decimal
+	if err := q.QueryRow(ctx, query, walletID, since).Scan(&spent); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get wallet spending: %w", err)
+	}
+
+	if spent.IsNegative() {
+		return decimal.Zero, nil // Refunds of charges made before the window
+	}
+	return spent, nil
+}
+
+// GetProviderEarnedTotal returns the provider's share of every completed rental session
+func (s *PostgresStore) GetProviderEarnedTotal(ctx context.Context, providerID uuid.UUID) (decimal.Decimal, error) {
+	return getProviderEarnedTotal(ctx, s.db, providerID)
+}
+
+func getProviderEarnedTotal(ctx context.Context, q querier, providerID uuid.UUID) (decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(provider_earnings), 0)
+		FROM rental_sessions
+		WHERE provider_id = $1 AND status = 'completed'
+	`
+
+	var earned decimal.Decimal
+	if err := q.QueryRow(ctx, query, providerID).Scan(&earned); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get provider earnings: %w", err)
+	}
+	return earned, nil
+}
+
+// GetPlatformFees totals the platform fees on completed sessions and confirmed
+// payouts, optionally only those since the given time
+func (s *PostgresStore) GetPlatformFees(ctx context.Context, since *time.Time) (*models.PlatformFeesResponse, error) {
+	start := time.Time{}
+	if since != nil {
+		start = *since
+	}
+
+	fees := &models.PlatformFeesResponse{Since: since}
+
+	sessionQuery := `
+		SELECT COALESCE(SUM(platform_fee), 0), COUNT(*)
+		FROM rental_sessions
+		WHERE status = 'completed' AND ended_at >= $1
+	`
+	if err := s.db.QueryRow(ctx, sessionQuery, start).Scan(&fees.SessionFees, &fees.SessionCount); err != nil {
+		return nil, fmt.Errorf("failed to get session fees: %w", err)
+	}
+
+	payoutQuery := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE type = 'platform_fee' AND status = 'confirmed' AND created_at >= $1
+	`
+	if err := s.db.QueryRow(ctx, payoutQuery, start).Scan(&fees.PayoutFees); err != nil {
+		return nil, fmt.Errorf("failed to get payout fees: %w", err)
+	}
+
+	fees.TotalFees = fees.SessionFees.Add(fees.PayoutFees)
+	return fees, nil
+}
+
+// GetBillingStats counts active sessions and totals wallet balances by wallet type
+func (s *PostgresStore) GetBillingStats(ctx context.Context) (*models.BillingStats, error) {
+	stats := &models.BillingStats{
+		WalletBalances: make(map[models.WalletType]decimal.Decimal),
+		LockedBalances: make(map[models.WalletType]decimal.Decimal),
+	}
+
+	sessionQuery := `SELECT COUNT(*) FROM rental_sessions WHERE status = 'active'`
+	if err := s.db.QueryRow(ctx, sessionQuery).Scan(&stats.ActiveSessions); err != nil {
+		return nil, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	walletQuery := `
+		SELECT wallet_type, COALESCE(SUM(balance), 0), COALESCE(SUM(locked_balance), 0)
+		FROM wallets
+		GROUP BY wallet_type
+	`
+	rows, err := s.db.Query(ctx, walletQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total wallet balances: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var walletType models.WalletType
+		var balance, locked decimal.Decimal
+		if err := rows.Scan(&walletType, &balance, &locked); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet balances: %w", err)
+		}
+		stats.WalletBalances[walletType] = balance
+		stats.LockedBalances[walletType] = locked
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to total wallet balances: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetWalletPayoutTotal returns what has been paid out of a provider wallet's earnings,
+// including payout fees. Failed and cancelled payouts are ignored.
+func (s *PostgresStore) GetWalletPayoutTotal(ctx context.Context, walletID uuid.UUID) (decimal.Decimal, error) {
+	return getWalletPayoutTotal(ctx, s.db, walletID)
+}
+
+func getWalletPayoutTotal(ctx context.Context, q querier, walletID uuid.UUID) (decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE from_wallet_id = $1
+		  AND type IN ('payout', 'platform_fee')
+		  AND status IN ('pending', 'confirmed')
+	`
+
+	var paid decimal.Decimal
+	if err := q.QueryRow(ctx, query, walletID).Scan(&paid); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get wallet payouts: %w", err)
+	}
+	return paid, nil
+}
+
 // Transaction operations
 
 // CreateTransaction creates a new transaction
 func (s *PostgresStore) CreateTransaction(ctx context.Context, req *models.TransactionCreateRequest) (*models.Transaction, error) {
+	transaction, err := createTransaction(ctx, s.db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Transaction created",
+		zap.String("transaction_id", transaction.ID.String()),
+		zap.String("type", string(transaction.Type)),
+		zap.String("amount", transaction.Amount.String()),
+	)
+
+	return transaction, nil
+}
+
+func createTransaction(ctx context.Context, q querier, req *models.TransactionCreateRequest) (*models.Transaction, error) {
 	transaction := &models.Transaction{
 		ID:           uuid.New(),
 		FromWalletID: req.FromWalletID,
@@ -196,7 +440,7 @@ func (s *PostgresStore) CreateTransaction(ctx context.Context, req *models.Trans
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 
-	_, err = s.db.Exec(ctx, query,
+	_, err = q.Exec(ctx, query,
 		transaction.ID, transaction.FromWalletID, transaction.ToWalletID,
 		transaction.Type, transaction.Status, transaction.Amount, transaction.Fee,
 		transaction.Description, transaction.SessionID, transaction.JobID,
@@ -206,15 +450,64 @@ func (s *PostgresStore) CreateTransaction(ctx context.Context, req *models.Trans
 		return nil, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
-	s.logger.Info("Transaction created",
-		zap.String("transaction_id", transaction.ID.String()),
-		zap.String("type", string(transaction.Type)),
-		zap.String("amount", transaction.Amount.String()),
-	)
-
 	return transaction, nil
 }
 
+// RecordPayout records a provider payout, and its fee unless feeReq is nil, under the
+// provider wallet's row lock. Payouts requested at the same time, on any instance, are
+// thus recorded one after the other, each seeing the earnings the ones before paid out.
+// check is given the provider's unpaid earnings and nothing is recorded if it returns
+// an error, which is returned unchanged. The fee is linked to the payout through its
+// payout_transaction_id metadata.
+func (s *PostgresStore) RecordPayout(ctx context.Context, providerID, walletID uuid.UUID, check func(available decimal.Decimal) error, payoutReq, feeReq *models.TransactionCreateRequest) (payout, fee *models.Transaction, available decimal.Decimal, err error) {
+	err = s.WithTx(ctx, func(tx pgx.Tx) error {
+		var locked uuid.UUID
+		if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE id = $1 FOR UPDATE`, walletID).Scan(&locked); err != nil {
+			if err == pgx.ErrNoRows {
+				return models.ErrWalletNotFound
+			}
+			return fmt.Errorf("failed to lock provider wallet: %w", err)
+		}
+
+		earned, err := getProviderEarnedTotal(ctx, tx, providerID)
+		if err != nil {
+			return err
+		}
+		paid, err := getWalletPayoutTotal(ctx, tx, walletID)
+		if err != nil {
+			return err
+		}
+		available = earned.Sub(paid)
+		if err := check(available); err != nil {
+			return err
+		}
+
+		if payout, err = createTransaction(ctx, tx, payoutReq); err != nil {
+			return err
+		}
+		if feeReq != nil {
+			if feeReq.Metadata == nil {
+				feeReq.Metadata = make(map[string]interface{})
+			}
+			feeReq.Metadata["payout_transaction_id"] = payout.ID.String()
+			if fee, err = createTransaction(ctx, tx, feeReq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, decimal.Zero, err
+	}
+
+	s.logger.Info("Payout recorded",
+		zap.String("provider_id", providerID.String()),
+		zap.String("transaction_id", payout.ID.String()),
+		zap.String("amount", payout.Amount.String()),
+	)
+	return payout, fee, available, nil
+}
+
 // UpdateTransactionStatus updates transaction status and signature
 func (s *PostgresStore) UpdateTransactionStatus(ctx context.Context, transactionID uuid.UUID, status models.TransactionStatus, signature *string) error {
 	var confirmedAt *time.Time
@@ -241,18 +534,120 @@ func (s *PostgresStore) UpdateTransactionStatus(ctx context.Context, transaction
 	return nil
 }
 
-// GetTransaction retrieves a transaction by ID
-func (s *PostgresStore) GetTransaction(ctx context.Context, transactionID uuid.UUID) (*models.Transaction, error) {
-	transaction := &models.Transaction{}
+// MarkTransferPending records the signature of a transfer that was sent but not yet
+// confirmed, and the block height after which it can no longer land. The transaction
+// stays pending until SettleTransfer is called.
+func (s *PostgresStore) MarkTransferPending(ctx context.Context, transactionID uuid.UUID, signature string, lastValidBlockHeight uint64) error {
 	query := `
-		SELECT id, from_wallet_id, to_wallet_id, type, status, amount, fee, description,
-		       solana_signature, session_id, job_id, metadata, created_at, updated_at, confirmed_at
-		FROM transactions WHERE id = $1
+		UPDATE transactions
+		SET solana_signature = $2,
+		    metadata = COALESCE(metadata, '{}'::jsonb) || jsonb_build_object('last_valid_block_height', $3::bigint),
+		    updated_at = $4
+		WHERE id = $1 AND status = 'pending'
 	`
+	result, err := s.db.Exec(ctx, query, transactionID, signature, int64(lastValidBlockHeight), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to mark transfer pending: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return models.ErrTransactionNotFound
+	}
+	return nil
+}
+
+// GetPendingTransfers returns the pending transactions of the given types that have a
+// signature and haven't been updated since before
+func (s *PostgresStore) GetPendingTransfers(ctx context.Context, types []models.TransactionType, before time.Time) ([]*models.Transaction, error) {
+	typeNames := make([]string, len(types))
+	for i, t := range types {
+		typeNames[i] = string(t)
+	}
+
+	query := `SELECT ` + transactionColumns + ` FROM transactions
+		WHERE status = 'pending' AND solana_signature IS NOT NULL AND type = ANY($1) AND updated_at < $2
+		ORDER BY created_at`
+	rows, err := s.db.Query(ctx, query, typeNames, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending transfers: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []*models.Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transaction)
+	}
+	return transfers, rows.Err()
+}
+
+// SettleTransfer moves a pending transfer to status, recording its signature if one is
+// given, and if walletID is set applies settle to the wallet in the same database
+// transaction. Fees linked to the transfer through their payout_transaction_id metadata
+// move to status with it. It returns false without changing anything if the transfer
+// is no longer pending, e.g. because another instance settled it first.
+func (s *PostgresStore) SettleTransfer(ctx context.Context, transactionID uuid.UUID, status models.TransactionStatus, signature *string, walletID *uuid.UUID, settle func(wallet *models.Wallet) error) (bool, error) {
+	settled := false
+	err := s.WithTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now().UTC()
+		var confirmedAt *time.Time
+		if status == models.TransactionStatusConfirmed {
+			confirmedAt = &now
+		}
+
+		query := `
+			UPDATE transactions
+			SET status = $2, confirmed_at = $3, updated_at = $4, solana_signature = COALESCE($5, solana_signature)
+			WHERE id = $1 AND status = 'pending'
+		`
+		result, err := tx.Exec(ctx, query, transactionID, status, confirmedAt, now, signature)
+		if err != nil {
+			return fmt.Errorf("failed to update transaction status: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return nil
+		}
+
+		feeQuery := `
+			UPDATE transactions
+			SET status = $2, confirmed_at = $3, updated_at = $4
+			WHERE type = 'platform_fee' AND status = 'pending' AND metadata->>'payout_transaction_id' = $1
+		`
+		if _, err := tx.Exec(ctx, feeQuery, transactionID.String(), status, confirmedAt, now); err != nil {
+			return fmt.Errorf("failed to update fee transaction status: %w", err)
+		}
+
+		if walletID != nil {
+			if _, err := updateWalletTx(ctx, tx, *walletID, settle); err != nil {
+				return err
+			}
+		}
+		settled = true
+		return nil
+	})
+	return settled, err
+}
+
+// transactionColumns are the transaction columns read by scanTransaction
+const transactionColumns = `
+	id, from_wallet_id, to_wallet_id, type, status, amount, fee, description,
+	solana_signature, session_id, job_id, metadata, created_at, updated_at, confirmed_at
+`
 
+// GetTransaction retrieves a transaction by ID
+func (s *PostgresStore) GetTransaction(ctx context.Context, transactionID uuid.UUID) (*models.Transaction, error) {
+	query := `SELECT ` + transactionColumns + ` FROM transactions WHERE id = $1`
+	return scanTransaction(s.db.QueryRow(ctx, query, transactionID))
+}
+
+// scanTransaction scans a row of transactionColumns
+func scanTransaction(row pgx.Row) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
 	var metadataJSON []byte
 	var confirmedAt sql.NullTime
-	err := s.db.QueryRow(ctx, query, transactionID).Scan(
+	err := row.Scan(
 		&transaction.ID, &transaction.FromWalletID, &transaction.ToWalletID,
 		&transaction.Type, &transaction.Status, &transaction.Amount, &transaction.Fee,
 		&transaction.Description, &transaction.SolanaSignature, &transaction.SessionID,
@@ -279,6 +674,190 @@ func (s *PostgresStore) GetTransaction(ctx context.Context, transactionID uuid.U
 	return transaction, nil
 }
 
+// CreditDeposit records a confirmed deposit and adds it to the wallet balance in one
+// database transaction. A Solana signature can only be credited once: if a deposit
+// with the signature already exists, it is returned with duplicate set and nothing
+// is credited. Concurrent requests for the same signature wait on the unique index,
+// so only one of them credits.
+func (s *PostgresStore) CreditDeposit(ctx context.Context, walletID uuid.UUID, amount decimal.Decimal, signature string, metadata map[string]interface{}) (transaction *models.Transaction, duplicate bool, err error) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin deposit: %w", err)
+	}
+	defer tx.Rollback(ctx) // No-op once committed
+
+	now := time.Now().UTC()
+	transaction = &models.Transaction{
+		ID:              uuid.New(),
+		ToWalletID:      &walletID,
+		Type:            models.TransactionTypeDeposit,
+		Status:          models.TransactionStatusConfirmed,
+		Amount:          amount,
+		Fee:             decimal.Zero,
+		Description:     "dGPU token deposit",
+		SolanaSignature: &signature,
+		Metadata:        metadata,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ConfirmedAt:     &now,
+	}
+
+	insert := `
+		INSERT INTO transactions (id, to_wallet_id, type, status, amount, fee, description,
+		                          solana_signature, metadata, created_at, updated_at, confirmed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $10)
+		ON CONFLICT (solana_signature) WHERE type = 'deposit' DO NOTHING
+	`
+	result, err := tx.Exec(ctx, insert,
+		transaction.ID, walletID, transaction.Type, transaction.Status, amount, transaction.Fee,
+		transaction.Description, signature, metadataJSON, now,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record deposit: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		existing, err := scanTransaction(tx.QueryRow(ctx,
+			`SELECT `+transactionColumns+` FROM transactions WHERE solana_signature = $1 AND type = 'deposit'`,
+			signature,
+		))
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, true, nil
+	}
+
+	update := `
+		UPDATE wallets
+		SET balance = balance + $2, updated_at = $3, last_activity_at = $3
+		WHERE id = $1
+	`
+	result, err = tx.Exec(ctx, update, walletID, amount, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to credit wallet: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, false, models.ErrWalletNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to commit deposit: %w", err)
+	}
+
+	s.logger.Info("Deposit credited",
+		zap.String("transaction_id", transaction.ID.String()),
+		zap.String("wallet_id", walletID.String()),
+		zap.String("amount", amount.String()),
+	)
+	return transaction, false, nil
+}
+
+// GetTransactionHistory retrieves a page of transactions to or from a wallet, newest first
+func (s *PostgresStore) GetTransactionHistory(ctx context.Context, req *models.TransactionHistoryRequest) (*models.TransactionHistoryResponse, error) {
+	whereClause := "WHERE 1=1"
+	args := []interface{}{}
+	argIndex := 1
+
+	if req.WalletID != nil {
+		whereClause += fmt.Sprintf(" AND (from_wallet_id = $%d OR to_wallet_id = $%d)", argIndex, argIndex)
+		args = append(args, *req.WalletID)
+		argIndex++
+	}
+
+	if req.Type != nil {
+		whereClause += fmt.Sprintf(" AND type = $%d", argIndex)
+		args = append(args, *req.Type)
+		argIndex++
+	}
+
+	if req.Status != nil {
+		whereClause += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, *req.Status)
+		argIndex++
+	}
+
+	if req.StartDate != nil {
+		whereClause += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+		args = append(args, *req.StartDate)
+		argIndex++
+	}
+
+	if req.EndDate != nil {
+		whereClause += fmt.Sprintf(" AND created_at <= $%d", argIndex)
+		args = append(args, *req.EndDate)
+		argIndex++
+	}
+
+	// Count total records
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM transactions %s", whereClause)
+	var total int
+	err := s.db.QueryRow(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count transactions: %w", err)
+	}
+
+	// Get records with pagination
+	query := fmt.Sprintf(`
+		SELECT id, from_wallet_id, to_wallet_id, type, status, amount, fee, description,
+		       solana_signature, session_id, job_id, metadata, created_at, updated_at, confirmed_at
+		FROM transactions %s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, whereClause, argIndex, argIndex+1)
+
+	args = append(args, req.Limit, req.Offset)
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := make([]models.Transaction, 0)
+	for rows.Next() {
+		var transaction models.Transaction
+		var metadataJSON []byte
+		var confirmedAt sql.NullTime
+
+		err := rows.Scan(
+			&transaction.ID, &transaction.FromWalletID, &transaction.ToWalletID,
+			&transaction.Type, &transaction.Status, &transaction.Amount, &transaction.Fee,
+			&transaction.Description, &transaction.SolanaSignature, &transaction.SessionID,
+			&transaction.JobID, &metadataJSON, &transaction.CreatedAt, &transaction.UpdatedAt,
+			&confirmedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		if confirmedAt.Valid {
+			transaction.ConfirmedAt = &confirmedAt.Time
+		}
+
+		if len(metadataJSON) > 0 {
+			if err := json.Unmarshal(metadataJSON, &transaction.Metadata); err != nil {
+				s.logger.Warn("Failed to unmarshal transaction metadata", zap.Error(err))
+			}
+		}
+
+		transactions = append(transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", err)
+	}
+
+	return &models.TransactionHistoryResponse{
+		Transactions: transactions,
+		Total:        total,
+		Limit:        req.Limit,
+		Offset:       req.Offset,
+	}, nil
+}
+
 // Rental Session operations
 
 // CreateRentalSession creates a new rental session
@@ -293,8 +872,10 @@ func (s *PostgresStore) CreateRentalSession(ctx context.Context, session *models
 			id, user_id, provider_id, job_id, status, gpu_model, allocated_vram_mb, total_vram_mb,
 			vram_percentage, hourly_rate, vram_rate, power_rate, platform_fee_rate, estimated_power_w,
 			actual_power_w, started_at, ended_at, last_billed_at, total_cost, platform_fee,
-			provider_earnings, metadata, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+			provider_earnings, metadata, created_at, updated_at, idempotency_key, paused_at, paused_seconds,
+			locked_amount
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25,
+			$26, $27, $28)
 	`
 
 	_, err = s.db.Exec(ctx, query,
@@ -303,9 +884,14 @@ func (s *PostgresStore) CreateRentalSession(ctx context.Context, session *models
 		session.HourlyRate, session.VRAMRate, session.PowerRate, session.PlatformFeeRate,
 		session.EstimatedPowerW, session.ActualPowerW, session.StartedAt, session.EndedAt,
 		session.LastBilledAt, session.TotalCost, session.PlatformFee, session.ProviderEarnings,
-		metadataJSON, session.CreatedAt, session.UpdatedAt,
+		metadataJSON, session.CreatedAt, session.UpdatedAt, session.IdempotencyKey, session.PausedAt,
+		session.PausedSeconds, session.LockedAmount,
 	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_rental_sessions_user_idempotency_key" {
+			return models.ErrDuplicateIdempotencyKey
+		}
 		return fmt.Errorf("failed to create rental session: %w", err)
 	}
 
@@ -320,12 +906,13 @@ func (s *PostgresStore) GetRentalSession(ctx context.Context, sessionID uuid.UUI
 		SELECT id, user_id, provider_id, job_id, status, gpu_model, allocated_vram_mb, total_vram_mb,
 		       vram_percentage, hourly_rate, vram_rate, power_rate, platform_fee_rate, estimated_power_w,
 		       actual_power_w, started_at, ended_at, last_billed_at, total_cost, platform_fee,
-		       provider_earnings, metadata, created_at, updated_at
+		       provider_earnings, metadata, created_at, updated_at, idempotency_key, paused_at,
+		       paused_seconds, locked_amount, version
 		FROM rental_sessions WHERE id = $1
 	`
 
 	var metadataJSON []byte
-	var endedAt sql.NullTime
+	var endedAt, pausedAt sql.NullTime
 	var actualPowerW sql.NullInt32
 	err := s.db.QueryRow(ctx, query, sessionID).Scan(
 		&session.ID, &session.UserID, &session.ProviderID, &session.JobID, &session.Status,
@@ -333,7 +920,8 @@ func (s *PostgresStore) GetRentalSession(ctx context.Context, sessionID uuid.UUI
 		&session.HourlyRate, &session.VRAMRate, &session.PowerRate, &session.PlatformFeeRate,
 		&session.EstimatedPowerW, &actualPowerW, &session.StartedAt, &endedAt,
 		&session.LastBilledAt, &session.TotalCost, &session.PlatformFee, &session.ProviderEarnings,
-		&metadataJSON, &session.CreatedAt, &session.UpdatedAt,
+		&metadataJSON, &session.CreatedAt, &session.UpdatedAt, &session.IdempotencyKey, &pausedAt,
+		&session.PausedSeconds, &session.LockedAmount, &session.Version,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -345,6 +933,9 @@ func (s *PostgresStore) GetRentalSession(ctx context.Context, sessionID uuid.UUI
 	if endedAt.Valid {
 		session.EndedAt = &endedAt.Time
 	}
+	if pausedAt.Valid {
+		session.PausedAt = &pausedAt.Time
+	}
 	if actualPowerW.Valid {
 		actualPower := uint32(actualPowerW.Int32)
 		session.ActualPowerW = &actualPower
@@ -359,8 +950,125 @@ func (s *PostgresStore) GetRentalSession(ctx context.Context, sessionID uuid.UUI
 	return session, nil
 }
 
-// UpdateRentalSession updates a rental session
+// GetRentalSessionIDByIdempotencyKey returns the ID of the session the user started with the given key
+func (s *PostgresStore) GetRentalSessionIDByIdempotencyKey(ctx context.Context, userID, key string) (uuid.UUID, error) {
+	var sessionID uuid.UUID
+	query := `SELECT id FROM rental_sessions WHERE user_id = $1 AND idempotency_key = $2`
+
+	err := s.db.QueryRow(ctx, query, userID, key).Scan(&sessionID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return uuid.Nil, models.ErrSessionNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to get rental session by idempotency key: %w", err)
+	}
+
+	return sessionID, nil
+}
+
+// UpdateRentalSession updates a rental session if it is still at the version it was read
+// at, and increments the version. If it was changed in the meantime nothing is written
+// and models.ErrSessionConflict is returned, so the caller can retry with a fresh read.
 func (s *PostgresStore) UpdateRentalSession(ctx context.Context, session *models.RentalSession) error {
+	return updateRentalSession(ctx, s.db, session)
+}
+
+// EndRentalSession writes an ended session as UpdateRentalSession does, and in the same
+// database transaction applies settle to the user's wallet as UpdateWallet does and
+// records txnReq, so the session is never ended without being paid for or paid for
+// without being ended. settle runs before the session and txnReq are written, so it
+// may still adjust them to what was actually charged. If the session changed since it
+// was read, or settle returns an error, nothing is written and the error is returned
+// unchanged. The updated wallet is returned.
+func (s *PostgresStore) EndRentalSession(ctx context.Context, session *models.RentalSession, walletID uuid.UUID, settle func(wallet *models.Wallet) error, txnReq *models.TransactionCreateRequest) (*models.Wallet, error) {
+	version := session.Version
+	var wallet *models.Wallet
+	err := s.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if wallet, err = updateWalletTx(ctx, tx, walletID, settle); err != nil {
+			return err
+		}
+		if err := updateRentalSession(ctx, tx, session); err != nil {
+			return err
+		}
+		if txnReq != nil {
+			if _, err := createTransaction(ctx, tx, txnReq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		session.Version = version // Rolled back
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// RefundRentalSession writes a cancelled session, releases the funds it had locked and
+// gives back what the user's wallet actually paid for it, all in one database
+// transaction. The amount paid is the sum of the session's charges to the wallet less
+// earlier refunds, so costs that were never collected aren't refunded. If anything was
+// paid, txnReq is recorded for that amount. The session write fails with
+// models.ErrSessionConflict if it changed since it was read. The updated wallet and the
+// refunded amount are returned.
+func (s *PostgresStore) RefundRentalSession(ctx context.Context, session *models.RentalSession, walletID uuid.UUID, unlocked decimal.Decimal, txnReq *models.TransactionCreateRequest) (*models.Wallet, decimal.Decimal, error) {
+	version := session.Version
+	var wallet *models.Wallet
+	var paid decimal.Decimal
+	err := s.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if paid, err = getSessionPayments(ctx, tx, session.ID, walletID); err != nil {
+			return err
+		}
+		wallet, err = updateWalletTx(ctx, tx, walletID, func(w *models.Wallet) error {
+			w.UnlockFunds(unlocked)
+			w.AddFunds(paid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := updateRentalSession(ctx, tx, session); err != nil {
+			return err
+		}
+		if paid.IsPositive() {
+			txnReq.Amount = paid
+			if _, err := createTransaction(ctx, tx, txnReq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		session.Version = version // Rolled back
+		return nil, decimal.Zero, err
+	}
+	return wallet, paid, nil
+}
+
+// getSessionPayments returns what the wallet paid for the session, less what was
+// already refunded. Failed and cancelled transactions are ignored.
+func getSessionPayments(ctx context.Context, q querier, sessionID, walletID uuid.UUID) (decimal.Decimal, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE from_wallet_id = $2 AND type IN ('session_end', 'session_billing', 'payment')), 0) -
+			COALESCE(SUM(amount) FILTER (WHERE to_wallet_id = $2 AND type = 'refund'), 0)
+		FROM transactions
+		WHERE session_id = $1
+		  AND (from_wallet_id = $2 OR to_wallet_id = $2)
+		  AND status IN ('pending', 'confirmed')
+	`
+
+	var paid decimal.Decimal
+	if err := q.QueryRow(ctx, query, sessionID, walletID).Scan(&paid); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get session payments: %w", err)
+	}
+	return decimal.Max(paid, decimal.Zero), nil
+}
+
+// updateRentalSession is UpdateRentalSession on q
+func updateRentalSession(ctx context.Context, q querier, session *models.RentalSession) error {
 	metadataJSON, err := json.Marshal(session.Metadata)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
@@ -369,32 +1077,87 @@ func (s *PostgresStore) UpdateRentalSession(ctx context.Context, session *models
 	query := `
 		UPDATE rental_sessions SET
 			status = $2, actual_power_w = $3, ended_at = $4, last_billed_at = $5,
-			total_cost = $6, platform_fee = $7, provider_earnings = $8, metadata = $9, updated_at = $10
-		WHERE id = $1
+			total_cost = $6, platform_fee = $7, provider_earnings = $8, metadata = $9, updated_at = $10,
+			paused_at = $11, paused_seconds = $12, locked_amount = $13, version = version + 1
+		WHERE id = $1 AND version = $14
 	`
 
-	result, err := s.db.Exec(ctx, query,
+	result, err := q.Exec(ctx, query,
 		session.ID, session.Status, session.ActualPowerW, session.EndedAt, session.LastBilledAt,
 		session.TotalCost, session.PlatformFee, session.ProviderEarnings, metadataJSON, time.Now().UTC(),
+		session.PausedAt, session.PausedSeconds, session.LockedAmount, session.Version,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update rental session: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := q.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM rental_sessions WHERE id = $1)`, session.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check rental session: %w", err)
+		}
+		if exists {
+			return models.ErrSessionConflict
+		}
 		return models.ErrSessionNotFound
 	}
 
+	session.Version++
 	return nil
 }
 
+// StartSessionGrace sets the end of an active session's insufficient funds grace period,
+// unless one is already running. It reports whether the grace period was started, so
+// that of several instances noticing the shortfall only one notifies the user.
+func (s *PostgresStore) StartSessionGrace(ctx context.Context, sessionID uuid.UUID, endsAt time.Time) (bool, error) {
+	query := `UPDATE rental_sessions SET grace_ends_at = $2 WHERE id = $1 AND status = 'active' AND grace_ends_at IS NULL`
+	result, err := s.db.Exec(ctx, query, sessionID, endsAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to start session grace period: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ClearSessionGrace cancels a session's insufficient funds grace period and reports
+// whether one was running
+func (s *PostgresStore) ClearSessionGrace(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	query := `UPDATE rental_sessions SET grace_ends_at = NULL WHERE id = $1 AND grace_ends_at IS NOT NULL`
+	result, err := s.db.Exec(ctx, query, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear session grace period: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetSessionsPastGrace returns the active sessions whose insufficient funds grace period
+// ended at or before now
+func (s *PostgresStore) GetSessionsPastGrace(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	query := `SELECT id FROM rental_sessions WHERE status = 'active' AND grace_ends_at <= $1 ORDER BY grace_ends_at`
+	rows, err := s.db.Query(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions past grace: %w", err)
+	}
+	defer rows.Close()
+
+	var sessionIDs []uuid.UUID
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs, rows.Err()
+}
+
 // GetActiveSessionsByUser retrieves active sessions for a user
 func (s *PostgresStore) GetActiveSessionsByUser(ctx context.Context, userID string) ([]models.RentalSession, error) {
 	query := `
 		SELECT id, user_id, provider_id, job_id, status, gpu_model, allocated_vram_mb, total_vram_mb,
 		       vram_percentage, hourly_rate, vram_rate, power_rate, platform_fee_rate, estimated_power_w,
 		       actual_power_w, started_at, ended_at, last_billed_at, total_cost, platform_fee,
-		       provider_earnings, metadata, created_at, updated_at
+		       provider_earnings, metadata, created_at, updated_at, idempotency_key, paused_at,
+		       paused_seconds, locked_amount, version
 		FROM rental_sessions
 		WHERE user_id = $1 AND status = 'active'
 		ORDER BY started_at DESC
@@ -410,7 +1173,7 @@ func (s *PostgresStore) GetActiveSessionsByUser(ctx context.Context, userID stri
 	for rows.Next() {
 		var session models.RentalSession
 		var metadataJSON []byte
-		var endedAt sql.NullTime
+		var endedAt, pausedAt sql.NullTime
 		var actualPowerW sql.NullInt32
 
 		err := rows.Scan(
@@ -419,7 +1182,8 @@ func (s *PostgresStore) GetActiveSessionsByUser(ctx context.Context, userID stri
 			&session.HourlyRate, &session.VRAMRate, &session.PowerRate, &session.PlatformFeeRate,
 			&session.EstimatedPowerW, &actualPowerW, &session.StartedAt, &endedAt,
 			&session.LastBilledAt, &session.TotalCost, &session.PlatformFee, &session.ProviderEarnings,
-			&metadataJSON, &session.CreatedAt, &session.UpdatedAt,
+			&metadataJSON, &session.CreatedAt, &session.UpdatedAt, &session.IdempotencyKey, &pausedAt,
+			&session.PausedSeconds, &session.LockedAmount, &session.Version,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
@@ -428,6 +1192,9 @@ func (s *PostgresStore) GetActiveSessionsByUser(ctx context.Context, userID stri
 		if endedAt.Valid {
 			session.EndedAt = &endedAt.Time
 		}
+		if pausedAt.Valid {
+			session.PausedAt = &pausedAt.Time
+		}
 		if actualPowerW.Valid {
 			actualPower := uint32(actualPowerW.Int32)
 			session.ActualPowerW = &actualPower
@@ -468,6 +1235,104 @@ func (s *PostgresStore) CreateUsageRecord(ctx context.Context, record *models.Us
 	return nil
 }
 
+// SessionUsage is the latest billing state of a session whose usage is being written
+type SessionUsage struct {
+	SessionID    uuid.UUID
+	LastBilledAt time.Time
+	PowerDraw    uint32
+}
+
+// usageRecordColumns are the usage_records columns written by SaveUsage
+var usageRecordColumns = []string{
+	"id", "session_id", "recorded_at", "gpu_utilization_percent", "vram_utilization_percent",
+	"power_draw_w", "temperature_c", "period_minutes", "period_cost", "created_at",
+}
+
+// SaveUsage writes buffered usage in one transaction: the records are copied into a
+// temporary table and inserted from there, skipping any already stored, and the cost of
+// those inserted is added to each session's total in a single batch. A usage update
+// delivered twice is therefore charged once. Totals are incremented rather than
+// overwritten, and only active sessions accrue.
+//
+// Usage writes increment the session's version like any other update. Pausing, ending
+// and refunding a session write its total cost from what they read, so one that read
+// the session before usage was written must start over rather than overwrite it.
+func (s *PostgresStore) SaveUsage(ctx context.Context, records []models.UsageRecord, sessions []SessionUsage) error {
+	return s.WithTx(ctx, func(tx pgx.Tx) error {
+		costs, err := insertUsageRecords(ctx, tx, records)
+		if err != nil {
+			return err
+		}
+
+		if len(sessions) == 0 {
+			return nil
+		}
+		batch := &pgx.Batch{}
+		for _, usage := range sessions {
+			batch.Queue(`
+				UPDATE rental_sessions SET
+					total_cost = total_cost + $2, last_billed_at = GREATEST(last_billed_at, $3),
+					actual_power_w = $4, updated_at = $5, version = version + 1
+				WHERE id = $1 AND status = 'active'
+			`, usage.SessionID, costs[usage.SessionID], usage.LastBilledAt, usage.PowerDraw, time.Now().UTC())
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to update session usage totals: %w", err)
+		}
+		return nil
+	})
+}
+
+// insertUsageRecords inserts the records that aren't stored yet and returns the cost of
+// those inserted per session
+func insertUsageRecords(ctx context.Context, tx pgx.Tx, records []models.UsageRecord) (map[uuid.UUID]decimal.Decimal, error) {
+	costs := make(map[uuid.UUID]decimal.Decimal)
+	if len(records) == 0 {
+		return costs, nil
+	}
+
+	if _, err := tx.Exec(ctx, `CREATE TEMPORARY TABLE incoming_usage_records (LIKE usage_records) ON COMMIT DROP`); err != nil {
+		return nil, fmt.Errorf("failed to create usage records table: %w", err)
+	}
+	rows := pgx.CopyFromSlice(len(records), func(i int) ([]interface{}, error) {
+		r := &records[i]
+		return []interface{}{
+			r.ID, r.SessionID, r.RecordedAt, r.GPUUtilization, r.VRAMUtilization,
+			r.PowerDraw, r.Temperature, r.PeriodMinutes, r.PeriodCost, r.CreatedAt,
+		}, nil
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"incoming_usage_records"}, usageRecordColumns, rows); err != nil {
+		return nil, fmt.Errorf("failed to copy usage records: %w", err)
+	}
+
+	columns := strings.Join(usageRecordColumns, ", ")
+	inserted, err := tx.Query(ctx, `
+		WITH inserted AS (
+			INSERT INTO usage_records (`+columns+`)
+			SELECT `+columns+` FROM incoming_usage_records
+			ON CONFLICT (id) DO NOTHING
+			RETURNING session_id, period_cost
+		)
+		SELECT session_id, SUM(period_cost) FROM inserted GROUP BY session_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert usage records: %w", err)
+	}
+	defer inserted.Close()
+	for inserted.Next() {
+		var sessionID uuid.UUID
+		var cost decimal.Decimal
+		if err := inserted.Scan(&sessionID, &cost); err != nil {
+			return nil, fmt.Errorf("failed to scan inserted usage: %w", err)
+		}
+		costs[sessionID] = cost
+	}
+	if err := inserted.Err(); err != nil {
+		return nil, fmt.Errorf("failed to insert usage records: %w", err)
+	}
+	return costs, nil
+}
+
 // GetUsageRecordsBySession retrieves usage records for a session
 func (s *PostgresStore) GetUsageRecordsBySession(ctx context.Context, sessionID uuid.UUID, limit int) ([]models.UsageRecord, error) {
 	query := `
@@ -659,7 +1524,7 @@ func (s *PostgresStore) GetProviderEarnings(ctx context.Context, req *models.Pro
 		period = fmt.Sprintf("%s to %s", req.StartDate.Format("2006-01-02"), req.EndDate.Format("2006-01-02"))
 	}
 
-	return &models.ProviderEarningsResponse{
+	response := &models.ProviderEarningsResponse{
 		ProviderID:      req.ProviderID,
 		TotalEarnings:   totalEarnings,
 		PendingEarnings: pendingEarnings,
@@ -668,5 +1533,215 @@ func (s *PostgresStore) GetProviderEarnings(ctx context.Context, req *models.Pro
 		TotalHours:      totalHours,
 		AvgHourlyRate:   avgHourlyRate,
 		Period:          period,
-	}, nil
+	}
+
+	if req.GroupBy != "" {
+		breakdown, err := s.getProviderEarningsBreakdown(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		response.GroupBy = req.GroupBy
+		response.Breakdown = breakdown
+	}
+
+	return response, nil
+}
+
+// earningsGroupExpressions are the columns earnings breakdowns group ended sessions by
+var earningsGroupExpressions = map[string]string{
+	models.EarningsGroupByGPUModel: "rs.gpu_model",
+	models.EarningsGroupByDay:      "to_char(date_trunc('day', rs.ended_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')",
+	models.EarningsGroupByWeek:     "to_char(date_trunc('week', rs.ended_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')",
+	models.EarningsGroupByMonth:    "to_char(date_trunc('month', rs.ended_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')",
+}
+
+// getProviderEarningsBreakdown breaks a provider's earnings from settled sessions down by
+// GPU model or by the window the sessions ended in. Settled sessions are the completed
+// and terminated ones; cancelled sessions may have ended without earning anything.
+// Utilization hours and energy come from the sessions' usage records.
+func (s *PostgresStore) getProviderEarningsBreakdown(ctx context.Context, req *models.ProviderEarningsRequest) ([]models.EarningsBreakdown, error) {
+	groupExpr, ok := earningsGroupExpressions[req.GroupBy]
+	if !ok {
+		return nil, models.NewValidationError("group_by", fmt.Sprintf("unsupported earnings breakdown %q", req.GroupBy))
+	}
+
+	whereClause := "WHERE rs.provider_id = $1 AND rs.status IN ($2, $3)"
+	args := []interface{}{req.ProviderID, models.SessionStatusCompleted, models.SessionStatusTerminated}
+	argIndex := 4
+
+	if req.StartDate != nil {
+		whereClause += fmt.Sprintf(" AND rs.ended_at >= $%d", argIndex)
+		args = append(args, *req.StartDate)
+		argIndex++
+	}
+
+	if req.EndDate != nil {
+		whereClause += fmt.Sprintf(" AND rs.ended_at <= $%d", argIndex)
+		args = append(args, *req.EndDate)
+		argIndex++
+	}
+
+	query := fmt.Sprintf(`
+		WITH usage AS (
+			SELECT
+				session_id,
+				SUM(period_minutes * COALESCE(gpu_utilization_percent, 0)) / 6000.0 AS utilization_hours,
+				SUM(power_draw_w::bigint * period_minutes) / 60000.0 AS energy_kwh
+			FROM usage_records
+			WHERE session_id IN (SELECT id FROM rental_sessions WHERE provider_id = $1)
+			GROUP BY session_id
+		)
+		SELECT
+			%s AS grp,
+			COUNT(*) AS sessions,
+			COALESCE(SUM(rs.provider_earnings), 0) AS earnings,
+			COALESCE(SUM(GREATEST(EXTRACT(EPOCH FROM rs.ended_at - rs.started_at) - rs.paused_seconds, 0)), 0)::numeric / 3600 AS hours,
+			COALESCE(SUM(u.utilization_hours), 0)::numeric AS utilization_hours,
+			COALESCE(SUM(u.energy_kwh), 0)::numeric AS energy_kwh
+		FROM rental_sessions rs
+		LEFT JOIN usage u ON u.session_id = rs.id
+		%s
+		GROUP BY grp
+		ORDER BY grp
+	`, groupExpr, whereClause)
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to break down provider earnings: %w", err)
+	}
+	defer rows.Close()
+
+	breakdown := []models.EarningsBreakdown{}
+	for rows.Next() {
+		var group string
+		var entry models.EarningsBreakdown
+		if err := rows.Scan(&group, &entry.Sessions, &entry.Earnings, &entry.Hours, &entry.UtilizationHours, &entry.EnergyKWh); err != nil {
+			return nil, fmt.Errorf("failed to scan provider earnings breakdown: %w", err)
+		}
+		if req.GroupBy == models.EarningsGroupByGPUModel {
+			entry.GPUModel = group
+		} else {
+			entry.Window = group
+		}
+		breakdown = append(breakdown, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to break down provider earnings: %w", err)
+	}
+
+	return breakdown, nil
+}
+
+// Provider rate operations
+
+// UpsertProviderRateSchedule creates or replaces a provider's rate schedule for its GPU model
+func (s *PostgresStore) UpsertProviderRateSchedule(ctx context.Context, schedule *models.ProviderRateSchedule) error {
+	gpuModel := schedule.GPUModel
+	if gpuModel == "" {
+		gpuModel = models.AllGPUModels
+	}
+
+	multipliers := schedule.Multipliers
+	if multipliers == nil {
+		multipliers = []models.RateMultiplier{}
+	}
+	multipliersJSON, err := json.Marshal(multipliers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rate multipliers: %w", err)
+	}
+
+	query := `
+		INSERT INTO provider_rates (id, provider_id, gpu_model, hourly_rate, timezone, multipliers, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, TRUE, $7, $7)
+		ON CONFLICT (provider_id, gpu_model) DO UPDATE SET
+			hourly_rate = EXCLUDED.hourly_rate,
+			timezone = EXCLUDED.timezone,
+			multipliers = EXCLUDED.multipliers,
+			is_active = TRUE,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err = s.db.Exec(ctx, query,
+		uuid.New(), schedule.ProviderID, gpuModel, schedule.HourlyRate,
+		schedule.Timezone, multipliersJSON, schedule.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save provider rates: %w", err)
+	}
+	return nil
+}
+
+// ListProviderRateSchedules returns a provider's active rate schedules
+func (s *PostgresStore) ListProviderRateSchedules(ctx context.Context, providerID uuid.UUID) ([]models.ProviderRateSchedule, error) {
+	query := `
+		SELECT provider_id, gpu_model, hourly_rate, timezone, multipliers, updated_at
+		FROM provider_rates
+		WHERE provider_id = $1 AND is_active
+		ORDER BY gpu_model
+	`
+
+	rows, err := s.db.Query(ctx, query, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provider rates: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make([]models.ProviderRateSchedule, 0)
+	for rows.Next() {
+		schedule, err := scanProviderRateSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list provider rates: %w", err)
+	}
+	return schedules, nil
+}
+
+// GetProviderRateSchedule returns the provider's active schedule for gpuModel, falling
+// back to its schedule for all GPUs. It returns models.ErrRateNotFound if neither is set.
+func (s *PostgresStore) GetProviderRateSchedule(ctx context.Context, providerID uuid.UUID, gpuModel string) (*models.ProviderRateSchedule, error) {
+	query := `
+		SELECT provider_id, gpu_model, hourly_rate, timezone, multipliers, updated_at
+		FROM provider_rates
+		WHERE provider_id = $1 AND is_active AND (LOWER(gpu_model) = LOWER($2) OR gpu_model = $3)
+		ORDER BY gpu_model = $3
+		LIMIT 1
+	`
+
+	schedule, err := scanProviderRateSchedule(s.db.QueryRow(ctx, query, providerID, gpuModel, models.AllGPUModels))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrRateNotFound
+	}
+	return schedule, err
+}
+
+// scanProviderRateSchedule scans a provider_rates row selected by the queries above
+func scanProviderRateSchedule(row pgx.Row) (*models.ProviderRateSchedule, error) {
+	var schedule models.ProviderRateSchedule
+	var hourlyRate decimal.NullDecimal
+	var multipliersJSON []byte
+
+	if err := row.Scan(
+		&schedule.ProviderID, &schedule.GPUModel, &hourlyRate,
+		&schedule.Timezone, &multipliersJSON, &schedule.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan provider rates: %w", err)
+	}
+
+	if schedule.GPUModel == models.AllGPUModels {
+		schedule.GPUModel = ""
+	}
+	if hourlyRate.Valid {
+		schedule.HourlyRate = hourlyRate.Decimal
+	}
+	if err := json.Unmarshal(multipliersJSON, &schedule.Multipliers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rate multipliers: %w", err)
+	}
+	return &schedule, nil
 }
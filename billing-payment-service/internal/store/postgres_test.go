@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/billing-payment-service/internal/models"
+)
+
+// testDatabaseEnv names the PostgreSQL database the store tests run against; they are
+// skipped when it isn't set. Tests use their own providers, so it can be shared.
+const testDatabaseEnv = "BILLING_TEST_DATABASE_URL"
+
+func newTestStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	databaseURL := os.Getenv(testDatabaseEnv)
+	if databaseURL == "" {
+		t.Skipf("%s not set", testDatabaseEnv)
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	s := NewPostgresStore(db, zap.NewNop())
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatalf("failed to initialize the test database: %v", err)
+	}
+	return s
+}
+
+// createEndedSession stores a session of the provider that ended with the given status
+// and earnings
+func createEndedSession(t *testing.T, s *PostgresStore, providerID uuid.UUID, status models.SessionStatus, gpuModel string, earnings int64) {
+	t.Helper()
+	endedAt := time.Now().Add(-time.Hour)
+	session := &models.RentalSession{
+		ID:               uuid.New(),
+		UserID:           "user-" + uuid.NewString(),
+		ProviderID:       providerID,
+		Status:           status,
+		GPUModel:         gpuModel,
+		AllocatedVRAM:    24576,
+		TotalVRAM:        24576,
+		VRAMPercentage:   decimal.NewFromInt(100),
+		HourlyRate:       decimal.NewFromInt(1),
+		VRAMRate:         decimal.Zero,
+		PowerRate:        decimal.Zero,
+		PlatformFeeRate:  decimal.NewFromInt(10),
+		EstimatedPowerW:  350,
+		StartedAt:        endedAt.Add(-2 * time.Hour),
+		EndedAt:          &endedAt,
+		LastBilledAt:     endedAt,
+		ProviderEarnings: decimal.NewFromInt(earnings),
+	}
+	if err := s.CreateRentalSession(context.Background(), session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+}
+
+func TestEarningsBreakdownCountsSettledSessionsOnly(t *testing.T) {
+	s := newTestStore(t)
+	providerID := uuid.New()
+	createEndedSession(t, s, providerID, models.SessionStatusCompleted, "RTX 4090", 10)
+	createEndedSession(t, s, providerID, models.SessionStatusTerminated, "RTX 4090", 3)
+	createEndedSession(t, s, providerID, models.SessionStatusCancelled, "RTX 4090", 100)
+	createEndedSession(t, s, providerID, models.SessionStatusSuspended, "A100", 100)
+
+	breakdown, err := s.getProviderEarningsBreakdown(context.Background(), &models.ProviderEarningsRequest{
+		ProviderID: providerID,
+		GroupBy:    models.EarningsGroupByGPUModel,
+	})
+	if err != nil {
+		t.Fatalf("getProviderEarningsBreakdown: %v", err)
+	}
+	if len(breakdown) != 1 {
+		t.Fatalf("breakdown %+v, want only the RTX 4090 sessions that settled", breakdown)
+	}
+	if entry := breakdown[0]; entry.GPUModel != "RTX 4090" || entry.Sessions != 2 || !entry.Earnings.Equal(decimal.NewFromInt(13)) {
+		t.Errorf("breakdown entry %+v, want 2 RTX 4090 sessions earning 13", entry)
+	}
+}
+
+func TestIdempotencyKeyScopedToUser(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	key := "start-" + uuid.NewString()
+
+	// startSession stores a session the user started with the key
+	startSession := func(userID string) (uuid.UUID, error) {
+		now := time.Now().UTC()
+		session := &models.RentalSession{
+			ID:              uuid.New(),
+			UserID:          userID,
+			ProviderID:      uuid.New(),
+			Status:          models.SessionStatusActive,
+			GPUModel:        "RTX 4090",
+			AllocatedVRAM:   24576,
+			TotalVRAM:       24576,
+			VRAMPercentage:  decimal.NewFromInt(100),
+			HourlyRate:      decimal.NewFromInt(1),
+			PlatformFeeRate: decimal.NewFromInt(10),
+			EstimatedPowerW: 350,
+			StartedAt:       now,
+			LastBilledAt:    now,
+			IdempotencyKey:  &key,
+		}
+		return session.ID, s.CreateRentalSession(ctx, session)
+	}
+
+	alice, bob := "user-"+uuid.NewString(), "user-"+uuid.NewString()
+	aliceSession, err := startSession(alice)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if _, err := s.GetRentalSessionIDByIdempotencyKey(ctx, bob, key); err != models.ErrSessionNotFound {
+		t.Fatalf("another user's key returned %v, want ErrSessionNotFound", err)
+	}
+
+	// The same key starts a session of its own for another user, and only repeats for the same one
+	bobSession, err := startSession(bob)
+	if err != nil {
+		t.Fatalf("another user reusing the key: %v", err)
+	}
+	if _, err := startSession(alice); err != models.ErrDuplicateIdempotencyKey {
+		t.Errorf("same user reusing the key: %v, want ErrDuplicateIdempotencyKey", err)
+	}
+	for userID, want := range map[string]uuid.UUID{alice: aliceSession, bob: bobSession} {
+		if got, err := s.GetRentalSessionIDByIdempotencyKey(ctx, userID, key); err != nil || got != want {
+			t.Errorf("session for %s = %s, %v; want %s", userID, got, err, want)
+		}
+	}
+}
+
+func TestSaveUsageConflictsWithStaleSessionUpdates(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	session := &models.RentalSession{
+		ID:              uuid.New(),
+		UserID:          "user-" + uuid.NewString(),
+		ProviderID:      uuid.New(),
+		Status:          models.SessionStatusActive,
+		GPUModel:        "RTX 4090",
+		AllocatedVRAM:   24576,
+		TotalVRAM:       24576,
+		VRAMPercentage:  decimal.NewFromInt(100),
+		HourlyRate:      decimal.NewFromInt(1),
+		PlatformFeeRate: decimal.NewFromInt(10),
+		EstimatedPowerW: 350,
+		StartedAt:       now,
+		LastBilledAt:    now,
+	}
+	if err := s.CreateRentalSession(ctx, session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	stale, err := s.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := models.UsageRecord{
+		ID:            uuid.New(),
+		SessionID:     session.ID,
+		RecordedAt:    now,
+		PowerDraw:     300,
+		PeriodMinutes: 1,
+		PeriodCost:    decimal.NewFromInt(3),
+		CreatedAt:     now,
+	}
+	usage := SessionUsage{SessionID: session.ID, LastBilledAt: now, PowerDraw: 300}
+	if err := s.SaveUsage(ctx, []models.UsageRecord{record}, []SessionUsage{usage}); err != nil {
+		t.Fatalf("SaveUsage: %v", err)
+	}
+
+	// An update from before the usage was written must not overwrite its cost
+	stale.Status = models.SessionStatusPaused
+	if err := s.UpdateRentalSession(ctx, stale); err != models.ErrSessionConflict {
+		t.Fatalf("stale update returned %v, want ErrSessionConflict", err)
+	}
+	stored, err := s.GetRentalSession(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.TotalCost.Equal(decimal.NewFromInt(3)) || stored.Status != models.SessionStatusActive {
+		t.Errorf("session %s with total cost %s, want active with the usage's 3", stored.Status, stored.TotalCost)
+	}
+}
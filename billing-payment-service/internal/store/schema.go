@@ -54,7 +54,8 @@ CREATE TABLE IF NOT EXISTS rental_sessions (
     user_id VARCHAR(255) NOT NULL,
     provider_id UUID NOT NULL,
     job_id VARCHAR(255),
-    status VARCHAR(50) NOT NULL CHECK (status IN ('active', 'completed', 'cancelled', 'suspended', 'terminated')),
+    status VARCHAR(50) NOT NULL CHECK (status IN ('active', 'paused', 'completed', 'cancelled', 'suspended', 'terminated')),
+    idempotency_key VARCHAR(255), -- Unique per user, see migrateRentalSessionsIdempotencyKey
     
     -- GPU allocation details
     gpu_model VARCHAR(255) NOT NULL,
@@ -76,11 +77,15 @@ CREATE TABLE IF NOT EXISTS rental_sessions (
     started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     ended_at TIMESTAMPTZ,
     last_billed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    paused_at TIMESTAMPTZ,
+    paused_seconds BIGINT NOT NULL DEFAULT 0,
     
     -- Financial tracking
     total_cost DECIMAL(20,9) NOT NULL DEFAULT 0,
     platform_fee DECIMAL(20,9) NOT NULL DEFAULT 0,
     provider_earnings DECIMAL(20,9) NOT NULL DEFAULT 0,
+    locked_amount DECIMAL(20,9) NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 0,
     
     -- Metadata
     metadata JSONB,
@@ -204,6 +209,48 @@ CREATE TABLE IF NOT EXISTS provider_rates (
 );
 `
 
+// Adds the idempotency_key column, unique per user, including to rental_sessions tables
+// created before it existed, and replaces the index that made keys unique across users
+const migrateRentalSessionsIdempotencyKey = `
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+DROP INDEX IF EXISTS idx_rental_sessions_idempotency_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rental_sessions_user_idempotency_key ON rental_sessions(user_id, idempotency_key);
+`
+
+// Adds pause tracking to rental_sessions tables created before sessions could be paused
+const migrateRentalSessionsPause = `
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS paused_at TIMESTAMPTZ;
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS paused_seconds BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS locked_amount DECIMAL(20,9) NOT NULL DEFAULT 0;
+ALTER TABLE rental_sessions DROP CONSTRAINT IF EXISTS rental_sessions_status_check;
+ALTER TABLE rental_sessions ADD CONSTRAINT rental_sessions_status_check
+    CHECK (status IN ('active', 'paused', 'completed', 'cancelled', 'suspended', 'terminated'));
+`
+
+// Adds the optimistic locking version to rental_sessions tables created before it existed
+const migrateRentalSessionsVersion = `
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+`
+
+// Adds the insufficient funds grace deadline to rental_sessions tables created before
+// it was stored
+const migrateRentalSessionsGrace = `
+ALTER TABLE rental_sessions ADD COLUMN IF NOT EXISTS grace_ends_at TIMESTAMPTZ;
+`
+
+// Adds spending limits to wallets tables created before they existed
+const migrateWalletsSpendLimits = `
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS daily_spend_limit DECIMAL(20,9) NOT NULL DEFAULT 0;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS monthly_spend_limit DECIMAL(20,9) NOT NULL DEFAULT 0;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+`
+
+// Adds time-of-day rate schedules to provider_rates tables created before they existed
+const migrateProviderRatesSchedule = `
+ALTER TABLE provider_rates ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE provider_rates ADD COLUMN IF NOT EXISTS multipliers JSONB NOT NULL DEFAULT '[]';
+`
+
 const createIndexes = `
 -- Wallet indexes
 CREATE INDEX IF NOT EXISTS idx_wallets_user_id ON wallets(user_id);
@@ -217,6 +264,9 @@ CREATE INDEX IF NOT EXISTS idx_transactions_type_status ON transactions(type, st
 CREATE INDEX IF NOT EXISTS idx_transactions_session_id ON transactions(session_id);
 CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at);
 CREATE INDEX IF NOT EXISTS idx_transactions_solana_signature ON transactions(solana_signature);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_deposit_signature ON transactions(solana_signature) WHERE type = 'deposit';
+CREATE INDEX IF NOT EXISTS idx_transactions_from_wallet_created ON transactions(from_wallet_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_to_wallet_created ON transactions(to_wallet_id, created_at);
 
 -- Rental session indexes
 CREATE INDEX IF NOT EXISTS idx_rental_sessions_user_id ON rental_sessions(user_id);
@@ -225,6 +275,7 @@ CREATE INDEX IF NOT EXISTS idx_rental_sessions_status ON rental_sessions(status)
 CREATE INDEX IF NOT EXISTS idx_rental_sessions_job_id ON rental_sessions(job_id);
 CREATE INDEX IF NOT EXISTS idx_rental_sessions_started_at ON rental_sessions(started_at);
 CREATE INDEX IF NOT EXISTS idx_rental_sessions_gpu_model ON rental_sessions(gpu_model);
+CREATE INDEX IF NOT EXISTS idx_rental_sessions_grace_ends_at ON rental_sessions(grace_ends_at) WHERE grace_ends_at IS NOT NULL;
 
 -- Usage record indexes
 CREATE INDEX IF NOT EXISTS idx_usage_records_session_id ON usage_records(session_id);
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// billingRecorder is a billing service that records the requests it gets
+type billingRecorder struct {
+	mu       sync.Mutex
+	paths    []string
+	refunded map[string]interface{}
+}
+
+func (b *billingRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paths = append(b.paths, r.URL.Path)
+	if r.URL.Path == "/api/v1/billing/refund-session" {
+		json.NewDecoder(r.Body).Decode(&b.refunded)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestHandleTaskErrorRefundsSetupFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		started bool
+	}{
+		{"failed during setup", false},
+		{"failed while running", true}, // Billed by ending the session instead
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			billing := &billingRecorder{}
+			server := httptest.NewServer(billing)
+			defer server.Close()
+
+			p := &GPUProvider{
+				config:       &common.ProviderConfig{BillingServiceURL: server.URL},
+				logger:       zap.NewNop(),
+				provider:     &common.Provider{ID: uuid.New()},
+				httpClient:   &http.Client{Timeout: 5 * time.Second},
+				alertManager: newAlertManager(common.AlertSettings{}, zap.NewNop()),
+			}
+			job := &ActiveJob{
+				Task:            &Task{JobID: "job-1"},
+				BillingSession:  &BillingSessionResponse{},
+				OutputCollector: &OutputCollector{},
+				ErrorCollector:  &ErrorCollector{},
+			}
+			job.BillingSession.Session.ID = uuid.New()
+			job.ExecutionStarted.Store(tt.started)
+
+			(&TaskWorker{provider: p, logger: zap.NewNop()}).handleTaskError(job, "image_pull", errors.New("pull access denied"))
+
+			billing.mu.Lock()
+			defer billing.mu.Unlock()
+			if len(billing.paths) != 1 {
+				t.Fatalf("billing got %v, want one request", billing.paths)
+			}
+			refunded := billing.paths[0] == "/api/v1/billing/refund-session"
+			if refunded != !tt.started {
+				t.Fatalf("billing got %s, refund wanted: %v", billing.paths[0], !tt.started)
+			}
+			if refunded {
+				if billing.refunded["session_id"] != job.BillingSession.Session.ID.String() {
+					t.Errorf("refunded session %v, want %s", billing.refunded["session_id"], job.BillingSession.Session.ID)
+				}
+				if reason, _ := billing.refunded["reason"].(string); reason != "image_pull: pull access denied" {
+					t.Errorf("refund reason %q", reason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats supported for input and output files
+const (
+	compressionGzip  = "gzip"
+	compressionZstd  = "zstd"
+	compressionTarGz = "tar.gz"
+)
+
+// Magic numbers at the start of compressed streams
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// normalizeCompression validates a FileTransfer compression, returning "" for none
+func normalizeCompression(compression string) (string, error) {
+	switch c := strings.ToLower(strings.TrimSpace(compression)); c {
+	case "", "none":
+		return "", nil
+	case compressionGzip, compressionZstd, compressionTarGz:
+		return c, nil
+	case "tgz":
+		return compressionTarGz, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q: expected gzip, zstd or tar.gz", compression)
+	}
+}
+
+// maxArchiveEntries bounds the entries extracted from a tar.gz input
+const maxArchiveEntries = 100000
+
+// errDecompressLimit is returned when decompressing an input would write more than allowed
+var errDecompressLimit = errors.New("decompressed input exceeds the limit")
+
+// decompressLimit bounds what decompressing an input may write
+type decompressLimit struct {
+	maxBytes   int64 // In total, across all entries of an archive
+	maxEntries int   // Of a tar.gz archive
+}
+
+// decompressLimit returns the limit for decompressing an input into the workspace: the
+// job's disk requirement of diskSpaceMB if set, and never more than the free space less
+// diskSpaceSafetyMarginMB
+func (e *ExecutionEnvironment) decompressLimit(diskSpaceMB uint64) (decompressLimit, error) {
+	usage, err := e.diskUsage(e.workspaceDir)
+	if err != nil {
+		return decompressLimit{}, fmt.Errorf("failed to check free disk space: %w", err)
+	}
+
+	const mb = 1024 * 1024
+	var maxBytes uint64
+	if free := usage.Free / mb; free > diskSpaceSafetyMarginMB {
+		maxBytes = (free - diskSpaceSafetyMarginMB) * mb
+	}
+	if diskSpaceMB > 0 && diskSpaceMB*mb < maxBytes {
+		maxBytes = diskSpaceMB * mb
+	}
+	if maxBytes > math.MaxInt64 {
+		maxBytes = math.MaxInt64
+	}
+	return decompressLimit{maxBytes: int64(maxBytes), maxEntries: maxArchiveEntries}, nil
+}
+
+// copyLimited copies src to dst, failing with errDecompressLimit once more than
+// *remaining bytes were read, and deducts what was copied from *remaining
+func copyLimited(dst io.Writer, src io.Reader, remaining *int64) error {
+	n, err := io.Copy(dst, io.LimitReader(src, *remaining+1))
+	*remaining -= n
+	if err != nil {
+		return err
+	}
+	if *remaining < 0 {
+		return errDecompressLimit
+	}
+	return nil
+}
+
+// detectCompression names the compression a stream starts with, or "" if unknown
+func detectCompression(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return compressionZstd
+	default:
+		return ""
+	}
+}
+
+// decompressInput decompresses src into destPath. tar.gz archives are extracted into
+// destPath as a directory. The stream must start with the declared format's magic
+// number, so a mislabeled input fails instead of being handed to the job as is. What
+// is written is bounded by limit, so a small input can't fill the disk.
+func decompressInput(src io.Reader, destPath, compression string, limit decompressLimit) error {
+	reader := bufio.NewReader(src)
+	header, _ := reader.Peek(len(zstdMagic))
+
+	expected := compression
+	if expected == compressionTarGz {
+		expected = compressionGzip
+	}
+	if actual := detectCompression(header); actual != expected {
+		if actual == "" {
+			actual = "not compressed"
+		}
+		return fmt.Errorf("declared compression %s does not match content (%s)", compression, actual)
+	}
+
+	if compression == compressionTarGz {
+		return extractTarGz(reader, destPath, limit)
+	}
+
+	var decoder io.Reader
+	switch compression {
+	case compressionZstd:
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		defer zstdReader.Close()
+		decoder = zstdReader
+	default:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		defer gzipReader.Close()
+		decoder = gzipReader
+	}
+
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	remaining := limit.maxBytes
+	if err := copyLimited(destFile, decoder, &remaining); err != nil {
+		destFile.Close()
+		os.Remove(destPath)
+		if errors.Is(err, errDecompressLimit) {
+			return fmt.Errorf("%w of %d bytes", errDecompressLimit, limit.maxBytes)
+		}
+		return fmt.Errorf("failed to decompress: %w", err)
+	}
+	return destFile.Close()
+}
+
+// extractTarGz extracts a gzipped tar archive into destDir. Entries must stay inside
+// destDir. Symlinks are created last so no entry is ever written through one, and
+// hard links and special files are skipped. The archive may hold no more than
+// limit.maxEntries entries and limit.maxBytes of file content.
+func extractTarGz(src io.Reader, destDir string, limit decompressLimit) error {
+	gzipReader, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var names []string
+	var symlinks []*tar.Header
+	links := make(map[string]string) // Archive path to target
+	remaining := limit.maxBytes
+	archive := tar.NewReader(gzipReader)
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if entries >= limit.maxEntries {
+			return fmt.Errorf("archive has more than %d entries", limit.maxEntries)
+		}
+
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("archive entry %q escapes the target directory", header.Name)
+		}
+		target := filepath.Join(destDir, header.Name)
+		names = append(names, filepath.Clean(header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+		case tar.TypeReg:
+			if header.Size > remaining {
+				return fmt.Errorf("%w of %d bytes", errDecompressLimit, limit.maxBytes)
+			}
+			if err := extractTarFile(archive, target, header.FileInfo().Mode().Perm(), &remaining); err != nil {
+				if errors.Is(err, errDecompressLimit) {
+					return fmt.Errorf("%w of %d bytes", errDecompressLimit, limit.maxBytes)
+				}
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) {
+				return fmt.Errorf("archive symlink %q points outside the target directory", header.Name)
+			}
+			symlinks = append(symlinks, header)
+			links[filepath.Clean(header.Name)] = header.Linkname
+		}
+	}
+
+	// Symlinks are only created once everything else is extracted, so nothing is written
+	// through them. Their targets are resolved through the archive's other symlinks,
+	// since a target like a/.. depends on where a points rather than just its name.
+	for _, name := range names {
+		if linkedParent(name, links) {
+			return fmt.Errorf("archive entry %q is inside an archive symlink", name)
+		}
+	}
+	for _, header := range symlinks {
+		dir := filepath.Dir(filepath.Clean(header.Name))
+		if _, ok := resolveArchiveLink(splitArchivePath(dir), header.Linkname, links, maxArchiveLinkHops); !ok {
+			return fmt.Errorf("archive symlink %q points outside the target directory", header.Name)
+		}
+	}
+
+	for _, header := range symlinks {
+		target := filepath.Join(destDir, header.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return fmt.Errorf("failed to create symlink: %w", err)
+		}
+	}
+	return nil
+}
+
+// maxArchiveLinkHops bounds how many archive symlinks a target is resolved through,
+// as the kernel's ELOOP limit does
+const maxArchiveLinkHops = 40
+
+// linkedParent reports whether any parent directory of the archive path name is one
+// of the archive's symlinks
+func linkedParent(name string, links map[string]string) bool {
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		if _, ok := links[dir]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArchivePath splits a clean archive path into its elements; "." has none
+func splitArchivePath(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, string(filepath.Separator))
+}
+
+// resolveArchiveLink resolves a symlink target from the archive directory dir the way
+// the file system will once the archive's symlinks exist, following them through
+// links. It returns the resolved archive path, or false if the target leaves the
+// archive, is absolute or goes through more than hops links.
+func resolveArchiveLink(dir []string, target string, links map[string]string, hops int) ([]string, bool) {
+	if filepath.IsAbs(target) {
+		return nil, false
+	}
+	path := append([]string(nil), dir...)
+	for _, elem := range strings.Split(target, string(filepath.Separator)) {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(path) == 0 {
+				return nil, false
+			}
+			path = path[:len(path)-1]
+		default:
+			path = append(path, elem)
+			linkTarget, ok := links[filepath.Join(path...)]
+			if !ok {
+				continue
+			}
+			if hops == 0 {
+				return nil, false
+			}
+			if path, ok = resolveArchiveLink(path[:len(path)-1], linkTarget, links, hops-1); !ok {
+				return nil, false
+			}
+		}
+	}
+	return path, true
+}
+
+// extractTarFile writes the current archive entry to target, deducting its size from
+// *remaining as copyLimited does
+func extractTarFile(archive *tar.Reader, target string, perm os.FileMode, remaining *int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0600)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if err := copyLimited(file, archive, remaining); err != nil {
+		file.Close()
+		if errors.Is(err, errDecompressLimit) {
+			return err
+		}
+		return fmt.Errorf("failed to extract %s: %w", filepath.Base(target), err)
+	}
+	return file.Close()
+}
+
+// compressOutput compresses an output file on the fly, returning the compressed
+// stream and its content type. tar.gz archives sourcePath, which may be a directory.
+func compressOutput(compression string, source io.Reader, sourcePath string) (io.ReadCloser, string) {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(writeCompressed(pipeWriter, compression, source, sourcePath))
+	}()
+
+	if compression == compressionZstd {
+		return pipeReader, "application/zstd"
+	}
+	return pipeReader, "application/gzip"
+}
+
+// writeCompressed writes source, or the archive of sourcePath for tar.gz, to dst
+func writeCompressed(dst io.Writer, compression string, source io.Reader, sourcePath string) error {
+	switch compression {
+	case compressionZstd:
+		zstdWriter, err := zstd.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		_, copyErr := io.Copy(zstdWriter, source)
+		if closeErr := zstdWriter.Close(); copyErr == nil {
+			copyErr = closeErr
+		}
+		return copyErr
+	case compressionTarGz:
+		gzipWriter := gzip.NewWriter(dst)
+		archiveErr := writeTarArchive(gzipWriter, sourcePath)
+		if closeErr := gzipWriter.Close(); archiveErr == nil {
+			archiveErr = closeErr
+		}
+		return archiveErr
+	default:
+		gzipWriter := gzip.NewWriter(dst)
+		_, copyErr := io.Copy(gzipWriter, source)
+		if closeErr := gzipWriter.Close(); copyErr == nil {
+			copyErr = closeErr
+		}
+		return copyErr
+	}
+}
+
+// writeTarArchive writes sourcePath, a file or directory, as a tar archive with
+// entries named relative to its parent directory
+func writeTarArchive(dst io.Writer, sourcePath string) error {
+	archive := tar.NewWriter(dst)
+	parent := filepath.Dir(sourcePath)
+
+	err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(parent, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(archive, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// unlimited lets decompressInput write anything a test needs
+var unlimited = decompressLimit{maxBytes: 1 << 30, maxEntries: maxArchiveEntries}
+
+// compress compresses data, or for tar.gz the directory at sourcePath
+func compress(t *testing.T, compression string, data []byte, sourcePath string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeCompressed(&buf, compression, bytes.NewReader(data), sourcePath); err != nil {
+		t.Fatalf("writeCompressed(%s): %v", compression, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressInputRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("gpu input "), 10000)
+	for _, compression := range []string{compressionGzip, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "input.bin")
+			if err := decompressInput(bytes.NewReader(compress(t, compression, data, "")), dest, compression, unlimited); err != nil {
+				t.Fatalf("decompressInput: %v", err)
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("decompressed %d bytes, want the %d compressed", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestDecompressInputTarGzRoundTrip(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "dataset")
+	files := map[string]string{"a.txt": "first", "nested/b.txt": "second"}
+	for name, content := range files {
+		path := filepath.Join(source, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "input")
+	if err := decompressInput(bytes.NewReader(compress(t, compressionTarGz, nil, source)), dest, compressionTarGz, unlimited); err != nil {
+		t.Fatalf("decompressInput: %v", err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dest, "dataset", name))
+		if err != nil {
+			t.Errorf("%s not extracted: %v", name, err)
+		} else if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestDecompressInputLimitsSize(t *testing.T) {
+	data := make([]byte, 64*1024) // Compresses to almost nothing
+	limit := decompressLimit{maxBytes: 1024, maxEntries: maxArchiveEntries}
+
+	for _, compression := range []string{compressionGzip, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "input.bin")
+			err := decompressInput(bytes.NewReader(compress(t, compression, data, "")), dest, compression, limit)
+			if !errors.Is(err, errDecompressLimit) {
+				t.Fatalf("decompressInput error = %v, want the size limit", err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("partly decompressed file left behind")
+			}
+		})
+	}
+
+	t.Run(compressionTarGz, func(t *testing.T) {
+		archive := tarGz(t, map[string][]byte{"a.bin": data[:800], "b.bin": data[:800]})
+		err := decompressInput(bytes.NewReader(archive), filepath.Join(t.TempDir(), "input"), compressionTarGz, limit)
+		if !errors.Is(err, errDecompressLimit) {
+			t.Errorf("decompressInput error = %v, want the size limit across entries", err)
+		}
+	})
+}
+
+func TestDecompressInputLimitsEntries(t *testing.T) {
+	entries := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		entries[strings.Repeat("f", i+1)] = []byte("x")
+	}
+	limit := decompressLimit{maxBytes: 1 << 20, maxEntries: 4}
+
+	err := decompressInput(bytes.NewReader(tarGz(t, entries)), filepath.Join(t.TempDir(), "input"), compressionTarGz, limit)
+	if err == nil || !strings.Contains(err.Error(), "more than 4 entries") {
+		t.Errorf("decompressInput error = %v, want the entry limit", err)
+	}
+}
+
+func TestDecompressInputRejectsUnsafeArchives(t *testing.T) {
+	err := decompressInput(bytes.NewReader(tarGz(t, map[string][]byte{"../escape.txt": []byte("x")})),
+		filepath.Join(t.TempDir(), "input"), compressionTarGz, unlimited)
+	if err == nil || !strings.Contains(err.Error(), "escapes") {
+		t.Errorf("decompressInput error = %v, want the escaping entry rejected", err)
+	}
+
+	err = decompressInput(strings.NewReader("plain text"), filepath.Join(t.TempDir(), "input"), compressionGzip, unlimited)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("decompressInput error = %v, want the mislabeled input rejected", err)
+	}
+}
+
+func TestDecompressInputSymlinks(t *testing.T) {
+	link := func(name, target string) *tar.Header {
+		return &tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink}
+	}
+	file := &tar.Header{Name: "v1/model.bin", Mode: 0644, Typeflag: tar.TypeReg}
+
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+		wantErr string // Substring of the rejection, empty if extracted
+	}{
+		{"link within the archive", []*tar.Header{file, link("current", "v1"), link("v1/latest", "model.bin")}, ""},
+		{"link up to a sibling", []*tar.Header{file, link("v2/model.bin", "../v1/model.bin")}, ""},
+		{"link to another link", []*tar.Header{file, link("current", "v1"), link("model", "current/model.bin")}, ""},
+		{"absolute link", []*tar.Header{link("passwd", "/etc/passwd")}, "points outside"},
+		{"link out of the archive", []*tar.Header{link("v1/up", "../..")}, "points outside"},
+		{"link chained inside a link", []*tar.Header{link("a", "."), link("a/d", "..")}, "inside an archive symlink"},
+		{"link chained before its parent", []*tar.Header{link("a/d", ".."), link("a", ".")}, "inside an archive symlink"},
+		{"link through a link", []*tar.Header{link("d/a", ".."), link("d/b", "a/..")}, "points outside"},
+		{"link loop", []*tar.Header{link("a", "b/x"), link("b", "a/y")}, "points outside"},
+		{"file inside a link", []*tar.Header{link("a", "."), {Name: "a/f", Mode: 0644, Typeflag: tar.TypeReg}}, "inside an archive symlink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destDir := filepath.Join(t.TempDir(), "input")
+			err := decompressInput(bytes.NewReader(tarGzEntries(t, tt.entries)), destDir, compressionTarGz, unlimited)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("decompressInput: %v", err)
+				}
+				for _, entry := range tt.entries {
+					if _, err := os.Stat(filepath.Join(destDir, entry.Name)); err != nil {
+						t.Errorf("%s not extracted: %v", entry.Name, err)
+					}
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("decompressInput error = %v, want it rejected as %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	const mb = 1024 * 1024
+	env := &ExecutionEnvironment{
+		workspaceDir: t.TempDir(),
+		diskUsage: func(string) (*disk.UsageStat, error) {
+			return &disk.UsageStat{Free: (diskSpaceSafetyMarginMB + 500) * mb}, nil
+		},
+	}
+
+	tests := []struct {
+		diskSpaceMB uint64
+		want        int64
+	}{
+		{0, 500 * mb},    // No requirement: the free space less the margin
+		{100, 100 * mb},  // The job's requirement
+		{2000, 500 * mb}, // Never more than is free
+	}
+	for _, tt := range tests {
+		limit, err := env.decompressLimit(tt.diskSpaceMB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limit.maxBytes != tt.want || limit.maxEntries != maxArchiveEntries {
+			t.Errorf("decompressLimit(%d) = %+v, want %d bytes", tt.diskSpaceMB, limit, tt.want)
+		}
+	}
+}
+
+// tarGz builds a gzipped tar archive of the given files
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarGzEntries builds a gzipped tar archive of the given empty entries, in order
+func tarGzEntries(t *testing.T, entries []*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gzipWriter)
+	for _, header := range entries {
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestContainerResources(t *testing.T) {
+	limit := ResourceLimit{CPUCores: 8, MemoryMB: 16384, MaxProcesses: 1024}
+	const mb = 1024 * 1024
+
+	tests := []struct {
+		name         string
+		requirements ResourceRequirements
+		constraints  TaskConstraints
+		wantMemory   int64
+		wantQuota    int64
+	}{
+		{"no requirements or constraints", ResourceRequirements{}, TaskConstraints{}, 16384 * mb, 800000},
+		{"requested allocation", ResourceRequirements{CPUCores: 2, MemoryMB: 4096}, TaskConstraints{}, 4096 * mb, 200000},
+		{"requests above the limit", ResourceRequirements{CPUCores: 32, MemoryMB: 65536}, TaskConstraints{}, 16384 * mb, 800000},
+		{"percentages of the allocation", ResourceRequirements{CPUCores: 2, MemoryMB: 4096},
+			TaskConstraints{MaxCPUUsagePercent: 50, MaxMemoryUsagePercent: 75}, 3072 * mb, 100000},
+		{"percentages of the limit", ResourceRequirements{},
+			TaskConstraints{MaxCPUUsagePercent: 25, MaxMemoryUsagePercent: 50}, 8192 * mb, 200000},
+		{"percentages of 100 or more are no limit", ResourceRequirements{CPUCores: 2, MemoryMB: 4096},
+			TaskConstraints{MaxCPUUsagePercent: 150, MaxMemoryUsagePercent: 100}, 4096 * mb, 200000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := containerResources(&Task{Requirements: tt.requirements, Constraints: tt.constraints}, limit)
+			if got.Memory != tt.wantMemory {
+				t.Errorf("Memory = %d MB, want %d MB", got.Memory/mb, tt.wantMemory/mb)
+			}
+			if got.CPUPeriod != cpuQuotaPeriod || got.CPUQuota != tt.wantQuota {
+				t.Errorf("CPUQuota/CPUPeriod = %d/%d, want %d/%d", got.CPUQuota, got.CPUPeriod, tt.wantQuota, cpuQuotaPeriod)
+			}
+			if got.PidsLimit == nil || *got.PidsLimit != 1024 {
+				t.Errorf("PidsLimit = %v, want the provider's 1024", got.PidsLimit)
+			}
+		})
+	}
+
+	if got := containerResources(&Task{}, ResourceLimit{CPUCores: 1, MemoryMB: 512}); got.PidsLimit != nil {
+		t.Errorf("PidsLimit = %d without a process limit, want unset", *got.PidsLimit)
+	}
+}
+
+func TestContainerNetworkMode(t *testing.T) {
+	if got := containerNetworkMode(&Task{}); got != container.NetworkMode("none") {
+		t.Errorf("network mode %q without network access, want none", got)
+	}
+	if got := containerNetworkMode(&Task{Constraints: TaskConstraints{AllowNetworkAccess: true}}); got != container.NetworkMode("bridge") {
+		t.Errorf("network mode %q with network access, want bridge", got)
+	}
+}
+
+func TestGPUShareEnvironment(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    []string
+	}{
+		{0, nil},
+		{100, nil},
+		{40, []string{"CUDA_MPS_ACTIVE_THREAD_PERCENTAGE=40"}},
+	}
+	for _, tt := range tests {
+		task := &Task{Constraints: TaskConstraints{MaxGPUUsagePercent: tt.percent}}
+		if got := gpuShareEnvironment(task); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("gpuShareEnvironment(%v%%) = %v, want %v", tt.percent, got, tt.want)
+		}
+	}
+}
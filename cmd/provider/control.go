@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"dante-backend/common"
+)
+
+// Control commands answered on provider.<id>.<command> with NATS request-reply
+const (
+	controlCommandStatus       = "status"
+	controlCommandDrain        = "drain"
+	controlCommandReloadConfig = "reload-config"
+)
+
+// controlResponse is the JSON reply to a control request
+type controlResponse struct {
+	OK    bool        `json:"ok"`
+	Error string      `json:"error,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// controlStatus is the reply to the status command
+type controlStatus struct {
+	ProviderID        string             `json:"provider_id"`
+	Status            string             `json:"status"` // online, busy or draining
+	Health            string             `json:"health"`
+	ActiveJobs        []controlJobStatus `json:"active_jobs"`
+	QueuedTasks       int                `json:"queued_tasks"`
+	MaxConcurrentJobs int                `json:"max_concurrent_jobs"`
+	JobsCompleted     int                `json:"jobs_completed"`
+	Settings          controlSettings    `json:"settings"`
+	Timestamp         time.Time          `json:"timestamp"`
+}
+
+// controlJobStatus is a running job in the status reply
+type controlJobStatus struct {
+	JobID           string    `json:"job_id"`
+	SessionID       string    `json:"session_id,omitempty"`
+	GPU             string    `json:"gpu,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	CancelRequested bool      `json:"cancel_requested"`
+}
+
+// controlSettings are the settings reload-config can change. In a request, omitted
+// fields are left as they are; durations use Go syntax such as "30m".
+type controlSettings struct {
+	ImagePolicy        *common.ImagePolicy `json:"image_policy,omitempty"`
+	DrainTimeout       string              `json:"drain_timeout,omitempty"`
+	CancelGracePeriod  string              `json:"cancel_grace_period,omitempty"`
+	GPUThrottleCelsius *uint8              `json:"gpu_throttle_celsius,omitempty"`
+	GPUResumeCelsius   *uint8              `json:"gpu_resume_celsius,omitempty"`
+}
+
+// runtimeSettings is a snapshot of the config fields reload-config can change
+type runtimeSettings struct {
+	ImagePolicy        common.ImagePolicy
+	DrainTimeout       time.Duration
+	CancelGracePeriod  time.Duration
+	GPUThrottleCelsius uint8
+	GPUResumeCelsius   uint8
+}
+
+// settings returns the current values of the reloadable config fields
+func (p *GPUProvider) settings() runtimeSettings {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return runtimeSettings{
+		ImagePolicy:        p.config.ImagePolicy,
+		DrainTimeout:       p.config.DrainTimeout,
+		CancelGracePeriod:  p.config.CancelGracePeriod,
+		GPUThrottleCelsius: p.config.GPUThrottleCelsius,
+		GPUResumeCelsius:   p.config.GPUResumeCelsius,
+	}
+}
+
+// controlSettings returns the reloadable settings as reported over the control channel
+func (s runtimeSettings) controlSettings() controlSettings {
+	policy := s.ImagePolicy
+	throttle, resume := s.GPUThrottleCelsius, s.GPUResumeCelsius
+	return controlSettings{
+		ImagePolicy:        &policy,
+		DrainTimeout:       s.DrainTimeout.String(),
+		CancelGracePeriod:  s.CancelGracePeriod.String(),
+		GPUThrottleCelsius: &throttle,
+		GPUResumeCelsius:   &resume,
+	}
+}
+
+// handleControlMessage answers a control request for this provider. Messages without
+// a reply subject are ignored, since the caller couldn't see the outcome.
+func (p *GPUProvider) handleControlMessage(msg *nats.Msg) {
+	if msg.Reply == "" {
+		return
+	}
+
+	command := msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+	p.logger.Info("Control request received", zap.String("command", command))
+
+	var data interface{}
+	var err error
+	switch command {
+	case controlCommandStatus:
+		data = p.controlStatus()
+	case controlCommandDrain:
+		p.RequestDrain()
+		data = map[string]string{"status": "draining"}
+	case controlCommandReloadConfig:
+		data, err = p.reloadSettings(msg.Data)
+	default:
+		err = fmt.Errorf("unknown control command %q", command)
+	}
+
+	response := controlResponse{OK: err == nil, Data: data}
+	if err != nil {
+		response.Error = err.Error()
+		p.logger.Warn("Control request failed", zap.String("command", command), zap.Error(err))
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		p.logger.Error("Failed to encode control response", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(payload); err != nil {
+		p.logger.Warn("Failed to send control response", zap.String("command", command), zap.Error(err))
+	}
+}
+
+// controlStatus gathers the live job state for the status command
+func (p *GPUProvider) controlStatus() controlStatus {
+	p.jobMutex.RLock()
+	jobs := make([]controlJobStatus, 0, len(p.activeJobs))
+	for _, activeJob := range p.activeJobs {
+		job := controlJobStatus{
+			JobID:           activeJob.Task.JobID,
+			StartedAt:       activeJob.StartTime,
+			CancelRequested: activeJob.CancelRequested.Load(),
+		}
+		if activeJob.SessionID != uuid.Nil {
+			job.SessionID = activeJob.SessionID.String()
+		}
+		if activeJob.AssignedGPU != nil {
+			job.GPU = activeJob.AssignedGPU.ModelName
+			if count := len(activeJob.AssignedGPUIndices); count > 1 {
+				job.GPU = fmt.Sprintf("%dx %s", count, job.GPU)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	p.jobMutex.RUnlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+
+	status := "online"
+	if p.draining() {
+		status = "draining"
+	} else if len(jobs) >= p.config.MaxConcurrentJobs {
+		status = "busy"
+	}
+
+	p.jobStats.mu.Lock()
+	completed := p.jobStats.completed
+	p.jobStats.mu.Unlock()
+
+	return controlStatus{
+		ProviderID:        p.provider.ID.String(),
+		Status:            status,
+		Health:            p.healthChecker.report().OverallHealth,
+		ActiveJobs:        jobs,
+		QueuedTasks:       p.jobQueue.Len(),
+		MaxConcurrentJobs: p.config.MaxConcurrentJobs,
+		JobsCompleted:     completed,
+		Settings:          p.settings().controlSettings(),
+		Timestamp:         time.Now(),
+	}
+}
+
+// reloadSettings applies the settings in a reload-config request and returns the
+// resulting settings. Nothing is changed unless the whole request is valid.
+func (p *GPUProvider) reloadSettings(data []byte) (controlSettings, error) {
+	var req controlSettings
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return controlSettings{}, fmt.Errorf("invalid settings: %w", err)
+		}
+	}
+
+	next := p.settings()
+	if req.ImagePolicy != nil {
+		next.ImagePolicy = *req.ImagePolicy
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"drain_timeout", req.DrainTimeout, &next.DrainTimeout},
+		{"cancel_grace_period", req.CancelGracePeriod, &next.CancelGracePeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < 0 {
+			return controlSettings{}, fmt.Errorf("invalid %s: %q", d.name, d.value)
+		}
+		*d.dst = parsed
+	}
+	if req.GPUThrottleCelsius != nil {
+		next.GPUThrottleCelsius = *req.GPUThrottleCelsius
+	}
+	if req.GPUResumeCelsius != nil {
+		next.GPUResumeCelsius = *req.GPUResumeCelsius
+	}
+
+	p.settingsMu.Lock()
+	p.config.ImagePolicy = next.ImagePolicy
+	p.config.DrainTimeout = next.DrainTimeout
+	p.config.CancelGracePeriod = next.CancelGracePeriod
+	p.config.GPUThrottleCelsius = next.GPUThrottleCelsius
+	p.config.GPUResumeCelsius = next.GPUResumeCelsius
+	p.settingsMu.Unlock()
+
+	p.logger.Info("Settings reloaded",
+		zap.Duration("drain_timeout", next.DrainTimeout),
+		zap.Duration("cancel_grace_period", next.CancelGracePeriod),
+		zap.Uint8("gpu_throttle_celsius", next.GPUThrottleCelsius),
+		zap.Uint8("gpu_resume_celsius", next.GPUResumeCelsius),
+		zap.Int("allowed_images", len(next.ImagePolicy.AllowedImages)),
+		zap.Int("denied_images", len(next.ImagePolicy.DeniedImages)),
+	)
+	return next.controlSettings(), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const mb = 1024 * 1024
+
+// fakeDiskEnvironment is a workspace whose disk reports free bytes
+func fakeDiskEnvironment(t *testing.T, free uint64) *ExecutionEnvironment {
+	return &ExecutionEnvironment{
+		workspaceDir: t.TempDir(),
+		logger:       zap.NewNop(),
+		diskUsage: func(string) (*disk.UsageStat, error) {
+			return &disk.UsageStat{Free: free}, nil
+		},
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	tests := []struct {
+		name       string
+		freeMB     uint64
+		requiredMB uint64
+		wantErr    bool
+	}{
+		{"plenty of space", 100 * 1024, 10 * 1024, false},
+		{"exactly the requirement and margin", 10*1024 + diskSpaceSafetyMarginMB, 10 * 1024, false},
+		{"margin not left free", 10*1024 + diskSpaceSafetyMarginMB - 1, 10 * 1024, true},
+		{"no requirement still keeps the margin", diskSpaceSafetyMarginMB - 1, 0, true},
+		{"nearly full disk", 200, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fakeDiskEnvironment(t, tt.freeMB*mb).checkDiskSpace(tt.requiredMB)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkDiskSpace: %v", err)
+				}
+				return
+			}
+			var de *insufficientDiskError
+			if !errors.As(err, &de) {
+				t.Fatalf("checkDiskSpace: %v, want an insufficientDiskError", err)
+			}
+			if de.requiredMB != tt.requiredMB+diskSpaceSafetyMarginMB || de.availableMB != tt.freeMB {
+				t.Errorf("error reports %d MB needed, %d MB available; want %d and %d",
+					de.requiredMB, de.availableMB, tt.requiredMB+diskSpaceSafetyMarginMB, tt.freeMB)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpaceFailures(t *testing.T) {
+	env := fakeDiskEnvironment(t, 100*1024*mb)
+	env.diskUsage = func(string) (*disk.UsageStat, error) { return nil, errors.New("statfs failed") }
+	if err := env.checkDiskSpace(0); err == nil {
+		t.Error("job accepted without knowing the free space")
+	}
+
+	env = fakeDiskEnvironment(t, 100*1024*mb)
+	env.workspaceDir = filepath.Join(env.workspaceDir, "missing")
+	if err := env.checkDiskSpace(0); err == nil {
+		t.Error("job accepted into a workspace that can't be written to")
+	}
+
+	if got := jobErrorType(errWorkspaceReadOnly); got != "workspace_read_only" {
+		t.Errorf("jobErrorType(read-only workspace) = %s, want workspace_read_only", got)
+	}
+}
+
+func TestExecuteTaskRejectsJobWithoutDiskSpace(t *testing.T) {
+	billing := &sessionBilling{}
+	server := httptest.NewServer(billing)
+	defer server.Close()
+	w, p := newExecuteTestWorker(t, server.URL, 512*mb)
+
+	task := &Task{
+		JobID:              "job-1",
+		UserID:             "user-1",
+		ExecutionType:      ExecutionTypeScript,
+		ScriptLanguage:     "bash",
+		Script:             "true",
+		MaxDurationMinutes: 1,
+		Requirements:       ResourceRequirements{DiskSpaceMB: 2048},
+		InputFiles:         []FileTransfer{{URL: server.URL + "/input", Path: "input.bin"}},
+	}
+	core, logs := observer.New(zapcore.ErrorLevel)
+	w.logger = zap.New(core)
+	w.executeTask(task)
+
+	failures := logs.FilterMessage("Task execution error").All()
+	if len(failures) != 1 || failures[0].ContextMap()["stage"] != "preflight" ||
+		!strings.Contains(fmt.Sprint(failures[0].ContextMap()["error"]), "insufficient disk space") {
+		t.Fatalf("task errors %v, want the job rejected for disk space at preflight", failures)
+	}
+	// Rejected before billing started, inputs were downloaded or a workspace was made
+	if requests := billing.requests(); len(requests) != 0 {
+		t.Errorf("requests %v made for a job without disk space", requests)
+	}
+	if _, err := os.Stat(filepath.Join(p.executionEnv.workspaceDir, task.JobID)); !os.IsNotExist(err) {
+		t.Errorf("workspace created for a job without disk space: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dante-backend/common"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func TestExecSessionOnlyForJobOwner(t *testing.T) {
+	p := &GPUProvider{config: &common.ProviderConfig{AllowInteractiveExec: true}, logger: zap.NewNop()}
+
+	tests := []struct {
+		owner, user string
+		wantErr     string
+	}{
+		{"", "", "no recorded owner"},
+		{"", "user-1", "no recorded owner"},
+		{"user-1", "user-2", "another user"},
+		{"user-1", "", "another user"},
+		{"user-1", "user-1", "not running"}, // Past the owner check
+	}
+	for _, tt := range tests {
+		job := &ActiveJob{Task: &Task{JobID: "job-1", UserID: tt.owner}, Status: JobStatusStarting}
+		_, err := p.startExecSession(job, execRequest{SessionID: uuid.NewString(), UserID: tt.user})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q opening a session in %q's job: %v, want %q", tt.user, tt.owner, err, tt.wantErr)
+		}
+	}
+}
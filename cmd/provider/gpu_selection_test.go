@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"dante-backend/common"
+)
+
+// mixedGPUs is a box with cards of several generations
+func mixedGPUs() []common.GPUDetail {
+	return []common.GPUDetail{
+		{ModelName: "NVIDIA A100-SXM4-80GB", VRAM: 81920, Architecture: "Ampere", ComputeCapability: "8.0", IsAvailable: true, IsHealthy: true},
+		{ModelName: "NVIDIA GeForce RTX 3090", VRAM: 24576, Architecture: "Ampere", ComputeCapability: "8.6", IsAvailable: true, IsHealthy: true},
+		{ModelName: "Tesla T4", VRAM: 15360, Architecture: "Turing", ComputeCapability: "7.5", IsAvailable: true, IsHealthy: true},
+		{ModelName: "NVIDIA H100 PCIe", VRAM: 81920, Architecture: "Hopper", ComputeCapability: "9.0", IsAvailable: true, IsHealthy: true},
+		{ModelName: "NVIDIA GeForce RTX 4090", VRAM: 24576, Architecture: "Ada Lovelace", ComputeCapability: "8.9", IsAvailable: false, IsHealthy: true},
+		{ModelName: "NVIDIA L4", VRAM: 23034, Architecture: "Ada Lovelace", ComputeCapability: "8.9", IsAvailable: true, IsHealthy: false},
+	}
+}
+
+func TestSelectBestGPU(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements ResourceRequirements
+		want         int
+	}{
+		{"smallest card without requirements", ResourceRequirements{}, 2},
+		{"smallest card with enough VRAM", ResourceRequirements{GPUMemoryMB: 16000}, 1},
+		{"min VRAM above the requested VRAM", ResourceRequirements{GPUMemoryMB: 8000, MinGPUMemoryMB: 40000}, 0},
+		{"compute capability", ResourceRequirements{GPUComputeUnits: 8.0}, 1},
+		{"newer compute capability", ResourceRequirements{GPUComputeUnits: 8.7}, 3},
+		{"architecture name", ResourceRequirements{Architecture: "hopper"}, 3},
+		{"CUDA target of the same major version", ResourceRequirements{Architecture: "sm_80"}, 1},
+		{"CUDA target needing the minor version", ResourceRequirements{Architecture: "sm_86"}, 1},
+		{"model", ResourceRequirements{GPUModel: "a100"}, 0},
+		{"equal VRAM keeps the first card", ResourceRequirements{MinGPUMemoryMB: 40000, GPUComputeUnits: 8.0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpus := mixedGPUs()
+			got, err := selectBestGPU(gpus, tt.requirements)
+			if err != nil {
+				t.Fatalf("selectBestGPU: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("selected %s, want %s", gpus[got].ModelName, gpus[tt.want].ModelName)
+			}
+		})
+	}
+}
+
+func TestSelectBestGPUNoMatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		gpus         []common.GPUDetail
+		requirements ResourceRequirements
+		wantReason   []string
+	}{
+		{"too little VRAM", mixedGPUs(), ResourceRequirements{MinGPUMemoryMB: 100000}, []string{"vram=4", "unavailable=2"}},
+		{"old compute capability", mixedGPUs(), ResourceRequirements{GPUComputeUnits: 10.0}, []string{"compute_capability=4", "requires compute capability 10.0"}},
+		{"architecture", mixedGPUs(), ResourceRequirements{Architecture: "Blackwell"}, []string{"architecture=4", "requires Blackwell architecture"}},
+		{"CUDA target of another major version", mixedGPUs()[2:3], ResourceRequirements{Architecture: "sm_86"}, []string{"architecture=1"}},
+		{"only the busy card fits", mixedGPUs(), ResourceRequirements{GPUModel: "4090"}, []string{"unavailable=2", "model=4"}},
+		{"no GPUs", nil, ResourceRequirements{}, []string{"no GPUs detected"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := selectBestGPU(tt.gpus, tt.requirements)
+			var noGPU *NoSuitableGPUError
+			if !errors.As(err, &noGPU) {
+				t.Fatalf("selectBestGPU: %v, want a NoSuitableGPUError", err)
+			}
+			if noGPU.Requirements != tt.requirements {
+				t.Errorf("error carries requirements %+v, want %+v", noGPU.Requirements, tt.requirements)
+			}
+			for _, want := range tt.wantReason {
+				if !strings.Contains(noGPU.Reason, want) {
+					t.Errorf("reason %q doesn't mention %q", noGPU.Reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectGPUsTakesBestFits(t *testing.T) {
+	gpus := mixedGPUs()
+	got, err := selectGPUs(gpus, ResourceRequirements{GPUCount: 2, GPUComputeUnits: 8.0})
+	if err != nil {
+		t.Fatalf("selectGPUs: %v", err)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 0 {
+		t.Errorf("selected GPUs %v, want the RTX 3090 then the A100", got)
+	}
+
+	if _, err := selectGPUs(gpus, ResourceRequirements{GPUCount: 5}); !errors.As(err, new(*NoSuitableGPUError)) {
+		t.Errorf("selectGPUs for more GPUs than available: %v, want a NoSuitableGPUError", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"dante-backend/common"
+)
+
+const testDigest = "sha256:4b1d1f9e2c3a5b6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9a0b1c2d3e4f"
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image      string
+		repository string
+		tag        string
+		digest     string
+	}{
+		{"ubuntu", "docker.io/library/ubuntu", "", ""},
+		{"ubuntu:22.04", "docker.io/library/ubuntu", "22.04", ""},
+		{"tensorflow/tensorflow:2.15.0-gpu", "docker.io/tensorflow/tensorflow", "2.15.0-gpu", ""},
+		{"ghcr.io/org/repo@" + testDigest, "ghcr.io/org/repo", "", testDigest},
+		{"registry.local:5000/team/model:v1", "registry.local:5000/team/model", "v1", ""},
+		{"localhost/model", "localhost/model", "", ""},
+		{"nvcr.io/nvidia/pytorch:24.01-py3@" + testDigest, "nvcr.io/nvidia/pytorch", "24.01-py3", testDigest},
+	}
+	for _, tt := range tests {
+		ref, err := parseImageReference(tt.image)
+		if err != nil {
+			t.Errorf("parseImageReference(%q): %v", tt.image, err)
+			continue
+		}
+		if ref.repository != tt.repository || ref.tag != tt.tag || ref.digest != tt.digest {
+			t.Errorf("parseImageReference(%q) = %+v, want %s, tag %q, digest %q", tt.image, *ref, tt.repository, tt.tag, tt.digest)
+		}
+	}
+
+	for _, image := range []string{"Ubuntu", "ubuntu@sha256:abc", "ubuntu@md5:" + strings.Repeat("0", 32), ":latest"} {
+		if _, err := parseImageReference(image); err == nil {
+			t.Errorf("parseImageReference(%q) accepted an invalid reference", image)
+		}
+	}
+}
+
+func TestCheckImagePolicy(t *testing.T) {
+	policy := common.ImagePolicy{
+		AllowedImages: []string{"docker.io/tensorflow/*", "docker.io/library/ubuntu", "ghcr.io/org/*:1.*"},
+		DeniedImages:  []string{"docker.io/tensorflow/tensorflow:*-devel*"},
+	}
+	pinned := policy
+	pinned.RequireDigestPinning = true
+
+	tests := []struct {
+		name    string
+		policy  common.ImagePolicy
+		image   string
+		wantErr string // Substring of the rejection, empty if allowed
+	}{
+		{"no policy", common.ImagePolicy{}, "someone/miner:latest", ""},
+		{"allowed repository glob", policy, "tensorflow/tensorflow:2.15.0-gpu", ""},
+		{"allowed official image", policy, "ubuntu:22.04", ""},
+		{"allowed official image by its full name", policy, "docker.io/library/ubuntu", ""},
+		{"allowed tag glob", policy, "ghcr.io/org/trainer:1.4", ""},
+		{"tag outside the allowed glob", policy, "ghcr.io/org/trainer:2.0", "not in the allowed image list"},
+		{"not allowed", policy, "someone/miner:latest", "not in the allowed image list"},
+		{"glob doesn't cross path segments", policy, "docker.io/tensorflow/serving/extra", "not in the allowed image list"},
+		{"denied takes precedence", policy, "tensorflow/tensorflow:2.15.0-devel-gpu", "matches denied pattern"},
+		{"denied without an allowlist", common.ImagePolicy{DeniedImages: []string{"docker.io/someone/*"}}, "someone/miner", "matches denied pattern"},
+		{"pinned", pinned, "ubuntu@" + testDigest, ""},
+		{"pinned with a tag", pinned, "tensorflow/tensorflow:2.15.0-gpu@" + testDigest, ""},
+		{"unpinned", pinned, "ubuntu:22.04", "digest pinning is required"},
+		{"pinning checked after the allowlist", pinned, "someone/miner@" + testDigest, "not in the allowed image list"},
+		{"invalid digest", policy, "ubuntu@sha256:1234", "invalid digest"},
+		{"no image", common.ImagePolicy{}, "", "no image specified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImagePolicy(tt.policy, tt.image)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkImagePolicy(%q) = %v, want allowed", tt.image, err)
+				}
+				return
+			}
+			var pe *imagePolicyError
+			if !errors.As(err, &pe) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkImagePolicy(%q) = %v, want a policy rejection saying %q", tt.image, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImagePolicyJobErrorType(t *testing.T) {
+	err := fmt.Errorf("execution: %w", checkImagePolicy(common.ImagePolicy{RequireDigestPinning: true}, "ubuntu"))
+	if got := jobErrorType(err); got != "image_policy_violation" {
+		t.Errorf("jobErrorType = %s, want image_policy_violation", got)
+	}
+	if isRecoverableError(err) {
+		t.Error("policy rejection is retried")
+	}
+}
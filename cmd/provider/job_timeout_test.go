@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v3/disk"
+	"go.uber.org/zap"
+)
+
+// sessionBilling is a billing service that starts sessions and records how they end
+type sessionBilling struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (b *sessionBilling) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.paths = append(b.paths, r.URL.Path)
+	b.mu.Unlock()
+
+	var session BillingSessionResponse
+	session.Session.ID = uuid.New()
+	if strings.HasSuffix(r.URL.Path, "/start") {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(&session)
+}
+
+func (b *sessionBilling) requests() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.paths...)
+}
+
+// newExecuteTestWorker returns a worker of a provider with one GPU that bills through
+// billingURL and whose workspace has free bytes of disk space
+func newExecuteTestWorker(t *testing.T, billingURL string, free uint64) (*TaskWorker, *GPUProvider) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	gpus := []common.GPUDetail{{ModelName: "RTX 4090", VRAM: 24576, IsAvailable: true, IsHealthy: true}}
+	p := &GPUProvider{
+		config: &common.ProviderConfig{
+			BillingServiceURL: billingURL,
+			MetricsInterval:   time.Hour,
+			CancelGracePeriod: 100 * time.Millisecond,
+		},
+		logger:     zap.NewNop(),
+		provider:   &common.Provider{ID: uuid.New()},
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		gpus:       gpus,
+		executionEnv: &ExecutionEnvironment{
+			workspaceDir: t.TempDir(),
+			logger:       zap.NewNop(),
+			diskUsage: func(string) (*disk.UsageStat, error) {
+				return &disk.UsageStat{Free: free}, nil
+			},
+		},
+		resourceManager: newResourceManager(1, gpus),
+		alertManager:    newAlertManager(common.AlertSettings{}, zap.NewNop()),
+		activeJobs:      make(map[string]*ActiveJob),
+		ctx:             ctx,
+	}
+	return &TaskWorker{provider: p, logger: zap.NewNop(), ctx: ctx, cancel: cancel}, p
+}
+
+// awaitJob returns the job once the provider tracks it, to see how it ended
+func awaitJob(p *GPUProvider, jobID string) <-chan *ActiveJob {
+	jobs := make(chan *ActiveJob, 1)
+	go func() {
+		for {
+			p.jobMutex.RLock()
+			job := p.activeJobs[jobID]
+			p.jobMutex.RUnlock()
+			if job != nil {
+				jobs <- job
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return jobs
+}
+
+func TestExecuteTaskTimesOut(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	defer func(unit time.Duration) { maxDurationUnit = unit }(maxDurationUnit)
+	maxDurationUnit = 300 * time.Millisecond
+
+	billing := &sessionBilling{}
+	server := httptest.NewServer(billing)
+	defer server.Close()
+	w, p := newExecuteTestWorker(t, server.URL, 100<<30)
+
+	task := &Task{
+		JobID:              "job-1",
+		UserID:             "user-1",
+		ExecutionType:      ExecutionTypeScript,
+		ScriptLanguage:     "bash",
+		Script:             "sleep 30",
+		MaxDurationMinutes: 1,
+	}
+	jobs := awaitJob(p, task.JobID)
+
+	start := time.Now()
+	w.executeTask(task)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("task ran for %v, want it stopped at its 300ms max duration", elapsed)
+	}
+
+	job := <-jobs
+	if job.Status != JobStatusTimeout {
+		t.Errorf("job %s, want %s", job.Status, JobStatusTimeout)
+	}
+	errs := job.ErrorCollector.Errors
+	if len(errs) != 1 || errs[0].ErrorType != "timeout" || errs[0].Stage != "execution" {
+		t.Errorf("errors %+v, want one timeout during execution", errs)
+	}
+
+	// The script ran, so the session is ended and billed for the time used, not refunded
+	requests := billing.requests()
+	if len(requests) != 2 || !strings.HasSuffix(requests[0], "/start") || !strings.HasSuffix(requests[1], "/end") {
+		t.Errorf("billing requests %v, want the session started and ended", requests)
+	}
+}
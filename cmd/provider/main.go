@@ -2,33 +2,53 @@ package main
 
 import (
 	"bytes"
+	"container/heap"
 	"context"
-	"crypto/tls"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 
@@ -43,6 +63,7 @@ const (
 	ExecutionTypeScript TaskExecutionType = "script"
 	ExecutionTypePython TaskExecutionType = "python"
 	ExecutionTypeBash   TaskExecutionType = "bash"
+	ExecutionTypeWASM   TaskExecutionType = "wasm"
 )
 
 // JobStatus represents the status of a job
@@ -59,10 +80,11 @@ const (
 	JobStatusTimeout    JobStatus = "timeout"
 )
 
-// AppleGPUMetrics represents Apple GPU metrics from system_profiler
+// AppleGPUMetrics represents live Apple GPU metrics from powermetrics/ioreg
 type AppleGPUMetrics struct {
 	Utilization float64
 	Temperature float64
+	PowerDrawW  float64
 }
 
 // Task represents comprehensive work sent to the provider daemon
@@ -88,6 +110,11 @@ type Task struct {
 	ScriptLanguage    string            `json:"script_language,omitempty"`
 	ScriptEnvironment map[string]string `json:"script_environment,omitempty"`
 
+	// WebAssembly execution parameters; the module path is relative to the
+	// job workspace, typically delivered as an input file
+	WASMModule string   `json:"wasm_module,omitempty"`
+	WASMArgs   []string `json:"wasm_args,omitempty"`
+
 	// Resource requirements and constraints
 	Requirements ResourceRequirements `json:"requirements"`
 	Constraints  TaskConstraints      `json:"constraints"`
@@ -121,11 +148,17 @@ type VolumeMount struct {
 type ResourceRequirements struct {
 	GPUModel           string  `json:"gpu_model,omitempty"`
 	GPUMemoryMB        uint64  `json:"gpu_memory_mb"`
-	GPUComputeUnits    float64 `json:"gpu_compute_units"`
+	MinGPUMemoryMB     uint64  `json:"min_gpu_memory_mb"`
+	GPUComputeUnits    float64 `json:"gpu_compute_units"` // minimum compute capability, e.g. 8.0
+	Architecture       string  `json:"architecture,omitempty"`
 	CPUCores           int     `json:"cpu_cores"`
 	MemoryMB           uint64  `json:"memory_mb"`
 	DiskSpaceMB        uint64  `json:"disk_space_mb"`
 	NetworkBandwidthMB uint64  `json:"network_bandwidth_mb"`
+
+	// GPUs the job needs on this provider, e.g. for NCCL training; 0 means one. A job
+	// spanning several GPUs gets each of them to itself.
+	GPUCount int `json:"gpu_count,omitempty"`
 }
 
 // TaskConstraints specifies execution constraints
@@ -136,6 +169,7 @@ type TaskConstraints struct {
 	MaxNetworkUsageMB     uint64  `json:"max_network_usage_mb"`
 	AllowNetworkAccess    bool    `json:"allow_network_access"`
 	AllowFileSystemAccess bool    `json:"allow_filesystem_access"`
+	IsolationLevel        string  `json:"isolation_level,omitempty"` // process, gvisor, container, vm
 }
 
 // FileTransfer represents a file to be transferred
@@ -310,6 +344,7 @@ type BillingSessionResponse struct {
 
 // UsageUpdateRequest for sending usage updates to billing
 type UsageUpdateRequest struct {
+	UpdateID        uuid.UUID              `json:"update_id"` // Lets billing drop redelivered updates
 	SessionID       uuid.UUID              `json:"session_id"`
 	JobID           string                 `json:"job_id"`
 	ProviderID      uuid.UUID              `json:"provider_id"`
@@ -324,6 +359,31 @@ type UsageUpdateRequest struct {
 	CustomMetrics   map[string]interface{} `json:"custom_metrics,omitempty"`
 }
 
+// HeartbeatRequest is sent periodically to the provider registry
+type HeartbeatRequest struct {
+	ProviderID        uuid.UUID          `json:"provider_id"`
+	Status            string             `json:"status"`
+	GPUMetrics        []common.GPUDetail `json:"gpu_metrics"`
+	GPUCapacity       []GPUCapacity      `json:"gpu_capacity"`
+	ActiveJobs        int                `json:"active_jobs"`
+	MaxConcurrentJobs int                `json:"max_concurrent_jobs"`
+	AvailableSlots    int                `json:"available_slots"`
+	Timestamp         time.Time          `json:"timestamp"`
+}
+
+// GPUCapacity reports the live state of a single GPU for placement decisions
+type GPUCapacity struct {
+	Index             int    `json:"index"`
+	UUID              string `json:"uuid,omitempty"`
+	ModelName         string `json:"model_name"`
+	MemoryTotalMB     uint64 `json:"memory_total_mb"`
+	MemoryFreeMB      uint64 `json:"memory_free_mb"`
+	UtilizationGPU    uint8  `json:"utilization_gpu_percent"`
+	UtilizationMemory uint8  `json:"utilization_memory_percent"`
+	Temperature       uint8  `json:"temperature_celsius"`
+	PowerDraw         uint32 `json:"power_draw_watts"`
+}
+
 // SolanaWalletManager manages Solana wallet operations
 type SolanaWalletManager struct {
 	privateKey      solana.PrivateKey
@@ -339,6 +399,52 @@ type ExecutionEnvironment struct {
 	workspaceDir  string
 	logger        *zap.Logger
 	resourceLimit ResourceLimit
+
+	// diskUsage reports free space for a path; disk.Usage unless replaced
+	diskUsage func(path string) (*disk.UsageStat, error)
+}
+
+// diskSpaceSafetyMarginMB is kept free on top of a job's disk requirement for
+// logs, temporary files and output written beyond the estimate
+const diskSpaceSafetyMarginMB = 1024
+
+// insufficientDiskError rejects a job whose disk requirement exceeds the free space
+type insufficientDiskError struct {
+	requiredMB  uint64
+	availableMB uint64
+}
+
+func (e *insufficientDiskError) Error() string {
+	return fmt.Sprintf("insufficient disk space: job needs %d MB (including %d MB margin), %d MB available",
+		e.requiredMB, diskSpaceSafetyMarginMB, e.availableMB)
+}
+
+// errWorkspaceReadOnly rejects jobs when the workspace can't be written to
+var errWorkspaceReadOnly = errors.New("workspace is on a read-only file system")
+
+// checkDiskSpace verifies that the workspace is writable and has room for
+// requiredMB plus diskSpaceSafetyMarginMB
+func (e *ExecutionEnvironment) checkDiskSpace(requiredMB uint64) error {
+	probe, err := os.CreateTemp(e.workspaceDir, ".preflight-*")
+	if errors.Is(err, syscall.EROFS) {
+		return errWorkspaceReadOnly
+	}
+	if err != nil {
+		return fmt.Errorf("workspace is not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	usage, err := e.diskUsage(e.workspaceDir)
+	if err != nil {
+		return fmt.Errorf("failed to check free disk space: %w", err)
+	}
+
+	availableMB := usage.Free / (1024 * 1024)
+	if needed := requiredMB + diskSpaceSafetyMarginMB; availableMB < needed {
+		return &insufficientDiskError{requiredMB: needed, availableMB: availableMB}
+	}
+	return nil
 }
 
 // ResourceLimit defines resource limits for task execution
@@ -363,8 +469,17 @@ type GPUProvider struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
+	workers        sync.WaitGroup // Task workers, waited on separately so jobs can drain
 	mu             sync.RWMutex
-	isShuttingDown bool
+	initialized    bool // Set by Initialize, which must only run once
+	isShuttingDown bool // Set once draining starts; new tasks are rejected
+
+	// Closed when a drain is requested over the control channel
+	drainRequested chan struct{}
+	drainOnce      sync.Once
+
+	// Guards the config fields that reload-config can change while running
+	settingsMu sync.RWMutex
 
 	// Advanced components
 	walletManager *SolanaWalletManager
@@ -372,19 +487,211 @@ type GPUProvider struct {
 	activeJobs    map[string]*ActiveJob
 	jobMutex      sync.RWMutex
 
-	// Monitoring and metrics
+	// Monitoring and metrics. systemMetrics is replaced whole on every collection
+	// and never modified in place, so readers can use the snapshot after unlocking.
 	systemMetrics *SystemMetrics
+	metricsMutex  sync.RWMutex
+	cpuSampler    *cpuSampler
+	cpuPower      *cpuPowerSampler
 	alertManager  *AlertManager
 	healthChecker *HealthChecker
+	statusServer  *http.Server // Local status API; nil when disabled
 
 	// Performance tracking
 	performanceHistory []PerformanceSnapshot
+	thermalHistory     []ThermalEvent // Guarded by historyMutex too
 	historyMutex       sync.RWMutex
+	jobStats           jobStats
+
+	// Cards the thermal guard has paused, keyed by UUID or "index-N" for cards
+	// without one. Only touched by the metrics loop.
+	thermalThrottled map[string]bool
 
 	// Rate limiting and resource management
 	resourceManager *ResourceManager
-	jobQueue        chan *Task
+	jobQueue        *taskQueue
 	workerPool      []*TaskWorker
+
+	// Messages held back while NATS is disconnected
+	pendingPublishes []pendingPublish
+	publishMutex     sync.Mutex
+
+	// Set once the job output bucket is known to exist in the storage-service
+	jobBucketReady bool
+	jobBucketMutex sync.Mutex
+}
+
+// pendingPublish is a NATS message waiting for the connection to come back
+type pendingPublish struct {
+	Subject string
+	Data    []byte
+}
+
+const (
+	// maxPendingPublishes bounds the disconnected publish buffer; the oldest
+	// messages are dropped once it is full.
+	maxPendingPublishes = 1000
+	// natsReconnectBufSize is the client library's own buffer used while reconnecting
+	natsReconnectBufSize = 8 * 1024 * 1024
+)
+
+// jobQueueCapacity is the number of tasks that may wait for a free worker before
+// EnqueueTask blocks.
+const jobQueueCapacity = 100
+
+var errTaskQueueClosed = errors.New("task queue closed")
+
+// shutdownWaitTimeout bounds how long Shutdown waits for background loops and
+// workers to return once their context is canceled.
+const shutdownWaitTimeout = 15 * time.Second
+
+// deregisterTimeout bounds the offline notice sent to the registry on shutdown, so an
+// unreachable registry doesn't hold shutdown up.
+const deregisterTimeout = 5 * time.Second
+
+// taskQueue is a bounded priority queue of tasks waiting for a worker. Tasks with a
+// higher Priority are dispatched first; equal priorities are dispatched in submission order.
+type taskQueue struct {
+	mu     sync.Mutex
+	items  taskHeap
+	seq    uint64
+	closed bool
+
+	space     chan struct{} // One token per free slot; Push blocks when empty
+	available chan struct{} // One token per queued task; Pop blocks when empty
+}
+
+func newTaskQueue(capacity int) *taskQueue {
+	q := &taskQueue{
+		space:     make(chan struct{}, capacity),
+		available: make(chan struct{}, capacity),
+	}
+	for i := 0; i < capacity; i++ {
+		q.space <- struct{}{}
+	}
+	return q
+}
+
+// Push adds a task, blocking while the queue is full until a slot frees up or ctx is done.
+func (q *taskQueue) Push(ctx context.Context, task *Task) error {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return errTaskQueueClosed
+	}
+
+	select {
+	case <-q.space:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		q.space <- struct{}{}
+		return errTaskQueueClosed
+	}
+	q.seq++
+	heap.Push(&q.items, &queuedTask{task: task, seq: q.seq})
+	q.available <- struct{}{} // Never blocks: tokens never exceed capacity
+	return nil
+}
+
+// Pop removes the highest priority task, blocking until one is queued, the queue is
+// closed and drained, or ctx is done.
+func (q *taskQueue) Pop(ctx context.Context) (*Task, error) {
+	select {
+	case _, ok := <-q.available:
+		if !ok {
+			return nil, errTaskQueueClosed
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	q.mu.Lock()
+	if q.items.Len() == 0 {
+		// Drain took the task this token was for
+		q.mu.Unlock()
+		return nil, errTaskQueueClosed
+	}
+	item := heap.Pop(&q.items).(*queuedTask)
+	q.mu.Unlock()
+
+	q.space <- struct{}{}
+	return item.task, nil
+}
+
+// Len returns the number of queued tasks.
+func (q *taskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// Close stops accepting tasks. Tasks already queued can still be popped.
+func (q *taskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.available)
+	}
+}
+
+// Drain closes the queue and removes the tasks still waiting in it, in dispatch
+// order, so they can be handed back. Workers stop once their current task is done.
+func (q *taskQueue) Drain() []*Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.available)
+	}
+
+	tasks := make([]*Task, 0, q.items.Len())
+	for q.items.Len() > 0 {
+		tasks = append(tasks, heap.Pop(&q.items).(*queuedTask).task)
+		q.space <- struct{}{} // Wakes a Push blocked on a full queue to find it closed
+	}
+	return tasks
+}
+
+// queuedTask is a heap entry; seq breaks ties between tasks with identical submission times.
+type queuedTask struct {
+	task *Task
+	seq  uint64
+}
+
+// taskHeap implements heap.Interface ordered by priority, then submission time.
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	a, b := h[i], h[j]
+	if a.task.Priority != b.task.Priority {
+		return a.task.Priority > b.task.Priority
+	}
+	if !a.task.SubmittedAt.Equal(b.task.SubmittedAt) {
+		return a.task.SubmittedAt.Before(b.task.SubmittedAt)
+	}
+	return a.seq < b.seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
 }
 
 // ActiveJob tracks an active job execution
@@ -401,19 +708,247 @@ type ActiveJob struct {
 	Progress        float32
 	ResourceUsage   ResourceUsage
 	BillingSession  *BillingSessionResponse
+	AssignedGPU     *common.GPUDetail    // First GPU or MIG instance the job was placed on
+	AssignedGPUIdx  int                  // Index of AssignedGPU among the provider's GPUs, -1 if none
+	Reservation     *ResourceReservation // Capacity held for the job, including its share of the GPU's VRAM
 	Metrics         ExecutionMetrics
 	GPUMetrics      []GPUMetrics
 	OutputCollector *OutputCollector
 	ErrorCollector  *ErrorCollector
+	OutputFilesURL  []string
+	Artifacts       []Artifact // Uploaded output files, reported in the final status
+	LogsURL         string     // Presigned link to the uploaded output log
+	CancelRequested atomic.Bool
+	Secrets         *secretRedactor // Masks the job's resolved secrets; nil if it has none
+
+	// ProcessPID is the script or WASM runtime process, for per-job process metrics
+	ProcessPID atomic.Int32
+
+	// AssignedGPUIndices lists every GPU the job was placed on, AssignedGPUIdx first
+	AssignedGPUIndices []int
+
+	// ExecutionStarted is set once the job's workload has started running. Failures
+	// before that are refunded rather than billed.
+	ExecutionStarted atomic.Bool
+
+	// usageMu guards ResourceUsage and Metrics, which metric collectors update concurrently
+	usageMu sync.RWMutex
+}
+
+// recordUsage stores the latest per-job resource usage and execution metrics
+func (aj *ActiveJob) recordUsage(usage ResourceUsage, metrics ExecutionMetrics) {
+	aj.usageMu.Lock()
+	defer aj.usageMu.Unlock()
+	usage.Timestamp = time.Now()
+	aj.ResourceUsage = usage
+	aj.Metrics = metrics
+}
+
+// usageSnapshot returns copies of the latest resource usage and execution metrics
+func (aj *ActiveJob) usageSnapshot() (ResourceUsage, ExecutionMetrics) {
+	aj.usageMu.RLock()
+	defer aj.usageMu.RUnlock()
+	return aj.ResourceUsage, aj.Metrics
 }
 
-// OutputCollector manages stdout/stderr collection
+// OutputCollector manages stdout/stderr collection. The in-memory buffers are
+// bounded by MaxSizeMB; when LogFile is set the complete output is also
+// written there so nothing is lost once the buffers are truncated.
 type OutputCollector struct {
 	Stdout    strings.Builder
 	Stderr    strings.Builder
 	LogFile   *os.File
 	MaxSizeMB int
 	mu        sync.Mutex
+
+	bytesWritten int64
+	truncated    bool
+
+	// redactor masks the job's secrets in everything recorded. Output written in
+	// chunks keeps back a tail that may begin a secret until more output arrives.
+	redactor *secretRedactor
+	held     map[string]string
+}
+
+// outputTruncatedMarker is appended once the collector stops buffering output
+const outputTruncatedMarker = "\n[output truncated]\n"
+
+// write records p, with the job's secrets masked
+func (oc *OutputCollector) write(stream string, p []byte) (int, error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	n := len(p)
+	if oc.redactor != nil {
+		p = oc.redactChunk(stream, p)
+	}
+	oc.record(stream, p)
+	return n, nil
+}
+
+// redactSecrets masks the given secrets in all output recorded from now on
+func (oc *OutputCollector) redactSecrets(redactor *secretRedactor) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	oc.redactor = redactor
+}
+
+// redactChunk masks secrets in a chunk of output joined to the tail held back from
+// the previous chunk. It holds back the new tail, which is too short to contain a
+// whole secret but may be the start of one, and returns the rest.
+func (oc *OutputCollector) redactChunk(stream string, p []byte) []byte {
+	text := oc.redactor.Redact(oc.held[stream] + string(p))
+	keep := oc.redactor.maxLen - 1
+	if keep > len(text) {
+		keep = len(text)
+	}
+	if oc.held == nil {
+		oc.held = make(map[string]string)
+	}
+	oc.held[stream] = text[len(text)-keep:]
+	return []byte(text[:len(text)-keep])
+}
+
+// flushHeld records the output held back by redactChunk
+func (oc *OutputCollector) flushHeld() {
+	for _, stream := range []string{"stdout", "stderr"} {
+		if held := oc.held[stream]; held != "" {
+			oc.record(stream, []byte(held))
+			delete(oc.held, stream)
+		}
+	}
+}
+
+// record appends p to the stdout or stderr buffer until MaxSizeMB is reached,
+// after which a truncation marker is recorded and further output is only
+// written to LogFile
+func (oc *OutputCollector) record(stream string, p []byte) {
+	if oc.LogFile != nil {
+		// The log file is best effort; a failing disk must not fail the job
+		oc.LogFile.Write(p)
+	}
+
+	target := &oc.Stdout
+	if stream == "stderr" {
+		target = &oc.Stderr
+	}
+
+	limit := int64(oc.MaxSizeMB) * 1024 * 1024
+	if limit <= 0 {
+		target.Write(p)
+		return
+	}
+
+	if oc.truncated {
+		return
+	}
+
+	remaining := limit - oc.bytesWritten
+	if int64(len(p)) <= remaining {
+		target.Write(p)
+		oc.bytesWritten += int64(len(p))
+		return
+	}
+
+	target.Write(p[:remaining])
+	target.WriteString(outputTruncatedMarker)
+	oc.bytesWritten = limit
+	oc.truncated = true
+}
+
+// StdoutWriter returns an io.Writer feeding the bounded stdout buffer
+func (oc *OutputCollector) StdoutWriter() io.Writer {
+	return collectorWriter{collector: oc, stream: "stdout"}
+}
+
+// StderrWriter returns an io.Writer feeding the bounded stderr buffer
+func (oc *OutputCollector) StderrWriter() io.Writer {
+	return collectorWriter{collector: oc, stream: "stderr"}
+}
+
+// Output returns copies of the buffered stdout and stderr
+func (oc *OutputCollector) Output() (string, string) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	oc.flushHeld()
+	return oc.Stdout.String(), oc.Stderr.String()
+}
+
+// Truncated reports whether output exceeded MaxSizeMB
+func (oc *OutputCollector) Truncated() bool {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	return oc.truncated
+}
+
+// collectorWriter adapts one stream of an OutputCollector to io.Writer
+type collectorWriter struct {
+	collector *OutputCollector
+	stream    string
+}
+
+func (cw collectorWriter) Write(p []byte) (int, error) {
+	return cw.collector.write(cw.stream, p)
+}
+
+// appendLogLine appends a line to the stdout or stderr buffer, dropping the
+// oldest lines once the combined size exceeds MaxSizeMB. It returns the line as
+// recorded, with the job's secrets masked.
+func (oc *OutputCollector) appendLogLine(stream, line string) string {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	line = oc.redactor.Redact(line)
+	if oc.LogFile != nil {
+		oc.LogFile.WriteString(line + "\n")
+	}
+
+	target := &oc.Stdout
+	if stream == "stderr" {
+		target = &oc.Stderr
+	}
+	target.WriteString(line)
+	target.WriteByte('\n')
+
+	limit := oc.MaxSizeMB * 1024 * 1024
+	if limit <= 0 {
+		return line
+	}
+
+	if excess := oc.Stdout.Len() + oc.Stderr.Len() - limit; excess > 0 {
+		// Drop an extra tenth of the limit so trimming isn't repeated on every line
+		excess += limit / 10
+		if oc.Stdout.Len() >= oc.Stderr.Len() {
+			dropOldestLines(&oc.Stdout, excess)
+		} else {
+			dropOldestLines(&oc.Stderr, excess)
+		}
+	}
+	return line
+}
+
+// dropOldestLines removes at least n bytes of whole lines from the start of b
+func dropOldestLines(b *strings.Builder, n int) {
+	current := b.String()
+	cut := len(current)
+	if n < len(current) {
+		if idx := strings.IndexByte(current[n:], '\n'); idx >= 0 {
+			cut = n + idx + 1
+		}
+	}
+
+	remaining := current[cut:]
+	b.Reset()
+	b.WriteString(remaining)
+}
+
+// ContainerLogLine is a single line of container output published on task.logs.<job_id>
+type ContainerLogLine struct {
+	JobID     string    `json:"job_id"`
+	Stream    string    `json:"stream"` // stdout or stderr
+	Sequence  uint64    `json:"sequence"`
+	Line      string    `json:"line"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // ErrorCollector manages error tracking and reporting
@@ -457,6 +992,10 @@ type AlertManager struct {
 	mu            sync.Mutex
 	webhookURL    string
 	emailSettings EmailSettings
+	httpClient    *http.Client
+	minSeverity   string
+	cooldown      time.Duration
+	lastRaised    map[string]time.Time // Keyed by alertKey
 }
 
 // Alert represents a system alert
@@ -464,6 +1003,7 @@ type Alert struct {
 	ID         string                 `json:"id"`
 	Type       string                 `json:"type"`
 	Severity   string                 `json:"severity"`
+	Source     string                 `json:"source,omitempty"` // What the alert is about, e.g. gpu-0
 	Message    string                 `json:"message"`
 	Details    map[string]interface{} `json:"details"`
 	Timestamp  time.Time              `json:"timestamp"`
@@ -471,6 +1011,28 @@ type Alert struct {
 	ResolvedAt *time.Time             `json:"resolved_at,omitempty"`
 }
 
+// Alert severities, in increasing order
+const (
+	alertSeverityInfo     = "info"
+	alertSeverityWarning  = "warning"
+	alertSeverityCritical = "critical"
+)
+
+var alertSeverityRank = map[string]int{
+	alertSeverityInfo:     1,
+	alertSeverityWarning:  2,
+	alertSeverityCritical: 3,
+}
+
+// Alert types
+const (
+	alertTypeGPUOvertemp    = "gpu_overtemp"
+	alertTypeBillingFailure = "billing_failure"
+)
+
+// maxStoredAlerts bounds the alert history kept in memory
+const maxStoredAlerts = 500
+
 // EmailSettings for alert notifications
 type EmailSettings struct {
 	SMTPHost    string
@@ -481,6 +1043,192 @@ type EmailSettings struct {
 	ToAddresses []string
 }
 
+// newAlertManager creates an alert manager delivering alerts as configured
+func newAlertManager(settings common.AlertSettings, logger *zap.Logger) *AlertManager {
+	minSeverity := settings.MinSeverity
+	if _, ok := alertSeverityRank[minSeverity]; !ok {
+		minSeverity = alertSeverityWarning
+	}
+
+	return &AlertManager{
+		logger:     logger,
+		alerts:     make([]Alert, 0),
+		webhookURL: settings.WebhookURL,
+		emailSettings: EmailSettings{
+			SMTPHost:    settings.SMTPHost,
+			SMTPPort:    settings.SMTPPort,
+			Username:    settings.SMTPUsername,
+			Password:    settings.SMTPPassword,
+			FromAddress: settings.EmailFrom,
+			ToAddresses: settings.EmailTo,
+		},
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		minSeverity: minSeverity,
+		cooldown:    settings.Cooldown,
+		lastRaised:  make(map[string]time.Time),
+	}
+}
+
+func alertKey(alertType, source string) string {
+	return alertType + "/" + source
+}
+
+// RaiseAlert records an alert and delivers it if its severity is at or above the
+// configured threshold. An alert repeating one that is still unresolved within the
+// cooldown window is dropped. It reports whether the alert was recorded.
+func (am *AlertManager) RaiseAlert(alert Alert) bool {
+	now := time.Now()
+	key := alertKey(alert.Type, alert.Source)
+
+	am.mu.Lock()
+	if last, ok := am.lastRaised[key]; ok && now.Sub(last) < am.cooldown && am.hasUnresolvedLocked(alert.Type, alert.Source) {
+		am.mu.Unlock()
+		return false
+	}
+
+	if alert.ID == "" {
+		alert.ID = uuid.New().String()
+	}
+	alert.Timestamp = now
+	alert.Resolved = false
+	alert.ResolvedAt = nil
+
+	am.alerts = append(am.alerts, alert)
+	if len(am.alerts) > maxStoredAlerts {
+		am.alerts = am.alerts[len(am.alerts)-maxStoredAlerts:]
+	}
+	am.lastRaised[key] = now
+	am.mu.Unlock()
+
+	am.logger.Warn("Alert raised",
+		zap.String("type", alert.Type),
+		zap.String("severity", alert.Severity),
+		zap.String("source", alert.Source),
+		zap.String("message", alert.Message))
+
+	if am.shouldDeliver(alert.Severity) {
+		go am.deliver(alert)
+	}
+	return true
+}
+
+// ResolveAlert marks unresolved alerts of the given type and source resolved, e.g.
+// once a GPU has cooled down, and sends a resolution notice for delivered alerts
+func (am *AlertManager) ResolveAlert(alertType, source string) {
+	now := time.Now()
+
+	am.mu.Lock()
+	var resolved []Alert
+	for i := range am.alerts {
+		if am.alerts[i].Type == alertType && am.alerts[i].Source == source && !am.alerts[i].Resolved {
+			am.alerts[i].Resolved = true
+			am.alerts[i].ResolvedAt = &now
+			resolved = append(resolved, am.alerts[i])
+		}
+	}
+	delete(am.lastRaised, alertKey(alertType, source))
+	am.mu.Unlock()
+
+	for _, alert := range resolved {
+		am.logger.Info("Alert resolved",
+			zap.String("type", alert.Type),
+			zap.String("source", alert.Source),
+			zap.String("alert_id", alert.ID))
+
+		if am.shouldDeliver(alert.Severity) {
+			go am.deliver(alert)
+		}
+	}
+}
+
+// hasUnresolvedLocked reports whether an unresolved alert of the type and source
+// exists. Caller must hold am.mu.
+func (am *AlertManager) hasUnresolvedLocked(alertType, source string) bool {
+	for i := len(am.alerts) - 1; i >= 0; i-- {
+		if am.alerts[i].Type == alertType && am.alerts[i].Source == source && !am.alerts[i].Resolved {
+			return true
+		}
+	}
+	return false
+}
+
+func (am *AlertManager) shouldDeliver(severity string) bool {
+	return alertSeverityRank[severity] >= alertSeverityRank[am.minSeverity]
+}
+
+// deliver posts the alert to the webhook and emails it, where configured
+func (am *AlertManager) deliver(alert Alert) {
+	if am.webhookURL != "" {
+		if err := am.postWebhook(alert); err != nil {
+			am.logger.Error("Failed to deliver alert webhook", zap.String("alert_id", alert.ID), zap.Error(err))
+		}
+	}
+
+	if am.emailSettings.SMTPHost != "" && len(am.emailSettings.ToAddresses) > 0 {
+		if err := am.sendEmail(alert); err != nil {
+			am.logger.Error("Failed to send alert email", zap.String("alert_id", alert.ID), zap.Error(err))
+		}
+	}
+}
+
+func (am *AlertManager) postWebhook(alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	resp, err := am.httpClient.Post(am.webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (am *AlertManager) sendEmail(alert Alert) error {
+	settings := am.emailSettings
+
+	state := strings.ToUpper(alert.Severity)
+	if alert.Resolved {
+		state = "RESOLVED"
+	}
+	subject := fmt.Sprintf("[Dante provider][%s] %s", state, alert.Message)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\r\n\r\n", alert.Message)
+	fmt.Fprintf(&body, "Type: %s\r\nSeverity: %s\r\nSource: %s\r\nRaised: %s\r\n",
+		alert.Type, alert.Severity, alert.Source, alert.Timestamp.UTC().Format(time.RFC1123Z))
+	if alert.ResolvedAt != nil {
+		fmt.Fprintf(&body, "Resolved: %s\r\n", alert.ResolvedAt.UTC().Format(time.RFC1123Z))
+	}
+	keys := make([]string, 0, len(alert.Details))
+	for k := range alert.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&body, "%s: %v\r\n", k, alert.Details[k])
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		settings.FromAddress,
+		strings.Join(settings.ToAddresses, ", "),
+		subject,
+		time.Now().Format(time.RFC1123Z),
+		body.String())
+
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, settings.SMTPHost)
+	}
+	addr := fmt.Sprintf("%s:%d", settings.SMTPHost, settings.SMTPPort)
+	return smtp.SendMail(addr, auth, settings.FromAddress, settings.ToAddresses, []byte(msg))
+}
+
 // HealthChecker monitors system health
 type HealthChecker struct {
 	logger        *zap.Logger
@@ -490,6 +1238,72 @@ type HealthChecker struct {
 	mu            sync.Mutex
 }
 
+// Health check statuses, from best to worst
+const (
+	healthStatusHealthy   = "healthy"
+	healthStatusDegraded  = "degraded"
+	healthStatusUnhealthy = "unhealthy"
+)
+
+var healthStatusRank = map[string]int{
+	healthStatusHealthy:   0,
+	healthStatusDegraded:  1,
+	healthStatusUnhealthy: 2,
+}
+
+// healthCheckInterval is how often performHealthChecks runs
+const healthCheckInterval = time.Minute
+
+// updateCheck records the result of a named check and recomputes overall health
+// as the worst status of any check
+func (hc *HealthChecker) updateCheck(check HealthCheck) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	replaced := false
+	for i := range hc.checks {
+		if hc.checks[i].Name == check.Name {
+			hc.checks[i] = check
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		hc.checks = append(hc.checks, check)
+	}
+
+	hc.lastCheckTime = check.LastCheck
+	hc.overallHealth = healthStatusHealthy
+	for _, c := range hc.checks {
+		if healthStatusRank[c.Status] > healthStatusRank[hc.overallHealth] {
+			hc.overallHealth = c.Status
+		}
+	}
+}
+
+// HealthReport is the local status API's view of the provider's health
+type HealthReport struct {
+	OverallHealth string        `json:"overall_health"`
+	LastCheck     time.Time     `json:"last_check"`
+	Checks        []HealthCheck `json:"checks"`
+}
+
+// report returns a copy of the current health check results
+func (hc *HealthChecker) report() HealthReport {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	checks := make([]HealthCheck, len(hc.checks))
+	copy(checks, hc.checks)
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	return HealthReport{
+		OverallHealth: hc.overallHealth,
+		LastCheck:     hc.lastCheckTime,
+		Checks:        checks,
+	}
+}
+
 // HealthCheck represents a health check
 type HealthCheck struct {
 	Name      string                 `json:"name"`
@@ -514,14 +1328,259 @@ type PerformanceSnapshot struct {
 	ProviderEarnings     decimal.Decimal `json:"provider_earnings"`
 }
 
-// ResourceManager manages resource allocation and limits
-type ResourceManager struct {
-	maxConcurrentJobs int
-	maxCPUUsage       float64
-	maxMemoryUsage    float64
+const (
+	// maxPerformanceHistory bounds the performance snapshots kept in memory; at
+	// the snapshot interval that is about 16 hours
+	maxPerformanceHistory = 1000
+
+	// maxThermalHistory bounds the thermal events kept in memory
+	maxThermalHistory = 1000
+
+	// gpuResumeMargin is how far below the throttle temperature a GPU must cool
+	// before it takes jobs again, unless a resume temperature is configured
+	gpuResumeMargin = 6
+
+	// performanceSnapshotInterval is how often the performance recorder takes a snapshot
+	performanceSnapshotInterval = time.Minute
+)
+
+// jobStats accumulates totals for jobs this provider has run since it started
+type jobStats struct {
+	mu                 sync.Mutex
+	completed          int
+	totalExecutionTime time.Duration
+	earnings           decimal.Decimal
+	reclaimedBytes     uint64 // Freed by removing job workspaces
+}
+
+// ResourceManager manages resource allocation and limits. Jobs reserve CPU cores,
+// memory and GPU VRAM before they run, so that concurrent jobs never collectively
+// exceed what the host has.
+type ResourceManager struct {
+	maxConcurrentJobs int
+	maxCPUUsage       float64
+	maxMemoryUsage    float64
 	maxGPUUsage       float64
 	currentJobs       int
 	mu                sync.RWMutex
+
+	gpus          []common.GPUDetail // Shares the provider's slice, so health updates are seen
+	totalCPUCores int
+	totalMemoryMB uint64
+	reservedCPU   int
+	reservedMemMB uint64
+	reservedVRAM  []uint64      // Per GPU index
+	throttled     []bool        // Per GPU index; throttled GPUs take no new jobs
+	released      chan struct{} // Closed and replaced whenever capacity is released
+}
+
+// ResourceReservation is the capacity held by one job until it is released
+type ResourceReservation struct {
+	GPUs     []GPUAllocation // Empty if the job needs no GPU
+	CPUCores int
+	MemoryMB uint64
+}
+
+// GPUAllocation is the VRAM a reservation holds on one GPU
+type GPUAllocation struct {
+	Index  int
+	VRAMMB uint64
+}
+
+// gpuIndices returns the indices of the reserved GPUs
+func (r *ResourceReservation) gpuIndices() []int {
+	indices := make([]int, len(r.GPUs))
+	for i, gpu := range r.GPUs {
+		indices[i] = gpu.Index
+	}
+	return indices
+}
+
+// totalVRAMMB returns the VRAM reserved across all of the job's GPUs
+func (r *ResourceReservation) totalVRAMMB() uint64 {
+	var total uint64
+	for _, gpu := range r.GPUs {
+		total += gpu.VRAMMB
+	}
+	return total
+}
+
+// insufficientCapacityError rejects a job that can never fit on this provider,
+// even when no other job is running
+type insufficientCapacityError struct {
+	resource  string
+	required  uint64
+	available uint64
+}
+
+func (e *insufficientCapacityError) Error() string {
+	return fmt.Sprintf("insufficient capacity: job needs %d %s, provider has %d", e.required, e.resource, e.available)
+}
+
+// newResourceManager sizes a resource manager from the host's CPU cores, memory and GPUs
+func newResourceManager(maxConcurrentJobs int, gpus []common.GPUDetail) *ResourceManager {
+	rm := &ResourceManager{
+		maxConcurrentJobs: maxConcurrentJobs,
+		maxCPUUsage:       80.0,
+		maxMemoryUsage:    85.0,
+		maxGPUUsage:       90.0,
+		gpus:              gpus,
+		totalCPUCores:     runtime.NumCPU(),
+		reservedVRAM:      make([]uint64, len(gpus)),
+		throttled:         make([]bool, len(gpus)),
+		released:          make(chan struct{}),
+	}
+	if cores, err := cpu.Counts(true); err == nil && cores > 0 {
+		rm.totalCPUCores = cores
+	}
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		rm.totalMemoryMB = memInfo.Total / 1024 / 1024
+	}
+	return rm
+}
+
+// requiresGPU reports whether the requirements ask for any GPU
+func requiresGPU(requirements ResourceRequirements) bool {
+	return requirements.GPUCount > 0 || requirements.GPUMemoryMB > 0 || requirements.MinGPUMemoryMB > 0 || requirements.GPUModel != "" ||
+		requirements.GPUComputeUnits > 0 || (requirements.Architecture != "" && !isCPUArchitecture(requirements.Architecture))
+}
+
+// CheckFits returns an error if the requirements exceed the provider's total
+// capacity, in which case waiting for other jobs to finish won't help
+func (rm *ResourceManager) CheckFits(requirements ResourceRequirements, needsGPU bool) error {
+	if requirements.CPUCores > rm.totalCPUCores {
+		return &insufficientCapacityError{resource: "CPU cores", required: uint64(requirements.CPUCores), available: uint64(rm.totalCPUCores)}
+	}
+	if rm.totalMemoryMB > 0 && requirements.MemoryMB > rm.totalMemoryMB {
+		return &insufficientCapacityError{resource: "MB memory", required: requirements.MemoryMB, available: rm.totalMemoryMB}
+	}
+	if needsGPU {
+		if _, err := selectGPUs(rm.gpus, requirements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TryReserve atomically reserves a job slot, CPU cores, memory and, if the job needs
+// GPUs, VRAM on the best fitting ones. Jobs share a GPU as long as their VRAM fits; a
+// job that doesn't say how much VRAM it needs, or that needs several GPUs, gets its
+// GPUs to itself. It returns false without reserving anything if the job doesn't fit
+// alongside the jobs already running.
+func (rm *ResourceManager) TryReserve(requirements ResourceRequirements, needsGPU bool) (*ResourceReservation, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.maxConcurrentJobs > 0 && rm.currentJobs >= rm.maxConcurrentJobs {
+		return nil, false
+	}
+	if rm.reservedCPU+requirements.CPUCores > rm.totalCPUCores {
+		return nil, false
+	}
+	if rm.totalMemoryMB > 0 && rm.reservedMemMB+requirements.MemoryMB > rm.totalMemoryMB {
+		return nil, false
+	}
+
+	reservation := &ResourceReservation{
+		CPUCores: requirements.CPUCores,
+		MemoryMB: requirements.MemoryMB,
+	}
+
+	if needsGPU {
+		vram := requirements.GPUMemoryMB
+		if requirements.MinGPUMemoryMB > vram {
+			vram = requirements.MinGPUMemoryMB
+		}
+		wholeGPU := vram == 0 || requiredGPUCount(requirements) > 1
+
+		// Select against the VRAM each GPU has left
+		free := make([]common.GPUDetail, len(rm.gpus))
+		copy(free, rm.gpus)
+		for i := range free {
+			if i < len(rm.throttled) && rm.throttled[i] {
+				free[i].IsAvailable = false
+			}
+			if i >= len(rm.reservedVRAM) || rm.reservedVRAM[i] == 0 {
+				continue
+			}
+			free[i].VRAM -= rm.reservedVRAM[i]
+			if wholeGPU || free[i].MIGProfile != "" {
+				free[i].IsAvailable = false // A MIG instance is dedicated to a single job
+			}
+		}
+		gpuIndices, err := selectGPUs(free, requirements)
+		if err != nil {
+			return nil, false
+		}
+
+		for _, gpuIndex := range gpuIndices {
+			reserved := vram
+			if wholeGPU || rm.gpus[gpuIndex].MIGProfile != "" {
+				reserved = rm.gpus[gpuIndex].VRAM
+			}
+			reservation.GPUs = append(reservation.GPUs, GPUAllocation{Index: gpuIndex, VRAMMB: reserved})
+			rm.reservedVRAM[gpuIndex] += reserved
+		}
+	}
+
+	rm.currentJobs++
+	rm.reservedCPU += reservation.CPUCores
+	rm.reservedMemMB += reservation.MemoryMB
+	return reservation, true
+}
+
+// Release returns a reservation's capacity and wakes jobs waiting for it
+func (rm *ResourceManager) Release(reservation *ResourceReservation) {
+	if reservation == nil {
+		return
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.currentJobs--
+	rm.reservedCPU -= reservation.CPUCores
+	rm.reservedMemMB -= reservation.MemoryMB
+	for _, gpu := range reservation.GPUs {
+		rm.reservedVRAM[gpu.Index] -= gpu.VRAMMB
+	}
+
+	rm.notifyReleasedLocked()
+}
+
+// SetThrottled stops or resumes placing new jobs on a GPU. Jobs already running on
+// it are left alone. Resuming a GPU wakes jobs waiting for capacity.
+func (rm *ResourceManager) SetThrottled(gpuIndex int, throttled bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if gpuIndex < 0 || gpuIndex >= len(rm.throttled) || rm.throttled[gpuIndex] == throttled {
+		return
+	}
+	rm.throttled[gpuIndex] = throttled
+	if !throttled {
+		rm.notifyReleasedLocked()
+	}
+}
+
+// IsThrottled reports whether a GPU is refusing new jobs for running hot
+func (rm *ResourceManager) IsThrottled(gpuIndex int) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return gpuIndex >= 0 && gpuIndex < len(rm.throttled) && rm.throttled[gpuIndex]
+}
+
+// notifyReleasedLocked wakes jobs waiting for capacity. Caller must hold rm.mu.
+func (rm *ResourceManager) notifyReleasedLocked() {
+	close(rm.released)
+	rm.released = make(chan struct{})
+}
+
+// Released returns a channel that is closed the next time capacity is released
+func (rm *ResourceManager) Released() <-chan struct{} {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.released
 }
 
 // TaskWorker represents a worker that executes tasks
@@ -541,21 +1600,68 @@ func (js JobStatus) String() string {
 // getDefaultProviderConfig returns comprehensive default configuration
 func getDefaultProviderConfig() *common.ProviderConfig {
 	return &common.ProviderConfig{
-		ProviderName:        "Advanced GPU Provider",
-		OwnerID:             os.Getenv("PROVIDER_OWNER_ID"),
-		Location:            getLocationFromEnvironment(),
-		APIGatewayURL:       getenvDefault("API_GATEWAY_URL", "http://localhost:8080"),
-		ProviderRegistryURL: getenvDefault("PROVIDER_REGISTRY_URL", "http://localhost:8001"),
-		BillingServiceURL:   getenvDefault("BILLING_SERVICE_URL", "http://localhost:8003"),
-		NATSAddress:         getenvDefault("NATS_ADDRESS", "nats://localhost:4222"),
-		SolanaWalletAddress: os.Getenv("SOLANA_WALLET_ADDRESS"),
-		MaxConcurrentJobs:   getenvIntDefault("MAX_CONCURRENT_JOBS", 4),
-		MinPricePerHour:     getenvDecimalDefault("MIN_PRICE_PER_HOUR", "1.0"),
-		EnableDocker:        getenvBoolDefault("ENABLE_DOCKER", true),
-		RequestTimeout:      30 * time.Second,
-		HeartbeatInterval:   15 * time.Second,
-		MetricsInterval:     5 * time.Second,
-		WorkspaceDir:        getenvDefault("WORKSPACE_DIR", "/tmp/dante-workspace"),
+		ProviderName:         "Advanced GPU Provider",
+		OwnerID:              os.Getenv("PROVIDER_OWNER_ID"),
+		Location:             getLocationFromEnvironment(),
+		APIGatewayURL:        getenvDefault("API_GATEWAY_URL", "http://localhost:8080"),
+		ProviderRegistryURL:  getenvDefault("PROVIDER_REGISTRY_URL", "http://localhost:8001"),
+		BillingServiceURL:    getenvDefault("BILLING_SERVICE_URL", "http://localhost:8003"),
+		StorageServiceURL:    os.Getenv("STORAGE_SERVICE_URL"),
+		NATSAddress:          getenvDefault("NATS_ADDRESS", "nats://localhost:4222"),
+		UsageUpdatesViaNATS:  getenvBoolDefault("USAGE_UPDATES_VIA_NATS", false),
+		SolanaWalletAddress:  os.Getenv("SOLANA_WALLET_ADDRESS"),
+		MaxConcurrentJobs:    getenvIntDefault("MAX_CONCURRENT_JOBS", 4),
+		MinPricePerHour:      getenvDecimalDefault("MIN_PRICE_PER_HOUR", "1.0"),
+		EnableDocker:         getenvBoolDefault("ENABLE_DOCKER", true),
+		RequestTimeout:       30 * time.Second,
+		HeartbeatInterval:    15 * time.Second,
+		MetricsInterval:      getenvDurationDefault("METRICS_INTERVAL", 5*time.Second),
+		CPUSampleWindow:      getenvDurationDefault("CPU_SAMPLE_WINDOW", time.Second),
+		WorkspaceDir:         getenvDefault("WORKSPACE_DIR", "/tmp/dante-workspace"),
+		WorkspaceOrphanTTL:   getenvDurationDefault("WORKSPACE_ORPHAN_TTL", 24*time.Hour),
+		MaxDownloadRetries:   getenvIntDefault("MAX_DOWNLOAD_RETRIES", 3),
+		DownloadRetryBackoff: 2 * time.Second,
+		MaxParallelDownloads: getenvIntDefault("MAX_PARALLEL_DOWNLOADS", 4),
+		MaxUploadRetries:     getenvIntDefault("MAX_UPLOAD_RETRIES", 3),
+		UploadRetryBackoff:   2 * time.Second,
+		CancelGracePeriod:    10 * time.Second,
+		DrainTimeout:         getenvDurationDefault("DRAIN_TIMEOUT", 15*time.Minute),
+		AllowInteractiveExec: getenvBoolDefault("ALLOW_INTERACTIVE_EXEC", false),
+		ExecSessionTimeout:   getenvDurationDefault("EXEC_SESSION_TIMEOUT", 30*time.Minute),
+		WASMRuntimePath:      os.Getenv("WASM_RUNTIME_PATH"),
+		BenchmarkResultsPath: os.Getenv("BENCHMARK_RESULTS_PATH"),
+		StatusAPIPort:        getenvIntDefault("STATUS_API_PORT", 8791),
+		TLS: common.TLSSettings{
+			CAFile:             os.Getenv("TLS_CA_FILE"),
+			CertFile:           os.Getenv("TLS_CERT_FILE"),
+			KeyFile:            os.Getenv("TLS_KEY_FILE"),
+			InsecureSkipVerify: getenvBoolDefault("TLS_INSECURE_SKIP_VERIFY", false),
+		},
+		Secrets: common.SecretSettings{
+			EnvFile:       os.Getenv("SECRETS_ENV_FILE"),
+			VaultAddress:  os.Getenv("VAULT_ADDR"),
+			VaultToken:    os.Getenv("VAULT_TOKEN"),
+			VaultMount:    getenvDefault("VAULT_KV_MOUNT", "secret"),
+			StorageBucket: getenvDefault("SECRETS_BUCKET", "secrets"),
+		},
+		ImagePolicy: common.ImagePolicy{
+			AllowedImages:        getenvList("ALLOWED_IMAGES"),
+			DeniedImages:         getenvList("DENIED_IMAGES"),
+			RequireDigestPinning: getenvBoolDefault("REQUIRE_IMAGE_DIGEST", false),
+		},
+		Alerts: common.AlertSettings{
+			WebhookURL:   os.Getenv("ALERT_WEBHOOK_URL"),
+			MinSeverity:  getenvDefault("ALERT_MIN_SEVERITY", alertSeverityWarning),
+			Cooldown:     15 * time.Minute,
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     getenvIntDefault("SMTP_PORT", 587),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			EmailFrom:    os.Getenv("ALERT_EMAIL_FROM"),
+			EmailTo:      getenvList("ALERT_EMAIL_TO"),
+		},
+		GPUThrottleCelsius: uint8(getenvIntDefault("GPU_OVERTEMP_CELSIUS", 85)),
+		GPUResumeCelsius:   uint8(getenvIntDefault("GPU_RESUME_CELSIUS", 0)),
 	}
 }
 
@@ -595,6 +1701,26 @@ func getenvBoolDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getenvDurationDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durVal, err := time.ParseDuration(value); err == nil {
+			return durVal
+		}
+	}
+	return defaultValue
+}
+
+// getenvList splits a comma separated environment variable, skipping empty entries
+func getenvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getLocationFromEnvironment() string {
 	if location := os.Getenv("PROVIDER_LOCATION"); location != "" {
 		return location
@@ -651,6 +1777,12 @@ func estimatePowerConsumption(gpuName string) uint32 {
 		return 300
 	} else if strings.Contains(gpuName, "6800 xt") {
 		return 250
+	} else if strings.Contains(gpuName, "mi300") {
+		return 750
+	} else if strings.Contains(gpuName, "mi250") {
+		return 500
+	} else if strings.Contains(gpuName, "mi210") || strings.Contains(gpuName, "mi100") {
+		return 300
 	}
 
 	// Apple Silicon (very efficient)
@@ -681,6 +1813,12 @@ func NewGPUProvider(config *common.ProviderConfig) (*GPUProvider, error) {
 		return nil, fmt.Errorf("GPU detection failed: %w", err)
 	}
 
+	if config.BenchmarkResultsPath != "" {
+		if err := attachBenchmarks(config.BenchmarkResultsPath, gpus); err != nil {
+			logger.Warn("Failed to load GPU benchmark results", zap.String("path", config.BenchmarkResultsPath), zap.Error(err))
+		}
+	}
+
 	logger.Info("Detected GPUs", zap.Int("count", len(gpus)))
 	for i, gpu := range gpus {
 		logger.Info("GPU details",
@@ -693,14 +1831,15 @@ func NewGPUProvider(config *common.ProviderConfig) (*GPUProvider, error) {
 	}
 
 	// Create HTTP client with timeouts
+	transport, err := common.NewTLSTransport(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+	transport.MaxIdleConns = 10
+	transport.IdleConnTimeout = 30 * time.Second
 	httpClient := &http.Client{
-		Timeout: config.RequestTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig:    &tls.Config{InsecureSkipVerify: false},
-			MaxIdleConns:       10,
-			IdleConnTimeout:    30 * time.Second,
-			DisableCompression: false,
-		},
+		Timeout:   config.RequestTimeout,
+		Transport: transport,
 	}
 
 	// Create context for provider lifecycle
@@ -730,6 +1869,11 @@ func NewGPUProvider(config *common.ProviderConfig) (*GPUProvider, error) {
 	walletManager, err := initializeSolanaWallet(config, logger)
 	if err != nil {
 		logger.Warn("Failed to initialize Solana wallet, continuing without it", zap.Error(err))
+	} else if walletManager.publicKey.String() != config.SolanaWalletAddress {
+		// The registry checks heartbeat signatures against the registered wallet address
+		logger.Warn("Solana private key doesn't belong to the configured wallet address, the registry will reject heartbeats",
+			zap.String("wallet_address", config.SolanaWalletAddress),
+			zap.String("key_public_key", walletManager.publicKey.String()))
 	}
 
 	// Initialize execution environment
@@ -741,18 +1885,10 @@ func NewGPUProvider(config *common.ProviderConfig) (*GPUProvider, error) {
 	}
 
 	// Create resource manager
-	resourceManager := &ResourceManager{
-		maxConcurrentJobs: config.MaxConcurrentJobs,
-		maxCPUUsage:       80.0,
-		maxMemoryUsage:    85.0,
-		maxGPUUsage:       90.0,
-	}
+	resourceManager := newResourceManager(config.MaxConcurrentJobs, gpus)
 
 	// Create alert manager
-	alertManager := &AlertManager{
-		logger: logger,
-		alerts: make([]Alert, 0),
-	}
+	alertManager := newAlertManager(config.Alerts, logger)
 
 	// Create health checker
 	healthChecker := &HealthChecker{
@@ -773,16 +1909,17 @@ func NewGPUProvider(config *common.ProviderConfig) (*GPUProvider, error) {
 		walletManager:      walletManager,
 		executionEnv:       executionEnv,
 		systemMetrics:      &SystemMetrics{},
+		cpuSampler:         newCPUSampler(config.CPUSampleWindow),
+		cpuPower:           newCPUPowerSampler(config.CPUSampleWindow),
 		alertManager:       alertManager,
 		healthChecker:      healthChecker,
-		performanceHistory: make([]PerformanceSnapshot, 0, 1000),
+		performanceHistory: make([]PerformanceSnapshot, 0, maxPerformanceHistory),
+		thermalThrottled:   make(map[string]bool),
 		resourceManager:    resourceManager,
-		jobQueue:           make(chan *Task, 100),
+		jobQueue:           newTaskQueue(jobQueueCapacity),
+		drainRequested:     make(chan struct{}),
 	}
 
-	// Initialize worker pool
-	provider.initializeWorkerPool()
-
 	return provider, nil
 }
 
@@ -924,11 +2061,38 @@ func initializeExecutionEnvironment(config *common.ProviderConfig, logger *zap.L
 		workspaceDir:  workspaceDir,
 		logger:        logger,
 		resourceLimit: resourceLimit,
+		diskUsage:     disk.Usage,
 	}
 
 	return execEnv, nil
 }
 
+// errProviderDraining is returned for tasks submitted after shutdown has started.
+var errProviderDraining = errors.New("provider is draining for shutdown")
+
+// EnqueueTask queues a task for execution by the worker pool. Higher priority tasks
+// are picked up first. It blocks while the queue is full until ctx is done.
+func (p *GPUProvider) EnqueueTask(ctx context.Context, task *Task) error {
+	if task.ExecutionType == ExecutionTypeWASM && p.config.WASMRuntimePath == "" {
+		return fmt.Errorf("cannot accept task %s: %w", task.JobID, errWASMRuntimeNotConfigured)
+	}
+	if p.draining() {
+		return fmt.Errorf("cannot accept task %s: %w", task.JobID, errProviderDraining)
+	}
+	if task.SubmittedAt.IsZero() {
+		task.SubmittedAt = time.Now()
+	}
+	if err := p.jobQueue.Push(ctx, task); err != nil {
+		return fmt.Errorf("failed to enqueue task %s: %w", task.JobID, err)
+	}
+
+	p.logger.Info("Task queued",
+		zap.String("job_id", task.JobID),
+		zap.Int("priority", task.Priority),
+		zap.Int("queue_length", p.jobQueue.Len()))
+	return nil
+}
+
 // initializeWorkerPool creates worker goroutines for task execution
 func (p *GPUProvider) initializeWorkerPool() {
 	workerCount := p.config.MaxConcurrentJobs
@@ -946,7 +2110,7 @@ func (p *GPUProvider) initializeWorkerPool() {
 		p.workerPool[i] = worker
 
 		// Start worker goroutine
-		p.wg.Add(1)
+		p.workers.Add(1)
 		go worker.run()
 	}
 
@@ -955,20 +2119,18 @@ func (p *GPUProvider) initializeWorkerPool() {
 
 // run is the main worker loop
 func (w *TaskWorker) run() {
-	defer w.provider.wg.Done()
+	defer w.provider.workers.Done()
 	w.logger.Info("Worker started")
 
 	for {
-		select {
-		case <-w.ctx.Done():
+		// Pop returns the highest priority task and fails once the worker is
+		// cancelled or the queue is closed and drained
+		task, err := w.provider.jobQueue.Pop(w.ctx)
+		if err != nil {
 			w.logger.Info("Worker stopping")
 			return
-		case task, ok := <-w.provider.jobQueue:
-			if !ok {
-				return
-			}
-			w.executeTask(task)
 		}
+		w.executeTask(task)
 	}
 }
 
@@ -987,15 +2149,27 @@ func (w *TaskWorker) executeTask(task *Task) {
 		LastHeartbeat:   time.Now(),
 		Status:          JobStatusStarting,
 		Progress:        0.0,
+		AssignedGPUIdx:  -1,
 		OutputCollector: &OutputCollector{MaxSizeMB: 100},
 		ErrorCollector:  &ErrorCollector{Errors: make([]JobError, 0)},
 	}
 
-	ctx, cancel := context.WithTimeout(w.ctx, time.Duration(task.MaxDurationMinutes)*time.Minute)
+	ctx, cancel := context.WithTimeout(w.ctx, time.Duration(task.MaxDurationMinutes)*maxDurationUnit)
 	activeJob.Context = ctx
 	activeJob.Cancel = cancel
 	defer cancel()
 
+	// The job runs with its secret references resolved; the task as received keeps
+	// the references, so the values aren't reported anywhere the task is
+	resolvedTask, secrets, err := w.resolveTaskSecrets(ctx, task)
+	if err != nil {
+		w.handleTaskError(activeJob, "secret_resolution", err)
+		return
+	}
+	activeJob.Task = resolvedTask
+	activeJob.Secrets = secrets
+	activeJob.OutputCollector.redactSecrets(secrets)
+
 	// Track active job
 	w.provider.jobMutex.Lock()
 	w.provider.activeJobs[task.JobID] = activeJob
@@ -1007,6 +2181,28 @@ func (w *TaskWorker) executeTask(task *Task) {
 		w.provider.jobMutex.Unlock()
 	}()
 
+	// Make sure the job fits on disk before any money or bandwidth is spent on it
+	if err := w.provider.executionEnv.checkDiskSpace(task.Requirements.DiskSpaceMB); err != nil {
+		w.handleTaskError(activeJob, "preflight", err)
+		return
+	}
+
+	// Hold CPU, memory and VRAM for the job so concurrent jobs can't oversubscribe them
+	reservation, err := w.reserveCapacity(activeJob)
+	if err != nil {
+		if activeJob.CancelRequested.Load() {
+			w.handleTaskCanceled(activeJob)
+			return
+		}
+		if timedOut(activeJob) {
+			w.handleTaskTimeout(activeJob, "preflight")
+			return
+		}
+		w.handleTaskError(activeJob, "preflight", err)
+		return
+	}
+	defer w.provider.resourceManager.Release(reservation)
+
 	// Create workspace for this job
 	jobWorkspace := filepath.Join(w.provider.executionEnv.workspaceDir, task.JobID)
 	if err := os.MkdirAll(jobWorkspace, 0755); err != nil {
@@ -1015,41 +2211,58 @@ func (w *TaskWorker) executeTask(task *Task) {
 	}
 	activeJob.WorkspaceDir = jobWorkspace
 
+	// Keep the complete job output on disk, outside the workspace the job can write
+	// to; the in-memory buffers are bounded
+	if logFile, err := w.provider.executionEnv.createJobLog(task.JobID); err == nil {
+		activeJob.OutputCollector.LogFile = logFile
+		defer logFile.Close()
+	} else {
+		w.logger.Warn("Failed to create job output log file", zap.Error(err))
+	}
+
 	// Start billing session
 	if err := w.startBillingSession(activeJob); err != nil {
 		w.handleTaskError(activeJob, "billing_start", err)
 		return
 	}
 
-	// Download input files
-	if err := w.downloadInputFiles(activeJob); err != nil {
-		w.handleTaskError(activeJob, "input_download", err)
-		return
-	}
-
-	// Update status to running
-	activeJob.Status = JobStatusRunning
-	w.publishTaskStatus(activeJob, "Task execution started", "")
-
 	// Start metrics collection
 	go w.collectMetrics(activeJob)
 
-	// Execute based on execution type
-	var err error
+	// Download inputs and execute, retrying recoverable failures
+	for attempt := 0; ; attempt++ {
+		stage, err := w.runTaskAttempt(activeJob)
 
-	switch task.ExecutionType {
-	case ExecutionTypeDocker:
-		_, err = w.executeDockerTask(activeJob)
-	case ExecutionTypeScript:
-		_, err = w.executeScriptTask(activeJob)
-	default:
-		err = fmt.Errorf("unsupported execution type: %s", task.ExecutionType)
-	}
+		// A cancel request stops the container or script, which surfaces as an
+		// error or non-zero exit; report it as a cancellation instead
+		if activeJob.CancelRequested.Load() {
+			w.handleTaskCanceled(activeJob)
+			return
+		}
 
-	// Handle execution result
-	if err != nil {
-		w.handleTaskError(activeJob, "execution", err)
-		return
+		if err == nil {
+			break
+		}
+
+		// Likewise, hitting the maximum duration kills the workload
+		if timedOut(activeJob) {
+			w.handleTaskTimeout(activeJob, stage)
+			return
+		}
+
+		if !isRecoverableError(err) || attempt >= task.RetryCount || ctx.Err() != nil {
+			w.handleTaskError(activeJob, stage, err)
+			return
+		}
+
+		if !w.prepareRetry(activeJob, stage, err, attempt) {
+			if timedOut(activeJob) {
+				w.handleTaskTimeout(activeJob, stage)
+				return
+			}
+			w.handleTaskError(activeJob, stage, err)
+			return
+		}
 	}
 
 	// Upload output files
@@ -1058,6 +2271,8 @@ func (w *TaskWorker) executeTask(task *Task) {
 		// Don't fail the task for output upload errors
 	}
 
+	w.uploadJobLog(activeJob)
+
 	// Finalize task
 	activeJob.Status = JobStatusCompleted
 	activeJob.Progress = 1.0
@@ -1070,14 +2285,70 @@ func (w *TaskWorker) executeTask(task *Task) {
 
 	// Cleanup workspace if requested
 	if task.WorkspaceCleanup {
-		if err := os.RemoveAll(jobWorkspace); err != nil {
+		reclaimed, err := removeWorkspace(jobWorkspace)
+		w.provider.recordWorkspaceReclaimed(reclaimed)
+		if err != nil {
 			w.logger.Warn("Failed to cleanup workspace", zap.Error(err))
 		}
+		if err := os.Remove(w.provider.executionEnv.jobLogPath(task.JobID)); err != nil && !os.IsNotExist(err) {
+			w.logger.Warn("Failed to remove job output log", zap.Error(err))
+		}
 	}
 
+	w.provider.recordJobCompleted(time.Since(activeJob.StartTime))
 	w.logger.Info("Task completed successfully", zap.String("job_id", task.JobID))
 }
 
+// reserveCapacity reserves resources for the job, waiting for running jobs to release
+// capacity if necessary. Time spent waiting counts towards the job's maximum duration.
+func (w *TaskWorker) reserveCapacity(activeJob *ActiveJob) (*ResourceReservation, error) {
+	rm := w.provider.resourceManager
+	task := activeJob.Task
+	requirements := task.Requirements
+
+	// Containers given GPU access are placed on a GPU even without GPU requirements,
+	// so they only see the device reserved for them
+	needsGPU := requiresGPU(requirements) ||
+		(task.ExecutionType == ExecutionTypeDocker && task.DockerGPUAccess && w.hasAvailableGPU())
+
+	if err := rm.CheckFits(requirements, needsGPU); err != nil {
+		return nil, err
+	}
+
+	waiting := false
+	for {
+		// Take the channel before trying so a release in between isn't missed
+		released := rm.Released()
+		if reservation, ok := rm.TryReserve(requirements, needsGPU); ok {
+			activeJob.Reservation = reservation
+			if len(reservation.GPUs) > 0 {
+				w.assignGPUs(activeJob, reservation.gpuIndices())
+			}
+			return reservation, nil
+		}
+
+		if !waiting {
+			waiting = true
+			w.logger.Info("Waiting for capacity", zap.String("job_id", activeJob.Task.JobID))
+			w.publishTaskStatus(activeJob, "Waiting for resources to become available", "")
+		}
+
+		select {
+		case <-released:
+		case <-activeJob.Context.Done():
+			return nil, fmt.Errorf("waiting for capacity: %w", activeJob.Context.Err())
+		}
+	}
+}
+
+// assignGPUs records the GPUs a job was placed on; the first is its AssignedGPU
+func (w *TaskWorker) assignGPUs(activeJob *ActiveJob, gpuIndices []int) {
+	assignedGPU := w.provider.gpus[gpuIndices[0]]
+	activeJob.AssignedGPU = &assignedGPU
+	activeJob.AssignedGPUIdx = gpuIndices[0]
+	activeJob.AssignedGPUIndices = gpuIndices
+}
+
 // executeDockerTask executes a task using Docker
 func (w *TaskWorker) executeDockerTask(activeJob *ActiveJob) (*TaskResult, error) {
 	task := activeJob.Task
@@ -1086,41 +2357,45 @@ func (w *TaskWorker) executeDockerTask(activeJob *ActiveJob) (*TaskResult, error
 		return nil, fmt.Errorf("Docker not available")
 	}
 
+	// Refuse images outside the provider's policy before anything is downloaded
+	if err := checkImagePolicy(w.provider.settings().ImagePolicy, task.DockerImage); err != nil {
+		return nil, err
+	}
+
 	// Pull Docker image
 	w.publishTaskStatus(activeJob, "Pulling Docker image", "")
-	if err := w.pullDockerImage(task.DockerImage); err != nil {
-		return nil, fmt.Errorf("failed to pull Docker image: %w", err)
+	if err := w.pullDockerImage(task); err != nil {
+		return nil, retryable(fmt.Errorf("failed to pull Docker image: %w", err))
 	}
 
 	// Prepare container configuration
 	containerConfig := &container.Config{
 		Image:        task.DockerImage,
 		Cmd:          task.DockerCommand,
-		Env:          mapToSlice(task.DockerEnvironment),
+		Env:          mapToSlice(containerEnvironment(task.DockerEnvironment)),
 		WorkingDir:   "/workspace",
 		AttachStdout: true,
 		AttachStderr: true,
 	}
 
-	// Add GPU access if requested and available
+	// Apply the task's resource constraints
 	hostConfig := &container.HostConfig{
 		Binds: []string{
 			fmt.Sprintf("%s:/workspace", activeJob.WorkspaceDir),
 		},
-		Resources: container.Resources{
-			Memory:   int64(w.provider.executionEnv.resourceLimit.MemoryMB * 1024 * 1024),
-			NanoCPUs: int64(w.provider.executionEnv.resourceLimit.CPUCores) * 1000000000,
-		},
-		NetworkMode: "bridge",
+		Resources:   containerResources(task, w.provider.executionEnv.resourceLimit),
+		NetworkMode: containerNetworkMode(task),
 	}
 
+	// Add GPU access if requested and available
 	if task.DockerGPUAccess && w.hasAvailableGPU() {
-		hostConfig.DeviceRequests = []container.DeviceRequest{
-			{
-				Driver:       "nvidia",
-				Count:        -1, // All GPUs
-				Capabilities: [][]string{{"gpu"}},
-			},
+		containerConfig.Env = append(containerConfig.Env, gpuShareEnvironment(task)...)
+		containerConfig.Env = append(containerConfig.Env, gpuAllocationEnvironment(activeJob)...)
+		containerConfig.Env = append(containerConfig.Env, multiGPUEnvironment(activeJob)...)
+		hostConfig.DeviceRequests = []container.DeviceRequest{gpuDeviceRequest(activeJob, w.provider.gpus)}
+		if count := len(activeJob.AssignedGPUIndices); count > 1 {
+			// NCCL exchanges data between GPUs through /dev/shm, which Docker caps at 64MB
+			hostConfig.ShmSize = int64(count) * multiGPUShmPerGPU
 		}
 	}
 
@@ -1135,7 +2410,7 @@ func (w *TaskWorker) executeDockerTask(activeJob *ActiveJob) (*TaskResult, error
 	resp, err := w.provider.executionEnv.dockerClient.ContainerCreate(
 		ctx, containerConfig, hostConfig, &network.NetworkingConfig{}, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create container: %w", err)
+		return nil, retryable(fmt.Errorf("failed to create container: %w", err))
 	}
 
 	activeJob.ContainerID = resp.ID
@@ -1143,13 +2418,15 @@ func (w *TaskWorker) executeDockerTask(activeJob *ActiveJob) (*TaskResult, error
 
 	// Start container
 	if err := w.provider.executionEnv.dockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return nil, fmt.Errorf("failed to start container: %w", err)
+		return nil, retryable(fmt.Errorf("failed to start container: %w", err))
 	}
+	activeJob.ExecutionStarted.Store(true)
 
 	w.publishTaskStatus(activeJob, "Container started", "")
 
-	// Attach to container to collect logs
+	// Attach to container to collect logs and per-container resource usage
 	go w.collectContainerLogs(activeJob, resp.ID)
+	go w.streamContainerStats(activeJob, resp.ID)
 
 	// Wait for container to finish
 	statusCh, errCh := w.provider.executionEnv.dockerClient.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
@@ -1161,25 +2438,158 @@ func (w *TaskWorker) executeDockerTask(activeJob *ActiveJob) (*TaskResult, error
 		}
 	case status := <-statusCh:
 		// Container finished
+		stdout, stderr := activeJob.OutputCollector.Output()
 		result := &TaskResult{
 			Success:  status.StatusCode == 0,
 			ExitCode: int(status.StatusCode),
-			Output:   activeJob.OutputCollector.Stdout.String(),
+			Output:   stdout,
 		}
 
 		if status.StatusCode != 0 {
-			result.Error = activeJob.OutputCollector.Stderr.String()
+			result.Error = stderr
 		}
 
 		return result, nil
 	case <-ctx.Done():
 		// Timeout or cancellation
-		return nil, fmt.Errorf("task execution timeout or cancelled")
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("task exceeded max duration of %d minutes", task.MaxDurationMinutes)
+		}
+		return nil, fmt.Errorf("task execution cancelled")
 	}
 
 	return nil, fmt.Errorf("unexpected container execution end")
 }
 
+// cpuQuotaPeriod is the CFS period used for container CPU quotas (100ms)
+const cpuQuotaPeriod = 100000
+
+// containerResources translates a task's requirements and constraints into
+// Docker resource limits, never exceeding the provider's resource limits
+func containerResources(task *Task, limit ResourceLimit) container.Resources {
+	// Allocation is what the task requested, capped at the provider limit
+	memoryMB := limit.MemoryMB
+	if task.Requirements.MemoryMB > 0 && task.Requirements.MemoryMB < memoryMB {
+		memoryMB = task.Requirements.MemoryMB
+	}
+	cpuCores := limit.CPUCores
+	if task.Requirements.CPUCores > 0 && task.Requirements.CPUCores < cpuCores {
+		cpuCores = task.Requirements.CPUCores
+	}
+
+	if pct := task.Constraints.MaxMemoryUsagePercent; pct > 0 && pct < 100 {
+		memoryMB = uint64(float64(memoryMB) * pct / 100)
+	}
+
+	cpuPercent := 100.0
+	if pct := task.Constraints.MaxCPUUsagePercent; pct > 0 && pct < 100 {
+		cpuPercent = pct
+	}
+
+	resources := container.Resources{
+		Memory:    int64(memoryMB * 1024 * 1024),
+		CPUPeriod: cpuQuotaPeriod,
+		CPUQuota:  int64(float64(cpuCores) * cpuQuotaPeriod * cpuPercent / 100),
+	}
+
+	if limit.MaxProcesses > 0 {
+		pidsLimit := int64(limit.MaxProcesses)
+		resources.PidsLimit = &pidsLimit
+	}
+
+	return resources
+}
+
+// containerNetworkMode isolates the container from the network unless the task allows access
+func containerNetworkMode(task *Task) container.NetworkMode {
+	if !task.Constraints.AllowNetworkAccess {
+		return "none"
+	}
+	return "bridge"
+}
+
+// gpuShareEnvironment limits the container's share of GPU compute through
+// CUDA MPS when MaxGPUUsagePercent is set. It only takes effect on hosts
+// running the MPS control daemon.
+func gpuShareEnvironment(task *Task) []string {
+	pct := task.Constraints.MaxGPUUsagePercent
+	if pct <= 0 || pct >= 100 {
+		return nil
+	}
+	return []string{fmt.Sprintf("CUDA_MPS_ACTIVE_THREAD_PERCENTAGE=%d", int(pct))}
+}
+
+// assignedDeviceIDs returns the NVIDIA devices the job was placed on, by UUID when
+// known or by index, or nil if it has none. Billing and execution both use the
+// assigned GPUs, so the job runs on the devices it pays for.
+func assignedDeviceIDs(activeJob *ActiveJob, gpus []common.GPUDetail) []string {
+	deviceIDs := make([]string, 0, len(activeJob.AssignedGPUIndices))
+	for _, gpuIndex := range activeJob.AssignedGPUIndices {
+		if gpuIndex < len(gpus) && gpus[gpuIndex].UUID != "" {
+			deviceIDs = append(deviceIDs, gpus[gpuIndex].UUID)
+		} else {
+			deviceIDs = append(deviceIDs, strconv.Itoa(gpuIndex))
+		}
+	}
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	return deviceIDs
+}
+
+// gpuDeviceRequest requests the job's GPUs or MIG instance for its container, the ones
+// it is billed for. A job that wasn't assigned a GPU gets every GPU, as before.
+func gpuDeviceRequest(activeJob *ActiveJob, gpus []common.GPUDetail) container.DeviceRequest {
+	request := container.DeviceRequest{
+		Driver:       "nvidia",
+		Capabilities: [][]string{{"gpu"}},
+	}
+	if deviceIDs := assignedDeviceIDs(activeJob, gpus); deviceIDs != nil {
+		request.DeviceIDs = deviceIDs
+	} else {
+		request.Count = -1 // All GPUs
+	}
+	return request
+}
+
+// multiGPUShmPerGPU is the /dev/shm size a container gets per GPU when it has several
+const multiGPUShmPerGPU = 1 << 30
+
+// multiGPUEnvironment tells a job spanning several GPUs how many it has, and keeps
+// NCCL's bootstrap on loopback since all of its ranks run on this host
+func multiGPUEnvironment(activeJob *ActiveJob) []string {
+	count := len(activeJob.AssignedGPUIndices)
+	if count < 2 {
+		return nil
+	}
+	return []string{fmt.Sprintf("DANTE_GPU_COUNT=%d", count), "NCCL_SOCKET_IFNAME=lo"}
+}
+
+// gpuAllocationEnvironment caps a job sharing a GPU at the VRAM reserved for it. The
+// limit is enforced by MPS when the daemon runs; otherwise frameworks that honour
+// these variables stay within it. Only the assigned device is exposed, so it is
+// always device 0 to the job.
+func gpuAllocationEnvironment(activeJob *ActiveJob) []string {
+	gpu := activeJob.AssignedGPU
+	if gpu == nil || activeJob.Reservation == nil || len(activeJob.Reservation.GPUs) != 1 || gpu.VRAM == 0 {
+		return nil
+	}
+	vramMB := activeJob.Reservation.GPUs[0].VRAMMB
+	if vramMB == 0 || vramMB >= gpu.VRAM {
+		return nil
+	}
+
+	// Round down so the fraction never grants more than was reserved
+	fraction := strconv.FormatFloat(math.Floor(float64(vramMB)/float64(gpu.VRAM)*1000)/1000, 'f', 3, 64)
+	return []string{
+		fmt.Sprintf("DANTE_GPU_MEMORY_MB=%d", vramMB),
+		"DANTE_GPU_MEMORY_FRACTION=" + fraction,
+		fmt.Sprintf("CUDA_MPS_PINNED_DEVICE_MEM_LIMIT=0=%dM", vramMB),
+		"XLA_PYTHON_CLIENT_MEM_FRACTION=" + fraction,
+		"TF_FORCE_GPU_ALLOW_GROWTH=true",
+	}
+}
+
 // executeScriptTask executes a script-based task
 func (w *TaskWorker) executeScriptTask(activeJob *ActiveJob) (*TaskResult, error) {
 	task := activeJob.Task
@@ -1232,30 +2642,53 @@ func (w *TaskWorker) executeScriptTask(activeJob *ActiveJob) (*TaskResult, error
 	}
 
 	// Prepare execution environment
-	cmd := exec.CommandContext(activeJob.Context, interpreter, scriptPath)
-	cmd.Dir = activeJob.WorkspaceDir
-
-	// Set environment variables
-	cmd.Env = os.Environ()
-	for key, value := range task.ScriptEnvironment {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	args := []string{interpreter, scriptPath}
+	switch isolation := strings.ToLower(task.Constraints.IsolationLevel); isolation {
+	case "", IsolationProcess:
+		// Plain child process with a curated environment
+	case IsolationGVisor, "runsc", IsolationContainer, IsolationVM:
+		// Container and VM level isolation for scripts is provided by the gVisor sandbox
+		if !isCommandAvailable("runsc") {
+			return nil, fmt.Errorf("isolation level %s requires gVisor (runsc), which is not installed", isolation)
+		}
+		args = gVisorCommand(task, args)
+	default:
+		return nil, fmt.Errorf("unsupported isolation level: %s", task.Constraints.IsolationLevel)
 	}
 
-	// Set up stdout/stderr capture
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd := exec.CommandContext(activeJob.Context, args[0], args[1:]...)
+	cmd.Dir = activeJob.WorkspaceDir
+
+	// Give the script a chance to exit cleanly before it is killed
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = w.provider.settings().CancelGracePeriod
+
+	// Never inherit the daemon environment, which holds provider secrets
+	cmd.Env = scriptEnvironment(task, activeJob.WorkspaceDir)
+	if deviceIDs := assignedDeviceIDs(activeJob, w.provider.gpus); deviceIDs != nil {
+		devices := strings.Join(deviceIDs, ",")
+		cmd.Env = append(cmd.Env, "CUDA_VISIBLE_DEVICES="+devices, "NVIDIA_VISIBLE_DEVICES="+devices)
+		cmd.Env = append(cmd.Env, gpuAllocationEnvironment(activeJob)...)
+		cmd.Env = append(cmd.Env, multiGPUEnvironment(activeJob)...)
+	}
+
+	// Set up bounded stdout/stderr capture
+	cmd.Stdout = activeJob.OutputCollector.StdoutWriter()
+	cmd.Stderr = activeJob.OutputCollector.StderrWriter()
 
 	w.publishTaskStatus(activeJob, "Starting script execution", "")
 
 	// Run the script
-	err := cmd.Run()
+	err := runTrackedCommand(activeJob, cmd)
 
 	// Prepare result
+	stdout, stderr := activeJob.OutputCollector.Output()
 	result := &TaskResult{
 		Success:  err == nil,
-		Output:   stdout.String(),
-		Error:    stderr.String(),
+		Output:   stdout,
+		Error:    stderr,
 		ExitCode: 0,
 	}
 
@@ -1267,998 +2700,4162 @@ func (w *TaskWorker) executeScriptTask(activeJob *ActiveJob) (*TaskResult, error
 		}
 	}
 
-	// Update output collectors
-	activeJob.OutputCollector.Stdout.WriteString(result.Output)
-	activeJob.OutputCollector.Stderr.WriteString(result.Error)
-
 	return result, nil
 }
 
-// handleTaskError handles task execution errors
-func (w *TaskWorker) handleTaskError(activeJob *ActiveJob, stage string, err error) {
-	w.logger.Error("Task execution error",
-		zap.String("job_id", activeJob.Task.JobID),
-		zap.String("stage", stage),
-		zap.Error(err))
-
-	// Add error to collector
-	jobError := JobError{
-		Timestamp:   time.Now(),
-		Stage:       stage,
-		ErrorType:   "execution_error",
-		Message:     err.Error(),
-		Recoverable: false,
-	}
+// wasmGuestWorkspace is where the job workspace is preopened inside the WASI sandbox
+const wasmGuestWorkspace = "/workspace"
 
-	activeJob.ErrorCollector.mu.Lock()
-	activeJob.ErrorCollector.Errors = append(activeJob.ErrorCollector.Errors, jobError)
-	activeJob.ErrorCollector.mu.Unlock()
+// errWASMRuntimeNotConfigured rejects WebAssembly tasks on providers without a WASI runtime
+var errWASMRuntimeNotConfigured = errors.New("WebAssembly execution is not supported: no WASM runtime configured")
 
-	// Update status
-	activeJob.Status = JobStatusFailed
-	w.publishTaskStatus(activeJob, fmt.Sprintf("Task failed at %s", stage), err.Error())
+// executeWASMTask runs a WebAssembly module under the configured WASI runtime.
+// The module only sees the job workspace, preopened at wasmGuestWorkspace, and
+// the task's ScriptEnvironment.
+func (w *TaskWorker) executeWASMTask(activeJob *ActiveJob) (*TaskResult, error) {
+	task := activeJob.Task
 
-	// End billing session if it was started
-	if activeJob.BillingSession != nil {
-		if endErr := w.endBillingSession(activeJob); endErr != nil {
-			w.logger.Error("Failed to end billing session after error", zap.Error(endErr))
-		}
+	runtimePath := w.provider.config.WASMRuntimePath
+	if runtimePath == "" {
+		return nil, errWASMRuntimeNotConfigured
+	}
+	if _, err := exec.LookPath(runtimePath); err != nil {
+		return nil, fmt.Errorf("WASM runtime %s not found: %w", runtimePath, err)
 	}
-}
 
-// publishTaskStatus publishes task status updates via NATS
-func (w *TaskWorker) publishTaskStatus(activeJob *ActiveJob, message, errorMsg string) {
-	if w.provider.natsConn == nil {
-		return
+	if task.WASMModule == "" {
+		return nil, fmt.Errorf("no WASM module provided")
+	}
+	modulePath := filepath.Join(activeJob.WorkspaceDir, filepath.Clean("/"+task.WASMModule))
+	if _, err := os.Stat(modulePath); err != nil {
+		return nil, fmt.Errorf("WASM module %s not found in workspace: %w", task.WASMModule, err)
 	}
 
-	update := TaskStatusUpdate{
-		JobID:           activeJob.Task.JobID,
-		ProviderID:      w.provider.provider.ID.String(),
-		SessionID:       activeJob.SessionID,
-		Status:          activeJob.Status,
-		Progress:        activeJob.Progress,
-		Stage:           activeJob.Status.String(),
-		Message:         message,
-		Error:           errorMsg,
-		Metrics:         activeJob.Metrics,
-		Timestamp:       time.Now(),
-		ResourceUsage:   activeJob.ResourceUsage,
-		GPUMetrics:      activeJob.GPUMetrics,
-		StartedAt:       &activeJob.StartTime,
-		DurationSeconds: time.Since(activeJob.StartTime).Seconds(),
+	args := wasmRuntimeArgs(runtimePath, modulePath, activeJob.WorkspaceDir, task)
+	cmd := exec.CommandContext(activeJob.Context, runtimePath, args...)
+	cmd.Dir = activeJob.WorkspaceDir
+
+	// Give the runtime a chance to exit cleanly before it is killed
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
 	}
+	cmd.WaitDelay = w.provider.settings().CancelGracePeriod
 
-	if activeJob.BillingSession != nil {
-		update.ActualCostDGPU = activeJob.BillingSession.CurrentCost
+	// The guest gets its variables through WASI; the runtime itself only needs a minimal environment
+	cmd.Env = []string{"PATH=" + scriptSafePath, "HOME=" + activeJob.WorkspaceDir}
+
+	cmd.Stdout = activeJob.OutputCollector.StdoutWriter()
+	cmd.Stderr = activeJob.OutputCollector.StderrWriter()
+
+	w.publishTaskStatus(activeJob, "Starting WASM execution", "")
+
+	err := runTrackedCommand(activeJob, cmd)
+
+	if errors.Is(activeJob.Context.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("WASM module exceeded max duration of %d minutes", task.MaxDurationMinutes)
 	}
 
-	if data, err := json.Marshal(update); err == nil {
-		subject := fmt.Sprintf("task.status.%s", activeJob.Task.JobID)
-		w.provider.natsConn.Publish(subject, data)
+	stdout, stderr := activeJob.OutputCollector.Output()
+	result := &TaskResult{
+		Success:  err == nil,
+		Output:   stdout,
+		Error:    stderr,
+		ExitCode: 0,
 	}
-}
 
-// startBillingSession starts a billing session for the task
-func (w *TaskWorker) startBillingSession(activeJob *ActiveJob) error {
-	if w.provider.config.BillingServiceURL == "" {
-		w.logger.Warn("Billing service URL not configured, skipping billing")
-		return nil
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitError.ExitCode()
+		} else {
+			return nil, fmt.Errorf("failed to run WASM module: %w", err)
+		}
 	}
 
-	task := activeJob.Task
+	return result, nil
+}
 
-	// Find appropriate GPU for the task
-	var selectedGPU *common.GPUDetail
-	for _, gpu := range w.provider.gpus {
-		if gpu.IsAvailable && gpu.IsHealthy {
-			if task.Requirements.GPUModel == "" ||
-				strings.Contains(strings.ToLower(gpu.ModelName), strings.ToLower(task.Requirements.GPUModel)) {
-				if gpu.VRAM >= task.Requirements.GPUMemoryMB {
-					selectedGPU = &gpu
-					break
-				}
-			}
+// wasmRuntimeArgs builds the runtime command line that preopens the workspace
+// and passes ScriptEnvironment as WASI environment variables. wazero and
+// wasmtime spell these flags differently.
+func wasmRuntimeArgs(runtimePath, modulePath, workspaceDir string, task *Task) []string {
+	keys := make([]string, 0, len(task.ScriptEnvironment))
+	for key := range task.ScriptEnvironment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	if strings.Contains(strings.ToLower(filepath.Base(runtimePath)), "wazero") {
+		args = []string{"run", "-mount=" + workspaceDir + ":" + wasmGuestWorkspace}
+		for _, key := range keys {
+			args = append(args, "-env="+key+"="+task.ScriptEnvironment[key])
+		}
+	} else {
+		args = []string{"run", "--dir=" + workspaceDir + "::" + wasmGuestWorkspace}
+		for _, key := range keys {
+			args = append(args, "--env", key+"="+task.ScriptEnvironment[key])
 		}
 	}
 
-	if selectedGPU == nil {
-		return fmt.Errorf("no suitable GPU available for task requirements")
-	}
+	args = append(args, modulePath)
+	return append(args, task.WASMArgs...)
+}
 
-	// Create billing session request
-	request := BillingSessionRequest{
-		UserID:          task.UserID,
-		ProviderID:      w.provider.provider.ID,
-		JobID:           &task.JobID,
-		SessionID:       &activeJob.SessionID,
-		GPUModel:        selectedGPU.ModelName,
-		RequestedVRAM:   task.Requirements.GPUMemoryMB,
-		EstimatedPowerW: selectedGPU.PowerConsumption,
-		MaxTotalCost:    &task.MaxCostDGPU,
-	}
+// Isolation levels for script execution
+const (
+	IsolationProcess   = "process"
+	IsolationContainer = "container"
+	IsolationVM        = "vm"
+	IsolationGVisor    = "gvisor"
+)
 
-	// Send request to billing service
-	reqData, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to marshal billing request: %w", err)
-	}
+// scriptSafePath is the PATH given to script tasks
+const scriptSafePath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
 
-	url := fmt.Sprintf("%s/api/v1/billing/sessions/start", w.provider.config.BillingServiceURL)
-	resp, err := w.provider.httpClient.Post(url, "application/json", bytes.NewBuffer(reqData))
-	if err != nil {
-		return fmt.Errorf("failed to start billing session: %w", err)
+// scriptEnvAllowlist lists host variables that are safe to pass to script tasks
+var scriptEnvAllowlist = []string{"LANG", "LC_ALL", "TZ"}
+
+// scriptEnvironment builds the environment for a script task from a curated
+// base plus the task's own ScriptEnvironment
+func scriptEnvironment(task *Task, workspaceDir string) []string {
+	env := []string{
+		"PATH=" + scriptSafePath,
+		"HOME=" + workspaceDir,
+		"TMPDIR=" + workspaceDir,
+		"DANTE_JOB_ID=" + task.JobID,
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("billing service returned status %d: %s", resp.StatusCode, string(body))
+	for _, key := range scriptEnvAllowlist {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
 	}
 
-	// Parse response
-	var billingResp BillingSessionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&billingResp); err != nil {
-		return fmt.Errorf("failed to decode billing response: %w", err)
+	for key, value := range task.ScriptEnvironment {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
 	}
 
-	activeJob.BillingSession = &billingResp
-	w.logger.Info("Billing session started",
-		zap.String("session_id", billingResp.Session.ID.String()),
-		zap.String("hourly_rate", billingResp.Session.HourlyRate.String()))
+	return env
+}
 
-	return nil
+// gVisorCommand wraps a command to run inside a rootless gVisor sandbox
+func gVisorCommand(task *Task, args []string) []string {
+	network := "none"
+	if task.Constraints.AllowNetworkAccess {
+		network = "host"
+	}
+
+	wrapped := []string{"runsc", "--rootless", "--network=" + network, "do"}
+	return append(wrapped, args...)
 }
 
-// endBillingSession ends the billing session
-func (w *TaskWorker) endBillingSession(activeJob *ActiveJob) error {
-	if activeJob.BillingSession == nil {
-		return nil
+// Retry backoff bounds for recoverable task failures
+const (
+	taskRetryBaseBackoff = 5 * time.Second
+	taskRetryMaxBackoff  = 2 * time.Minute
+)
+
+// runTaskAttempt downloads the inputs and executes the task once, returning
+// the stage that failed along with the error
+func (w *TaskWorker) runTaskAttempt(activeJob *ActiveJob) (string, error) {
+	task := activeJob.Task
+
+	// Download input files
+	if err := w.downloadInputFiles(activeJob); err != nil {
+		return "input_download", err
 	}
 
-	url := fmt.Sprintf("%s/api/v1/billing/sessions/%s/end",
-		w.provider.config.BillingServiceURL,
-		activeJob.BillingSession.Session.ID.String())
+	// Update status to running
+	activeJob.Status = JobStatusRunning
+	w.publishTaskStatus(activeJob, "Task execution started", "")
 
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create billing end request: %w", err)
+	// Execute based on execution type
+	var result *TaskResult
+	var err error
+
+	switch task.ExecutionType {
+	case ExecutionTypeDocker:
+		result, err = w.executeDockerTask(activeJob)
+	case ExecutionTypeScript:
+		result, err = w.executeScriptTask(activeJob)
+	case ExecutionTypeWASM:
+		result, err = w.executeWASMTask(activeJob)
+	default:
+		err = fmt.Errorf("unsupported execution type: %s", task.ExecutionType)
 	}
 
-	resp, err := w.provider.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to end billing session: %w", err)
+		return "execution", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		w.logger.Error("Failed to end billing session",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("response", string(body)))
+	// A non-zero exit is the job's own failure and is not retried
+	if result != nil && !result.Success {
+		return "execution", fmt.Errorf("task exited with code %d", result.ExitCode)
 	}
 
-	return nil
+	return "", nil
 }
 
-// downloadInputFiles downloads input files for the task
-func (w *TaskWorker) downloadInputFiles(activeJob *ActiveJob) error {
-	if len(activeJob.Task.InputFiles) == 0 {
-		return nil
+// prepareRetry records a recoverable failure, waits out the backoff and resets
+// the workspace for the next attempt. It returns false if the job was
+// canceled or timed out while waiting.
+func (w *TaskWorker) prepareRetry(activeJob *ActiveJob, stage string, err error, attempt int) bool {
+	task := activeJob.Task
+	err = activeJob.Secrets.RedactError(err)
+
+	activeJob.ErrorCollector.mu.Lock()
+	activeJob.ErrorCollector.Errors = append(activeJob.ErrorCollector.Errors, JobError{
+		Timestamp:   time.Now(),
+		Stage:       stage,
+		ErrorType:   "execution_error",
+		Message:     err.Error(),
+		Recoverable: true,
+	})
+	activeJob.ErrorCollector.mu.Unlock()
+
+	backoff := taskRetryBaseBackoff << attempt
+	if backoff > taskRetryMaxBackoff || backoff <= 0 {
+		backoff = taskRetryMaxBackoff
 	}
 
-	w.publishTaskStatus(activeJob, "Downloading input files", "")
+	w.logger.Warn("Recoverable task failure, retrying",
+		zap.String("job_id", task.JobID),
+		zap.String("stage", stage),
+		zap.Int("attempt", attempt+1),
+		zap.Int("max_retries", task.RetryCount),
+		zap.Duration("backoff", backoff),
+		zap.Error(err))
 
-	for i, file := range activeJob.Task.InputFiles {
-		w.logger.Info("Downloading input file",
-			zap.Int("index", i),
-			zap.String("url", file.URL),
-			zap.String("path", file.Path))
+	activeJob.Status = JobStatusStarting
+	w.publishTaskStatus(activeJob,
+		fmt.Sprintf("Retrying after %s failure (attempt %d/%d)", stage, attempt+1, task.RetryCount),
+		err.Error())
 
-		if err := w.downloadFile(file, activeJob.WorkspaceDir); err != nil {
-			return fmt.Errorf("failed to download file %s: %w", file.URL, err)
-		}
+	select {
+	case <-activeJob.Context.Done():
+		return false
+	case <-time.After(backoff):
+	}
 
-		// Update progress
-		activeJob.Progress = float32(i+1) / float32(len(activeJob.Task.InputFiles)) * 0.2 // 20% of total progress
-		w.publishTaskStatus(activeJob, fmt.Sprintf("Downloaded %d/%d input files", i+1, len(activeJob.Task.InputFiles)), "")
+	if err := resetWorkspace(activeJob.WorkspaceDir); err != nil {
+		w.logger.Warn("Failed to reset workspace before retry", zap.Error(err))
 	}
+	activeJob.ContainerID = ""
+	activeJob.Progress = 0
 
-	return nil
+	return true
 }
 
-// downloadFile downloads a single file
-func (w *TaskWorker) downloadFile(file FileTransfer, workspaceDir string) error {
-	// Create HTTP request
-	req, err := http.NewRequest("GET", file.URL, nil)
+// resetWorkspace empties a job workspace
+func resetWorkspace(workspaceDir string) error {
+	entries, err := os.ReadDir(workspaceDir)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	// Add custom headers
-	for key, value := range file.Headers {
-		req.Header.Set(key, value)
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(workspaceDir, entry.Name())); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Perform request
-	resp, err := w.provider.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
-	}
-	defer resp.Body.Close()
+// Attempts and backoff for removing a workspace whose files are still held, e.g. by a
+// container that is being torn down
+const (
+	workspaceRemoveAttempts = 4
+	workspaceRemoveBackoff  = 500 * time.Millisecond
+)
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
-	}
+// removeWorkspace removes a job workspace and returns the bytes it freed. Removal is
+// retried with backoff, and a busy mount point inside the workspace is lazily
+// unmounted before the next attempt.
+func removeWorkspace(workspaceDir string) (uint64, error) {
+	size := directorySize(workspaceDir)
+
+	var err error
+	for attempt := 0; attempt < workspaceRemoveAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(workspaceRemoveBackoff * time.Duration(1<<(attempt-1)))
+		}
+		if err = os.RemoveAll(workspaceDir); err == nil {
+			return size, nil
+		}
 
-	// Create destination file
-	destPath := filepath.Join(workspaceDir, file.Path)
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		var pathErr *os.PathError
+		if errors.Is(err, syscall.EBUSY) && errors.As(err, &pathErr) {
+			if unmountErr := unmountDetached(pathErr.Path); unmountErr != nil {
+				err = fmt.Errorf("%w (unmount failed: %v)", err, unmountErr)
+			}
+		}
 	}
 
-	destFile, err := os.Create(destPath)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
+	// Count whatever was removed before giving up
+	remaining := directorySize(workspaceDir)
+	if remaining > size {
+		remaining = size
 	}
-	defer destFile.Close()
+	return size - remaining, fmt.Errorf("failed to remove workspace after %d attempts: %w", workspaceRemoveAttempts, err)
+}
 
-	// Copy data
-	_, err = io.Copy(destFile, resp.Body)
+// unmountDetached lazily unmounts a mount point that is still busy, e.g. a volume a
+// crashed job left mounted in its workspace
+func unmountDetached(mountPoint string) error {
+	output, err := exec.Command("umount", "-l", mountPoint).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
 	}
-
 	return nil
 }
 
-// uploadOutputFiles uploads output files
-func (w *TaskWorker) uploadOutputFiles(activeJob *ActiveJob) error {
-	if len(activeJob.Task.OutputFiles) == 0 {
+// directorySize returns the total size of the regular files under dir, skipping
+// anything that can't be read
+func directorySize(dir string) uint64 {
+	var size uint64
+	filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += uint64(info.Size())
+			}
+		}
 		return nil
+	})
+	return size
+}
+
+// sweepOrphanWorkspaces removes job workspaces and output logs that no running job
+// owns and that haven't been modified for WorkspaceOrphanTTL, e.g. those of jobs that
+// were running when the provider crashed. Files in the workspace root, such as disk
+// probes, are left.
+func (p *GPUProvider) sweepOrphanWorkspaces() {
+	ttl := p.config.WorkspaceOrphanTTL
+	if ttl <= 0 || p.executionEnv == nil {
+		return
 	}
+	workspaceDir := p.executionEnv.workspaceDir
 
-	w.publishTaskStatus(activeJob, "Uploading output files", "")
+	entries, err := os.ReadDir(workspaceDir)
+	if err != nil {
+		p.logger.Warn("Failed to list workspaces for cleanup", zap.Error(err))
+		return
+	}
 
-	for i, file := range activeJob.Task.OutputFiles {
-		sourcePath := filepath.Join(activeJob.WorkspaceDir, file.Path)
+	p.jobMutex.RLock()
+	active := make(map[string]bool, len(p.activeJobs))
+	for jobID := range p.activeJobs {
+		active[jobID] = true
+	}
+	p.jobMutex.RUnlock()
 
-		if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-			w.logger.Warn("Output file not found", zap.String("path", sourcePath))
+	cutoff := time.Now().Add(-ttl)
+	var removed int
+	var reclaimed uint64
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || active[entry.Name()] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
 			continue
 		}
 
-		if err := w.uploadFile(file, sourcePath); err != nil {
-			w.logger.Error("Failed to upload output file",
-				zap.String("path", file.Path),
-				zap.Error(err))
-			// Continue with other files
-		} else {
-			w.logger.Info("Uploaded output file",
-				zap.Int("index", i),
-				zap.String("path", file.Path))
+		dir := filepath.Join(workspaceDir, entry.Name())
+		freed, err := removeWorkspace(dir)
+		reclaimed += freed
+		if err != nil {
+			p.logger.Warn("Failed to remove orphaned workspace", zap.String("workspace", dir), zap.Error(err))
+			continue
 		}
+		removed++
 	}
 
-	return nil
+	logDir := filepath.Join(workspaceDir, jobLogDir)
+	logs, err := os.ReadDir(logDir)
+	if err != nil && !os.IsNotExist(err) {
+		p.logger.Warn("Failed to list job output logs for cleanup", zap.Error(err))
+	}
+	for _, entry := range logs {
+		if entry.IsDir() || active[strings.TrimSuffix(entry.Name(), ".log")] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(logDir, entry.Name())); err != nil {
+			p.logger.Warn("Failed to remove orphaned job output log", zap.String("log", entry.Name()), zap.Error(err))
+			continue
+		}
+		reclaimed += uint64(info.Size())
+	}
+
+	p.recordWorkspaceReclaimed(reclaimed)
+	if removed > 0 || reclaimed > 0 {
+		p.logger.Info("Removed orphaned workspaces",
+			zap.Int("workspaces", removed),
+			zap.Uint64("reclaimed_mb", reclaimed/(1024*1024)),
+			zap.Duration("ttl", ttl))
+	}
 }
 
-// uploadFile uploads a single file
-func (w *TaskWorker) uploadFile(file FileTransfer, sourcePath string) error {
-	// This is a simplified implementation
-	// In a real system, you'd upload to a storage service like S3, Google Cloud Storage, etc.
+// retryableError marks a failure as transient, e.g. a network blip or a registry timeout
+type retryableError struct {
+	err error
+}
 
-	sourceFile, err := os.Open(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
-	}
-	defer sourceFile.Close()
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
 
-	// Create upload request
-	req, err := http.NewRequest("PUT", file.URL, sourceFile)
-	if err != nil {
-		return fmt.Errorf("failed to create upload request: %w", err)
-	}
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
 
-	// Add headers
-	for key, value := range file.Headers {
-		req.Header.Set(key, value)
+// retryable wraps err so that isRecoverableError reports it as recoverable
+func retryable(err error) error {
+	if err == nil {
+		return nil
 	}
+	return &retryableError{err: err}
+}
 
-	// Perform upload
-	resp, err := w.provider.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to upload file: %w", err)
-	}
-	defer resp.Body.Close()
+// isRecoverableError reports whether retrying the task could succeed
+func isRecoverableError(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re)
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("upload failed with status %d", resp.StatusCode)
+// jobErrorType classifies an error for the JobError reported to the user
+func jobErrorType(err error) string {
+	var pe *imagePolicyError
+	var de *insufficientDiskError
+	var ce *insufficientCapacityError
+	var ge *NoSuitableGPUError
+	switch {
+	case errors.As(err, &pe):
+		return "image_policy_violation"
+	case errors.As(err, &de):
+		return "insufficient_disk_space"
+	case errors.As(err, &ce), errors.As(err, &ge):
+		return "insufficient_capacity"
+	case errors.Is(err, errWorkspaceReadOnly):
+		return "workspace_read_only"
+	default:
+		return "execution_error"
 	}
-
-	return nil
 }
 
-// collectMetrics collects system and GPU metrics during task execution
-func (w *TaskWorker) collectMetrics(activeJob *ActiveJob) {
-	ticker := time.NewTicker(w.provider.config.MetricsInterval)
-	defer ticker.Stop()
+// handleTaskCanceled finalizes a job that was canceled on request
+func (w *TaskWorker) handleTaskCanceled(activeJob *ActiveJob) {
+	w.logger.Info("Task canceled", zap.String("job_id", activeJob.Task.JobID))
 
-	for {
-		select {
-		case <-activeJob.Context.Done():
-			return
-		case <-ticker.C:
-			// Collect CPU metrics
-			if cpuPercent, err := cpu.Percent(time.Second, false); err == nil && len(cpuPercent) > 0 {
-				activeJob.ResourceUsage.CPUPercent = cpuPercent[0]
-			}
+	w.uploadJobLog(activeJob)
+	activeJob.Status = JobStatusCanceled
+	w.publishTaskStatus(activeJob, "Task canceled by request", "")
 
-			// Collect memory metrics
-			if memInfo, err := mem.VirtualMemory(); err == nil {
-				activeJob.ResourceUsage.MemoryMB = (memInfo.Total - memInfo.Available) / 1024 / 1024
-				activeJob.ResourceUsage.MemoryPercent = memInfo.UsedPercent
-			}
+	if activeJob.BillingSession != nil {
+		if err := w.endBillingSession(activeJob); err != nil {
+			w.logger.Error("Failed to end billing session after cancel", zap.Error(err))
+		}
+	}
+}
 
-			// Collect GPU metrics
-			if gpuMetrics, err := w.collectGPUMetrics(); err == nil {
-				activeJob.GPUMetrics = gpuMetrics
+// maxDurationUnit is the unit of a task's MaxDurationMinutes. Tests shorten it.
+var maxDurationUnit = time.Minute
+
+// timedOut reports whether the job ran past its maximum duration
+func timedOut(activeJob *ActiveJob) bool {
+	return errors.Is(activeJob.Context.Err(), context.DeadlineExceeded)
+}
+
+// handleTaskTimeout finalizes a job that ran past its maximum duration. The time it
+// actually ran is billed; a job that timed out before its workload started, e.g.
+// while waiting for capacity, is refunded.
+func (w *TaskWorker) handleTaskTimeout(activeJob *ActiveJob, stage string) {
+	message := fmt.Sprintf("Task exceeded max duration of %d minutes", activeJob.Task.MaxDurationMinutes)
+	w.logger.Warn("Task timed out",
+		zap.String("job_id", activeJob.Task.JobID),
+		zap.String("stage", stage),
+		zap.Int("max_duration_minutes", activeJob.Task.MaxDurationMinutes))
+
+	activeJob.ErrorCollector.mu.Lock()
+	activeJob.ErrorCollector.Errors = append(activeJob.ErrorCollector.Errors, JobError{
+		Timestamp: time.Now(),
+		Stage:     stage,
+		ErrorType: "timeout",
+		Message:   message,
+	})
+	activeJob.ErrorCollector.mu.Unlock()
+
+	w.uploadJobLog(activeJob)
+	activeJob.Status = JobStatusTimeout
+	w.publishTaskStatus(activeJob, fmt.Sprintf("Task timed out at %s", stage), message)
+
+	if activeJob.BillingSession != nil {
+		if !activeJob.ExecutionStarted.Load() {
+			if err := w.refundBillingSession(activeJob, "timeout: "+message); err != nil {
+				w.logger.Error("Failed to refund billing session after timeout", zap.Error(err))
 			}
+		} else if err := w.endBillingSession(activeJob); err != nil {
+			w.logger.Error("Failed to end billing session after timeout", zap.Error(err))
+		}
+	}
+}
 
-			// Update timestamp
-			activeJob.ResourceUsage.Timestamp = time.Now()
-			activeJob.LastHeartbeat = time.Now()
+// handleTaskError handles task execution errors
+func (w *TaskWorker) handleTaskError(activeJob *ActiveJob, stage string, err error) {
+	err = activeJob.Secrets.RedactError(err)
+	w.logger.Error("Task execution error",
+		zap.String("job_id", activeJob.Task.JobID),
+		zap.String("stage", stage),
+		zap.Error(err))
 
-			// Send usage update to billing service
-			if activeJob.BillingSession != nil {
-				w.sendUsageUpdate(activeJob)
+	// Add error to collector
+	jobError := JobError{
+		Timestamp:   time.Now(),
+		Stage:       stage,
+		ErrorType:   jobErrorType(err),
+		Message:     err.Error(),
+		Recoverable: isRecoverableError(err),
+	}
+
+	activeJob.ErrorCollector.mu.Lock()
+	activeJob.ErrorCollector.Errors = append(activeJob.ErrorCollector.Errors, jobError)
+	activeJob.ErrorCollector.mu.Unlock()
+
+	w.uploadJobLog(activeJob)
+
+	// Update status
+	activeJob.Status = JobStatusFailed
+	w.publishTaskStatus(activeJob, fmt.Sprintf("Task failed at %s", stage), err.Error())
+
+	// End billing session if it was started. Jobs that failed during setup, before
+	// their workload ran, are refunded instead of billed.
+	if activeJob.BillingSession != nil {
+		if !activeJob.ExecutionStarted.Load() {
+			if refundErr := w.refundBillingSession(activeJob, fmt.Sprintf("%s: %s", stage, err.Error())); refundErr != nil {
+				w.logger.Error("Failed to refund billing session after error", zap.Error(refundErr))
 			}
+		} else if endErr := w.endBillingSession(activeJob); endErr != nil {
+			w.logger.Error("Failed to end billing session after error", zap.Error(endErr))
 		}
 	}
 }
 
-// collectGPUMetrics collects current GPU metrics
-func (w *TaskWorker) collectGPUMetrics() ([]GPUMetrics, error) {
-	var metrics []GPUMetrics
+// publishTaskStatus publishes task status updates via NATS
+func (w *TaskWorker) publishTaskStatus(activeJob *ActiveJob, message, errorMsg string) {
+	if w.provider.natsConn == nil {
+		return
+	}
 
-	// Try NVIDIA first
-	if nvidiaMetrics, err := w.collectNVIDIAMetrics(); err == nil {
-		metrics = append(metrics, nvidiaMetrics...)
+	usage, metrics := activeJob.usageSnapshot()
+	update := TaskStatusUpdate{
+		JobID:           activeJob.Task.JobID,
+		ProviderID:      w.provider.provider.ID.String(),
+		SessionID:       activeJob.SessionID,
+		Status:          activeJob.Status,
+		Progress:        activeJob.Progress,
+		Stage:           activeJob.Status.String(),
+		Message:         activeJob.Secrets.Redact(message),
+		Error:           activeJob.Secrets.Redact(errorMsg),
+		Metrics:         metrics,
+		Timestamp:       time.Now(),
+		ResourceUsage:   usage,
+		GPUMetrics:      activeJob.GPUMetrics,
+		StartedAt:       &activeJob.StartTime,
+		DurationSeconds: time.Since(activeJob.StartTime).Seconds(),
 	}
 
-	// Add other GPU vendors as needed
-	// TODO: Implement AMD, Intel, Apple metrics collection
+	if len(activeJob.OutputFilesURL) > 0 {
+		update.OutputFilesURL = activeJob.OutputFilesURL
+	}
+	if len(activeJob.Artifacts) > 0 {
+		update.Result.Artifacts = activeJob.Artifacts
+	}
+	update.LogsURL = activeJob.LogsURL
 
-	return metrics, nil
+	if activeJob.BillingSession != nil {
+		update.ActualCostDGPU = activeJob.BillingSession.CurrentCost
+	}
+
+	if data, err := json.Marshal(update); err == nil {
+		subject := fmt.Sprintf("task.status.%s", activeJob.Task.JobID)
+		w.provider.publish(subject, data)
+	}
 }
 
-// collectNVIDIAMetrics collects NVIDIA GPU metrics
-func (w *TaskWorker) collectNVIDIAMetrics() ([]GPUMetrics, error) {
-	if !isCommandAvailable("nvidia-smi") {
-		return nil, fmt.Errorf("nvidia-smi not available")
+// NoSuitableGPUError is returned when no GPU satisfies a task's requirements
+type NoSuitableGPUError struct {
+	Requirements ResourceRequirements
+	Reason       string
+}
+
+func (e *NoSuitableGPUError) Error() string {
+	return fmt.Sprintf("no suitable GPU available for task requirements: %s", e.Reason)
+}
+
+// selectBestGPU returns the index of the GPU best suited to the requirements.
+// Candidates must be healthy, available and match the requested model, VRAM,
+// compute capability and architecture; among them the smallest sufficient
+// card wins so larger cards stay free for heavier jobs.
+func selectBestGPU(gpus []common.GPUDetail, requirements ResourceRequirements) (int, error) {
+	minVRAM := requirements.GPUMemoryMB
+	if requirements.MinGPUMemoryMB > minVRAM {
+		minVRAM = requirements.MinGPUMemoryMB
 	}
 
-	cmd := exec.Command("nvidia-smi",
-		"--query-gpu=index,uuid,name,utilization.gpu,utilization.memory,memory.total,memory.used,memory.free,temperature.gpu,power.draw,clocks.gr,clocks.mem,fan.speed",
-		"--format=csv,noheader,nounits")
+	best := -1
+	rejected := map[string]int{}
 
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("nvidia-smi execution failed: %w", err)
+	for i, gpu := range gpus {
+		switch {
+		case !gpu.IsAvailable || !gpu.IsHealthy:
+			rejected["unavailable"]++
+		case requirements.GPUModel != "" &&
+			!strings.Contains(strings.ToLower(gpu.ModelName), strings.ToLower(requirements.GPUModel)):
+			rejected["model"]++
+		case gpu.VRAM < minVRAM:
+			rejected["vram"]++
+		case requirements.GPUComputeUnits > 0 && parseComputeCapability(gpu.ComputeCapability) < requirements.GPUComputeUnits:
+			rejected["compute_capability"]++
+		case !matchesArchitecture(gpu, requirements.Architecture):
+			rejected["architecture"]++
+		default:
+			// Best fit: smallest VRAM that still satisfies the request
+			if best < 0 || gpu.VRAM < gpus[best].VRAM {
+				best = i
+			}
+		}
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var metrics []GPUMetrics
+	if best < 0 {
+		reasons := make([]string, 0, len(rejected))
+		for reason, count := range rejected {
+			reasons = append(reasons, fmt.Sprintf("%s=%d", reason, count))
+		}
+		sort.Strings(reasons)
 
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
+		reason := "no GPUs detected"
+		if len(reasons) > 0 {
+			reason = "rejected " + strings.Join(reasons, ", ")
 		}
+		if rejected["compute_capability"] > 0 {
+			reason += fmt.Sprintf("; requires compute capability %.1f or newer", requirements.GPUComputeUnits)
+		}
+		if rejected["architecture"] > 0 {
+			reason += fmt.Sprintf("; requires %s architecture", requirements.Architecture)
+		}
+		return -1, &NoSuitableGPUError{Requirements: requirements, Reason: reason}
+	}
 
-		parts := strings.Split(line, ",")
-		if len(parts) < 13 {
-			continue
+	return best, nil
+}
+
+// requiredGPUCount returns how many GPUs the requirements ask for, at least one
+func requiredGPUCount(requirements ResourceRequirements) int {
+	if requirements.GPUCount > 1 {
+		return requirements.GPUCount
+	}
+	return 1
+}
+
+// selectGPUs returns the indices of the GPUs best suited to the requirements, as many
+// as they ask for. A job spanning several GPUs only gets whole cards, since CUDA
+// exposes a single MIG instance to a process.
+func selectGPUs(gpus []common.GPUDetail, requirements ResourceRequirements) ([]int, error) {
+	count := requiredGPUCount(requirements)
+	candidates := make([]common.GPUDetail, len(gpus))
+	copy(candidates, gpus)
+	if count > 1 {
+		for i := range candidates {
+			if candidates[i].MIGProfile != "" {
+				candidates[i].IsAvailable = false
+			}
 		}
+	}
 
-		index, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
-		uuid := strings.TrimSpace(parts[1])
-		name := strings.TrimSpace(parts[2])
-		utilizationGPU, _ := strconv.ParseUint(strings.TrimSpace(parts[3]), 10, 8)
-		utilizationMemory, _ := strconv.ParseUint(strings.TrimSpace(parts[4]), 10, 8)
-		memoryTotal, _ := strconv.ParseUint(strings.TrimSpace(parts[5]), 10, 64)
-		memoryUsed, _ := strconv.ParseUint(strings.TrimSpace(parts[6]), 10, 64)
-		memoryFree, _ := strconv.ParseUint(strings.TrimSpace(parts[7]), 10, 64)
-		temperature, _ := strconv.ParseUint(strings.TrimSpace(parts[8]), 10, 8)
-		powerDraw, _ := strconv.ParseUint(strings.TrimSpace(parts[9]), 10, 32)
-		clockCore, _ := strconv.ParseUint(strings.TrimSpace(parts[10]), 10, 32)
-		clockMemory, _ := strconv.ParseUint(strings.TrimSpace(parts[11]), 10, 32)
-		fanSpeed, _ := strconv.ParseUint(strings.TrimSpace(parts[12]), 10, 8)
+	selected := make([]int, 0, count)
+	for len(selected) < count {
+		gpuIndex, err := selectBestGPU(candidates, requirements)
+		if err != nil {
+			if len(selected) == 0 {
+				return nil, err
+			}
+			return nil, &NoSuitableGPUError{
+				Requirements: requirements,
+				Reason:       fmt.Sprintf("job needs %d GPUs, only %d suitable", count, len(selected)),
+			}
+		}
+		selected = append(selected, gpuIndex)
+		candidates[gpuIndex].IsAvailable = false
+	}
+	return selected, nil
+}
 
-		metric := GPUMetrics{
-			Index:             index,
-			UUID:              uuid,
-			Name:              name,
-			UtilizationGPU:    uint8(utilizationGPU),
-			UtilizationMemory: uint8(utilizationMemory),
-			MemoryTotal:       memoryTotal,
-			MemoryUsed:        memoryUsed,
-			MemoryFree:        memoryFree,
-			Temperature:       uint8(temperature),
-			PowerDraw:         uint32(powerDraw),
-			ClockCore:         uint32(clockCore),
-			ClockMemory:       uint32(clockMemory),
-			FanSpeed:          uint8(fanSpeed),
-			Timestamp:         time.Now(),
+// parseComputeCapability parses a compute capability such as "8.6", returning 0 if unknown
+func parseComputeCapability(capability string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(capability), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// matchesArchitecture checks a GPU against a required architecture. CPU
+// architectures (x86_64, arm64) are matched against the host instead. A CUDA
+// target such as "sm_86" needs the same major compute capability and at least
+// its minor one, as binaries built for it require.
+func matchesArchitecture(gpu common.GPUDetail, required string) bool {
+	required = strings.ToLower(strings.TrimSpace(required))
+
+	switch required {
+	case "":
+		return true
+	case "x86_64", "amd64":
+		return runtime.GOARCH == "amd64"
+	case "arm64", "aarch64":
+		return runtime.GOARCH == "arm64"
+	}
+
+	if target, ok := strings.CutPrefix(required, "sm_"); ok {
+		have := parseComputeCapability(gpu.ComputeCapability)
+		want, err := strconv.Atoi(target)
+		if err != nil || have == 0 {
+			return false
 		}
+		return int(have) == want/10 && have >= float64(want)/10
+	}
 
-		metrics = append(metrics, metric)
+	return strings.EqualFold(gpu.Architecture, required)
+}
+
+// isCPUArchitecture reports whether an architecture requirement names a CPU
+// architecture rather than a GPU one
+func isCPUArchitecture(architecture string) bool {
+	switch strings.ToLower(strings.TrimSpace(architecture)) {
+	case "x86_64", "amd64", "arm64", "aarch64":
+		return true
+	}
+	return false
+}
+
+// startBillingSession starts a billing session for the task
+func (w *TaskWorker) startBillingSession(activeJob *ActiveJob) error {
+	if w.provider.config.BillingServiceURL == "" {
+		w.logger.Warn("Billing service URL not configured, skipping billing")
+		return nil
 	}
 
-	return metrics, nil
+	task := activeJob.Task
+
+	// Bill the GPUs reserved for the task, or find appropriate ones. The job is
+	// confined to the GPUs it is billed for.
+	if activeJob.AssignedGPU == nil {
+		gpuIndices, err := selectGPUs(w.provider.gpus, task.Requirements)
+		if err != nil {
+			return err
+		}
+		w.assignGPUs(activeJob, gpuIndices)
+	}
+	selectedGPU := activeJob.AssignedGPU
+
+	// Bill the VRAM reserved for the job across all of its GPUs: its share of a GPU, or
+	// the whole GPUs or MIG slice when it has them to itself. The power estimate is
+	// likewise the sum of its GPUs'.
+	requestedVRAM := task.Requirements.GPUMemoryMB
+	if activeJob.Reservation != nil && activeJob.Reservation.totalVRAMMB() > 0 {
+		requestedVRAM = activeJob.Reservation.totalVRAMMB()
+	} else if selectedGPU.MIGProfile != "" {
+		requestedVRAM = selectedGPU.VRAM
+	}
+	var estimatedPowerW uint32
+	for _, gpuIndex := range activeJob.AssignedGPUIndices {
+		estimatedPowerW += w.provider.gpus[gpuIndex].PowerConsumption
+	}
+
+	// Create billing session request
+	request := BillingSessionRequest{
+		UserID:          task.UserID,
+		ProviderID:      w.provider.provider.ID,
+		JobID:           &task.JobID,
+		SessionID:       &activeJob.SessionID,
+		GPUModel:        selectedGPU.ModelName,
+		RequestedVRAM:   requestedVRAM,
+		EstimatedPowerW: estimatedPowerW,
+		MaxTotalCost:    &task.MaxCostDGPU,
+	}
+
+	// Send request to billing service
+	reqData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal billing request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/sessions/start", w.provider.config.BillingServiceURL)
+	req, err := http.NewRequestWithContext(activeJob.Context, "POST", url, bytes.NewBuffer(reqData))
+	if err != nil {
+		return fmt.Errorf("failed to create billing request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Keyed on the job so a retry after a timeout reuses the session the billing
+	// service may already have created instead of billing the user twice
+	req.Header.Set("Idempotency-Key", sessionIdempotencyKey(task.JobID))
+
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to start billing session: %w", err)
+		w.provider.reportBillingFailure("start session", 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("billing service returned status %d: %s", resp.StatusCode, string(body))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			w.provider.reportBillingFailure("start session", resp.StatusCode, err)
+		}
+		return err
+	}
+	w.provider.reportBillingRecovered()
+
+	// Parse response
+	var billingResp BillingSessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&billingResp); err != nil {
+		return fmt.Errorf("failed to decode billing response: %w", err)
+	}
+
+	activeJob.BillingSession = &billingResp
+	w.logger.Info("Billing session started",
+		zap.String("session_id", billingResp.Session.ID.String()),
+		zap.String("hourly_rate", billingResp.Session.HourlyRate.String()))
+
+	return nil
+}
+
+// sessionIdempotencyKey derives the billing session start idempotency key for a job
+func sessionIdempotencyKey(jobID string) string {
+	return "session-start:" + jobID
 }
 
-// sendUsageUpdate sends usage update to billing service
-func (w *TaskWorker) sendUsageUpdate(activeJob *ActiveJob) {
-	if w.provider.config.BillingServiceURL == "" || activeJob.BillingSession == nil {
-		return
-	}
+// endBillingSession ends the billing session
+func (w *TaskWorker) endBillingSession(activeJob *ActiveJob) error {
+	if activeJob.BillingSession == nil {
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/sessions/%s/end",
+		w.provider.config.BillingServiceURL,
+		activeJob.BillingSession.Session.ID.String())
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create billing end request: %w", err)
+	}
+
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to end billing session: %w", err)
+		w.provider.reportBillingFailure("end session", 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		w.logger.Error("Failed to end billing session",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(body)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			w.provider.reportBillingFailure("end session", resp.StatusCode,
+				fmt.Errorf("billing service returned status %d", resp.StatusCode))
+		}
+		return nil
+	}
+
+	w.provider.reportBillingRecovered()
+
+	var ended BillingSessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ended); err != nil {
+		w.logger.Warn("Failed to decode ended billing session", zap.Error(err))
+		return nil
+	}
+	w.provider.recordEarnings(ended.Session.ProviderEarnings)
+	return nil
+}
+
+// refundBillingSession cancels the billing session of a job that failed before
+// execution, releasing locked funds and reversing any charge
+func (w *TaskWorker) refundBillingSession(activeJob *ActiveJob, reason string) error {
+	if activeJob.BillingSession == nil {
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/refund-session", w.provider.config.BillingServiceURL)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"session_id": activeJob.BillingSession.Session.ID,
+		"reason":     reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal billing refund request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create billing refund request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to refund billing session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		w.logger.Error("Failed to refund billing session",
+			zap.Int("status_code", resp.StatusCode),
+			zap.String("response", string(respBody)))
+		return nil
+	}
+
+	w.logger.Info("Billing session refunded",
+		zap.String("job_id", activeJob.Task.JobID),
+		zap.String("session_id", activeJob.BillingSession.Session.ID.String()))
+	return nil
+}
+
+// collectMetrics collects per-job and GPU metrics during task execution.
+// Container usage is streamed by streamContainerStats; script and WASM tasks
+// are sampled here from their process tree.
+func (w *TaskWorker) collectMetrics(activeJob *ActiveJob) {
+	ticker := time.NewTicker(w.provider.config.MetricsInterval)
+	defer ticker.Stop()
+
+	var sampler *processTreeSampler
+
+	for {
+		select {
+		case <-activeJob.Context.Done():
+			return
+		case <-ticker.C:
+			if pid := activeJob.ProcessPID.Load(); pid > 0 {
+				// A retry starts a new process, which needs a fresh CPU baseline
+				if sampler == nil || sampler.pid != pid {
+					sampler = &processTreeSampler{pid: pid}
+				}
+				if usage, metrics, err := sampler.sample(); err == nil {
+					activeJob.recordUsage(usage, metrics)
+				}
+			}
+
+			// Collect GPU metrics
+			if gpuMetrics, err := w.provider.collectGPUMetrics(); err == nil {
+				activeJob.GPUMetrics = gpuMetrics
+			}
+
+			activeJob.LastHeartbeat = time.Now()
+
+			// Send usage update to billing service
+			if activeJob.BillingSession != nil {
+				w.sendUsageUpdate(activeJob)
+			}
+		}
+	}
+}
+
+// runTrackedCommand runs cmd, recording its PID on the job while it runs so
+// that collectMetrics can sample its process tree
+func runTrackedCommand(activeJob *ActiveJob, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	activeJob.ExecutionStarted.Store(true)
+	activeJob.ProcessPID.Store(int32(cmd.Process.Pid))
+	defer activeJob.ProcessPID.Store(0)
+
+	return cmd.Wait()
+}
+
+// streamContainerStats follows the Docker stats stream for the job's container
+// and records its CPU, memory, network and block IO usage until it exits
+func (w *TaskWorker) streamContainerStats(activeJob *ActiveJob, containerID string) {
+	stats, err := w.provider.executionEnv.dockerClient.ContainerStats(activeJob.Context, containerID, true)
+	if err != nil {
+		w.logger.Warn("Failed to stream container stats", zap.String("container_id", containerID), zap.Error(err))
+		return
+	}
+	defer stats.Body.Close()
+
+	decoder := json.NewDecoder(stats.Body)
+	for {
+		var sample types.StatsJSON
+		if err := decoder.Decode(&sample); err != nil {
+			if !errors.Is(err, io.EOF) && activeJob.Context.Err() == nil {
+				w.logger.Debug("Container stats stream ended", zap.String("container_id", containerID), zap.Error(err))
+			}
+			return
+		}
+		activeJob.recordUsage(containerUsage(&sample))
+	}
+}
+
+// containerUsage converts a Docker stats sample to job resource usage, computing
+// CPU percent the way docker stats does
+func containerUsage(sample *types.StatsJSON) (ResourceUsage, ExecutionMetrics) {
+	var usage ResourceUsage
+
+	cpuStats, preCPUStats := sample.CPUStats, sample.PreCPUStats
+	if cpuStats.CPUUsage.TotalUsage > preCPUStats.CPUUsage.TotalUsage && cpuStats.SystemUsage > preCPUStats.SystemUsage {
+		onlineCPUs := float64(cpuStats.OnlineCPUs)
+		if onlineCPUs == 0 {
+			onlineCPUs = float64(len(cpuStats.CPUUsage.PercpuUsage))
+		}
+		cpuDelta := float64(cpuStats.CPUUsage.TotalUsage - preCPUStats.CPUUsage.TotalUsage)
+		systemDelta := float64(cpuStats.SystemUsage - preCPUStats.SystemUsage)
+		usage.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	// Page cache isn't the job's working set; cgroup v1 and v2 name it differently
+	memoryUsed := sample.MemoryStats.Usage
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if cache, ok := sample.MemoryStats.Stats[key]; ok && cache < memoryUsed {
+			memoryUsed -= cache
+			break
+		}
+	}
+	usage.MemoryMB = memoryUsed / 1024 / 1024
+	if sample.MemoryStats.Limit > 0 {
+		usage.MemoryPercent = float64(memoryUsed) / float64(sample.MemoryStats.Limit) * 100
+	}
+
+	var rxBytes, txBytes uint64
+	for _, network := range sample.Networks {
+		rxBytes += network.RxBytes
+		txBytes += network.TxBytes
+	}
+	usage.NetworkRxMB = rxBytes / 1024 / 1024
+	usage.NetworkTxMB = txBytes / 1024 / 1024
+
+	var readBytes, writeBytes uint64
+	for _, entry := range sample.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			readBytes += entry.Value
+		case "write":
+			writeBytes += entry.Value
+		}
+	}
+	usage.DiskReadMB = readBytes / 1024 / 1024
+	usage.DiskWriteMB = writeBytes / 1024 / 1024
+
+	metrics := ExecutionMetrics{
+		CPUUsagePercent:    usage.CPUPercent,
+		MemoryUsageMB:      usage.MemoryMB,
+		MemoryUsagePercent: usage.MemoryPercent,
+		NetworkTxMB:        usage.NetworkTxMB,
+		NetworkRxMB:        usage.NetworkRxMB,
+		ProcessCount:       int(sample.PidsStats.Current),
+	}
+	return usage, metrics
+}
+
+// processTreeSampler measures a task process and its descendants. CPU percent is
+// computed from CPU time consumed between samples, so the first sample reports 0.
+type processTreeSampler struct {
+	pid     int32
+	lastCPU float64
+	lastAt  time.Time
+}
+
+// sample sums resource usage across the process tree. Network usage can't be
+// attributed to processes and is left unset.
+func (ps *processTreeSampler) sample() (ResourceUsage, ExecutionMetrics, error) {
+	root, err := process.NewProcess(ps.pid)
+	if err != nil {
+		return ResourceUsage{}, ExecutionMetrics{}, err
+	}
+
+	var usage ResourceUsage
+	var metrics ExecutionMetrics
+	var cpuSeconds float64
+	var rssBytes, readBytes, writeBytes uint64
+
+	for _, proc := range processTree(root) {
+		metrics.ProcessCount++
+		if times, err := proc.Times(); err == nil {
+			cpuSeconds += times.User + times.System
+		}
+		if memInfo, err := proc.MemoryInfo(); err == nil {
+			rssBytes += memInfo.RSS
+		}
+		if io, err := proc.IOCounters(); err == nil {
+			readBytes += io.ReadBytes
+			writeBytes += io.WriteBytes
+		}
+		if threads, err := proc.NumThreads(); err == nil {
+			metrics.ThreadCount += int(threads)
+		}
+		if fds, err := proc.NumFDs(); err == nil {
+			metrics.FileDescriptorCount += int(fds)
+		}
+		if switches, err := proc.NumCtxSwitches(); err == nil {
+			metrics.ContextSwitches += uint64(switches.Voluntary + switches.Involuntary)
+		}
+		if faults, err := proc.PageFaults(); err == nil {
+			metrics.PageFaults += faults.MinorFaults + faults.MajorFaults
+		}
+	}
+
+	now := time.Now()
+	if !ps.lastAt.IsZero() && cpuSeconds > ps.lastCPU {
+		usage.CPUPercent = (cpuSeconds - ps.lastCPU) / now.Sub(ps.lastAt).Seconds() * 100
+	}
+	ps.lastCPU, ps.lastAt = cpuSeconds, now
+
+	usage.MemoryMB = rssBytes / 1024 / 1024
+	if memInfo, err := mem.VirtualMemory(); err == nil && memInfo.Total > 0 {
+		usage.MemoryPercent = float64(rssBytes) / float64(memInfo.Total) * 100
+	}
+	usage.DiskReadMB = readBytes / 1024 / 1024
+	usage.DiskWriteMB = writeBytes / 1024 / 1024
+
+	metrics.CPUUsagePercent = usage.CPUPercent
+	metrics.MemoryUsageMB = usage.MemoryMB
+	metrics.MemoryUsagePercent = usage.MemoryPercent
+	return usage, metrics, nil
+}
+
+// processTree returns a process and all of its descendants
+func processTree(root *process.Process) []*process.Process {
+	tree := []*process.Process{root}
+	for i := 0; i < len(tree); i++ {
+		children, err := tree[i].Children()
+		if err != nil {
+			continue // Includes processes without children
+		}
+		tree = append(tree, children...)
+	}
+	return tree
+}
+
+// collectGPUMetrics collects current GPU metrics
+func (p *GPUProvider) collectGPUMetrics() ([]GPUMetrics, error) {
+	var metrics []GPUMetrics
+
+	// Try NVIDIA first
+	if nvidiaMetrics, err := p.collectNVIDIAMetrics(); err == nil {
+		metrics = append(metrics, nvidiaMetrics...)
+	}
+
+	// AMD GPUs via ROCm
+	if amdMetrics, err := p.collectAMDMetrics(); err == nil {
+		metrics = append(metrics, amdMetrics...)
+	}
+
+	// Apple Silicon GPUs
+	if runtime.GOOS == "darwin" {
+		if appleMetrics, err := p.collectAppleGPUMetrics(); err == nil {
+			metrics = append(metrics, GPUMetrics{
+				Index:          0,
+				UUID:           "apple-gpu-0",
+				Name:           "Apple Silicon GPU",
+				UtilizationGPU: uint8(appleMetrics.Utilization),
+				Temperature:    uint8(appleMetrics.Temperature),
+				PowerDraw:      uint32(appleMetrics.PowerDrawW),
+				Timestamp:      time.Now(),
+			})
+		}
+	}
+
+	// Add other GPU vendors as needed
+	// TODO: Implement Intel metrics collection
+
+	return metrics, nil
+}
+
+// collectNVIDIAMetrics collects NVIDIA GPU metrics
+func (p *GPUProvider) collectNVIDIAMetrics() ([]GPUMetrics, error) {
+	if !isCommandAvailable("nvidia-smi") {
+		return nil, fmt.Errorf("nvidia-smi not available")
+	}
+
+	cmd := exec.Command("nvidia-smi",
+		"--query-gpu=index,uuid,name,utilization.gpu,utilization.memory,memory.total,memory.used,memory.free,temperature.gpu,power.draw,clocks.gr,clocks.mem,fan.speed",
+		"--format=csv,noheader,nounits")
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi execution failed: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	var metrics []GPUMetrics
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		if len(parts) < 13 {
+			continue
+		}
+
+		index, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+		uuid := strings.TrimSpace(parts[1])
+		name := strings.TrimSpace(parts[2])
+		utilizationGPU, _ := strconv.ParseUint(strings.TrimSpace(parts[3]), 10, 8)
+		utilizationMemory, _ := strconv.ParseUint(strings.TrimSpace(parts[4]), 10, 8)
+		memoryTotal, _ := strconv.ParseUint(strings.TrimSpace(parts[5]), 10, 64)
+		memoryUsed, _ := strconv.ParseUint(strings.TrimSpace(parts[6]), 10, 64)
+		memoryFree, _ := strconv.ParseUint(strings.TrimSpace(parts[7]), 10, 64)
+		temperature, _ := strconv.ParseUint(strings.TrimSpace(parts[8]), 10, 8)
+		powerDraw, _ := strconv.ParseUint(strings.TrimSpace(parts[9]), 10, 32)
+		clockCore, _ := strconv.ParseUint(strings.TrimSpace(parts[10]), 10, 32)
+		clockMemory, _ := strconv.ParseUint(strings.TrimSpace(parts[11]), 10, 32)
+		fanSpeed, _ := strconv.ParseUint(strings.TrimSpace(parts[12]), 10, 8)
+
+		metric := GPUMetrics{
+			Index:             index,
+			UUID:              uuid,
+			Name:              name,
+			UtilizationGPU:    uint8(utilizationGPU),
+			UtilizationMemory: uint8(utilizationMemory),
+			MemoryTotal:       memoryTotal,
+			MemoryUsed:        memoryUsed,
+			MemoryFree:        memoryFree,
+			Temperature:       uint8(temperature),
+			PowerDraw:         uint32(powerDraw),
+			ClockCore:         uint32(clockCore),
+			ClockMemory:       uint32(clockMemory),
+			FanSpeed:          uint8(fanSpeed),
+			Timestamp:         time.Now(),
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// collectAMDMetrics collects AMD GPU metrics using rocm-smi
+func (p *GPUProvider) collectAMDMetrics() ([]GPUMetrics, error) {
+	if !isCommandAvailable("rocm-smi") {
+		return nil, fmt.Errorf("rocm-smi not available")
+	}
+
+	cards, err := runROCmSMIJSON("--showuse", "--showmemuse", "--showmeminfo", "vram", "--showpower", "--showtemp", "--showproductname")
+	if err != nil {
+		return nil, err
+	}
+
+	// Unique IDs are queried separately; older rocm-smi releases reject
+	// --showuniqueid in combination with the other flags.
+	uniqueIDs, err := runROCmSMIJSON("--showuniqueid")
+	if err != nil {
+		p.logger.Debug("Failed to query rocm-smi unique IDs", zap.Error(err))
+		uniqueIDs = map[string]map[string]string{}
+	}
+
+	cardNames := make([]string, 0, len(cards))
+	for name := range cards {
+		if strings.HasPrefix(name, "card") {
+			cardNames = append(cardNames, name)
+		}
+	}
+	sort.Slice(cardNames, func(i, j int) bool {
+		return rocmCardIndex(cardNames[i]) < rocmCardIndex(cardNames[j])
+	})
+
+	var metrics []GPUMetrics
+	now := time.Now()
+
+	for _, name := range cardNames {
+		fields := cards[name]
+		index := rocmCardIndex(name)
+
+		// VRAM is reported in bytes
+		memoryTotal := uint64(rocmField(fields, "VRAM Total Memory (B)")) / 1024 / 1024
+		memoryUsed := uint64(rocmField(fields, "VRAM Total Used Memory (B)")) / 1024 / 1024
+		var memoryFree uint64
+		if memoryTotal > memoryUsed {
+			memoryFree = memoryTotal - memoryUsed
+		}
+
+		// Newer ROCm releases report socket power instead of average package power
+		powerDraw := rocmField(fields, "Average Graphics Package Power (W)")
+		if powerDraw == 0 {
+			powerDraw = rocmField(fields, "Current Socket Graphics Package Power (W)")
+		}
+
+		gpuName := strings.TrimSpace(fields["Card series"])
+		if gpuName == "" {
+			gpuName = strings.TrimSpace(fields["Card model"])
+		}
+
+		gpuUUID := strings.TrimSpace(uniqueIDs[name]["Unique ID"])
+		if gpuUUID == "" {
+			gpuUUID = name
+		}
+
+		metric := GPUMetrics{
+			Index:             index,
+			UUID:              gpuUUID,
+			Name:              gpuName,
+			UtilizationGPU:    uint8(rocmField(fields, "GPU use (%)")),
+			UtilizationMemory: uint8(rocmField(fields, "GPU memory use (%)")),
+			MemoryTotal:       memoryTotal,
+			MemoryUsed:        memoryUsed,
+			MemoryFree:        memoryFree,
+			Temperature:       uint8(rocmField(fields, "Temperature (Sensor edge) (C)")),
+			PowerDraw:         uint32(powerDraw),
+			Timestamp:         now,
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("rocm-smi reported no AMD GPUs")
+	}
+
+	return metrics, nil
+}
+
+// runROCmSMIJSON runs rocm-smi with --json and returns the per-card field maps
+func runROCmSMIJSON(args ...string) (map[string]map[string]string, error) {
+	cmd := exec.Command("rocm-smi", append(args, "--json")...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("rocm-smi execution failed: %w", err)
+	}
+
+	// rocm-smi may print warnings before the JSON document
+	if start := bytes.IndexByte(output, '{'); start > 0 {
+		output = output[start:]
+	}
+
+	var cards map[string]map[string]string
+	if err := json.Unmarshal(output, &cards); err != nil {
+		return nil, fmt.Errorf("failed to parse rocm-smi output: %w", err)
+	}
+
+	return cards, nil
+}
+
+// rocmCardIndex extracts the numeric index from a rocm-smi card key such as "card0"
+func rocmCardIndex(name string) int {
+	index, err := strconv.Atoi(strings.TrimPrefix(name, "card"))
+	if err != nil {
+		return -1
+	}
+	return index
+}
+
+// rocmField parses a numeric rocm-smi field, returning 0 when missing or unparsable
+func rocmField(fields map[string]string, key string) float64 {
+	value, ok := fields[key]
+	if !ok {
+		return 0
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || parsed < 0 {
+		return 0
+	}
+	return parsed
+}
+
+// collectAppleGPUMetrics collects Apple Silicon GPU metrics.
+//
+// powermetrics provides utilization, power and (on some models) temperature but
+// requires root; it is run directly when the daemon is root and through
+// passwordless sudo otherwise. When neither is possible, utilization is read
+// from the IOAccelerator performance statistics in ioreg, which is unprivileged
+// but doesn't report power or temperature.
+func (p *GPUProvider) collectAppleGPUMetrics() (*AppleGPUMetrics, error) {
+	metrics, err := collectApplePowermetrics()
+	if err == nil {
+		return metrics, nil
+	}
+	p.logger.Debug("powermetrics unavailable, falling back to ioreg", zap.Error(err))
+
+	return collectAppleIORegMetrics()
+}
+
+// collectApplePowermetrics samples the gpu_power sampler of powermetrics once
+func collectApplePowermetrics() (*AppleGPUMetrics, error) {
+	if !isCommandAvailable("powermetrics") {
+		return nil, fmt.Errorf("powermetrics not available")
+	}
+
+	args := []string{"powermetrics", "--samplers", "gpu_power", "-n", "1", "-i", "1000"}
+	if os.Geteuid() != 0 {
+		if !isCommandAvailable("sudo") {
+			return nil, fmt.Errorf("powermetrics requires root privileges")
+		}
+		// -n makes sudo fail instead of prompting for a password
+		args = append([]string{"sudo", "-n"}, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("powermetrics execution failed: %w", err)
+	}
+
+	metrics := &AppleGPUMetrics{}
+	found := false
+
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(key, "GPU HW active residency"), strings.HasPrefix(key, "GPU active residency"):
+			// e.g. "GPU HW active residency:  12.34% (389 MHz: 10% ...)"
+			if percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64); err == nil {
+				metrics.Utilization = percent
+				found = true
+			}
+		case key == "GPU Power":
+			// e.g. "GPU Power: 1234 mW"
+			if power, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				if len(fields) > 1 && fields[1] == "mW" {
+					power /= 1000
+				}
+				metrics.PowerDrawW = power
+				found = true
+			}
+		case key == "GPU die temperature":
+			// e.g. "GPU die temperature: 45.12 C"
+			if temp, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				metrics.Temperature = temp
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no GPU metrics found in powermetrics output")
+	}
+
+	return metrics, nil
+}
+
+// collectAppleIORegMetrics reads GPU utilization from the IOAccelerator registry entry
+func collectAppleIORegMetrics() (*AppleGPUMetrics, error) {
+	if !isCommandAvailable("ioreg") {
+		return nil, fmt.Errorf("ioreg not available")
+	}
+
+	output, err := exec.Command("ioreg", "-r", "-d", "1", "-w", "0", "-c", "IOAccelerator").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ioreg execution failed: %w", err)
+	}
+
+	// PerformanceStatistics contains e.g. "Device Utilization %"=37
+	const key = `"Device Utilization %"=`
+	text := string(output)
+	idx := strings.Index(text, key)
+	if idx < 0 {
+		return nil, fmt.Errorf("GPU utilization not found in ioreg output")
+	}
+
+	rest := text[idx+len(key):]
+	end := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	if end > 0 {
+		rest = rest[:end]
+	}
+
+	utilization, err := strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GPU utilization from ioreg: %w", err)
+	}
+
+	return &AppleGPUMetrics{Utilization: utilization}, nil
+}
+
+// jobGPUShare is one of a job's GPUs with the share of its power draw the job is
+// attributed
+type jobGPUShare struct {
+	Metrics GPUMetrics
+	Share   float64 // The job's MIG slice or share of the VRAM, 1 if it has the GPU to itself
+}
+
+// jobGPUShares matches the GPUs a job was placed on to their live metrics. GPUs
+// without metrics are left out.
+func (p *GPUProvider) jobGPUShares(activeJob *ActiveJob, metrics []GPUMetrics) []jobGPUShare {
+	reservedVRAM := make(map[int]uint64)
+	if activeJob.Reservation != nil {
+		for _, allocation := range activeJob.Reservation.GPUs {
+			reservedVRAM[allocation.Index] = allocation.VRAMMB
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	shares := make([]jobGPUShare, 0, len(activeJob.AssignedGPUIndices))
+	for _, i := range activeJob.AssignedGPUIndices {
+		if i < 0 || i >= len(p.gpus) {
+			continue
+		}
+		gpu := p.gpus[i]
+
+		// MIG instances report their parent card's metrics. GPUs without a UUID
+		// rely on metrics being collected in the order GPUs are detected in.
+		key := gpu.UUID
+		if gpu.ParentUUID != "" {
+			key = gpu.ParentUUID
+		}
+		found := -1
+		for j := range metrics {
+			if (key != "" && metrics[j].UUID == key) || (key == "" && metrics[j].UUID == "" && j == i) {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			continue
+		}
+
+		share := 1.0
+		switch vram := reservedVRAM[i]; {
+		case gpu.ParentUUID != "" && gpu.ComputeSlice > 0:
+			share = gpu.ComputeSlice
+		case vram > 0 && vram < gpu.VRAM:
+			share = float64(vram) / float64(gpu.VRAM)
+		}
+		shares = append(shares, jobGPUShare{Metrics: metrics[found], Share: share})
+	}
+	return shares
+}
+
+// jobCPUShare returns the fraction of the host's CPU time a job used, given its CPU
+// usage in percent of one core
+func jobCPUShare(cpuPercent float64, cores int) float64 {
+	if cores <= 0 || cpuPercent <= 0 {
+		return 0
+	}
+	return math.Min(cpuPercent/(100*float64(cores)), 1)
+}
+
+// energyKWh returns the energy drawn at watts over interval
+func energyKWh(watts float64, interval time.Duration) decimal.Decimal {
+	wattSeconds := decimal.NewFromFloat(watts).Mul(decimal.NewFromFloat(interval.Seconds()))
+	return wattSeconds.Div(decimal.NewFromInt(3600 * 1000))
+}
+
+// Usage updates published over NATS go to billing.usage.<session_id>, where the
+// billing service consumes them
+const usageUpdateSubject = "billing.usage.%s"
+
+// sendUsageUpdate sends usage update to billing service. With UsageUpdatesViaNATS it is
+// published over NATS, and POSTed only while NATS is disconnected.
+func (w *TaskWorker) sendUsageUpdate(activeJob *ActiveJob) {
+	if activeJob.BillingSession == nil {
+		return
+	}
+	viaNATS := w.provider.config.UsageUpdatesViaNATS && w.provider.natsConn != nil
+	if !viaNATS && w.provider.config.BillingServiceURL == "" {
+		return
+	}
+
+	usage, _ := activeJob.usageSnapshot()
+	interval := w.provider.config.MetricsInterval
+	request := UsageUpdateRequest{
+		UpdateID:       uuid.New(),
+		SessionID:      activeJob.BillingSession.Session.ID,
+		JobID:          activeJob.Task.JobID,
+		ProviderID:     w.provider.provider.ID,
+		CPUUtilization: usage.CPUPercent,
+		MemoryUsageMB:  usage.MemoryMB,
+		Timestamp:      time.Now(),
+	}
+
+	// Only the job's own GPUs count, and only its share of those it shares. Utilization
+	// is averaged over them and the temperature is the hottest one's.
+	gpus := w.provider.jobGPUShares(activeJob, activeJob.GPUMetrics)
+	var gpuPowerW, gpuUtilization, vramUtilization float64
+	gpuBreakdown := make([]map[string]interface{}, 0, len(gpus))
+	for _, gpu := range gpus {
+		powerW := float64(gpu.Metrics.PowerDraw) * gpu.Share
+		gpuPowerW += powerW
+		gpuUtilization += float64(gpu.Metrics.UtilizationGPU)
+		vramUtilization += float64(gpu.Metrics.UtilizationMemory)
+		if gpu.Metrics.Temperature > request.Temperature {
+			request.Temperature = gpu.Metrics.Temperature
+		}
+		gpuBreakdown = append(gpuBreakdown, map[string]interface{}{
+			"index":                      gpu.Metrics.Index,
+			"uuid":                       gpu.Metrics.UUID,
+			"name":                       gpu.Metrics.Name,
+			"utilization_gpu_percent":    gpu.Metrics.UtilizationGPU,
+			"utilization_memory_percent": gpu.Metrics.UtilizationMemory,
+			"temperature_celsius":        gpu.Metrics.Temperature,
+			"power_draw_watts":           gpu.Metrics.PowerDraw,
+			"share":                      gpu.Share,
+			"attributed_power_watts":     powerW,
+			"energy_kwh":                 energyKWh(powerW, interval),
+		})
+	}
+	if len(gpus) > 0 {
+		request.GPUUtilization = uint8(math.Round(gpuUtilization / float64(len(gpus))))
+		request.VRAMUtilization = uint8(math.Round(vramUtilization / float64(len(gpus))))
+	}
+	request.PowerDraw = uint32(math.Round(gpuPowerW))
+	request.EnergyUsageKWh = energyKWh(gpuPowerW, interval)
+	request.CustomMetrics = map[string]interface{}{
+		"gpus":            gpuBreakdown,
+		"gpu_power_watts": gpuPowerW,
+	}
+
+	// The job's share of the CPUs' draw, in proportion to the CPU time it used, where
+	// the host exposes it
+	if cpuPowerW, ok := w.provider.cpuPower.Watts(); ok {
+		share := jobCPUShare(usage.CPUPercent, runtime.NumCPU())
+		jobCPUPowerW := cpuPowerW * share
+		request.EnergyUsageKWh = request.EnergyUsageKWh.Add(energyKWh(jobCPUPowerW, interval))
+		request.CustomMetrics["cpu_power_watts"] = jobCPUPowerW
+		request.CustomMetrics["cpu_share"] = share
+	}
+
+	// Send update
+	reqData, err := json.Marshal(request)
+	if err != nil {
+		w.logger.Error("Failed to marshal usage update", zap.Error(err))
+		return
+	}
+
+	if viaNATS && w.provider.natsConn.IsConnected() {
+		subject := fmt.Sprintf(usageUpdateSubject, activeJob.BillingSession.Session.ID.String())
+		err := w.provider.natsConn.Publish(subject, reqData)
+		if err == nil {
+			return
+		}
+		w.logger.Warn("Failed to publish usage update, sending it over HTTP", zap.Error(err))
+	}
+	if w.provider.config.BillingServiceURL == "" {
+		return
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/sessions/%s/usage",
+		w.provider.config.BillingServiceURL,
+		activeJob.BillingSession.Session.ID.String())
+
+	resp, err := w.provider.httpClient.Post(url, "application/json", bytes.NewBuffer(reqData))
+	if err != nil {
+		w.logger.Error("Failed to send usage update", zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		w.logger.Warn("Usage update returned non-OK status", zap.Int("status", resp.StatusCode))
+	}
+}
+
+// pullDockerImage pulls the task's Docker image, authenticating to private registries
+func (w *TaskWorker) pullDockerImage(task *Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	registryAuth, err := w.registryAuth(task)
+	if err != nil {
+		return err
+	}
+
+	reader, err := w.provider.executionEnv.dockerClient.ImagePull(ctx, task.DockerImage, types.ImagePullOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	defer reader.Close()
+
+	// Read the pull output (optional, for logging)
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// Task DockerEnvironment keys carrying registry credentials. They are used for
+// the image pull only and never passed to the container.
+const (
+	registryUsernameEnv = "DANTE_REGISTRY_USERNAME"
+	registryPasswordEnv = "DANTE_REGISTRY_PASSWORD"
+)
+
+// dockerHubAuthKey is the key Docker Hub credentials are stored under in the Docker config
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// registryAuth returns the encoded RegistryAuth for the task's image, or "" to
+// pull anonymously. Credentials from the task take precedence over the
+// provider's configured credentials, which take precedence over the Docker
+// config. The returned value must never be logged.
+func (w *TaskWorker) registryAuth(task *Task) (string, error) {
+	ref, err := parseImageReference(task.DockerImage)
+	if err != nil {
+		return "", err
+	}
+	host, _, _ := strings.Cut(ref.repository, "/")
+	serverAddress := host
+	if host == "docker.io" {
+		serverAddress = dockerHubAuthKey
+	}
+
+	var authConfig *registry.AuthConfig
+	if username := task.DockerEnvironment[registryUsernameEnv]; username != "" {
+		authConfig = &registry.AuthConfig{Username: username, Password: task.DockerEnvironment[registryPasswordEnv]}
+	} else if cred, ok := w.provider.config.RegistryCredentials[host]; ok {
+		authConfig = &registry.AuthConfig{Username: cred.Username, Password: cred.Password, IdentityToken: cred.IdentityToken}
+	} else if authConfig, err = dockerConfigAuth(host); err != nil {
+		// A broken Docker config shouldn't block public images; the pull reports auth failures
+		w.logger.Warn("Failed to read registry credentials from Docker config", zap.String("registry", host), zap.Error(err))
+	}
+
+	if authConfig == nil {
+		return "", nil
+	}
+	authConfig.ServerAddress = serverAddress
+
+	w.logger.Debug("Using registry credentials for image pull", zap.String("registry", host))
+	return registry.EncodeAuthConfig(*authConfig)
+}
+
+// containerEnvironment returns the task environment without registry credentials
+func containerEnvironment(env map[string]string) map[string]string {
+	filtered := make(map[string]string, len(env))
+	for key, value := range env {
+		if key != registryUsernameEnv && key != registryPasswordEnv {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// dockerConfigFile is the subset of the Docker CLI config.json used for registry auth
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// dockerConfigAuth looks up credentials for a registry host in the Docker CLI
+// config in DOCKER_CONFIG or ~/.docker, consulting credential helpers the way
+// the Docker CLI does. It returns nil if there are none.
+func dockerConfigAuth(host string) (*registry.AuthConfig, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Docker config: %w", err)
+	}
+
+	var config dockerConfigFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse Docker config: %w", err)
+	}
+
+	keys := []string{host}
+	if host == "docker.io" {
+		keys = []string{dockerHubAuthKey, "index.docker.io", "docker.io", "registry-1.docker.io"}
+	}
+
+	for _, key := range keys {
+		if helper, ok := config.CredHelpers[key]; ok {
+			return credentialHelperAuth(helper, key)
+		}
+	}
+
+	for _, key := range keys {
+		entry, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		if entry.Auth == "" && entry.IdentityToken == "" {
+			break // Credentials live in the credential store
+		}
+
+		authConfig := &registry.AuthConfig{IdentityToken: entry.IdentityToken}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth entry for %s in Docker config", key)
+			}
+			username, password, found := strings.Cut(string(decoded), ":")
+			if !found {
+				return nil, fmt.Errorf("invalid auth entry for %s in Docker config", key)
+			}
+			authConfig.Username, authConfig.Password = username, password
+		}
+		return authConfig, nil
+	}
+
+	if config.CredsStore != "" {
+		return credentialHelperAuth(config.CredsStore, keys[0])
+	}
+	return nil, nil
+}
+
+// credentialHelperAuth asks docker-credential-<helper> for the credentials of a
+// registry. It returns nil if the helper has none for it.
+func credentialHelperAuth(helper, serverURL string) (*registry.AuthConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	// The helper's output holds the secret, so only its exit status is reported
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), "credentials not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %w", helper, err)
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, fmt.Errorf("credential helper %s returned invalid output", helper)
+	}
+
+	// Helpers store identity tokens under this placeholder username
+	if creds.Username == "<token>" {
+		return &registry.AuthConfig{IdentityToken: creds.Secret}, nil
+	}
+	return &registry.AuthConfig{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+// imagePolicyError reports a container image rejected by the provider's image policy
+type imagePolicyError struct {
+	image  string
+	reason string
+}
+
+func (e *imagePolicyError) Error() string {
+	return fmt.Sprintf("image %s rejected by provider policy: %s", e.image, e.reason)
+}
+
+// checkImagePolicy rejects images that match a denied pattern, match no allowed
+// pattern when an allowlist is configured, or lack a digest when pinning is required
+func checkImagePolicy(policy common.ImagePolicy, image string) error {
+	if image == "" {
+		return &imagePolicyError{image: `""`, reason: "no image specified"}
+	}
+
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return &imagePolicyError{image: image, reason: err.Error()}
+	}
+
+	for _, pattern := range policy.DeniedImages {
+		if ref.matches(pattern) {
+			return &imagePolicyError{image: image, reason: fmt.Sprintf("matches denied pattern %s", pattern)}
+		}
+	}
+
+	if len(policy.AllowedImages) > 0 {
+		allowed := false
+		for _, pattern := range policy.AllowedImages {
+			if ref.matches(pattern) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &imagePolicyError{image: image, reason: "not in the allowed image list"}
+		}
+	}
+
+	if policy.RequireDigestPinning && ref.digest == "" {
+		return &imagePolicyError{image: image, reason: "digest pinning is required (use image@sha256:<digest>)"}
+	}
+
+	return nil
+}
+
+// imageReference is a container image reference normalized the way Docker
+// resolves it, e.g. "ubuntu" becomes docker.io/library/ubuntu
+type imageReference struct {
+	repository string // Registry host and path
+	tag        string
+	digest     string // sha256:<hex>
+}
+
+// sha256DigestPattern matches a sha256 content digest
+var sha256DigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// parseImageReference splits an image reference into its normalized repository, tag and digest
+func parseImageReference(image string) (*imageReference, error) {
+	ref := &imageReference{}
+
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.digest = name[:i], name[i+1:]
+		if !sha256DigestPattern.MatchString(ref.digest) {
+			return nil, fmt.Errorf("invalid digest %q, expected sha256:<64 hex characters>", ref.digest)
+		}
+	}
+
+	// A colon after the last slash separates the tag; earlier ones belong to a registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.tag = name[:i], name[i+1:]
+	}
+	if name == "" || strings.ToLower(name) != name {
+		return nil, fmt.Errorf("invalid repository name %q", name)
+	}
+
+	// Without a registry host, Docker Hub is implied and official images live under library/
+	host, repoPath, found := strings.Cut(name, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		host, repoPath = "docker.io", name
+		if !strings.Contains(repoPath, "/") {
+			repoPath = "library/" + repoPath
+		}
+	}
+	ref.repository = host + "/" + repoPath
+
+	return ref, nil
+}
+
+// matches reports whether a policy pattern matches the repository alone, or
+// the repository with its tag or digest
+func (r *imageReference) matches(pattern string) bool {
+	candidates := []string{r.repository}
+	if r.tag != "" {
+		candidates = append(candidates, r.repository+":"+r.tag)
+	}
+	if r.digest != "" {
+		candidates = append(candidates, r.repository+"@"+r.digest)
+	}
+
+	for _, candidate := range candidates {
+		if ok, _ := path.Match(pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAvailableGPU checks if there's an available GPU
+func (w *TaskWorker) hasAvailableGPU() bool {
+	for _, gpu := range w.provider.gpus {
+		if gpu.IsAvailable && gpu.IsHealthy {
+			return true
+		}
+	}
+	return false
+}
+
+// collectContainerLogs streams logs from a Docker container into the job's
+// output collector and publishes each line on task.logs.<job_id>
+func (w *TaskWorker) collectContainerLogs(activeJob *ActiveJob, containerID string) {
+	ctx := activeJob.Context
+
+	logs, err := w.provider.executionEnv.dockerClient.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+	})
+	if err != nil {
+		w.logger.Error("Failed to get container logs", zap.Error(err))
+		return
+	}
+	defer logs.Close()
+
+	var sequence uint64
+	emit := func(stream, raw string) {
+		sequence++
+		line := ContainerLogLine{
+			JobID:     activeJob.Task.JobID,
+			Stream:    stream,
+			Sequence:  sequence,
+			Timestamp: time.Now(),
+			Line:      raw,
+		}
+
+		// Lines are prefixed with an RFC3339Nano timestamp when Timestamps is set
+		if ts, rest, ok := strings.Cut(raw, " "); ok {
+			if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				line.Timestamp = parsed
+				line.Line = rest
+			}
+		}
+
+		line.Line = activeJob.OutputCollector.appendLogLine(stream, line.Line)
+		w.publishLogLine(line)
+	}
+
+	stdout := &lineWriter{emit: func(line string) { emit("stdout", line) }}
+	stderr := &lineWriter{emit: func(line string) { emit("stderr", line) }}
+
+	// Docker multiplexes stdout and stderr into framed chunks for non-TTY containers
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil && ctx.Err() == nil {
+		w.logger.Error("Error reading container logs", zap.Error(err))
+	}
+
+	stdout.Flush()
+	stderr.Flush()
+}
+
+// publishLogLine publishes a single container log line via NATS
+func (w *TaskWorker) publishLogLine(line ContainerLogLine) {
+	if w.provider.natsConn == nil {
+		return
+	}
+
+	if data, err := json.Marshal(line); err == nil {
+		subject := fmt.Sprintf("task.logs.%s", line.JobID)
+		w.provider.publish(subject, data)
+	}
+}
+
+// lineWriter is an io.Writer that splits its input into lines
+type lineWriter struct {
+	buf  []byte
+	emit func(line string)
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		idx := bytes.IndexByte(lw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		lw.emit(strings.TrimSuffix(string(lw.buf[:idx]), "\r"))
+		lw.buf = lw.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing partial line
+func (lw *lineWriter) Flush() {
+	if len(lw.buf) > 0 {
+		lw.emit(string(lw.buf))
+		lw.buf = nil
+	}
+}
+
+// cleanupContainer removes a Docker container
+func (w *TaskWorker) cleanupContainer(containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Stop container
+	timeout := 10
+	w.provider.executionEnv.dockerClient.ContainerStop(ctx, containerID, container.StopOptions{
+		Timeout: &timeout,
+	})
+
+	// Remove container
+	w.provider.executionEnv.dockerClient.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
+		Force: true,
+	})
+}
+
+// mapToSlice converts a map to a slice of key=value strings
+func mapToSlice(m map[string]string) []string {
+	result := make([]string, 0, len(m))
+	for k, v := range m {
+		result = append(result, fmt.Sprintf("%s=%s", k, v))
+	}
+	return result
+}
+
+// Main function
+func main() {
+	// Load configuration
+	config := getDefaultProviderConfig()
+
+	// Create provider
+	provider, err := NewGPUProvider(config)
+	if err != nil {
+		fmt.Printf("Failed to create GPU provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize provider
+	if err := provider.Initialize(); err != nil {
+		fmt.Printf("Failed to initialize GPU provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	provider.logger.Info("GPU Provider started successfully")
+	fmt.Println("GPU Provider is running. Press Ctrl+C to stop.")
+
+	// Wait for a shutdown signal or a drain requested over NATS
+	select {
+	case <-sigChan:
+	case <-provider.DrainRequested():
+		provider.logger.Info("Drain requested over the control channel")
+	}
+	fmt.Println("Draining running jobs. Press Ctrl+C again to stop immediately.")
+
+	// A second signal gives up on draining
+	force := make(chan struct{})
+	go func() {
+		<-sigChan
+		provider.logger.Warn("Second shutdown signal received, forcing shutdown")
+		close(force)
+	}()
+
+	// Graceful shutdown
+	if err := provider.Shutdown(force); err != nil {
+		provider.logger.Error("Error during shutdown", zap.Error(err))
+		os.Exit(1)
+	}
+
+	fmt.Println("GPU Provider stopped")
+}
+
+// isCommandAvailable checks if a command exists in PATH
+func isCommandAvailable(command string) bool {
+	_, err := exec.LookPath(command)
+	return err == nil
+}
+
+// benchmarkResult is one GPU's entry in the provider daemon's --benchmark-json output
+type benchmarkResult struct {
+	GPUID              string    `json:"gpu_id"`
+	Model              string    `json:"model"`
+	FP16TFLOPS         float64   `json:"fp16_tflops"`
+	MemoryBandwidthGBs float64   `json:"memory_bandwidth_gb_s"`
+	StabilityScore     float64   `json:"stability_score"`
+	RunAt              time.Time `json:"run_at"`
+}
+
+// attachBenchmarks reads daemon benchmark results and attaches them to the GPUs
+// they were measured on. Results are matched to whole GPUs of the same model in
+// detection order; MIG instances aren't benchmarked.
+func attachBenchmarks(path string, gpus []common.GPUDetail) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var results []benchmarkResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return fmt.Errorf("failed to parse benchmark results: %w", err)
+	}
+
+	used := make([]bool, len(results))
+	for i := range gpus {
+		if gpus[i].MIGProfile != "" {
+			continue
+		}
+		for j, result := range results {
+			if used[j] || !strings.EqualFold(result.Model, gpus[i].ModelName) {
+				continue
+			}
+			used[j] = true
+			gpus[i].Benchmark = &common.GPUBenchmark{
+				FP16TFLOPS:         result.FP16TFLOPS,
+				MemoryBandwidthGBs: result.MemoryBandwidthGBs,
+				StabilityScore:     result.StabilityScore,
+				RunAt:              result.RunAt,
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// detectGPUs detects available GPUs on the system
+func detectGPUs() ([]common.GPUDetail, error) {
+	var gpus []common.GPUDetail
+
+	// Detect NVIDIA GPUs
+	if isCommandAvailable("nvidia-smi") {
+		nvidiaGPUs, err := detectNVIDIAGPUs()
+		if err == nil {
+			gpus = append(gpus, nvidiaGPUs...)
+		}
+	}
+
+	// Detect AMD GPUs
+	if runtime.GOOS == "linux" {
+		amdGPUs, err := detectAMDGPUs()
+		if err == nil {
+			gpus = append(gpus, amdGPUs...)
+		}
+	}
+
+	// Detect Intel GPUs
+	if isCommandAvailable("intel_gpu_top") {
+		intelGPUs, err := detectIntelGPUs()
+		if err == nil {
+			gpus = append(gpus, intelGPUs...)
+		}
+	}
+
+	// Detect Apple Silicon GPUs
+	if runtime.GOOS == "darwin" {
+		appleGPUs, err := detectAppleGPUs()
+		if err == nil {
+			gpus = append(gpus, appleGPUs...)
+		}
+	}
+
+	if len(gpus) == 0 {
+		return nil, fmt.Errorf("no GPUs detected")
+	}
+
+	return gpus, nil
+}
+
+// detectNVIDIAGPUs detects NVIDIA GPUs using nvidia-smi
+func detectNVIDIAGPUs() ([]common.GPUDetail, error) {
+	output, err := exec.Command("nvidia-smi", "--query-gpu=index,name,memory.total,driver_version,compute_cap,uuid,mig.mode.current", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		// Drivers that predate MIG reject the mig.mode field
+		output, err = exec.Command("nvidia-smi", "--query-gpu=index,name,memory.total,driver_version,compute_cap", "--format=csv,noheader,nounits").Output()
+		if err != nil {
+			return nil, fmt.Errorf("nvidia-smi command failed: %w", err)
+		}
+	}
+
+	var gpus []common.GPUDetail
+	migEnabled := map[string]bool{}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 5 {
+			continue
+		}
+
+		// Parse memory
+		memoryStr := strings.TrimSpace(fields[2])
+		memoryMB, err := strconv.ParseUint(memoryStr, 10, 64)
+		if err != nil {
+			memoryMB = 0
+		}
+
+		gpu := common.GPUDetail{
+			ModelName:         strings.TrimSpace(fields[1]),
+			VRAM:              memoryMB,
+			DriverVersion:     strings.TrimSpace(fields[3]),
+			ComputeCapability: strings.TrimSpace(fields[4]),
+			Architecture:      nvidiaArchitecture(strings.TrimSpace(fields[4])),
+			IsHealthy:         true,
+			IsAvailable:       true,
+			LastCheckAt:       time.Now(),
+		}
+		if len(fields) >= 7 {
+			gpu.UUID = strings.TrimSpace(fields[5])
+			migEnabled[gpu.UUID] = strings.EqualFold(strings.TrimSpace(fields[6]), "Enabled")
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	for _, enabled := range migEnabled {
+		if enabled {
+			return expandMIGInstances(gpus, migEnabled), nil
+		}
+	}
+	return gpus, nil
+}
+
+// migMaxComputeSlices is the number of GPU compute slices on MIG-capable cards (A100, H100)
+const migMaxComputeSlices = 7
+
+var (
+	// nvidia-smi -L lines for a physical GPU and for one of its MIG devices
+	nvidiaSMIGPULine = regexp.MustCompile(`^GPU \d+: .* \(UUID: (GPU-[^)]+)\)`)
+	nvidiaSMIMIGLine = regexp.MustCompile(`^\s+MIG (\S+)\s+Device\s+\d+: \(UUID: (MIG-[^)]+)\)`)
+
+	// migProfilePattern extracts compute slices and memory from a profile such as 3g.20gb
+	migProfilePattern = regexp.MustCompile(`^(\d+)g\.(\d+)gb`)
+)
+
+// expandMIGInstances replaces each MIG-enabled GPU with its MIG instances, so
+// that jobs are placed on and billed for a slice rather than the whole card.
+// GPUs are left whole if the instances can't be listed.
+func expandMIGInstances(gpus []common.GPUDetail, migEnabled map[string]bool) []common.GPUDetail {
+	output, err := exec.Command("nvidia-smi", "-L").Output()
+	if err != nil {
+		return gpus
+	}
+	instances := parseMIGInstances(string(output))
+
+	var expanded []common.GPUDetail
+	for _, gpu := range gpus {
+		if !migEnabled[gpu.UUID] {
+			expanded = append(expanded, gpu)
+			continue
+		}
+
+		// A MIG-enabled GPU without instances can't run CUDA work, so it is left out
+		for _, instance := range instances[gpu.UUID] {
+			slice := gpu
+			slice.UUID = instance.uuid
+			slice.ParentUUID = gpu.UUID
+			slice.MIGProfile = instance.profile
+
+			if match := migProfilePattern.FindStringSubmatch(instance.profile); match != nil {
+				computeSlices, _ := strconv.Atoi(match[1])
+				memoryGB, _ := strconv.ParseUint(match[2], 10, 64)
+				slice.ComputeSlice = float64(computeSlices) / migMaxComputeSlices
+				if memoryMB := memoryGB * 1024; memoryMB < gpu.VRAM {
+					slice.VRAM = memoryMB
+				}
+			}
+			if slice.ComputeSlice > 0 {
+				slice.PowerConsumption = uint32(float64(estimatePowerConsumption(gpu.ModelName)) * slice.ComputeSlice)
+			}
+
+			expanded = append(expanded, slice)
+		}
+	}
+	return expanded
+}
+
+// migInstance is a MIG device listed by nvidia-smi -L
+type migInstance struct {
+	profile string
+	uuid    string
+}
+
+// parseMIGInstances parses nvidia-smi -L output into MIG instances keyed by parent GPU UUID
+func parseMIGInstances(output string) map[string][]migInstance {
+	instances := make(map[string][]migInstance)
+	parent := ""
+	for _, line := range strings.Split(output, "\n") {
+		if match := nvidiaSMIGPULine.FindStringSubmatch(line); match != nil {
+			parent = match[1]
+			continue
+		}
+		if match := nvidiaSMIMIGLine.FindStringSubmatch(line); match != nil && parent != "" {
+			instances[parent] = append(instances[parent], migInstance{profile: match[1], uuid: match[2]})
+		}
+	}
+	return instances
+}
+
+// detectAMDGPUs detects AMD GPUs (Linux only)
+func detectAMDGPUs() ([]common.GPUDetail, error) {
+	var gpus []common.GPUDetail
+
+	// Check for ROCm devices
+	devices, err := filepath.Glob("/sys/class/drm/card*/device/vendor")
+	if err != nil {
+		return gpus, nil
+	}
+
+	// rocm-smi product names are only queried if sysfs doesn't provide them
+	var rocmCards map[string]map[string]string
+
+	for _, device := range devices {
+		vendorBytes, err := os.ReadFile(device)
+		if err != nil {
+			continue
+		}
+
+		vendor := strings.TrimSpace(string(vendorBytes))
+		if vendor != "0x1002" { // AMD vendor ID
+			continue
+		}
+
+		deviceDir := filepath.Dir(device)
+		cardName := filepath.Base(filepath.Dir(deviceDir))
+
+		// product_name is only exposed by newer kernels
+		modelName := readSysfsString(filepath.Join(deviceDir, "product_name"))
+		if modelName == "" && isCommandAvailable("rocm-smi") {
+			if rocmCards == nil {
+				if cards, err := runROCmSMIJSON("--showproductname"); err == nil {
+					rocmCards = cards
+				} else {
+					rocmCards = map[string]map[string]string{}
+				}
+			}
+			modelName = strings.TrimSpace(rocmCards[cardName]["Card series"])
+		}
+		if modelName == "" {
+			modelName = "AMD GPU"
+		}
+
+		// mem_info_vram_total is reported in bytes; older kernels lack it
+		vramMB := uint64(8192) // Default assumption
+		if vramBytes, err := strconv.ParseUint(readSysfsString(filepath.Join(deviceDir, "mem_info_vram_total")), 10, 64); err == nil && vramBytes > 0 {
+			vramMB = vramBytes / 1024 / 1024
+		}
+
+		gpu := common.GPUDetail{
+			ModelName:        modelName,
+			VRAM:             vramMB,
+			Architecture:     amdArchitecture(modelName),
+			PowerConsumption: estimatePowerConsumption(modelName),
+			IsHealthy:        true,
+			IsAvailable:      true,
+			LastCheckAt:      time.Now(),
+		}
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus, nil
+}
+
+// readSysfsString reads a sysfs attribute, returning an empty string if it is missing
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// nvidiaArchitecture maps a CUDA compute capability to its GPU architecture
+func nvidiaArchitecture(computeCapability string) string {
+	capability := parseComputeCapability(computeCapability)
+
+	switch {
+	case capability >= 10:
+		return "Blackwell"
+	case capability >= 9:
+		return "Hopper"
+	case capability >= 8.9:
+		return "Ada Lovelace"
+	case capability >= 8:
+		return "Ampere"
+	case capability >= 7.5:
+		return "Turing"
+	case capability >= 7:
+		return "Volta"
+	case capability >= 6:
+		return "Pascal"
+	case capability >= 5:
+		return "Maxwell"
+	case capability >= 3:
+		return "Kepler"
+	}
+
+	return ""
+}
+
+// amdArchitecture maps an AMD product name to its GPU architecture
+func amdArchitecture(modelName string) string {
+	name := strings.ToLower(modelName)
+
+	switch {
+	case strings.Contains(name, "mi300"):
+		return "CDNA3"
+	case strings.Contains(name, "mi200"), strings.Contains(name, "mi210"), strings.Contains(name, "mi250"):
+		return "CDNA2"
+	case strings.Contains(name, "mi100"):
+		return "CDNA"
+	case strings.Contains(name, "rx 7"), strings.Contains(name, "w7"):
+		return "RDNA3"
+	case strings.Contains(name, "rx 6"), strings.Contains(name, "w6"):
+		return "RDNA2"
+	case strings.Contains(name, "rx 5"), strings.Contains(name, "w5"):
+		return "RDNA"
+	case strings.Contains(name, "vega"), strings.Contains(name, "mi50"), strings.Contains(name, "mi60"):
+		return "GCN5"
+	}
+
+	return ""
+}
+
+// detectIntelGPUs detects Intel GPUs
+func detectIntelGPUs() ([]common.GPUDetail, error) {
+	var gpus []common.GPUDetail
+
+	// Basic Intel GPU detection
+	if runtime.GOOS == "linux" {
+		devices, err := filepath.Glob("/sys/class/drm/card*/device/vendor")
+		if err != nil {
+			return gpus, nil
+		}
+
+		for _, device := range devices {
+			vendorBytes, err := os.ReadFile(device)
+			if err != nil {
+				continue
+			}
+
+			vendor := strings.TrimSpace(string(vendorBytes))
+			if vendor == "0x8086" { // Intel vendor ID
+				gpu := common.GPUDetail{
+					ModelName:   "Intel GPU",
+					VRAM:        4096, // Default assumption
+					IsHealthy:   true,
+					IsAvailable: true,
+					LastCheckAt: time.Now(),
+				}
+				gpus = append(gpus, gpu)
+			}
+		}
+	}
+
+	return gpus, nil
+}
+
+// detectAppleGPUs detects Apple Silicon GPUs (macOS only)
+func detectAppleGPUs() ([]common.GPUDetail, error) {
+	var gpus []common.GPUDetail
+
+	if runtime.GOOS != "darwin" {
+		return gpus, nil
+	}
+
+	cmd := exec.Command("system_profiler", "SPDisplaysDataType", "-json")
+	output, err := cmd.Output()
+	if err != nil {
+		return gpus, nil
+	}
+
+	var profile struct {
+		Displays []struct {
+			Name       string `json:"_name"`
+			Model      string `json:"sppci_model"`
+			Cores      string `json:"sppci_cores"`
+			Vendor     string `json:"spdisplays_vendor"`
+			VRAM       string `json:"spdisplays_vram"`
+			VRAMShared string `json:"spdisplays_vram_shared"`
+		} `json:"SPDisplaysDataType"`
+	}
+	if err := json.Unmarshal(output, &profile); err != nil {
+		return gpus, nil
+	}
+
+	for _, display := range profile.Displays {
+		modelName := display.Model
+		if modelName == "" {
+			modelName = display.Name
+		}
+		if !strings.Contains(modelName, "Apple") && !strings.Contains(display.Vendor, "Apple") {
+			continue
+		}
+
+		cores, _ := strconv.ParseUint(strings.TrimSpace(display.Cores), 10, 32)
+
+		// Apple Silicon GPUs share unified memory with the CPU, so
+		// system_profiler usually reports no dedicated VRAM
+		vramMB := parseProfilerMemoryMB(display.VRAM)
+		if vramMB == 0 {
+			vramMB = parseProfilerMemoryMB(display.VRAMShared)
+		}
+		if vramMB == 0 {
+			if memInfo, err := mem.VirtualMemory(); err == nil {
+				vramMB = memInfo.Total / 1024 / 1024
+			} else {
+				vramMB = 8192 // Unified memory assumption
+			}
+		}
+
+		gpu := common.GPUDetail{
+			ModelName:        modelName,
+			VRAM:             vramMB,
+			Architecture:     "Apple Silicon",
+			CudaCores:        uint32(cores),
+			PowerConsumption: estimatePowerConsumption(modelName),
+			IsHealthy:        true,
+			IsAvailable:      true,
+			LastCheckAt:      time.Now(),
+		}
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus, nil
+}
+
+// parseProfilerMemoryMB parses system_profiler memory strings such as "16 GB" or "1536 MB"
+func parseProfilerMemoryMB(value string) uint64 {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return 0
+	}
+
+	amount, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	switch strings.ToUpper(fields[1]) {
+	case "GB":
+		return amount * 1024
+	case "MB":
+		return amount
+	}
+	return 0
+}
+
+// Initialize sets up the GPU provider
+func (p *GPUProvider) Initialize() error {
+	p.mu.Lock()
+	if p.initialized {
+		p.mu.Unlock()
+		return fmt.Errorf("GPU provider already initialized")
+	}
+	p.initialized = true
+	p.mu.Unlock()
+
+	p.logger.Info("Initializing GPU provider", zap.String("provider_id", p.provider.ID.String()))
+
+	// Clear workspaces left behind by a previous run before any job gets a new one
+	p.sweepOrphanWorkspaces()
+
+	// Start the worker pool; the job queue is created with the provider
+	p.initializeWorkerPool()
+
+	// Connect to NATS for status publishing and job control
+	if err := p.connectNATS(); err != nil {
+		p.logger.Warn("Failed to connect to NATS, continuing without job control", zap.Error(err))
+	}
+
+	// Start background services
+	go p.startHeartbeat()
+	go p.cpuSampler.run(p.ctx, &p.wg)
+	go p.cpuPower.run(p.ctx, &p.wg)
+	go p.startMetricsCollection()
+	go p.startHealthChecks()
+	go p.startPerformanceRecorder()
+
+	if err := p.startStatusAPI(); err != nil {
+		p.logger.Warn("Failed to start local status API", zap.Error(err))
+	}
+
+	p.logger.Info("GPU provider initialized successfully")
+	return nil
+}
+
+// connectNATS connects to NATS and subscribes to job control subjects
+func (p *GPUProvider) connectNATS() error {
+	if p.config.NATSAddress == "" {
+		return fmt.Errorf("NATS address not configured")
+	}
+
+	nc, err := nats.Connect(p.config.NATSAddress,
+		nats.Name(fmt.Sprintf("gpu-provider-%s", p.provider.ID)),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.ReconnectBufSize(natsReconnectBufSize),
+		nats.DisconnectErrHandler(p.handleNATSDisconnect),
+		nats.ReconnectHandler(p.handleNATSReconnect),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			p.logger.Warn("NATS connection closed")
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	if _, err := nc.Subscribe(fmt.Sprintf(taskDispatchSubject, p.provider.ID), p.handleTaskDispatch); err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to subscribe to task dispatch subject: %w", err)
+	}
+
+	if _, err := nc.Subscribe("task.cancel.*", p.handleCancelMessage); err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to subscribe to cancel subject: %w", err)
+	}
+
+	if _, err := nc.Subscribe("task.exec.*", p.handleExecMessage); err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to subscribe to exec subject: %w", err)
+	}
+
+	if _, err := nc.Subscribe(fmt.Sprintf("provider.%s.*", p.provider.ID), p.handleControlMessage); err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to subscribe to control subject: %w", err)
+	}
+
+	p.natsConn = nc
+	p.logger.Info("Connected to NATS", zap.String("address", p.config.NATSAddress))
+	return nil
+}
+
+// handleNATSDisconnect logs the disconnect and marks NATS unhealthy
+func (p *GPUProvider) handleNATSDisconnect(nc *nats.Conn, err error) {
+	p.logger.Warn("Disconnected from NATS, buffering outgoing updates", zap.Error(err))
+
+	message := "disconnected"
+	if err != nil {
+		message = err.Error()
+	}
+	p.healthChecker.updateCheck(HealthCheck{
+		Name:      "nats",
+		Type:      "connectivity",
+		Status:    "unhealthy",
+		Message:   message,
+		LastCheck: time.Now(),
+	})
+}
+
+// handleNATSReconnect marks NATS healthy again and flushes buffered updates
+func (p *GPUProvider) handleNATSReconnect(nc *nats.Conn) {
+	p.logger.Info("Reconnected to NATS", zap.String("url", nc.ConnectedUrl()))
+
+	p.healthChecker.updateCheck(HealthCheck{
+		Name:      "nats",
+		Type:      "connectivity",
+		Status:    "healthy",
+		Message:   "connected",
+		LastCheck: time.Now(),
+	})
+
+	p.flushPendingPublishes()
+}
+
+// publish sends a message over NATS, buffering it while the connection is down
+// so that status updates survive short outages
+func (p *GPUProvider) publish(subject string, data []byte) {
+	if p.natsConn == nil {
+		return
+	}
+
+	p.publishMutex.Lock()
+	defer p.publishMutex.Unlock()
+
+	// Keep ordering: anything queued earlier must go out first
+	if len(p.pendingPublishes) == 0 && p.natsConn.IsConnected() {
+		if err := p.natsConn.Publish(subject, data); err == nil {
+			return
+		}
+	}
+
+	if len(p.pendingPublishes) >= maxPendingPublishes {
+		p.pendingPublishes = p.pendingPublishes[1:]
+		p.logger.Warn("NATS publish buffer full, dropping oldest update")
+	}
+	p.pendingPublishes = append(p.pendingPublishes, pendingPublish{Subject: subject, Data: data})
+}
+
+// flushPendingPublishes publishes buffered messages in order, stopping at the
+// first failure so the remainder is retried on the next reconnect
+func (p *GPUProvider) flushPendingPublishes() {
+	p.publishMutex.Lock()
+	defer p.publishMutex.Unlock()
+
+	sent := 0
+	for _, msg := range p.pendingPublishes {
+		if err := p.natsConn.Publish(msg.Subject, msg.Data); err != nil {
+			p.logger.Warn("Failed to flush buffered NATS update", zap.Error(err))
+			break
+		}
+		sent++
+	}
+
+	p.pendingPublishes = p.pendingPublishes[sent:]
+	if sent > 0 {
+		p.logger.Info("Flushed buffered NATS updates",
+			zap.Int("sent", sent),
+			zap.Int("remaining", len(p.pendingPublishes)))
+	}
+}
+
+// taskDispatchSubject is where the scheduler sends this provider its tasks, as
+// tasks.dispatch.<provider_id>.<job_id>.
+const taskDispatchSubject = "tasks.dispatch.%s.*"
+
+// handleTaskDispatch queues a task dispatched by the scheduler. NATS delivers a
+// subscription's messages one at a time, so while the queue is full this blocks and
+// later tasks wait in the subscription until a worker frees a slot. Tasks that can't
+// run here are handed back to the scheduler.
+func (p *GPUProvider) handleTaskDispatch(msg *nats.Msg) {
+	var task Task
+	if err := json.Unmarshal(msg.Data, &task); err != nil || task.JobID == "" {
+		p.logger.Warn("Ignoring invalid task dispatch", zap.String("subject", msg.Subject), zap.Error(err))
+		return
+	}
+	if task.DispatchedAt.IsZero() {
+		task.DispatchedAt = time.Now()
+	}
+
+	if err := p.EnqueueTask(p.ctx, &task); err != nil {
+		p.logger.Warn("Rejecting dispatched task", zap.String("job_id", task.JobID), zap.Error(err))
+		code := "task_rejected"
+		if errors.Is(err, errProviderDraining) || errors.Is(err, errTaskQueueClosed) || errors.Is(err, context.Canceled) {
+			code = "provider_draining"
+		}
+		p.rejectTask(&task, "Task was not accepted", err, code)
+	}
+}
+
+// handleCancelMessage cancels the job named in a task.cancel.<job_id> message
+func (p *GPUProvider) handleCancelMessage(msg *nats.Msg) {
+	jobID := strings.TrimPrefix(msg.Subject, "task.cancel.")
+
+	p.jobMutex.RLock()
+	activeJob, ok := p.activeJobs[jobID]
+	p.jobMutex.RUnlock()
+
+	if !ok {
+		p.logger.Debug("Ignoring cancel for job not running on this provider", zap.String("job_id", jobID))
+		return
+	}
+
+	go p.cancelJob(activeJob)
+}
+
+// cancelJob stops a running job. Containers receive SIGTERM and are killed
+// once CancelGracePeriod elapses; scripts get the same treatment through
+// their command's Cancel hook when the job context is canceled.
+func (p *GPUProvider) cancelJob(activeJob *ActiveJob) {
+	if !activeJob.CancelRequested.CompareAndSwap(false, true) {
+		return
+	}
+
+	p.logger.Info("Canceling job", zap.String("job_id", activeJob.Task.JobID))
+
+	if activeJob.ContainerID != "" && p.executionEnv != nil && p.executionEnv.dockerClient != nil {
+		grace := p.settings().CancelGracePeriod
+		ctx, cancel := context.WithTimeout(context.Background(), grace+10*time.Second)
+		defer cancel()
+
+		timeout := int(grace.Seconds())
+		if err := p.executionEnv.dockerClient.ContainerStop(ctx, activeJob.ContainerID, container.StopOptions{
+			Signal:  "SIGTERM",
+			Timeout: &timeout,
+		}); err != nil {
+			p.logger.Warn("Failed to stop container for canceled job",
+				zap.String("job_id", activeJob.Task.JobID),
+				zap.Error(err))
+		}
+	}
+
+	activeJob.Cancel()
+}
+
+// errInteractiveExecDisabled rejects exec sessions on providers that don't allow them
+var errInteractiveExecDisabled = errors.New("interactive access is disabled on this provider")
+
+// Exec sessions are opened with a request on task.exec.<job_id>, answered only by the
+// provider running the job. The session then runs over exec.<session_id>: the client
+// sends in.stdin, in.resize and in.close, and the provider publishes the output on out
+// and an execExit on exit when the session ends.
+const (
+	execInSubject   = "exec.%s.in.*"
+	execOutSubject  = "exec.%s.out"
+	execExitSubject = "exec.%s.exit"
+)
+
+// execRequest asks for an exec session in a running job's container
+type execRequest struct {
+	SessionID string   `json:"session_id"` // Chosen by the client, which subscribes first
+	UserID    string   `json:"user_id"`
+	Command   []string `json:"command,omitempty"` // /bin/sh by default
+	TTY       bool     `json:"tty"`
+	Cols      uint     `json:"cols,omitempty"`
+	Rows      uint     `json:"rows,omitempty"`
+}
+
+// execSessionInfo is the reply to an accepted exec request
+type execSessionInfo struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// execResize sets the terminal size of a TTY session
+type execResize struct {
+	Cols uint `json:"cols"`
+	Rows uint `json:"rows"`
+}
+
+// execExit reports how an exec session ended. ExitCode is -1 if the command was still
+// running, e.g. when the session timed out.
+type execExit struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleExecMessage answers a task.exec.<job_id> request for a job running here.
+// Requests for other jobs are left to the provider running them.
+func (p *GPUProvider) handleExecMessage(msg *nats.Msg) {
+	jobID := strings.TrimPrefix(msg.Subject, "task.exec.")
+
+	p.jobMutex.RLock()
+	activeJob, ok := p.activeJobs[jobID]
+	p.jobMutex.RUnlock()
+
+	if !ok || msg.Reply == "" {
+		return
+	}
+
+	var req execRequest
+	var info *execSessionInfo
+	err := json.Unmarshal(msg.Data, &req)
+	if err == nil {
+		info, err = p.startExecSession(activeJob, req)
+	}
+
+	response := controlResponse{OK: err == nil}
+	if err != nil {
+		response.Error = err.Error()
+		p.logger.Warn("Exec request rejected", zap.String("job_id", jobID), zap.Error(err))
+	} else {
+		response.Data = info
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		p.logger.Error("Failed to encode exec response", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(payload); err != nil {
+		p.logger.Warn("Failed to send exec response", zap.String("job_id", jobID), zap.Error(err))
+	}
+}
+
+// startExecSession execs a command in the job's container and relays it over NATS
+// until the command exits, the client closes the session, the session times out or
+// the job ends
+func (p *GPUProvider) startExecSession(activeJob *ActiveJob, req execRequest) (*execSessionInfo, error) {
+	if !p.config.AllowInteractiveExec {
+		return nil, errInteractiveExecDisabled
+	}
+	if _, err := uuid.Parse(req.SessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if activeJob.Task.UserID == "" {
+		return nil, errors.New("job has no recorded owner")
+	}
+	if req.UserID != activeJob.Task.UserID {
+		return nil, errors.New("job belongs to another user")
+	}
+	if activeJob.Status != JobStatusRunning || activeJob.ContainerID == "" {
+		return nil, errors.New("job is not running in a container")
+	}
+	if p.executionEnv == nil || p.executionEnv.dockerClient == nil {
+		return nil, errors.New("docker is not available")
+	}
+
+	command := req.Command
+	if len(command) == 0 {
+		command = []string{"/bin/sh"}
+	}
+	timeout := p.config.ExecSessionTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+
+	dockerClient := p.executionEnv.dockerClient
+	ctx, cancel := context.WithTimeout(activeJob.Context, timeout)
+	created, err := dockerClient.ContainerExecCreate(ctx, activeJob.ContainerID, types.ExecConfig{
+		Cmd:          command,
+		Tty:          req.TTY,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+	attached, err := dockerClient.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: req.TTY})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+
+	resize := func(size execResize) {
+		if !req.TTY || size.Cols == 0 || size.Rows == 0 {
+			return
+		}
+		if err := dockerClient.ContainerExecResize(ctx, created.ID, types.ResizeOptions{Width: size.Cols, Height: size.Rows}); err != nil {
+			p.logger.Debug("Failed to resize exec session", zap.String("session_id", req.SessionID), zap.Error(err))
+		}
+	}
+	resize(execResize{Cols: req.Cols, Rows: req.Rows})
+
+	sub, err := p.natsConn.Subscribe(fmt.Sprintf(execInSubject, req.SessionID), func(msg *nats.Msg) {
+		switch msg.Subject[strings.LastIndex(msg.Subject, ".")+1:] {
+		case "stdin":
+			if _, err := attached.Conn.Write(msg.Data); err != nil && ctx.Err() == nil {
+				// The command can't be given its input any more, so the session is over
+				p.logger.Warn("Failed to write exec session input, ending the session",
+					zap.String("session_id", req.SessionID), zap.Error(err))
+				cancel()
+			}
+		case "resize":
+			var size execResize
+			if json.Unmarshal(msg.Data, &size) == nil {
+				resize(size)
+			}
+		case "close":
+			cancel()
+		}
+	})
+	if err != nil {
+		attached.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to subscribe to session input: %w", err)
+	}
+
+	p.logger.Info("Exec session opened",
+		zap.String("job_id", activeJob.Task.JobID),
+		zap.String("session_id", req.SessionID),
+		zap.String("user_id", req.UserID),
+		zap.Strings("command", command),
+		zap.Duration("timeout", timeout))
+
+	go p.relayExecSession(ctx, cancel, req.SessionID, created.ID, req.TTY, attached, sub)
+	return &execSessionInfo{SessionID: req.SessionID, ExpiresAt: time.Now().Add(timeout)}, nil
+}
+
+// relayExecSession publishes an exec session's output until it ends and then reports
+// its exit. Docker can't kill an exec'd process, so a session that is cut short closes
+// the command's stdin, which ends a shell.
+func (p *GPUProvider) relayExecSession(ctx context.Context, cancel context.CancelFunc, sessionID, execID string, tty bool, attached types.HijackedResponse, sub *nats.Subscription) {
+	defer cancel()
+	defer sub.Unsubscribe()
+
+	go func() {
+		<-ctx.Done()
+		attached.Close()
+	}()
+
+	output := natsWriter{provider: p, subject: fmt.Sprintf(execOutSubject, sessionID)}
+	var err error
+	if tty {
+		_, err = io.Copy(output, attached.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(output, output, attached.Reader)
+	}
+
+	exit := execExit{ExitCode: -1}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		exit.Error = "session timed out"
+	case err != nil && ctx.Err() == nil:
+		exit.Error = err.Error()
+	}
+
+	inspectCtx, inspectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if inspect, err := p.executionEnv.dockerClient.ContainerExecInspect(inspectCtx, execID); err == nil && !inspect.Running {
+		exit.ExitCode = inspect.ExitCode
+	}
+	inspectCancel()
+
+	if data, err := json.Marshal(exit); err == nil {
+		p.publish(fmt.Sprintf(execExitSubject, sessionID), data)
+	}
+	p.logger.Info("Exec session closed",
+		zap.String("session_id", sessionID),
+		zap.Int("exit_code", exit.ExitCode),
+		zap.String("reason", exit.Error))
+}
+
+// natsWriter publishes everything written to it on a NATS subject
+type natsWriter struct {
+	provider *GPUProvider
+	subject  string
+}
+
+func (w natsWriter) Write(b []byte) (int, error) {
+	// publish may buffer the message, so it gets its own copy
+	w.provider.publish(w.subject, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// RequestDrain asks the provider to drain and shut down, as on SIGTERM. It only
+// signals DrainRequested; main runs the shutdown.
+func (p *GPUProvider) RequestDrain() {
+	p.drainOnce.Do(func() { close(p.drainRequested) })
+}
+
+// DrainRequested is closed once a drain has been requested over the control channel
+func (p *GPUProvider) DrainRequested() <-chan struct{} {
+	return p.drainRequested
+}
+
+// draining reports whether shutdown has started.
+func (p *GPUProvider) draining() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.isShuttingDown
+}
+
+// Shutdown drains the provider and stops it. New tasks are rejected, queued tasks
+// are handed back to the scheduler, and running jobs get up to DrainTimeout to
+// finish and end their billing sessions. Jobs still running after that are
+// canceled. Closing force skips the remaining waits.
+func (p *GPUProvider) Shutdown(force <-chan struct{}) error {
+	settings := p.settings()
+	p.logger.Info("Draining GPU provider", zap.Duration("drain_timeout", settings.DrainTimeout))
+
+	p.mu.Lock()
+	p.isShuttingDown = true
+	p.mu.Unlock()
+
+	// Queued tasks haven't started, so they can run elsewhere
+	for _, task := range p.jobQueue.Drain() {
+		p.rejectQueuedTask(task)
+	}
+
+	// Report draining straight away so no more jobs are placed here
+	if err := p.sendHeartbeat(); err != nil {
+		p.logger.Warn("Failed to send draining heartbeat", zap.Error(err))
+	}
+
+	if waitTimeout(&p.workers, settings.DrainTimeout, force) {
+		p.logger.Info("All jobs finished")
+	} else {
+		p.jobMutex.RLock()
+		running := make([]*ActiveJob, 0, len(p.activeJobs))
+		for _, activeJob := range p.activeJobs {
+			running = append(running, activeJob)
+		}
+		p.jobMutex.RUnlock()
+
+		p.logger.Warn("Drain incomplete, canceling running jobs", zap.Int("active_jobs", len(running)))
+		for _, activeJob := range running {
+			go p.cancelJob(activeJob)
+		}
+		// Canceled jobs end their billing sessions on the way out
+		if !waitTimeout(&p.workers, settings.CancelGracePeriod+shutdownWaitTimeout, force) {
+			p.logger.Warn("Jobs did not stop after cancellation")
+		}
+	}
+
+	// Cancel context to stop all operations
+	p.cancel()
+
+	if p.statusServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		p.statusServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+
+	// Wait for background loops, but don't hang on a stuck one
+	if !waitTimeout(&p.wg, shutdownWaitTimeout, force) {
+		p.logger.Warn("Timed out waiting for background tasks to stop")
+	}
+
+	// Heartbeats have stopped, so nothing brings the provider back online after this
+	if err := p.deregister(); err != nil {
+		p.logger.Warn("Failed to mark provider offline in registry", zap.Error(err))
+	}
+
+	// Close NATS connection
+	if p.natsConn != nil {
+		p.natsConn.Close()
+	}
+
+	// Clean up execution environment
+	if p.executionEnv != nil && p.executionEnv.dockerClient != nil {
+		p.executionEnv.dockerClient.Close()
+	}
+
+	p.logger.Info("GPU provider shutdown complete")
+	return nil
+}
+
+// rejectQueuedTask tells the scheduler that a queued task won't run here.
+func (p *GPUProvider) rejectQueuedTask(task *Task) {
+	p.logger.Info("Returning queued task", zap.String("job_id", task.JobID))
+	p.rejectTask(task, "Provider is shutting down", errProviderDraining, "provider_draining")
+}
+
+// rejectTask reports a task that won't run here as failed before it started.
+func (p *GPUProvider) rejectTask(task *Task, message string, err error, code string) {
+	update := TaskStatusUpdate{
+		JobID:      task.JobID,
+		ProviderID: p.provider.ID.String(),
+		SessionID:  task.SessionID,
+		Status:     JobStatusFailed,
+		Stage:      "queued",
+		Message:    message,
+		Error:      err.Error(),
+		ErrorCode:  code,
+		Timestamp:  time.Now(),
+	}
+	if data, err := json.Marshal(update); err == nil {
+		p.publish(fmt.Sprintf("task.status.%s", task.JobID), data)
+	}
+}
+
+// waitTimeout waits for wg until timeout elapses or stop is closed, and reports
+// whether wg finished.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration, stop <-chan struct{}) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// startHeartbeat sends periodic heartbeats to the registry
+func (p *GPUProvider) startHeartbeat() {
+	p.wg.Add(1)
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.HeartbeatInterval)
+	defer ticker.Stop()
 
-	// Calculate energy usage (simplified)
-	var energyUsage decimal.Decimal
-	if len(activeJob.GPUMetrics) > 0 {
-		totalPower := decimal.Zero
-		for _, gpu := range activeJob.GPUMetrics {
-			totalPower = totalPower.Add(decimal.NewFromInt(int64(gpu.PowerDraw)))
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.sendHeartbeat(); err != nil {
+				p.logger.Error("Failed to send heartbeat", zap.Error(err))
+			}
 		}
-		// Convert watts to kWh (power in watts * time in hours / 1000)
-		hours := decimal.NewFromFloat(w.provider.config.MetricsInterval.Hours())
-		energyUsage = totalPower.Mul(hours).Div(decimal.NewFromInt(1000))
-	}
-
-	request := UsageUpdateRequest{
-		SessionID:      activeJob.BillingSession.Session.ID,
-		JobID:          activeJob.Task.JobID,
-		ProviderID:     w.provider.provider.ID,
-		CPUUtilization: activeJob.ResourceUsage.CPUPercent,
-		MemoryUsageMB:  activeJob.ResourceUsage.MemoryMB,
-		EnergyUsageKWh: energyUsage,
-		Timestamp:      time.Now(),
 	}
+}
 
-	// Add GPU metrics
-	if len(activeJob.GPUMetrics) > 0 {
-		gpu := activeJob.GPUMetrics[0] // Use first GPU for simplicity
-		request.GPUUtilization = gpu.UtilizationGPU
-		request.VRAMUtilization = gpu.UtilizationMemory
-		request.PowerDraw = gpu.PowerDraw
-		request.Temperature = gpu.Temperature
+// sendHeartbeat sends a heartbeat to the provider registry
+func (p *GPUProvider) sendHeartbeat() error {
+	data, err := json.Marshal(p.buildHeartbeat())
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat data: %w", err)
 	}
 
-	// Send update
-	reqData, err := json.Marshal(request)
+	url := fmt.Sprintf("%s/api/v1/providers/%s/heartbeat", p.config.ProviderRegistryURL, p.provider.ID)
+	req, err := http.NewRequestWithContext(p.ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
-		w.logger.Error("Failed to marshal usage update", zap.Error(err))
-		return
+		return fmt.Errorf("failed to create heartbeat request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/api/v1/billing/sessions/%s/usage",
-		w.provider.config.BillingServiceURL,
-		activeJob.BillingSession.Session.ID.String())
+	req.Header.Set("Content-Type", "application/json")
+	if err := p.signRegistryRequest(req, "heartbeat", data); err != nil {
+		return err
+	}
 
-	resp, err := w.provider.httpClient.Post(url, "application/json", bytes.NewBuffer(reqData))
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
-		w.logger.Error("Failed to send usage update", zap.Error(err))
-		return
+		return fmt.Errorf("failed to send heartbeat: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		w.logger.Warn("Usage update returned non-OK status", zap.Int("status", resp.StatusCode))
+		return fmt.Errorf("heartbeat failed with status: %d", resp.StatusCode)
 	}
+
+	return nil
 }
 
-// pullDockerImage pulls a Docker image
-func (w *TaskWorker) pullDockerImage(image string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
+// signRegistryRequest signs a request about this provider to the registry with the
+// wallet key, so the registry can tell it came from this provider. The signature
+// covers the action, the provider ID, a timestamp, a random nonce and the SHA-256 of
+// the body; the registry rejects old timestamps and reused nonces. Without a wallet
+// the request goes out unsigned.
+func (p *GPUProvider) signRegistryRequest(req *http.Request, action string, body []byte) error {
+	if p.walletManager == nil {
+		return nil
+	}
 
-	reader, err := w.provider.executionEnv.dockerClient.ImagePull(ctx, image, types.ImagePullOptions{})
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate request nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	payload := fmt.Sprintf("%s\n%s\n%s\n%s\n%x", action, p.provider.ID, timestamp, nonceHex, sha256.Sum256(body))
+	signature, err := p.walletManager.privateKey.Sign([]byte(payload))
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+		return fmt.Errorf("failed to sign %s request: %w", action, err)
 	}
-	defer reader.Close()
 
-	// Read the pull output (optional, for logging)
-	_, err = io.Copy(io.Discard, reader)
-	return err
+	req.Header.Set("X-Provider-Timestamp", timestamp)
+	req.Header.Set("X-Provider-Nonce", nonceHex)
+	req.Header.Set("X-Provider-Signature", signature.String())
+	return nil
 }
 
-// hasAvailableGPU checks if there's an available GPU
-func (w *TaskWorker) hasAvailableGPU() bool {
-	for _, gpu := range w.provider.gpus {
-		if gpu.IsAvailable && gpu.IsHealthy {
-			return true
-		}
+// deregister tells the provider registry the provider is going offline, so it stops
+// being offered for jobs right away rather than when its heartbeat times out
+func (p *GPUProvider) deregister() error {
+	if p.provider == nil {
+		return nil
 	}
-	return false
-}
 
-// collectContainerLogs collects logs from a Docker container
-func (w *TaskWorker) collectContainerLogs(activeJob *ActiveJob, containerID string) {
-	ctx := activeJob.Context
+	ctx, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+	defer cancel()
 
-	logs, err := w.provider.executionEnv.dockerClient.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     true,
-		Timestamps: true,
-	})
+	url := fmt.Sprintf("%s/api/v1/providers/%s/offline", p.config.ProviderRegistryURL, p.provider.ID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
-		w.logger.Error("Failed to get container logs", zap.Error(err))
-		return
+		return fmt.Errorf("failed to create offline request: %w", err)
 	}
-	defer logs.Close()
-
-	// Read logs and add to output collector
-	buf := make([]byte, 4096)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			n, err := logs.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					w.logger.Error("Error reading container logs", zap.Error(err))
-				}
-				return
-			}
-
-			if n > 0 {
-				// Docker logs have 8-byte header, strip it
-				logData := buf[8:n]
-
-				activeJob.OutputCollector.mu.Lock()
-				activeJob.OutputCollector.Stdout.Write(logData)
-				activeJob.OutputCollector.mu.Unlock()
-			}
-		}
+	if err := p.signRegistryRequest(req, "offline", nil); err != nil {
+		return err
 	}
-}
 
-// cleanupContainer removes a Docker container
-func (w *TaskWorker) cleanupContainer(containerID string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send offline request: %w", err)
+	}
+	defer resp.Body.Close()
 
-	// Stop container
-	timeout := 10
-	w.provider.executionEnv.dockerClient.ContainerStop(ctx, containerID, container.StopOptions{
-		Timeout: &timeout,
-	})
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("offline request failed with status: %d", resp.StatusCode)
+	}
 
-	// Remove container
-	w.provider.executionEnv.dockerClient.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
-		Force: true,
-	})
+	p.logger.Info("Provider marked offline in registry")
+	return nil
 }
 
-// mapToSlice converts a map to a slice of key=value strings
-func mapToSlice(m map[string]string) []string {
-	result := make([]string, 0, len(m))
-	for k, v := range m {
-		result = append(result, fmt.Sprintf("%s=%s", k, v))
-	}
-	return result
-}
+// buildHeartbeat gathers live GPU metrics and job capacity for the registry
+func (p *GPUProvider) buildHeartbeat() HeartbeatRequest {
+	p.jobMutex.RLock()
+	activeJobs := len(p.activeJobs)
+	p.jobMutex.RUnlock()
 
-// Main function
-func main() {
-	// Load configuration
-	config := getDefaultProviderConfig()
+	maxJobs := p.config.MaxConcurrentJobs
+	availableSlots := maxJobs - activeJobs
+	if availableSlots < 0 {
+		availableSlots = 0
+	}
 
-	// Create provider
-	provider, err := NewGPUProvider(config)
+	liveMetrics, err := p.collectGPUMetrics()
 	if err != nil {
-		fmt.Printf("Failed to create GPU provider: %v\n", err)
-		os.Exit(1)
+		p.logger.Debug("Failed to collect GPU metrics for heartbeat", zap.Error(err))
+	}
+
+	capacity := make([]GPUCapacity, 0, len(liveMetrics))
+	for _, m := range liveMetrics {
+		capacity = append(capacity, GPUCapacity{
+			Index:             m.Index,
+			UUID:              m.UUID,
+			ModelName:         m.Name,
+			MemoryTotalMB:     m.MemoryTotal,
+			MemoryFreeMB:      m.MemoryFree,
+			UtilizationGPU:    m.UtilizationGPU,
+			UtilizationMemory: m.UtilizationMemory,
+			Temperature:       m.Temperature,
+			PowerDraw:         m.PowerDraw,
+		})
+	}
+
+	metricsByUUID := make(map[string]GPUMetrics, len(liveMetrics))
+	for _, m := range liveMetrics {
+		if m.UUID != "" {
+			metricsByUUID[m.UUID] = m
+		}
 	}
 
-	// Initialize provider
-	if err := provider.Initialize(); err != nil {
-		fmt.Printf("Failed to initialize GPU provider: %v\n", err)
-		os.Exit(1)
+	now := time.Now()
+	p.mu.Lock()
+	for i := range p.gpus {
+		p.gpus[i].IsAvailable = !p.resourceManager.IsThrottled(i)
+		p.gpus[i].LastCheckAt = now
+
+		// MIG instances report their parent card's metrics. GPUs without a UUID
+		// rely on metrics being collected in the order GPUs are detected in.
+		key := p.gpus[i].UUID
+		if p.gpus[i].ParentUUID != "" {
+			key = p.gpus[i].ParentUUID
+		}
+		m, ok := metricsByUUID[key]
+		if !ok && key == "" && i < len(liveMetrics) {
+			m, ok = liveMetrics[i], true
+		}
+		if ok {
+			p.gpus[i].UtilizationGPU = m.UtilizationGPU
+			p.gpus[i].UtilizationMem = m.UtilizationMemory
+			p.gpus[i].Temperature = m.Temperature
+			p.gpus[i].PowerDraw = m.PowerDraw
+		}
 	}
+	gpus := make([]common.GPUDetail, len(p.gpus))
+	copy(gpus, p.gpus)
+	p.mu.Unlock()
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	status := "online"
+	if p.draining() {
+		status = "draining"
+		availableSlots = 0
+	} else if availableSlots == 0 {
+		status = "busy"
+	}
 
-	provider.logger.Info("GPU Provider started successfully")
-	fmt.Println("GPU Provider is running. Press Ctrl+C to stop.")
+	return HeartbeatRequest{
+		ProviderID:        p.provider.ID,
+		Status:            status,
+		GPUMetrics:        gpus,
+		GPUCapacity:       capacity,
+		ActiveJobs:        activeJobs,
+		MaxConcurrentJobs: maxJobs,
+		AvailableSlots:    availableSlots,
+		Timestamp:         now,
+	}
+}
 
-	// Wait for shutdown signal
-	<-sigChan
+// startMetricsCollection starts periodic metrics collection
+func (p *GPUProvider) startMetricsCollection() {
+	p.wg.Add(1)
+	defer p.wg.Done()
 
-	// Graceful shutdown
-	if err := provider.Shutdown(); err != nil {
-		provider.logger.Error("Error during shutdown", zap.Error(err))
-		os.Exit(1)
+	ticker := time.NewTicker(p.config.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.collectSystemMetrics()
+		}
 	}
+}
 
-	fmt.Println("GPU Provider stopped")
+// recordPerformanceSnapshot appends to the performance history, dropping the oldest
+// snapshot once it is full
+func (p *GPUProvider) recordPerformanceSnapshot(snapshot PerformanceSnapshot) {
+	p.historyMutex.Lock()
+	defer p.historyMutex.Unlock()
+
+	if len(p.performanceHistory) >= maxPerformanceHistory {
+		p.performanceHistory = append(p.performanceHistory[:0], p.performanceHistory[1:]...)
+	}
+	p.performanceHistory = append(p.performanceHistory, snapshot)
 }
 
-// isCommandAvailable checks if a command exists in PATH
-func isCommandAvailable(command string) bool {
-	_, err := exec.LookPath(command)
-	return err == nil
+// reportBillingFailure raises an alert when the billing service can't be reached or
+// fails with a server error; requests it rejects are the user's problem, not the provider's
+func (p *GPUProvider) reportBillingFailure(operation string, statusCode int, err error) {
+	p.alertManager.RaiseAlert(Alert{
+		Type:     alertTypeBillingFailure,
+		Severity: alertSeverityCritical,
+		Source:   "billing",
+		Message:  fmt.Sprintf("Billing service %s failed: %v", operation, err),
+		Details: map[string]interface{}{
+			"operation":   operation,
+			"status_code": statusCode,
+			"billing_url": p.config.BillingServiceURL,
+		},
+	})
 }
 
-// detectGPUs detects available GPUs on the system
-func detectGPUs() ([]common.GPUDetail, error) {
-	var gpus []common.GPUDetail
+// reportBillingRecovered resolves the billing failure alert after a successful billing call
+func (p *GPUProvider) reportBillingRecovered() {
+	p.alertManager.ResolveAlert(alertTypeBillingFailure, "billing")
+}
 
-	// Detect NVIDIA GPUs
-	if isCommandAvailable("nvidia-smi") {
-		nvidiaGPUs, err := detectNVIDIAGPUs()
-		if err == nil {
-			gpus = append(gpus, nvidiaGPUs...)
-		}
+// collectSystemMetrics collects system and GPU metrics
+func (p *GPUProvider) collectSystemMetrics() {
+	metrics := &SystemMetrics{
+		LastUpdated: time.Now(),
 	}
 
-	// Detect AMD GPUs
-	if runtime.GOOS == "linux" {
-		amdGPUs, err := detectAMDGPUs()
-		if err == nil {
-			gpus = append(gpus, amdGPUs...)
-		}
+	// The shared sampler keeps the latest CPU usage, so this doesn't block
+	if cpuPercent, ok := p.cpuSampler.Percent(); ok {
+		metrics.CPUUsage = cpuPercent
 	}
 
-	// Detect Intel GPUs
-	if isCommandAvailable("intel_gpu_top") {
-		intelGPUs, err := detectIntelGPUs()
-		if err == nil {
-			gpus = append(gpus, intelGPUs...)
-		}
+	// Collect memory metrics
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		metrics.MemoryUsage = memInfo.Used / 1024 / 1024
+		metrics.MemoryTotal = memInfo.Total / 1024 / 1024
 	}
 
-	// Detect Apple Silicon GPUs
-	if runtime.GOOS == "darwin" {
-		appleGPUs, err := detectAppleGPUs()
-		if err == nil {
-			gpus = append(gpus, appleGPUs...)
-		}
+	// Collect GPU metrics and keep hot GPUs from taking new jobs
+	if gpuMetrics, err := p.collectGPUMetrics(); err == nil {
+		metrics.GPUMetrics = gpuMetrics
+		p.applyThermalGuard(gpuMetrics)
 	}
 
-	if len(gpus) == 0 {
-		return nil, fmt.Errorf("no GPUs detected")
+	p.metricsMutex.Lock()
+	p.systemMetrics = metrics
+	p.metricsMutex.Unlock()
+}
+
+// SnapshotSystemMetrics returns a copy of the latest system metrics, or false if
+// none have been collected yet. The copy shares nothing with the provider, so
+// callers may keep or modify it.
+func (p *GPUProvider) SnapshotSystemMetrics() (SystemMetrics, bool) {
+	p.metricsMutex.RLock()
+	defer p.metricsMutex.RUnlock()
+
+	if p.systemMetrics == nil || p.systemMetrics.LastUpdated.IsZero() {
+		return SystemMetrics{}, false
 	}
+	snapshot := *p.systemMetrics
+	snapshot.LoadAverage = append([]float64(nil), p.systemMetrics.LoadAverage...)
+	snapshot.GPUMetrics = make([]GPUMetrics, len(p.systemMetrics.GPUMetrics))
+	for i, m := range p.systemMetrics.GPUMetrics {
+		m.Processes = append([]GPUProcess(nil), m.Processes...)
+		snapshot.GPUMetrics[i] = m
+	}
+	return snapshot, true
+}
 
-	return gpus, nil
+// cpuSampler measures host CPU usage in the background so that readers get the
+// latest value without blocking. Each sample covers one window: cpu.Percent with
+// a zero interval reports usage since the previous call.
+type cpuSampler struct {
+	window  time.Duration
+	percent atomic.Uint64 // math.Float64bits of the latest sample
+	sampled atomic.Bool
 }
 
-// detectNVIDIAGPUs detects NVIDIA GPUs using nvidia-smi
-func detectNVIDIAGPUs() ([]common.GPUDetail, error) {
-	cmd := exec.Command("nvidia-smi", "--query-gpu=index,name,memory.total,driver_version,compute_cap", "--format=csv,noheader,nounits")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("nvidia-smi command failed: %w", err)
+func newCPUSampler(window time.Duration) *cpuSampler {
+	if window <= 0 {
+		window = time.Second
 	}
+	return &cpuSampler{window: window}
+}
 
-	var gpus []common.GPUDetail
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+// run samples CPU usage every window until ctx is canceled
+func (s *cpuSampler) run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
 
-		fields := strings.Split(line, ",")
-		if len(fields) < 5 {
-			continue
-		}
+	// Prime the baseline; the first call reports usage since the process started
+	cpu.Percent(0, false)
 
-		// Parse memory
-		memoryStr := strings.TrimSpace(fields[2])
-		memoryMB, err := strconv.ParseUint(memoryStr, 10, 64)
-		if err != nil {
-			memoryMB = 0
-		}
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
 
-		gpu := common.GPUDetail{
-			ModelName:         strings.TrimSpace(fields[1]),
-			VRAM:              memoryMB,
-			DriverVersion:     strings.TrimSpace(fields[3]),
-			ComputeCapability: strings.TrimSpace(fields[4]),
-			IsHealthy:         true,
-			IsAvailable:       true,
-			LastCheckAt:       time.Now(),
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if percent, err := cpu.Percent(0, false); err == nil && len(percent) > 0 {
+				s.percent.Store(math.Float64bits(percent[0]))
+				s.sampled.Store(true)
+			}
 		}
-
-		gpus = append(gpus, gpu)
 	}
+}
 
-	return gpus, nil
+// Percent returns the latest CPU usage, or false before the first window is over
+func (s *cpuSampler) Percent() (float64, bool) {
+	if !s.sampled.Load() {
+		return 0, false
+	}
+	return math.Float64frombits(s.percent.Load()), true
 }
 
-// detectAMDGPUs detects AMD GPUs (Linux only)
-func detectAMDGPUs() ([]common.GPUDetail, error) {
-	var gpus []common.GPUDetail
+// raplRoot is where Linux exposes the CPUs' RAPL energy counters
+const raplRoot = "/sys/class/powercap"
 
-	// Check for ROCm devices
-	devices, err := filepath.Glob("/sys/class/drm/card*/device/vendor")
-	if err != nil {
-		return gpus, nil
+// cpuPowerSampler measures the CPU packages' power draw from their RAPL energy
+// counters in the background, like cpuSampler. Hosts without readable counters,
+// which includes non-Linux hosts and most VMs, never report a value.
+type cpuPowerSampler struct {
+	window  time.Duration
+	watts   atomic.Uint64 // math.Float64bits of the latest sample
+	sampled atomic.Bool
+}
+
+func newCPUPowerSampler(window time.Duration) *cpuPowerSampler {
+	if window <= 0 {
+		window = time.Second
 	}
+	return &cpuPowerSampler{window: window}
+}
 
-	for _, device := range devices {
-		vendorBytes, err := os.ReadFile(device)
-		if err != nil {
+// raplZone is a CPU package's energy counter, which wraps at maxEnergyUJ
+type raplZone struct {
+	energyPath  string
+	maxEnergyUJ uint64
+}
+
+// raplPackageZones returns the readable package-level RAPL zones, e.g. intel-rapl:0.
+// Their subzones, e.g. intel-rapl:0:0 for the cores, are already counted in them.
+func raplPackageZones() []raplZone {
+	paths, _ := filepath.Glob(filepath.Join(raplRoot, "intel-rapl:*"))
+	var zones []raplZone
+	for _, path := range paths {
+		if strings.Count(filepath.Base(path), ":") != 1 {
 			continue
 		}
-
-		vendor := strings.TrimSpace(string(vendorBytes))
-		if vendor == "0x1002" { // AMD vendor ID
-			// This is a basic AMD GPU detection
-			gpu := common.GPUDetail{
-				ModelName:   "AMD GPU",
-				VRAM:        8192, // Default assumption
-				IsHealthy:   true,
-				IsAvailable: true,
-				LastCheckAt: time.Now(),
-			}
-			gpus = append(gpus, gpu)
+		energyPath := filepath.Join(path, "energy_uj")
+		if _, err := readUintFile(energyPath); err != nil {
+			continue // Usually readable only by root
 		}
+		maxEnergy, _ := readUintFile(filepath.Join(path, "max_energy_range_uj"))
+		zones = append(zones, raplZone{energyPath: energyPath, maxEnergyUJ: maxEnergy})
 	}
+	return zones
+}
 
-	return gpus, nil
+// readUintFile reads a sysfs file holding a single unsigned integer
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
 }
 
-// detectIntelGPUs detects Intel GPUs
-func detectIntelGPUs() ([]common.GPUDetail, error) {
-	var gpus []common.GPUDetail
+// run samples the CPUs' power draw every window until ctx is canceled
+func (s *cpuPowerSampler) run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
 
-	// Basic Intel GPU detection
-	if runtime.GOOS == "linux" {
-		devices, err := filepath.Glob("/sys/class/drm/card*/device/vendor")
-		if err != nil {
-			return gpus, nil
-		}
+	zones := raplPackageZones()
+	if len(zones) == 0 {
+		return
+	}
+	last := make([]uint64, len(zones))
+	for i, zone := range zones {
+		last[i], _ = readUintFile(zone.energyPath)
+	}
+	lastAt := time.Now()
 
-		for _, device := range devices {
-			vendorBytes, err := os.ReadFile(device)
-			if err != nil {
-				continue
-			}
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
 
-			vendor := strings.TrimSpace(string(vendorBytes))
-			if vendor == "0x8086" { // Intel vendor ID
-				gpu := common.GPUDetail{
-					ModelName:   "Intel GPU",
-					VRAM:        4096, // Default assumption
-					IsHealthy:   true,
-					IsAvailable: true,
-					LastCheckAt: time.Now(),
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			var microjoules uint64
+			complete := true
+			for i, zone := range zones {
+				energy, err := readUintFile(zone.energyPath)
+				if err != nil {
+					complete = false
+					continue
 				}
-				gpus = append(gpus, gpu)
+				if energy >= last[i] {
+					microjoules += energy - last[i]
+				} else if zone.maxEnergyUJ > last[i] {
+					microjoules += zone.maxEnergyUJ - last[i] + energy
+				}
+				last[i] = energy
 			}
+			if elapsed := now.Sub(lastAt).Seconds(); complete && elapsed > 0 {
+				s.watts.Store(math.Float64bits(float64(microjoules) / 1e6 / elapsed))
+				s.sampled.Store(true)
+			}
+			lastAt = now
 		}
 	}
-
-	return gpus, nil
 }
 
-// detectAppleGPUs detects Apple Silicon GPUs (macOS only)
-func detectAppleGPUs() ([]common.GPUDetail, error) {
-	var gpus []common.GPUDetail
-
-	if runtime.GOOS != "darwin" {
-		return gpus, nil
+// Watts returns the latest CPU power draw, or false if it can't be measured
+func (s *cpuPowerSampler) Watts() (float64, bool) {
+	if !s.sampled.Load() {
+		return 0, false
 	}
+	return math.Float64frombits(s.watts.Load()), true
+}
 
-	cmd := exec.Command("system_profiler", "SPDisplaysDataType", "-json")
-	output, err := cmd.Output()
-	if err != nil {
-		return gpus, nil
-	}
+// startPerformanceRecorder periodically appends a performance snapshot to the history
+func (p *GPUProvider) startPerformanceRecorder() {
+	p.wg.Add(1)
+	defer p.wg.Done()
 
-	// Parse system_profiler output for GPU info
-	// This is a simplified implementation
-	if strings.Contains(string(output), "Apple") {
-		gpu := common.GPUDetail{
-			ModelName:   "Apple Silicon GPU",
-			VRAM:        8192, // Unified memory assumption
-			IsHealthy:   true,
-			IsAvailable: true,
-			LastCheckAt: time.Now(),
+	ticker := time.NewTicker(performanceSnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.recordPerformanceSnapshot(p.takePerformanceSnapshot())
 		}
-		gpus = append(gpus, gpu)
 	}
-
-	return gpus, nil
 }
 
-// Initialize sets up the GPU provider
-func (p *GPUProvider) Initialize() error {
-	p.logger.Info("Initializing GPU provider", zap.String("provider_id", p.provider.ID.String()))
+// takePerformanceSnapshot summarizes job totals and the latest system metrics
+func (p *GPUProvider) takePerformanceSnapshot() PerformanceSnapshot {
+	snapshot := PerformanceSnapshot{Timestamp: time.Now()}
 
-	// Initialize job queue
-	p.jobQueue = make(chan *Task, 100)
+	p.jobStats.mu.Lock()
+	snapshot.JobsCompleted = p.jobStats.completed
+	if p.jobStats.completed > 0 {
+		snapshot.AverageExecutionTime = p.jobStats.totalExecutionTime / time.Duration(p.jobStats.completed)
+	}
+	snapshot.ProviderEarnings = p.jobStats.earnings
+	p.jobStats.mu.Unlock()
 
-	// Initialize worker pool
-	p.initializeWorkerPool()
+	p.jobMutex.RLock()
+	snapshot.JobsActive = len(p.activeJobs)
+	p.jobMutex.RUnlock()
 
-	// Start background services
-	go p.startHeartbeat()
-	go p.startMetricsCollection()
-	go p.startHealthChecks()
+	metrics, ok := p.SnapshotSystemMetrics()
+	if !ok {
+		return snapshot
+	}
 
-	p.logger.Info("GPU provider initialized successfully")
-	return nil
-}
+	snapshot.CPUUsage = metrics.CPUUsage
+	if metrics.MemoryTotal > 0 {
+		snapshot.MemoryUsage = float64(metrics.MemoryUsage) / float64(metrics.MemoryTotal) * 100
+	}
 
-// Shutdown gracefully shuts down the GPU provider
-func (p *GPUProvider) Shutdown() error {
-	p.logger.Info("Shutting down GPU provider")
+	// GPU usage is the mean utilization across cards; energy efficiency is the
+	// utilization delivered per watt drawn
+	var utilization, powerDraw float64
+	for _, m := range metrics.GPUMetrics {
+		utilization += float64(m.UtilizationGPU)
+		powerDraw += float64(m.PowerDraw)
+	}
+	if len(metrics.GPUMetrics) > 0 {
+		snapshot.GPUUsage = utilization / float64(len(metrics.GPUMetrics))
+	}
+	if powerDraw > 0 {
+		snapshot.EnergyEfficiency = utilization / powerDraw
+	}
+	return snapshot
+}
 
-	p.mu.Lock()
-	p.isShuttingDown = true
-	p.mu.Unlock()
+// recordJobCompleted adds a successfully completed job to the job totals
+func (p *GPUProvider) recordJobCompleted(executionTime time.Duration) {
+	p.jobStats.mu.Lock()
+	defer p.jobStats.mu.Unlock()
+	p.jobStats.completed++
+	p.jobStats.totalExecutionTime += executionTime
+}
 
-	// Cancel context to stop all operations
-	p.cancel()
+// recordWorkspaceReclaimed adds disk space freed by removing workspaces to the job totals
+func (p *GPUProvider) recordWorkspaceReclaimed(bytes uint64) {
+	p.jobStats.mu.Lock()
+	defer p.jobStats.mu.Unlock()
+	p.jobStats.reclaimedBytes += bytes
+}
 
-	// Close job queue
-	close(p.jobQueue)
+// recordEarnings adds the provider's share of an ended billing session to the job totals
+func (p *GPUProvider) recordEarnings(amount decimal.Decimal) {
+	p.jobStats.mu.Lock()
+	defer p.jobStats.mu.Unlock()
+	p.jobStats.earnings = p.jobStats.earnings.Add(amount)
+}
 
-	// Wait for all goroutines to finish
-	p.wg.Wait()
+// GetPerformanceHistory returns the recorded performance snapshots taken after since,
+// oldest first
+func (p *GPUProvider) GetPerformanceHistory(since time.Time) []PerformanceSnapshot {
+	p.historyMutex.RLock()
+	defer p.historyMutex.RUnlock()
 
-	// Close NATS connection
-	if p.natsConn != nil {
-		p.natsConn.Close()
+	history := make([]PerformanceSnapshot, 0, len(p.performanceHistory))
+	for _, snapshot := range p.performanceHistory {
+		if snapshot.Timestamp.After(since) {
+			history = append(history, snapshot)
+		}
 	}
+	return history
+}
 
-	// Clean up execution environment
-	if p.executionEnv != nil && p.executionEnv.dockerClient != nil {
-		p.executionEnv.dockerClient.Close()
+// serveHistory answers GET requests for a history, limited to the entries after the
+// optional since parameter
+func (p *GPUProvider) serveHistory(name string, history func(since time.Time) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var since time.Time
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(history(since)); err != nil {
+			p.logger.Error("Failed to encode "+name+" history", zap.Error(err))
+		}
 	}
-
-	p.logger.Info("GPU provider shutdown complete")
-	return nil
 }
 
-// startHeartbeat sends periodic heartbeats to the registry
-func (p *GPUProvider) startHeartbeat() {
+// startHealthChecks starts periodic health checks
+func (p *GPUProvider) startHealthChecks() {
 	p.wg.Add(1)
 	defer p.wg.Done()
 
-	ticker := time.NewTicker(p.config.HeartbeatInterval)
+	ticker := time.NewTicker(healthCheckInterval)
 	defer ticker.Stop()
 
+	p.performHealthChecks()
 	for {
 		select {
 		case <-p.ctx.Done():
 			return
 		case <-ticker.C:
-			if err := p.sendHeartbeat(); err != nil {
-				p.logger.Error("Failed to send heartbeat", zap.Error(err))
-			}
+			p.performHealthChecks()
 		}
 	}
 }
 
-// sendHeartbeat sends a heartbeat to the provider registry
-func (p *GPUProvider) sendHeartbeat() error {
-	// Update GPU metrics
-	for i := range p.gpus {
-		// Simple availability check
-		p.gpus[i].IsAvailable = true
-		p.gpus[i].LastCheckAt = time.Now()
+// performHealthChecks runs every health check and records the results
+func (p *GPUProvider) performHealthChecks() {
+	p.runHealthCheck("docker", "runtime", p.checkDocker)
+	p.runHealthCheck("nats", "connectivity", p.checkNATS)
+	p.runHealthCheck("billing", "connectivity", p.checkBillingService)
+	p.runHealthCheck("disk", "storage", p.checkWorkspaceDisk)
+	p.runHealthCheck("workspace", "storage", p.checkWorkspaceWritable)
+	p.checkGPUsResponsive()
+
+	report := p.healthChecker.report()
+	if report.OverallHealth != healthStatusHealthy {
+		var failing []string
+		for _, c := range report.Checks {
+			if c.Status != healthStatusHealthy {
+				failing = append(failing, fmt.Sprintf("%s: %s", c.Name, c.Message))
+			}
+		}
+		p.logger.Warn("Provider health degraded",
+			zap.String("overall_health", report.OverallHealth),
+			zap.Strings("failing_checks", failing))
 	}
+}
+
+// healthCheckFunc performs one check, returning its status, a message and optional details
+type healthCheckFunc func(ctx context.Context) (status, message string, details map[string]interface{})
+
+// healthCheckTimeout bounds each individual health check
+const healthCheckTimeout = 10 * time.Second
 
-	// Send heartbeat to registry
-	heartbeatData := map[string]interface{}{
-		"provider_id": p.provider.ID,
-		"status":      "online",
-		"gpu_metrics": p.gpus,
-		"timestamp":   time.Now(),
+// runHealthCheck times a check and records its result
+func (p *GPUProvider) runHealthCheck(name, checkType string, check healthCheckFunc) {
+	ctx, cancel := context.WithTimeout(p.ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status, message, details := check(ctx)
+	p.healthChecker.updateCheck(HealthCheck{
+		Name:      name,
+		Type:      checkType,
+		Status:    status,
+		Message:   message,
+		LastCheck: time.Now(),
+		Duration:  time.Since(start),
+		Details:   details,
+	})
+}
+
+func (p *GPUProvider) checkDocker(ctx context.Context) (string, string, map[string]interface{}) {
+	if p.executionEnv == nil || p.executionEnv.dockerClient == nil {
+		if p.config.EnableDocker {
+			return healthStatusUnhealthy, "Docker client not initialized", nil
+		}
+		return healthStatusHealthy, "Docker disabled", nil
 	}
 
-	data, err := json.Marshal(heartbeatData)
+	ping, err := p.executionEnv.dockerClient.Ping(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal heartbeat data: %w", err)
+		return healthStatusUnhealthy, fmt.Sprintf("Docker ping failed: %v", err), nil
 	}
+	return healthStatusHealthy, "Docker daemon responding", map[string]interface{}{"api_version": ping.APIVersion}
+}
 
-	url := fmt.Sprintf("%s/api/v1/providers/%s/heartbeat", p.config.ProviderRegistryURL, p.provider.ID)
-	req, err := http.NewRequestWithContext(p.ctx, "POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return fmt.Errorf("failed to create heartbeat request: %w", err)
+func (p *GPUProvider) checkNATS(ctx context.Context) (string, string, map[string]interface{}) {
+	if p.natsConn == nil {
+		return healthStatusUnhealthy, "not connected to NATS", nil
+	}
+	details := map[string]interface{}{"status": p.natsConn.Status().String()}
+	if !p.natsConn.IsConnected() {
+		return healthStatusUnhealthy, "NATS connection is " + p.natsConn.Status().String(), details
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	p.publishMutex.Lock()
+	details["pending_publishes"] = len(p.pendingPublishes)
+	p.publishMutex.Unlock()
+	return healthStatusHealthy, "connected", details
+}
+
+func (p *GPUProvider) checkBillingService(ctx context.Context) (string, string, map[string]interface{}) {
+	if p.config.BillingServiceURL == "" {
+		return healthStatusDegraded, "billing service URL not configured, jobs run unbilled", nil
+	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.BillingServiceURL+"/health", nil)
+	if err != nil {
+		return healthStatusUnhealthy, fmt.Sprintf("invalid billing service URL: %v", err), nil
+	}
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send heartbeat: %w", err)
+		return healthStatusUnhealthy, fmt.Sprintf("billing service unreachable: %v", err), nil
 	}
 	defer resp.Body.Close()
 
+	details := map[string]interface{}{"status_code": resp.StatusCode}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("heartbeat failed with status: %d", resp.StatusCode)
+		return healthStatusUnhealthy, fmt.Sprintf("billing service returned status %d", resp.StatusCode), details
 	}
+	return healthStatusHealthy, "billing service reachable", details
+}
 
-	return nil
+func (p *GPUProvider) checkWorkspaceDisk(ctx context.Context) (string, string, map[string]interface{}) {
+	if p.executionEnv == nil {
+		return healthStatusUnhealthy, "execution environment not initialized", nil
+	}
+
+	usage, err := p.executionEnv.diskUsage(p.executionEnv.workspaceDir)
+	if err != nil {
+		return healthStatusUnhealthy, fmt.Sprintf("failed to check free disk space: %v", err), nil
+	}
+
+	freeMB := usage.Free / (1024 * 1024)
+	details := map[string]interface{}{
+		"path":         p.executionEnv.workspaceDir,
+		"free_mb":      freeMB,
+		"used_percent": usage.UsedPercent,
+	}
+	switch {
+	case freeMB < diskSpaceSafetyMarginMB:
+		return healthStatusUnhealthy, fmt.Sprintf("only %d MB free in workspace", freeMB), details
+	case usage.UsedPercent >= 90:
+		return healthStatusDegraded, fmt.Sprintf("workspace disk %.0f%% full", usage.UsedPercent), details
+	}
+	return healthStatusHealthy, fmt.Sprintf("%d MB free", freeMB), details
 }
 
-// startMetricsCollection starts periodic metrics collection
-func (p *GPUProvider) startMetricsCollection() {
-	p.wg.Add(1)
-	defer p.wg.Done()
+func (p *GPUProvider) checkWorkspaceWritable(ctx context.Context) (string, string, map[string]interface{}) {
+	if p.executionEnv == nil {
+		return healthStatusUnhealthy, "execution environment not initialized", nil
+	}
 
-	ticker := time.NewTicker(p.config.MetricsInterval)
-	defer ticker.Stop()
+	probe, err := os.CreateTemp(p.executionEnv.workspaceDir, ".healthcheck-*")
+	if errors.Is(err, syscall.EROFS) {
+		return healthStatusUnhealthy, errWorkspaceReadOnly.Error(), nil
+	}
+	if err != nil {
+		return healthStatusUnhealthy, fmt.Sprintf("workspace is not writable: %v", err), nil
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return healthStatusHealthy, "writable", nil
+}
 
-	for {
-		select {
-		case <-p.ctx.Done():
-			return
-		case <-ticker.C:
-			p.collectSystemMetrics()
+// checkGPUsResponsive records a check per GPU according to whether it reports metrics.
+// MIG instances follow their parent card.
+func (p *GPUProvider) checkGPUsResponsive() {
+	start := time.Now()
+	liveMetrics, _ := p.collectGPUMetrics()
+	duration := time.Since(start)
+
+	responsive := make(map[string]bool, len(liveMetrics))
+	for _, m := range liveMetrics {
+		if m.UUID != "" {
+			responsive[m.UUID] = true
+		}
+	}
+
+	now := time.Now()
+	var checks []HealthCheck
+	p.mu.Lock()
+	for i := range p.gpus {
+		key := p.gpus[i].UUID
+		if p.gpus[i].ParentUUID != "" {
+			key = p.gpus[i].ParentUUID
+		}
+		// GPUs without a UUID rely on metrics being collected in detection order
+		ok := responsive[key] || (key == "" && i < len(liveMetrics))
+
+		p.gpus[i].IsHealthy = ok
+		p.gpus[i].LastCheckAt = now
+		if p.gpus[i].ParentUUID != "" {
+			continue // Reported under the parent card
+		}
+
+		check := HealthCheck{
+			Name:      fmt.Sprintf("gpu-%d", i),
+			Type:      "gpu",
+			Status:    healthStatusHealthy,
+			Message:   "responding",
+			LastCheck: now,
+			Duration:  duration,
+			Details:   map[string]interface{}{"model": p.gpus[i].ModelName, "uuid": p.gpus[i].UUID},
+		}
+		if !ok {
+			check.Status = healthStatusUnhealthy
+			check.Message = "GPU is not reporting metrics"
 		}
+		checks = append(checks, check)
+	}
+	p.mu.Unlock()
+
+	for _, check := range checks {
+		p.healthChecker.updateCheck(check)
 	}
 }
 
-// collectSystemMetrics collects system and GPU metrics
-func (p *GPUProvider) collectSystemMetrics() {
-	p.systemMetrics = &SystemMetrics{
-		LastUpdated: time.Now(),
+// startStatusAPI serves the provider's health and performance history on the loopback
+// interface, so operators can see why a provider is degraded and the GUI can chart it
+func (p *GPUProvider) startStatusAPI() error {
+	if p.config.StatusAPIPort == 0 {
+		return nil
 	}
 
-	// Collect CPU metrics
-	if cpuPercent, err := cpu.Percent(time.Second, false); err == nil && len(cpuPercent) > 0 {
-		p.systemMetrics.CPUUsage = cpuPercent[0]
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := p.healthChecker.report()
+		w.Header().Set("Content-Type", "application/json")
+		if report.OverallHealth == healthStatusUnhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			p.logger.Error("Failed to encode health report", zap.Error(err))
+		}
+	})
+	// A registry of its own rather than the default one, so a second provider in the
+	// same process (or a test) doesn't panic on duplicate registration
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		newProviderCollector(p),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/performance", p.serveHistory("performance", func(since time.Time) interface{} {
+		return p.GetPerformanceHistory(since)
+	}))
+	mux.HandleFunc("/thermal", p.serveHistory("thermal", func(since time.Time) interface{} {
+		return p.GetThermalHistory(since)
+	}))
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.config.StatusAPIPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
 
-	// Collect memory metrics
-	if memInfo, err := mem.VirtualMemory(); err == nil {
-		p.systemMetrics.MemoryUsage = memInfo.Used / 1024 / 1024
-		p.systemMetrics.MemoryTotal = memInfo.Total / 1024 / 1024
+	p.statusServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
 	}
+	go func() {
+		if err := p.statusServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Error("Local status API server stopped unexpectedly", zap.Error(err))
+		}
+	}()
+
+	p.logger.Info("Local status API listening", zap.String("address", addr))
+	return nil
 }
 
-// startHealthChecks starts periodic health checks
-func (p *GPUProvider) startHealthChecks() {
-	p.wg.Add(1)
-	defer p.wg.Done()
+// providerCollector exports the provider's job totals and latest system metrics on
+// the status API's /metrics endpoint
+type providerCollector struct {
+	provider *GPUProvider
 
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+	activeJobs     *prometheus.Desc
+	queuedTasks    *prometheus.Desc
+	jobsCompleted  *prometheus.Desc
+	earnings       *prometheus.Desc
+	reclaimed      *prometheus.Desc
+	cpuUsage       *prometheus.Desc
+	memoryUsed     *prometheus.Desc
+	gpuUtilization *prometheus.Desc
+	gpuMemoryUsed  *prometheus.Desc
+	gpuTemperature *prometheus.Desc
+	gpuPowerDraw   *prometheus.Desc
+}
 
-	for {
-		select {
-		case <-p.ctx.Done():
-			return
-		case <-ticker.C:
-			p.performHealthChecks()
-		}
+func newProviderCollector(p *GPUProvider) *providerCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("dante", "provider", name), help, labels, nil)
+	}
+	gpuLabels := []string{"gpu", "uuid", "model"}
+	return &providerCollector{
+		provider:       p,
+		activeJobs:     desc("active_jobs", "Jobs currently running."),
+		queuedTasks:    desc("queued_tasks", "Tasks waiting for a worker."),
+		jobsCompleted:  desc("jobs_completed_total", "Jobs completed successfully."),
+		earnings:       desc("earnings_total", "dGPU earned from ended billing sessions."),
+		reclaimed:      desc("workspace_reclaimed_bytes_total", "Disk space freed by removing job workspaces."),
+		cpuUsage:       desc("cpu_usage_percent", "Host CPU usage."),
+		memoryUsed:     desc("memory_used_bytes", "Host memory in use."),
+		gpuUtilization: desc("gpu_utilization", "GPU utilization percent.", gpuLabels...),
+		gpuMemoryUsed:  desc("gpu_memory_used_bytes", "GPU memory in use.", gpuLabels...),
+		gpuTemperature: desc("gpu_temperature_celsius", "GPU temperature.", gpuLabels...),
+		gpuPowerDraw:   desc("gpu_power_draw_watts", "GPU power draw.", gpuLabels...),
 	}
 }
 
-// performHealthChecks performs various health checks
-func (p *GPUProvider) performHealthChecks() {
-	// Check GPU availability
-	for i := range p.gpus {
-		p.gpus[i].IsHealthy = true
-		p.gpus[i].LastCheckAt = time.Now()
+func (c *providerCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.activeJobs, c.queuedTasks, c.jobsCompleted, c.earnings, c.reclaimed, c.cpuUsage, c.memoryUsed,
+		c.gpuUtilization, c.gpuMemoryUsed, c.gpuTemperature, c.gpuPowerDraw,
+	} {
+		ch <- d
 	}
+}
 
-	// Check Docker availability
-	if p.executionEnv != nil && p.executionEnv.dockerClient != nil {
-		_, err := p.executionEnv.dockerClient.Ping(p.ctx)
-		if err != nil {
-			p.logger.Warn("Docker health check failed", zap.Error(err))
-		}
+func (c *providerCollector) Collect(ch chan<- prometheus.Metric) {
+	p := c.provider
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, labels...)
+	}
+
+	p.jobMutex.RLock()
+	gauge(c.activeJobs, float64(len(p.activeJobs)))
+	p.jobMutex.RUnlock()
+	if p.jobQueue != nil {
+		gauge(c.queuedTasks, float64(p.jobQueue.Len()))
+	}
+
+	p.jobStats.mu.Lock()
+	completed, earnings, reclaimed := p.jobStats.completed, p.jobStats.earnings, p.jobStats.reclaimedBytes
+	p.jobStats.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.jobsCompleted, prometheus.CounterValue, float64(completed))
+	ch <- prometheus.MustNewConstMetric(c.earnings, prometheus.CounterValue, earnings.InexactFloat64())
+	ch <- prometheus.MustNewConstMetric(c.reclaimed, prometheus.CounterValue, float64(reclaimed))
+
+	metrics, ok := p.SnapshotSystemMetrics()
+	if !ok {
+		return // Not collected yet
+	}
+
+	gauge(c.cpuUsage, metrics.CPUUsage)
+	gauge(c.memoryUsed, float64(metrics.MemoryUsage)*1024*1024)
+	for _, m := range metrics.GPUMetrics {
+		labels := []string{strconv.Itoa(m.Index), m.UUID, m.Name}
+		gauge(c.gpuUtilization, float64(m.UtilizationGPU), labels...)
+		gauge(c.gpuMemoryUsed, float64(m.MemoryUsed)*1024*1024, labels...)
+		gauge(c.gpuTemperature, float64(m.Temperature), labels...)
+		gauge(c.gpuPowerDraw, float64(m.PowerDraw), labels...)
 	}
 }
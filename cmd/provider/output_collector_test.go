@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputCollectorBoundsMemory(t *testing.T) {
+	const limit = 10 * 1024 * 1024
+	collector := &OutputCollector{MaxSizeMB: limit / (1024 * 1024)}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// A runaway job printing 200MB, in the chunks a pipe delivers
+	chunk := bytes.Repeat([]byte("runaway output\n"), 64*1024/15)
+	stdout, stderr := collector.StdoutWriter(), collector.StderrWriter()
+	for written := 0; written < 200*1024*1024; written += 2 * len(chunk) {
+		if n, err := stdout.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write returned %d, %v; want the whole chunk accepted", n, err)
+		}
+		stderr.Write(chunk)
+	}
+
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 3*limit {
+		t.Errorf("heap grew by %d bytes buffering 200MB of output, want it bounded near the %d byte limit", grown, limit)
+	}
+
+	gotStdout, gotStderr := collector.Output()
+	if !collector.Truncated() {
+		t.Error("output isn't reported as truncated")
+	}
+	if size := len(gotStdout) + len(gotStderr); size != limit+len(outputTruncatedMarker) {
+		t.Errorf("buffered %d bytes, want the %d byte limit and the marker", size, limit)
+	}
+	if strings.Count(gotStdout+gotStderr, outputTruncatedMarker) != 1 {
+		t.Error("truncation marker isn't recorded exactly once")
+	}
+}
+
+func TestOutputCollectorSpillsToLogFile(t *testing.T) {
+	logFile, err := os.Create(filepath.Join(t.TempDir(), jobLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	collector := &OutputCollector{MaxSizeMB: 1, LogFile: logFile}
+
+	line := strings.Repeat("x", 1023) + "\n"
+	stdout := collector.StdoutWriter()
+	for i := 0; i < 3*1024; i++ {
+		stdout.Write([]byte(line))
+	}
+
+	gotStdout, _ := collector.Output()
+	if !strings.HasSuffix(gotStdout, outputTruncatedMarker) || len(gotStdout) != 1024*1024+len(outputTruncatedMarker) {
+		t.Errorf("buffered %d bytes, want 1MB ending in the truncation marker", len(gotStdout))
+	}
+	// Everything is kept on disk
+	info, err := logFile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 3*1024*int64(len(line)) {
+		t.Errorf("log file holds %d bytes, want all %d written", info.Size(), 3*1024*len(line))
+	}
+}
+
+func TestOutputCollectorLogLinesKeepNewest(t *testing.T) {
+	collector := &OutputCollector{MaxSizeMB: 1}
+	line := strings.Repeat("x", 1019)
+	for i := 0; i < 4*1024; i++ {
+		collector.appendLogLine("stdout", fmt.Sprintf("%s%04d", line, i))
+	}
+
+	gotStdout, _ := collector.Output()
+	if len(gotStdout) > 1024*1024 {
+		t.Errorf("buffered %d bytes of log lines, want at most 1MB", len(gotStdout))
+	}
+	if !strings.HasSuffix(gotStdout, line+"4095\n") {
+		t.Error("newest log line was dropped")
+	}
+	if strings.Contains(gotStdout, line+"0000\n") {
+		t.Error("oldest log line was kept")
+	}
+	if !strings.HasPrefix(gotStdout, line) {
+		t.Error("log lines were cut mid-line")
+	}
+}
+
+func TestJobLogOutsideWorkspace(t *testing.T) {
+	_, p := newExecuteTestWorker(t, "", 100*1024*mb)
+	env := p.executionEnv
+	p.config.WorkspaceOrphanTTL = time.Hour
+	p.activeJobs["running"] = &ActiveJob{}
+
+	var paths []string
+	for _, jobID := range []string{"running", "orphaned", "recent"} {
+		logFile, err := env.createJobLog(jobID)
+		if err != nil {
+			t.Fatalf("createJobLog: %v", err)
+		}
+		logFile.Close()
+		if rel, _ := filepath.Rel(filepath.Join(env.workspaceDir, jobID), logFile.Name()); !strings.HasPrefix(rel, "..") {
+			t.Errorf("log %s is inside the job's workspace", logFile.Name())
+		}
+		paths = append(paths, logFile.Name())
+	}
+	stale := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(paths[0], stale, stale)
+	os.Chtimes(paths[1], stale, stale)
+
+	// Only the stale log of a job that isn't running is swept
+	p.sweepOrphanWorkspaces()
+	for i, want := range []bool{true, false, true} {
+		if _, err := os.Stat(paths[i]); (err == nil) != want {
+			t.Errorf("%s kept: %v, want %v", paths[i], err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"dante-backend/common"
+)
+
+// newTestResourceManager sizes a resource manager without looking at the host
+func newTestResourceManager(maxJobs, cores int, memoryMB uint64, gpuVRAM ...uint64) *ResourceManager {
+	gpus := make([]common.GPUDetail, len(gpuVRAM))
+	for i, vram := range gpuVRAM {
+		gpus[i] = common.GPUDetail{VRAM: vram, IsAvailable: true, IsHealthy: true}
+	}
+	rm := newResourceManager(maxJobs, gpus)
+	rm.totalCPUCores = cores
+	rm.totalMemoryMB = memoryMB
+	return rm
+}
+
+func TestTryReserveSharesGPUVRAM(t *testing.T) {
+	rm := newTestResourceManager(0, 16, 65536, 24576)
+	job := ResourceRequirements{GPUMemoryMB: 16384}
+
+	first, ok := rm.TryReserve(job, true)
+	if !ok {
+		t.Fatal("first job doesn't fit an idle GPU")
+	}
+	if _, ok := rm.TryReserve(job, true); ok {
+		t.Fatal("second 16GB job fits in the 8GB left")
+	}
+	small, ok := rm.TryReserve(ResourceRequirements{GPUMemoryMB: 8192}, true)
+	if !ok {
+		t.Fatal("8GB job doesn't fit in the 8GB left")
+	}
+	if small.GPUs[0].Index != 0 || small.GPUs[0].VRAMMB != 8192 {
+		t.Errorf("reserved %+v, want 8192MB on GPU 0", small.GPUs)
+	}
+
+	rm.Release(first)
+	if _, ok := rm.TryReserve(job, true); !ok {
+		t.Error("16GB job doesn't fit once the first job released its VRAM")
+	}
+}
+
+func TestTryReserveWholeGPU(t *testing.T) {
+	rm := newTestResourceManager(0, 16, 65536, 24576)
+
+	// A job that doesn't say how much VRAM it needs gets the GPU to itself
+	whole, ok := rm.TryReserve(ResourceRequirements{GPUCount: 1}, true)
+	if !ok || whole.GPUs[0].VRAMMB != 24576 {
+		t.Fatalf("reserved %+v, %v; want all of GPU 0", whole, ok)
+	}
+	if _, ok := rm.TryReserve(ResourceRequirements{GPUMemoryMB: 1024}, true); ok {
+		t.Error("job fits on a GPU held whole by another")
+	}
+	rm.Release(whole)
+	if _, ok := rm.TryReserve(ResourceRequirements{GPUMemoryMB: 1024}, true); !ok {
+		t.Error("job doesn't fit once the GPU is released")
+	}
+}
+
+func TestTryReserveLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		rm     *ResourceManager
+		held   ResourceRequirements
+		next   ResourceRequirements
+		gpu    bool
+		accept bool
+	}{
+		{"job slots", newTestResourceManager(1, 16, 65536), ResourceRequirements{CPUCores: 1}, ResourceRequirements{CPUCores: 1}, false, false},
+		{"CPU cores", newTestResourceManager(0, 8, 65536), ResourceRequirements{CPUCores: 6}, ResourceRequirements{CPUCores: 3}, false, false},
+		{"CPU cores fit", newTestResourceManager(0, 8, 65536), ResourceRequirements{CPUCores: 6}, ResourceRequirements{CPUCores: 2}, false, true},
+		{"memory", newTestResourceManager(0, 16, 32768), ResourceRequirements{MemoryMB: 30000}, ResourceRequirements{MemoryMB: 4096}, false, false},
+		{"no GPU left", newTestResourceManager(0, 16, 65536, 24576), ResourceRequirements{GPUMemoryMB: 24576}, ResourceRequirements{GPUMemoryMB: 1}, true, false},
+		{"second GPU", newTestResourceManager(0, 16, 65536, 24576, 24576), ResourceRequirements{GPUMemoryMB: 24576}, ResourceRequirements{GPUMemoryMB: 24576}, true, true},
+		{"too few GPUs for several", newTestResourceManager(0, 16, 65536, 24576, 24576), ResourceRequirements{GPUMemoryMB: 1}, ResourceRequirements{GPUCount: 2}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.rm.TryReserve(tt.held, tt.gpu); !ok {
+				t.Fatal("first job doesn't fit")
+			}
+			reservedCPU, reservedMem := tt.rm.reservedCPU, tt.rm.reservedMemMB
+			if _, ok := tt.rm.TryReserve(tt.next, tt.gpu); ok != tt.accept {
+				t.Errorf("second job reserved %v, want %v", ok, tt.accept)
+			}
+			if !tt.accept && (tt.rm.reservedCPU != reservedCPU || tt.rm.reservedMemMB != reservedMem || tt.rm.currentJobs != 1) {
+				t.Error("refused job reserved capacity")
+			}
+		})
+	}
+}
+
+func TestTryReserveConcurrent(t *testing.T) {
+	// Two 24GB GPUs fit twelve 4GB jobs, however many ask at once
+	rm := newTestResourceManager(0, 64, 1<<20, 24576, 24576)
+	job := ResourceRequirements{GPUMemoryMB: 4096, CPUCores: 1}
+
+	var wg sync.WaitGroup
+	reservations := make(chan *ResourceReservation, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reservation, ok := rm.TryReserve(job, true); ok {
+				reservations <- reservation
+			}
+		}()
+	}
+	wg.Wait()
+	close(reservations)
+
+	var held []*ResourceReservation
+	for reservation := range reservations {
+		held = append(held, reservation)
+	}
+	if len(held) != 12 {
+		t.Fatalf("%d jobs reserved, want 12", len(held))
+	}
+	for i, vram := range rm.reservedVRAM {
+		if vram != 24576 {
+			t.Errorf("GPU %d has %dMB reserved, want all 24576MB", i, vram)
+		}
+	}
+
+	for _, reservation := range held {
+		rm.Release(reservation)
+	}
+	if rm.currentJobs != 0 || rm.reservedCPU != 0 || rm.reservedVRAM[0] != 0 || rm.reservedVRAM[1] != 0 {
+		t.Errorf("after releasing everything: %d jobs, %d cores, %v VRAM reserved", rm.currentJobs, rm.reservedCPU, rm.reservedVRAM)
+	}
+}
+
+func TestTryReserveNeverOversubscribes(t *testing.T) {
+	rm := newTestResourceManager(3, 64, 1<<20, 24576)
+	job := ResourceRequirements{GPUMemoryMB: 6144}
+
+	// Jobs reserve and release over and over; at no point may more run than fit
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				reservation, ok := rm.TryReserve(job, true)
+				if !ok {
+					continue
+				}
+				now := running.Add(1)
+				for {
+					p := peak.Load()
+					if now <= p || peak.CompareAndSwap(p, now) {
+						break
+					}
+				}
+				running.Add(-1)
+				rm.Release(reservation)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d jobs ran at once with 3 job slots", p)
+	}
+	if rm.currentJobs != 0 || rm.reservedVRAM[0] != 0 {
+		t.Errorf("%d jobs and %dMB still reserved", rm.currentJobs, rm.reservedVRAM[0])
+	}
+}
+
+func TestReleaseWakesWaiters(t *testing.T) {
+	rm := newTestResourceManager(1, 8, 65536)
+	reservation, _ := rm.TryReserve(ResourceRequirements{}, false)
+
+	released := rm.Released()
+	select {
+	case <-released:
+		t.Fatal("woken before anything was released")
+	default:
+	}
+	rm.Release(reservation)
+	select {
+	case <-released:
+	default:
+		t.Error("not woken by the release")
+	}
+}
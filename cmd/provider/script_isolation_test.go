@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"dante-backend/common"
+)
+
+// runScript runs a bash script task with the given isolation level and returns its result
+func runScript(t *testing.T, script, isolation string, env map[string]string) (*TaskResult, error) {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &TaskWorker{
+		provider: &GPUProvider{config: &common.ProviderConfig{}, provider: &common.Provider{}},
+		logger:   zap.NewNop(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	job := &ActiveJob{
+		Task: &Task{
+			JobID:             "job-1",
+			ExecutionType:     ExecutionTypeBash,
+			Script:            script,
+			ScriptEnvironment: env,
+			Constraints:       TaskConstraints{IsolationLevel: isolation},
+		},
+		WorkspaceDir:    t.TempDir(),
+		Context:         ctx,
+		OutputCollector: &OutputCollector{},
+	}
+	return w.executeScriptTask(job)
+}
+
+func TestScriptDoesNotInheritHostEnvironment(t *testing.T) {
+	t.Setenv("SOLANA_PRIVATE_KEY", "host-private-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "host-aws-secret")
+	t.Setenv("TZ", "UTC")
+
+	for _, isolation := range []string{"", IsolationProcess} {
+		result, err := runScript(t, "env", isolation, map[string]string{"MODEL": "llama"})
+		if err != nil || !result.Success {
+			t.Fatalf("isolation %q: script failed: %v %+v", isolation, err, result)
+		}
+		env := strings.Split(strings.TrimSpace(result.Output), "\n")
+		for _, secret := range []string{"SOLANA_PRIVATE_KEY", "AWS_SECRET_ACCESS_KEY", "host-private-key"} {
+			if strings.Contains(result.Output, secret) {
+				t.Errorf("isolation %q: %s is visible to the script", isolation, secret)
+			}
+		}
+		for _, want := range []string{"MODEL=llama", "PATH=" + scriptSafePath, "DANTE_JOB_ID=job-1", "TZ=UTC"} {
+			found := false
+			for _, v := range env {
+				found = found || v == want
+			}
+			if !found {
+				t.Errorf("isolation %q: script environment %v lacks %s", isolation, env, want)
+			}
+		}
+	}
+}
+
+func TestScriptIsolationLevels(t *testing.T) {
+	if _, err := runScript(t, "true", "chroot", nil); err == nil || !strings.Contains(err.Error(), "unsupported isolation level") {
+		t.Errorf("unknown isolation level: %v, want it refused", err)
+	}
+	if _, err := exec.LookPath("runsc"); err == nil {
+		return
+	}
+	for _, isolation := range []string{IsolationGVisor, IsolationContainer, IsolationVM} {
+		if _, err := runScript(t, "true", isolation, nil); err == nil || !strings.Contains(err.Error(), "requires gVisor") {
+			t.Errorf("isolation %s without runsc: %v, want it refused rather than run unsandboxed", isolation, err)
+		}
+	}
+}
+
+func TestGVisorCommand(t *testing.T) {
+	args := []string{"bash", "/workspace/script.sh"}
+	if got, want := gVisorCommand(&Task{}, args), []string{"runsc", "--rootless", "--network=none", "do", "bash", "/workspace/script.sh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gVisorCommand = %v, want %v", got, want)
+	}
+	task := &Task{Constraints: TaskConstraints{AllowNetworkAccess: true}}
+	if got := gVisorCommand(task, args); got[2] != "--network=host" {
+		t.Errorf("gVisorCommand with network access = %v, want the host network", got)
+	}
+}
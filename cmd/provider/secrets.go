@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"dante-backend/common"
+)
+
+// secretReferencePrefix marks a task environment value that is resolved from a secret
+// backend when the job starts, e.g. secret://vault/hf-token
+const secretReferencePrefix = "secret://"
+
+// secretRedactedMarker replaces resolved secrets in job output and status updates
+const secretRedactedMarker = "[REDACTED]"
+
+// maxSecretSize bounds a secret read from the Vault or storage backend
+const maxSecretSize = 1 << 20
+
+// resolveTaskSecrets returns a copy of the task with the secret references in its
+// Docker and script environments replaced by their values, and a redactor for those
+// values. Tasks without references are returned as is, with a nil redactor.
+func (w *TaskWorker) resolveTaskSecrets(ctx context.Context, task *Task) (*Task, *secretRedactor, error) {
+	resolved := make(map[string]string) // Reference -> value
+	resolveEnvironment := func(env map[string]string) (map[string]string, error) {
+		if env == nil {
+			return nil, nil
+		}
+		result := make(map[string]string, len(env))
+		for key, value := range env {
+			if !strings.HasPrefix(value, secretReferencePrefix) {
+				result[key] = value
+				continue
+			}
+			secret, ok := resolved[value]
+			if !ok {
+				var err error
+				if secret, err = w.resolveSecret(ctx, task.UserID, value); err != nil {
+					return nil, fmt.Errorf("failed to resolve secret %s for %s: %w", value, key, err)
+				}
+				resolved[value] = secret
+			}
+			result[key] = secret
+		}
+		return result, nil
+	}
+
+	dockerEnv, err := resolveEnvironment(task.DockerEnvironment)
+	if err != nil {
+		return nil, nil, err
+	}
+	scriptEnv, err := resolveEnvironment(task.ScriptEnvironment)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(resolved) == 0 {
+		return task, nil, nil
+	}
+
+	resolvedTask := *task
+	resolvedTask.DockerEnvironment = dockerEnv
+	resolvedTask.ScriptEnvironment = scriptEnv
+	secrets := make([]string, 0, len(resolved))
+	for _, secret := range resolved {
+		secrets = append(secrets, secret)
+	}
+	return &resolvedTask, newSecretRedactor(secrets), nil
+}
+
+// resolveSecret reads the secret a reference points to from the backend named by the
+// reference's host: env, vault or storage. Every backend is read with the provider's
+// credentials, so a reference only reaches the secrets under users/<user_id>/ for the
+// user who submitted the task.
+func (w *TaskWorker) resolveSecret(ctx context.Context, userID, reference string) (string, error) {
+	backend, name, _ := strings.Cut(strings.TrimPrefix(reference, secretReferencePrefix), "/")
+	if name == "" {
+		return "", errors.New("secret reference has no name")
+	}
+
+	settings := w.provider.config.Secrets
+	switch backend {
+	case "env":
+		scoped, err := scopeSecretName(userID, name)
+		if err != nil {
+			return "", err
+		}
+		return readEnvFileSecret(settings.EnvFile, scoped)
+	case "vault":
+		secretPath, field, _ := strings.Cut(name, "#")
+		scoped, err := scopeSecretName(userID, secretPath)
+		if err != nil {
+			return "", err
+		}
+		return w.readVaultSecret(ctx, settings, scoped, field)
+	case "storage":
+		scoped, err := scopeSecretName(userID, name)
+		if err != nil {
+			return "", err
+		}
+		return w.readStorageSecret(ctx, settings.StorageBucket, scoped)
+	}
+	return "", fmt.Errorf("unknown secret backend %q", backend)
+}
+
+// scopeSecretName returns the name of a user's secret within a backend,
+// users/<user_id>/<name>. Names are made of path segments of letters, digits, '.',
+// '_' and '-', so that a reference can't climb out of the user's scope with ".." or
+// with an escaped separator the backend would decode.
+func scopeSecretName(userID, name string) (string, error) {
+	if userID == "" {
+		return "", errors.New("task has no user to scope secrets to")
+	}
+	if !isSecretNameSegment(userID) {
+		return "", fmt.Errorf("invalid user ID %q for secret lookup", userID)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if !isSecretNameSegment(segment) {
+			return "", fmt.Errorf("invalid secret name %q", name)
+		}
+	}
+	return "users/" + userID + "/" + name, nil
+}
+
+// isSecretNameSegment reports whether s may be one segment of a scoped secret name
+func isSecretNameSegment(s string) bool {
+	if s == "" || s == "." || s == ".." {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// readEnvFileSecret looks up a KEY=value line in the secrets env file. Comments, an
+// "export " prefix and quotes around the value are allowed.
+func readEnvFileSecret(path, key string) (string, error) {
+	if path == "" {
+		return "", errors.New("no secrets env file configured")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open secrets env file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok || strings.TrimSpace(name) != key {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		return value, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read secrets env file: %w", err)
+	}
+	return "", fmt.Errorf("%s not found in secrets env file", key)
+}
+
+// readVaultSecret reads a field of a secret from Vault's KV v2 engine. The reference
+// names the field after a '#', e.g. secret://vault/ml/hf#token; it defaults to "value".
+func (w *TaskWorker) readVaultSecret(ctx context.Context, settings common.SecretSettings, secretPath, field string) (string, error) {
+	if settings.VaultAddress == "" {
+		return "", errors.New("no Vault address configured")
+	}
+	if field == "" {
+		field = "value"
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s",
+		strings.TrimSuffix(settings.VaultAddress, "/"), strings.Trim(settings.VaultMount, "/"), secretPath)
+	header := http.Header{}
+	header.Set("X-Vault-Token", settings.VaultToken)
+	data, err := w.fetchSecret(ctx, endpoint, header)
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	value, ok := response.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no field %s", secretPath, field)
+	}
+	return value, nil
+}
+
+// readStorageSecret reads a secret stored as an object in the storage-service's
+// secrets bucket. A trailing newline is dropped.
+func (w *TaskWorker) readStorageSecret(ctx context.Context, bucket, key string) (string, error) {
+	if w.provider.config.StorageServiceURL == "" {
+		return "", errors.New("no storage service configured")
+	}
+	endpoint := fmt.Sprintf("%s/objects/%s/%s",
+		strings.TrimSuffix(w.provider.config.StorageServiceURL, "/"), url.PathEscape(bucket), key)
+	data, err := w.fetchSecret(ctx, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fetchSecret GETs a secret from a backend. Response bodies are kept out of errors
+// since they may contain the secret.
+func (w *TaskWorker) fetchSecret(ctx context.Context, endpoint string, header http.Header) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.provider.config.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secret request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secret request failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSecretSize))
+}
+
+// secretRedactor masks a job's resolved secrets in text. A nil redactor masks nothing.
+type secretRedactor struct {
+	replacer *strings.Replacer
+	maxLen   int // Length of the longest secret
+}
+
+func newSecretRedactor(secrets []string) *secretRedactor {
+	// Replacer tries secrets in order, so longer ones go first to be masked whole when
+	// they contain a shorter one
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	redactor := &secretRedactor{}
+	var pairs []string
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		pairs = append(pairs, secret, secretRedactedMarker)
+		if len(secret) > redactor.maxLen {
+			redactor.maxLen = len(secret)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	redactor.replacer = strings.NewReplacer(pairs...)
+	return redactor
+}
+
+// Redact returns s with the secrets masked
+func (r *secretRedactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// RedactError returns err with the secrets masked in its message, keeping the
+// wrapped error for errors.Is and errors.As
+func (r *secretRedactor) RedactError(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	message := r.Redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, message: message}
+}
+
+// redactedError is an error whose message had secrets masked
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"dante-backend/common"
+)
+
+// newSecretTestWorker returns a worker resolving secrets with the given settings
+func newSecretTestWorker(settings common.SecretSettings, storageURL string) *TaskWorker {
+	return &TaskWorker{
+		provider: &GPUProvider{
+			config: &common.ProviderConfig{
+				StorageServiceURL: storageURL,
+				RequestTimeout:    5 * time.Second,
+				Secrets:           settings,
+			},
+			httpClient: &http.Client{},
+		},
+		logger: zap.NewNop(),
+	}
+}
+
+func TestScopeSecretName(t *testing.T) {
+	tests := []struct {
+		userID string
+		name   string
+		want   string
+	}{
+		{"alice", "HF_TOKEN", "users/alice/HF_TOKEN"},
+		{"alice", "ml/hf-token.v2", "users/alice/ml/hf-token.v2"},
+		{"", "HF_TOKEN", ""},
+		{"..", "HF_TOKEN", ""},
+		{"alice/bob", "HF_TOKEN", ""},
+		{"alice", "../bob/HF_TOKEN", ""},
+		{"alice", "ml/../../bob/HF_TOKEN", ""},
+		{"alice", "/etc/passwd", ""},
+		{"alice", "ml//token", ""},
+		{"alice", "ml/./token", ""},
+		{"alice", `..\bob\token`, ""},
+		{"alice", "%2e%2e/bob/token", ""},
+		{"alice", "token?version=1", ""},
+	}
+	for _, tt := range tests {
+		got, err := scopeSecretName(tt.userID, tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("scopeSecretName(%q, %q) = %q, want an error", tt.userID, tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("scopeSecretName(%q, %q) = %q, %v; want %q", tt.userID, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveEnvSecretScopedToUser(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "secrets.env")
+	content := "HF_TOKEN=provider-token\n" +
+		"users/alice/HF_TOKEN=alice-token\n" +
+		"export users/bob/HF_TOKEN=\"bob-token\"\n"
+	if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w := newSecretTestWorker(common.SecretSettings{EnvFile: envFile}, "")
+	ctx := context.Background()
+
+	if got, err := w.resolveSecret(ctx, "alice", "secret://env/HF_TOKEN"); err != nil || got != "alice-token" {
+		t.Errorf("alice resolved %q, %v; want alice-token", got, err)
+	}
+	if got, err := w.resolveSecret(ctx, "bob", "secret://env/HF_TOKEN"); err != nil || got != "bob-token" {
+		t.Errorf("bob resolved %q, %v; want bob-token", got, err)
+	}
+
+	// Neither the provider's own keys nor other users' keys are reachable
+	for _, reference := range []string{
+		"secret://env/../HF_TOKEN",
+		"secret://env/../../HF_TOKEN",
+		"secret://env/../bob/HF_TOKEN",
+	} {
+		if got, err := w.resolveSecret(ctx, "alice", reference); err == nil {
+			t.Errorf("alice resolved %s to %q, want an error", reference, got)
+		}
+	}
+	if _, err := w.resolveSecret(ctx, "carol", "secret://env/HF_TOKEN"); err == nil {
+		t.Error("carol resolved a secret she doesn't have")
+	}
+	if _, err := w.resolveSecret(ctx, "", "secret://env/HF_TOKEN"); err == nil {
+		t.Error("a task without a user resolved a secret")
+	}
+}
+
+func TestResolveRemoteSecretsScopedToUser(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1/kv/data/users/alice/ml/hf":
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data":{"data":{"value":"vault-value","token":"vault-field"}}}`))
+		case "/objects/secrets/users/alice/wandb":
+			w.Write([]byte("storage-value\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	w := newSecretTestWorker(common.SecretSettings{
+		VaultAddress:  server.URL,
+		VaultToken:    "vault-token",
+		VaultMount:    "kv",
+		StorageBucket: "secrets",
+	}, server.URL)
+	ctx := context.Background()
+
+	tests := []struct {
+		reference string
+		want      string
+	}{
+		{"secret://vault/ml/hf", "vault-value"},
+		{"secret://vault/ml/hf#token", "vault-field"},
+		{"secret://storage/wandb", "storage-value"},
+	}
+	for _, tt := range tests {
+		if got, err := w.resolveSecret(ctx, "alice", tt.reference); err != nil || got != tt.want {
+			t.Errorf("resolveSecret(%s) = %q, %v; want %q", tt.reference, got, err, tt.want)
+		}
+	}
+
+	paths = nil
+	for _, reference := range []string{
+		"secret://vault/../bob/ml/hf",
+		"secret://vault/ml/%2e%2e/hf",
+		"secret://storage/../../other-bucket/key",
+		"secret://storage/..%2f..%2fkey",
+	} {
+		if got, err := w.resolveSecret(ctx, "alice", reference); err == nil {
+			t.Errorf("resolveSecret(%s) = %q, want an error", reference, got)
+		}
+	}
+	if len(paths) != 0 {
+		t.Errorf("rejected references reached the backends: %v", paths)
+	}
+}
+
+func TestSecretNeverAppearsInOutputOrLogs(t *testing.T) {
+	const secret = "hf_abcdefghijklmnopqrstuvwxyz"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/objects/secrets/users/alice/broken" {
+			// An error page echoing the secret must not leak into the error
+			http.Error(w, "bad secret "+secret, http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(secret))
+	}))
+	defer server.Close()
+
+	w := newSecretTestWorker(common.SecretSettings{StorageBucket: "secrets"}, server.URL)
+	task := &Task{
+		UserID:            "alice",
+		DockerEnvironment: map[string]string{"HF_TOKEN": "secret://storage/hf", "MODE": "train"},
+	}
+	resolved, redactor, err := w.resolveTaskSecrets(context.Background(), task)
+	if err != nil {
+		t.Fatalf("resolveTaskSecrets: %v", err)
+	}
+	if resolved.DockerEnvironment["HF_TOKEN"] != secret || resolved.DockerEnvironment["MODE"] != "train" {
+		t.Fatalf("resolved environment %v", resolved.DockerEnvironment)
+	}
+	if task.DockerEnvironment["HF_TOKEN"] != "secret://storage/hf" {
+		t.Error("resolving secrets modified the task as received")
+	}
+
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "output.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	collector := &OutputCollector{LogFile: logFile}
+	collector.redactSecrets(redactor)
+
+	// The secret is split across writes, as a process writing unbuffered output would
+	stdout := collector.StdoutWriter()
+	stdout.Write([]byte("token is " + secret[:5]))
+	stdout.Write([]byte(secret[5:12]))
+	stdout.Write([]byte(secret[12:] + " done\n"))
+	collector.StderrWriter().Write([]byte("warning: " + secret + "\n"))
+	logged := collector.appendLogLine("stdout", "using "+secret)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	jobErr := redactor.RedactError(errors.New("container exited: " + secret))
+	logger.Error("Job failed", zap.Error(jobErr), zap.String("line", logged))
+
+	gotStdout, gotStderr := collector.Output()
+	fileOutput, err := os.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logText bytes.Buffer
+	for _, entry := range logs.All() {
+		logText.WriteString(entry.Message)
+		for key, value := range entry.ContextMap() {
+			logText.WriteString(" " + key + "=" + fmtValue(value))
+		}
+	}
+	for name, text := range map[string]string{
+		"stdout":   gotStdout,
+		"stderr":   gotStderr,
+		"log file": string(fileOutput),
+		"logs":     logText.String(),
+	} {
+		if strings.Contains(text, secret) || strings.Contains(text, secret[:12]) {
+			t.Errorf("%s contains the secret: %q", name, text)
+		}
+		if !strings.Contains(text, secretRedactedMarker) {
+			t.Errorf("%s has no redaction marker: %q", name, text)
+		}
+	}
+	if !strings.Contains(gotStdout, "token is "+secretRedactedMarker+" done") {
+		t.Errorf("stdout = %q", gotStdout)
+	}
+
+	// Errors from the backend don't carry its response body
+	task.DockerEnvironment = map[string]string{"HF_TOKEN": "secret://storage/broken"}
+	if _, _, err := w.resolveTaskSecrets(context.Background(), task); err == nil {
+		t.Error("resolving a failing secret succeeded")
+	} else if strings.Contains(err.Error(), secret) {
+		t.Errorf("resolution error contains the secret: %v", err)
+	}
+}
+
+func fmtValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	return ""
+}
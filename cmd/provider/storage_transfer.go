@@ -0,0 +1,823 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// downloadInputFiles downloads input files for the task, up to MaxParallelDownloads
+// at a time. The first failure cancels the downloads still in flight.
+func (w *TaskWorker) downloadInputFiles(activeJob *ActiveJob) error {
+	files := activeJob.Task.InputFiles
+	if len(files) == 0 {
+		return nil
+	}
+
+	w.publishTaskStatus(activeJob, "Downloading input files", "")
+
+	group, ctx := errgroup.WithContext(w.ctx)
+	limit := w.provider.config.MaxParallelDownloads
+	if limit < 1 {
+		limit = 1
+	}
+	group.SetLimit(limit)
+
+	var progressMu sync.Mutex // Serializes progress updates so they are published in order
+	completed := 0
+	for i, file := range files {
+		i, file := i, file
+		group.Go(func() error {
+			w.logger.Info("Downloading input file",
+				zap.Int("index", i),
+				zap.String("url", file.URL),
+				zap.String("path", file.Path))
+
+			if err := w.downloadFile(ctx, file, activeJob.WorkspaceDir, activeJob.Task.Requirements.DiskSpaceMB); err != nil {
+				return fmt.Errorf("failed to download file %s: %w", file.URL, err)
+			}
+
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			completed++
+			activeJob.Progress = float32(completed) / float32(len(files)) * 0.2 // 20% of total progress
+			w.publishTaskStatus(activeJob, fmt.Sprintf("Downloaded %d/%d input files", completed, len(files)), "")
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// downloadFile downloads a single file, resuming interrupted transfers with
+// HTTP range requests when the server supports them. Compressed files are
+// decompressed into the target path once the download is complete, writing no more
+// than the job's disk requirement of diskSpaceMB, if set, or the workspace's free space.
+func (w *TaskWorker) downloadFile(ctx context.Context, file FileTransfer, workspaceDir string, diskSpaceMB uint64) error {
+	compression, err := normalizeCompression(file.Compression)
+	if err != nil {
+		return err
+	}
+
+	// Create destination file
+	destPath := filepath.Join(workspaceDir, file.Path)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// A compressed body is downloaded next to the target, then decompressed into it
+	downloadPath := destPath
+	if compression != "" {
+		downloadPath = destPath + ".download"
+		defer os.Remove(downloadPath)
+	}
+
+	destFile, err := os.Create(downloadPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer destFile.Close()
+
+	// Hash the body while it is streamed to disk
+	var hasher hash.Hash
+	var algorithm, expected string
+	if file.Checksum != "" {
+		hasher, algorithm, expected, err = newChecksumHasher(file.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+
+	var written int64
+	supportsRange := false
+	maxRetries := w.provider.config.MaxDownloadRetries
+	backoff := w.provider.config.DownloadRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		resumeFrom := int64(0)
+		if supportsRange {
+			resumeFrom = written
+		}
+
+		end, rangeOK, err := w.downloadAttempt(ctx, file, destFile, hasher, resumeFrom)
+		written = end
+		supportsRange = rangeOK
+		if err == nil {
+			break
+		}
+
+		var permanent *permanentDownloadError
+		if errors.As(err, &permanent) {
+			return fmt.Errorf("failed to download file: %w", err)
+		}
+		if attempt >= maxRetries {
+			// Transient failures may still succeed when the task is retried
+			return retryable(fmt.Errorf("failed to download file: %w", err))
+		}
+
+		delay := backoff * time.Duration(1<<attempt)
+		w.logger.Warn("Input download interrupted, retrying",
+			zap.String("path", file.Path),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", maxRetries),
+			zap.Int64("bytes_written", written),
+			zap.Bool("resume", supportsRange),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("download cancelled: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+
+	if hasher != nil {
+		actual := hex.EncodeToString(hasher.Sum(nil))
+		if actual != expected {
+			return fmt.Errorf("checksum mismatch for %s: expected %s:%s, got %s:%s",
+				file.Path, algorithm, expected, algorithm, actual)
+		}
+	}
+
+	if compression != "" {
+		// The checksum covers the file as downloaded, so decompress only once it passed
+		if _, err := destFile.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek downloaded file: %w", err)
+		}
+		limit, err := w.provider.executionEnv.decompressLimit(diskSpaceMB)
+		if err != nil {
+			return err
+		}
+		if err := decompressInput(destFile, destPath, compression, limit); err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", file.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// permanentDownloadError marks download failures that retrying cannot fix
+type permanentDownloadError struct {
+	err error
+}
+
+func (e *permanentDownloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentDownloadError) Unwrap() error {
+	return e.err
+}
+
+// downloadAttempt performs a single GET of the file starting at offset. It
+// returns the number of valid bytes in the destination file afterwards and
+// whether the server advertised byte-range support.
+func (w *TaskWorker) downloadAttempt(ctx context.Context, file FileTransfer, destFile *os.File, hasher hash.Hash, offset int64) (int64, bool, error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "GET", file.URL, nil)
+	if err != nil {
+		return offset, false, &permanentDownloadError{fmt.Errorf("failed to create request: %w", err)}
+	}
+
+	// Add custom headers
+	for key, value := range file.Headers {
+		req.Header.Set(key, value)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Perform request
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		return offset, false, err
+	}
+	defer resp.Body.Close()
+
+	supportsRange := resp.Header.Get("Accept-Ranges") == "bytes"
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// Server honored the range request, append to the partial file
+		supportsRange = true
+		if _, err := destFile.Seek(offset, io.SeekStart); err != nil {
+			return offset, false, &permanentDownloadError{fmt.Errorf("failed to seek destination file: %w", err)}
+		}
+	case resp.StatusCode == http.StatusOK:
+		// Full body, start over from the beginning
+		if err := destFile.Truncate(0); err != nil {
+			return 0, false, &permanentDownloadError{fmt.Errorf("failed to truncate destination file: %w", err)}
+		}
+		if _, err := destFile.Seek(0, io.SeekStart); err != nil {
+			return 0, false, &permanentDownloadError{fmt.Errorf("failed to seek destination file: %w", err)}
+		}
+		if hasher != nil {
+			hasher.Reset()
+		}
+		offset = 0
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return offset, supportsRange, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	default:
+		return offset, false, &permanentDownloadError{fmt.Errorf("download failed with status %d", resp.StatusCode)}
+	}
+
+	var body io.Reader = resp.Body
+	if hasher != nil {
+		body = io.TeeReader(resp.Body, hasher)
+	}
+
+	// Copy data
+	n, err := io.Copy(destFile, body)
+	if err != nil {
+		return offset + n, supportsRange, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return offset + n, supportsRange, nil
+}
+
+// newChecksumHasher returns a hasher for a "sha256:<hex>" or "md5:<hex>" checksum
+// together with the algorithm name and the normalized expected digest
+func newChecksumHasher(checksum string) (hash.Hash, string, string, error) {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return nil, "", "", fmt.Errorf("invalid checksum %q: expected <algorithm>:<hex digest>", checksum)
+	}
+
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	digest = strings.ToLower(strings.TrimSpace(digest))
+
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), algorithm, digest, nil
+	case "md5":
+		return md5.New(), algorithm, digest, nil
+	default:
+		return nil, "", "", fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+}
+
+// uploadOutputFiles uploads output files
+func (w *TaskWorker) uploadOutputFiles(activeJob *ActiveJob) error {
+	if len(activeJob.Task.OutputFiles) == 0 {
+		return nil
+	}
+
+	w.publishTaskStatus(activeJob, "Uploading output files", "")
+
+	for i, file := range activeJob.Task.OutputFiles {
+		sourcePath := filepath.Join(activeJob.WorkspaceDir, file.Path)
+
+		if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
+			w.logger.Warn("Output file not found", zap.String("path", sourcePath))
+			continue
+		}
+
+		artifact, err := w.uploadFile(file, sourcePath, activeJob.Task.JobID)
+		if err != nil {
+			w.logger.Error("Failed to upload output file",
+				zap.String("path", file.Path),
+				zap.Error(err))
+			// Continue with other files
+		} else {
+			activeJob.OutputFilesURL = append(activeJob.OutputFilesURL, artifact.URL)
+			activeJob.Artifacts = append(activeJob.Artifacts, *artifact)
+			w.logger.Info("Uploaded output file",
+				zap.Int("index", i),
+				zap.String("path", file.Path),
+				zap.String("url", artifact.URL),
+				zap.Int64("size", artifact.Size),
+				zap.String("checksum", artifact.Checksum))
+		}
+	}
+
+	return nil
+}
+
+// jobOutputBucket is the storage-service bucket job outputs and logs are stored in,
+// under <job_id>/. The API gateway serves job logs from the same place.
+const jobOutputBucket = "jobs"
+
+// jobLogName is the output log's name under the job's prefix in jobOutputBucket
+const jobLogName = "output.log"
+
+// jobLogDir holds the jobs' output logs in the workspace root, outside every job's
+// workspace, so a job can't read, overwrite or delete its own log
+const jobLogDir = ".logs"
+
+// jobLogPath returns where the job's output log is kept while the job runs
+func (e *ExecutionEnvironment) jobLogPath(jobID string) string {
+	return filepath.Join(e.workspaceDir, jobLogDir, jobID+".log")
+}
+
+// createJobLog creates the job's output log at jobLogPath
+func (e *ExecutionEnvironment) createJobLog(jobID string) (*os.File, error) {
+	path := e.jobLogPath(jobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// uploadJobLog uploads the job's combined stdout and stderr to the storage-service once
+// the job has ended, whatever its outcome, and records a presigned link to it for the
+// final status. Failures are logged and don't affect the job.
+func (w *TaskWorker) uploadJobLog(activeJob *ActiveJob) {
+	if activeJob.OutputCollector.LogFile == nil || w.provider.config.StorageServiceURL == "" {
+		return
+	}
+	jobID := activeJob.Task.JobID
+
+	file := FileTransfer{Path: jobLogName}
+	artifact, err := w.uploadFile(file, activeJob.OutputCollector.LogFile.Name(), jobID)
+	if err != nil {
+		w.logger.Warn("Failed to upload job output log", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	query := url.Values{"bucket": {jobOutputBucket}, "object": {path.Join(jobID, jobLogName)}}
+	var presigned struct {
+		URL string `json:"url"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.provider.config.RequestTimeout)
+	defer cancel()
+	storageURL := strings.TrimSuffix(w.provider.config.StorageServiceURL, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", storageURL+"/presign/download?"+query.Encode(), nil)
+	if err == nil {
+		_, err = w.doStorageRequest(req, &presigned)
+	}
+	if err != nil || presigned.URL == "" {
+		// The log is still reachable through the gateway's logs endpoint
+		w.logger.Warn("Failed to presign job output log", zap.String("job_id", jobID), zap.Error(err))
+		return
+	}
+
+	activeJob.LogsURL = presigned.URL
+	w.logger.Info("Uploaded job output log", zap.String("job_id", jobID), zap.Int64("size", artifact.Size))
+}
+
+// Output files at least this large are sent to the storage-service as multipart
+// uploads, one part per request, so they aren't bound by request timeouts. Parts are
+// kept small enough to finish within RequestTimeout on a modest uplink.
+const (
+	multipartUploadThreshold = 256 * 1024 * 1024
+	multipartUploadPartSize  = 32 * 1024 * 1024
+)
+
+// uploadTarget is where an output file is uploaded to
+type uploadTarget struct {
+	url     string
+	storage bool   // Uploaded through the storage-service object API
+	bucket  string // Storage-service bucket; empty for the default bucket
+	key     string // Storage-service object key
+}
+
+// uploadDigest accumulates the size and SHA-256 of the bytes sent in an upload, so
+// artifacts can be described without reading the file a second time
+type uploadDigest struct {
+	hash        hash.Hash
+	size        int64
+	contentType string
+}
+
+func newUploadDigest(contentType string) *uploadDigest {
+	return &uploadDigest{hash: sha256.New(), contentType: contentType}
+}
+
+func (d *uploadDigest) Write(p []byte) (int, error) {
+	d.hash.Write(p)
+	d.size += int64(len(p))
+	return len(p), nil
+}
+
+// artifact describes the uploaded object. Size, checksum and type are those of the
+// bytes sent, so they match what clients download, compressed or not.
+func (d *uploadDigest) artifact(name, objectURL string) *Artifact {
+	return &Artifact{
+		Name:      name,
+		Type:      d.contentType,
+		Size:      d.size,
+		Checksum:  "sha256:" + hex.EncodeToString(d.hash.Sum(nil)),
+		URL:       objectURL,
+		CreatedAt: time.Now(),
+	}
+}
+
+// uploadFile uploads a single file and returns the artifact describing the stored object.
+//
+// Destinations:
+//   - s3://<bucket>/<key> is uploaded through the storage-service object API
+//   - an empty URL is uploaded through the storage-service object API to
+//     jobOutputBucket under <job_id>/, which is created if it doesn't exist yet
+//   - any other URL receives a plain HTTP PUT (e.g. a presigned URL)
+//
+// Files are streamed. Large files going to the storage-service are uploaded in parts
+// via its multipart API. Uploads are retried on 5xx responses.
+func (w *TaskWorker) uploadFile(file FileTransfer, sourcePath string, jobID string) (*Artifact, error) {
+	target, err := w.resolveUploadTarget(file, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if target.bucket == jobOutputBucket {
+		if err := w.ensureJobOutputBucket(); err != nil {
+			return nil, err
+		}
+	}
+
+	var digest *uploadDigest
+	stat, statErr := os.Stat(sourcePath)
+	if statErr == nil && target.storage && stat.Size() >= multipartUploadThreshold {
+		digest, err = w.uploadMultipart(file, sourcePath, target)
+	} else {
+		err = w.retryUpload(file.Path, func() (bool, error) {
+			var retryable bool
+			var attemptErr error
+			digest, retryable, attemptErr = w.uploadAttempt(file, sourcePath, target.url)
+			return retryable, attemptErr
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Strip query parameters so presigned signatures aren't reported back
+	objectURL := target.url
+	if parsed, err := url.Parse(target.url); err == nil {
+		parsed.RawQuery = ""
+		objectURL = parsed.String()
+	}
+
+	return digest.artifact(filepath.ToSlash(file.Path), objectURL), nil
+}
+
+// retryUpload runs attempt until it succeeds, fails with a non-retryable error or
+// MaxUploadRetries is exhausted, backing off exponentially between attempts
+func (w *TaskWorker) retryUpload(description string, attempt func() (bool, error)) error {
+	maxRetries := w.provider.config.MaxUploadRetries
+	backoff := w.provider.config.UploadRetryBackoff
+
+	for n := 0; ; n++ {
+		retryable, err := attempt()
+		if err == nil {
+			return nil
+		}
+		if !retryable || n >= maxRetries {
+			return err
+		}
+
+		delay := backoff * time.Duration(1<<n)
+		w.logger.Warn("Output upload failed, retrying",
+			zap.String("path", description),
+			zap.Int("attempt", n+1),
+			zap.Int("max_retries", maxRetries),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+
+		select {
+		case <-w.ctx.Done():
+			return fmt.Errorf("upload cancelled: %w", w.ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// resolveUploadTarget maps an output FileTransfer to the HTTP URL it is PUT to
+func (w *TaskWorker) resolveUploadTarget(file FileTransfer, jobID string) (uploadTarget, error) {
+	storageURL := strings.TrimSuffix(w.provider.config.StorageServiceURL, "/")
+
+	switch {
+	case strings.HasPrefix(file.URL, "s3://"):
+		if storageURL == "" {
+			return uploadTarget{}, fmt.Errorf("storage service URL not configured for %s", file.URL)
+		}
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(file.URL, "s3://"), "/")
+		if !ok || bucket == "" || key == "" {
+			return uploadTarget{}, fmt.Errorf("invalid S3 URL %q: expected s3://<bucket>/<key>", file.URL)
+		}
+		return uploadTarget{
+			url:     fmt.Sprintf("%s/objects/%s/%s", storageURL, url.PathEscape(bucket), escapeObjectKey(key)),
+			storage: true,
+			bucket:  bucket,
+			key:     key,
+		}, nil
+	case file.URL == "":
+		if storageURL == "" {
+			return uploadTarget{}, fmt.Errorf("no upload URL for %s and storage service URL not configured", file.Path)
+		}
+		key := path.Join(jobID, filepath.ToSlash(file.Path))
+		return uploadTarget{
+			url:     fmt.Sprintf("%s/objects/%s/%s", storageURL, jobOutputBucket, escapeObjectKey(key)),
+			storage: true,
+			bucket:  jobOutputBucket,
+			key:     key,
+		}, nil
+	default:
+		return uploadTarget{url: file.URL}, nil
+	}
+}
+
+// uploadContentType is the content type an output file is stored with. Logs are
+// stored as text so they can be read in a browser.
+func uploadContentType(sourcePath string) string {
+	ext := filepath.Ext(sourcePath)
+	if ext == ".log" {
+		return "text/plain; charset=utf-8"
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// escapeObjectKey escapes each segment of an object key while keeping the separators
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uploadAttempt performs a single upload, reporting whether a failure is retryable.
+// The returned digest covers the bytes sent in this attempt.
+func (w *TaskWorker) uploadAttempt(file FileTransfer, sourcePath, targetURL string) (*uploadDigest, bool, error) {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer sourceFile.Close()
+
+	stat, err := sourceFile.Stat()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	compression, err := normalizeCompression(file.Compression)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var body io.Reader = sourceFile
+	contentLength := stat.Size()
+	contentType := uploadContentType(sourcePath)
+
+	if compression != "" {
+		// Compress on the fly; the compressed size isn't known up front
+		compressed, compressedType := compressOutput(compression, sourceFile, sourcePath)
+		defer compressed.Close()
+
+		body = compressed
+		contentLength = -1
+		contentType = compressedType
+	}
+
+	digest := newUploadDigest(contentType)
+	body = io.TeeReader(body, digest)
+
+	// Create upload request
+	req, err := http.NewRequestWithContext(w.ctx, "PUT", targetURL, body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = contentLength
+	req.Header.Set("Content-Type", contentType)
+
+	// Add headers
+	for key, value := range file.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Perform upload
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, resp.StatusCode >= 500, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return digest, false, nil
+}
+
+// storageMultipartPart is a part reported by the storage-service multipart API
+type storageMultipartPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// storageMultipartRequest identifies a storage-service multipart upload
+type storageMultipartRequest struct {
+	Bucket      string                 `json:"bucket"`
+	Key         string                 `json:"key"`
+	UploadID    string                 `json:"upload_id,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Parts       []storageMultipartPart `json:"parts,omitempty"`
+}
+
+// uploadMultipart uploads a file through the storage-service multipart API. Each part
+// is retried on its own, and the upload is aborted on failure so that no orphaned parts
+// are left behind.
+func (w *TaskWorker) uploadMultipart(file FileTransfer, sourcePath string, target uploadTarget) (*uploadDigest, error) {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer sourceFile.Close()
+
+	compression, err := normalizeCompression(file.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = sourceFile
+	contentType := uploadContentType(sourcePath)
+
+	if compression != "" {
+		// Parts are cut from the compressed stream, so its size needn't be known up front
+		compressed, compressedType := compressOutput(compression, sourceFile, sourcePath)
+		defer compressed.Close()
+
+		body = compressed
+		contentType = compressedType
+	}
+
+	// Each part is read from the stream exactly once, however often it is retried
+	digest := newUploadDigest(contentType)
+	body = io.TeeReader(body, digest)
+
+	upload := storageMultipartRequest{Bucket: target.bucket, Key: target.key, ContentType: contentType}
+	var initiated struct {
+		UploadID string `json:"upload_id"`
+	}
+	err = w.retryUpload(file.Path, func() (bool, error) {
+		return w.postStorageJSON("/upload/multipart/initiate", upload, &initiated)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	upload.UploadID = initiated.UploadID
+	upload.ContentType = ""
+
+	w.logger.Info("Started multipart upload",
+		zap.String("path", file.Path),
+		zap.String("key", target.key),
+		zap.String("upload_id", upload.UploadID))
+
+	if err := w.uploadParts(file, body, &upload); err != nil {
+		w.abortMultipart(upload)
+		return nil, err
+	}
+
+	err = w.retryUpload(file.Path, func() (bool, error) {
+		return w.postStorageJSON("/upload/multipart/complete", upload, nil)
+	})
+	if err != nil {
+		w.abortMultipart(upload)
+		return nil, fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return digest, nil
+}
+
+// uploadParts reads body in multipartUploadPartSize chunks and uploads each as a part,
+// recording the returned ETags in upload.Parts
+func (w *TaskWorker) uploadParts(file FileTransfer, body io.Reader, upload *storageMultipartRequest) error {
+	storageURL := strings.TrimSuffix(w.provider.config.StorageServiceURL, "/")
+	buf := make([]byte, multipartUploadPartSize)
+
+	for partNumber := 1; ; partNumber++ {
+		n, readErr := io.ReadFull(body, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read output file: %w", readErr)
+		}
+		if n == 0 {
+			if partNumber == 1 {
+				return fmt.Errorf("output file is empty")
+			}
+			return nil
+		}
+
+		query := url.Values{}
+		query.Set("bucket", upload.Bucket)
+		query.Set("key", upload.Key)
+		query.Set("upload_id", upload.UploadID)
+		query.Set("part_number", strconv.Itoa(partNumber))
+		partURL := storageURL + "/upload/multipart/part?" + query.Encode()
+
+		var part storageMultipartPart
+		err := w.retryUpload(file.Path, func() (bool, error) {
+			req, err := http.NewRequestWithContext(w.ctx, "PUT", partURL, bytes.NewReader(buf[:n]))
+			if err != nil {
+				return false, fmt.Errorf("failed to create part upload request: %w", err)
+			}
+			req.ContentLength = int64(n)
+			req.Header.Set("Content-Type", "application/octet-stream")
+			return w.doStorageRequest(req, &part)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		upload.Parts = append(upload.Parts, part)
+
+		if readErr != nil {
+			return nil // Short read: that was the last part
+		}
+	}
+}
+
+// abortMultipart cancels a failed multipart upload so the storage-service discards its parts
+func (w *TaskWorker) abortMultipart(upload storageMultipartRequest) {
+	upload.Parts = nil
+	if _, err := w.postStorageJSON("/upload/multipart/abort", upload, nil); err != nil {
+		w.logger.Warn("Failed to abort multipart upload",
+			zap.String("key", upload.Key),
+			zap.String("upload_id", upload.UploadID),
+			zap.Error(err))
+	}
+}
+
+// postStorageJSON POSTs payload to a storage-service endpoint and decodes the response
+// into out if it is non-nil, reporting whether a failure is retryable
+func (w *TaskWorker) postStorageJSON(endpoint string, payload, out interface{}) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Use a fresh context so that aborts still go out when the job was cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), w.provider.config.RequestTimeout)
+	defer cancel()
+
+	storageURL := strings.TrimSuffix(w.provider.config.StorageServiceURL, "/")
+	req, err := http.NewRequestWithContext(ctx, "POST", storageURL+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return w.doStorageRequest(req, out)
+}
+
+// ensureJobOutputBucket creates jobOutputBucket in the storage-service unless it was
+// already found to exist
+func (w *TaskWorker) ensureJobOutputBucket() error {
+	w.provider.jobBucketMutex.Lock()
+	defer w.provider.jobBucketMutex.Unlock()
+	if w.provider.jobBucketReady {
+		return nil
+	}
+
+	err := w.retryUpload(jobOutputBucket, func() (bool, error) {
+		return w.postStorageJSON("/buckets/"+jobOutputBucket, struct{}{}, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ensure job output bucket: %w", err)
+	}
+	w.provider.jobBucketReady = true
+	return nil
+}
+
+// doStorageRequest performs a storage-service request and decodes a JSON response into out
+func (w *TaskWorker) doStorageRequest(req *http.Request, out interface{}) (bool, error) {
+	resp, err := w.provider.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("storage request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode >= 500, fmt.Errorf("storage request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return false, fmt.Errorf("failed to decode storage response: %w", err)
+		}
+	}
+	return false, nil
+}
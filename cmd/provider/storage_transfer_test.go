@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"dante-backend/common"
+)
+
+// fakeStorage is a storage-service recording the requests it was sent
+type fakeStorage struct {
+	mu       sync.Mutex
+	requests []string // Method and path, plus the query for presign requests
+	objects  map[string][]byte
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	request := r.Method + " " + r.URL.Path
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/buckets/"+jobOutputBucket:
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT":
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+	case r.Method == "GET" && r.URL.Path == "/presign/download":
+		request += "?" + r.URL.RawQuery
+		json.NewEncoder(w).Encode(map[string]string{"url": "https://storage.example/presigned"})
+	default:
+		http.NotFound(w, r)
+	}
+	f.requests = append(f.requests, request)
+}
+
+func newStorageTestWorker(t *testing.T) (*TaskWorker, *fakeStorage) {
+	t.Helper()
+	storage := &fakeStorage{objects: make(map[string][]byte)}
+	server := httptest.NewServer(storage)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &TaskWorker{
+		provider: &GPUProvider{
+			config: &common.ProviderConfig{
+				StorageServiceURL: server.URL,
+				RequestTimeout:    5 * time.Second,
+			},
+			httpClient: &http.Client{},
+		},
+		logger: zap.NewNop(),
+		ctx:    ctx,
+		cancel: cancel,
+	}, storage
+}
+
+func TestResolveUploadTargetJobOutput(t *testing.T) {
+	w, _ := newStorageTestWorker(t)
+	target, err := w.resolveUploadTarget(FileTransfer{Path: "results/model.bin"}, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Single and multipart uploads both go to the bucket and key the gateway reads from
+	if target.bucket != jobOutputBucket || target.key != "job-1/results/model.bin" {
+		t.Errorf("target bucket %q, key %q; want %q and job-1/results/model.bin", target.bucket, target.key, jobOutputBucket)
+	}
+	if want := w.provider.config.StorageServiceURL + "/objects/jobs/job-1/results/model.bin"; target.url != want {
+		t.Errorf("target URL %s, want %s", target.url, want)
+	}
+}
+
+func TestUploadJobLogLayout(t *testing.T) {
+	w, storage := newStorageTestWorker(t)
+	logFile, err := os.Create(filepath.Join(t.TempDir(), jobLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	logFile.WriteString("job output\n")
+
+	job := &ActiveJob{Task: &Task{JobID: "job-1"}, OutputCollector: &OutputCollector{LogFile: logFile}}
+	w.uploadJobLog(job)
+	w.uploadJobLog(job) // The bucket is only ensured once
+
+	want := []string{
+		"POST /buckets/jobs",
+		"PUT /objects/jobs/job-1/output.log",
+		"GET /presign/download?bucket=jobs&object=job-1%2Foutput.log",
+		"PUT /objects/jobs/job-1/output.log",
+		"GET /presign/download?bucket=jobs&object=job-1%2Foutput.log",
+	}
+	if len(storage.requests) != len(want) {
+		t.Fatalf("storage requests %v, want %v", storage.requests, want)
+	}
+	for i := range want {
+		if storage.requests[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i, storage.requests[i], want[i])
+		}
+	}
+	if got := string(storage.objects["/objects/jobs/job-1/output.log"]); got != "job output\n" {
+		t.Errorf("uploaded log %q", got)
+	}
+	if job.LogsURL != "https://storage.example/presigned" {
+		t.Errorf("logs URL %q, want the presigned URL", job.LogsURL)
+	}
+}
+
+func TestStorageServiceURLFromEnvironment(t *testing.T) {
+	t.Setenv("STORAGE_SERVICE_URL", "http://storage:8082")
+	if got := getDefaultProviderConfig().StorageServiceURL; got != "http://storage:8082" {
+		t.Errorf("StorageServiceURL = %q, want it from STORAGE_SERVICE_URL", got)
+	}
+}
+
+func TestUploadOutputFilesReportsArtifacts(t *testing.T) {
+	w, storage := newStorageTestWorker(t)
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "results"), 0755)
+	metrics := []byte(`{"loss": 0.125, "accuracy": 0.97}`)
+	os.WriteFile(filepath.Join(workspace, "results", "metrics.json"), metrics, 0644)
+	os.WriteFile(filepath.Join(workspace, "model.bin"), bytes.Repeat([]byte("weights "), 4096), 0644)
+
+	job := &ActiveJob{
+		Task: &Task{JobID: "job-1", OutputFiles: []FileTransfer{
+			{Path: "results/metrics.json"},
+			{Path: "model.bin", Compression: "gzip"},
+			{Path: "missing.txt"},
+		}},
+		WorkspaceDir:    workspace,
+		OutputCollector: &OutputCollector{},
+	}
+	if err := w.uploadOutputFiles(job); err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Artifacts) != 2 {
+		t.Fatalf("got %d artifacts, want one per uploaded file", len(job.Artifacts))
+	}
+
+	wantTypes := []string{"application/json", "application/gzip"}
+	for i, artifact := range job.Artifacts {
+		path := "/objects/jobs/job-1/" + job.Task.OutputFiles[i].Path
+		stored, ok := storage.objects[path]
+		if !ok {
+			t.Fatalf("%s wasn't uploaded", path)
+		}
+		// Size and checksum are those of the bytes stored, compressed or not
+		sum := sha256.Sum256(stored)
+		if artifact.Name != job.Task.OutputFiles[i].Path {
+			t.Errorf("artifact %d named %q, want %q", i, artifact.Name, job.Task.OutputFiles[i].Path)
+		}
+		if artifact.Size != int64(len(stored)) {
+			t.Errorf("%s: size %d, want %d", artifact.Name, artifact.Size, len(stored))
+		}
+		if want := "sha256:" + hex.EncodeToString(sum[:]); artifact.Checksum != want {
+			t.Errorf("%s: checksum %s, want %s", artifact.Name, artifact.Checksum, want)
+		}
+		if !strings.HasPrefix(artifact.Type, wantTypes[i]) {
+			t.Errorf("%s: type %q, want %s", artifact.Name, artifact.Type, wantTypes[i])
+		}
+		if want := w.provider.config.StorageServiceURL + path; artifact.URL != want || job.OutputFilesURL[i] != want {
+			t.Errorf("%s: URL %s, want %s", artifact.Name, artifact.URL, want)
+		}
+		if artifact.CreatedAt.IsZero() {
+			t.Errorf("%s: no creation time", artifact.Name)
+		}
+	}
+	if !bytes.Equal(storage.objects["/objects/jobs/job-1/results/metrics.json"], metrics) {
+		t.Error("uploaded metrics differ from the file")
+	}
+}
+
+func TestDownloadFileVerifiesChecksum(t *testing.T) {
+	content := []byte("input data\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+	sha := sha256.Sum256(content)
+	md := md5.Sum(content)
+	wrong := sha256.Sum256([]byte("other data\n"))
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  []string // Substrings of the error, none if it should succeed
+	}{
+		{"no checksum", "", nil},
+		{"sha256", "sha256:" + hex.EncodeToString(sha[:]), nil},
+		{"md5 upper case", "MD5:" + strings.ToUpper(hex.EncodeToString(md[:])), nil},
+		{"mismatch", "sha256:" + hex.EncodeToString(wrong[:]),
+			[]string{"checksum mismatch", "sha256:" + hex.EncodeToString(wrong[:]), "sha256:" + hex.EncodeToString(sha[:])}},
+		{"unsupported algorithm", "crc32:0badf00d", []string{"unsupported checksum algorithm"}},
+		{"no algorithm", hex.EncodeToString(sha[:]), []string{"invalid checksum"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := newStorageTestWorker(t)
+			dir := t.TempDir()
+			err := w.downloadFile(context.Background(), FileTransfer{URL: server.URL, Path: "input.txt", Checksum: tt.checksum}, dir, 0)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("downloadFile: %v", err)
+				}
+				if data, _ := os.ReadFile(filepath.Join(dir, "input.txt")); !bytes.Equal(data, content) {
+					t.Errorf("downloaded %q, want %q", data, content)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("download accepted")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadFileChecksumAcrossResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var attempts int
+	var resumedRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// Send half of the body, then drop the connection
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		resumedRange = r.Header.Get("Range")
+		http.ServeContent(w, r, "input.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	w, _ := newStorageTestWorker(t)
+	w.provider.config.MaxDownloadRetries = 1
+	w.provider.config.DownloadRetryBackoff = time.Millisecond
+	sum := sha256.Sum256(content)
+	dir := t.TempDir()
+	file := FileTransfer{URL: server.URL, Path: "input.bin", Checksum: "sha256:" + hex.EncodeToString(sum[:])}
+	if err := w.downloadFile(context.Background(), file, dir, 0); err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+	if want := "bytes=" + strconv.Itoa(len(content)/2) + "-"; attempts != 2 || resumedRange != want {
+		t.Errorf("downloaded in %d attempts, the last with range %q; want the second one resumed with %q", attempts, resumedRange, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "input.bin")); !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes, want the %d served", len(data), len(content))
+	}
+}
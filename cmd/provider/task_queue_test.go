@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// newQueueTestProvider returns a provider without workers whose queue holds capacity tasks
+func newQueueTestProvider(t *testing.T, capacity int) *GPUProvider {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &GPUProvider{
+		config:   &common.ProviderConfig{},
+		logger:   zap.NewNop(),
+		provider: &common.Provider{ID: uuid.New()},
+		ctx:      ctx,
+		cancel:   cancel,
+		jobQueue: newTaskQueue(capacity),
+	}
+}
+
+// dispatch delivers a task the way the scheduler sends it
+func dispatch(p *GPUProvider, jobID string, priority int) {
+	data, _ := json.Marshal(map[string]interface{}{"job_id": jobID, "priority": priority})
+	p.handleTaskDispatch(&nats.Msg{Subject: fmt.Sprintf("tasks.dispatch.%s.%s", p.provider.ID, jobID), Data: data})
+}
+
+func TestDispatchedTasksRunByPriority(t *testing.T) {
+	p := newQueueTestProvider(t, 10)
+	dispatch(p, "low-1", 0)
+	dispatch(p, "high", 5)
+	dispatch(p, "low-2", 0)
+	dispatch(p, "medium", 2)
+	p.handleTaskDispatch(&nats.Msg{Subject: "tasks.dispatch.x.y", Data: []byte("not a task")})
+
+	var got []string
+	for p.jobQueue.Len() > 0 {
+		task, err := p.jobQueue.Pop(p.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, task.JobID)
+	}
+	want := []string{"high", "medium", "low-1", "low-2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tasks ran in order %v, want %v", got, want)
+	}
+}
+
+func TestDispatchBlocksWhileQueueIsFull(t *testing.T) {
+	p := newQueueTestProvider(t, 2)
+	dispatch(p, "job-1", 0)
+	dispatch(p, "job-2", 0)
+
+	queued := make(chan struct{})
+	go func() {
+		dispatch(p, "job-3", 9)
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("dispatch returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A worker taking a task frees the slot the waiting dispatch needs
+	if task, err := p.jobQueue.Pop(p.ctx); err != nil || task.JobID != "job-1" {
+		t.Fatalf("popped %v, %v; want job-1", task, err)
+	}
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch still blocked after a slot freed up")
+	}
+	if task, err := p.jobQueue.Pop(p.ctx); err != nil || task.JobID != "job-3" {
+		t.Errorf("popped %v, %v; want the higher priority job-3", task, err)
+	}
+}
+
+func TestDispatchBlockedOnFullQueueIsReleasedByDrain(t *testing.T) {
+	p := newQueueTestProvider(t, 1)
+	dispatch(p, "job-1", 0)
+
+	returned := make(chan struct{})
+	go func() {
+		dispatch(p, "job-2", 0)
+		close(returned)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if drained := p.jobQueue.Drain(); len(drained) != 1 || drained[0].JobID != "job-1" {
+		t.Fatalf("drained %v, want job-1", drained)
+	}
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch still blocked after the queue was drained")
+	}
+	if p.jobQueue.Len() != 0 {
+		t.Errorf("%d tasks queued after the drain, want the blocked one rejected", p.jobQueue.Len())
+	}
+}
+
+func TestDispatchRejectedWhileDraining(t *testing.T) {
+	p := newQueueTestProvider(t, 10)
+	p.isShuttingDown = true
+	dispatch(p, "job-1", 0)
+	if p.jobQueue.Len() != 0 {
+		t.Error("task queued on a draining provider")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ThermalEvent records a GPU being throttled for running hot, or re-enabled once it cooled
+type ThermalEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	GPUIndex     int       `json:"gpu_index"`
+	GPUUUID      string    `json:"gpu_uuid,omitempty"`
+	TemperatureC uint8     `json:"temperature_celsius"`
+	Throttled    bool      `json:"throttled"`
+}
+
+// applyThermalGuard throttles GPUs at or above the throttle temperature, so that
+// no new jobs are placed on them, and re-enables them once they have cooled to the
+// resume temperature, gpuResumeMargin below the throttle temperature if unset. The
+// gap between the two keeps GPUs hovering around the threshold from flapping.
+func (p *GPUProvider) applyThermalGuard(metrics []GPUMetrics) {
+	settings := p.settings()
+	throttleAt, resumeAt := settings.GPUThrottleCelsius, settings.GPUResumeCelsius
+	if throttleAt == 0 {
+		return
+	}
+	if resumeAt == 0 || resumeAt >= throttleAt {
+		resumeAt = 0
+		if throttleAt > gpuResumeMargin {
+			resumeAt = throttleAt - gpuResumeMargin
+		}
+	}
+
+	for i, m := range metrics {
+		card := m.UUID
+		if card == "" {
+			card = fmt.Sprintf("index-%d", m.Index)
+		}
+
+		throttled := p.thermalThrottled[card]
+		switch {
+		case !throttled && m.Temperature >= throttleAt:
+			throttled = true
+		case throttled && m.Temperature <= resumeAt:
+			throttled = false
+		default:
+			continue
+		}
+		p.thermalThrottled[card] = throttled
+
+		// MIG instances live on their parent card. GPUs without a UUID rely on
+		// metrics being collected in the order GPUs are detected in.
+		p.mu.Lock()
+		for j := range p.gpus {
+			key := p.gpus[j].UUID
+			if p.gpus[j].ParentUUID != "" {
+				key = p.gpus[j].ParentUUID
+			}
+			if (key != "" && key == m.UUID) || (key == "" && m.UUID == "" && j == i) {
+				p.resourceManager.SetThrottled(j, throttled)
+				p.gpus[j].IsAvailable = !throttled
+			}
+		}
+		p.mu.Unlock()
+
+		source := fmt.Sprintf("gpu-%d", m.Index)
+		if throttled {
+			p.logger.Warn("GPU over temperature, pausing new jobs on it",
+				zap.Int("gpu_index", m.Index),
+				zap.Uint8("temperature_celsius", m.Temperature),
+				zap.Uint8("throttle_celsius", throttleAt))
+			p.alertManager.RaiseAlert(Alert{
+				Type:     alertTypeGPUOvertemp,
+				Severity: alertSeverityCritical,
+				Source:   source,
+				Message:  fmt.Sprintf("GPU %d (%s) is at %d°C, threshold is %d°C; no new jobs will be placed on it", m.Index, m.Name, m.Temperature, throttleAt),
+				Details: map[string]interface{}{
+					"gpu_index":           m.Index,
+					"gpu_uuid":            m.UUID,
+					"gpu_model":           m.Name,
+					"temperature_celsius": m.Temperature,
+					"threshold_celsius":   throttleAt,
+				},
+			})
+		} else {
+			p.logger.Info("GPU cooled down, accepting new jobs on it again",
+				zap.Int("gpu_index", m.Index),
+				zap.Uint8("temperature_celsius", m.Temperature))
+			p.alertManager.ResolveAlert(alertTypeGPUOvertemp, source)
+		}
+
+		p.recordThermalEvent(ThermalEvent{
+			Timestamp:    time.Now(),
+			GPUIndex:     m.Index,
+			GPUUUID:      m.UUID,
+			TemperatureC: m.Temperature,
+			Throttled:    throttled,
+		})
+	}
+}
+
+// recordThermalEvent appends to the thermal history, dropping the oldest event once
+// it is full
+func (p *GPUProvider) recordThermalEvent(event ThermalEvent) {
+	p.historyMutex.Lock()
+	defer p.historyMutex.Unlock()
+
+	if len(p.thermalHistory) >= maxThermalHistory {
+		p.thermalHistory = append(p.thermalHistory[:0], p.thermalHistory[1:]...)
+	}
+	p.thermalHistory = append(p.thermalHistory, event)
+}
+
+// GetThermalHistory returns the GPU throttling events recorded after since, oldest first
+func (p *GPUProvider) GetThermalHistory(since time.Time) []ThermalEvent {
+	p.historyMutex.RLock()
+	defer p.historyMutex.RUnlock()
+
+	history := make([]ThermalEvent, 0, len(p.thermalHistory))
+	for _, event := range p.thermalHistory {
+		if event.Timestamp.After(since) {
+			history = append(history, event)
+		}
+	}
+	return history
+}
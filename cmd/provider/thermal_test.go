@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"go.uber.org/zap"
+)
+
+func newThermalTestProvider(throttle, resume uint8) *GPUProvider {
+	gpus := []common.GPUDetail{{UUID: "GPU-a", IsAvailable: true}, {UUID: "GPU-b", IsAvailable: true}}
+	return &GPUProvider{
+		config:           &common.ProviderConfig{GPUThrottleCelsius: throttle, GPUResumeCelsius: resume},
+		logger:           zap.NewNop(),
+		gpus:             gpus,
+		resourceManager:  newResourceManager(2, gpus),
+		alertManager:     newAlertManager(common.AlertSettings{}, zap.NewNop()),
+		thermalThrottled: make(map[string]bool),
+	}
+}
+
+func TestThermalGuardThrottlesAndResumes(t *testing.T) {
+	p := newThermalTestProvider(85, 0)
+	start := time.Now()
+
+	steps := []struct {
+		temperature uint8
+		throttled   bool
+	}{
+		{84, false},
+		{85, true},
+		{80, true}, // Still within the resume margin
+		{79, false},
+		{84, false},
+	}
+	for _, step := range steps {
+		p.applyThermalGuard([]GPUMetrics{{Index: 0, UUID: "GPU-a", Temperature: step.temperature}, {Index: 1, UUID: "GPU-b", Temperature: 40}})
+		if got := p.resourceManager.IsThrottled(0); got != step.throttled {
+			t.Errorf("at %d°C throttled = %v, want %v", step.temperature, got, step.throttled)
+		}
+		if p.gpus[0].IsAvailable == step.throttled {
+			t.Errorf("at %d°C available = %v, want %v", step.temperature, p.gpus[0].IsAvailable, !step.throttled)
+		}
+		if p.resourceManager.IsThrottled(1) {
+			t.Error("cool GPU throttled")
+		}
+	}
+
+	// Only the two changes are recorded, in their own history
+	events := p.GetThermalHistory(start.Add(-time.Second))
+	if len(events) != 2 || !events[0].Throttled || events[0].TemperatureC != 85 || events[1].Throttled || events[1].TemperatureC != 79 {
+		t.Errorf("thermal history = %+v, want throttled at 85 and resumed at 79", events)
+	}
+	if history := p.GetPerformanceHistory(time.Time{}); len(history) != 0 {
+		t.Errorf("thermal events added %d performance snapshots", len(history))
+	}
+}
+
+func TestThermalGuardConfiguredResume(t *testing.T) {
+	p := newThermalTestProvider(85, 70)
+	for _, temperature := range []uint8{90, 75} {
+		p.applyThermalGuard([]GPUMetrics{{Index: 0, UUID: "GPU-a", Temperature: temperature}})
+	}
+	if !p.resourceManager.IsThrottled(0) {
+		t.Error("GPU resumed above the configured resume temperature")
+	}
+	p.applyThermalGuard([]GPUMetrics{{Index: 0, UUID: "GPU-a", Temperature: 70}})
+	if p.resourceManager.IsThrottled(0) {
+		t.Error("GPU still throttled at the resume temperature")
+	}
+}
+
+func TestThermalHistoryIsBounded(t *testing.T) {
+	p := &GPUProvider{}
+	for i := 0; i < maxThermalHistory+10; i++ {
+		p.recordThermalEvent(ThermalEvent{Timestamp: time.Now(), GPUIndex: i})
+	}
+	history := p.GetThermalHistory(time.Time{})
+	if len(history) != maxThermalHistory || history[0].GPUIndex != 10 {
+		t.Errorf("kept %d events from %d, want the newest %d", len(history), history[0].GPUIndex, maxThermalHistory)
+	}
+}
+
+func TestOvertempThresholdFromEnvironment(t *testing.T) {
+	t.Setenv("GPU_OVERTEMP_CELSIUS", "80")
+	if got := getDefaultProviderConfig().GPUThrottleCelsius; got != 80 {
+		t.Errorf("GPUThrottleCelsius = %d, want it from GPU_OVERTEMP_CELSIUS", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// kWhTolerance absorbs float rounding in the watts fed to energyKWh
+var kWhTolerance = decimal.New(1, -9)
+
+func assertKWh(t *testing.T, what string, got, want decimal.Decimal) {
+	t.Helper()
+	if got.Sub(want).Abs().GreaterThan(kWhTolerance) {
+		t.Errorf("%s = %s kWh, want %s", what, got, want)
+	}
+}
+
+func TestEnergyKWh(t *testing.T) {
+	tests := []struct {
+		watts    float64
+		interval time.Duration
+		want     string
+	}{
+		{1000, time.Hour, "1"},
+		{450, 90 * time.Minute, "0.675"},
+		{300, 5 * time.Second, "0.000416666667"},
+		{250.5, 30 * time.Second, "0.00208750"},
+		{0, time.Minute, "0"},
+	}
+	for _, tt := range tests {
+		assertKWh(t, "energyKWh("+decimal.NewFromFloat(tt.watts).String()+"W, "+tt.interval.String()+")",
+			energyKWh(tt.watts, tt.interval), decimal.RequireFromString(tt.want))
+	}
+}
+
+func TestJobCPUShare(t *testing.T) {
+	tests := []struct {
+		cpuPercent float64
+		cores      int
+		want       float64
+	}{
+		{200, 8, 0.25},
+		{100, 1, 1},
+		{1600, 8, 1}, // Samples can overshoot the cores there are
+		{50, 0, 0},
+		{0, 8, 0},
+	}
+	for _, tt := range tests {
+		if got := jobCPUShare(tt.cpuPercent, tt.cores); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("jobCPUShare(%v, %d) = %v, want %v", tt.cpuPercent, tt.cores, got, tt.want)
+		}
+	}
+}
+
+// newEnergyTestProvider has four GPUs: two whole cards, a third card and a MIG
+// instance holding 3/7 of it
+func newEnergyTestProvider() *GPUProvider {
+	return &GPUProvider{
+		config:   &common.ProviderConfig{MetricsInterval: 5 * time.Second},
+		logger:   zap.NewNop(),
+		provider: &common.Provider{ID: uuid.New()},
+		gpus: []common.GPUDetail{
+			{UUID: "GPU-0", VRAM: 24576},
+			{UUID: "GPU-1", VRAM: 24576},
+			{UUID: "GPU-2", VRAM: 81920},
+			{UUID: "MIG-2a", VRAM: 40960, ParentUUID: "GPU-2", ComputeSlice: 3.0 / 7},
+		},
+		cpuPower:   newCPUPowerSampler(time.Second),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// energyTestMetrics are the host's GPU metrics; MIG instances report their parent's
+var energyTestMetrics = []GPUMetrics{
+	{Index: 0, UUID: "GPU-0", PowerDraw: 300, UtilizationGPU: 90},
+	{Index: 1, UUID: "GPU-1", PowerDraw: 400, UtilizationGPU: 50},
+	{Index: 2, UUID: "GPU-2", PowerDraw: 350, UtilizationGPU: 70},
+}
+
+func TestJobGPUShares(t *testing.T) {
+	p := newEnergyTestProvider()
+	tests := []struct {
+		name   string
+		job    *ActiveJob
+		uuids  []string
+		shares []float64
+	}{
+		{"whole GPU", &ActiveJob{AssignedGPUIndices: []int{1}}, []string{"GPU-1"}, []float64{1}},
+		{"only the job's GPUs", &ActiveJob{AssignedGPUIndices: []int{0, 1}}, []string{"GPU-0", "GPU-1"}, []float64{1, 1}},
+		{"share of the VRAM", &ActiveJob{
+			AssignedGPUIndices: []int{0},
+			Reservation:        &ResourceReservation{GPUs: []GPUAllocation{{Index: 0, VRAMMB: 6144}}},
+		}, []string{"GPU-0"}, []float64{0.25}},
+		{"MIG slice", &ActiveJob{AssignedGPUIndices: []int{3}}, []string{"GPU-2"}, []float64{3.0 / 7}},
+		{"no GPU", &ActiveJob{}, nil, nil},
+		{"unknown GPU", &ActiveJob{AssignedGPUIndices: []int{7}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := p.jobGPUShares(tt.job, energyTestMetrics)
+			if len(shares) != len(tt.uuids) {
+				t.Fatalf("got %d GPUs, want %d", len(shares), len(tt.uuids))
+			}
+			for i, share := range shares {
+				if share.Metrics.UUID != tt.uuids[i] || math.Abs(share.Share-tt.shares[i]) > 1e-9 {
+					t.Errorf("GPU %d: %s with share %v, want %s with %v", i, share.Metrics.UUID, share.Share, tt.uuids[i], tt.shares[i])
+				}
+			}
+		})
+	}
+
+	// A GPU whose metrics weren't collected is left out
+	if shares := p.jobGPUShares(&ActiveJob{AssignedGPUIndices: []int{0, 1}}, energyTestMetrics[1:]); len(shares) != 1 || shares[0].Metrics.UUID != "GPU-1" {
+		t.Errorf("got %+v, want GPU-1 only", shares)
+	}
+}
+
+func TestSendUsageUpdateAttributesEnergy(t *testing.T) {
+	updates := make(chan UsageUpdateRequest, 1)
+	billing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var update UsageUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			t.Errorf("failed to decode usage update: %v", err)
+		}
+		updates <- update
+	}))
+	defer billing.Close()
+
+	p := newEnergyTestProvider()
+	p.config.BillingServiceURL = billing.URL
+	// The CPUs draw 120W and the job uses half of them
+	p.cpuPower.watts.Store(math.Float64bits(120))
+	p.cpuPower.sampled.Store(true)
+	job := &ActiveJob{
+		Task:               &Task{JobID: "job-1"},
+		BillingSession:     &BillingSessionResponse{},
+		AssignedGPUIndices: []int{0, 3},
+		Reservation:        &ResourceReservation{GPUs: []GPUAllocation{{Index: 0, VRAMMB: 12288}}},
+		ResourceUsage:      ResourceUsage{CPUPercent: 50 * float64(runtime.NumCPU())},
+		GPUMetrics:         energyTestMetrics,
+	}
+	job.BillingSession.Session.ID = uuid.New()
+
+	(&TaskWorker{provider: p, logger: zap.NewNop()}).sendUsageUpdate(job)
+	update := <-updates
+
+	// Half of GPU-0's 300W, 3/7 of GPU-2's 350W and half of the CPUs' 120W, over 5s.
+	// GPU-1 isn't the job's and draws nothing for it.
+	gpuW := 150.0 + 150.0
+	wantKWh := decimal.NewFromFloat((gpuW + 60) * 5 / 3600 / 1000)
+	assertKWh(t, "EnergyUsageKWh", update.EnergyUsageKWh, wantKWh)
+	if update.PowerDraw != 300 {
+		t.Errorf("PowerDraw = %dW, want 300W", update.PowerDraw)
+	}
+	if update.GPUUtilization != 80 {
+		t.Errorf("GPUUtilization = %d%%, want the average of the job's GPUs, 80%%", update.GPUUtilization)
+	}
+
+	gpus, _ := update.CustomMetrics["gpus"].([]interface{})
+	if len(gpus) != 2 {
+		t.Fatalf("got %d GPUs in the breakdown, want 2", len(gpus))
+	}
+	var breakdownKWh decimal.Decimal
+	for _, gpu := range gpus {
+		entry := gpu.(map[string]interface{})
+		kWh, err := decimal.NewFromString(entry["energy_kwh"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		breakdownKWh = breakdownKWh.Add(kWh)
+	}
+	assertKWh(t, "GPU breakdown total", breakdownKWh, decimal.NewFromFloat(gpuW*5/3600/1000))
+	if cpuW, _ := update.CustomMetrics["cpu_power_watts"].(float64); math.Abs(cpuW-60) > 1e-9 {
+		t.Errorf("cpu_power_watts = %v, want 60", cpuW)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runningWorkers counts the goroutines running a task worker's loop
+func runningWorkers() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), ".(*TaskWorker).run(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// waitForWorkers waits for want workers to be running and reports how many there are
+func waitForWorkers(want int) int {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := runningWorkers()
+		if got == want || time.Now().After(deadline) {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorkerPoolStartsMaxConcurrentJobsWorkers(t *testing.T) {
+	if n := runningWorkers(); n != 0 {
+		t.Fatalf("%d workers running before the test", n)
+	}
+	p := newQueueTestProvider(t, 10)
+	p.config.MaxConcurrentJobs = 3
+
+	p.initializeWorkerPool()
+	if got := waitForWorkers(3); got != 3 {
+		t.Fatalf("%d workers running, want 3", got)
+	}
+	// None turn up late
+	time.Sleep(20 * time.Millisecond)
+	if got := runningWorkers(); got != 3 || len(p.workerPool) != 3 {
+		t.Errorf("%d workers running and %d in the pool, want 3", got, len(p.workerPool))
+	}
+
+	p.cancel()
+	p.workers.Wait()
+	if got := waitForWorkers(0); got != 0 {
+		t.Errorf("%d workers still running after stopping", got)
+	}
+}
+
+func TestInitializeOnlyOnce(t *testing.T) {
+	p := newQueueTestProvider(t, 10)
+	p.config.MaxConcurrentJobs = 3
+	// As if Initialize had already run
+	p.initialized = true
+
+	if err := p.Initialize(); err == nil {
+		t.Fatal("second Initialize succeeded")
+	}
+	if got := runningWorkers(); got != 0 || p.workerPool != nil {
+		t.Errorf("second Initialize started %d more workers", got)
+	}
+}
@@ -3,14 +3,18 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	bin "github.com/gagliardetto/binary"
@@ -157,6 +161,12 @@ type JobSubmissionRequest struct {
 	NotificationWebhook string                 `json:"notification_webhook,omitempty"`
 	MetadataCallback    string                 `json:"metadata_callback,omitempty"`
 	CustomParams        map[string]interface{} `json:"custom_params,omitempty"`
+
+	// DryRun returns the placement decision and estimated cost without reserving
+	// funds or dispatching the job
+	DryRun bool `json:"dry_run,omitempty"`
+	// SkipCostCheck submits even if the cost estimate exceeds MaxCostDGPU
+	SkipCostCheck bool `json:"-"`
 }
 
 // ResourceRequirements specifies detailed resource requirements
@@ -206,19 +216,63 @@ type JobSubmissionResponse struct {
 	Timestamp        time.Time       `json:"timestamp"`
 	Message          string          `json:"message"`
 	ValidationErrors []string        `json:"validation_errors,omitempty"`
+
+	// Placement decision, returned for dry runs
+	DryRun       bool   `json:"dry_run,omitempty"`
+	Placeable    bool   `json:"placeable,omitempty"`
+	ProviderID   string `json:"provider_id,omitempty"`
+	ProviderName string `json:"provider_name,omitempty"`
+	Candidates   int    `json:"candidates,omitempty"`
+}
+
+// maxJobBatchSize is the gateway's default cap on jobs per batch submission
+const maxJobBatchSize = 100
+
+// JobBatchRequest submits several jobs at once. Each entry in Jobs is applied over
+// Template (its custom params merged into the template's), so a sweep only needs to
+// set the fields that differ
+type JobBatchRequest struct {
+	Template *JobSubmissionRequest    `json:"template,omitempty"`
+	Jobs     []map[string]interface{} `json:"jobs"`
+}
+
+// JobBatchResult reports what happened to one job of a batch
+type JobBatchResult struct {
+	Index         int             `json:"index"`
+	JobID         string          `json:"job_id,omitempty"`
+	Status        string          `json:"status"`
+	ReservedFunds decimal.Decimal `json:"reserved_funds"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// JobBatchResponse from the gateway for a batch submission
+type JobBatchResponse struct {
+	BatchID       string           `json:"batch_id"`
+	Submitted     int              `json:"submitted"`
+	ReservedFunds decimal.Decimal  `json:"reserved_funds"`
+	Jobs          []JobBatchResult `json:"jobs"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Message       string           `json:"message"`
+	Code          string           `json:"code,omitempty"`
 }
 
 // JobStatusResponse from scheduler with comprehensive details
 type JobStatusResponse struct {
-	JobID         string     `json:"job_id"`
-	UserID        string     `json:"user_id"`
-	SessionID     uuid.UUID  `json:"session_id"`
-	Status        string     `json:"status"`
-	Stage         string     `json:"stage"`
-	Progress      float32    `json:"progress"`
-	ProviderID    *uuid.UUID `json:"provider_id,omitempty"`
-	ProviderName  string     `json:"provider_name,omitempty"`
-	QueuePosition int        `json:"queue_position,omitempty"`
+	JobID          string     `json:"job_id"`
+	UserID         string     `json:"user_id"`
+	SessionID      uuid.UUID  `json:"session_id"`
+	Status         string     `json:"status"`
+	Stage          string     `json:"stage"`
+	Progress       float32    `json:"progress"`
+	ProviderID     *uuid.UUID `json:"provider_id,omitempty"`
+	ProviderName   string     `json:"provider_name,omitempty"`
+	QueuePosition  int        `json:"queue_position,omitempty"`
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+	// Set while the job waits for a provider; no provider is available yet if
+	// Status is "no_provider_available", and Reason says why
+	WaitingSeconds int64  `json:"waiting_seconds,omitempty"`
+	MaxWaitSeconds int64  `json:"max_wait_seconds,omitempty"`
+	Reason         string `json:"reason,omitempty"`
 
 	// Results and output
 	Result    string `json:"result,omitempty"`
@@ -348,6 +402,45 @@ type ProviderFilter struct {
 	Offset          int             `json:"offset,omitempty"`
 }
 
+// QueryParams serializes the filter into provider registry query parameters
+func (f *ProviderFilter) QueryParams() url.Values {
+	q := url.Values{}
+	if f.Location != "" {
+		q.Set("location", f.Location)
+	}
+	if f.GPUModel != "" {
+		q.Set("gpu_model", f.GPUModel)
+	}
+	if f.MinVRAM > 0 {
+		q.Set("min_vram", strconv.FormatUint(f.MinVRAM, 10))
+	}
+	if f.MaxPricePerHour.IsPositive() {
+		q.Set("max_price_per_hour", f.MaxPricePerHour.String())
+	}
+	if f.MinRating > 0 {
+		q.Set("min_rating", strconv.FormatFloat(f.MinRating, 'f', -1, 64))
+	}
+	if f.IsOnline != nil {
+		q.Set("online", strconv.FormatBool(*f.IsOnline))
+	}
+	if f.HasCapacity != nil {
+		q.Set("has_capacity", strconv.FormatBool(*f.HasCapacity))
+	}
+	if f.SortBy != "" {
+		q.Set("sort_by", f.SortBy)
+	}
+	if f.SortOrder != "" {
+		q.Set("sort_order", f.SortOrder)
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Offset > 0 {
+		q.Set("offset", strconv.Itoa(f.Offset))
+	}
+	return q
+}
+
 // SolanaWalletManager manages Solana operations for the client
 type SolanaWalletManager struct {
 	privateKey      solana.PrivateKey
@@ -356,6 +449,17 @@ type SolanaWalletManager struct {
 	tokenMintPubkey solana.PublicKey
 	tokenAccount    solana.PublicKey
 	logger          *zap.Logger
+
+	// Token balances keyed on token account, to avoid hitting RPC rate limits
+	balanceCacheTTL time.Duration
+	balanceMu       sync.Mutex
+	balanceCache    map[solana.PublicKey]cachedTokenBalance
+}
+
+// cachedTokenBalance is a token balance and when it was fetched
+type cachedTokenBalance struct {
+	balance   decimal.Decimal
+	fetchedAt time.Time
 }
 
 // GPURentalClient manages comprehensive GPU rental operations
@@ -383,14 +487,15 @@ func NewGPURentalClient(config *common.GPURentalConfig) (*GPURentalClient, error
 	}
 
 	// Create HTTP client with proper configuration
+	transport, err := common.NewTLSTransport(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %v", err)
+	}
+	transport.MaxIdleConns = 10
+	transport.IdleConnTimeout = 30 * time.Second
 	httpClient := &http.Client{
-		Timeout: config.RequestTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig:    &tls.Config{InsecureSkipVerify: false},
-			MaxIdleConns:       10,
-			IdleConnTimeout:    30 * time.Second,
-			DisableCompression: false,
-		},
+		Timeout:   config.RequestTimeout,
+		Transport: transport,
 	}
 
 	client := &GPURentalClient{
@@ -434,6 +539,13 @@ func getDefaultRentalConfig() *common.GPURentalConfig {
 		EnableAutoRetry:       getenvBoolDefault("ENABLE_AUTO_RETRY", true),
 		MaxRetryAttempts:      getenvIntDefault("MAX_RETRY_ATTEMPTS", 3),
 		EnableNotifications:   getenvBoolDefault("ENABLE_NOTIFICATIONS", true),
+		BalanceCacheTTL:       getenvDurationDefault("TOKEN_BALANCE_CACHE_TTL", 15*time.Second),
+		TLS: common.TLSSettings{
+			CAFile:             os.Getenv("TLS_CA_FILE"),
+			CertFile:           os.Getenv("TLS_CERT_FILE"),
+			KeyFile:            os.Getenv("TLS_KEY_FILE"),
+			InsecureSkipVerify: getenvBoolDefault("TLS_INSECURE_SKIP_VERIFY", false),
+		},
 	}
 }
 
@@ -464,6 +576,15 @@ func getenvDecimalDefault(key, defaultValue string) decimal.Decimal {
 	return decVal
 }
 
+func getenvDurationDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 func getenvBoolDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolVal, err := strconv.ParseBool(value); err == nil {
@@ -507,6 +628,8 @@ func (c *GPURentalClient) initializeSolanaWallet() (*SolanaWalletManager, error)
 		tokenMintPubkey: tokenMintPubkey,
 		tokenAccount:    tokenAccount,
 		logger:          c.logger,
+		balanceCacheTTL: c.config.BalanceCacheTTL,
+		balanceCache:    make(map[solana.PublicKey]cachedTokenBalance),
 	}
 
 	// Test connection
@@ -552,16 +675,33 @@ func (swm *SolanaWalletManager) testConnection() error {
 	return nil
 }
 
-// getTokenBalance gets the dGPU token balance
+// getTokenBalance gets the dGPU token balance, reusing a balance fetched within balanceCacheTTL
 func (swm *SolanaWalletManager) getTokenBalance() (decimal.Decimal, error) {
+	swm.balanceMu.Lock()
+	defer swm.balanceMu.Unlock()
+
+	if cached, ok := swm.balanceCache[swm.tokenAccount]; ok && time.Since(cached.fetchedAt) < swm.balanceCacheTTL {
+		return cached.balance, nil
+	}
+	return swm.fetchTokenBalance()
+}
+
+// ForceRefresh discards the cached token balance and fetches it again. Call it after a
+// deposit or withdrawal so the new balance is shown straight away.
+func (swm *SolanaWalletManager) ForceRefresh() (decimal.Decimal, error) {
+	swm.balanceMu.Lock()
+	defer swm.balanceMu.Unlock()
+
+	delete(swm.balanceCache, swm.tokenAccount)
+	return swm.fetchTokenBalance()
+}
+
+// fetchTokenBalance reads the token balance from RPC and caches it. Caller must hold balanceMu.
+func (swm *SolanaWalletManager) fetchTokenBalance() (decimal.Decimal, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Get associated token account
-	tokenAccount, _, err := solana.FindAssociatedTokenAddress(swm.publicKey, swm.tokenMintPubkey)
-	if err != nil {
-		return decimal.Zero, fmt.Errorf("failed to find associated token account: %w", err)
-	}
+	tokenAccount := swm.tokenAccount
 
 	// Get account info
 	accountInfo, err := swm.rpcClient.GetAccountInfo(ctx, tokenAccount)
@@ -570,6 +710,7 @@ func (swm *SolanaWalletManager) getTokenBalance() (decimal.Decimal, error) {
 	}
 
 	if accountInfo.Value == nil {
+		swm.balanceCache[tokenAccount] = cachedTokenBalance{balance: decimal.Zero, fetchedAt: time.Now()}
 		return decimal.Zero, nil // Account doesn't exist, balance is 0
 	}
 
@@ -583,6 +724,7 @@ func (swm *SolanaWalletManager) getTokenBalance() (decimal.Decimal, error) {
 	// Convert token amount to decimal (assuming 6 decimals for dGPU token)
 	amountBig := new(big.Int).SetUint64(tokenAccountData.Amount)
 	balance := decimal.NewFromBigInt(amountBig, -6)
+	swm.balanceCache[tokenAccount] = cachedTokenBalance{balance: balance, fetchedAt: time.Now()}
 	return balance, nil
 }
 
@@ -614,7 +756,7 @@ func (c *GPURentalClient) refreshTokenIfNeeded() error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("token refresh failed with status %d", resp.StatusCode)
+		return newAPIError("token refresh failed", resp)
 	}
 
 	var authResp AuthResponse
@@ -646,7 +788,123 @@ func (c *GPURentalClient) makeAuthenticatedRequest(method, url string, body io.R
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Dante-GPU-Rental-Client/1.0")
 
-	return c.httpClient.Do(req)
+	return c.doWithRetry(req)
+}
+
+// Backoff between request retries: the first retry waits around retryBaseDelay and
+// each later one twice as long, up to retryMaxDelay. Retry-After is honored up to
+// retryMaxRetryAfter so an interactive session doesn't stall.
+const (
+	retryBaseDelay       = 500 * time.Millisecond
+	retryMaxDelay        = 10 * time.Second
+	retryMaxRetryAfter   = time.Minute
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+// doWithRetry sends req, retrying connection errors and 5xx or 429 responses up to
+// MaxRetryAttempts times with jittered exponential backoff. Only GET and HEAD
+// requests, and requests carrying an Idempotency-Key, are retried, since repeating
+// anything else could apply it twice.
+func (c *GPURentalClient) doWithRetry(req *http.Request) (*http.Response, error) {
+	maxRetries := 0
+	if c.config.EnableAutoRetry && isRetrySafe(req) {
+		maxRetries = c.config.MaxRetryAttempts
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= maxRetries || !isRetryableResponse(resp, err) {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		fields := []zap.Field{
+			zap.String("method", req.Method),
+			zap.String("url", req.URL.Redacted()),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", delay),
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		} else {
+			fields = append(fields, zap.Int("status", resp.StatusCode))
+		}
+		c.logger.Warn("Request failed, retrying", fields...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetrySafe reports whether req can be sent again without side effects
+func isRetrySafe(req *http.Request) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true
+	}
+	return req.Header.Get(idempotencyKeyHeader) != "" && (req.Body == nil || req.GetBody != nil)
+}
+
+// isRetryableResponse reports whether a request failed in a way worth retrying
+func isRetryableResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryDelay returns how long to wait before retrying after attempt, taken from
+// the response's Retry-After header when it has one
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if delay > retryMaxRetryAfter {
+				delay = retryMaxRetryAfter
+			}
+			return delay
+		}
+	}
+
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	// Jitter within the upper half so concurrent clients spread out
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
 }
 
 // getUserProfile gets the user profile information
@@ -658,7 +916,7 @@ func (c *GPURentalClient) getUserProfile() error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("get profile failed with status %d", resp.StatusCode)
+		return newAPIError("get profile failed", resp)
 	}
 
 	var profile UserProfile
@@ -718,7 +976,7 @@ func (c *GPURentalClient) authenticate() error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("authentication failed with status %d", resp.StatusCode)
+		return newAPIError("authentication failed", resp)
 	}
 
 	var authResp AuthResponse
@@ -762,14 +1020,14 @@ func (c *GPURentalClient) getUserWallet() (*WalletResponse, error) {
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get wallet: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to get wallet", resp)
 	}
 
 	var wallet WalletResponse
@@ -800,14 +1058,14 @@ func (c *GPURentalClient) createWallet() (*WalletResponse, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to create wallet: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to create wallet", resp)
 	}
 
 	var wallet WalletResponse
@@ -827,14 +1085,14 @@ func (c *GPURentalClient) GetWalletBalance() (*BalanceResponse, error) {
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get balance: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to get balance", resp)
 	}
 
 	var balance BalanceResponse
@@ -859,14 +1117,14 @@ func (c *GPURentalClient) ListAvailableProviders(filters map[string]string) ([]c
 	}
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list providers: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to list providers", resp)
 	}
 
 	var providers []common.Provider
@@ -877,6 +1135,42 @@ func (c *GPURentalClient) ListAvailableProviders(filters map[string]string) ([]c
 	return providers, nil
 }
 
+// ListProviders retrieves one page of providers matching filter. It also returns
+// the total number of matching providers so callers can page through results.
+func (c *GPURentalClient) ListProviders(filter *ProviderFilter) ([]common.Provider, int, error) {
+	req, err := http.NewRequest("GET", c.config.ProviderRegistryURL+"/api/providers", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter != nil {
+		req.URL.RawQuery = filter.QueryParams().Encode()
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, newAPIError("failed to list providers", resp)
+	}
+
+	var providers []common.Provider
+	if err := json.NewDecoder(resp.Body).Decode(&providers); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(providers)
+	if header := resp.Header.Get("X-Total-Count"); header != "" {
+		if n, err := strconv.Atoi(header); err == nil {
+			total = n
+		}
+	}
+
+	return providers, total, nil
+}
+
 // EstimateJobCost estimates the cost of running a job
 func (c *GPURentalClient) EstimateJobCost(req *PricingEstimateRequest) (*PricingEstimateResponse, error) {
 	jsonData, err := json.Marshal(req)
@@ -891,14 +1185,14 @@ func (c *GPURentalClient) EstimateJobCost(req *PricingEstimateRequest) (*Pricing
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.doWithRetry(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to estimate cost: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to estimate cost", resp)
 	}
 
 	var estimate PricingEstimateResponse
@@ -909,8 +1203,98 @@ func (c *GPURentalClient) EstimateJobCost(req *PricingEstimateRequest) (*Pricing
 	return &estimate, nil
 }
 
-// SubmitJob submits a new job for execution
+// Errors an *APIError matches with errors.Is, by the code the gateway answered with
+var (
+	ErrValidation          = errors.New("request is invalid")
+	ErrUnauthorized        = errors.New("not authorized")
+	ErrNotFound            = errors.New("not found")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrSpendingLimit       = errors.New("spending limit exceeded")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrConcurrentJobLimit  = errors.New("concurrent job limit reached")
+	ErrNoProviderAvailable = errors.New("no provider available")
+)
+
+// apiErrorCodes maps the gateway's error codes to the errors they match
+var apiErrorCodes = map[string]error{
+	"INVALID_REQUEST":         ErrValidation,
+	"VALIDATION_ERROR":        ErrValidation,
+	"UNAUTHORIZED":            ErrUnauthorized,
+	"FORBIDDEN":               ErrUnauthorized,
+	"NOT_FOUND":               ErrNotFound,
+	"INSUFFICIENT_FUNDS":      ErrInsufficientFunds,
+	"SPENDING_LIMIT_EXCEEDED": ErrSpendingLimit,
+	"RATE_LIMITED":            ErrRateLimited,
+	"CONCURRENT_JOB_LIMIT":    ErrConcurrentJobLimit,
+	"NO_PROVIDER_AVAILABLE":   ErrNoProviderAvailable,
+}
+
+// APIError is an error response from the gateway. Code is one of the gateway's error
+// codes, such as INSUFFICIENT_FUNDS; use errors.Is with the Err variables above to check for one.
+type APIError struct {
+	Op         string
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s: status %d", e.Op, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	return target != nil && apiErrorCodes[e.Code] == target
+}
+
+// ValidationErrors returns the problems the gateway found with a rejected job submission
+func (e *APIError) ValidationErrors() []string {
+	list, _ := e.Details["validation_errors"].([]interface{})
+	errs := make([]string, 0, len(list))
+	for _, item := range list {
+		if msg, ok := item.(string); ok {
+			errs = append(errs, msg)
+		}
+	}
+	return errs
+}
+
+// newAPIError reads the error response resp into an *APIError. Bodies that aren't the
+// gateway's error envelope, such as those of older gateways, become the message.
+func newAPIError(op string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return parseAPIError(op, resp.StatusCode, body)
+}
+
+func parseAPIError(op string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Op: op, StatusCode: statusCode}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" {
+		apiErr.Code = ""
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+// ErrCostCeilingExceeded is returned by SubmitJob when the estimated cost of a job is above its MaxCostDGPU
+var ErrCostCeilingExceeded = errors.New("estimated job cost exceeds max cost")
+
+// SubmitJob submits a new job for execution. Unless the request is a dry run or
+// sets SkipCostCheck, the job's cost is estimated first and the job is not
+// submitted if the estimate exceeds MaxCostDGPU.
 func (c *GPURentalClient) SubmitJob(req *JobSubmissionRequest) (*JobSubmissionResponse, error) {
+	if !req.DryRun && !req.SkipCostCheck {
+		if err := c.checkCostCeiling(req); err != nil {
+			return nil, err
+		}
+	}
+
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
@@ -922,15 +1306,21 @@ func (c *GPURentalClient) SubmitJob(req *JobSubmissionRequest) (*JobSubmissionRe
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
+	// The gateway answers retries carrying the same key with the original response
+	httpReq.Header.Set(idempotencyKeyHeader, uuid.New().String())
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.doWithRetry(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to submit job: status %d", resp.StatusCode)
+	expectedStatus := http.StatusCreated
+	if req.DryRun {
+		expectedStatus = http.StatusOK
+	}
+	if resp.StatusCode != expectedStatus {
+		return nil, newAPIError("failed to submit job", resp)
 	}
 
 	var jobResp JobSubmissionResponse
@@ -941,6 +1331,94 @@ func (c *GPURentalClient) SubmitJob(req *JobSubmissionRequest) (*JobSubmissionRe
 	return &jobResp, nil
 }
 
+// SubmitJobBatch submits a batch of jobs. The gateway reserves funds for the whole
+// batch at once, so either every job is submitted or, if a job is invalid or the wallet
+// can't cover them all, none is. Per-job results are returned along with the error.
+func (c *GPURentalClient) SubmitJobBatch(req *JobBatchRequest) (*JobBatchResponse, error) {
+	if len(req.Jobs) == 0 {
+		return nil, fmt.Errorf("batch has no jobs")
+	}
+	if len(req.Jobs) > maxJobBatchSize {
+		return nil, fmt.Errorf("batch has %d jobs, at most %d are allowed", len(req.Jobs), maxJobBatchSize)
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", c.config.APIGatewayURL+"/jobs/batch", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
+	httpReq.Header.Set(idempotencyKeyHeader, uuid.New().String())
+
+	resp, err := c.doWithRetry(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var batchResp JobBatchResponse
+	if jsonErr := json.Unmarshal(body, &batchResp); jsonErr != nil || batchResp.BatchID == "" {
+		// Rejections such as an oversized batch or insufficient funds are error envelopes
+		return nil, parseAPIError("failed to submit job batch", resp.StatusCode, body)
+	}
+	if resp.StatusCode != http.StatusAccepted || batchResp.Submitted < len(req.Jobs) {
+		return &batchResp, &APIError{
+			Op:         "failed to submit job batch",
+			StatusCode: resp.StatusCode,
+			Code:       batchResp.Code,
+			Message:    batchResp.Message,
+		}
+	}
+
+	return &batchResp, nil
+}
+
+// checkCostCeiling estimates the job's cost and refuses it if the estimate exceeds
+// MaxCostDGPU, or the configured default ceiling when the job sets none
+func (c *GPURentalClient) checkCostCeiling(req *JobSubmissionRequest) error {
+	ceiling := req.MaxCostDGPU
+	if !ceiling.IsPositive() {
+		ceiling = c.config.DefaultMaxCostDGPU
+	}
+	if !ceiling.IsPositive() {
+		return nil
+	}
+
+	durationMinutes := req.MaxDurationMinutes
+	if durationMinutes <= 0 {
+		durationMinutes = c.config.DefaultMaxDurationHrs * 60
+	}
+
+	estimate, err := c.EstimateJobCost(&PricingEstimateRequest{
+		GPUModel:        req.Requirements.GPUModel,
+		RequestedVRAMGB: int(req.Requirements.GPUMemoryMB / 1024),
+		DurationHours:   decimal.NewFromInt(int64(durationMinutes)).Div(decimal.NewFromInt(60)),
+		Location:        req.PreferredLocation,
+		CPUCores:        req.Requirements.CPUCores,
+		MemoryGB:        int(req.Requirements.MemoryMB / 1024),
+		StorageGB:       int(req.Requirements.DiskSpaceMB / 1024),
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify job cost against max cost %s dGPU (use SkipCostCheck to submit anyway): %w", ceiling.String(), err)
+	}
+
+	if estimate.TotalCost.GreaterThan(ceiling) {
+		return fmt.Errorf("%w: estimated %s dGPU, max %s dGPU (raise the max cost or use SkipCostCheck to submit anyway)",
+			ErrCostCeilingExceeded, estimate.TotalCost.StringFixed(4), ceiling.StringFixed(4))
+	}
+	return nil
+}
+
 // GetJobStatus retrieves the current status of a job
 func (c *GPURentalClient) GetJobStatus(jobID string) (*JobStatusResponse, error) {
 	req, err := http.NewRequest("GET", c.config.APIGatewayURL+"/jobs/"+jobID, nil)
@@ -949,14 +1427,14 @@ func (c *GPURentalClient) GetJobStatus(jobID string) (*JobStatusResponse, error)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get job status: status %d", resp.StatusCode)
+		return nil, newAPIError("failed to get job status", resp)
 	}
 
 	var status JobStatusResponse
@@ -975,14 +1453,14 @@ func (c *GPURentalClient) CancelJob(jobID string) error {
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to cancel job: status %d", resp.StatusCode)
+		return newAPIError("failed to cancel job", resp)
 	}
 
 	return nil
@@ -1099,6 +1577,12 @@ func (c *GPURentalClient) runInteractiveMode() error {
 				fmt.Printf("\n=== Job Status ===\n")
 				fmt.Printf("Job ID: %s\n", status.JobID)
 				fmt.Printf("Status: %s\n", status.Status)
+				if status.QueuePosition > 0 {
+					fmt.Printf("Queue Position: %d\n", status.QueuePosition)
+				}
+				if status.EstimatedStart != nil {
+					fmt.Printf("Estimated Start: %s\n", status.EstimatedStart.Local().Format(time.RFC1123))
+				}
 				fmt.Printf("Progress: %.2f%%\n", status.Progress*100)
 				if status.Error != "" {
 					fmt.Printf("Error: %s\n", status.Error)
@@ -1284,6 +1768,10 @@ func (c *GPURentalClient) estimateJobCost() {
 	fmt.Printf("Total Cost: %s dGPU\n", estimate.TotalCost.StringFixed(4))
 	fmt.Printf("Platform Fee: %s dGPU\n", estimate.PlatformFee.StringFixed(4))
 	fmt.Printf("Provider Earnings: %s dGPU\n", estimate.ProviderEarnings.StringFixed(4))
+	if !estimate.EstimatedEnergyKWh.IsZero() {
+		fmt.Printf("Estimated Energy: %s kWh\n", estimate.EstimatedEnergyKWh.StringFixed(3))
+		fmt.Printf("Carbon Footprint: %s kg CO2\n", estimate.CarbonFootprintKg.StringFixed(3))
+	}
 }
 
 func main() {
@@ -1353,6 +1841,11 @@ func main() {
 			fmt.Printf("Available Balance: %s dGPU tokens\n", balance.AvailableBalance.StringFixed(4))
 
 		case "submit":
+			if len(os.Args) < 3 {
+				fmt.Println("Usage: rental submit <job_name> [--dry-run] [--skip-cost-check]")
+				os.Exit(1)
+			}
+
 			// Quick job submission
 			req := &JobSubmissionRequest{
 				Type:        "ai-training",
@@ -1368,12 +1861,29 @@ func main() {
 					"framework": "pytorch",
 				},
 			}
+			for _, arg := range os.Args[3:] {
+				switch arg {
+				case "--dry-run":
+					req.DryRun = true
+				case "--skip-cost-check":
+					req.SkipCostCheck = true
+				}
+			}
 
 			resp, err := client.SubmitJob(req)
 			if err != nil {
 				fmt.Printf("Error: %v\n", err)
 				os.Exit(1)
 			}
+			if resp.DryRun {
+				if resp.Placeable {
+					fmt.Printf("Dry run: job would be placed on %s (%s), %d candidate providers\n", resp.ProviderName, resp.ProviderID, resp.Candidates)
+				} else {
+					fmt.Printf("Dry run: %s\n", resp.Message)
+				}
+				fmt.Printf("Estimated Cost: %s dGPU\n", resp.EstimatedCost.String())
+				break
+			}
 			fmt.Printf("Job ID: %s\n", resp.JobID)
 
 		case "status":
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dante-backend/common"
+
+	"go.uber.org/zap"
+)
+
+// flakyGateway fails the first failures requests with status, then answers 200. Failed
+// responses ask for an immediate retry so the tests don't wait out the backoff.
+type flakyGateway struct {
+	mu       sync.Mutex
+	failures int
+	status   int // 0 drops the connection instead
+	bodies   []string
+	keys     []string
+}
+
+func (g *flakyGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	g.bodies = append(g.bodies, string(body))
+	g.keys = append(g.keys, r.Header.Get(idempotencyKeyHeader))
+	fail := len(g.bodies) <= g.failures
+	g.mu.Unlock()
+
+	switch {
+	case fail && g.status == 0:
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	case fail:
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(g.status)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"job_id":"job-1","status":"running"}`))
+	}
+}
+
+func (g *flakyGateway) requests() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.bodies)
+}
+
+func newRetryTestClient(t *testing.T, gateway *flakyGateway, maxRetries int) *GPURentalClient {
+	t.Helper()
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	return &GPURentalClient{
+		config: &common.GPURentalConfig{
+			APIGatewayURL:    server.URL,
+			EnableAutoRetry:  true,
+			MaxRetryAttempts: maxRetries,
+		},
+		logger:     zap.NewNop(),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func TestGetRetriesTransientFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		gateway  *flakyGateway
+		requests int
+	}{
+		{"bad gateway", &flakyGateway{failures: 2, status: http.StatusBadGateway}, 3},
+		{"unavailable", &flakyGateway{failures: 1, status: http.StatusServiceUnavailable}, 2},
+		{"rate limited", &flakyGateway{failures: 1, status: http.StatusTooManyRequests}, 2},
+		{"connection dropped", &flakyGateway{failures: 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRetryTestClient(t, tt.gateway, 3)
+			status, err := c.GetJobStatus("job-1")
+			if err != nil {
+				t.Fatalf("GetJobStatus: %v", err)
+			}
+			if status.JobID != "job-1" {
+				t.Errorf("got job %q", status.JobID)
+			}
+			if got := tt.gateway.requests(); got != tt.requests {
+				t.Errorf("%d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestGetGivesUpAfterMaxRetryAttempts(t *testing.T) {
+	gateway := &flakyGateway{failures: 10, status: http.StatusBadGateway}
+	c := newRetryTestClient(t, gateway, 2)
+
+	_, err := c.GetJobStatus("job-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got %v, want the last 502", err)
+	}
+	if got := gateway.requests(); got != 3 {
+		t.Errorf("%d requests, want the first and 2 retries", got)
+	}
+}
+
+func TestRequestsNotRetried(t *testing.T) {
+	tests := []struct {
+		name    string
+		gateway *flakyGateway
+		retry   bool
+		request func(url string) *http.Request
+	}{
+		{"client error", &flakyGateway{failures: 1, status: http.StatusNotFound}, true, func(url string) *http.Request {
+			req, _ := http.NewRequest("GET", url, nil)
+			return req
+		}},
+		{"POST without idempotency key", &flakyGateway{failures: 1, status: http.StatusServiceUnavailable}, true, func(url string) *http.Request {
+			req, _ := http.NewRequest("POST", url, bytes.NewBufferString(`{}`))
+			return req
+		}},
+		{"DELETE without idempotency key", &flakyGateway{failures: 1, status: http.StatusBadGateway}, true, func(url string) *http.Request {
+			req, _ := http.NewRequest("DELETE", url, nil)
+			return req
+		}},
+		{"auto retry disabled", &flakyGateway{failures: 1, status: http.StatusBadGateway}, false, func(url string) *http.Request {
+			req, _ := http.NewRequest("GET", url, nil)
+			return req
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRetryTestClient(t, tt.gateway, 3)
+			c.config.EnableAutoRetry = tt.retry
+			resp, err := c.doWithRetry(tt.request(c.config.APIGatewayURL + "/jobs/job-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := tt.gateway.requests(); got != 1 {
+				t.Errorf("%d requests, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPostWithIdempotencyKeyRetried(t *testing.T) {
+	gateway := &flakyGateway{failures: 2, status: http.StatusServiceUnavailable}
+	c := newRetryTestClient(t, gateway, 3)
+
+	req, _ := http.NewRequest("POST", c.config.APIGatewayURL+"/jobs", bytes.NewBufferString(`{"name":"train"}`))
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || gateway.requests() != 3 {
+		t.Fatalf("status %d after %d requests, want 200 after 3", resp.StatusCode, gateway.requests())
+	}
+	// Every attempt carries the same body and key
+	for i := range gateway.bodies {
+		if gateway.bodies[i] != `{"name":"train"}` || gateway.keys[i] != "key-1" {
+			t.Errorf("attempt %d sent %q with key %q", i+1, gateway.bodies[i], gateway.keys[i])
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+	if got := retryDelay(0, withRetryAfter("3")); got != 3*time.Second {
+		t.Errorf("Retry-After 3: waited %v", got)
+	}
+	if got := retryDelay(0, withRetryAfter("3600")); got != retryMaxRetryAfter {
+		t.Errorf("Retry-After 3600: waited %v, want it capped at %v", got, retryMaxRetryAfter)
+	}
+	if got := retryDelay(0, withRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))); got != 0 {
+		t.Errorf("Retry-After in the past: waited %v", got)
+	}
+	if got := retryDelay(0, withRetryAfter(time.Now().Add(30*time.Second).UTC().Format(http.TimeFormat))); got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("Retry-After 30s from now: waited %v", got)
+	}
+
+	// Without Retry-After the backoff doubles with jitter in its upper half, up to the cap
+	for attempt := 0; attempt < 8; attempt++ {
+		limit := retryBaseDelay << attempt
+		if limit > retryMaxDelay {
+			limit = retryMaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			if got := retryDelay(attempt, withRetryAfter("soon")); got < limit/2 || got > limit {
+				t.Fatalf("attempt %d waited %v, want between %v and %v", attempt, got, limit/2, limit)
+			}
+		}
+	}
+}
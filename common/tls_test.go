@@ -0,0 +1,166 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority that issues server certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue returns a server certificate for the given DNS names and IP addresses
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips []net.IP) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSServer serves TLS on a loopback IP address with cert and returns its URL
+func startTLSServer(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func get(transport *http.Transport, url string) error {
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestNewTLSTransportVerifiesDialedHost(t *testing.T) {
+	ca := newTestCA(t)
+	loopback := []net.IP{net.ParseIP("127.0.0.1")}
+
+	tests := []struct {
+		name     string
+		ca       string
+		dnsNames []string
+		ips      []net.IP
+		wantErr  bool
+	}{
+		{"certificate for the dialed IP", ca.file, nil, loopback, false},
+		{"certificate for another host", ca.file, []string{"other.internal"}, []net.IP{net.ParseIP("10.0.0.1")}, true},
+		{"certificate from another CA", newTestCA(t).file, nil, loopback, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := startTLSServer(t, ca.issue(t, tt.dnsNames, tt.ips))
+			transport, err := NewTLSTransport(TLSSettings{CAFile: tt.ca})
+			if err != nil {
+				t.Fatalf("NewTLSTransport: %v", err)
+			}
+			if err := get(transport, url); (err != nil) != tt.wantErr {
+				t.Errorf("request error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigServerName(t *testing.T) {
+	ca := newTestCA(t)
+	url := startTLSServer(t, ca.issue(t, []string{"service.internal"}, []net.IP{net.ParseIP("127.0.0.1")}))
+
+	tests := []struct {
+		name       string
+		serverName string
+		wantErr    bool
+	}{
+		// An IP address isn't sent as the server name, so there's nothing to verify
+		// the certificate against
+		{"dial by IP", "", true},
+		{"matching server name", "service.internal", false},
+		{"wrong server name", "other.internal", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewTLSConfig(TLSSettings{CAFile: ca.file})
+			if err != nil {
+				t.Fatalf("NewTLSConfig: %v", err)
+			}
+			config.ServerName = tt.serverName
+			if err := get(&http.Transport{TLSClientConfig: config}, url); (err != nil) != tt.wantErr {
+				t.Errorf("request error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigRequiresCertificateAndKey(t *testing.T) {
+	if _, err := NewTLSConfig(TLSSettings{CertFile: "client.pem"}); err == nil {
+		t.Error("client certificate without a key accepted")
+	}
+}
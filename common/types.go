@@ -18,6 +18,15 @@ type GPUDetail struct {
 	TensorCores       uint32 `json:"tensor_cores,omitempty"`
 	MemoryBandwidth   uint64 `json:"memory_bandwidth_gb_s,omitempty"`
 	PowerConsumption  uint32 `json:"power_consumption_w,omitempty"`
+	UUID              string `json:"uuid,omitempty"`
+
+	// MIG instance details, set when the GPU is a slice of a MIG-enabled card
+	MIGProfile   string  `json:"mig_profile,omitempty"` // e.g. 3g.20gb
+	ParentUUID   string  `json:"parent_uuid,omitempty"`
+	ComputeSlice float64 `json:"compute_slice,omitempty"` // Fraction of the parent GPU's compute
+
+	// Latest self-benchmark, if the provider has run one
+	Benchmark *GPUBenchmark `json:"benchmark,omitempty"`
 
 	// Current metrics
 	UtilizationGPU uint8  `json:"utilization_gpu_percent,omitempty"`
@@ -31,6 +40,15 @@ type GPUDetail struct {
 	LastCheckAt time.Time `json:"last_check_at,omitempty"`
 }
 
+// GPUBenchmark holds measured GPU performance from the provider daemon's
+// --benchmark-json self-benchmark
+type GPUBenchmark struct {
+	FP16TFLOPS         float64   `json:"fp16_tflops"`
+	MemoryBandwidthGBs float64   `json:"memory_bandwidth_gb_s"`
+	StabilityScore     float64   `json:"stability_score"` // 0-1, 1 means no variation between samples
+	RunAt              time.Time `json:"run_at"`
+}
+
 // Provider represents a GPU provider in the system
 type Provider struct {
 	ID         uuid.UUID        `json:"id"`
@@ -68,8 +86,13 @@ type ProviderConfig struct {
 	APIGatewayURL       string `json:"api_gateway_url"`
 	ProviderRegistryURL string `json:"provider_registry_url"`
 	BillingServiceURL   string `json:"billing_service_url"`
+	StorageServiceURL   string `json:"storage_service_url"`
 	NATSAddress         string `json:"nats_address"`
 
+	// Publish usage updates over NATS instead of POSTing them to the billing service,
+	// which they still go to while NATS is disconnected
+	UsageUpdatesViaNATS bool `json:"usage_updates_via_nats"`
+
 	// Provider settings
 	SolanaWalletAddress string          `json:"solana_wallet_address"`
 	MaxConcurrentJobs   int             `json:"max_concurrent_jobs"`
@@ -80,9 +103,116 @@ type ProviderConfig struct {
 	RequestTimeout    time.Duration `json:"request_timeout"`
 	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
 	MetricsInterval   time.Duration `json:"metrics_interval"`
+	// Window host CPU usage is measured over; a background sampler keeps the latest
+	// value so metrics collection never waits on it
+	CPUSampleWindow time.Duration `json:"cpu_sample_window"`
 
 	// Optional workspace settings
 	WorkspaceDir string `json:"workspace_dir,omitempty"`
+	// Age after which a workspace left behind by a job that is no longer running is
+	// removed when the provider starts
+	WorkspaceOrphanTTL time.Duration `json:"workspace_orphan_ttl"`
+
+	// Input download retries; interrupted downloads resume via HTTP range
+	// requests when the server supports them
+	MaxDownloadRetries   int           `json:"max_download_retries"`
+	DownloadRetryBackoff time.Duration `json:"download_retry_backoff"`
+
+	// Input files downloaded at the same time per job
+	MaxParallelDownloads int `json:"max_parallel_downloads"`
+
+	// Output upload retries on 5xx responses
+	MaxUploadRetries   int           `json:"max_upload_retries"`
+	UploadRetryBackoff time.Duration `json:"upload_retry_backoff"`
+
+	// Time a canceled job gets to exit after SIGTERM before it is killed
+	CancelGracePeriod time.Duration `json:"cancel_grace_period"`
+
+	// Time running jobs get to finish after a shutdown signal before they are canceled
+	DrainTimeout time.Duration `json:"drain_timeout"`
+
+	// Interactive exec sessions into running job containers, opened by the job's owner
+	// through the gateway. Disabled unless AllowInteractiveExec is set; sessions end
+	// after ExecSessionTimeout.
+	AllowInteractiveExec bool          `json:"allow_interactive_exec"`
+	ExecSessionTimeout   time.Duration `json:"exec_session_timeout"`
+
+	// WASI runtime binary (wasmtime or wazero) for WebAssembly tasks; empty
+	// disables them
+	WASMRuntimePath string `json:"wasm_runtime_path,omitempty"`
+
+	// Container image policy, checked before an image is pulled
+	ImagePolicy ImagePolicy `json:"image_policy"`
+
+	// Private registry credentials keyed by registry host, e.g. ghcr.io. Hosts
+	// not listed fall back to the Docker config in DOCKER_CONFIG or ~/.docker
+	RegistryCredentials map[string]RegistryCredential `json:"registry_credentials,omitempty"`
+
+	// JSON output of the provider daemon's --benchmark-json, attached to the
+	// matching GPUs at registration and in heartbeats
+	BenchmarkResultsPath string `json:"benchmark_results_path,omitempty"`
+
+	// Operator alerts, e.g. GPU overheating or the billing service failing
+	Alerts AlertSettings `json:"alerts"`
+
+	// GPUs at or above GPUThrottleCelsius take no new jobs until they cool to
+	// GPUResumeCelsius, or a few degrees below the threshold if that is 0. A
+	// GPUThrottleCelsius of 0 disables thermal throttling
+	GPUThrottleCelsius uint8 `json:"gpu_throttle_celsius"`
+	GPUResumeCelsius   uint8 `json:"gpu_resume_celsius"`
+
+	// Loopback port for the local status API reporting health checks; 0 disables it
+	StatusAPIPort int `json:"status_api_port"`
+
+	// TLS for requests to the platform services
+	TLS TLSSettings `json:"tls"`
+
+	// Backends that secret:// references in task environments are resolved from
+	Secrets SecretSettings `json:"secrets"`
+}
+
+// SecretSettings configures where the provider resolves secret references such as
+// secret://vault/hf-token. The backend is the reference's host: env reads EnvFile,
+// vault reads Vault's KV v2 engine and storage reads StorageBucket from the
+// storage-service. A reference is looked up under users/<user_id>/ for the user who
+// submitted the task, e.g. secret://vault/hf-token reads <mount>/users/<user_id>/hf-token.
+type SecretSettings struct {
+	EnvFile       string `json:"env_file,omitempty"` // users/<user_id>/KEY=value lines, for secret://env/KEY
+	VaultAddress  string `json:"vault_address,omitempty"`
+	VaultToken    string `json:"vault_token,omitempty"`
+	VaultMount    string `json:"vault_mount"`    // KV v2 mount, for secret://vault/<path>[#field]
+	StorageBucket string `json:"storage_bucket"` // For secret://storage/<key>
+}
+
+// AlertSettings controls where provider alerts are delivered. Alerts at or
+// above MinSeverity are posted to WebhookURL and emailed when SMTP is configured
+type AlertSettings struct {
+	WebhookURL  string        `json:"webhook_url,omitempty"`
+	MinSeverity string        `json:"min_severity"` // info, warning or critical
+	Cooldown    time.Duration `json:"cooldown"`     // Repeats of an unresolved alert within this window are dropped
+
+	SMTPHost     string   `json:"smtp_host,omitempty"`
+	SMTPPort     int      `json:"smtp_port,omitempty"`
+	SMTPUsername string   `json:"smtp_username,omitempty"`
+	SMTPPassword string   `json:"smtp_password,omitempty"`
+	EmailFrom    string   `json:"email_from,omitempty"`
+	EmailTo      []string `json:"email_to,omitempty"`
+}
+
+// RegistryCredential authenticates image pulls from a private registry
+type RegistryCredential struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identity_token,omitempty"` // OAuth refresh token, used instead of a password
+}
+
+// ImagePolicy restricts which container images tasks may run. Patterns are
+// globs matched against fully qualified references such as
+// docker.io/tensorflow/*, docker.io/library/ubuntu or ghcr.io/org/repo:1.*
+type ImagePolicy struct {
+	AllowedImages        []string `json:"allowed_images,omitempty"` // Empty allows any image not denied
+	DeniedImages         []string `json:"denied_images,omitempty"`  // Takes precedence over AllowedImages
+	RequireDigestPinning bool     `json:"require_digest_pinning"`   // Images must be referenced by @sha256: digest
 }
 
 // GPURentalConfig holds configuration for the GPU rental client
@@ -104,4 +234,6 @@ type GPURentalConfig struct {
 	EnableAutoRetry       bool            `json:"enable_auto_retry"`
 	MaxRetryAttempts      int             `json:"max_retry_attempts"`
 	EnableNotifications   bool            `json:"enable_notifications"`
+	BalanceCacheTTL       time.Duration   `json:"balance_cache_ttl"` // How long a fetched token balance is reused
+	TLS                   TLSSettings     `json:"tls"`               // TLS for requests to the platform services
 }
@@ -21,12 +21,13 @@ import (
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/config"
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/executor"
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/gpu"
+	"github.com/dante-gpu/dante-backend/provider-daemon/internal/localapi"
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/models"
 	cli_models "github.com/dante-gpu/dante-backend/provider-daemon/internal/models" // Alias for cli response models
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/nats"
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/tasks"
 
-	// "github.com/google/uuid" // Will be needed for other CLI commands or if instance ID generation is reactivated here
+	"github.com/google/uuid"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
@@ -34,6 +35,7 @@ import (
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -51,22 +53,24 @@ var (
 	gpuIDForConfig          = flag.String("gpu-id", "", "GPU ID for --set-gpu-config-json (e.g., nvidia-0)")
 	rateForConfig           = flag.Float64("rate", -1.0, "Hourly rate in DGPU. A non-negative value updates the rate. For --set-gpu-config-json.")
 	availableForConfig      = flag.String("available", "", "Availability for rent ('true' or 'false'). For --set-gpu-config-json.")
-	getLocalJobsJSON        = flag.Bool("get-local-jobs-json", false, "Get current local jobs as JSON, then exit (currently placeholder).")
+	getLocalJobsJSON        = flag.Bool("get-local-jobs-json", false, "Get current local jobs from the running daemon as JSON, then exit.")
 	getNetworkStatusJSON    = flag.Bool("get-network-status-json", false, "Get NATS connection status as JSON, then exit.")
-	getFinancialSummaryJSON = flag.Bool("get-financial-summary-json", false, "Get financial summary as JSON, then exit (currently placeholder).")
+	getFinancialSummaryJSON = flag.Bool("get-financial-summary-json", false, "Get financial summary as JSON, then exit.")
 	getSystemOverviewJSON   = flag.Bool("get-system-overview-json", false, "Get system overview (CPU, RAM, Disk, Uptime) as JSON, then exit.")
+	benchmarkJSON           = flag.Bool("benchmark-json", false, "Benchmark each GPU (FP16 TFLOPS, memory bandwidth, stability) and output as JSON, then exit. Cached results are reused until the hardware changes.")
 )
 
 func main() {
 	flag.Parse() // Parse all defined CLI flags
 
-	tempLogger, _ := setupLogger("info")
+	// Until the configuration is loaded the log file rotates at lumberjack's default size
+	tempLogger, _ := setupLogger("info", config.LogRotationSettings{})
 	cfg, err := config.LoadConfig(*configPath, tempLogger)
 	if err != nil {
 		tempLogger.Fatal("Failed to load configuration", zap.Error(err), zap.String("path", *configPath))
 	}
 
-	logger, err := setupLogger(cfg.LogLevel)
+	logger, err := setupLogger(cfg.LogLevel, cfg.LogRotation)
 	if err != nil {
 		tempLogger.Fatal("Failed to setup logger with config level", zap.Error(err))
 	}
@@ -106,6 +110,10 @@ func main() {
 		handleGetSystemOverviewJSON(cfg, logger)
 		return
 	}
+	if *benchmarkJSON {
+		handleBenchmarkJSON(cfg, *configPath, logger)
+		return
+	}
 	// Add other CLI command handlers here as they are implemented
 
 	// --- Start Daemon Mode (if no CLI command was executed) ---
@@ -151,6 +159,25 @@ func main() {
 	}
 	defer natsClient.Stop()
 
+	// Start the local status API so CLI commands and the GUI can query this running instance.
+	var localAPI *localapi.Server
+	if cfg.LocalAPIPort > 0 {
+		localAPI = localapi.NewServer(cfg.LocalAPIPort, logger, taskHandler,
+			func() cli_models.CliNetworkStatus {
+				return networkStatusFromClient(natsClient)
+			},
+			func(ctx context.Context) cli_models.CliFinancialSummary {
+				return fetchFinancialSummary(ctx, billingClient, cfg.ProviderID, logger)
+			},
+			gpuDetector.GetMetrics,
+		)
+		if err := localAPI.Start(); err != nil {
+			// Not fatal: the daemon can still process tasks, only local queries are unavailable.
+			logger.Error("Failed to start local status API", zap.Error(err))
+			localAPI = nil
+		}
+	}
+
 	logger.Info("Provider Daemon is running. Waiting for tasks...")
 
 	stopChan := make(chan os.Signal, 1)
@@ -158,6 +185,31 @@ func main() {
 	<-stopChan
 
 	logger.Info("Shutting down Provider Daemon...")
+
+	if localAPI != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := localAPI.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to shut down local status API", zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// queryRunningDaemon asks a running daemon's local status API for path and decodes the result into out.
+// It returns false when no daemon is reachable, in which case callers fall back to standalone behaviour.
+func queryRunningDaemon(cfg *config.Config, logger *zap.Logger, path string, out interface{}) bool {
+	if cfg.LocalAPIPort <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := localapi.Query(ctx, cfg.LocalAPIPort, path, out); err != nil {
+		logger.Debug("Running daemon not reachable via local status API", zap.String("path", path), zap.Error(err))
+		return false
+	}
+	logger.Info("Retrieved data from running daemon", zap.String("path", path))
+	return true
 }
 
 func handleGetGpusJSON(cfg *config.Config, logger *zap.Logger) {
@@ -349,34 +401,79 @@ func handleSetGpuRentalConfig(cfg *config.Config, configFilePath string, logger
 	outputJSON(map[string]string{"status": "success", "message": fmt.Sprintf("GPU %s rental configuration updated and saved.", gpuID)}, logger)
 }
 
-func handleGetLocalJobsJSON(cfg *config.Config, logger *zap.Logger /* taskHandler *tasks.Handler */) {
+func handleBenchmarkJSON(cfg *config.Config, configFilePath string, logger *zap.Logger) {
+	logger.Info("CLI command: --benchmark-json")
+	gpuDetector := gpu.NewDetector(&cfg.GPUDetectorConfig, logger)
+
+	detectedSystemGPUs, err := gpuDetector.DetectGPUsOnce()
+	if err != nil {
+		outputJSONError(fmt.Sprintf("Failed to detect GPUs: %v", err), os.Stderr, logger)
+		return
+	}
+
+	cached := make(map[string]config.GPUBenchmarkResult, len(cfg.LatestBenchmarks))
+	for _, result := range cfg.LatestBenchmarks {
+		cached[result.GpuID] = result
+	}
+
+	benchmarker := gpu.NewBenchmarker(&cfg.Benchmark, logger)
+	results := make([]config.GPUBenchmarkResult, 0, len(detectedSystemGPUs))
+	changed := len(cfg.LatestBenchmarks) != len(detectedSystemGPUs)
+
+	for _, systemGPU := range detectedSystemGPUs {
+		// Benchmarks are only re-run when the GPU, its driver or its slot changes
+		if previous, ok := cached[systemGPU.ID]; ok && previous.Fingerprint == gpu.Fingerprint(systemGPU) {
+			logger.Info("Using cached GPU benchmark", zap.String("gpu_id", systemGPU.ID), zap.Time("run_at", previous.RunAt))
+			results = append(results, previous)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Benchmark.Timeout)
+		result, err := benchmarker.Run(ctx, systemGPU)
+		cancel()
+		if err != nil {
+			outputJSONError(fmt.Sprintf("Failed to benchmark GPU %s: %v", systemGPU.ID, err), os.Stderr, logger)
+			return
+		}
+		results = append(results, *result)
+		changed = true
+	}
+
+	if changed {
+		cfg.LatestBenchmarks = results
+		if err := config.SaveConfig(cfg, configFilePath); err != nil {
+			outputJSONError(fmt.Sprintf("Failed to save benchmark results: %v", err), os.Stderr, logger)
+			return
+		}
+	}
+
+	outputJSON(results, logger)
+}
+
+func handleGetLocalJobsJSON(cfg *config.Config, logger *zap.Logger) {
 	logger.Info("CLI command: --get-local-jobs-json")
 
-	// The internal tasks.Handler is now capable of tracking active jobs in memory (see tasks.Handler.GetActiveJobsForCLI()).
-	// However, this standalone CLI command does not have direct access to the memory of a running daemon instance.
-	// To make this CLI command functional for querying a running daemon, an IPC mechanism would be required, such as:
-	// 1. The daemon exposing a local HTTP endpoint for CLI queries.
-	// 2. The daemon periodically writing job status to a file that this CLI can read.
-	// 3. Using NATS for a request-reply pattern on a specific subject for daemon control/query.
-
-	logger.Warn("handleGetLocalJobsJSON currently returns an empty list. Fetching live job data from a running daemon requires an IPC mechanism (e.g., local API endpoint or status file) which is not yet implemented for this specific CLI command path. The GUI will interact with the daemon directly.")
-	// TODO: Implement an IPC mechanism for this CLI command to query active jobs from a running daemon instance,
-	//       or clarify if this CLI is only for internal/GUI use where the taskHandler instance is directly available.
-
-	localJobs := make([]cli_models.CliLocalJob, 0)
-	// Example of how it *could* work if a taskHandler was available (e.g., if this was an internal call within the daemon):
-	// if taskHandler != nil { // taskHandler would need to be passed in or initialized
-	// 	 localJobs = taskHandler.GetActiveJobsForCLI()
-	// } else {
-	// 	 logger.Warn("Task handler not available to fetch local jobs for CLI command.")
-	// }
-
-	outputJSON(localJobs, logger)
+	// Active jobs only live in the memory of a running daemon, so ask it via the local status API.
+	var localJobs []cli_models.CliLocalJob
+	if queryRunningDaemon(cfg, logger, "/jobs", &localJobs) {
+		outputJSON(localJobs, logger)
+		return
+	}
+
+	logger.Warn("No running daemon reachable on the local status API; returning an empty job list.", zap.Int("port", cfg.LocalAPIPort))
+	outputJSON(make([]cli_models.CliLocalJob, 0), logger)
 }
 
 func handleGetNetworkStatusJSON(cfg *config.Config, logger *zap.Logger) {
 	logger.Info("CLI command: --get-network-status-json")
 
+	// Prefer the running daemon's live connection over a fresh probe connection.
+	var daemonStatus cli_models.CliNetworkStatus
+	if queryRunningDaemon(cfg, logger, "/network", &daemonStatus) {
+		outputJSON(daemonStatus, logger)
+		return
+	}
+
 	status := cli_models.CliNetworkStatus{
 		NatsServerURL: cfg.NatsConfig.URL, // Use NatsConfig directly
 		NatsConnected: false,              // Default to false
@@ -392,10 +489,7 @@ func handleGetNetworkStatusJSON(cfg *config.Config, logger *zap.Logger) {
 	}
 	defer natsClient.Stop() // Ensure client is stopped (which closes connection)
 
-	status.NatsConnected = natsClient.IsConnected()
-	status.NatsServerURL = natsClient.GetConnectionURL() // Might differ if connected to a different server in a cluster
-	status.LastNatsError = natsClient.GetLastErrorStr()
-	status.ActiveSubscriptions = natsClient.GetActiveSubscriptionCount() // Will be 0 as we don't call StartListening
+	status = networkStatusFromClient(natsClient) // ActiveSubscriptions will be 0 as we don't call StartListening
 
 	if status.NatsConnected {
 		logger.Info("NATS connection successful for status check.", zap.String("url", status.NatsServerURL))
@@ -406,48 +500,62 @@ func handleGetNetworkStatusJSON(cfg *config.Config, logger *zap.Logger) {
 	outputJSON(status, logger)
 }
 
+// networkStatusFromClient reports the connectivity of an initialized NATS client.
+func networkStatusFromClient(natsClient *nats.Client) cli_models.CliNetworkStatus {
+	return cli_models.CliNetworkStatus{
+		NatsConnected:       natsClient.IsConnected(),
+		NatsServerURL:       natsClient.GetConnectionURL(), // Might differ if connected to a different server in a cluster
+		LastNatsError:       natsClient.GetLastErrorStr(),
+		ActiveSubscriptions: natsClient.GetActiveSubscriptionCount(),
+		DeadLetteredTasks:   natsClient.DeadLetterCount(),
+	}
+}
+
 func handleGetFinancialSummaryJSON(cfg *config.Config, logger *zap.Logger) {
 	logger.Info("CLI command: --get-financial-summary-json")
 
+	var summary cli_models.CliFinancialSummary
+	if queryRunningDaemon(cfg, logger, "/financial", &summary) {
+		outputJSON(summary, logger)
+		return
+	}
+
 	billingClient := billing.NewClient(&cfg.BillingClientConfig, logger)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	logger.Info("Fetching financial summary (using stubbed billing client methods).")
-	financialDetails, err := billingClient.GetFinancialSummary(ctx, cfg.InstanceID)
+	outputJSON(fetchFinancialSummary(ctx, billingClient, cfg.ProviderID, logger), logger)
+}
 
+// fetchFinancialSummary retrieves the provider's financial summary from the billing service
+// and maps it to the CLI representation. providerID is the registry's ID for the provider.
+// Errors, or a missing provider ID, yield a zeroed summary.
+func fetchFinancialSummary(ctx context.Context, billingClient *billing.Client, providerID string, logger *zap.Logger) cli_models.CliFinancialSummary {
 	var summary cli_models.CliFinancialSummary
 
+	id, err := uuid.Parse(providerID)
 	if err != nil {
-		logger.Error("Failed to get financial summary from billing client (stub)", zap.Error(err))
-		// Populate with zeros or error indicators if preferred, but for now, empty/zero struct.
-		summary = cli_models.CliFinancialSummary{
-			CurrentBalanceDGPU: 0,
-			TotalEarnedDGPU:    0,
-			PendingPayoutDGPU:  0,
-			LastPayoutAt:       nil,
-		}
-		// outputJSONError(fmt.Sprintf("Error fetching financial summary: %v", err), os.Stderr, logger) // Option: exit on error
-		// return
-	} else if financialDetails != nil {
-		summary.CurrentBalanceDGPU = financialDetails.CurrentBalanceDGPU
-		summary.TotalEarnedDGPU = financialDetails.TotalEarnedDGPU
-		summary.PendingPayoutDGPU = financialDetails.PendingPayoutDGPU
-		if financialDetails.LastPayoutAt != nil {
-			lastPayoutAtStr := financialDetails.LastPayoutAt.Format(time.RFC3339)
-			summary.LastPayoutAt = &lastPayoutAtStr
-		}
-		logger.Info("Successfully retrieved (stubbed) financial summary details.", zap.Any("details", financialDetails))
-	} else {
-		// Should not happen if err is nil, but as a fallback
-		logger.Error("Financial summary details were nil without an error from billing client (stub)")
-		summary = cli_models.CliFinancialSummary{} // Empty
+		logger.Warn("provider_id is not set to the provider registry's ID, no financial summary available",
+			zap.String("providerID", providerID))
+		return summary
 	}
 
-	// nowStr is no longer directly used here as LastPayoutAt comes from financialDetails
-	// The CliFinancialSummary is now populated from the (stubbed) service call.
+	financialDetails, err := billingClient.GetFinancialSummary(ctx, id)
+	if err != nil {
+		logger.Error("Failed to get financial summary from billing service", zap.Error(err))
+		return summary
+	}
 
-	outputJSON(summary, logger)
+	summary.CurrentBalanceDGPU = financialDetails.CurrentBalanceDGPU
+	summary.TotalEarnedDGPU = financialDetails.TotalEarnedDGPU
+	summary.PendingPayoutDGPU = financialDetails.PendingPayoutDGPU
+	if financialDetails.LastPayoutAt != nil {
+		lastPayoutAtStr := financialDetails.LastPayoutAt.Format(time.RFC3339)
+		summary.LastPayoutAt = &lastPayoutAtStr
+	}
+	logger.Debug("Retrieved financial summary", zap.Any("details", financialDetails))
+
+	return summary
 }
 
 func handleGetSystemOverviewJSON(cfg *config.Config, logger *zap.Logger) {
@@ -522,7 +630,9 @@ func outputJSONError(message string, writer *os.File, logger *zap.Logger) {
 	os.Exit(1) // Exit after error for CLI mode
 }
 
-func setupLogger(levelString string) (*zap.Logger, error) {
+// setupLogger logs to stderr and to logs/provider-daemon/daemon.log, which is rotated
+// as configured.
+func setupLogger(levelString string, rotation config.LogRotationSettings) (*zap.Logger, error) {
 	var logLevel zapcore.Level
 	switch levelString {
 	case "debug":
@@ -570,7 +680,7 @@ func setupLogger(levelString string) (*zap.Logger, error) {
 
 	fileCore := zapcore.NewCore(
 		zapcore.NewJSONEncoder(encoderConfig),
-		zapcore.AddSync(zapcore.Lock(mustOpen(logFileName))),
+		zapcore.AddSync(newRotatingLogFile(logFileName, rotation)),
 		logLevel,
 	)
 
@@ -601,19 +711,19 @@ func setupLogger(levelString string) (*zap.Logger, error) {
 	return zap.New(teeCore, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
 }
 
-func mustOpen(filePath string) *os.File {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		// Fallback if log file cannot be opened, print to stderr
-		fmt.Fprintf(os.Stderr, "PANIC: Failed to open log file %s: %v\n", filePath, err)
-		// Attempt to use a basic stderr logger if primary logging fails catastrophically
-		cfg := zap.NewProductionConfig()
-		cfg.OutputPaths = []string{"stderr"}
-		logger, _ := cfg.Build()
-		logger.Panic("Failed to open log file", zap.String("path", filePath), zap.Error(err))
-		// Should not reach here due to panic
-	}
-	return file
+// newRotatingLogFile returns a writer appending to the log file at filePath that moves
+// it aside once it reaches the configured size, keeping as many rotated files as configured.
+// Rotated files are named after the time they were rotated, e.g. daemon-2024-05-01T10-00-00.000.log.
+// The writer is safe for concurrent use.
+func newRotatingLogFile(filePath string, rotation config.LogRotationSettings) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    rotation.MaxSizeMB,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAgeDays,
+		Compress:   rotation.Compress,
+		LocalTime:  true,
+	}
 }
 
 // Ensure all model types are correctly imported and used to avoid "unused import" errors
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dante-gpu/dante-backend/provider-daemon/internal/config"
+)
+
+func TestRotatingLogFileRotatesAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	logFile := newRotatingLogFile(filepath.Join(dir, "daemon.log"), config.LogRotationSettings{MaxSizeMB: 1, MaxBackups: 2})
+	defer logFile.Close()
+
+	line := append(bytes.Repeat([]byte("x"), 1023), '\n')
+	write := func(kb int) {
+		t.Helper()
+		for i := 0; i < kb; i++ {
+			if _, err := logFile.Write(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	logFiles := func() []string {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	write(1000)
+	if names := logFiles(); len(names) != 1 || names[0] != "daemon.log" {
+		t.Fatalf("log files %v under the size threshold, want only daemon.log", names)
+	}
+
+	write(100)
+	names := logFiles()
+	if len(names) != 2 {
+		t.Fatalf("log files %v after crossing the size threshold, want daemon.log and a rotated file", names)
+	}
+	for _, name := range names {
+		if name != "daemon.log" && !(strings.HasPrefix(name, "daemon-") && strings.HasSuffix(name, ".log")) {
+			t.Errorf("unexpected log file %s", name)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "daemon.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1024 lines fill the first file, the rest went to the new one
+	if want := int64(1100-1024) * int64(len(line)); info.Size() != want {
+		t.Errorf("daemon.log holds %d bytes after rotating, want the %d written since", info.Size(), want)
+	}
+}
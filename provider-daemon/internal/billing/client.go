@@ -5,32 +5,36 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
-	// For CliFinancialSummary type if needed, or define local types
 )
 
 // Client represents a client for the billing service
 type Client struct {
 	baseURL    string
+	apiToken   string
 	httpClient *http.Client
 	logger     *zap.Logger
 }
 
 // Config represents billing client configuration
 type Config struct {
-	BaseURL string        `yaml:"base_url"`
-	Timeout time.Duration `yaml:"timeout"`
+	BaseURL  string        `yaml:"base_url"` // Root URL of the billing service, without the /api/v1 prefix
+	APIToken string        `yaml:"api_token,omitempty"`
+	Timeout  time.Duration `yaml:"timeout"`
 }
 
 // NewClient creates a new billing service client
 func NewClient(config *Config, logger *zap.Logger) *Client {
 	return &Client{
-		baseURL: config.BaseURL,
+		baseURL:  strings.TrimRight(config.BaseURL, "/"),
+		apiToken: config.APIToken,
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
@@ -270,6 +274,18 @@ type FinancialSummaryDetails struct {
 	// Potentially other fields like NextEstimatedPayout etc.
 }
 
+// ProviderEarningsResponse is the billing service's earnings summary for a provider
+type ProviderEarningsResponse struct {
+	ProviderID      uuid.UUID       `json:"provider_id"`
+	TotalEarnings   decimal.Decimal `json:"total_earnings"`
+	PendingEarnings decimal.Decimal `json:"pending_earnings"`
+	PaidEarnings    decimal.Decimal `json:"paid_earnings"`
+	TotalSessions   int             `json:"total_sessions"`
+	TotalHours      decimal.Decimal `json:"total_hours"`
+	AvgHourlyRate   decimal.Decimal `json:"avg_hourly_rate"`
+	Period          string          `json:"period"`
+}
+
 // GetBalance (hypothetical, from previous linter error context)
 // This is a placeholder, assuming the billing service would have an endpoint for this.
 func (c *Client) GetBalance(ctx context.Context, providerID string) (float64, error) {
@@ -281,24 +297,51 @@ func (c *Client) GetBalance(ctx context.Context, providerID string) (float64, er
 	return 123.45, nil // Mock balance
 }
 
-// GetFinancialSummary retrieves a summary of financial data for the provider.
-// This is a STUB method and needs a corresponding endpoint in the billing service.
-func (c *Client) GetFinancialSummary(ctx context.Context, providerID string) (*FinancialSummaryDetails, error) {
-	c.logger.Warn("billing.Client.GetFinancialSummary is a STUB and not implemented. Returning mock data.", zap.String("providerID", providerID))
+// GetProviderEarnings fetches the provider's all-time earnings from the billing service.
+// providerID is the ID the provider registry assigned, not the daemon's instance ID.
+func (c *Client) GetProviderEarnings(ctx context.Context, providerID uuid.UUID) (*ProviderEarningsResponse, error) {
+	url := fmt.Sprintf("%s/api/v1/provider/%s/earnings", c.baseURL, providerID)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.apiToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiToken)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider earnings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("billing service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
 
-	// In a real implementation, this would call an endpoint on the billing service:
-	// e.g., GET /api/v1/providers/{providerID}/financial-summary
-	// For now, return mock data based on CliFinancialSummary structure.
+	var earnings ProviderEarningsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&earnings); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &earnings, nil
+}
 
-	// Attempt to get at least the current balance using the stubbed GetBalance
-	balance, _ := c.GetBalance(ctx, providerID) // Ignore error for stub
+// GetFinancialSummary retrieves a summary of financial data for the provider. Settled
+// earnings make up the current balance; earnings whose payments are still pending are
+// reported as the pending payout. The billing service doesn't process payouts yet, so
+// no last payout is reported.
+func (c *Client) GetFinancialSummary(ctx context.Context, providerID uuid.UUID) (*FinancialSummaryDetails, error) {
+	earnings, err := c.GetProviderEarnings(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
 
-	mockTime := time.Now().Add(-24 * time.Hour)
 	return &FinancialSummaryDetails{
-		TotalEarnedDGPU:    float32(balance + 1000.0), // Mock
-		PendingPayoutDGPU:  float32(balance),          // Mock based on GetBalance stub
-		CurrentBalanceDGPU: float32(balance),          // Mock
-		LastPayoutDGPU:     500.0,                     // Mock
-		LastPayoutAt:       &mockTime,                 // Mock
+		TotalEarnedDGPU:    float32(earnings.TotalEarnings.InexactFloat64()),
+		PendingPayoutDGPU:  float32(earnings.PendingEarnings.InexactFloat64()),
+		CurrentBalanceDGPU: float32(earnings.PaidEarnings.InexactFloat64()),
 	}, nil
 }
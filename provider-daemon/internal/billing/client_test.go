@@ -0,0 +1,40 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func TestGetFinancialSummaryUsesProviderID(t *testing.T) {
+	providerID := uuid.New()
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"provider_id":      providerID,
+			"total_earnings":   "12.5",
+			"pending_earnings": "2.5",
+			"paid_earnings":    "10",
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{BaseURL: server.URL + "/", Timeout: 5 * time.Second}, zap.NewNop())
+	summary, err := client.GetFinancialSummary(context.Background(), providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/api/v1/provider/" + providerID.String() + "/earnings"; path != want {
+		t.Errorf("requested %s, want %s", path, want)
+	}
+	if summary.TotalEarnedDGPU != 12.5 || summary.PendingPayoutDGPU != 2.5 || summary.CurrentBalanceDGPU != 10 {
+		t.Errorf("summary %+v, want 12.5 earned, 2.5 pending and 10 balance", summary)
+	}
+}
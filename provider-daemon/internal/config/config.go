@@ -41,10 +41,44 @@ type GPUDetectorSettings struct {
 	// Other paths like rocm-smi if needed
 }
 
+// BenchmarkSettings configures the GPU self-benchmark run by --benchmark-json.
+type BenchmarkSettings struct {
+	Image      string        `yaml:"image"`      // CUDA-enabled PyTorch image the benchmark runs in
+	Timeout    time.Duration `yaml:"timeout"`    // Per GPU, including the image pull
+	Iterations int           `yaml:"iterations"` // GEMM samples used for the TFLOPS and stability figures
+}
+
+// LogRotationSettings controls rotation of the daemon's log file. The file is rotated
+// once it reaches MaxSizeMB; rotated files are removed once there are more than
+// MaxBackups of them or they are older than MaxAgeDays, where 0 keeps them.
+type LogRotationSettings struct {
+	MaxSizeMB  int  `yaml:"max_size_mb"`
+	MaxBackups int  `yaml:"max_backups"`
+	MaxAgeDays int  `yaml:"max_age_days"`
+	Compress   bool `yaml:"compress"` // Gzip rotated files
+}
+
+// GPUBenchmarkResult is the latest benchmark of one GPU. Fingerprint identifies the
+// hardware and driver it was measured on, so it is reused until either changes.
+type GPUBenchmarkResult struct {
+	GpuID              string    `yaml:"gpu_id" json:"gpu_id"`
+	Model              string    `yaml:"model" json:"model"`
+	Fingerprint        string    `yaml:"fingerprint" json:"fingerprint"`
+	FP16TFLOPS         float64   `yaml:"fp16_tflops" json:"fp16_tflops"`
+	MemoryBandwidthGBs float64   `yaml:"memory_bandwidth_gb_s" json:"memory_bandwidth_gb_s"`
+	StabilityScore     float64   `yaml:"stability_score" json:"stability_score"` // 0-1, 1 means no variation between samples
+	RunAt              time.Time `yaml:"run_at" json:"run_at"`
+}
+
 // Config holds the application configuration for the provider daemon.
 type Config struct {
 	InstanceID string `yaml:"instance_id"`
+	// ProviderID is the UUID the provider registry assigned when this provider was
+	// registered. The billing service keeps the provider's earnings under it.
+	ProviderID string `yaml:"provider_id,omitempty"`
 	LogLevel   string `yaml:"log_level"`
+	// Rotation of logs/provider-daemon/daemon.log
+	LogRotation LogRotationSettings `yaml:"log_rotation"`
 	// General request timeout, e.g., for HTTP calls to other services
 	RequestTimeout time.Duration `yaml:"request_timeout"`
 
@@ -68,6 +102,17 @@ type Config struct {
 
 	GpuRentalConfigs []GpuRentalConfigEntry `yaml:"gpu_rental_configs,omitempty"`
 
+	Benchmark        BenchmarkSettings    `yaml:"benchmark"`
+	LatestBenchmarks []GPUBenchmarkResult `yaml:"latest_benchmarks,omitempty"`
+
+	// LocalAPIPort is the loopback port for the daemon's local status API used by CLI commands
+	// and the GUI. A negative value disables the API.
+	LocalAPIPort int `yaml:"local_api_port"`
+
+	// NatsDeadLetterSubject is where task messages that can't be read or fail validation
+	// are published, with the reason, instead of being redelivered.
+	NatsDeadLetterSubject string `yaml:"nats_dead_letter_subject"`
+
 	Logger              *zap.Logger    `yaml:"-"`
 	BillingClientConfig billing.Config `yaml:"billing_client"`
 
@@ -94,6 +139,12 @@ func LoadConfig(path string, logger *zap.Logger) (*Config, error) {
 		InstanceID:     defaultInstanceID,
 		LogLevel:       "info",
 		RequestTimeout: 30 * time.Second,
+		LogRotation: LogRotationSettings{
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAgeDays: 30,
+			Compress:   true,
+		},
 		NatsConfig: NatsConfig{ // Initialize locally defined NatsConfig
 			URL:                        "nats://localhost:4222",
 			ConnectTimeout:             5 * time.Second,
@@ -124,8 +175,16 @@ func LoadConfig(path string, logger *zap.Logger) (*Config, error) {
 		DefaultHourlyRateDGPU:       1.0, // Default value
 		MinJobDurationMinutes:       5,   // Default value
 		GpuRentalConfigs:            make([]GpuRentalConfigEntry, 0),
+		LocalAPIPort:                8790,
+		NatsDeadLetterSubject:       "task.deadletter",
 		BillingClientConfig: billing.Config{
-			BaseURL: "http://localhost:8081/api/v1/billing",
+			BaseURL: "http://localhost:8081",
+			Timeout: 10 * time.Second,
+		},
+		Benchmark: BenchmarkSettings{
+			Image:      "pytorch/pytorch:2.3.1-cuda12.1-cudnn8-runtime",
+			Timeout:    10 * time.Minute,
+			Iterations: 20,
 		},
 		shutdownTimeout: 10 * time.Second,
 	}
@@ -178,6 +237,12 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	if cfg.RequestTimeout == 0 {
 		cfg.RequestTimeout = defaults.RequestTimeout
 	}
+	if cfg.LogRotation == (LogRotationSettings{}) {
+		cfg.LogRotation = defaults.LogRotation
+	}
+	if cfg.LogRotation.MaxSizeMB <= 0 {
+		cfg.LogRotation.MaxSizeMB = defaults.LogRotation.MaxSizeMB
+	}
 	// NATS Config
 	if cfg.NatsConfig.URL == "" {
 		cfg.NatsConfig.URL = defaults.NatsConfig.URL
@@ -253,9 +318,27 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	if cfg.GpuRentalConfigs == nil {
 		cfg.GpuRentalConfigs = defaults.GpuRentalConfigs
 	}
+	if cfg.Benchmark.Image == "" {
+		cfg.Benchmark.Image = defaults.Benchmark.Image
+	}
+	if cfg.Benchmark.Timeout == 0 {
+		cfg.Benchmark.Timeout = defaults.Benchmark.Timeout
+	}
+	if cfg.Benchmark.Iterations <= 0 {
+		cfg.Benchmark.Iterations = defaults.Benchmark.Iterations
+	}
+	if cfg.LocalAPIPort == 0 {
+		cfg.LocalAPIPort = defaults.LocalAPIPort
+	}
+	if cfg.NatsDeadLetterSubject == "" {
+		cfg.NatsDeadLetterSubject = defaults.NatsDeadLetterSubject
+	}
 	if cfg.BillingClientConfig.BaseURL == "" {
 		cfg.BillingClientConfig.BaseURL = defaults.BillingClientConfig.BaseURL
 	}
+	if cfg.BillingClientConfig.Timeout == 0 {
+		cfg.BillingClientConfig.Timeout = defaults.BillingClientConfig.Timeout
+	}
 	if cfg.shutdownTimeout == 0 {
 		cfg.shutdownTimeout = defaults.shutdownTimeout
 	}
@@ -0,0 +1,177 @@
+package gpu
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-daemon/internal/config"
+	"go.uber.org/zap"
+)
+
+// benchmarkScript measures FP16 GEMM throughput and device memory bandwidth with PyTorch.
+// It prints one JSON object with a TFLOPS sample per iteration and the copy bandwidth.
+const benchmarkScript = `
+import json, sys, time, torch
+
+iterations = int(sys.argv[1])
+device = torch.device("cuda")
+n = 4096
+a = torch.randn(n, n, device=device, dtype=torch.float16)
+b = torch.randn(n, n, device=device, dtype=torch.float16)
+for _ in range(5):
+    torch.matmul(a, b)
+torch.cuda.synchronize()
+
+samples = []
+for _ in range(iterations):
+    start = time.perf_counter()
+    for _ in range(10):
+        torch.matmul(a, b)
+    torch.cuda.synchronize()
+    samples.append(2 * n ** 3 * 10 / (time.perf_counter() - start) / 1e12)
+
+size = 256 * 1024 * 1024
+src = torch.empty(size, dtype=torch.uint8, device=device)
+dst = torch.empty_like(src)
+dst.copy_(src)
+torch.cuda.synchronize()
+start = time.perf_counter()
+for _ in range(10):
+    dst.copy_(src)
+torch.cuda.synchronize()
+bandwidth = 2 * size * 10 / (time.perf_counter() - start) / 1e9
+
+print(json.dumps({"tflops_samples": samples, "memory_bandwidth_gb_s": bandwidth}))
+`
+
+// benchmarkOutput is the JSON printed by benchmarkScript
+type benchmarkOutput struct {
+	TFLOPSSamples      []float64 `json:"tflops_samples"`
+	MemoryBandwidthGBs float64   `json:"memory_bandwidth_gb_s"`
+}
+
+// Benchmarker runs the standardized GPU benchmark in a container
+type Benchmarker struct {
+	logger *zap.Logger
+	cfg    *config.BenchmarkSettings
+}
+
+// NewBenchmarker creates a new GPU benchmarker
+func NewBenchmarker(cfg *config.BenchmarkSettings, logger *zap.Logger) *Benchmarker {
+	return &Benchmarker{
+		logger: logger,
+		cfg:    cfg,
+	}
+}
+
+// Fingerprint identifies the hardware and driver a benchmark was run on. A
+// benchmark only needs to be re-run when the fingerprint changes.
+func Fingerprint(gpu GPUInfo) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		gpu.ID,
+		gpu.Model,
+		strconv.FormatUint(gpu.VRAMTotal, 10),
+		gpu.DriverVersion,
+		gpu.PCIBusID,
+	}, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Run benchmarks a single GPU. Only NVIDIA GPUs are supported, as the benchmark
+// relies on the NVIDIA container runtime.
+func (b *Benchmarker) Run(ctx context.Context, gpu GPUInfo) (*config.GPUBenchmarkResult, error) {
+	if gpu.Vendor != "NVIDIA" {
+		return nil, fmt.Errorf("benchmarking %s GPUs is not supported", gpu.Vendor)
+	}
+	deviceIndex := strings.TrimPrefix(gpu.ID, "nvidia-")
+
+	b.logger.Info("Running GPU benchmark",
+		zap.String("gpuID", gpu.ID),
+		zap.String("model", gpu.Model),
+		zap.String("image", b.cfg.Image),
+	)
+
+	cmd := exec.CommandContext(ctx, "docker", "run", "--rm",
+		"--gpus", "device="+deviceIndex,
+		"--entrypoint", "python3",
+		b.cfg.Image,
+		"-c", benchmarkScript, strconv.Itoa(b.cfg.Iterations),
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("benchmark container failed for %s: %w: %s", gpu.ID, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// The image may print banners before the result, so only the last line is parsed
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var output benchmarkOutput
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse benchmark output for %s: %w", gpu.ID, err)
+	}
+	if len(output.TFLOPSSamples) == 0 {
+		return nil, fmt.Errorf("benchmark for %s produced no samples", gpu.ID)
+	}
+
+	result := &config.GPUBenchmarkResult{
+		GpuID:              gpu.ID,
+		Model:              gpu.Model,
+		Fingerprint:        Fingerprint(gpu),
+		FP16TFLOPS:         median(output.TFLOPSSamples),
+		MemoryBandwidthGBs: output.MemoryBandwidthGBs,
+		StabilityScore:     stabilityScore(output.TFLOPSSamples),
+		RunAt:              time.Now().UTC(),
+	}
+
+	b.logger.Info("GPU benchmark completed",
+		zap.String("gpuID", gpu.ID),
+		zap.Float64("fp16TFLOPS", result.FP16TFLOPS),
+		zap.Float64("memoryBandwidthGBs", result.MemoryBandwidthGBs),
+		zap.Float64("stabilityScore", result.StabilityScore),
+	)
+	return result, nil
+}
+
+// median returns the median of samples, which must not be empty
+func median(samples []float64) float64 {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// stabilityScore is one minus the coefficient of variation of the samples, clamped
+// to [0, 1]. Throttling or an unstable card shows up as a lower score.
+func stabilityScore(samples []float64) float64 {
+	var mean float64
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(len(samples))
+	if mean <= 0 {
+		return 0
+	}
+
+	var variance float64
+	for _, s := range samples {
+		variance += (s - mean) * (s - mean)
+	}
+	variance /= float64(len(samples))
+
+	return math.Max(0, math.Min(1, 1-math.Sqrt(variance)/mean))
+}
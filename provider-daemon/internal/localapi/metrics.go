@@ -0,0 +1,96 @@
+package localapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-daemon/internal/gpu"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// gpuMetricsTimeout bounds the GPU query behind each scrape.
+const gpuMetricsTimeout = 5 * time.Second
+
+// GPUMetricsFunc returns the current metrics of the daemon's GPUs.
+type GPUMetricsFunc func(ctx context.Context) ([]gpu.GPUMetrics, error)
+
+// daemonCollector exports the daemon's jobs, NATS connectivity and GPU metrics on
+// the local API's /metrics endpoint. Values are read fresh on every scrape.
+type daemonCollector struct {
+	server *Server
+
+	activeJobs     *prometheus.Desc
+	natsConnected  *prometheus.Desc
+	deadLettered   *prometheus.Desc
+	gpuUtilization *prometheus.Desc
+	gpuMemoryUsed  *prometheus.Desc
+	gpuTemperature *prometheus.Desc
+	gpuPowerDraw   *prometheus.Desc
+}
+
+func newDaemonCollector(s *Server) *daemonCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("dante", "provider_daemon", name), help, labels, nil)
+	}
+	return &daemonCollector{
+		server:         s,
+		activeJobs:     desc("active_jobs", "Jobs the daemon is running, by status.", "status"),
+		natsConnected:  desc("nats_connected", "1 if the daemon is connected to NATS."),
+		deadLettered:   desc("dead_lettered_tasks_total", "Task messages sent to the dead-letter subject."),
+		gpuUtilization: desc("gpu_utilization", "GPU utilization percent.", "gpu"),
+		gpuMemoryUsed:  desc("gpu_memory_used_bytes", "GPU memory in use.", "gpu"),
+		gpuTemperature: desc("gpu_temperature_celsius", "GPU temperature.", "gpu"),
+		gpuPowerDraw:   desc("gpu_power_draw_watts", "GPU power draw.", "gpu"),
+	}
+}
+
+func (c *daemonCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeJobs
+	ch <- c.natsConnected
+	ch <- c.deadLettered
+	ch <- c.gpuUtilization
+	ch <- c.gpuMemoryUsed
+	ch <- c.gpuTemperature
+	ch <- c.gpuPowerDraw
+}
+
+func (c *daemonCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, labels...)
+	}
+
+	byStatus := make(map[string]int)
+	for _, job := range c.server.jobs.GetActiveJobsForCLI() {
+		byStatus[job.Status]++
+	}
+	for status, count := range byStatus {
+		gauge(c.activeJobs, float64(count), status)
+	}
+
+	network := c.server.network()
+	connected := 0.0
+	if network.NatsConnected {
+		connected = 1
+	}
+	gauge(c.natsConnected, connected)
+	ch <- prometheus.MustNewConstMetric(c.deadLettered, prometheus.CounterValue, float64(network.DeadLetteredTasks))
+
+	if c.server.gpuMetrics == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gpuMetricsTimeout)
+	defer cancel()
+	gpus, err := c.server.gpuMetrics(ctx)
+	if err != nil {
+		// Leave the GPUs out rather than failing the whole scrape
+		c.server.logger.Warn("Failed to read GPU metrics for /metrics", zap.Error(err))
+		return
+	}
+	for _, m := range gpus {
+		gauge(c.gpuUtilization, float64(m.Utilization), m.ID)
+		gauge(c.gpuMemoryUsed, float64(m.VRAMUsed)*1024*1024, m.ID)
+		gauge(c.gpuTemperature, float64(m.Temperature), m.ID)
+		gauge(c.gpuPowerDraw, float64(m.PowerDraw), m.ID)
+	}
+}
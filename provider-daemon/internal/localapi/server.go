@@ -0,0 +1,150 @@
+package localapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-daemon/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// JobSource provides the daemon's currently active jobs.
+// It is satisfied by *tasks.Handler.
+type JobSource interface {
+	GetActiveJobsForCLI() []models.CliLocalJob
+}
+
+// NetworkStatusFunc returns the daemon's current NATS connectivity.
+type NetworkStatusFunc func() models.CliNetworkStatus
+
+// FinancialSummaryFunc returns the provider's financial summary.
+type FinancialSummaryFunc func(ctx context.Context) models.CliFinancialSummary
+
+// Server exposes read-only daemon state over HTTP on the loopback interface so that
+// CLI invocations (and the GUI) can query a running daemon instance.
+type Server struct {
+	logger     *zap.Logger
+	jobs       JobSource
+	network    NetworkStatusFunc
+	financial  FinancialSummaryFunc
+	gpuMetrics GPUMetricsFunc
+	server     *http.Server
+}
+
+// NewServer creates a local status API server listening on 127.0.0.1:port.
+// gpuMetrics may be nil, in which case /metrics omits the GPU metrics.
+func NewServer(port int, logger *zap.Logger, jobs JobSource, network NetworkStatusFunc, financial FinancialSummaryFunc, gpuMetrics GPUMetricsFunc) *Server {
+	s := &Server{
+		logger:     logger,
+		jobs:       jobs,
+		network:    network,
+		financial:  financial,
+		gpuMetrics: gpuMetrics,
+	}
+
+	// Each server has its own registry, so creating several (e.g. in tests) doesn't
+	// panic on duplicate registration with the default one
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		newDaemonCollector(s),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", s.handleJobs)
+	mux.HandleFunc("GET /network", s.handleNetwork)
+	mux.HandleFunc("GET /financial", s.handleFinancial)
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	s.server = &http.Server{
+		Addr:              Address(port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Address returns the loopback address the local API listens on for the given port.
+func Address(port int) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+// Start binds the listener and serves requests in the background.
+// Binding happens synchronously so that a port conflict is reported to the caller.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Local status API server stopped unexpectedly", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Local status API listening", zap.String("address", s.server.Addr))
+	return nil
+}
+
+// Shutdown gracefully stops the server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := s.jobs.GetActiveJobsForCLI()
+	if jobs == nil {
+		jobs = make([]models.CliLocalJob, 0) // Encode as [] rather than null
+	}
+	s.writeJSON(w, jobs)
+}
+
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.network())
+}
+
+func (s *Server) handleFinancial(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.financial(r.Context()))
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.logger.Error("Failed to encode local status API response", zap.Error(err))
+	}
+}
+
+// Query fetches path from a daemon's local API on the given port and decodes the JSON
+// response into out. An error means no daemon answered (or it answered badly) and the
+// caller should fall back to its standalone behaviour.
+func Query(ctx context.Context, port int, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+Address(port)+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create local API request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("local API not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("local API returned status %d for %s", resp.StatusCode, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode local API response: %w", err)
+	}
+	return nil
+}
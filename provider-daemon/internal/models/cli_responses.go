@@ -52,6 +52,7 @@ type CliNetworkStatus struct {
 	NatsServerURL       string `json:"nats_server_url"`
 	LastNatsError       string `json:"last_nats_error,omitempty"`
 	ActiveSubscriptions int    `json:"active_subscriptions,omitempty"` // Example: Number of active NATS subscriptions
+	DeadLetteredTasks   uint64 `json:"dead_lettered_tasks,omitempty"`  // Task messages sent to the dead-letter subject
 }
 
 // CliFinancialSummary mirrors the FinancialSummary struct in provider-gui
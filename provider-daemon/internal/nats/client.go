@@ -2,8 +2,10 @@ package nats
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dante-gpu/dante-backend/provider-daemon/internal/config"
@@ -24,8 +26,16 @@ type Client struct {
 	taskHandler  TaskHandlerFunc
 	shutdownChan chan struct{}
 	js           nats.JetStreamContext // JetStream context
+	deadLetters  atomic.Uint64         // Task messages sent to the dead-letter subject
 }
 
+// Headers set on a dead-lettered task message, whose data is the original message's
+const (
+	DeadLetterErrorHeader    = "Dante-Dead-Letter-Error"
+	DeadLetterSubjectHeader  = "Dante-Dead-Letter-Subject"
+	DeadLetterProviderHeader = "Dante-Dead-Letter-Provider"
+)
+
 // NewClient creates a new NATS client for the provider daemon.
 func NewClient(cfg *config.Config, logger *zap.Logger, handler TaskHandlerFunc) (*Client, error) {
 	client := &Client{
@@ -196,9 +206,12 @@ func (c *Client) handleMessage(msg *nats.Msg) {
 			zap.Error(err),
 			zap.ByteString("raw_data", msg.Data),
 		)
-		if ackErr := msg.Ack(); ackErr != nil { // Ack poison pill
-			c.logger.Error("Failed to ACK unmarshalable (poison pill) message", zap.Error(ackErr))
-		}
+		c.deadLetter(msg, fmt.Errorf("invalid task JSON: %w", err))
+		return
+	}
+	if err := validateTask(&task); err != nil {
+		c.logger.Error("Received invalid task", zap.String("job_id", task.JobID), zap.Error(err))
+		c.deadLetter(msg, err)
 		return
 	}
 
@@ -244,6 +257,60 @@ func (c *Client) handleMessage(msg *nats.Msg) {
 	c.logger.Info("Task processed and ACKed successfully", zap.String("job_id", task.JobID))
 }
 
+// validateTask checks that a task has what the daemon needs to run it.
+func validateTask(task *models.Task) error {
+	var problems []string
+	if task.JobID == "" {
+		problems = append(problems, "job_id is required")
+	}
+	if task.AssignedProviderID == "" {
+		problems = append(problems, "assigned_provider_id is required")
+	}
+	switch task.ExecutionType {
+	case models.ExecutionTypeScript, models.ExecutionTypeDocker, models.ExecutionTypeUndefined:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown execution_type %q", task.ExecutionType))
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid task: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// deadLetter publishes a task message that can never be processed (a poison message) to
+// the dead-letter subject, unchanged and with the reason in its headers, then ACKs it
+// so JetStream stops redelivering it.
+func (c *Client) deadLetter(msg *nats.Msg, reason error) {
+	c.deadLetters.Add(1)
+
+	deadLetter := nats.NewMsg(c.cfg.NatsDeadLetterSubject)
+	deadLetter.Data = msg.Data
+	deadLetter.Header.Set(DeadLetterErrorHeader, reason.Error())
+	deadLetter.Header.Set(DeadLetterSubjectHeader, msg.Subject)
+	deadLetter.Header.Set(DeadLetterProviderHeader, c.cfg.InstanceID)
+	if err := c.nc.PublishMsg(deadLetter); err != nil {
+		c.logger.Error("Failed to publish task message to the dead-letter subject",
+			zap.String("dead_letter_subject", c.cfg.NatsDeadLetterSubject),
+			zap.Error(err),
+		)
+	} else {
+		c.logger.Warn("Task message sent to the dead-letter subject",
+			zap.String("subject", msg.Subject),
+			zap.String("dead_letter_subject", c.cfg.NatsDeadLetterSubject),
+			zap.Error(reason),
+		)
+	}
+
+	if ackErr := msg.Ack(); ackErr != nil {
+		c.logger.Error("Failed to ACK dead-lettered (poison pill) message", zap.Error(ackErr))
+	}
+}
+
+// DeadLetterCount returns how many task messages have been sent to the dead-letter subject.
+func (c *Client) DeadLetterCount() uint64 {
+	return c.deadLetters.Load()
+}
+
 // PublishStatus sends a TaskStatusUpdate to the configured NATS subject.
 func (c *Client) PublishStatus(statusUpdate *models.TaskStatusUpdate) error {
 	if c.nc == nil || c.nc.Status() != nats.CONNECTED {
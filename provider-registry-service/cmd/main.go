@@ -15,6 +15,8 @@ import (
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/config"
 	consul_client "github.com/dante-gpu/dante-backend/provider-registry-service/internal/consul"
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/handlers"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/metrics"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/reaper"
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/server"
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/store"
 
@@ -96,10 +98,20 @@ func main() {
 	storeCancel() // Cancel the context after initialization
 	logger.Info("PostgreSQL provider store initialized successfully")
 
+	// --- Stale Provider Reaper ---
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	go reaper.NewReaper(providerStore, cfg.ProviderHeartbeatTTL, cfg.ProviderReapInterval, logger).Run(reaperCtx)
+	logger.Info("Stale provider reaper started",
+		zap.Duration("heartbeat_ttl", cfg.ProviderHeartbeatTTL),
+		zap.Duration("reap_interval", cfg.ProviderReapInterval),
+	)
+
 	// --- Setup Router and Server ---
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(metrics.Middleware)
 	// Add our correlation ID middleware
 	r.Use(customMiddleware.CorrelationID)
 	// Use the structured logger middleware
@@ -131,6 +143,10 @@ func main() {
 		logger.Debug("Health check endpoint hit", zap.Int("status", healthStatus))
 	})
 
+	// Prometheus scrape endpoint
+	metrics.Register(providerStore, logger)
+	r.Handle("/metrics", metrics.Handler())
+
 	// --- Mount API Handlers ---
 	providerHandler := handlers.NewProviderHandler(contextLogger, cfg, providerStore)
 	r.Mount("/providers", providerHandler.Routes())
@@ -151,6 +167,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit // Block until a signal is received
 	logger.Info("Shutdown signal received, starting graceful shutdown...")
+	stopReaper()
 
 	// Deregister from Consul
 	logger.Info("Deregistering service from Consul", zap.String("service_id", serviceID))
@@ -25,6 +25,18 @@ type Config struct {
 	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
 	HealthCheckTimeout  time.Duration `yaml:"health_check_timeout"`
 	RequestTimeout      time.Duration `yaml:"request_timeout"`
+
+	// Providers not heard from for ProviderHeartbeatTTL are treated as offline; the
+	// reaper marks them so every ProviderReapInterval
+	ProviderHeartbeatTTL time.Duration `yaml:"provider_heartbeat_ttl"`
+	ProviderReapInterval time.Duration `yaml:"provider_reap_interval"`
+
+	// Heartbeats and the provider's other requests about itself must be signed with the
+	// key of its registered Solana wallet and be no further than HeartbeatMaxClockSkew
+	// from the registry's clock. Unsigned requests are only accepted from providers
+	// without a wallet, and only if AllowUnsignedHeartbeats is set.
+	HeartbeatMaxClockSkew   time.Duration `yaml:"heartbeat_max_clock_skew"`
+	AllowUnsignedHeartbeats bool          `yaml:"allow_unsigned_heartbeats"`
 }
 
 // LoadConfig reads configuration from the given YAML file path.
@@ -44,6 +56,11 @@ func LoadConfig(path string) (*Config, error) {
 		HealthCheckInterval: 10 * time.Second,
 		HealthCheckTimeout:  2 * time.Second,
 		RequestTimeout:      30 * time.Second,
+
+		ProviderHeartbeatTTL: 90 * time.Second,
+		ProviderReapInterval: 30 * time.Second,
+
+		HeartbeatMaxClockSkew: time.Minute,
 	}
 
 	// Check if file exists, create if not
@@ -116,6 +133,15 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	if cfg.RequestTimeout == 0 {
 		cfg.RequestTimeout = defaults.RequestTimeout
 	}
+	if cfg.ProviderHeartbeatTTL == 0 {
+		cfg.ProviderHeartbeatTTL = defaults.ProviderHeartbeatTTL
+	}
+	if cfg.ProviderReapInterval == 0 {
+		cfg.ProviderReapInterval = defaults.ProviderReapInterval
+	}
+	if cfg.HeartbeatMaxClockSkew == 0 {
+		cfg.HeartbeatMaxClockSkew = defaults.HeartbeatMaxClockSkew
+	}
 }
 
 // Helper function to generate a unique Service ID for Consul
@@ -3,8 +3,9 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/config"
@@ -21,10 +22,12 @@ type ProviderStore interface {
 	AddProvider(ctx context.Context, provider *models.Provider) error
 	GetProvider(ctx context.Context, id uuid.UUID) (*models.Provider, error)
 	ListProviders(ctx context.Context, filters map[string]interface{}) ([]*models.Provider, error)
+	QueryProviders(ctx context.Context, query *models.ProviderQuery) ([]*models.Provider, int, error)
 	UpdateProvider(ctx context.Context, id uuid.UUID, updatedProvider *models.Provider) error
 	DeleteProvider(ctx context.Context, id uuid.UUID) error
 	UpdateProviderStatus(ctx context.Context, id uuid.UUID, status models.ProviderStatus) error
 	UpdateProviderHeartbeat(ctx context.Context, id uuid.UUID, gpuMetrics []models.GPUDetail) error
+	UseNonce(ctx context.Context, key string, expiresAt time.Time) (bool, error)
 	Initialize(ctx context.Context) error
 	Close() error
 }
@@ -56,6 +59,7 @@ func (h *ProviderHandler) Routes() chi.Router {
 	r.Put("/{providerID}", h.UpdateProvider)                // PUT /providers/{providerID}
 	r.Patch("/{providerID}/status", h.UpdateProviderStatus) // PATCH /providers/{providerID}/status
 	r.Post("/{providerID}/heartbeat", h.ProviderHeartbeat)  // POST /providers/{providerID}/heartbeat
+	r.Post("/{providerID}/offline", h.MarkProviderOffline)  // POST /providers/{providerID}/offline
 	r.Delete("/{providerID}", h.DeregisterProvider)         // DELETE /providers/{providerID}
 	return r
 }
@@ -125,46 +129,22 @@ func (h *ProviderHandler) ListProviders(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	logger := h.Logger.FromContext(ctx)
 
-	// Parse query parameters for filtering
-	queryParams := r.URL.Query()
-	filters := make(map[string]interface{})
-
-	// Add status filter if provided
-	if status := queryParams.Get("status"); status != "" {
-		filters["status"] = status
-	}
-
-	// Add GPU model filter if provided
-	if gpuModel := queryParams.Get("gpu_model"); gpuModel != "" {
-		filters["gpu_model"] = gpuModel
-	}
-
-	// Add min VRAM filter if provided
-	if minVRAM := queryParams.Get("min_vram"); minVRAM != "" {
-		// Parse minVRAM to uint64
-		var vramValue uint64
-		if _, err := fmt.Sscanf(minVRAM, "%d", &vramValue); err == nil && vramValue > 0 {
-			filters["min_vram"] = vramValue
-		}
-	}
-
-	// Add architecture filter if provided
-	if arch := queryParams.Get("architecture"); arch != "" {
-		filters["architecture"] = arch
-	}
-
-	// Add healthy_only filter if provided
-	if healthy := queryParams.Get("healthy_only"); healthy == "true" {
-		filters["healthy_only"] = true
+	query, err := parseProviderQuery(r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	// Providers whose heartbeat expired since the reaper last ran are already offline
+	query.StaleBefore = time.Now().UTC().Add(-h.Config.ProviderHeartbeatTTL)
 
-	providers, err := h.Store.ListProviders(ctx, filters)
+	page, total, err := h.Store.QueryProviders(ctx, query)
 	if err != nil {
 		logger.Error("Failed to list providers from store", zap.Error(err))
 		RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve providers")
 		return
 	}
-	RespondWithJSON(w, http.StatusOK, providers)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	RespondWithJSON(w, http.StatusOK, page)
 }
 
 // GetProvider retrieves a specific provider by its ID.
@@ -192,36 +172,46 @@ func (h *ProviderHandler) GetProvider(w http.ResponseWriter, r *http.Request) {
 	RespondWithJSON(w, http.StatusOK, provider)
 }
 
-// UpdateProvider handles full updates to a provider's details.
+// UpdateProvider handles full updates to a provider's details. It must be signed by
+// the provider, and can't change the wallet the provider registered with.
 func (h *ProviderHandler) UpdateProvider(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := h.Logger.FromContext(ctx)
 
-	providerIDStr := chi.URLParam(r, "providerID")
-	providerID, err := uuid.Parse(providerIDStr)
-	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Invalid provider ID format")
+	provider, body := h.authorizeProvider(w, r, ActionUpdate)
+	if provider == nil {
 		return
 	}
 
 	var req models.Provider // Expecting full provider object for PUT
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		logger.Error("Failed to decode update provider request", zap.Error(err))
 		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	// Ensure the ID in the path matches the ID in the body, or just use the path ID.
-	req.ID = providerID
+	// Use the path ID whatever the body says
+	req.ID = provider.ID
 	// Update timestamps are handled by the model or store logic when implemented with DB.
 	// For in-memory, we might need to explicitly set LastSeenAt if not using the model methods.
 	req.LastSeenAt = time.Now().UTC()
 
-	if err := h.Store.UpdateProvider(ctx, providerID, &req); err != nil {
+	// The wallet is what the provider's requests are verified against and where it is
+	// paid, so it stays the one it registered with
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]interface{})
+	}
+	if wallet, ok := provider.Metadata[providerWalletMetadataKey]; ok {
+		req.Metadata[providerWalletMetadataKey] = wallet
+	} else {
+		delete(req.Metadata, providerWalletMetadataKey)
+	}
+
+	if err := h.Store.UpdateProvider(ctx, provider.ID, &req); err != nil {
 		if err == models.ErrProviderNotFound {
 			RespondWithError(w, http.StatusNotFound, err.Error())
 		} else {
-			logger.Error("Failed to update provider in store", zap.String("provider_id", providerIDStr), zap.Error(err))
+			logger.Error("Failed to update provider in store", zap.String("provider_id", provider.ID.String()), zap.Error(err))
 			RespondWithError(w, http.StatusInternalServerError, "Failed to update provider")
 		}
 		return
@@ -229,20 +219,19 @@ func (h *ProviderHandler) UpdateProvider(w http.ResponseWriter, r *http.Request)
 	RespondWithJSON(w, http.StatusOK, &req)
 }
 
-// UpdateProviderStatus handles partial updates to a provider's status.
+// UpdateProviderStatus handles partial updates to a provider's status. It must be
+// signed by the provider.
 func (h *ProviderHandler) UpdateProviderStatus(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := h.Logger.FromContext(ctx)
 
-	providerIDStr := chi.URLParam(r, "providerID")
-	providerID, err := uuid.Parse(providerIDStr)
-	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Invalid provider ID format")
+	provider, body := h.authorizeProvider(w, r, ActionStatus)
+	if provider == nil {
 		return
 	}
 
 	var req UpdateProviderStatusRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		logger.Error("Failed to decode update provider status request", zap.Error(err))
 		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
@@ -250,11 +239,11 @@ func (h *ProviderHandler) UpdateProviderStatus(w http.ResponseWriter, r *http.Re
 
 	// Validate status value (optional, if ProviderStatus has more complex rules)
 
-	if err := h.Store.UpdateProviderStatus(ctx, providerID, req.Status); err != nil {
+	if err := h.Store.UpdateProviderStatus(ctx, provider.ID, req.Status); err != nil {
 		if err == models.ErrProviderNotFound {
 			RespondWithError(w, http.StatusNotFound, err.Error())
 		} else {
-			logger.Error("Failed to update provider status in store", zap.String("provider_id", providerIDStr), zap.Error(err))
+			logger.Error("Failed to update provider status in store", zap.String("provider_id", provider.ID.String()), zap.Error(err))
 			RespondWithError(w, http.StatusInternalServerError, "Failed to update provider status")
 		}
 		return
@@ -262,24 +251,25 @@ func (h *ProviderHandler) UpdateProviderStatus(w http.ResponseWriter, r *http.Re
 	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Provider status updated"})
 }
 
-// ProviderHeartbeat handles heartbeat signals from providers.
+// ProviderHeartbeat handles heartbeat signals from providers. Heartbeats must be signed
+// by the provider, see authorizeProvider.
 func (h *ProviderHandler) ProviderHeartbeat(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := h.Logger.FromContext(ctx)
 
-	providerIDStr := chi.URLParam(r, "providerID")
-	providerID, err := uuid.Parse(providerIDStr)
-	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Invalid provider ID format")
+	// Only the provider itself may report its heartbeat
+	provider, body := h.authorizeProvider(w, r, ActionHeartbeat)
+	if provider == nil {
 		return
 	}
+	providerIDStr := provider.ID.String()
 
 	// Parse GPU metrics if they are provided in the request body
 	var req HeartbeatRequest
 	var gpuMetrics []models.GPUDetail
 
-	if r.ContentLength > 0 {
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
 			logger.Error("Failed to decode heartbeat request", zap.Error(err))
 			RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 			return
@@ -287,7 +277,7 @@ func (h *ProviderHandler) ProviderHeartbeat(w http.ResponseWriter, r *http.Reque
 		gpuMetrics = req.GPUMetrics
 	}
 
-	if err := h.Store.UpdateProviderHeartbeat(ctx, providerID, gpuMetrics); err != nil {
+	if err := h.Store.UpdateProviderHeartbeat(ctx, provider.ID, gpuMetrics); err != nil {
 		if err == models.ErrProviderNotFound {
 			RespondWithError(w, http.StatusNotFound, err.Error())
 		} else {
@@ -300,19 +290,46 @@ func (h *ProviderHandler) ProviderHeartbeat(w http.ResponseWriter, r *http.Reque
 	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Heartbeat received"})
 }
 
-// DeregisterProvider handles provider deregistration.
+// MarkProviderOffline handles a provider announcing a clean shutdown. It is marked
+// offline straight away instead of lingering until its heartbeat times out; its
+// registration is kept, and its next heartbeat brings it back online. It must be
+// signed by the provider.
+func (h *ProviderHandler) MarkProviderOffline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := h.Logger.FromContext(ctx)
+
+	provider, _ := h.authorizeProvider(w, r, ActionOffline)
+	if provider == nil {
+		return
+	}
+	providerIDStr := provider.ID.String()
+
+	if err := h.Store.UpdateProviderStatus(ctx, provider.ID, models.StatusOffline); err != nil {
+		if err == models.ErrProviderNotFound {
+			RespondWithError(w, http.StatusNotFound, err.Error())
+		} else {
+			logger.Error("Failed to mark provider offline", zap.String("provider_id", providerIDStr), zap.Error(err))
+			RespondWithError(w, http.StatusInternalServerError, "Failed to mark provider offline")
+		}
+		return
+	}
+
+	logger.Info("Provider went offline", zap.String("provider_id", providerIDStr))
+	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Provider marked offline"})
+}
+
+// DeregisterProvider handles provider deregistration. It must be signed by the provider.
 func (h *ProviderHandler) DeregisterProvider(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := h.Logger.FromContext(ctx)
 
-	providerIDStr := chi.URLParam(r, "providerID")
-	providerID, err := uuid.Parse(providerIDStr)
-	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Invalid provider ID format")
+	provider, _ := h.authorizeProvider(w, r, ActionDeregister)
+	if provider == nil {
 		return
 	}
+	providerIDStr := provider.ID.String()
 
-	if err := h.Store.DeleteProvider(ctx, providerID); err != nil {
+	if err := h.Store.DeleteProvider(ctx, provider.ID); err != nil {
 		if err == models.ErrProviderNotFound {
 			RespondWithError(w, http.StatusNotFound, err.Error())
 		} else {
@@ -326,6 +343,67 @@ func (h *ProviderHandler) DeregisterProvider(w http.ResponseWriter, r *http.Requ
 	RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Provider deregistered successfully"})
 }
 
+// maxProviderRequestBodyBytes caps the size of a signed provider request body.
+const maxProviderRequestBodyBytes = 1 << 20
+
+// authorizeProvider reads the body of a request the provider must sign for action, and
+// checks the signature and that its nonce wasn't used before. Nonces are kept in the
+// store, so a request can't be replayed against another registry instance. It returns
+// the provider and the body, or writes the error response and returns a nil provider.
+func (h *ProviderHandler) authorizeProvider(w http.ResponseWriter, r *http.Request, action string) (*models.Provider, []byte) {
+	ctx := r.Context()
+	logger := h.Logger.FromContext(ctx)
+
+	providerIDStr := chi.URLParam(r, "providerID")
+	providerID, err := uuid.Parse(providerIDStr)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid provider ID format")
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxProviderRequestBodyBytes))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Failed to read request body")
+		return nil, nil
+	}
+
+	provider, err := h.Store.GetProvider(ctx, providerID)
+	if err != nil {
+		if err == models.ErrProviderNotFound {
+			RespondWithError(w, http.StatusNotFound, err.Error())
+		} else {
+			logger.Error("Failed to get provider", zap.String("provider_id", providerIDStr), zap.Error(err))
+			RespondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		}
+		return nil, nil
+	}
+
+	now := time.Now()
+	maxSkew := h.Config.HeartbeatMaxClockSkew
+	signature := signatureFromRequest(r)
+	signed, err := verifyProviderRequest(provider, action, signature, body, now, maxSkew, h.Config.AllowUnsignedHeartbeats)
+	if err == nil && signed {
+		// Only checked once the signature holds, so forged requests can't burn nonces.
+		// A nonce is remembered for as long as its timestamp is accepted.
+		var unused bool
+		unused, err = h.Store.UseNonce(ctx, nonceKey(provider.ID, signature.nonce), now.Add(2*maxSkew))
+		if err != nil {
+			logger.Error("Failed to record provider request nonce", zap.String("provider_id", providerIDStr), zap.Error(err))
+			RespondWithError(w, http.StatusInternalServerError, "Failed to process request")
+			return nil, nil
+		}
+		if !unused {
+			err = errRequestReplayed
+		}
+	}
+	if err != nil {
+		logger.Warn("Rejected provider request", zap.String("provider_id", providerIDStr), zap.String("action", action), zap.Error(err))
+		RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return nil, nil
+	}
+	return provider, body
+}
+
 // RespondWithError is a helper to send JSON error responses.
 func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, map[string]string{"error": message})
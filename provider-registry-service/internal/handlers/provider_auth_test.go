@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/config"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/logging"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/store"
+	"github.com/mr-tron/base58"
+	"go.uber.org/zap"
+)
+
+// signedProvider is a registered provider and the key of its wallet
+type signedProvider struct {
+	provider *models.Provider
+	key      ed25519.PrivateKey
+}
+
+func newTestHandler(t *testing.T) (*ProviderHandler, *store.InMemoryProviderStore) {
+	t.Helper()
+	providerStore := store.NewInMemoryProviderStore()
+	cfg := &config.Config{HeartbeatMaxClockSkew: time.Minute}
+	return NewProviderHandler(logging.NewContextLogger(zap.NewNop()), cfg, providerStore), providerStore
+}
+
+func registerSignedProvider(t *testing.T, providerStore *store.InMemoryProviderStore) *signedProvider {
+	t.Helper()
+	publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := models.NewProvider("owner-1", "provider-1", "", "", "", []models.GPUDetail{{ModelName: "RTX 4090", VRAM: 24576}},
+		map[string]interface{}{providerWalletMetadataKey: base58.Encode(publicKey)})
+	if err := providerStore.AddProvider(context.Background(), provider); err != nil {
+		t.Fatal(err)
+	}
+	return &signedProvider{provider: provider, key: key}
+}
+
+// request builds a request for action signed by the provider at the given time
+func (p *signedProvider) request(method, path, action, nonce string, body []byte, at time.Time) *http.Request {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	signature := ed25519.Sign(p.key, ProviderSigningPayload(action, p.provider.ID, timestamp, nonce, body))
+	req.Header.Set(HeaderProviderTimestamp, timestamp)
+	req.Header.Set(HeaderProviderNonce, nonce)
+	req.Header.Set(HeaderProviderSignature, base58.Encode(signature))
+	return req
+}
+
+func serve(h *ProviderHandler, req *http.Request) int {
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestSignedProviderRequests(t *testing.T) {
+	h, providerStore := newTestHandler(t)
+	p := registerSignedProvider(t, providerStore)
+	id := p.provider.ID.String()
+	now := time.Now()
+	statusBody := []byte(`{"status":"maintenance"}`)
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want int
+	}{
+		{"signed heartbeat", func() *http.Request {
+			return p.request("POST", "/"+id+"/heartbeat", ActionHeartbeat, "n1", []byte(`{}`), now)
+		}, http.StatusOK},
+		{"signed status", func() *http.Request {
+			return p.request("PATCH", "/"+id+"/status", ActionStatus, "n2", statusBody, now)
+		}, http.StatusOK},
+		{"replayed status", func() *http.Request {
+			return p.request("PATCH", "/"+id+"/status", ActionStatus, "n2", statusBody, now)
+		}, http.StatusUnauthorized},
+		{"tampered body", func() *http.Request {
+			req := p.request("PATCH", "/"+id+"/status", ActionStatus, "n3", statusBody, now)
+			req.Body = io.NopCloser(strings.NewReader(`{"status":"offline"}`))
+			return req
+		}, http.StatusUnauthorized},
+		{"signature for another action", func() *http.Request {
+			return p.request("POST", "/"+id+"/offline", ActionHeartbeat, "n4", nil, now)
+		}, http.StatusUnauthorized},
+		{"stale timestamp", func() *http.Request {
+			return p.request("POST", "/"+id+"/offline", ActionOffline, "n5", nil, now.Add(-2*time.Minute))
+		}, http.StatusUnauthorized},
+		{"unsigned offline", func() *http.Request {
+			return httptest.NewRequest("POST", "/"+id+"/offline", nil)
+		}, http.StatusUnauthorized},
+		{"unsigned deregister", func() *http.Request {
+			return httptest.NewRequest("DELETE", "/"+id, nil)
+		}, http.StatusUnauthorized},
+		{"signed offline", func() *http.Request {
+			return p.request("POST", "/"+id+"/offline", ActionOffline, "n6", nil, now)
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(h, tt.req()); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Only the signed requests took effect
+	provider, err := providerStore.GetProvider(context.Background(), p.provider.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.Status != models.StatusOffline {
+		t.Errorf("provider status = %s, want offline from the last signed request", provider.Status)
+	}
+}
+
+func TestForgedSignatureDoesNotBurnNonce(t *testing.T) {
+	h, providerStore := newTestHandler(t)
+	p := registerSignedProvider(t, providerStore)
+	path := "/" + p.provider.ID.String() + "/offline"
+
+	forged := p.request("POST", path, ActionOffline, "nonce", nil, time.Now())
+	forged.Header.Set(HeaderProviderSignature, base58.Encode(make([]byte, ed25519.SignatureSize)))
+	if got := serve(h, forged); got != http.StatusUnauthorized {
+		t.Fatalf("forged request status = %d, want 401", got)
+	}
+	if got := serve(h, p.request("POST", path, ActionOffline, "nonce", nil, time.Now())); got != http.StatusOK {
+		t.Errorf("signed request with the forged request's nonce: status = %d, want 200", got)
+	}
+}
+
+func TestUpdateProviderKeepsWallet(t *testing.T) {
+	h, providerStore := newTestHandler(t)
+	p := registerSignedProvider(t, providerStore)
+	wallet := p.provider.Metadata[providerWalletMetadataKey]
+
+	update := *p.provider
+	update.Name = "renamed"
+	update.Metadata = map[string]interface{}{providerWalletMetadataKey: "AttackerWa11et1111111111111111111111111111111"}
+	body, err := json.Marshal(&update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsigned, the update is refused outright
+	unsigned := httptest.NewRequest("PUT", "/"+p.provider.ID.String(), bytes.NewReader(body))
+	if got := serve(h, unsigned); got != http.StatusUnauthorized {
+		t.Fatalf("unsigned update status = %d, want 401", got)
+	}
+
+	// Signed, it goes through but can't move the wallet
+	if got := serve(h, p.request("PUT", "/"+p.provider.ID.String(), ActionUpdate, "n1", body, time.Now())); got != http.StatusOK {
+		t.Fatalf("signed update status = %d, want 200", got)
+	}
+	provider, err := providerStore.GetProvider(context.Background(), p.provider.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.Name != "renamed" {
+		t.Errorf("name = %q, want the update applied", provider.Name)
+	}
+	if got := provider.Metadata[providerWalletMetadataKey]; got != wallet {
+		t.Errorf("wallet = %v, want the registered %v", got, wallet)
+	}
+}
+
+func TestUnsignedRequestsFromProvidersWithoutWallet(t *testing.T) {
+	h, providerStore := newTestHandler(t)
+	provider := models.NewProvider("owner-1", "provider-1", "", "", "", []models.GPUDetail{{ModelName: "RTX 4090", VRAM: 24576}}, nil)
+	if err := providerStore.AddProvider(context.Background(), provider); err != nil {
+		t.Fatal(err)
+	}
+	path := "/" + provider.ID.String() + "/offline"
+
+	if got := serve(h, httptest.NewRequest("POST", path, nil)); got != http.StatusUnauthorized {
+		t.Errorf("unsigned request status = %d, want 401", got)
+	}
+	h.Config.AllowUnsignedHeartbeats = true
+	if got := serve(h, httptest.NewRequest("POST", path, nil)); got != http.StatusOK {
+		t.Errorf("unsigned request with unsigned requests allowed: status = %d, want 200", got)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+)
+
+// maxProviderPageSize caps the number of providers returned in a single page.
+const maxProviderPageSize = 500
+
+// parseProviderQuery parses and validates listing options from query parameters.
+func parseProviderQuery(params url.Values) (*models.ProviderQuery, error) {
+	q := &models.ProviderQuery{
+		Status:       params.Get("status"),
+		GPUModel:     params.Get("gpu_model"),
+		Architecture: params.Get("architecture"),
+		Location:     params.Get("location"),
+		HealthyOnly:  params.Get("healthy_only") == "true",
+		SortBy:       models.SortByName,
+	}
+
+	if v := params.Get("min_vram"); v != "" {
+		// An unparsable minimum is ignored
+		if vram, err := strconv.ParseUint(v, 10, 64); err == nil {
+			q.MinVRAM = vram
+		}
+	}
+
+	if v := params.Get("max_price_per_hour"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid max_price_per_hour: %s", v)
+		}
+		q.MaxPricePerHour = &price
+	}
+
+	if v := params.Get("min_rating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 {
+			return nil, fmt.Errorf("invalid min_rating: %s", v)
+		}
+		q.MinRating = rating
+	}
+
+	q.OnlineOnly = params.Get("online") == "true"
+	q.HasCapacity = params.Get("has_capacity") == "true"
+
+	if v := params.Get("sort_by"); v != "" {
+		switch v {
+		case models.SortByName, models.SortByPrice, models.SortByRating, models.SortByCapacity, models.SortByLocation, models.SortByLastSeen:
+			q.SortBy = v
+		default:
+			return nil, fmt.Errorf("invalid sort_by: %s", v)
+		}
+	}
+
+	switch order := params.Get("sort_order"); order {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return nil, fmt.Errorf("invalid sort_order: %s", order)
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit > maxProviderPageSize {
+			limit = maxProviderPageSize
+		}
+		q.Limit = limit
+	}
+
+	if v := params.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset: %s", v)
+		}
+		q.Offset = offset
+	}
+
+	return q, nil
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+)
+
+func TestParseProviderQuery(t *testing.T) {
+	q, err := parseProviderQuery(url.Values{
+		"status": {"idle"}, "min_vram": {"24576"}, "max_price_per_hour": {"1.5"},
+		"sort_by": {"price"}, "sort_order": {"desc"}, "limit": {"1000"}, "offset": {"10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Status != "idle" || q.MinVRAM != 24576 || *q.MaxPricePerHour != 1.5 || q.SortBy != models.SortByPrice || !q.Descending {
+		t.Errorf("query = %+v", q)
+	}
+	if q.Limit != maxProviderPageSize || q.Offset != 10 {
+		t.Errorf("limit %d offset %d, want the limit capped at %d", q.Limit, q.Offset, maxProviderPageSize)
+	}
+
+	for _, params := range []url.Values{
+		{"sort_by": {"ip"}}, {"sort_order": {"up"}}, {"limit": {"0"}}, {"offset": {"-1"}}, {"min_rating": {"x"}},
+	} {
+		if _, err := parseProviderQuery(params); err == nil {
+			t.Errorf("%v accepted", params)
+		}
+	}
+}
+
+func TestListProvidersPages(t *testing.T) {
+	h, providerStore := newTestHandler(t)
+	h.Config.ProviderHeartbeatTTL = time.Minute
+	for i, name := range []string{"c", "a", "b"} {
+		p := models.NewProvider("owner-1", name, "", "", "", nil, map[string]interface{}{"min_price_per_hour": float64(i)})
+		if name == "b" {
+			p.LastSeenAt = time.Now().Add(-time.Hour)
+		}
+		if err := providerStore.AddProvider(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, httptest.NewRequest("GET", "/?online=true&sort_by=price&limit=1&offset=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var page []*models.Provider
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	// b missed its heartbeats, leaving c and a online, by price
+	if len(page) != 1 || page[0].Name != "a" {
+		t.Errorf("page = %v, want [a]", page)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "2" {
+		t.Errorf("X-Total-Count = %s, want 2", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Package metrics holds the registry's Prometheus collectors and the /metrics handler.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+)
+
+const (
+	namespace = "dante"
+	subsystem = "provider_registry"
+
+	// listTimeout bounds the provider listing behind each scrape
+	listTimeout = 5 * time.Second
+)
+
+// RequestDuration observes request latency by method, route pattern and status code.
+var RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: subsystem,
+	Name:      "request_duration_seconds",
+	Help:      "HTTP request latency by method, route and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// ProviderLister lists the registered providers exported on every scrape.
+type ProviderLister interface {
+	ListProviders(ctx context.Context, filters map[string]interface{}) ([]*models.Provider, error)
+}
+
+var registerOnce sync.Once
+
+// Register adds the registry's collectors to the default registry, which already holds
+// the Go runtime and process collectors. Only the first call registers anything, so
+// tests building several routers don't panic on duplicate registration.
+func Register(providers ProviderLister, logger *zap.Logger) {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(RequestDuration, newProviderCollector(providers, logger))
+	})
+}
+
+// Handler serves the default registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records RequestDuration for every request. Requests are labeled with the
+// matched chi route pattern rather than the path, so IDs in URLs don't become labels.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+		RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// providerCollector exports provider counts and the GPU utilization from the latest
+// heartbeats, read from the store on every scrape.
+type providerCollector struct {
+	providers ProviderLister
+	logger    *zap.Logger
+
+	providerCount  *prometheus.Desc
+	gpuUtilization *prometheus.Desc
+	gpuMemory      *prometheus.Desc
+	gpuTemperature *prometheus.Desc
+}
+
+func newProviderCollector(providers ProviderLister, logger *zap.Logger) *providerCollector {
+	gpuLabels := []string{"provider_id", "gpu_index", "model"}
+	return &providerCollector{
+		providers: providers,
+		logger:    logger,
+		providerCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "providers"),
+			"Registered providers by status.", []string{"status"}, nil),
+		gpuUtilization: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "gpu_utilization"),
+			"GPU utilization percent from the provider's latest heartbeat.", gpuLabels, nil),
+		gpuMemory: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "gpu_memory_utilization"),
+			"GPU memory utilization percent from the provider's latest heartbeat.", gpuLabels, nil),
+		gpuTemperature: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "gpu_temperature_celsius"),
+			"GPU temperature from the provider's latest heartbeat.", gpuLabels, nil),
+	}
+}
+
+func (c *providerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.providerCount
+	ch <- c.gpuUtilization
+	ch <- c.gpuMemory
+	ch <- c.gpuTemperature
+}
+
+// Collect lists the providers. A failed listing leaves them out of the scrape rather
+// than failing it, so the request metrics are still reported.
+func (c *providerCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	providers, err := c.providers.ListProviders(ctx, nil)
+	if err != nil {
+		c.logger.Warn("Failed to list providers for metrics", zap.Error(err))
+		return
+	}
+
+	counts := map[models.ProviderStatus]int{
+		models.StatusIdle:        0,
+		models.StatusBusy:        0,
+		models.StatusOffline:     0,
+		models.StatusMaintenance: 0,
+		models.StatusError:       0,
+	}
+	for _, p := range providers {
+		counts[p.Status]++
+		if p.Status == models.StatusOffline {
+			continue // Heartbeat values of offline providers are stale
+		}
+		for i, gpu := range p.GPUs {
+			labels := []string{p.ID.String(), strconv.Itoa(i), gpu.ModelName}
+			ch <- prometheus.MustNewConstMetric(c.gpuUtilization, prometheus.GaugeValue, float64(gpu.UtilizationGPU), labels...)
+			ch <- prometheus.MustNewConstMetric(c.gpuMemory, prometheus.GaugeValue, float64(gpu.UtilizationMem), labels...)
+			ch <- prometheus.MustNewConstMetric(c.gpuTemperature, prometheus.GaugeValue, float64(gpu.Temperature), labels...)
+		}
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.providerCount, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
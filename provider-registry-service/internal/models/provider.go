@@ -17,6 +17,21 @@ const (
 	StatusError       ProviderStatus = "error"
 )
 
+// ActiveStatuses are the statuses of a provider taking jobs. Only an active provider
+// whose heartbeat stops is taken to be gone and marked offline; one in maintenance or
+// in error keeps its status.
+var ActiveStatuses = []ProviderStatus{StatusIdle, StatusBusy}
+
+// IsActive reports whether the status is one of ActiveStatuses.
+func (s ProviderStatus) IsActive() bool {
+	for _, active := range ActiveStatuses {
+		if s == active {
+			return true
+		}
+	}
+	return false
+}
+
 // GPUDetail holds specific information about a GPU.
 type GPUDetail struct {
 	ModelName         string `json:"model_name" yaml:"model_name"`
@@ -35,10 +50,21 @@ type GPUDetail struct {
 	Temperature    uint8  `json:"temperature_c,omitempty" yaml:"temperature_c,omitempty"`                           // Celsius
 	PowerDraw      uint32 `json:"power_draw_w,omitempty" yaml:"power_draw_w,omitempty"`                             // Current power usage in Watts
 
+	// Latest self-benchmark reported by the provider, if it has run one
+	Benchmark *GPUBenchmark `json:"benchmark,omitempty" yaml:"benchmark,omitempty"`
+
 	// Functional status
 	IsHealthy bool `json:"is_healthy" yaml:"is_healthy"` // Whether the GPU is in a good operational state
 }
 
+// GPUBenchmark holds measured GPU performance from the provider's self-benchmark.
+type GPUBenchmark struct {
+	FP16TFLOPS         float64   `json:"fp16_tflops" yaml:"fp16_tflops"`
+	MemoryBandwidthGBs float64   `json:"memory_bandwidth_gb_s" yaml:"memory_bandwidth_gb_s"`
+	StabilityScore     float64   `json:"stability_score" yaml:"stability_score"` // 0-1, 1 means no variation between samples
+	RunAt              time.Time `json:"run_at" yaml:"run_at"`
+}
+
 // Provider represents a registered GPU provider in the system.
 // This struct will be used for API requests/responses and internal representation.
 // For database storage, it would map to a table.
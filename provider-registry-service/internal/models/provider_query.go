@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider listing sort keys.
+const (
+	SortByName     = "name"
+	SortByPrice    = "price"
+	SortByRating   = "rating"
+	SortByCapacity = "capacity"
+	SortByLocation = "location"
+	SortByLastSeen = "last_seen"
+)
+
+// ProviderQuery selects, orders and pages providers in a listing. Stores evaluate the
+// whole query, so only the requested page is read.
+type ProviderQuery struct {
+	Status       string // Effective status, see StaleBefore
+	GPUModel     string // Substring of a GPU's model name, case-insensitive
+	Architecture string // Substring of a GPU's architecture, case-insensitive
+	Location     string // Substring of the location, case-insensitive
+	MinVRAM      uint64 // A GPU must have at least this much VRAM, in MB
+	HealthyOnly  bool   // Every GPU must be healthy
+
+	MaxPricePerHour *float64 // The provider's min_price_per_hour metadata must be set and at most this
+	MinRating       float64  // Compared with the provider's rating metadata, 0 if unset
+	OnlineOnly      bool     // Effective status isn't offline
+	HasCapacity     bool     // Effective status is idle
+
+	// StaleBefore makes providers last seen before it count as offline, and be listed
+	// as such, even if the reaper hasn't marked them yet. Zero means no cutoff.
+	StaleBefore time.Time
+
+	SortBy     string // One of the SortBy keys; name if empty. Ties fall back to name, then ID
+	Descending bool
+	Limit      int // 0 means no limit
+	Offset     int
+}
+
+// ProviderQueryFromFilters builds a query from the filters map ListProviders takes.
+func ProviderQueryFromFilters(filters map[string]interface{}) *ProviderQuery {
+	q := &ProviderQuery{}
+	q.Status, _ = filters["status"].(string)
+	q.GPUModel, _ = filters["gpu_model"].(string)
+	q.Architecture, _ = filters["architecture"].(string)
+	q.Location, _ = filters["location"].(string)
+	q.MinVRAM, _ = filters["min_vram"].(uint64)
+	q.HealthyOnly, _ = filters["healthy_only"].(bool)
+	return q
+}
+
+// MetadataFloat reads a numeric metadata value, which may be stored as a JSON
+// number or as a decimal string.
+func MetadataFloat(metadata map[string]interface{}, key string) (float64, bool) {
+	switch v := metadata[key].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// HealthyVRAM sums the VRAM of the provider's healthy GPUs in MB.
+func (p *Provider) HealthyVRAM() uint64 {
+	var total uint64
+	for _, gpu := range p.GPUs {
+		if gpu.IsHealthy {
+			total += gpu.VRAM
+		}
+	}
+	return total
+}
@@ -0,0 +1,70 @@
+package reaper
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// StaleProviderStore is the part of the provider store the reaper needs.
+type StaleProviderStore interface {
+	MarkStaleProvidersOffline(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error)
+}
+
+// Reaper marks active providers offline once their heartbeat is older than the TTL, so a
+// provider that crashed without going offline stops being offered for jobs. The next
+// heartbeat of a reaped provider brings it back online.
+type Reaper struct {
+	store    StaleProviderStore
+	ttl      time.Duration
+	interval time.Duration
+	logger   *zap.Logger
+	now      func() time.Time // Replaceable clock
+}
+
+// NewReaper creates a reaper that checks every interval for providers not seen for ttl.
+func NewReaper(store StaleProviderStore, ttl, interval time.Duration, logger *zap.Logger) *Reaper {
+	return &Reaper{
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Run reaps stale providers every interval until ctx is canceled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reap(ctx); err != nil {
+				r.logger.Error("Failed to reap stale providers", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Reap marks the active providers last seen more than the TTL ago offline and returns
+// their IDs.
+func (r *Reaper) Reap(ctx context.Context) ([]uuid.UUID, error) {
+	cutoff := r.now().UTC().Add(-r.ttl)
+	ids, err := r.store.MarkStaleProvidersOffline(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		r.logger.Warn("Provider heartbeat expired, marked offline",
+			zap.String("provider_id", id.String()),
+			zap.Duration("ttl", r.ttl),
+		)
+	}
+	return ids, nil
+}
@@ -0,0 +1,105 @@
+package reaper
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/store"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// addProvider stores a provider in the status, last seen at lastSeen
+func addProvider(t *testing.T, s *store.InMemoryProviderStore, name string, status models.ProviderStatus, lastSeen time.Time) *models.Provider {
+	t.Helper()
+	provider := models.NewProvider("owner-1", name, "", "", "", nil, nil)
+	provider.Status = status
+	provider.LastSeenAt = lastSeen
+	if err := s.AddProvider(context.Background(), provider); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func sortedIDs(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	sort.Strings(out)
+	return out
+}
+
+func status(t *testing.T, s *store.InMemoryProviderStore, id uuid.UUID) models.ProviderStatus {
+	t.Helper()
+	provider, err := s.GetProvider(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.Status
+}
+
+func TestReapMarksStaleActiveProvidersOffline(t *testing.T) {
+	s := store.NewInMemoryProviderStore()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReaper(s, 90*time.Second, time.Minute, zap.NewNop())
+	r.now = func() time.Time { return now }
+
+	stale := now.Add(-2 * time.Minute)
+	idle := addProvider(t, s, "idle", models.StatusIdle, stale)
+	busy := addProvider(t, s, "busy", models.StatusBusy, stale)
+	maintenance := addProvider(t, s, "maintenance", models.StatusMaintenance, stale)
+	failed := addProvider(t, s, "error", models.StatusError, stale)
+	fresh := addProvider(t, s, "fresh", models.StatusIdle, now.Add(-time.Minute))
+
+	ids, err := r.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sortedIDs([]uuid.UUID{idle.ID, busy.ID})
+	if got := sortedIDs(ids); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("reaped %v, want the idle and busy providers %v", got, want)
+	}
+	for _, p := range []*models.Provider{idle, busy} {
+		if got := status(t, s, p.ID); got != models.StatusOffline {
+			t.Errorf("%s provider is %s, want offline", p.Name, got)
+		}
+	}
+	for _, p := range []struct {
+		provider *models.Provider
+		want     models.ProviderStatus
+	}{{maintenance, models.StatusMaintenance}, {failed, models.StatusError}, {fresh, models.StatusIdle}} {
+		if got := status(t, s, p.provider.ID); got != p.want {
+			t.Errorf("%s provider is %s, want it left %s", p.provider.Name, got, p.want)
+		}
+	}
+
+	// Reaped providers aren't reaped again; the fresh one is once its TTL runs out
+	now = now.Add(31 * time.Second)
+	ids, err = r.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != fresh.ID {
+		t.Errorf("reaped %v at the fresh provider's TTL, want only %s", ids, fresh.ID)
+	}
+}
+
+func TestReapKeepsProviderAtTTL(t *testing.T) {
+	s := store.NewInMemoryProviderStore()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReaper(s, 90*time.Second, time.Minute, zap.NewNop())
+	r.now = func() time.Time { return now }
+	addProvider(t, s, "edge", models.StatusBusy, now.Add(-90*time.Second))
+
+	ids, err := r.Reap(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("reaped %v last seen exactly the TTL ago, want it kept", ids)
+	}
+}
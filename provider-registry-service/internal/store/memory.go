@@ -2,8 +2,10 @@ package store
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
 	"github.com/google/uuid"
@@ -14,12 +16,14 @@ import (
 type InMemoryProviderStore struct {
 	mu        sync.RWMutex
 	providers map[uuid.UUID]*models.Provider
+	nonces    map[string]time.Time // Nonce -> expiry
 }
 
 // NewInMemoryProviderStore creates a new in-memory provider store.
 func NewInMemoryProviderStore() *InMemoryProviderStore {
 	return &InMemoryProviderStore{
 		providers: make(map[uuid.UUID]*models.Provider),
+		nonces:    make(map[string]time.Time),
 	}
 }
 
@@ -62,42 +66,66 @@ func (s *InMemoryProviderStore) GetProvider(ctx context.Context, id uuid.UUID) (
 	return provider, nil
 }
 
-// ListProviders returns a list of all providers with optional filtering.
-// For now, it returns all providers.
+// ListProviders returns the providers matching the filters, ordered by name.
 func (s *InMemoryProviderStore) ListProviders(ctx context.Context, filters map[string]interface{}) ([]*models.Provider, error) {
+	providers, _, err := s.QueryProviders(ctx, models.ProviderQueryFromFilters(filters))
+	return providers, err
+}
+
+// QueryProviders returns the page of providers the query selects and how many it
+// selects in all.
+func (s *InMemoryProviderStore) QueryProviders(ctx context.Context, query *models.ProviderQuery) ([]*models.Provider, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Start with all providers
-	var filtered []*models.Provider
+	var matched []*models.Provider
 	for _, provider := range s.providers {
-		// Apply filters if any
-		if passesFilters(provider, filters) {
-			filtered = append(filtered, provider)
+		if !query.StaleBefore.IsZero() && provider.Status.IsActive() && provider.LastSeenAt.Before(query.StaleBefore) {
+			// Copied, so the stored record is left to the reaper
+			stale := *provider
+			stale.Status = models.StatusOffline
+			provider = &stale
+		}
+		if passesQuery(provider, query) {
+			matched = append(matched, provider)
 		}
 	}
 
-	return filtered, nil
-}
+	sort.Slice(matched, func(i, j int) bool {
+		if query.Descending {
+			return providerLess(query.SortBy, matched[j], matched[i])
+		}
+		return providerLess(query.SortBy, matched[i], matched[j])
+	})
 
-// passesFilters checks if a provider passes all the provided filters.
-func passesFilters(provider *models.Provider, filters map[string]interface{}) bool {
-	if filters == nil || len(filters) == 0 {
-		return true // No filters, pass everything
+	total := len(matched)
+	if query.Offset >= total {
+		return []*models.Provider{}, total, nil
+	}
+	end := total
+	if query.Limit > 0 && query.Offset+query.Limit < total {
+		end = query.Offset + query.Limit
 	}
+	return matched[query.Offset:end], total, nil
+}
 
-	// Check status filter
-	if statusFilter, ok := filters["status"].(string); ok && statusFilter != "" {
-		if string(provider.Status) != statusFilter {
-			return false
-		}
+// passesQuery checks if a provider passes all of the query's filters.
+func passesQuery(provider *models.Provider, query *models.ProviderQuery) bool {
+	if query.Status != "" && string(provider.Status) != query.Status {
+		return false
+	}
+	if query.OnlineOnly && provider.Status == models.StatusOffline {
+		return false
+	}
+	if query.HasCapacity && provider.Status != models.StatusIdle {
+		return false
 	}
 
 	// Check minimum VRAM
-	if minVRAM, ok := filters["min_vram"].(uint64); ok && minVRAM > 0 {
+	if query.MinVRAM > 0 {
 		hasGPUWithEnoughVRAM := false
 		for _, gpu := range provider.GPUs {
-			if gpu.VRAM >= minVRAM {
+			if gpu.VRAM >= query.MinVRAM {
 				hasGPUWithEnoughVRAM = true
 				break
 			}
@@ -108,10 +136,10 @@ func passesFilters(provider *models.Provider, filters map[string]interface{}) bo
 	}
 
 	// Check GPU model
-	if gpuModel, ok := filters["gpu_model"].(string); ok && gpuModel != "" {
+	if query.GPUModel != "" {
 		hasMatchingModel := false
 		for _, gpu := range provider.GPUs {
-			if strings.Contains(strings.ToLower(gpu.ModelName), strings.ToLower(gpuModel)) {
+			if strings.Contains(strings.ToLower(gpu.ModelName), strings.ToLower(query.GPUModel)) {
 				hasMatchingModel = true
 				break
 			}
@@ -122,10 +150,10 @@ func passesFilters(provider *models.Provider, filters map[string]interface{}) bo
 	}
 
 	// Check architecture
-	if arch, ok := filters["architecture"].(string); ok && arch != "" {
+	if query.Architecture != "" {
 		hasMatchingArch := false
 		for _, gpu := range provider.GPUs {
-			if strings.Contains(strings.ToLower(gpu.Architecture), strings.ToLower(arch)) {
+			if strings.Contains(strings.ToLower(gpu.Architecture), strings.ToLower(query.Architecture)) {
 				hasMatchingArch = true
 				break
 			}
@@ -135,8 +163,13 @@ func passesFilters(provider *models.Provider, filters map[string]interface{}) bo
 		}
 	}
 
+	// Check location
+	if query.Location != "" && !strings.Contains(strings.ToLower(provider.Location), strings.ToLower(query.Location)) {
+		return false
+	}
+
 	// Check for healthy GPUs only
-	if healthyOnly, ok := filters["healthy_only"].(bool); ok && healthyOnly {
+	if query.HealthyOnly {
 		for _, gpu := range provider.GPUs {
 			if !gpu.IsHealthy {
 				return false // At least one GPU is unhealthy
@@ -144,9 +177,58 @@ func passesFilters(provider *models.Provider, filters map[string]interface{}) bo
 		}
 	}
 
+	if query.MaxPricePerHour != nil {
+		price, ok := models.MetadataFloat(provider.Metadata, "min_price_per_hour")
+		if !ok || price > *query.MaxPricePerHour {
+			return false
+		}
+	}
+	if query.MinRating > 0 {
+		rating, _ := models.MetadataFloat(provider.Metadata, "rating")
+		if rating < query.MinRating {
+			return false
+		}
+	}
+
 	return true // Passed all filters
 }
 
+// providerLess orders providers by sortBy, then by name and ID, so pages are stable
+// between requests.
+func providerLess(sortBy string, a, b *models.Provider) bool {
+	switch sortBy {
+	case models.SortByPrice:
+		pa, _ := models.MetadataFloat(a.Metadata, "min_price_per_hour")
+		pb, _ := models.MetadataFloat(b.Metadata, "min_price_per_hour")
+		if pa != pb {
+			return pa < pb
+		}
+	case models.SortByRating:
+		ra, _ := models.MetadataFloat(a.Metadata, "rating")
+		rb, _ := models.MetadataFloat(b.Metadata, "rating")
+		if ra != rb {
+			return ra < rb
+		}
+	case models.SortByCapacity:
+		ca, cb := a.HealthyVRAM(), b.HealthyVRAM()
+		if ca != cb {
+			return ca < cb
+		}
+	case models.SortByLocation:
+		if a.Location != b.Location {
+			return a.Location < b.Location
+		}
+	case models.SortByLastSeen:
+		if !a.LastSeenAt.Equal(b.LastSeenAt) {
+			return a.LastSeenAt.Before(b.LastSeenAt)
+		}
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.ID.String() < b.ID.String()
+}
+
 // UpdateProvider updates an existing provider in the store.
 func (s *InMemoryProviderStore) UpdateProvider(ctx context.Context, id uuid.UUID, updatedProvider *models.Provider) error {
 	s.mu.Lock()
@@ -188,6 +270,22 @@ func (s *InMemoryProviderStore) UpdateProviderStatus(ctx context.Context, id uui
 	return nil
 }
 
+// MarkStaleProvidersOffline marks active providers last seen before cutoff offline and
+// returns their IDs. Their LastSeenAt is left alone.
+func (s *InMemoryProviderStore) MarkStaleProvidersOffline(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uuid.UUID
+	for id, provider := range s.providers {
+		if provider.Status.IsActive() && provider.LastSeenAt.Before(cutoff) {
+			provider.Status = models.StatusOffline
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 // UpdateProviderHeartbeat updates the LastSeenAt timestamp for a provider
 // and updates GPU metrics if provided.
 func (s *InMemoryProviderStore) UpdateProviderHeartbeat(ctx context.Context, id uuid.UUID, gpuMetrics []models.GPUDetail) error {
@@ -212,9 +310,31 @@ func (s *InMemoryProviderStore) UpdateProviderHeartbeat(ctx context.Context, id
 			provider.GPUs[i].Temperature = gpuMetrics[i].Temperature
 			provider.GPUs[i].PowerDraw = gpuMetrics[i].PowerDraw
 			provider.GPUs[i].IsHealthy = gpuMetrics[i].IsHealthy
+			if gpuMetrics[i].Benchmark != nil {
+				provider.GPUs[i].Benchmark = gpuMetrics[i].Benchmark
+			}
 		}
 	}
 
 	s.providers[id] = provider
 	return nil
 }
+
+// UseNonce records a request nonce until expiresAt and reports whether it was unused.
+// Nonces are only known to this instance.
+func (s *InMemoryProviderStore) UseNonce(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for nonce, expiry := range s.nonces {
+		if now.After(expiry) {
+			delete(s.nonces, nonce)
+		}
+	}
+	if _, ok := s.nonces[key]; ok {
+		return false, nil
+	}
+	s.nonces[key] = expiresAt
+	return true, nil
+}
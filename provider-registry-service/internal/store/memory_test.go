@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+)
+
+// addProviders stores providers named after their price and rating, some of them stale
+func addProviders(t *testing.T, s *InMemoryProviderStore) map[string]*models.Provider {
+	t.Helper()
+	byName := make(map[string]*models.Provider)
+	for _, p := range []struct {
+		name   string
+		price  interface{}
+		rating float64
+		vram   uint64
+		stale  bool
+	}{
+		{"alpha", 1.5, 4.5, 24576, false},
+		{"bravo", "0.80", 3.0, 81920, false},
+		{"charlie", nil, 5.0, 16384, false},
+		{"delta", 0.5, 4.0, 40960, true},
+	} {
+		metadata := map[string]interface{}{"rating": p.rating}
+		if p.price != nil {
+			metadata["min_price_per_hour"] = p.price
+		}
+		provider := models.NewProvider("owner-1", p.name, "", "", "eu-west", []models.GPUDetail{{ModelName: "GPU", VRAM: p.vram, IsHealthy: true}}, metadata)
+		if p.stale {
+			provider.LastSeenAt = time.Now().Add(-time.Hour)
+		}
+		if err := s.AddProvider(context.Background(), provider); err != nil {
+			t.Fatal(err)
+		}
+		byName[p.name] = provider
+	}
+	return byName
+}
+
+func names(providers []*models.Provider) []string {
+	var out []string
+	for _, p := range providers {
+		out = append(out, p.Name)
+	}
+	return out
+}
+
+func TestQueryProviders(t *testing.T) {
+	s := NewInMemoryProviderStore()
+	stored := addProviders(t, s)
+	staleBefore := time.Now().Add(-time.Minute)
+	price := 1.0
+
+	tests := []struct {
+		name      string
+		query     models.ProviderQuery
+		want      []string
+		wantTotal int
+	}{
+		{"all by name", models.ProviderQuery{}, []string{"alpha", "bravo", "charlie", "delta"}, 4},
+		{"online only", models.ProviderQuery{OnlineOnly: true, StaleBefore: staleBefore}, []string{"alpha", "bravo", "charlie"}, 3},
+		{"stale listed as offline", models.ProviderQuery{Status: "offline", StaleBefore: staleBefore}, []string{"delta"}, 1},
+		{"max price skips unpriced", models.ProviderQuery{MaxPricePerHour: &price}, []string{"bravo", "delta"}, 2},
+		{"min rating", models.ProviderQuery{MinRating: 4.5}, []string{"alpha", "charlie"}, 2},
+		{"by price", models.ProviderQuery{SortBy: models.SortByPrice}, []string{"charlie", "delta", "bravo", "alpha"}, 4},
+		{"by capacity descending", models.ProviderQuery{SortBy: models.SortByCapacity, Descending: true}, []string{"bravo", "delta", "alpha", "charlie"}, 4},
+		{"second page", models.ProviderQuery{SortBy: models.SortByRating, Limit: 2, Offset: 2}, []string{"alpha", "charlie"}, 4},
+		{"past the end", models.ProviderQuery{Limit: 2, Offset: 10}, nil, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total, err := s.QueryProviders(context.Background(), &tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("page = %v, want %v", got, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+		})
+	}
+
+	// Listing a stale provider as offline leaves its record to the reaper
+	if stored["delta"].Status != models.StatusIdle {
+		t.Errorf("stored status = %s, want idle", stored["delta"].Status)
+	}
+}
+
+func TestQueryProvidersStaleStatuses(t *testing.T) {
+	s := NewInMemoryProviderStore()
+	for _, status := range []models.ProviderStatus{models.StatusBusy, models.StatusMaintenance, models.StatusError} {
+		provider := models.NewProvider("owner-1", string(status), "", "", "", nil, nil)
+		provider.Status = status
+		provider.LastSeenAt = time.Now().Add(-time.Hour)
+		if err := s.AddProvider(context.Background(), provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the active provider counts as gone; the others keep their status
+	page, _, err := s.QueryProviders(context.Background(), &models.ProviderQuery{Status: "offline", StaleBefore: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(page); !reflect.DeepEqual(got, []string{"busy"}) {
+		t.Errorf("listed offline: %v, want only the busy provider", got)
+	}
+	page, _, err = s.QueryProviders(context.Background(), &models.ProviderQuery{Status: "maintenance", StaleBefore: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(page); !reflect.DeepEqual(got, []string{"maintenance"}) {
+		t.Errorf("listed in maintenance: %v, want the stale maintenance provider", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
@@ -22,6 +23,9 @@ type PostgresProviderStore struct {
 	db          *pgxpool.Pool
 	logger      *zap.Logger
 	retryConfig retryer.DatabaseRetryConfig
+
+	nonceMu        sync.Mutex
+	noncesPrunedAt time.Time
 }
 
 // NewPostgresProviderStore creates a new PostgresProviderStore.
@@ -77,10 +81,14 @@ func (pps *PostgresProviderStore) Initialize(ctx context.Context) error {
 		temperature_c SMALLINT,
 		power_draw_w INTEGER,
 		is_healthy BOOLEAN DEFAULT TRUE,
+		benchmark JSONB,
 		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 	);
 
+	-- Added after the initial schema
+	ALTER TABLE gpu_details ADD COLUMN IF NOT EXISTS benchmark JSONB;
+
 	-- Create indexes for GPU details table
 	CREATE INDEX IF NOT EXISTS idx_gpu_details_provider_id ON gpu_details(provider_id);
 	CREATE INDEX IF NOT EXISTS idx_gpu_details_model_name ON gpu_details(model_name);
@@ -89,6 +97,16 @@ func (pps *PostgresProviderStore) Initialize(ctx context.Context) error {
 	CREATE INDEX IF NOT EXISTS idx_gpu_details_is_healthy ON gpu_details(is_healthy);
 	`
 
+	// Nonces of signed provider requests, shared by all registry instances
+	sqlNonces := `
+	CREATE TABLE IF NOT EXISTS provider_request_nonces (
+		nonce TEXT PRIMARY KEY,
+		expires_at TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_provider_request_nonces_expires_at ON provider_request_nonces(expires_at);
+	`
+
 	// Execute the table creation queries with retry
 	return retryer.WithRetry(ctx, pps.logger, pps.retryConfig, "initialize database tables", func() error {
 		// Execute providers table creation
@@ -101,6 +119,10 @@ func (pps *PostgresProviderStore) Initialize(ctx context.Context) error {
 			return fmt.Errorf("failed to create gpu_details table: %w", err)
 		}
 
+		if _, err := pps.db.Exec(ctx, sqlNonces); err != nil {
+			return fmt.Errorf("failed to create provider_request_nonces table: %w", err)
+		}
+
 		pps.logger.Info("PostgreSQL tables initialized for provider store")
 		return nil
 	})
@@ -168,8 +190,8 @@ func (pps *PostgresProviderStore) AddProvider(ctx context.Context, provider *mod
 			architecture, compute_capability, cuda_cores, tensor_cores, 
 			memory_bandwidth_gb_s, power_consumption_w, 
 			utilization_gpu_percent, utilization_memory_percent, 
-			temperature_c, power_draw_w, is_healthy
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			temperature_c, power_draw_w, is_healthy, benchmark
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		`
 
 		for _, gpu := range provider.GPUs {
@@ -189,6 +211,7 @@ func (pps *PostgresProviderStore) AddProvider(ctx context.Context, provider *mod
 				gpu.Temperature,
 				gpu.PowerDraw,
 				gpu.IsHealthy,
+				benchmarkJSON(gpu.Benchmark),
 			)
 			if err != nil {
 				err = fmt.Errorf("failed to insert GPU detail: %w", err)
@@ -256,7 +279,7 @@ func (pps *PostgresProviderStore) GetProvider(ctx context.Context, id uuid.UUID)
 			architecture, compute_capability, cuda_cores, tensor_cores, 
 			memory_bandwidth_gb_s, power_consumption_w, 
 			utilization_gpu_percent, utilization_memory_percent, 
-			temperature_c, power_draw_w, is_healthy
+			temperature_c, power_draw_w, is_healthy, benchmark
 		FROM gpu_details 
 		WHERE provider_id = $1
 		`
@@ -277,6 +300,7 @@ func (pps *PostgresProviderStore) GetProvider(ctx context.Context, id uuid.UUID)
 			var utilizationGPU, utilizationMem, temperature sql.NullInt16
 			var powerDraw sql.NullInt64
 			var isHealthy sql.NullBool
+			var benchmark []byte
 
 			err := rows.Scan(
 				&gpu.ModelName,
@@ -293,6 +317,7 @@ func (pps *PostgresProviderStore) GetProvider(ctx context.Context, id uuid.UUID)
 				&temperature,
 				&powerDraw,
 				&isHealthy,
+				&benchmark,
 			)
 			if err != nil {
 				return fmt.Errorf("failed to scan GPU detail: %w", err)
@@ -334,6 +359,11 @@ func (pps *PostgresProviderStore) GetProvider(ctx context.Context, id uuid.UUID)
 			} else {
 				gpu.IsHealthy = true // Default to true if not set
 			}
+			if len(benchmark) > 0 {
+				if err := json.Unmarshal(benchmark, &gpu.Benchmark); err != nil {
+					return fmt.Errorf("failed to unmarshal GPU benchmark: %w", err)
+				}
+			}
 
 			provider.GPUs = append(provider.GPUs, gpu)
 		}
@@ -348,15 +378,113 @@ func (pps *PostgresProviderStore) GetProvider(ctx context.Context, id uuid.UUID)
 
 // ListProviders returns a list of all providers, with optional filtering.
 func (pps *PostgresProviderStore) ListProviders(ctx context.Context, filters map[string]interface{}) ([]*models.Provider, error) {
-	var providers []*models.Provider
+	providers, _, err := pps.QueryProviders(ctx, models.ProviderQueryFromFilters(filters))
+	return providers, err
+}
 
-	// Define a function for the database operation to be retried
-	operation := func() error {
-		// Query both provider information and GPU details with a single query
-		// Use LEFT JOIN to include providers without GPUs and JSON_AGG to aggregate GPU details
-		sqlQuery := `
-		SELECT p.id, p.owner_id, p.name, p.hostname, p.ip_address, p.status, p.location, 
-		       p.registered_at, p.last_seen_at, p.metadata,
+// numericMetadataPattern matches the metadata values MetadataFloat can read, so casting
+// them to a number can't fail.
+const numericMetadataPattern = `^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$`
+
+// metadataNumber returns SQL reading a numeric metadata value, NULL if it isn't set
+// or isn't a number.
+func metadataNumber(key string) string {
+	value := fmt.Sprintf("p.metadata->>'%s'", key)
+	return fmt.Sprintf("(CASE WHEN %s ~ '%s' THEN (%s)::float8 END)", value, numericMetadataPattern, value)
+}
+
+// providerQuerySQL is a listing query being built
+type providerQuerySQL struct {
+	where []string
+	args  []interface{}
+}
+
+// arg adds a query argument and returns its placeholder
+func (b *providerQuerySQL) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// buildProviderQuery returns the SQL selecting the query's page of providers with the
+// total number matched in each row, the SQL counting them on its own for when the page
+// is empty, and the arguments of both; the count takes only the first countArgs.
+func buildProviderQuery(query *models.ProviderQuery) (pageSQL, countSQL string, args []interface{}, countArgs int) {
+	b := &providerQuerySQL{}
+
+	status := "p.status"
+	if !query.StaleBefore.IsZero() {
+		status = fmt.Sprintf("(CASE WHEN p.status IN (%s) AND p.last_seen_at < %s THEN '%s' ELSE p.status END)",
+			activeStatusList, b.arg(query.StaleBefore), models.StatusOffline)
+	}
+	price := metadataNumber("min_price_per_hour")
+	rating := metadataNumber("rating")
+
+	if query.Status != "" {
+		b.where = append(b.where, fmt.Sprintf("%s = %s", status, b.arg(query.Status)))
+	}
+	if query.OnlineOnly {
+		b.where = append(b.where, fmt.Sprintf("%s <> '%s'", status, models.StatusOffline))
+	}
+	if query.HasCapacity {
+		b.where = append(b.where, fmt.Sprintf("%s = '%s'", status, models.StatusIdle))
+	}
+	if query.GPUModel != "" {
+		b.where = append(b.where, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND LOWER(gf.model_name) LIKE LOWER(%s))", b.arg("%"+query.GPUModel+"%")))
+	}
+	if query.MinVRAM > 0 {
+		b.where = append(b.where, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND gf.vram_mb >= %s)", b.arg(query.MinVRAM)))
+	}
+	if query.Architecture != "" {
+		b.where = append(b.where, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND LOWER(gf.architecture) LIKE LOWER(%s))", b.arg("%"+query.Architecture+"%")))
+	}
+	if query.Location != "" {
+		b.where = append(b.where, fmt.Sprintf("LOWER(p.location) LIKE LOWER(%s)", b.arg("%"+query.Location+"%")))
+	}
+	if query.HealthyOnly {
+		b.where = append(b.where, "NOT EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND gf.is_healthy = false)")
+	}
+	if query.MaxPricePerHour != nil {
+		b.where = append(b.where, fmt.Sprintf("%s <= %s", price, b.arg(*query.MaxPricePerHour)))
+	}
+	if query.MinRating > 0 {
+		b.where = append(b.where, fmt.Sprintf("COALESCE(%s, 0) >= %s", rating, b.arg(query.MinRating)))
+	}
+
+	from := "FROM providers p LEFT JOIN gpu_details g ON p.id = g.provider_id"
+	if len(b.where) > 0 {
+		from += " WHERE " + strings.Join(b.where, " AND ")
+	}
+	from += " GROUP BY p.id"
+	countSQL = "SELECT COUNT(*) FROM (SELECT p.id " + from + ") matched"
+	countArgs = len(b.args)
+
+	// Ties fall back to name, then ID, so pages are stable between requests. Names
+	// compare bytewise whatever the database's collation.
+	var order string
+	switch query.SortBy {
+	case models.SortByPrice:
+		order = fmt.Sprintf("COALESCE(%s, 0)", price)
+	case models.SortByRating:
+		order = fmt.Sprintf("COALESCE(%s, 0)", rating)
+	case models.SortByCapacity:
+		order = "COALESCE(SUM(g.vram_mb) FILTER (WHERE g.is_healthy), 0)"
+	case models.SortByLocation:
+		order = `COALESCE(p.location, '') COLLATE "C"`
+	case models.SortByLastSeen:
+		order = "p.last_seen_at"
+	}
+	direction := " ASC"
+	if query.Descending {
+		direction = " DESC"
+	}
+	orderBy := []string{`p.name COLLATE "C"` + direction, "p.id" + direction}
+	if order != "" {
+		orderBy = append([]string{order + direction}, orderBy...)
+	}
+
+	pageSQL = `
+		SELECT p.id, p.owner_id, p.name, COALESCE(p.hostname, ''), COALESCE(p.ip_address, ''), ` + status + `,
+		       COALESCE(p.location, ''), p.registered_at, p.last_seen_at, p.metadata,
 			COALESCE(
 				JSON_AGG(
 					JSON_BUILD_OBJECT(
@@ -373,105 +501,68 @@ func (pps *PostgresProviderStore) ListProviders(ctx context.Context, filters map
 						'utilization_memory_percent', g.utilization_memory_percent,
 						'temperature_c', g.temperature_c,
 						'power_draw_w', g.power_draw_w,
-						'is_healthy', g.is_healthy
+						'is_healthy', g.is_healthy,
+						'benchmark', g.benchmark
 					)
 				) FILTER (WHERE g.id IS NOT NULL),
 				'[]'::JSON
-			) AS gpus
-		FROM providers p
-		LEFT JOIN gpu_details g ON p.id = g.provider_id
-		`
-
-		// Base WHERE clause to be appended if filters exist
-		var whereConditions []string
-		var args []interface{}
-		argIndex := 1
-
-		// Apply filters
-		if filters != nil {
-			// Filter by status
-			if statusFilter, ok := filters["status"].(string); ok && statusFilter != "" {
-				whereConditions = append(whereConditions, fmt.Sprintf("p.status = $%d", argIndex))
-				args = append(args, statusFilter)
-				argIndex++
-			}
-
-			// Filter by GPU model
-			if gpuModel, ok := filters["gpu_model"].(string); ok && gpuModel != "" {
-				whereConditions = append(whereConditions, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND LOWER(gf.model_name) LIKE LOWER($%d))", argIndex))
-				args = append(args, "%"+gpuModel+"%")
-				argIndex++
-			}
-
-			// Filter by minimum VRAM
-			if minVRAM, ok := filters["min_vram"].(uint64); ok && minVRAM > 0 {
-				whereConditions = append(whereConditions, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND gf.vram_mb >= $%d)", argIndex))
-				args = append(args, minVRAM)
-				argIndex++
-			}
-
-			// Filter by architecture
-			if arch, ok := filters["architecture"].(string); ok && arch != "" {
-				whereConditions = append(whereConditions, fmt.Sprintf("EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND LOWER(gf.architecture) LIKE LOWER($%d))", argIndex))
-				args = append(args, "%"+arch+"%")
-				argIndex++
-			}
-
-			// Filter for only healthy GPUs
-			if healthyOnly, ok := filters["healthy_only"].(bool); ok && healthyOnly {
-				whereConditions = append(whereConditions, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM gpu_details gf WHERE gf.provider_id = p.id AND gf.is_healthy = false)"))
-			}
-		}
-
-		// Append WHERE clause if any filters were added
-		if len(whereConditions) > 0 {
-			sqlQuery += " WHERE " + strings.Join(whereConditions, " AND ")
-		}
+			) AS gpus,
+			COUNT(*) OVER () AS total
+		` + from + " ORDER BY " + strings.Join(orderBy, ", ")
+	if query.Limit > 0 {
+		pageSQL += " LIMIT " + b.arg(query.Limit)
+	}
+	if query.Offset > 0 {
+		pageSQL += " OFFSET " + b.arg(query.Offset)
+	}
+	return pageSQL, countSQL, b.args, countArgs
+}
 
-		// Add GROUP BY and ORDER BY
-		sqlQuery += " GROUP BY p.id ORDER BY p.name"
+// QueryProviders returns the page of providers the query selects and how many it
+// selects in all. Filtering, ordering and paging are done by the database.
+func (pps *PostgresProviderStore) QueryProviders(ctx context.Context, query *models.ProviderQuery) ([]*models.Provider, int, error) {
+	var (
+		providers []*models.Provider
+		total     int
+	)
+	pageSQL, countSQL, args, countArgs := buildProviderQuery(query)
 
-		// Execute the query
-		rows, err := pps.db.Query(ctx, sqlQuery, args...)
+	// Define a function for the database operation to be retried
+	operation := func() error {
+		rows, err := pps.db.Query(ctx, pageSQL, args...)
 		if err != nil {
 			return fmt.Errorf("failed to list providers: %w", err)
 		}
 		defer rows.Close()
 
 		tmpProviders := []*models.Provider{}
+		tmpTotal := 0
 		for rows.Next() {
 			var (
 				provider     = &models.Provider{}
 				metadataJSON []byte
 				gpusJSON     []byte
-				hostname     string
-				ipAddress    string
-				location     string
 			)
 
 			err := rows.Scan(
 				&provider.ID,
 				&provider.OwnerID,
 				&provider.Name,
-				&hostname,
+				&provider.Hostname,
 				&provider.IPAddress,
 				&provider.Status,
-				&location,
+				&provider.Location,
 				&provider.RegisteredAt,
 				&provider.LastSeenAt,
 				&metadataJSON,
 				&gpusJSON,
+				&tmpTotal,
 			)
 
 			if err != nil {
 				return fmt.Errorf("failed to scan provider row: %w", err)
 			}
 
-			// Set the scanned values
-			provider.Hostname = hostname
-			provider.IPAddress = ipAddress
-			provider.Location = location
-
 			// Unmarshal metadata if it exists
 			if len(metadataJSON) > 0 && !strings.EqualFold(string(metadataJSON), "null") {
 				var metadata map[string]interface{}
@@ -501,18 +592,26 @@ func (pps *PostgresProviderStore) ListProviders(ctx context.Context, filters map
 			return fmt.Errorf("error iterating provider rows: %w", err)
 		}
 
+		// A page past the end has no rows to carry the total
+		if len(tmpProviders) == 0 && query.Offset > 0 {
+			if err := pps.db.QueryRow(ctx, countSQL, args[:countArgs]...).Scan(&tmpTotal); err != nil {
+				return fmt.Errorf("failed to count providers: %w", err)
+			}
+		}
+
 		// Update output parameters only on success
 		providers = tmpProviders
+		total = tmpTotal
 		return nil
 	}
 
 	// Execute the operation with retry
 	err := WithRetry(ctx, pps.logger, "ListProviders", 3, 1*time.Second, operation)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return providers, nil
+	return providers, total, nil
 }
 
 // UpdateProvider updates an existing provider in the database.
@@ -576,8 +675,8 @@ func (pps *PostgresProviderStore) UpdateProvider(ctx context.Context, id uuid.UU
 		architecture, compute_capability, cuda_cores, tensor_cores,
 		memory_bandwidth_gb_s, power_consumption_w,
 		utilization_gpu_percent, utilization_memory_percent,
-		temperature_c, power_draw_w, is_healthy
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		temperature_c, power_draw_w, is_healthy, benchmark
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	for _, gpu := range updatedProvider.GPUs {
@@ -597,6 +696,7 @@ func (pps *PostgresProviderStore) UpdateProvider(ctx context.Context, id uuid.UU
 			gpu.Temperature,
 			gpu.PowerDraw,
 			gpu.IsHealthy,
+			benchmarkJSON(gpu.Benchmark),
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert updated GPU detail: %w", err)
@@ -628,6 +728,86 @@ func (pps *PostgresProviderStore) DeleteProvider(ctx context.Context, id uuid.UU
 	return nil
 }
 
+// activeStatusList is models.ActiveStatuses as an SQL list
+var activeStatusList = func() string {
+	quoted := make([]string, len(models.ActiveStatuses))
+	for i, status := range models.ActiveStatuses {
+		quoted[i] = "'" + string(status) + "'"
+	}
+	return strings.Join(quoted, ", ")
+}()
+
+// MarkStaleProvidersOffline marks active providers last seen before cutoff offline and
+// returns their IDs. Their last_seen_at is left alone.
+func (pps *PostgresProviderStore) MarkStaleProvidersOffline(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	sql := `
+	UPDATE providers
+	SET status = 'offline'
+	WHERE last_seen_at < $1 AND status IN (` + activeStatusList + `)
+	RETURNING id
+	`
+	rows, err := pps.db.Query(ctx, sql, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark stale providers offline: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan stale provider id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to mark stale providers offline: %w", err)
+	}
+	return ids, nil
+}
+
+// noncePruneInterval is how often expired nonces are deleted
+const noncePruneInterval = time.Minute
+
+// UseNonce records a request nonce until expiresAt and reports whether it was unused.
+// An expired nonce counts as unused.
+func (pps *PostgresProviderStore) UseNonce(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	now := time.Now().UTC()
+	pps.pruneNonces(ctx, now)
+
+	sql := `
+	INSERT INTO provider_request_nonces (nonce, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (nonce) DO UPDATE SET expires_at = EXCLUDED.expires_at
+	WHERE provider_request_nonces.expires_at < $3
+	RETURNING nonce
+	`
+	var stored string
+	err := pps.db.QueryRow(ctx, sql, key, expiresAt, now).Scan(&stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record nonce: %w", err)
+	}
+	return true, nil
+}
+
+// pruneNonces deletes expired nonces, at most every noncePruneInterval
+func (pps *PostgresProviderStore) pruneNonces(ctx context.Context, now time.Time) {
+	pps.nonceMu.Lock()
+	if now.Sub(pps.noncesPrunedAt) < noncePruneInterval {
+		pps.nonceMu.Unlock()
+		return
+	}
+	pps.noncesPrunedAt = now
+	pps.nonceMu.Unlock()
+
+	if _, err := pps.db.Exec(ctx, `DELETE FROM provider_request_nonces WHERE expires_at < $1`, now); err != nil {
+		pps.logger.Warn("Failed to prune expired nonces", zap.Error(err))
+	}
+}
+
 // UpdateProviderStatus updates the status of a specific provider.
 func (pps *PostgresProviderStore) UpdateProviderStatus(ctx context.Context, id uuid.UUID, status models.ProviderStatus) error {
 	now := time.Now().UTC()
@@ -703,13 +883,15 @@ func (pps *PostgresProviderStore) UpdateProviderHeartbeat(ctx context.Context, i
 					temperature_c = $3,
 					power_draw_w = $4,
 					is_healthy = $5,
+					benchmark = COALESCE($6::jsonb, benchmark),
 					updated_at = NOW()
-				WHERE id = $6`,
+				WHERE id = $7`,
 				gpu.UtilizationGPU,
 				gpu.UtilizationMem,
 				gpu.Temperature,
 				gpu.PowerDraw,
 				gpu.IsHealthy,
+				benchmarkJSON(gpu.Benchmark),
 				gpuID)
 
 			if err != nil {
@@ -727,6 +909,18 @@ func (pps *PostgresProviderStore) UpdateProviderHeartbeat(ctx context.Context, i
 	return nil
 }
 
+// benchmarkJSON encodes a GPU benchmark for the benchmark column, or nil (NULL) if there is none.
+func benchmarkJSON(benchmark *models.GPUBenchmark) []byte {
+	if benchmark == nil {
+		return nil
+	}
+	data, err := json.Marshal(benchmark)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
 // Close closes the database connection pool.
 func (pps *PostgresProviderStore) Close() error {
 	if pps.db != nil {
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
+)
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// maxPlaceholder returns the highest argument placeholder in query
+func maxPlaceholder(query string) int {
+	highest := 0
+	for _, m := range placeholder.FindAllStringSubmatch(query, -1) {
+		if n, _ := strconv.Atoi(m[1]); n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+func TestBuildProviderQuery(t *testing.T) {
+	price := 2.0
+	query := &models.ProviderQuery{
+		Status:          "idle",
+		GPUModel:        "4090",
+		MinVRAM:         24576,
+		MaxPricePerHour: &price,
+		MinRating:       4,
+		OnlineOnly:      true,
+		StaleBefore:     time.Now(),
+		SortBy:          models.SortByPrice,
+		Descending:      true,
+		Limit:           20,
+		Offset:          40,
+	}
+	pageSQL, countSQL, args, countArgs := buildProviderQuery(query)
+
+	// Every argument has a placeholder, and the count leaves out the paging ones
+	if got := maxPlaceholder(pageSQL); got != len(args) {
+		t.Errorf("page query uses %d placeholders for %d arguments", got, len(args))
+	}
+	if got := maxPlaceholder(countSQL); got != countArgs || countArgs != len(args)-2 {
+		t.Errorf("count query uses %d placeholders for %d arguments of %d", got, countArgs, len(args))
+	}
+	if args[len(args)-2] != 20 || args[len(args)-1] != 40 {
+		t.Errorf("paging arguments = %v, want limit 20 and offset 40", args[len(args)-2:])
+	}
+	for _, want := range []string{"LIMIT $", "OFFSET $", `ORDER BY COALESCE((CASE WHEN p.metadata->>'min_price_per_hour'`, `p.name COLLATE "C" DESC, p.id DESC`, "p.status IN ('idle', 'busy') AND p.last_seen_at < $"} {
+		if !strings.Contains(pageSQL, want) {
+			t.Errorf("page query lacks %q:\n%s", want, pageSQL)
+		}
+	}
+	if strings.Contains(countSQL, "LIMIT") || strings.Contains(countSQL, "ORDER BY") {
+		t.Errorf("count query pages or orders:\n%s", countSQL)
+	}
+}
+
+func TestNumericMetadataPattern(t *testing.T) {
+	pattern := regexp.MustCompile(numericMetadataPattern)
+	for value, want := range map[string]bool{
+		"1.5": true, " 0.80 ": true, "2": true, ".5": true, "1e-05": true, "-3": true,
+		"": false, "cheap": false, "1.5/h": false, "1..5": false,
+	} {
+		if got := pattern.MatchString(value); got != want {
+			t.Errorf("%q matches: %v, want %v", value, got, want)
+		}
+		if _, ok := models.MetadataFloat(map[string]interface{}{"v": value}, "v"); want && !ok {
+			t.Errorf("%q matches but MetadataFloat can't read it", value)
+		}
+	}
+}
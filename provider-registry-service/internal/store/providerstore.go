@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/dante-gpu/dante-backend/provider-registry-service/internal/models"
 	"github.com/google/uuid"
@@ -23,6 +24,10 @@ type ProviderStore interface {
 	// TODO: Add filtering parameters
 	ListProviders(ctx context.Context, filters map[string]interface{}) ([]*models.Provider, error)
 
+	// QueryProviders returns the page of providers the query selects, and how many it
+	// selects in all
+	QueryProviders(ctx context.Context, query *models.ProviderQuery) ([]*models.Provider, int, error)
+
 	// UpdateProvider updates an existing provider
 	UpdateProvider(ctx context.Context, id uuid.UUID, updatedProvider *models.Provider) error
 
@@ -36,6 +41,10 @@ type ProviderStore interface {
 	// and updates GPU utilization metrics if provided
 	UpdateProviderHeartbeat(ctx context.Context, id uuid.UUID, gpuMetrics []models.GPUDetail) error
 
+	// UseNonce records a signed request's nonce until expiresAt and reports whether
+	// it was unused
+	UseNonce(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+
 	// Close cleans up any resources used by the store
 	Close() error
 }
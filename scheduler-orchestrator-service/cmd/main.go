@@ -14,6 +14,7 @@ import (
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/config"
 	consul_client "github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/consul"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/metrics"
 	nats_client "github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/nats"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/scheduler"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/server"
@@ -27,6 +28,9 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// healthCheckRegistryTimeout bounds the provider registry ping so a slow registry can't stall health checks.
+const healthCheckRegistryTimeout = time.Second
+
 func main() {
 	// --- Configuration ---
 	cfg, err := config.LoadConfig("configs/config.yaml")
@@ -134,6 +138,7 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(metrics.Middleware)
 	r.Use(NewStructuredLogger(logger)) // Zap logging middleware
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(cfg.RequestTimeout))
@@ -163,21 +168,39 @@ func main() {
 			healthMsg += " NATS: OK."
 		}
 
-		// Check if JobConsumer is running (basic check)
+		// Check that the JobConsumer is running and subscribed to its subjects
 		if jobConsumer == nil {
 			healthStatus = http.StatusServiceUnavailable
 			healthMsg += " JobConsumer: Not Running."
 			logger.Warn("Health check: JobConsumer is not running")
+		} else if !jobConsumer.Healthy() {
+			healthStatus = http.StatusServiceUnavailable
+			healthMsg += " JobConsumer: Resubscribing."
+			logger.Warn("Health check: JobConsumer is not subscribed to its subjects")
 		} else {
 			healthMsg += " JobConsumer: Running."
 		}
 
+		// Check the Provider Registry, which job placement depends on
+		registryPingCtx, registryPingCancel := context.WithTimeout(r.Context(), healthCheckRegistryTimeout)
+		defer registryPingCancel()
+		if err := prClient.Ping(registryPingCtx); err != nil {
+			healthStatus = http.StatusServiceUnavailable
+			healthMsg += " ProviderRegistry: Unreachable."
+			logger.Warn("Health check: Provider registry ping failed", zap.Error(err))
+		} else {
+			healthMsg += " ProviderRegistry: OK."
+		}
+
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(healthStatus)
 		fmt.Fprintln(w, healthMsg)
 		logger.Debug("Health check endpoint hit", zap.Int("status", healthStatus), zap.String("message", healthMsg))
 	})
 
+	// Prometheus scrape endpoint
+	r.Handle("/metrics", metrics.Handler())
+
 	srv := server.NewServer(cfg, r, logger)
 
 	// --- Start Server Goroutine ---
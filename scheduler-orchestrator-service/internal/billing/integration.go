@@ -47,6 +47,7 @@ type SessionStartRequest struct {
 	EstimatedPowerW  uint32          `json:"estimated_power_w"`
 	MaxHourlyRate    *decimal.Decimal `json:"max_hourly_rate,omitempty"`
 	MaxDurationHours *int            `json:"max_duration_hours,omitempty"`
+	ReservedAmount   decimal.Decimal `json:"reserved_amount,omitempty"` // Reserved at submission; released by the session
 }
 
 // SessionEndRequest represents a request to end a rental session
@@ -109,6 +110,10 @@ func (c *Client) StartSession(ctx context.Context, req *SessionStartRequest) (*S
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	if req.JobID != nil {
+		// Same key the provider daemon uses, so a job never opens two sessions
+		httpReq.Header.Set("Idempotency-Key", "session-start:"+*req.JobID)
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -257,3 +262,41 @@ func (c *Client) EstimateJobCost(ctx context.Context, gpuModel string, vramMB ui
 
 	return totalCost, nil
 }
+
+// ReleaseFunds releases funds reserved for a job that won't run
+func (c *Client) ReleaseFunds(ctx context.Context, userID string, amount decimal.Decimal, reference string) error {
+	c.logger.Info("Releasing reserved funds",
+		zap.String("user_id", userID),
+		zap.String("amount", amount.String()),
+		zap.String("reference", reference),
+	)
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"user_id":   userID,
+		"amount":    amount,
+		"reference": reference,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal funds release request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/billing/release-funds", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to release funds: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("billing service returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
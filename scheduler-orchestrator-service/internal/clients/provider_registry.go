@@ -1,10 +1,12 @@
 package clients
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,6 +36,21 @@ type GPUDetail struct {
 	ModelName     string `json:"model_name"`
 	VRAM          uint64 `json:"vram_mb"` // VRAM in Megabytes
 	DriverVersion string `json:"driver_version"`
+	// GPU architecture (e.g. "Hopper") and CUDA compute capability (e.g. "9.0")
+	Architecture      string `json:"architecture,omitempty"`
+	ComputeCapability string `json:"compute_capability,omitempty"`
+	// Live metrics reported through provider heartbeats
+	UtilizationGPU uint8 `json:"utilization_gpu_percent,omitempty"` // 0-100%
+	IsHealthy      bool  `json:"is_healthy"`
+	// Latest self-benchmark reported by the provider, if any
+	Benchmark *GPUBenchmark `json:"benchmark,omitempty"`
+}
+
+// GPUBenchmark holds measured GPU performance from the provider's self-benchmark.
+type GPUBenchmark struct {
+	FP16TFLOPS         float64 `json:"fp16_tflops"`
+	MemoryBandwidthGBs float64 `json:"memory_bandwidth_gb_s"`
+	StabilityScore     float64 `json:"stability_score"`
 }
 
 // Provider represents a registered GPU provider as returned by the provider-registry-service.
@@ -76,9 +93,14 @@ func NewClient(cfg *config.Config, consulClient *consulapi.Client, logger *zap.L
 	}
 }
 
-// getServiceAddress discovers the Provider Registry service using Consul and returns a base URL.
+// getServiceAddress returns the Provider Registry's base URL: the configured one if set,
+// otherwise an instance discovered through Consul.
 // It implements a simple cache for the last known address to reduce Consul lookups.
 func (c *Client) getServiceAddress() (string, error) {
+	if c.cfg.ProviderRegistryURL != "" {
+		return strings.TrimSuffix(c.cfg.ProviderRegistryURL, "/"), nil
+	}
+
 	c.mu.RLock()
 	if c.lastKnownAddress != "" {
 		c.mu.RUnlock()
@@ -162,6 +184,33 @@ func (c *Client) ListAvailableProviders() ([]Provider, error) {
 	return providers, nil
 }
 
+// Ping checks that the Provider Registry service is reachable by requesting a single provider.
+func (c *Client) Ping(ctx context.Context) error {
+	baseURL, err := c.getServiceAddress()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/providers?limit=1", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.invalidateCachedAddress()
+		return fmt.Errorf("provider registry unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.invalidateCachedAddress()
+		return fmt.Errorf("provider registry service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // invalidateCachedAddress clears the last known address, forcing a new Consul lookup on next call.
 func (c *Client) invalidateCachedAddress() {
 	c.mu.Lock()
@@ -36,19 +36,57 @@ type Config struct {
 	NatsJobQueueGroup                string `yaml:"nats_job_queue_group"`
 	NatsTaskDispatchSubjectPrefix    string `yaml:"nats_task_dispatch_subject_prefix"`
 	NatsJobStatusUpdateSubjectPrefix string `yaml:"nats_job_status_update_subject_prefix"`
+	NatsJobDryRunSubject             string `yaml:"nats_job_dry_run_subject"`
+	NatsJobQueueStatusSubject        string `yaml:"nats_job_queue_status_subject"`
+	NatsUserActiveJobsSubject        string `yaml:"nats_user_active_jobs_subject"`
+	// Prefix of the subjects the provider daemon publishes task status updates on,
+	// besides NatsJobStatusUpdateSubjectPrefix
+	NatsTaskStatusSubjectPrefix string `yaml:"nats_task_status_subject_prefix"`
+	// Prefix of the subjects the API gateway publishes job cancellations on
+	NatsTaskCancelSubjectPrefix string `yaml:"nats_task_cancel_subject_prefix"`
+
+	// JetStream job queue configuration
+	NatsJobStreamName     string        `yaml:"nats_job_stream_name"`
+	NatsJobStreamMaxAge   time.Duration `yaml:"nats_job_stream_max_age"`
+	NatsJobStreamReplicas int           `yaml:"nats_job_stream_replicas"`
+	NatsJobAckWait        time.Duration `yaml:"nats_job_ack_wait"`
+	NatsJobMaxDeliver     int           `yaml:"nats_job_max_deliver"`
+
+	// Backoff between attempts to restore the job subscriptions after a lost connection
+	NatsResubscribeBackoff    time.Duration `yaml:"nats_resubscribe_backoff"`
+	NatsResubscribeMaxBackoff time.Duration `yaml:"nats_resubscribe_max_backoff"`
 
 	// Provider Registry Service Configuration
 	ProviderRegistryServiceName string `yaml:"provider_registry_service_name"`
-	// ProviderRegistryURL string `yaml:"provider_registry_url,omitempty"` // Alternative if not using Consul discovery
+	ProviderRegistryURL         string `yaml:"provider_registry_url,omitempty"` // Used instead of Consul discovery when set
 
 	// Scheduling Algorithm Configuration
-	SchedulingStrategy string `yaml:"scheduling_strategy"`
-	JobDefaultPriority int    `yaml:"job_default_priority"`
+	SchedulingStrategy string            `yaml:"scheduling_strategy"` // "weighted-score" or "first-fit"
+	JobDefaultPriority int               `yaml:"job_default_priority"`
+	SchedulingWeights  SchedulingWeights `yaml:"scheduling_weights"`
+	// MaxPricePerHour is the hourly price (in dGPU) that scores zero on the price component.
+	MaxPricePerHour float64 `yaml:"max_price_per_hour"`
+	// QueueDefaultRunTime is assumed per job for queue ETAs until some jobs have completed.
+	QueueDefaultRunTime time.Duration `yaml:"queue_default_run_time"`
+	// MaxQueueWaitMinutes is how long a job waits for a provider before it fails.
+	MaxQueueWaitMinutes int `yaml:"max_queue_wait_minutes"`
+	// NoProviderRetryInterval is how often placement is retried while no provider is available.
+	NoProviderRetryInterval time.Duration `yaml:"no_provider_retry_interval"`
 
 	// Resource Query Configuration
 	ProviderQueryTimeout time.Duration `yaml:"provider_query_timeout"`
 }
 
+// SchedulingWeights controls how much each factor contributes to a provider's
+// placement score under the "weighted-score" strategy. Weights are relative to each other.
+type SchedulingWeights struct {
+	Price       float64 `yaml:"price"`
+	Location    float64 `yaml:"location"`
+	SuccessRate float64 `yaml:"success_rate"`
+	Capacity    float64 `yaml:"capacity"`
+	Performance float64 `yaml:"performance"`
+}
+
 // LoadConfig reads configuration from the given YAML file path.
 // It creates a default config file if it doesn't exist.
 func LoadConfig(path string) (*Config, error) {
@@ -72,11 +110,37 @@ func LoadConfig(path string) (*Config, error) {
 		NatsJobQueueGroup:                "scheduler-group",
 		NatsTaskDispatchSubjectPrefix:    "tasks.dispatch",
 		NatsJobStatusUpdateSubjectPrefix: "jobs.status",
+		NatsJobDryRunSubject:             "jobs.dryrun",
+		NatsJobQueueStatusSubject:        "jobs.queue.status",
+		NatsUserActiveJobsSubject:        "jobs.user.active",
+		NatsTaskStatusSubjectPrefix:      "task.status",
+		NatsTaskCancelSubjectPrefix:      "task.cancel",
+
+		NatsJobStreamName:     "DANTE_JOBS",
+		NatsJobStreamMaxAge:   72 * time.Hour,
+		NatsJobStreamReplicas: 1,
+		NatsJobAckWait:        60 * time.Second,
+		NatsJobMaxDeliver:     20,
+
+		NatsResubscribeBackoff:    time.Second,
+		NatsResubscribeMaxBackoff: time.Minute,
 
 		ProviderRegistryServiceName: "provider-registry",
 
-		SchedulingStrategy: "round-robin",
+		SchedulingStrategy: "weighted-score",
 		JobDefaultPriority: 5,
+		SchedulingWeights: SchedulingWeights{
+			Price:       0.30,
+			Location:    0.15,
+			SuccessRate: 0.25,
+			Capacity:    0.15,
+			Performance: 0.15,
+		},
+		MaxPricePerHour:     10.0,
+		QueueDefaultRunTime: 30 * time.Minute,
+		MaxQueueWaitMinutes: 60,
+
+		NoProviderRetryInterval: time.Minute,
 
 		ProviderQueryTimeout: 5 * time.Second,
 	}
@@ -162,12 +226,63 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	if cfg.NatsJobStatusUpdateSubjectPrefix == "" {
 		cfg.NatsJobStatusUpdateSubjectPrefix = defaults.NatsJobStatusUpdateSubjectPrefix
 	}
+	if cfg.NatsJobDryRunSubject == "" {
+		cfg.NatsJobDryRunSubject = defaults.NatsJobDryRunSubject
+	}
+	if cfg.NatsJobQueueStatusSubject == "" {
+		cfg.NatsJobQueueStatusSubject = defaults.NatsJobQueueStatusSubject
+	}
+	if cfg.NatsUserActiveJobsSubject == "" {
+		cfg.NatsUserActiveJobsSubject = defaults.NatsUserActiveJobsSubject
+	}
+	if cfg.NatsTaskStatusSubjectPrefix == "" {
+		cfg.NatsTaskStatusSubjectPrefix = defaults.NatsTaskStatusSubjectPrefix
+	}
+	if cfg.NatsTaskCancelSubjectPrefix == "" {
+		cfg.NatsTaskCancelSubjectPrefix = defaults.NatsTaskCancelSubjectPrefix
+	}
+	if cfg.NatsJobStreamName == "" {
+		cfg.NatsJobStreamName = defaults.NatsJobStreamName
+	}
+	if cfg.NatsJobStreamMaxAge == 0 {
+		cfg.NatsJobStreamMaxAge = defaults.NatsJobStreamMaxAge
+	}
+	if cfg.NatsJobStreamReplicas == 0 {
+		cfg.NatsJobStreamReplicas = defaults.NatsJobStreamReplicas
+	}
+	if cfg.NatsJobAckWait == 0 {
+		cfg.NatsJobAckWait = defaults.NatsJobAckWait
+	}
+	if cfg.NatsJobMaxDeliver == 0 {
+		cfg.NatsJobMaxDeliver = defaults.NatsJobMaxDeliver
+	}
+	if cfg.NatsResubscribeBackoff == 0 {
+		cfg.NatsResubscribeBackoff = defaults.NatsResubscribeBackoff
+	}
+	if cfg.NatsResubscribeMaxBackoff == 0 {
+		cfg.NatsResubscribeMaxBackoff = defaults.NatsResubscribeMaxBackoff
+	}
 	if cfg.ProviderRegistryServiceName == "" {
 		cfg.ProviderRegistryServiceName = defaults.ProviderRegistryServiceName
 	}
 	if cfg.SchedulingStrategy == "" {
 		cfg.SchedulingStrategy = defaults.SchedulingStrategy
 	}
+	if cfg.SchedulingWeights == (SchedulingWeights{}) {
+		cfg.SchedulingWeights = defaults.SchedulingWeights
+	}
+	if cfg.MaxPricePerHour == 0 {
+		cfg.MaxPricePerHour = defaults.MaxPricePerHour
+	}
+	if cfg.QueueDefaultRunTime == 0 {
+		cfg.QueueDefaultRunTime = defaults.QueueDefaultRunTime
+	}
+	if cfg.MaxQueueWaitMinutes == 0 {
+		cfg.MaxQueueWaitMinutes = defaults.MaxQueueWaitMinutes
+	}
+	if cfg.NoProviderRetryInterval == 0 {
+		cfg.NoProviderRetryInterval = defaults.NoProviderRetryInterval
+	}
 	if cfg.JobDefaultPriority == 0 { // Assuming 0 is not a valid priority, so it acts as unset
 		cfg.JobDefaultPriority = defaults.JobDefaultPriority
 	}
@@ -0,0 +1,93 @@
+// Package metrics holds the scheduler's Prometheus collectors and the /metrics handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "dante"
+	subsystem = "scheduler"
+)
+
+var (
+	// RequestDuration observes request latency by method, route pattern and status code
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// JobsReceived counts new jobs consumed from NATS, not counting redeliveries
+	JobsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "jobs_received_total",
+		Help:      "New jobs received for scheduling.",
+	})
+
+	// SchedulingAttempts counts scheduling attempts by result: "dispatched",
+	// "no_provider" or "error"
+	SchedulingAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "scheduling_attempts_total",
+		Help:      "Job scheduling attempts by result.",
+	}, []string{"result"})
+
+	// SchedulingDuration observes how long placing and dispatching a job takes
+	SchedulingDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "scheduling_duration_seconds",
+		Help:      "Time taken by a job scheduling attempt.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+var registerOnce sync.Once
+
+// Register adds the scheduler's collectors to the default registry, which already holds
+// the Go runtime and process collectors. Only the first call registers anything, so
+// tests can call it repeatedly without panicking on duplicate registration.
+func Register() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(RequestDuration, JobsReceived, SchedulingAttempts, SchedulingDuration)
+	})
+}
+
+// Handler serves the default registry in the Prometheus exposition format
+func Handler() http.Handler {
+	Register()
+	return promhttp.Handler()
+}
+
+// Middleware records RequestDuration for every request. Requests are labeled with the
+// matched chi route pattern rather than the path, so IDs in URLs don't become labels.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+		RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
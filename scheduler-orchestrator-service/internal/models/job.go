@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 // Job represents a compute job submitted to the platform.
@@ -19,8 +21,22 @@ type Job struct {
 	// Resource Requirements
 	GPUType  string `json:"gpu_type,omitempty"`  // Specific GPU model or class required (e.g., "nvidia-a100", "any-rtx")
 	GPUCount int    `json:"gpu_count,omitempty"` // Number of GPUs required
+	// GPU architecture the job was built for, by name ("Hopper") or CUDA target ("sm_90")
+	GPUArchitecture string `json:"gpu_architecture,omitempty"`
+	// Minimum CUDA compute capability, e.g. 8.0
+	MinComputeCapability float64 `json:"min_compute_capability,omitempty"`
+	// Maximum run time, used for cost estimates
+	MaxDurationMinutes int `json:"max_duration_minutes,omitempty"`
+	// Funds reserved for the job at submission (batch submissions); the billing session
+	// releases them as it locks its own
+	ReservedFunds decimal.Decimal `json:"reserved_funds,omitempty"`
 	// Other requirements like min_vram_mb, cpu_cores, memory_gb could be added
 
+	// Placement preferences
+	PreferredProviders []string `json:"preferred_providers,omitempty"` // If set, only these provider IDs are considered
+	ExcludedProviders  []string `json:"excluded_providers,omitempty"`  // Provider IDs that must never be used
+	PreferredLocation  string   `json:"preferred_location,omitempty"`  // e.g., "us-east-1" or "us"
+
 	Params map[string]interface{} `json:"params"` // Job-specific parameters (e.g., script path, dataset URI, hyperparameters)
 	Tags   []string               `json:"tags,omitempty"`
 }
@@ -38,8 +54,27 @@ const (
 	JobStateCompleted  SchedulerJobState = "completed"  // Job finished successfully
 	JobStateFailed     SchedulerJobState = "failed"     // Job failed
 	JobStateCancelled  SchedulerJobState = "cancelled"  // Job was cancelled
+
+	// No provider can take the job yet; placement is retried until the queue wait runs out
+	JobStateNoProviderAvailable SchedulerJobState = "no_provider_available"
 )
 
+// ProviderJobStats holds the outcome counts of jobs a provider has finished.
+type ProviderJobStats struct {
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// SuccessRate returns the fraction of finished jobs that completed successfully.
+// ok is false when the provider has no finished jobs yet.
+func (s ProviderJobStats) SuccessRate() (rate float64, ok bool) {
+	total := s.Completed + s.Failed
+	if total == 0 {
+		return 0, false
+	}
+	return float64(s.Completed) / float64(total), true
+}
+
 // InternalJobRepresentation holds the job details along with its current state and assignment info.
 type InternalJobRepresentation struct {
 	JobDetails Job               `json:"job_details"`
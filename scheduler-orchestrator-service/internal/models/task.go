@@ -15,6 +15,8 @@ type Task struct {
 	JobParams      map[string]interface{} `json:"job_params"` // Job-specific parameters (script, dataset, hyperparameters)
 	GPUTypeNeeded  string                 `json:"gpu_type_needed,omitempty"`
 	GPUCountNeeded int                    `json:"gpu_count_needed,omitempty"`
+	// Requirements the provider daemon checks again when it picks a local GPU
+	Requirements *TaskRequirements `json:"requirements,omitempty"`
 
 	// Information about the assigned provider (optional, but useful for the daemon)
 	AssignedProviderID string `json:"assigned_provider_id,omitempty"`
@@ -30,8 +32,24 @@ type Task struct {
 	// - Docker image to use
 }
 
+// TaskRequirements holds the GPU requirements passed on to the provider daemon.
+// The JSON names match the daemon's resource requirements.
+type TaskRequirements struct {
+	Architecture         string  `json:"architecture,omitempty"`
+	MinComputeCapability float64 `json:"gpu_compute_units,omitempty"`
+	GPUCount             int     `json:"gpu_count,omitempty"` // GPUs reserved for the job on the provider
+}
+
 // NewTask creates a new Task from a Job and an assigned provider ID.
 func NewTask(job *Job, assignedProviderID string) *Task {
+	var requirements *TaskRequirements
+	if job.GPUArchitecture != "" || job.MinComputeCapability > 0 || job.GPUCount > 1 {
+		requirements = &TaskRequirements{
+			Architecture:         job.GPUArchitecture,
+			MinComputeCapability: job.MinComputeCapability,
+			GPUCount:             job.GPUCount,
+		}
+	}
 	return &Task{
 		JobID:              job.ID,
 		UserID:             job.UserID,
@@ -40,6 +58,7 @@ func NewTask(job *Job, assignedProviderID string) *Task {
 		JobParams:          job.Params,
 		GPUTypeNeeded:      job.GPUType,
 		GPUCountNeeded:     job.GPUCount,
+		Requirements:       requirements,
 		AssignedProviderID: assignedProviderID,
 		DispatchedAt:       time.Now().UTC(),
 	}
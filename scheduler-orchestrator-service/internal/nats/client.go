@@ -16,7 +16,7 @@ func Connect(natsAddress string, logger *zap.Logger) (*nats.Conn, error) {
 	nc, err := nats.Connect(
 		natsAddress,
 		nats.RetryOnFailedConnect(true),
-		nats.MaxReconnects(50),            // More aggressive reconnect attempts
+		nats.MaxReconnects(-1),            // Never give up; the JobConsumer resubscribes once the connection is back
 		nats.ReconnectWait(time.Second*5), // Longer wait between reconnects
 		nats.Timeout(10*time.Second),      // Connection timeout
 		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
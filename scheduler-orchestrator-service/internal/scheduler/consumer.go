@@ -3,16 +3,22 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/billing"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/config"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/metrics"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/store"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 )
 
@@ -27,7 +33,19 @@ type JobConsumer struct {
 	jobStore      store.JobStore                               // Added JobStore dependency
 	activeJobs    map[string]*models.InternalJobRepresentation // Map to track jobs being processed
 	subscription  *nats.Subscription
-	shutdownChan  chan struct{} // Channel to signal shutdown
+	dryRunSub     *nats.Subscription // Request-reply subscription for dry-run submissions
+	queueSub      *nats.Subscription // Request-reply subscription for job queue status
+	subMu         sync.Mutex         // Guards the subscriptions, which are replaced after a lost connection
+	resubMu       sync.Mutex         // Serialises resubscription attempts
+	healthy       atomic.Bool        // Whether all subscriptions are in place
+	shutdownChan  chan struct{}      // Channel to signal shutdown
+
+	// Also guarded by subMu
+	userJobsSub *nats.Subscription   // Request-reply subscription for a user's active job count
+	statusSubs  []*nats.Subscription // Task status updates from providers, one per subject prefix
+	cancelSub   *nats.Subscription   // Job cancellations from the API gateway
+
+	publish func(subject string, data []byte) error // Core NATS publish; replaceable for tests
 }
 
 // NewJobConsumer creates a new JobConsumer.
@@ -47,7 +65,7 @@ func NewJobConsumer(nc *nats.Conn, cfg *config.Config, prClient *clients.Client,
 		logger.Info("JetStream context obtained for JobConsumer")
 	}
 
-	return &JobConsumer{
+	jc := &JobConsumer{
 		nc:            nc,
 		js:            jetStream, // Use renamed variable
 		logger:        logger,
@@ -57,7 +75,11 @@ func NewJobConsumer(nc *nats.Conn, cfg *config.Config, prClient *clients.Client,
 		jobStore:      js, // Assign jobStore
 		activeJobs:    make(map[string]*models.InternalJobRepresentation),
 		shutdownChan:  make(chan struct{}),
-	}, nil
+	}
+	if nc != nil {
+		jc.publish = nc.Publish
+	}
+	return jc, nil
 }
 
 // StartConsuming subscribes to the NATS subject for job submissions and starts processing messages.
@@ -73,39 +95,194 @@ func (jc *JobConsumer) StartConsuming() error {
 		zap.String("queue_group", jc.cfg.NatsJobQueueGroup),
 	)
 
-	// For JetStream, we will create a durable pull consumer.
-	// The stream (e.g., DANTE_JOBS) is assumed to exist and be configured
-	// to capture messages published to jc.cfg.NatsJobSubmissionSubject.
-	durableName := jc.cfg.NatsJobQueueGroup + "_consumer" // Make durable name unique per queue group
+	if err := jc.subscribe(); err != nil {
+		return err
+	}
+	jc.healthy.Store(true)
 
-	var err error
-	jc.subscription, err = jc.js.PullSubscribe(
-		jc.cfg.NatsJobSubmissionSubject, // Subject to subscribe to within the stream
-		durableName,                     // Durable name for the consumer
-		nats.AckWait(60*time.Second),    // Increased AckWait for processing time
-		// nats.MaxDeliver(jc.cfg.NatsMaxRedelivery), // Configurable max redeliveries
-	)
+	// The connection is watched so the subscriptions can be restored once it is back
+	go jc.watchConnection()
 
-	if err != nil {
-		jc.logger.Error("Failed to create JetStream pull subscription",
+	// Start a goroutine to fetch messages
+	go jc.fetchLoop()
+
+	return nil
+}
+
+// subscribe creates whichever of the consumer's subscriptions are missing or no longer
+// valid, so it is used both on start and to restore them after a lost connection.
+func (jc *JobConsumer) subscribe() error {
+	jc.subMu.Lock()
+	defer jc.subMu.Unlock()
+
+	select {
+	case <-jc.shutdownChan:
+		return errors.New("job consumer is stopped")
+	default:
+	}
+
+	if !subscriptionValid(jc.subscription) {
+		// Jobs are captured by a JetStream stream so that submissions made while the
+		// scheduler is down are kept until a scheduler instance ACKs them.
+		if err := jc.ensureJobStream(); err != nil {
+			return err
+		}
+
+		// For JetStream, we will create a durable pull consumer. Unacked messages are
+		// redelivered after AckWait, including after a scheduler restart.
+		durableName := jc.durableName()
+
+		sub, err := jc.js.PullSubscribe(
+			jc.cfg.NatsJobSubmissionSubject, // Subject to subscribe to within the stream
+			durableName,                     // Durable name for the consumer
+			nats.BindStream(jc.cfg.NatsJobStreamName),
+			nats.ManualAck(),
+			nats.AckExplicit(),
+			nats.DeliverAll(),
+			nats.AckWait(jc.cfg.NatsJobAckWait),
+			nats.MaxDeliver(jc.cfg.NatsJobMaxDeliver),
+		)
+		if err != nil {
+			jc.logger.Error("Failed to create JetStream pull subscription",
+				zap.String("subject", jc.cfg.NatsJobSubmissionSubject),
+				zap.String("durable_name", durableName),
+				zap.Error(err),
+			)
+			return fmt.Errorf("failed to create pull subscription: %w", err)
+		}
+		jc.subscription = sub
+
+		jc.logger.Info("Successfully subscribed to JetStream for jobs",
 			zap.String("subject", jc.cfg.NatsJobSubmissionSubject),
-			zap.String("durable_name", durableName),
-			zap.Error(err),
+			zap.String("durable_consumer", durableName),
 		)
-		return fmt.Errorf("failed to create pull subscription: %w", err)
 	}
 
-	jc.logger.Info("Successfully subscribed to JetStream for jobs",
-		zap.String("subject", jc.cfg.NatsJobSubmissionSubject),
-		zap.String("durable_consumer", durableName),
-	)
+	// Dry runs are answered directly rather than queued, since nothing is dispatched
+	if !subscriptionValid(jc.dryRunSub) {
+		sub, err := jc.nc.QueueSubscribe(jc.cfg.NatsJobDryRunSubject, jc.cfg.NatsJobQueueGroup, jc.handleDryRun)
+		if err != nil {
+			jc.logger.Error("Failed to subscribe to dry-run job requests", zap.String("subject", jc.cfg.NatsJobDryRunSubject), zap.Error(err))
+			return fmt.Errorf("failed to subscribe to dry-run requests: %w", err)
+		}
+		jc.dryRunSub = sub
+	}
 
-	// Start a goroutine to fetch messages
-	go jc.fetchLoop()
+	if !subscriptionValid(jc.queueSub) {
+		sub, err := jc.nc.QueueSubscribe(jc.cfg.NatsJobQueueStatusSubject, jc.cfg.NatsJobQueueGroup, jc.handleQueueStatus)
+		if err != nil {
+			jc.logger.Error("Failed to subscribe to queue status requests", zap.String("subject", jc.cfg.NatsJobQueueStatusSubject), zap.Error(err))
+			return fmt.Errorf("failed to subscribe to queue status requests: %w", err)
+		}
+		jc.queueSub = sub
+	}
+
+	if !subscriptionValid(jc.userJobsSub) {
+		sub, err := jc.nc.QueueSubscribe(jc.cfg.NatsUserActiveJobsSubject, jc.cfg.NatsJobQueueGroup, jc.handleUserActiveJobs)
+		if err != nil {
+			jc.logger.Error("Failed to subscribe to active jobs requests", zap.String("subject", jc.cfg.NatsUserActiveJobsSubject), zap.Error(err))
+			return fmt.Errorf("failed to subscribe to active jobs requests: %w", err)
+		}
+		jc.userJobsSub = sub
+	}
+
+	// Providers report job progress on either prefix, depending on the daemon
+	prefixes := []string{jc.cfg.NatsJobStatusUpdateSubjectPrefix, jc.cfg.NatsTaskStatusSubjectPrefix}
+	if jc.statusSubs == nil {
+		jc.statusSubs = make([]*nats.Subscription, len(prefixes))
+	}
+	for i, prefix := range prefixes {
+		if subscriptionValid(jc.statusSubs[i]) {
+			continue
+		}
+		subject := prefix + ".*"
+		sub, err := jc.nc.QueueSubscribe(subject, jc.cfg.NatsJobQueueGroup, jc.handleTaskStatus)
+		if err != nil {
+			jc.logger.Error("Failed to subscribe to task status updates", zap.String("subject", subject), zap.Error(err))
+			return fmt.Errorf("failed to subscribe to task status updates: %w", err)
+		}
+		jc.statusSubs[i] = sub
+	}
+
+	if !subscriptionValid(jc.cancelSub) {
+		subject := jc.cfg.NatsTaskCancelSubjectPrefix + ".*"
+		sub, err := jc.nc.QueueSubscribe(subject, jc.cfg.NatsJobQueueGroup, jc.handleTaskCancel)
+		if err != nil {
+			jc.logger.Error("Failed to subscribe to job cancellations", zap.String("subject", subject), zap.Error(err))
+			return fmt.Errorf("failed to subscribe to job cancellations: %w", err)
+		}
+		jc.cancelSub = sub
+	}
+	return nil
+}
+
+// durableName returns the durable consumer name shared by all scheduler instances in the queue group.
+func (jc *JobConsumer) durableName() string {
+	return jc.cfg.NatsJobQueueGroup + "_consumer"
+}
 
+// ensureJobStream creates the job submission stream if it does not exist, or updates
+// its retention settings to match the configuration.
+func (jc *JobConsumer) ensureJobStream() error {
+	streamCfg := &nats.StreamConfig{
+		Name:       jc.cfg.NatsJobStreamName,
+		Subjects:   []string{jc.cfg.NatsJobSubmissionSubject},
+		Retention:  nats.WorkQueuePolicy, // A job is removed from the stream once it has been ACKed
+		Storage:    nats.FileStorage,
+		MaxAge:     jc.cfg.NatsJobStreamMaxAge,
+		Replicas:   jc.cfg.NatsJobStreamReplicas,
+		Duplicates: 2 * time.Minute, // Publishers set Nats-Msg-Id to the job ID to drop duplicate submissions
+	}
+
+	info, err := jc.js.StreamInfo(streamCfg.Name)
+	if err != nil {
+		if !errors.Is(err, nats.ErrStreamNotFound) {
+			return fmt.Errorf("failed to look up job stream %s: %w", streamCfg.Name, err)
+		}
+		if _, err := jc.js.AddStream(streamCfg); err != nil {
+			return fmt.Errorf("failed to create job stream %s: %w", streamCfg.Name, err)
+		}
+		jc.logger.Info("Created JetStream job stream",
+			zap.String("stream", streamCfg.Name),
+			zap.Duration("max_age", streamCfg.MaxAge),
+			zap.Int("replicas", streamCfg.Replicas),
+		)
+		return nil
+	}
+
+	// Retention and storage cannot be changed on an existing stream, so keep the existing ones.
+	existing := info.Config
+	if existing.MaxAge == streamCfg.MaxAge && existing.Replicas == streamCfg.Replicas && containsSubject(existing.Subjects, streamCfg.Subjects[0]) {
+		return nil
+	}
+	streamCfg.Retention = existing.Retention
+	streamCfg.Storage = existing.Storage
+	if !containsSubject(existing.Subjects, streamCfg.Subjects[0]) {
+		streamCfg.Subjects = append(existing.Subjects, streamCfg.Subjects[0])
+	} else {
+		streamCfg.Subjects = existing.Subjects
+	}
+	if _, err := jc.js.UpdateStream(streamCfg); err != nil {
+		// The existing stream still captures jobs, so this is not fatal.
+		jc.logger.Warn("Failed to update JetStream job stream settings",
+			zap.String("stream", streamCfg.Name),
+			zap.Error(err),
+		)
+		return nil
+	}
+	jc.logger.Info("Updated JetStream job stream settings", zap.String("stream", streamCfg.Name))
 	return nil
 }
 
+func containsSubject(subjects []string, subject string) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
 func (jc *JobConsumer) fetchLoop() {
 	jc.logger.Info("Starting JetStream message fetch loop...")
 	batchSize := 5 // Smaller batch for more responsive processing initially
@@ -115,20 +292,32 @@ func (jc *JobConsumer) fetchLoop() {
 			jc.logger.Info("Shutting down JetStream message fetch loop...")
 			return
 		default:
-			msgs, err := jc.subscription.Fetch(batchSize, nats.MaxWait(10*time.Second))
+			sub := jc.pullSubscription()
+			if sub == nil || !sub.IsValid() {
+				// The subscription was lost with the connection; wait for it to be restored
+				if !jc.resubscribe() {
+					jc.logger.Info("Stopping JetStream message fetch loop; consumer stopped or NATS connection closed")
+					return
+				}
+				continue
+			}
+
+			msgs, err := sub.Fetch(batchSize, nats.MaxWait(10*time.Second))
 			if err != nil {
 				if err == nats.ErrTimeout {
 					// This is normal, just means no messages in this fetch window
 					continue
 				}
-				// For other errors, log and potentially break or backoff
 				jc.logger.Error("Error fetching messages from JetStream", zap.Error(err))
-				// Check if subscription is still valid or if NATS connection is down
-				if !jc.subscription.IsValid() || jc.nc.Status() != nats.CONNECTED {
-					jc.logger.Error("NATS subscription or connection lost. Stopping fetch loop.")
-					return // Exit loop if subscription is bad
+				if errors.Is(err, nats.ErrConsumerDeleted) || errors.Is(err, nats.ErrConsumerNotFound) {
+					// The durable consumer is gone, e.g. after the NATS server lost its state
+					jc.dropPullSubscription(sub)
+					continue
+				}
+				select {
+				case <-jc.shutdownChan:
+				case <-time.After(5 * time.Second): // Simple backoff
 				}
-				time.Sleep(5 * time.Second) // Simple backoff
 				continue
 			}
 
@@ -160,12 +349,24 @@ func (jc *JobConsumer) handleMessage(msg *nats.Msg) {
 		return
 	}
 
-	// Check if job already exists (e.g. from a previous run if scheduler restarted)
+	if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > 1 {
+		jc.logger.Info("Job message redelivered",
+			zap.String("job_id", job.ID),
+			zap.Uint64("delivery", meta.NumDelivered),
+			zap.Int("max_deliver", jc.cfg.NatsJobMaxDeliver),
+		)
+	}
+
+	// Check if job already exists (e.g. from a previous run if scheduler restarted).
+	// Delivery is at-least-once, so the job ID is what keeps redeliveries idempotent;
+	// without a definitive answer from the store I retry later rather than risk a double dispatch.
 	existingJobRecord, err := jc.jobStore.GetJob(ctx, job.ID)
 	if err != nil {
 		jc.logger.Error("Failed to check for existing job in store", zap.String("job_id", job.ID), zap.Error(err))
-		// Decide how to handle this: Nak for retry, or attempt to process anyway?
-		// For now, log and attempt to process. If SaveJob fails later, it will be handled.
+		if nakErr := msg.NakWithDelay(10 * time.Second); nakErr != nil {
+			jc.logger.Error("Failed to NAK message after job lookup failure", zap.Error(nakErr))
+		}
+		return
 	}
 
 	var internalJob *models.InternalJobRepresentation
@@ -173,8 +374,11 @@ func (jc *JobConsumer) handleMessage(msg *nats.Msg) {
 		internalJob = existingJobRecord.ToInternalJobRepresentation()
 		jc.logger.Info("Processing existing job found in store", zap.String("job_id", internalJob.JobDetails.ID), zap.String("current_state", string(internalJob.State)))
 		// If job is already in a terminal state (completed, failed with max attempts, cancelled), maybe just ACK and skip?
-		if internalJob.State == models.JobStateCompleted || internalJob.State == models.JobStateCancelled {
-			jc.logger.Info("Job already in terminal state, ACKing and skipping", zap.String("job_id", internalJob.JobDetails.ID), zap.String("state", string(internalJob.State)))
+		// Dispatched or running jobs were handed to a provider by an earlier delivery whose ACK was lost.
+		// Failed jobs had their reservation released when they failed, so they can't be placed again.
+		if isTerminalJobState(internalJob.State) ||
+			internalJob.State == models.JobStateDispatched || internalJob.State == models.JobStateRunning {
+			jc.logger.Info("Job already dispatched or in terminal state, ACKing and skipping", zap.String("job_id", internalJob.JobDetails.ID), zap.String("state", string(internalJob.State)))
 			if ackErr := msg.Ack(); ackErr != nil {
 				jc.logger.Error("Failed to ACK message for already terminal job", zap.Error(ackErr))
 			}
@@ -197,9 +401,29 @@ func (jc *JobConsumer) handleMessage(msg *nats.Msg) {
 			return
 		}
 		jc.logger.Info("New job saved to store", zap.String("job_id", internalJob.JobDetails.ID))
+		metrics.JobsReceived.Inc()
 	}
 
+	scheduleStart := time.Now()
 	scheduled, scheduleErr := jc.scheduleJob(internalJob)
+	metrics.SchedulingDuration.Observe(time.Since(scheduleStart).Seconds())
+	switch {
+	case scheduleErr != nil:
+		metrics.SchedulingAttempts.WithLabelValues("error").Inc()
+	case !scheduled:
+		metrics.SchedulingAttempts.WithLabelValues("no_provider").Inc()
+	default:
+		metrics.SchedulingAttempts.WithLabelValues("dispatched").Inc()
+	}
+
+	// Cancelled while this delivery was being handled: the cancel released the job
+	if errors.Is(scheduleErr, errJobNotWaiting) {
+		jc.logger.Info("Job is no longer waiting for a provider, ACKing", zap.String("job_id", internalJob.JobDetails.ID))
+		if ackErr := msg.Ack(); ackErr != nil {
+			jc.logger.Error("Failed to ACK message for job no longer waiting", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(ackErr))
+		}
+		return
+	}
 
 	// Update job state in DB based on scheduling outcome
 	currentAttempts := internalJob.Attempts
@@ -207,16 +431,46 @@ func (jc *JobConsumer) handleMessage(msg *nats.Msg) {
 		currentAttempts++ // Increment attempt only if scheduling was tried and failed/not scheduled
 	}
 
-	finalLastError := ""
+	// A job no provider could take fails once it has waited too long
+	queueWaitExpired := !scheduled && scheduleErr == nil && jc.expireQueueWait(internalJob, time.Now().UTC())
+
+	finalLastError := internalJob.LastError
 	if scheduleErr != nil {
 		finalLastError = scheduleErr.Error()
 	}
 
-	// Persist the state after scheduling attempt (whether successful or not)
-	if err := jc.jobStore.UpdateJobState(ctx, internalJob.JobDetails.ID, internalJob.State, internalJob.ProviderID, finalLastError, currentAttempts); err != nil {
+	// Persist the state after scheduling attempt (whether successful or not). A job that
+	// is still waiting may be cancelled meanwhile, which this mustn't undo.
+	updated, err := jc.jobStore.UpdateJobStateFrom(ctx, internalJob.JobDetails.ID, unplacedJobStates, internalJob.State, internalJob.ProviderID, finalLastError, currentAttempts)
+	if err != nil {
 		jc.logger.Error("Failed to update job state in store after scheduling attempt", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(err))
 		// This is tricky: if DB update fails, what to do with NATS message?
 		// For now, we will proceed with NATS ack/nak based on scheduling outcome, as DB might recover.
+	} else if !updated && !scheduled {
+		jc.logger.Info("Job was cancelled while waiting for a provider, ACKing", zap.String("job_id", internalJob.JobDetails.ID))
+		if ackErr := msg.Ack(); ackErr != nil {
+			jc.logger.Error("Failed to ACK message for cancelled job", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(ackErr))
+		}
+		return
+	}
+
+	// Failing is final: whatever was held for the job is given back
+	if internalJob.State == models.JobStateFailed {
+		message := "Job failed before it was placed"
+		if queueWaitExpired {
+			message = "Job failed waiting for a provider"
+			jc.logger.Warn("Job timed out waiting for a provider",
+				zap.String("job_id", internalJob.JobDetails.ID),
+				zap.Int("max_queue_wait_minutes", jc.cfg.MaxQueueWaitMinutes),
+				zap.String("reason", internalJob.LastError))
+		} else {
+			jc.logger.Error("Job failed during placement", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(scheduleErr))
+		}
+		jc.releaseUnplacedJob(internalJob, "failed", message)
+		if ackErr := msg.AckSync(); ackErr != nil {
+			jc.logger.Error("Failed to ACK message for failed job", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(ackErr))
+		}
+		return
 	}
 
 	if scheduleErr != nil {
@@ -229,12 +483,11 @@ func (jc *JobConsumer) handleMessage(msg *nats.Msg) {
 	}
 
 	if !scheduled {
-		jc.logger.Warn("Job could not be scheduled at this time (no suitable providers)", zap.String("job_id", internalJob.JobDetails.ID))
+		jc.logger.Warn("Job could not be scheduled at this time (no suitable providers)",
+			zap.String("job_id", internalJob.JobDetails.ID),
+			zap.Duration("waited", time.Since(internalJob.ReceivedAt)))
 		// State is already updated in internalJob by scheduleJob, and persisted above.
-		if nakErr := msg.NakWithDelay(1 * time.Minute); nakErr != nil {
-			jc.logger.Error("Failed to NAK message for job with no suitable providers", zap.String("job_id", internalJob.JobDetails.ID), zap.Error(nakErr))
-			_ = msg.Ack()
-		}
+		jc.retryPlacement(msg, internalJob.JobDetails.ID)
 		return
 	}
 
@@ -263,81 +516,51 @@ func (jc *JobConsumer) scheduleJob(internalJob *models.InternalJobRepresentation
 		return false, fmt.Errorf("provider registry query failed: %w", err)
 	}
 
-	var suitableProvider *clients.Provider
-	for _, p := range providers {
-		provider := p // Create a new variable to take its address
-		if provider.Status != clients.StatusIdle {
-			jc.logger.Debug("Skipping provider: not idle", zap.String("provider_id", provider.ID.String()), zap.String("status", string(provider.Status)))
-			continue
-		}
-
-		// GPU Type Matching (case-insensitive for flexibility)
-		if job.GPUType != "" && !strings.EqualFold(jc.findProviderGPUType(&provider), job.GPUType) {
-			// This simple check assumes if a GPUType is requested, the provider must primarily feature that type.
-			// More complex logic can check individual GPUs within the provider.
-			jc.logger.Debug("Skipping provider: GPUType mismatch",
-				zap.String("provider_id", provider.ID.String()),
-				zap.String("provider_gpu", jc.findProviderGPUType(&provider)),
-				zap.String("job_requires", job.GPUType),
-			)
-			continue
-		}
+	candidates := jc.filterCandidates(&job, providers)
 
-		// GPU Count Matching
-		if job.GPUCount > 0 && len(provider.GPUs) < job.GPUCount {
-			jc.logger.Debug("Skipping provider: insufficient GPU count",
-				zap.String("provider_id", provider.ID.String()),
-				zap.Int("provider_gpus", len(provider.GPUs)),
-				zap.Int("job_requires", job.GPUCount),
-			)
-			continue
-		}
-		// TODO: Add more sophisticated matching: VRAM, specific GPU models within a provider if heterogeneous... -virjilakrum
-
-		suitableProvider = &provider
+	suitableProvider := jc.selectProvider(&job, candidates)
+	if suitableProvider != nil {
 		jc.logger.Info("Found suitable provider for job",
 			zap.String("job_id", job.ID),
 			zap.String("provider_id", suitableProvider.ID.String()),
 			zap.String("provider_name", suitableProvider.Name),
+			zap.Int("candidates", len(candidates)),
 		)
-		break
 	}
 
 	if suitableProvider == nil {
 		jc.logger.Info("No suitable provider found for job at this time", zap.String("job_id", job.ID))
-		internalJob.State = models.JobStatePending // Set back to pending if no provider found
+		internalJob.State = models.JobStateNoProviderAvailable // Placement is retried until the queue wait runs out
 		internalJob.LastError = "No suitable provider found"
+		if requiresGPUArchitecture(&job) && !anyCompatibleProvider(&job, providers) {
+			internalJob.LastError = fmt.Sprintf("No provider has a GPU with %s", describeGPURequirement(&job))
+		}
 		// UpdateJobState in handleMessage will handle attempts and UpdatedAt
 		return false, nil
 	}
 
+	// Claim the job for this placement. From here on its reservation is either handed
+	// to its billing session or released when the job fails, so a cancel must not
+	// release it as well.
+	ctx := context.Background()
+	claimed, err := jc.jobStore.UpdateJobStateFrom(ctx, job.ID, unplacedJobStates, models.JobStateAssigning, "", internalJob.LastError, internalJob.Attempts)
+	if err != nil {
+		internalJob.State = originalState
+		return false, fmt.Errorf("failed to claim job for placement: %w", err)
+	}
+	if !claimed {
+		return false, errJobNotWaiting
+	}
+	internalJob.State = models.JobStateAssigning
+
 	// Validate billing requirements and start session
+	var sessionID *uuid.UUID
 	if jc.billingClient != nil {
 		// Validate user has sufficient balance
-		gpuModel := jc.findProviderGPUType(suitableProvider)
-		vramMB := uint64(8192)         // Default 8GB, should come from provider GPU specs
-		estimatedPowerW := uint32(250) // Default 250W, should come from provider GPU specs
-
-		if len(suitableProvider.GPUs) > 0 {
-			// Use actual GPU specs if available
-			gpu := suitableProvider.GPUs[0]
-			if gpu.VRAM > 0 {
-				vramMB = gpu.VRAM
-			}
-			// Power consumption would need to be added to GPUDetail struct
-			// For now, use default values based on GPU model
-			if strings.Contains(strings.ToLower(gpu.ModelName), "4090") {
-				estimatedPowerW = 450
-			} else if strings.Contains(strings.ToLower(gpu.ModelName), "a100") {
-				estimatedPowerW = 400
-			} else if strings.Contains(strings.ToLower(gpu.ModelName), "h100") {
-				estimatedPowerW = 700
-			}
-		}
+		gpuModel, vramMB, estimatedPowerW := jc.providerBillingSpecs(suitableProvider)
 
-		err := jc.billingClient.ValidateJobRequirements(context.Background(), job.UserID, gpuModel, vramMB, estimatedPowerW)
+		err := jc.billingClient.ValidateJobRequirements(ctx, job.UserID, gpuModel, vramMB, estimatedPowerW)
 		if err != nil {
-			jc.logger.Error("Job billing validation failed", zap.String("job_id", job.ID), zap.Error(err))
 			internalJob.State = models.JobStateFailed
 			internalJob.LastError = fmt.Sprintf("Billing validation failed: %v", err)
 			return false, fmt.Errorf("billing validation failed: %w", err)
@@ -351,33 +574,31 @@ func (jc *JobConsumer) scheduleJob(internalJob *models.InternalJobRepresentation
 			GPUModel:        gpuModel,
 			RequestedVRAM:   vramMB,
 			EstimatedPowerW: estimatedPowerW,
+			ReservedAmount:  job.ReservedFunds,
 		}
 
-		sessionResp, err := jc.billingClient.StartSession(context.Background(), sessionReq)
+		sessionResp, err := jc.billingClient.StartSession(ctx, sessionReq)
 		if err != nil {
-			jc.logger.Error("Failed to start billing session", zap.String("job_id", job.ID), zap.Error(err))
 			internalJob.State = models.JobStateFailed
 			internalJob.LastError = fmt.Sprintf("Failed to start billing session: %v", err)
 			return false, fmt.Errorf("billing session start failed: %w", err)
 		}
+		// The session released the reservation as it locked its own funds
+		internalJob.JobDetails.ReservedFunds = decimal.Zero
+		sessionID = &sessionResp.Session.ID
 
 		jc.logger.Info("Billing session started successfully",
 			zap.String("job_id", job.ID),
 			zap.String("session_id", sessionResp.Session.ID.String()),
 			zap.String("estimated_hourly_cost", sessionResp.EstimatedHourlyCost.String()),
 		)
-
-		// Store session ID in task parameters for later reference
-		jc.logger.Info("Session ID will be passed to task execution",
-			zap.String("session_id", sessionResp.Session.ID.String()),
-		)
 	}
 
 	// --- Task Creation & Dispatch ---
 	task := models.NewTask(&job, suitableProvider.ID.String())
 	taskJSON, err := json.Marshal(task)
 	if err != nil {
-		jc.logger.Error("Failed to marshal task for dispatch", zap.String("job_id", job.ID), zap.Error(err))
+		jc.endPlacementSession(job.ID, sessionID)
 		internalJob.State = models.JobStateFailed
 		internalJob.LastError = fmt.Sprintf("Failed to prepare task data: %v", err)
 		return false, fmt.Errorf("task marshalling failed: %w", err)
@@ -392,19 +613,20 @@ func (jc *JobConsumer) scheduleJob(internalJob *models.InternalJobRepresentation
 	)
 
 	// Actually publish the task to NATS:
-	if err := jc.nc.Publish(dispatchSubject, taskJSON); err != nil {
+	if err := jc.publish(dispatchSubject, taskJSON); err != nil {
 		jc.logger.Error("Failed to publish task to NATS",
 			zap.String("job_id", job.ID),
 			zap.String("provider_id", suitableProvider.ID.String()),
 			zap.String("dispatch_subject", dispatchSubject),
 			zap.Error(err),
 		)
-		// If publishing fails, we should probably not ACK the original job message.
-		// Instead, let the original message be NAK'd so it can be retried later.
-		// The job state should reflect that it's pending a retry due to dispatch failure.
-		internalJob.State = models.JobStatePending // Or a more specific "dispatch_failed_retry" state
+		// The session took over the job's reservation, so placing the job again would
+		// need funds that are no longer reserved: the session is ended, which gives its
+		// funds back, and the job fails.
+		jc.endPlacementSession(job.ID, sessionID)
+		internalJob.State = models.JobStateFailed
 		internalJob.LastError = fmt.Sprintf("Failed to dispatch task to NATS: %v", err)
-		return false, fmt.Errorf("NATS publish failed for task: %w", err) // This error will trigger a Nak in handleMessage
+		return false, fmt.Errorf("NATS publish failed for task: %w", err)
 	}
 
 	internalJob.State = models.JobStateDispatched // Or JobStateAssigning if there's another ack step from daemon
@@ -419,6 +641,126 @@ func (jc *JobConsumer) scheduleJob(internalJob *models.InternalJobRepresentation
 	return true, nil
 }
 
+// filterCandidates returns the idle providers that satisfy the job's placement
+// preferences and GPU requirements.
+func (jc *JobConsumer) filterCandidates(job *models.Job, providers []clients.Provider) []clients.Provider {
+	var candidates []clients.Provider
+	for _, p := range providers {
+		provider := p // Create a new variable to take its address
+		if provider.Status != clients.StatusIdle {
+			jc.logger.Debug("Skipping provider: not idle", zap.String("provider_id", provider.ID.String()), zap.String("status", string(provider.Status)))
+			continue
+		}
+
+		// Preferred/excluded providers are hard filters
+		if !allowedByPreferences(job, &provider) {
+			jc.logger.Debug("Skipping provider: excluded by job placement preferences", zap.String("provider_id", provider.ID.String()))
+			continue
+		}
+
+		// GPU Type Matching (case-insensitive for flexibility)
+		if job.GPUType != "" && !strings.EqualFold(jc.findProviderGPUType(&provider), job.GPUType) {
+			// This simple check assumes if a GPUType is requested, the provider must primarily feature that type.
+			// More complex logic can check individual GPUs within the provider.
+			jc.logger.Debug("Skipping provider: GPUType mismatch",
+				zap.String("provider_id", provider.ID.String()),
+				zap.String("provider_gpu", jc.findProviderGPUType(&provider)),
+				zap.String("job_requires", job.GPUType),
+			)
+			continue
+		}
+
+		// GPU Count Matching
+		if job.GPUCount > 0 && len(provider.GPUs) < job.GPUCount {
+			jc.logger.Debug("Skipping provider: insufficient GPU count",
+				zap.String("provider_id", provider.ID.String()),
+				zap.Int("provider_gpus", len(provider.GPUs)),
+				zap.Int("job_requires", job.GPUCount),
+			)
+			continue
+		}
+
+		// Architecture / compute capability matching: the job's code only runs on GPUs it was built for
+		if requiresGPUArchitecture(job) {
+			needed := job.GPUCount
+			if needed < 1 {
+				needed = 1
+			}
+			if compatible := compatibleGPUCount(job, &provider); compatible < needed {
+				jc.logger.Debug("Skipping provider: incompatible GPU architecture",
+					zap.String("provider_id", provider.ID.String()),
+					zap.Int("compatible_gpus", compatible),
+					zap.String("job_requires", describeGPURequirement(job)),
+				)
+				continue
+			}
+		}
+		// TODO: Add more sophisticated matching: VRAM, specific GPU models within a provider if heterogeneous... -virjilakrum
+
+		candidates = append(candidates, provider)
+	}
+	return candidates
+}
+
+// selectProvider picks the provider to place the job on from the candidates that
+// satisfy its requirements, according to the configured scheduling strategy.
+func (jc *JobConsumer) selectProvider(job *models.Job, candidates []clients.Provider) *clients.Provider {
+	if len(candidates) == 0 {
+		return nil
+	}
+	if jc.cfg.SchedulingStrategy == SchedulingStrategyFirstFit {
+		return &candidates[0]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	providerIDs := make([]string, len(candidates))
+	for i := range candidates {
+		providerIDs[i] = candidates[i].ID.String()
+	}
+	stats, err := jc.jobStore.GetProviderStats(ctx, providerIDs)
+	if err != nil {
+		// Scoring still works without history; success rate is treated as neutral
+		jc.logger.Warn("Failed to load provider job stats, scoring without history", zap.String("job_id", job.ID), zap.Error(err))
+	}
+
+	scorer := NewProviderScorer(jc.cfg.SchedulingWeights, jc.cfg.MaxPricePerHour, stats)
+	best, score := scorer.SelectBest(job, candidates)
+	if best != nil {
+		jc.logger.Debug("Selected highest scoring provider",
+			zap.String("job_id", job.ID),
+			zap.String("provider_id", best.ID.String()),
+			zap.Float64("score", score),
+		)
+	}
+	return best
+}
+
+// providerBillingSpecs returns the GPU model, VRAM and power draw a provider is billed at
+func (jc *JobConsumer) providerBillingSpecs(provider *clients.Provider) (string, uint64, uint32) {
+	gpuModel := jc.findProviderGPUType(provider)
+	vramMB := uint64(8192)         // Default 8GB, should come from provider GPU specs
+	estimatedPowerW := uint32(250) // Default 250W, should come from provider GPU specs
+
+	if len(provider.GPUs) > 0 {
+		// Use actual GPU specs if available
+		gpu := provider.GPUs[0]
+		if gpu.VRAM > 0 {
+			vramMB = gpu.VRAM
+		}
+		// Power consumption would need to be added to GPUDetail struct
+		// For now, use default values based on GPU model
+		if strings.Contains(strings.ToLower(gpu.ModelName), "4090") {
+			estimatedPowerW = 450
+		} else if strings.Contains(strings.ToLower(gpu.ModelName), "a100") {
+			estimatedPowerW = 400
+		} else if strings.Contains(strings.ToLower(gpu.ModelName), "h100") {
+			estimatedPowerW = 700
+		}
+	}
+	return gpuModel, vramMB, estimatedPowerW
+}
+
 // findProviderGPUType extracts the GPU model name from a provider
 func (jc *JobConsumer) findProviderGPUType(provider *clients.Provider) string {
 	if len(provider.GPUs) > 0 {
@@ -431,13 +773,16 @@ func (jc *JobConsumer) findProviderGPUType(provider *clients.Provider) string {
 func (jc *JobConsumer) Stop() {
 	jc.logger.Info("Stopping JobConsumer...")
 	close(jc.shutdownChan) // Signal the fetchLoop to stop
+	jc.healthy.Store(false)
 
+	jc.subMu.Lock()
+	defer jc.subMu.Unlock()
 	if jc.subscription != nil {
 		jc.logger.Info("Unsubscribing NATS job consumer...")
 		// For Pull Subscriptions, Drain is often preferred to ensure all fetched messages are processed.
 		// However, Unsubscribe is quicker if we are shutting down hard.
 		// Let's try Drain first, then Unsubscribe as a fallback if Drain errors or times out.
-		durableName := jc.cfg.NatsJobQueueGroup + "_consumer" // Re-construct or pass durableName if needed
+		durableName := jc.durableName()
 		if err := jc.subscription.Drain(); err != nil {
 			jc.logger.Error("Error draining NATS subscription", zap.Error(err),
 				zap.String("durable_name", durableName),
@@ -450,6 +795,34 @@ func (jc *JobConsumer) Stop() {
 			jc.logger.Info("NATS job consumer subscription drained successfully")
 		}
 	}
+	if jc.dryRunSub != nil {
+		if err := jc.dryRunSub.Unsubscribe(); err != nil {
+			jc.logger.Error("Error unsubscribing from dry-run job requests", zap.Error(err))
+		}
+	}
+	if jc.queueSub != nil {
+		if err := jc.queueSub.Unsubscribe(); err != nil {
+			jc.logger.Error("Error unsubscribing from queue status requests", zap.Error(err))
+		}
+	}
+	if jc.userJobsSub != nil {
+		if err := jc.userJobsSub.Unsubscribe(); err != nil {
+			jc.logger.Error("Error unsubscribing from active jobs requests", zap.Error(err))
+		}
+	}
+	for _, sub := range jc.statusSubs {
+		if sub == nil {
+			continue
+		}
+		if err := sub.Unsubscribe(); err != nil {
+			jc.logger.Error("Error unsubscribing from task status updates", zap.String("subject", sub.Subject), zap.Error(err))
+		}
+	}
+	if jc.cancelSub != nil {
+		if err := jc.cancelSub.Unsubscribe(); err != nil {
+			jc.logger.Error("Error unsubscribing from job cancellations", zap.Error(err))
+		}
+	}
 	// Note: Draining the subscription or connection is handled by the main NATS client close/drain.
 	jc.logger.Info("JobConsumer stopped.")
 }
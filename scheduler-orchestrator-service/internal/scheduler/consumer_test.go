@@ -0,0 +1,478 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/billing"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/config"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// memJobStore is an in-memory store.JobStore
+type memJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*models.JobRecord
+
+	statsRequests [][]string // Provider IDs of each GetProviderStats call
+}
+
+func newMemJobStore() *memJobStore {
+	return &memJobStore{jobs: make(map[string]*models.JobRecord)}
+}
+
+func (s *memJobStore) SaveJob(ctx context.Context, record *models.JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *record
+	s.jobs[record.JobID] = &saved
+	return nil
+}
+
+func (s *memJobStore) GetJob(ctx context.Context, jobID string) (*models.JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.jobs[jobID]
+	if !ok {
+		return nil, nil
+	}
+	found := *record
+	return &found, nil
+}
+
+func (s *memJobStore) UpdateJobState(ctx context.Context, jobID string, newState models.SchedulerJobState, providerID string, lastError string, attempts int) error {
+	_, err := s.UpdateJobStateFrom(ctx, jobID, nil, newState, providerID, lastError, attempts)
+	return err
+}
+
+// UpdateJobStateFrom applies the update unconditionally when from is nil
+func (s *memJobStore) UpdateJobStateFrom(ctx context.Context, jobID string, from []models.SchedulerJobState, newState models.SchedulerJobState, providerID string, lastError string, attempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.jobs[jobID]
+	if !ok {
+		return false, nil
+	}
+	if from != nil && !containsState(from, record.State) {
+		return false, nil
+	}
+	record.State = newState
+	record.ProviderID = providerID
+	record.LastError = lastError
+	record.Attempts = attempts
+	record.UpdatedAt = time.Now().UTC()
+	return true, nil
+}
+
+func containsState(states []models.SchedulerJobState, state models.SchedulerJobState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memJobStore) GetJobsByState(ctx context.Context, state models.SchedulerJobState, limit int) ([]*models.JobRecord, error) {
+	return nil, nil
+}
+
+func (s *memJobStore) GetRetryableJobs(ctx context.Context, limit int) ([]*models.JobRecord, error) {
+	return nil, nil
+}
+
+// GetProviderStats counts the stored jobs of the providers and remembers which were asked for
+func (s *memJobStore) GetProviderStats(ctx context.Context, providerIDs []string) (map[string]models.ProviderJobStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statsRequests = append(s.statsRequests, providerIDs)
+	stats := make(map[string]models.ProviderJobStats)
+	for _, id := range providerIDs {
+		var providerStats models.ProviderJobStats
+		for _, record := range s.jobs {
+			if record.ProviderID != id {
+				continue
+			}
+			switch record.State {
+			case models.JobStateCompleted:
+				providerStats.Completed++
+			case models.JobStateFailed:
+				providerStats.Failed++
+			}
+		}
+		stats[id] = providerStats
+	}
+	return stats, nil
+}
+
+func (s *memJobStore) GetQueuePosition(ctx context.Context, jobID string) (int, error) {
+	return 0, nil
+}
+
+func (s *memJobStore) CountActiveJobsByUser(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+func (s *memJobStore) GetAverageRunDuration(ctx context.Context, sampleSize int) (time.Duration, bool, error) {
+	return 0, false, nil
+}
+
+func (s *memJobStore) DeleteJob(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, jobID)
+	return nil
+}
+
+func (s *memJobStore) Initialize(ctx context.Context) error { return nil }
+func (s *memJobStore) Close() error                         { return nil }
+
+func (s *memJobStore) state(t *testing.T, jobID string) models.SchedulerJobState {
+	t.Helper()
+	record, _ := s.GetJob(context.Background(), jobID)
+	if record == nil {
+		t.Fatalf("job %s not in the store", jobID)
+	}
+	return record.State
+}
+
+// fakeBilling is a billing service recording the calls the scheduler makes
+type fakeBilling struct {
+	mu             sync.Mutex
+	startStatus    int
+	sessionStarts  []billing.SessionStartRequest
+	sessionEnds    []billing.SessionEndRequest
+	releasedAmount decimal.Decimal
+	releases       int
+}
+
+func (b *fakeBilling) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/v1/billing/start-session":
+		var req billing.SessionStartRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		b.sessionStarts = append(b.sessionStarts, req)
+		if b.startStatus != 0 {
+			w.WriteHeader(b.startStatus)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"session": map[string]interface{}{"id": uuid.New()}})
+	case "/api/v1/billing/end-session":
+		var req billing.SessionEndRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		b.sessionEnds = append(b.sessionEnds, req)
+		json.NewEncoder(w).Encode(map[string]interface{}{"session": map[string]interface{}{"id": req.SessionID}})
+	case "/api/v1/billing/release-funds":
+		var req struct {
+			Amount decimal.Decimal `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		b.releases++
+		b.releasedAmount = b.releasedAmount.Add(req.Amount)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fakeRegistry is a provider registry serving a replaceable provider list
+type fakeRegistry struct {
+	mu        sync.Mutex
+	providers []clients.Provider
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	providers := f.providers
+	if providers == nil {
+		providers = []clients.Provider{}
+	}
+	json.NewEncoder(w).Encode(providers)
+}
+
+func (f *fakeRegistry) setProviders(providers ...clients.Provider) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.providers = providers
+}
+
+func idleProvider() clients.Provider {
+	return clients.Provider{
+		ID:     uuid.New(),
+		Name:   "provider",
+		Status: clients.StatusIdle,
+		GPUs:   []clients.GPUDetail{{ModelName: "RTX 4090", VRAM: 24576, IsHealthy: true}},
+	}
+}
+
+// published is a message the consumer published on core NATS
+type published struct {
+	subject string
+	data    []byte
+}
+
+// testConsumer is a job consumer against in-memory fakes of its dependencies
+type testConsumer struct {
+	*JobConsumer
+	store    *memJobStore
+	billing  *fakeBilling
+	registry *fakeRegistry
+
+	mu          sync.Mutex
+	published   []published
+	publishFail error
+}
+
+func newTestConsumer(t *testing.T) *testConsumer {
+	t.Helper()
+	tc := &testConsumer{store: newMemJobStore(), billing: &fakeBilling{}, registry: &fakeRegistry{}}
+	billingServer := httptest.NewServer(tc.billing)
+	t.Cleanup(billingServer.Close)
+	registryServer := httptest.NewServer(tc.registry)
+	t.Cleanup(registryServer.Close)
+
+	cfg := &config.Config{
+		ProviderRegistryURL:           registryServer.URL,
+		ProviderQueryTimeout:          5 * time.Second,
+		SchedulingStrategy:            SchedulingStrategyFirstFit,
+		MaxQueueWaitMinutes:           10,
+		NoProviderRetryInterval:       time.Second,
+		NatsTaskDispatchSubjectPrefix: "tasks.dispatch",
+		NatsTaskStatusSubjectPrefix:   "task.status",
+		NatsTaskCancelSubjectPrefix:   "task.cancel",
+	}
+	logger := zap.NewNop()
+	jc, err := NewJobConsumer(nil, cfg, clients.NewClient(cfg, nil, logger),
+		billing.NewClient(&billing.Config{BaseURL: billingServer.URL, Timeout: 5 * time.Second}, logger), logger, tc.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jc.publish = tc.publish
+	tc.JobConsumer = jc
+	return tc
+}
+
+func (tc *testConsumer) publish(subject string, data []byte) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.publishFail != nil && strings.HasPrefix(subject, tc.cfg.NatsTaskDispatchSubjectPrefix+".") {
+		return tc.publishFail
+	}
+	tc.published = append(tc.published, published{subject, data})
+	return nil
+}
+
+// dispatched returns the tasks dispatched to providers
+func (tc *testConsumer) dispatched() []published {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	var tasks []published
+	for _, msg := range tc.published {
+		if strings.HasPrefix(msg.subject, tc.cfg.NatsTaskDispatchSubjectPrefix+".") {
+			tasks = append(tasks, msg)
+		}
+	}
+	return tasks
+}
+
+// statusUpdates returns the statuses published for the job
+func (tc *testConsumer) statusUpdates(jobID string) []string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	var statuses []string
+	for _, msg := range tc.published {
+		if msg.subject != tc.cfg.NatsTaskStatusSubjectPrefix+"."+jobID {
+			continue
+		}
+		var update taskStatusUpdate
+		json.Unmarshal(msg.data, &update)
+		statuses = append(statuses, update.Status)
+	}
+	return statuses
+}
+
+// submit delivers a job submission to the consumer, as the job queue would
+func (tc *testConsumer) submit(t *testing.T, job models.Job) {
+	t.Helper()
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.handleMessage(&nats.Msg{Subject: "jobs.submitted", Data: data})
+}
+
+func reservedJob(amount int64) models.Job {
+	return models.Job{
+		ID:            uuid.NewString(),
+		UserID:        "user-1",
+		Name:          "train",
+		Type:          "training",
+		GPUCount:      1,
+		SubmittedAt:   time.Now().UTC(),
+		ReservedFunds: decimal.NewFromInt(amount),
+	}
+}
+
+func (b *fakeBilling) counts() (starts, ends, releases int, released decimal.Decimal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.sessionStarts), len(b.sessionEnds), b.releases, b.releasedAmount
+}
+
+func TestPlacementHandsReservationToSession(t *testing.T) {
+	tc := newTestConsumer(t)
+	tc.registry.setProviders(idleProvider())
+	job := reservedJob(5)
+
+	tc.submit(t, job)
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateDispatched {
+		t.Fatalf("job state = %s, want dispatched", state)
+	}
+	if len(tc.dispatched()) != 1 {
+		t.Errorf("dispatched %d tasks, want 1", len(tc.dispatched()))
+	}
+	starts, _, releases, _ := tc.billing.counts()
+	if starts != 1 || !tc.billing.sessionStarts[0].ReservedAmount.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("session starts %+v, want one carrying the reservation", tc.billing.sessionStarts)
+	}
+	if releases != 0 {
+		t.Errorf("released the reservation %d times; the session took it over", releases)
+	}
+}
+
+func TestStartSessionFailureReleasesReservation(t *testing.T) {
+	tc := newTestConsumer(t)
+	tc.registry.setProviders(idleProvider())
+	tc.billing.startStatus = http.StatusInternalServerError
+	job := reservedJob(5)
+
+	tc.submit(t, job)
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateFailed {
+		t.Fatalf("job state = %s, want failed", state)
+	}
+	if _, _, releases, released := tc.billing.counts(); releases != 1 || !released.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("released %s in %d calls, want the reservation of 5 once", released, releases)
+	}
+	if len(tc.dispatched()) != 0 {
+		t.Error("job was dispatched without a billing session")
+	}
+	if got := tc.statusUpdates(job.ID); len(got) != 1 || got[0] != "failed" {
+		t.Errorf("status updates = %v, want [failed]", got)
+	}
+
+	// A redelivery of the failed job neither places it nor releases again
+	tc.billing.startStatus = 0
+	tc.submit(t, job)
+	if starts, _, releases, _ := tc.billing.counts(); starts != 1 || releases != 1 {
+		t.Errorf("after redelivery: %d session starts, %d releases; want 1 and 1", starts, releases)
+	}
+}
+
+func TestDispatchFailureEndsSession(t *testing.T) {
+	tc := newTestConsumer(t)
+	tc.registry.setProviders(idleProvider())
+	tc.publishFail = errors.New("nats: connection closed")
+	job := reservedJob(5)
+
+	tc.submit(t, job)
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateFailed {
+		t.Fatalf("job state = %s, want failed", state)
+	}
+	starts, ends, releases, _ := tc.billing.counts()
+	if starts != 1 || ends != 1 {
+		t.Errorf("%d session starts and %d ends, want the started session ended", starts, ends)
+	}
+	// The session holds the reservation now; ending it gives it back
+	if releases != 0 {
+		t.Errorf("released the reservation %d times on top of ending the session", releases)
+	}
+}
+
+func TestCancelBeforePlacementReleasesReservation(t *testing.T) {
+	tc := newTestConsumer(t)
+	job := reservedJob(5)
+
+	// No provider yet: the job waits
+	tc.submit(t, job)
+	if state := tc.store.state(t, job.ID); state != models.JobStateNoProviderAvailable {
+		t.Fatalf("job state = %s, want no_provider_available", state)
+	}
+
+	cancel, _ := json.Marshal(map[string]interface{}{"job_id": job.ID, "requested_by": "user-1"})
+	tc.handleTaskCancel(&nats.Msg{Subject: "task.cancel." + job.ID, Data: cancel})
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateCancelled {
+		t.Fatalf("job state = %s, want cancelled", state)
+	}
+	if _, _, releases, released := tc.billing.counts(); releases != 1 || !released.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("released %s in %d calls, want the reservation of 5 once", released, releases)
+	}
+	if got := tc.statusUpdates(job.ID); len(got) != 1 || got[0] != "cancelled" {
+		t.Errorf("status updates = %v, want [cancelled]", got)
+	}
+
+	// The job's next delivery finds a provider, but the job is cancelled
+	tc.registry.setProviders(idleProvider())
+	tc.submit(t, job)
+	tc.handleTaskCancel(&nats.Msg{Subject: "task.cancel." + job.ID, Data: cancel})
+	if len(tc.dispatched()) != 0 {
+		t.Error("cancelled job was dispatched")
+	}
+	if starts, _, releases, _ := tc.billing.counts(); starts != 0 || releases != 1 {
+		t.Errorf("%d session starts and %d releases, want 0 and 1", starts, releases)
+	}
+}
+
+func TestCancelAfterPlacementLeavesReservationToSession(t *testing.T) {
+	tc := newTestConsumer(t)
+	tc.registry.setProviders(idleProvider())
+	job := reservedJob(5)
+
+	tc.submit(t, job)
+	tc.handleTaskCancel(&nats.Msg{Subject: "task.cancel." + job.ID})
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateDispatched {
+		t.Errorf("job state = %s; a placed job is cancelled by its provider", state)
+	}
+	if _, _, releases, _ := tc.billing.counts(); releases != 0 {
+		t.Errorf("released the reservation %d times after the session took it over", releases)
+	}
+}
+
+func TestQueueWaitExpiryReleasesReservation(t *testing.T) {
+	tc := newTestConsumer(t)
+	job := reservedJob(5)
+	tc.submit(t, job)
+
+	// The job has waited past the maximum by its next delivery
+	record, _ := tc.store.GetJob(context.Background(), job.ID)
+	record.ReceivedAt = time.Now().Add(-time.Hour)
+	tc.store.SaveJob(context.Background(), record)
+	tc.submit(t, job)
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateFailed {
+		t.Fatalf("job state = %s, want failed", state)
+	}
+	if _, _, releases, released := tc.billing.counts(); releases != 1 || !released.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("released %s in %d calls, want the reservation of 5 once", released, releases)
+	}
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// defaultDryRunDurationMinutes is assumed for cost estimates when a job sets no maximum duration
+const defaultDryRunDurationMinutes = 60
+
+// PlacementPreview is the reply to a dry-run job submission: where the job would be
+// placed right now and what it would cost, without reserving funds or dispatching.
+type PlacementPreview struct {
+	JobID         string          `json:"job_id,omitempty"`
+	Placeable     bool            `json:"placeable"`
+	ProviderID    string          `json:"provider_id,omitempty"`
+	ProviderName  string          `json:"provider_name,omitempty"`
+	GPUModel      string          `json:"gpu_model,omitempty"`
+	Candidates    int             `json:"candidates"`
+	DurationHours decimal.Decimal `json:"duration_hours"`
+	EstimatedCost decimal.Decimal `json:"estimated_cost"`
+	Message       string          `json:"message"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// handleDryRun answers a dry-run submission with the placement decision the scheduler
+// would make for the job and its estimated cost. Nothing is stored or dispatched.
+func (jc *JobConsumer) handleDryRun(msg *nats.Msg) {
+	var job models.Job
+	if err := json.Unmarshal(msg.Data, &job); err != nil {
+		jc.respondDryRun(msg, &PlacementPreview{Message: "Invalid job", Error: err.Error()})
+		return
+	}
+
+	preview := &PlacementPreview{JobID: job.ID}
+
+	providers, err := jc.prClient.ListAvailableProviders()
+	if err != nil {
+		jc.logger.Error("Failed to list providers for dry run", zap.String("job_id", job.ID), zap.Error(err))
+		preview.Message = "Provider registry unavailable"
+		preview.Error = err.Error()
+		jc.respondDryRun(msg, preview)
+		return
+	}
+
+	candidates := jc.filterCandidates(&job, providers)
+	preview.Candidates = len(candidates)
+
+	provider := jc.selectProvider(&job, candidates)
+	if provider == nil {
+		preview.Message = "No suitable provider available at this time"
+		jc.respondDryRun(msg, preview)
+		return
+	}
+
+	gpuModel, vramMB, estimatedPowerW := jc.providerBillingSpecs(provider)
+	preview.Placeable = true
+	preview.ProviderID = provider.ID.String()
+	preview.ProviderName = provider.Name
+	preview.GPUModel = gpuModel
+
+	durationMinutes := job.MaxDurationMinutes
+	if durationMinutes <= 0 {
+		durationMinutes = defaultDryRunDurationMinutes
+	}
+	preview.DurationHours = decimal.NewFromInt(int64(durationMinutes)).Div(decimal.NewFromInt(60))
+
+	if jc.billingClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		cost, err := jc.billingClient.EstimateJobCost(ctx, gpuModel, vramMB, estimatedPowerW, preview.DurationHours)
+		if err != nil {
+			jc.logger.Warn("Failed to estimate cost for dry run", zap.String("job_id", job.ID), zap.Error(err))
+			preview.Error = err.Error()
+		} else {
+			preview.EstimatedCost = cost
+		}
+	}
+
+	preview.Message = "Job can be placed"
+	jc.logger.Info("Answered dry-run job submission",
+		zap.String("job_id", job.ID),
+		zap.String("provider_id", preview.ProviderID),
+		zap.String("estimated_cost", preview.EstimatedCost.String()),
+	)
+	jc.respondDryRun(msg, preview)
+}
+
+func (jc *JobConsumer) respondDryRun(msg *nats.Msg, preview *PlacementPreview) {
+	data, err := json.Marshal(preview)
+	if err != nil {
+		jc.logger.Error("Failed to marshal dry-run reply", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		jc.logger.Error("Failed to send dry-run reply", zap.String("job_id", preview.JobID), zap.Error(err))
+	}
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+)
+
+// requiresGPUArchitecture reports whether the job restricts the GPU architecture or
+// compute capability it can run on.
+func requiresGPUArchitecture(job *models.Job) bool {
+	return job.GPUArchitecture != "" || job.MinComputeCapability > 0
+}
+
+// gpuCompatible reports whether a GPU can run the job's code: it must be at least the
+// job's minimum compute capability and of the requested architecture. A CUDA target
+// such as "sm_86" needs the same major compute capability and at least its minor one.
+func gpuCompatible(job *models.Job, gpu clients.GPUDetail) bool {
+	capability := parseComputeCapability(gpu.ComputeCapability)
+	if job.MinComputeCapability > 0 && capability < job.MinComputeCapability {
+		return false
+	}
+
+	required := strings.ToLower(strings.TrimSpace(job.GPUArchitecture))
+	if required == "" {
+		return true
+	}
+	if target, ok := strings.CutPrefix(required, "sm_"); ok {
+		want, err := strconv.Atoi(target)
+		if err != nil || capability == 0 {
+			return false
+		}
+		return int(capability) == want/10 && capability >= float64(want)/10
+	}
+	return strings.EqualFold(gpuArchitecture(gpu), required)
+}
+
+// compatibleGPUCount counts the provider's healthy GPUs the job can run on
+func compatibleGPUCount(job *models.Job, provider *clients.Provider) int {
+	count := 0
+	for _, gpu := range provider.GPUs {
+		if gpu.IsHealthy && gpuCompatible(job, gpu) {
+			count++
+		}
+	}
+	return count
+}
+
+// anyCompatibleProvider reports whether any provider, busy or not, has enough GPUs the
+// job can run on. If none does, waiting for one to free up won't help.
+func anyCompatibleProvider(job *models.Job, providers []clients.Provider) bool {
+	needed := job.GPUCount
+	if needed < 1 {
+		needed = 1
+	}
+	for i := range providers {
+		if compatibleGPUCount(job, &providers[i]) >= needed {
+			return true
+		}
+	}
+	return false
+}
+
+// describeGPURequirement describes a job's architecture requirements for errors
+func describeGPURequirement(job *models.Job) string {
+	var parts []string
+	if job.GPUArchitecture != "" {
+		parts = append(parts, fmt.Sprintf("%s architecture", job.GPUArchitecture))
+	}
+	if job.MinComputeCapability > 0 {
+		parts = append(parts, fmt.Sprintf("compute capability %.1f or newer", job.MinComputeCapability))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// gpuArchitecture returns a GPU's architecture, derived from its compute capability
+// when the provider daemon didn't report one
+func gpuArchitecture(gpu clients.GPUDetail) string {
+	if gpu.Architecture != "" {
+		return gpu.Architecture
+	}
+
+	capability := parseComputeCapability(gpu.ComputeCapability)
+	switch {
+	case capability >= 10:
+		return "Blackwell"
+	case capability >= 9:
+		return "Hopper"
+	case capability >= 8.9:
+		return "Ada Lovelace"
+	case capability >= 8:
+		return "Ampere"
+	case capability >= 7.5:
+		return "Turing"
+	case capability >= 7:
+		return "Volta"
+	case capability >= 6:
+		return "Pascal"
+	}
+	return ""
+}
+
+// parseComputeCapability parses a compute capability such as "8.6", returning 0 if unknown
+func parseComputeCapability(capability string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(capability), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
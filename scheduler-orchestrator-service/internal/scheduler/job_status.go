@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// taskStatusStates maps the task statuses providers report to the job states I record.
+// Statuses not listed, such as progress updates, don't change the job's state.
+var taskStatusStates = map[string]models.SchedulerJobState{
+	"running":     models.JobStateRunning,
+	"in_progress": models.JobStateRunning,
+	"completed":   models.JobStateCompleted,
+	"failed":      models.JobStateFailed,
+	"timeout":     models.JobStateFailed,
+	"canceled":    models.JobStateCancelled,
+	"cancelled":   models.JobStateCancelled,
+}
+
+// taskStatusUpdate holds the fields of a provider's task status update that I record.
+type taskStatusUpdate struct {
+	JobID      string `json:"job_id"`
+	ProviderID string `json:"provider_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// isTerminalJobState reports whether a job in the state has finished for good.
+func isTerminalJobState(state models.SchedulerJobState) bool {
+	return state == models.JobStateCompleted || state == models.JobStateFailed || state == models.JobStateCancelled
+}
+
+// handleTaskStatus records the state a provider reports for a dispatched job, so the job
+// store knows when a job starts running and when it ends. Finished jobs are never moved
+// back, since updates may arrive out of order.
+func (jc *JobConsumer) handleTaskStatus(msg *nats.Msg) {
+	var update taskStatusUpdate
+	if err := json.Unmarshal(msg.Data, &update); err != nil {
+		jc.logger.Warn("Invalid task status update", zap.String("subject", msg.Subject), zap.Error(err))
+		return
+	}
+	if update.JobID == "" {
+		update.JobID = msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+	}
+	newState, ok := taskStatusStates[update.Status]
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	record, err := jc.jobStore.GetJob(ctx, update.JobID)
+	if err != nil {
+		jc.logger.Error("Failed to load job for task status update", zap.String("job_id", update.JobID), zap.Error(err))
+		return
+	}
+	if record == nil || record.State == newState || isTerminalJobState(record.State) {
+		return
+	}
+
+	providerID := record.ProviderID
+	if providerID == "" {
+		providerID = update.ProviderID
+	}
+	lastError := record.LastError
+	if newState == models.JobStateFailed {
+		lastError = update.Error
+		if lastError == "" {
+			lastError = update.Message
+		}
+	}
+	if err := jc.jobStore.UpdateJobState(ctx, update.JobID, newState, providerID, lastError, record.Attempts); err != nil {
+		jc.logger.Error("Failed to record task status update", zap.String("job_id", update.JobID), zap.Error(err))
+		return
+	}
+	jc.logger.Info("Recorded job state reported by provider",
+		zap.String("job_id", update.JobID),
+		zap.String("provider_id", providerID),
+		zap.String("state", string(newState)))
+}
+
+// UserActiveJobsRequest asks how many of a user's jobs haven't finished. JobIDs are
+// jobs the API gateway submitted recently, which may still be waiting in the job stream.
+type UserActiveJobsRequest struct {
+	UserID string   `json:"user_id"`
+	JobIDs []string `json:"job_ids,omitempty"`
+}
+
+// UserActiveJobs is the reply to a user active jobs request. KnownJobIDs are the
+// requested jobs that are already recorded, and so counted in ActiveJobs if unfinished.
+type UserActiveJobs struct {
+	UserID      string   `json:"user_id"`
+	ActiveJobs  int      `json:"active_jobs"`
+	KnownJobIDs []string `json:"known_job_ids,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// handleUserActiveJobs answers with the number of the user's jobs that are queued,
+// being placed or running, and which of the requested jobs are recorded. The API
+// gateway checks it against the user's concurrent job limit.
+func (jc *JobConsumer) handleUserActiveJobs(msg *nats.Msg) {
+	var req UserActiveJobsRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.UserID == "" {
+		jc.respondUserActiveJobs(msg, &UserActiveJobs{Error: "invalid active jobs request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Looking the jobs up before counting can count a job recorded in between twice,
+	// but never miss it
+	reply := &UserActiveJobs{UserID: req.UserID}
+	for _, jobID := range req.JobIDs {
+		record, err := jc.jobStore.GetJob(ctx, jobID)
+		if err != nil {
+			reply.Error = err.Error()
+			jc.respondUserActiveJobs(msg, reply)
+			return
+		}
+		if record != nil && record.UserID == req.UserID {
+			reply.KnownJobIDs = append(reply.KnownJobIDs, jobID)
+		}
+	}
+	count, err := jc.jobStore.CountActiveJobsByUser(ctx, req.UserID)
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	reply.ActiveJobs = count
+	jc.respondUserActiveJobs(msg, reply)
+}
+
+func (jc *JobConsumer) respondUserActiveJobs(msg *nats.Msg, reply *UserActiveJobs) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		jc.logger.Error("Failed to marshal active jobs reply", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		jc.logger.Error("Failed to send active jobs reply", zap.String("user_id", reply.UserID), zap.Error(err))
+	}
+}
@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// queueRunTimeSampleSize is how many recently completed jobs the average run time is taken over
+const queueRunTimeSampleSize = 50
+
+// QueueStatusRequest asks for the live queue state of a job.
+type QueueStatusRequest struct {
+	JobID string `json:"job_id"`
+}
+
+// QueueStatus is the reply to a queue status request. QueuePosition, EstimatedStart and
+// WaitingSeconds are only set while the job is still waiting for a provider, and
+// MaxWaitSeconds once no provider has been found for it. Reason says why a job is
+// waiting for a provider or has failed.
+type QueueStatus struct {
+	JobID              string     `json:"job_id"`
+	UserID             string     `json:"user_id,omitempty"`
+	Found              bool       `json:"found"`
+	State              string     `json:"state,omitempty"`
+	ProviderID         string     `json:"provider_id,omitempty"`
+	QueuePosition      int        `json:"queue_position,omitempty"`
+	EstimatedStart     *time.Time `json:"estimated_start,omitempty"`
+	AvailableProviders int        `json:"available_providers"`
+	AverageRunSeconds  float64    `json:"average_run_seconds,omitempty"`
+	WaitingSeconds     float64    `json:"waiting_seconds,omitempty"`
+	MaxWaitSeconds     float64    `json:"max_wait_seconds,omitempty"`
+	Reason             string     `json:"reason,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
+// handleQueueStatus answers with a job's current state and, while it waits for a provider,
+// its position in the queue and an estimated start time. Both are computed on every request.
+func (jc *JobConsumer) handleQueueStatus(msg *nats.Msg) {
+	var req QueueStatusRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.JobID == "" {
+		jc.respondQueueStatus(msg, &QueueStatus{Error: "invalid queue status request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status := &QueueStatus{JobID: req.JobID}
+	record, err := jc.jobStore.GetJob(ctx, req.JobID)
+	if err != nil {
+		status.Error = err.Error()
+		jc.respondQueueStatus(msg, status)
+		return
+	}
+	if record == nil {
+		jc.respondQueueStatus(msg, status)
+		return
+	}
+	status.Found = true
+	status.UserID = record.UserID
+	status.State = string(record.State)
+	status.ProviderID = record.ProviderID
+	if record.State == models.JobStateNoProviderAvailable || record.State == models.JobStateFailed {
+		status.Reason = record.LastError
+	}
+
+	if !isWaitingJobState(record.State) {
+		jc.respondQueueStatus(msg, status)
+		return
+	}
+	status.WaitingSeconds = time.Since(record.ReceivedAt).Seconds()
+	if record.State == models.JobStateNoProviderAvailable {
+		status.MaxWaitSeconds = jc.maxQueueWait().Seconds()
+	}
+
+	status.QueuePosition, err = jc.jobStore.GetQueuePosition(ctx, req.JobID)
+	if err != nil {
+		status.Error = err.Error()
+		jc.respondQueueStatus(msg, status)
+		return
+	}
+
+	avgRunTime, ok, err := jc.jobStore.GetAverageRunDuration(ctx, queueRunTimeSampleSize)
+	if err != nil {
+		jc.logger.Warn("Failed to load average run time, using the default", zap.String("job_id", req.JobID), zap.Error(err))
+	}
+	if !ok {
+		avgRunTime = jc.cfg.QueueDefaultRunTime
+	}
+	status.AverageRunSeconds = avgRunTime.Seconds()
+
+	providers, err := jc.prClient.ListAvailableProviders()
+	if err != nil {
+		// Without the registry I still estimate, as if one provider will free up
+		jc.logger.Warn("Failed to list providers for queue status", zap.String("job_id", req.JobID), zap.Error(err))
+	} else {
+		job := models.Job(record.JobDetails)
+		status.AvailableProviders = len(jc.filterCandidates(&job, providers))
+	}
+
+	if status.QueuePosition > 0 {
+		estimatedStart := estimateStart(status.QueuePosition, status.AvailableProviders, avgRunTime, time.Now().UTC())
+		status.EstimatedStart = &estimatedStart
+	}
+	jc.respondQueueStatus(msg, status)
+}
+
+// estimateStart estimates when the job at the given queue position starts. The first
+// available providers take the head of the queue straight away; every later group of the
+// same size waits one average run for providers to free up. With no provider available,
+// the queue is assumed to drain through a single one.
+func estimateStart(position, availableProviders int, avgRunTime time.Duration, now time.Time) time.Time {
+	if position <= availableProviders {
+		return now
+	}
+	slots := availableProviders
+	if slots < 1 {
+		slots = 1
+		position++ // The job at the head also has to wait for a provider
+	}
+	waves := (position - 1) / slots
+	return now.Add(time.Duration(waves) * avgRunTime)
+}
+
+func (jc *JobConsumer) respondQueueStatus(msg *nats.Msg, status *QueueStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		jc.logger.Error("Failed to marshal queue status reply", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		jc.logger.Error("Failed to send queue status reply", zap.String("job_id", status.JobID), zap.Error(err))
+	}
+}
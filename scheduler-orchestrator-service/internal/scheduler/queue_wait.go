@@ -0,0 +1,181 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/billing"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// waitingJobStates are the states of a job still waiting for a provider. A job in one of
+// them can be cancelled.
+var waitingJobStates = []models.SchedulerJobState{
+	models.JobStatePending, models.JobStateSearching, models.JobStateNoProviderAvailable,
+}
+
+// unplacedJobStates are the states of a job that hasn't been handed to a provider: it is
+// waiting, or being placed. Jobs left assigning by a scheduler that stopped mid-placement
+// are placed again.
+var unplacedJobStates = append([]models.SchedulerJobState{models.JobStateAssigning}, waitingJobStates...)
+
+// errJobNotWaiting is returned when a job stopped waiting for a provider, because it was
+// cancelled, while it was being placed
+var errJobNotWaiting = errors.New("job is no longer waiting for a provider")
+
+// isWaitingJobState reports whether a job in the state is still waiting for a provider.
+func isWaitingJobState(state models.SchedulerJobState) bool {
+	for _, waiting := range waitingJobStates {
+		if state == waiting {
+			return true
+		}
+	}
+	return false
+}
+
+// maxQueueWait returns how long a job may wait for a provider before it fails.
+func (jc *JobConsumer) maxQueueWait() time.Duration {
+	return time.Duration(jc.cfg.MaxQueueWaitMinutes) * time.Minute
+}
+
+// expireQueueWait fails a job no provider could take if it has waited longer than the
+// configured maximum since the scheduler received it. It reports whether the job failed.
+func (jc *JobConsumer) expireQueueWait(internalJob *models.InternalJobRepresentation, now time.Time) bool {
+	waited := now.Sub(internalJob.ReceivedAt)
+	if waited < jc.maxQueueWait() {
+		return false
+	}
+	reason := internalJob.LastError
+	if reason == "" {
+		reason = "No suitable provider found"
+	}
+	internalJob.State = models.JobStateFailed
+	internalJob.LastError = fmt.Sprintf("No provider became available within %d minutes: %s", jc.cfg.MaxQueueWaitMinutes, reason)
+	return true
+}
+
+// retryPlacement returns a job no provider could take to the queue, to be placed again
+// after the retry interval. JetStream stops redelivering a message after
+// NatsJobMaxDeliver deliveries, so on the last one the job is published to the stream
+// again instead, to keep waiting until the queue wait runs out.
+func (jc *JobConsumer) retryPlacement(msg *nats.Msg, jobID string) {
+	meta, err := msg.Metadata()
+	if err != nil || jc.cfg.NatsJobMaxDeliver <= 0 || int(meta.NumDelivered) < jc.cfg.NatsJobMaxDeliver {
+		if nakErr := msg.NakWithDelay(jc.cfg.NoProviderRetryInterval); nakErr != nil {
+			jc.logger.Error("Failed to NAK message for job with no suitable providers", zap.String("job_id", jobID), zap.Error(nakErr))
+			_ = msg.Ack()
+		}
+		return
+	}
+
+	// The message ID keeps the stream's duplicate window from dropping the requeued job
+	requeue := &nats.Msg{Subject: msg.Subject, Data: msg.Data, Header: nats.Header{}}
+	requeue.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-requeue-%d", jobID, meta.Sequence.Stream))
+	if _, err := jc.js.PublishMsg(requeue); err != nil {
+		jc.logger.Error("Failed to requeue job waiting for a provider", zap.String("job_id", jobID), zap.Error(err))
+		_ = msg.NakWithDelay(jc.cfg.NoProviderRetryInterval)
+		return
+	}
+	if ackErr := msg.Ack(); ackErr != nil {
+		jc.logger.Error("Failed to ACK message of requeued job", zap.String("job_id", jobID), zap.Error(ackErr))
+	}
+	jc.logger.Info("Requeued job waiting for a provider after its last delivery",
+		zap.String("job_id", jobID),
+		zap.Uint64("delivery", meta.NumDelivered))
+}
+
+// releaseUnplacedJob gives back what was held for a job that ended before it was placed:
+// the funds reserved for it at submission are released, and clients following the job's
+// status are told it ended, with the given status and message.
+func (jc *JobConsumer) releaseUnplacedJob(internalJob *models.InternalJobRepresentation, status, message string) {
+	job := internalJob.JobDetails
+	if jc.billingClient != nil && job.ReservedFunds.IsPositive() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := jc.billingClient.ReleaseFunds(ctx, job.UserID, job.ReservedFunds, job.ID); err != nil {
+			jc.logger.Error("Failed to release funds of job that ended before it was placed",
+				zap.String("job_id", job.ID),
+				zap.String("amount", job.ReservedFunds.String()),
+				zap.Error(err))
+		}
+	}
+
+	update, err := json.Marshal(taskStatusUpdate{
+		JobID:   job.ID,
+		Status:  status,
+		Error:   internalJob.LastError,
+		Message: message,
+	})
+	if err != nil {
+		jc.logger.Error("Failed to marshal status update for unplaced job", zap.String("job_id", job.ID), zap.Error(err))
+		return
+	}
+	subject := jc.cfg.NatsTaskStatusSubjectPrefix + "." + job.ID
+	if err := jc.publish(subject, update); err != nil {
+		jc.logger.Warn("Failed to publish status update for unplaced job", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// endPlacementSession ends the billing session started for a job that then couldn't be
+// handed to its provider. Ending it releases the funds it locked.
+func (jc *JobConsumer) endPlacementSession(jobID string, sessionID *uuid.UUID) {
+	if sessionID == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := jc.billingClient.EndSession(ctx, &billing.SessionEndRequest{SessionID: *sessionID, Reason: "job could not be dispatched"}); err != nil {
+		jc.logger.Error("Failed to end billing session of job that could not be dispatched",
+			zap.String("job_id", jobID),
+			zap.String("session_id", sessionID.String()),
+			zap.Error(err))
+	}
+}
+
+// handleTaskCancel cancels a job the API gateway was asked to cancel, if it is still
+// waiting for a provider, and releases its reservation. Jobs already placed are
+// cancelled by their provider, which gets the same message.
+func (jc *JobConsumer) handleTaskCancel(msg *nats.Msg) {
+	var req struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.JobID == "" {
+		req.JobID = msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	record, err := jc.jobStore.GetJob(ctx, req.JobID)
+	if err != nil {
+		jc.logger.Error("Failed to load job to cancel", zap.String("job_id", req.JobID), zap.Error(err))
+		return
+	}
+	if record == nil || !isWaitingJobState(record.State) {
+		return
+	}
+
+	// Only one of this and a placement of the job can move it out of waiting
+	const reason = "Cancelled before it was placed"
+	cancelled, err := jc.jobStore.UpdateJobStateFrom(ctx, req.JobID, waitingJobStates, models.JobStateCancelled, "", reason, record.Attempts)
+	if err != nil {
+		jc.logger.Error("Failed to cancel waiting job", zap.String("job_id", req.JobID), zap.Error(err))
+		return
+	}
+	if !cancelled {
+		return
+	}
+
+	internalJob := record.ToInternalJobRepresentation()
+	internalJob.State = models.JobStateCancelled
+	internalJob.LastError = reason
+	jc.releaseUnplacedJob(internalJob, "cancelled", "Job cancelled before it was placed")
+	jc.logger.Info("Cancelled job waiting for a provider", zap.String("job_id", req.JobID))
+}
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+)
+
+func TestJobSchedulesWhenProviderAppears(t *testing.T) {
+	tc := newTestConsumer(t)
+	job := reservedJob(5)
+
+	// No provider yet: the job keeps waiting through its redeliveries
+	for delivery := 1; delivery <= 3; delivery++ {
+		tc.submit(t, job)
+		if state := tc.store.state(t, job.ID); state != models.JobStateNoProviderAvailable {
+			t.Fatalf("delivery %d: job state = %s, want %s", delivery, state, models.JobStateNoProviderAvailable)
+		}
+	}
+	if n := len(tc.dispatched()); n != 0 {
+		t.Fatalf("dispatched %d tasks without a provider", n)
+	}
+
+	// A provider comes online a few minutes in, within the queue wait
+	record, _ := tc.store.GetJob(context.Background(), job.ID)
+	record.ReceivedAt = time.Now().Add(-5 * time.Minute)
+	tc.store.SaveJob(context.Background(), record)
+	provider := idleProvider()
+	tc.registry.setProviders(provider)
+	tc.submit(t, job)
+
+	if state := tc.store.state(t, job.ID); state != models.JobStateDispatched {
+		t.Fatalf("job state = %s after a provider appeared, want dispatched", state)
+	}
+	record, _ = tc.store.GetJob(context.Background(), job.ID)
+	if record.ProviderID != provider.ID.String() {
+		t.Errorf("job placed on %q, want the new provider %s", record.ProviderID, provider.ID)
+	}
+	tasks := tc.dispatched()
+	if len(tasks) != 1 || !strings.Contains(tasks[0].subject, provider.ID.String()) {
+		t.Errorf("dispatched %v, want one task to the new provider", tasks)
+	}
+	if _, _, releases, _ := tc.billing.counts(); releases != 0 {
+		t.Errorf("released the reservation %d times while the job waited", releases)
+	}
+}
+
+func TestExpireQueueWait(t *testing.T) {
+	tc := newTestConsumer(t)
+	received := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		waited  time.Duration
+		expired bool
+	}{
+		{0, false},
+		{10*time.Minute - time.Second, false},
+		{10 * time.Minute, true},
+		{time.Hour, true},
+	}
+	for _, tt := range tests {
+		job := &models.InternalJobRepresentation{
+			ReceivedAt: received,
+			State:      models.JobStateNoProviderAvailable,
+			LastError:  "no GPU with 80 GB",
+		}
+		if got := tc.expireQueueWait(job, received.Add(tt.waited)); got != tt.expired {
+			t.Errorf("waited %v: expired = %v, want %v", tt.waited, got, tt.expired)
+			continue
+		}
+		if tt.expired && (job.State != models.JobStateFailed || !strings.Contains(job.LastError, "no GPU with 80 GB")) {
+			t.Errorf("waited %v: state %s with %q, want failed keeping the reason", tt.waited, job.State, job.LastError)
+		}
+	}
+}
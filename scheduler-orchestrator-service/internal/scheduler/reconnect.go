@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// Healthy reports whether the consumer is connected to NATS and subscribed to all of
+// its subjects.
+func (jc *JobConsumer) Healthy() bool {
+	if !jc.healthy.Load() || jc.nc.Status() != nats.CONNECTED {
+		return false
+	}
+	jc.subMu.Lock()
+	defer jc.subMu.Unlock()
+	if !subscriptionValid(jc.subscription) || !subscriptionValid(jc.dryRunSub) ||
+		!subscriptionValid(jc.queueSub) || !subscriptionValid(jc.userJobsSub) || !subscriptionValid(jc.cancelSub) ||
+		len(jc.statusSubs) == 0 {
+		return false
+	}
+	for _, sub := range jc.statusSubs {
+		if !subscriptionValid(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchConnection logs the consumer's NATS connection transitions and restores the
+// subscriptions whenever the connection comes back, until the consumer is stopped.
+func (jc *JobConsumer) watchConnection() {
+	statusCh := jc.nc.StatusChanged(nats.CONNECTED, nats.DISCONNECTED, nats.RECONNECTING, nats.CLOSED)
+	defer jc.nc.RemoveStatusListener(statusCh)
+
+	for {
+		select {
+		case <-jc.shutdownChan:
+			return
+		case status, ok := <-statusCh:
+			if !ok {
+				return
+			}
+			switch status {
+			case nats.CONNECTED:
+				jc.logger.Info("JobConsumer: NATS connection restored, resubscribing", zap.String("url", jc.nc.ConnectedUrl()))
+				go jc.resubscribe()
+			case nats.CLOSED:
+				jc.healthy.Store(false)
+				jc.logger.Error("JobConsumer: NATS connection closed, job processing has stopped")
+				return
+			default:
+				jc.healthy.Store(false)
+				jc.logger.Warn("JobConsumer: NATS connection lost, job processing paused", zap.String("status", status.String()))
+			}
+		}
+	}
+}
+
+// resubscribe restores the consumer's subscriptions, retrying with exponential backoff
+// until it succeeds. Subscriptions that survived the reconnect are kept. It reports
+// false if the consumer was stopped or the connection closed for good first.
+func (jc *JobConsumer) resubscribe() bool {
+	jc.resubMu.Lock()
+	defer jc.resubMu.Unlock()
+
+	backoff := jc.cfg.NatsResubscribeBackoff
+	for attempt := 1; ; attempt++ {
+		if jc.nc.IsClosed() {
+			return false
+		}
+		if jc.nc.Status() == nats.CONNECTED {
+			err := jc.subscribe()
+			if err == nil {
+				if !jc.healthy.Swap(true) {
+					jc.logger.Info("JobConsumer resubscribed to job subjects", zap.Int("attempt", attempt))
+				}
+				return true
+			}
+			jc.logger.Warn("JobConsumer failed to resubscribe, retrying",
+				zap.Int("attempt", attempt),
+				zap.Duration("backoff", backoff),
+				zap.Error(err))
+		}
+
+		select {
+		case <-jc.shutdownChan:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > jc.cfg.NatsResubscribeMaxBackoff {
+			backoff = jc.cfg.NatsResubscribeMaxBackoff
+		}
+	}
+}
+
+// pullSubscription returns the current JetStream job subscription
+func (jc *JobConsumer) pullSubscription() *nats.Subscription {
+	jc.subMu.Lock()
+	defer jc.subMu.Unlock()
+	return jc.subscription
+}
+
+// dropPullSubscription discards a job subscription whose durable consumer no longer
+// exists, so the next resubscription creates it again
+func (jc *JobConsumer) dropPullSubscription(sub *nats.Subscription) {
+	jc.subMu.Lock()
+	defer jc.subMu.Unlock()
+	if jc.subscription != sub {
+		return
+	}
+	jc.healthy.Store(false)
+	if err := sub.Unsubscribe(); err != nil {
+		jc.logger.Debug("Error unsubscribing stale JetStream subscription", zap.Error(err))
+	}
+	jc.subscription = nil
+}
+
+func subscriptionValid(sub *nats.Subscription) bool {
+	return sub != nil && sub.IsValid()
+}
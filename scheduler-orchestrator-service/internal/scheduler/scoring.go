@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/config"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+)
+
+const (
+	// SchedulingStrategyWeightedScore places a job on the highest scoring provider.
+	SchedulingStrategyWeightedScore = "weighted-score"
+	// SchedulingStrategyFirstFit places a job on the first provider that satisfies its requirements.
+	SchedulingStrategyFirstFit = "first-fit"
+
+	// neutralScore is used for a factor when there is no data to judge the provider by,
+	// so that new providers are neither favoured nor penalised.
+	neutralScore = 0.5
+
+	// scoreEpsilon is the difference below which two scores are considered tied.
+	scoreEpsilon = 1e-9
+)
+
+// ProviderScorer ranks providers for placement using a weighted sum of price,
+// location match, historical success rate, current free capacity and benchmarked performance.
+type ProviderScorer struct {
+	weights         config.SchedulingWeights
+	maxPricePerHour float64
+	stats           map[string]models.ProviderJobStats // Keyed by provider ID
+
+	bestPerformance float64 // Highest benchmarked performance among the candidates being ranked
+}
+
+// NewProviderScorer creates a scorer from the scheduling configuration and a snapshot
+// of per-provider job outcomes. stats may be nil if no history is available.
+func NewProviderScorer(weights config.SchedulingWeights, maxPricePerHour float64, stats map[string]models.ProviderJobStats) *ProviderScorer {
+	return &ProviderScorer{
+		weights:         weights,
+		maxPricePerHour: maxPricePerHour,
+		stats:           stats,
+	}
+}
+
+// ScoreProvider returns the provider's placement score for the job, between 0 and 1.
+// Higher is better. Each factor is scored between 0 and 1 and combined using the configured weights.
+func (s *ProviderScorer) ScoreProvider(job *models.Job, provider *clients.Provider) float64 {
+	totalWeight := s.weights.Price + s.weights.Location + s.weights.SuccessRate + s.weights.Capacity + s.weights.Performance
+	if totalWeight <= 0 {
+		return 0
+	}
+
+	score := s.weights.Price*s.priceScore(provider) +
+		s.weights.Location*locationScore(job.PreferredLocation, provider.Location) +
+		s.weights.SuccessRate*s.successRateScore(provider) +
+		s.weights.Capacity*capacityScore(provider) +
+		s.weights.Performance*s.performanceScore(provider)
+
+	return score / totalWeight
+}
+
+// SelectBest returns the highest scoring provider, or nil if there are no candidates.
+// Ties go to the cheaper provider and then to the lower provider ID, so that placement
+// is deterministic for identical inputs.
+func (s *ProviderScorer) SelectBest(job *models.Job, candidates []clients.Provider) (*clients.Provider, float64) {
+	var best *clients.Provider
+	bestScore := math.Inf(-1)
+
+	s.bestPerformance = 0
+	for i := range candidates {
+		if performance, ok := benchmarkedPerformance(&candidates[i]); ok && performance > s.bestPerformance {
+			s.bestPerformance = performance
+		}
+	}
+
+	for i := range candidates {
+		candidate := &candidates[i]
+		score := s.ScoreProvider(job, candidate)
+
+		switch {
+		case best == nil || score > bestScore+scoreEpsilon:
+			best, bestScore = candidate, score
+		case score >= bestScore-scoreEpsilon && preferOnTie(candidate, best):
+			best, bestScore = candidate, score
+		}
+	}
+
+	return best, bestScore
+}
+
+// preferOnTie reports whether a should win over b when both have the same score.
+func preferOnTie(a, b *clients.Provider) bool {
+	priceA, priceB := effectivePrice(a), effectivePrice(b)
+	if priceA != priceB {
+		return priceA < priceB
+	}
+	return a.ID.String() < b.ID.String()
+}
+
+// effectivePrice returns the provider's hourly price, treating an unknown price as the most expensive.
+func effectivePrice(p *clients.Provider) float64 {
+	if price, ok := providerPricePerHour(p); ok {
+		return price
+	}
+	return math.Inf(1)
+}
+
+// priceScore scales the provider's hourly price linearly from 1 (free) to 0 (at or above the configured maximum).
+func (s *ProviderScorer) priceScore(p *clients.Provider) float64 {
+	price, ok := providerPricePerHour(p)
+	if !ok || s.maxPricePerHour <= 0 {
+		return neutralScore
+	}
+	return clamp01(1 - price/s.maxPricePerHour)
+}
+
+// successRateScore is the share of the provider's finished jobs that completed.
+func (s *ProviderScorer) successRateScore(p *clients.Provider) float64 {
+	rate, ok := s.stats[p.ID.String()].SuccessRate()
+	if !ok {
+		return neutralScore
+	}
+	return rate
+}
+
+// locationScore is 1 for an exact match, 0.5 when only the region prefix matches
+// (e.g. "us" and "us-east-1") and 0 otherwise. Jobs without a preference score 1 everywhere.
+func locationScore(preferred, location string) float64 {
+	preferred = strings.ToLower(strings.TrimSpace(preferred))
+	location = strings.ToLower(strings.TrimSpace(location))
+
+	if preferred == "" {
+		return 1
+	}
+	if location == "" {
+		return 0
+	}
+	if preferred == location {
+		return 1
+	}
+	if regionPrefix(preferred) == regionPrefix(location) {
+		return 0.5
+	}
+	return 0
+}
+
+// regionPrefix returns the leading segment of a location such as "us-east-1".
+func regionPrefix(location string) string {
+	if i := strings.IndexAny(location, "-_/ "); i > 0 {
+		return location[:i]
+	}
+	return location
+}
+
+// capacityScore is the average free utilisation across the provider's healthy GPUs.
+func capacityScore(p *clients.Provider) float64 {
+	var free float64
+	var healthy int
+	for _, gpu := range p.GPUs {
+		if !gpu.IsHealthy {
+			continue
+		}
+		free += float64(100-min(gpu.UtilizationGPU, 100)) / 100
+		healthy++
+	}
+	if healthy == 0 {
+		return 0
+	}
+	return free / float64(healthy)
+}
+
+// performanceScore is the provider's benchmarked performance relative to the best
+// candidate. Once any candidate has been benchmarked, providers that haven't score 0,
+// so an unknown GPU never outranks a measured one however slow; when none has, all
+// score neutral.
+func (s *ProviderScorer) performanceScore(p *clients.Provider) float64 {
+	if s.bestPerformance <= 0 {
+		return neutralScore
+	}
+	performance, ok := benchmarkedPerformance(p)
+	if !ok {
+		return 0
+	}
+	return clamp01(performance / s.bestPerformance)
+}
+
+// benchmarkedPerformance is the provider's best FP16 throughput among its healthy GPUs,
+// discounted by how stable the GPU was during the benchmark.
+func benchmarkedPerformance(p *clients.Provider) (float64, bool) {
+	var best float64
+	found := false
+	for _, gpu := range p.GPUs {
+		if !gpu.IsHealthy || gpu.Benchmark == nil || gpu.Benchmark.FP16TFLOPS <= 0 {
+			continue
+		}
+		if performance := gpu.Benchmark.FP16TFLOPS * clamp01(gpu.Benchmark.StabilityScore); !found || performance > best {
+			best, found = performance, true
+		}
+	}
+	return best, found
+}
+
+// providerPricePerHour reads the provider's advertised minimum hourly price from its
+// metadata, where it may be stored as a JSON number or as a decimal string.
+func providerPricePerHour(p *clients.Provider) (float64, bool) {
+	switch v := p.Metadata["min_price_per_hour"].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// allowedByPreferences applies the job's preferred and excluded provider lists as hard filters.
+func allowedByPreferences(job *models.Job, provider *clients.Provider) bool {
+	id := provider.ID.String()
+	for _, excluded := range job.ExcludedProviders {
+		if strings.EqualFold(excluded, id) {
+			return false
+		}
+	}
+	if len(job.PreferredProviders) == 0 {
+		return true
+	}
+	for _, preferred := range job.PreferredProviders {
+		if strings.EqualFold(preferred, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
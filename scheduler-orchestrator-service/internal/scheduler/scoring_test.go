@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/clients"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/config"
+	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// pricedProvider returns an idle provider with the given ID and hourly price; a
+// negative price leaves it unpriced
+func pricedProvider(id string, price float64) clients.Provider {
+	p := idleProvider()
+	p.ID = uuid.MustParse(id)
+	p.Metadata = map[string]interface{}{}
+	if price >= 0 {
+		p.Metadata["min_price_per_hour"] = price
+	}
+	return p
+}
+
+// reversed returns the providers in the opposite order
+func reversed(providers []clients.Provider) []clients.Provider {
+	out := make([]clients.Provider, len(providers))
+	for i, p := range providers {
+		out[len(providers)-1-i] = p
+	}
+	return out
+}
+
+func TestSelectBestTieBreaks(t *testing.T) {
+	// Weighting only capacity makes every idle provider score the same
+	capacityOnly := config.SchedulingWeights{Capacity: 1}
+	const (
+		idA = "00000000-0000-0000-0000-00000000000a"
+		idB = "00000000-0000-0000-0000-00000000000b"
+		idC = "00000000-0000-0000-0000-00000000000c"
+	)
+
+	tests := []struct {
+		name       string
+		candidates []clients.Provider
+		want       string
+	}{
+		{"cheaper wins", []clients.Provider{pricedProvider(idA, 2), pricedProvider(idB, 1), pricedProvider(idC, 3)}, idB},
+		{"same price goes to the lower ID", []clients.Provider{pricedProvider(idC, 1), pricedProvider(idA, 1), pricedProvider(idB, 1)}, idA},
+		{"unknown price loses to any price", []clients.Provider{pricedProvider(idA, -1), pricedProvider(idB, 50)}, idB},
+		{"unpriced go to the lower ID", []clients.Provider{pricedProvider(idB, -1), pricedProvider(idA, -1)}, idA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := NewProviderScorer(capacityOnly, 10, nil)
+			for _, candidates := range [][]clients.Provider{tt.candidates, reversed(tt.candidates)} {
+				best, _ := scorer.SelectBest(&models.Job{}, candidates)
+				if best == nil || best.ID.String() != tt.want {
+					t.Errorf("selected %v, want %s whatever the candidate order", best, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectBestHigherScoreBeatsTieBreak(t *testing.T) {
+	const cheap, reliable = "00000000-0000-0000-0000-00000000000a", "00000000-0000-0000-0000-00000000000b"
+	stats := map[string]models.ProviderJobStats{
+		cheap:    {Completed: 1, Failed: 9},
+		reliable: {Completed: 10},
+	}
+	scorer := NewProviderScorer(config.SchedulingWeights{SuccessRate: 1}, 10, stats)
+	best, score := scorer.SelectBest(&models.Job{}, []clients.Provider{pricedProvider(cheap, 1), pricedProvider(reliable, 5)})
+	if best == nil || best.ID.String() != reliable || score != 1 {
+		t.Errorf("selected %v with score %v, want the reliable provider at 1", best, score)
+	}
+}
+
+func TestSelectBestScoresWithinEpsilonTie(t *testing.T) {
+	const idA, idB = "00000000-0000-0000-0000-00000000000a", "00000000-0000-0000-0000-00000000000b"
+	// Utilisations that differ by float rounding only: 1/3 and 2/6 of a GPU free
+	a, b := pricedProvider(idA, 2), pricedProvider(idB, 1)
+	a.GPUs = []clients.GPUDetail{{IsHealthy: true, UtilizationGPU: 67}, {IsHealthy: true, UtilizationGPU: 67}, {IsHealthy: true, UtilizationGPU: 67}}
+	b.GPUs = []clients.GPUDetail{{IsHealthy: true, UtilizationGPU: 67}}
+	scorer := NewProviderScorer(config.SchedulingWeights{Capacity: 1}, 10, nil)
+	best, _ := scorer.SelectBest(&models.Job{}, []clients.Provider{a, b})
+	if best == nil || best.ID.String() != idB {
+		t.Errorf("selected %v, want the cheaper of two equally free providers", best)
+	}
+}
+
+// benchmarkedProvider returns a priced provider whose GPU measured tflops at full
+// stability; 0 leaves it unbenchmarked
+func benchmarkedProvider(id string, price, tflops float64) clients.Provider {
+	p := pricedProvider(id, price)
+	if tflops > 0 {
+		p.GPUs = []clients.GPUDetail{{ModelName: "RTX 4090", VRAM: 24576, IsHealthy: true,
+			Benchmark: &clients.GPUBenchmark{FP16TFLOPS: tflops, StabilityScore: 1}}}
+	}
+	return p
+}
+
+func TestSelectBestPerformance(t *testing.T) {
+	performanceOnly := config.SchedulingWeights{Performance: 1}
+	const (
+		idA = "00000000-0000-0000-0000-00000000000a"
+		idB = "00000000-0000-0000-0000-00000000000b"
+		idC = "00000000-0000-0000-0000-00000000000c"
+	)
+
+	tests := []struct {
+		name       string
+		candidates []clients.Provider
+		want       string
+		wantScore  float64
+	}{
+		{"fastest wins", []clients.Provider{benchmarkedProvider(idA, 1, 80), benchmarkedProvider(idB, 2, 160)}, idB, 1},
+		{"slow measured GPU beats an unknown one", []clients.Provider{benchmarkedProvider(idA, 1, 0), benchmarkedProvider(idB, 2, 5)}, idB, 1},
+		{"unknown ones rank below every measured one",
+			[]clients.Provider{benchmarkedProvider(idA, 1, 0), benchmarkedProvider(idB, 2, 4), benchmarkedProvider(idC, 3, 0)}, idB, 1},
+		{"none measured falls back to the tie break", []clients.Provider{benchmarkedProvider(idB, 2, 0), benchmarkedProvider(idA, 1, 0)}, idA, neutralScore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := NewProviderScorer(performanceOnly, 10, nil)
+			for _, candidates := range [][]clients.Provider{tt.candidates, reversed(tt.candidates)} {
+				best, score := scorer.SelectBest(&models.Job{}, candidates)
+				if best == nil || best.ID.String() != tt.want || score != tt.wantScore {
+					t.Errorf("selected %v with score %v, want %s at %v whatever the candidate order", best, score, tt.want, tt.wantScore)
+				}
+			}
+		})
+	}
+}
+
+func TestPerformanceScore(t *testing.T) {
+	const id = "00000000-0000-0000-0000-00000000000a"
+	scorer := NewProviderScorer(config.SchedulingWeights{Performance: 1}, 10, nil)
+	scorer.bestPerformance = 200
+
+	unstable := benchmarkedProvider(id, 1, 100)
+	unstable.GPUs[0].Benchmark.StabilityScore = 0.5
+	unhealthy := benchmarkedProvider(id, 1, 200)
+	unhealthy.GPUs[0].IsHealthy = false
+
+	tests := []struct {
+		name     string
+		provider clients.Provider
+		want     float64
+	}{
+		{"half the best", benchmarkedProvider(id, 1, 100), 0.5},
+		{"discounted for instability", unstable, 0.25},
+		{"unbenchmarked", benchmarkedProvider(id, 1, 0), 0},
+		{"only benchmarked on an unhealthy GPU", unhealthy, 0},
+	}
+	for _, tt := range tests {
+		if got := scorer.performanceScore(&tt.provider); got != tt.want {
+			t.Errorf("%s: performanceScore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelectProviderLoadsStatsForCandidatesOnly(t *testing.T) {
+	tc := newTestConsumer(t)
+	tc.cfg.SchedulingStrategy = SchedulingStrategyWeightedScore
+	tc.cfg.SchedulingWeights = config.SchedulingWeights{SuccessRate: 1}
+
+	candidates := []clients.Provider{idleProvider(), idleProvider()}
+	other := idleProvider()
+	for i, record := range []*models.JobRecord{
+		{JobID: "job-1", ProviderID: candidates[0].ID.String(), State: models.JobStateFailed},
+		{JobID: "job-2", ProviderID: candidates[1].ID.String(), State: models.JobStateCompleted},
+		{JobID: "job-3", ProviderID: other.ID.String(), State: models.JobStateCompleted},
+	} {
+		if err := tc.store.SaveJob(nil, record); err != nil {
+			t.Fatalf("job %d: %v", i, err)
+		}
+	}
+
+	best := tc.selectProvider(&models.Job{ID: "job-4"}, candidates)
+	if best == nil || best.ID != candidates[1].ID {
+		t.Errorf("selected %v, want the provider whose job completed", best)
+	}
+	if len(tc.store.statsRequests) != 1 {
+		t.Fatalf("loaded stats %d times, want once", len(tc.store.statsRequests))
+	}
+	requested := tc.store.statsRequests[0]
+	want := []string{candidates[0].ID.String(), candidates[1].ID.String()}
+	sort.Strings(requested)
+	sort.Strings(want)
+	if len(requested) != 2 || requested[0] != want[0] || requested[1] != want[1] {
+		t.Errorf("loaded stats for %v, want only the candidates %v", requested, want)
+	}
+}
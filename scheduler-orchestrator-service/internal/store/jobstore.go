@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/dante-gpu/dante-backend/scheduler-orchestrator-service/internal/models"
 )
@@ -19,6 +20,10 @@ type JobStore interface {
 	// It also updates the UpdatedAt timestamp.
 	UpdateJobState(ctx context.Context, jobID string, newState models.SchedulerJobState, providerID string, lastError string, attempts int) error
 
+	// UpdateJobStateFrom is UpdateJobState for a job that others may move on concurrently:
+	// it only applies if the job is in one of the from states, and reports whether it did.
+	UpdateJobStateFrom(ctx context.Context, jobID string, from []models.SchedulerJobState, newState models.SchedulerJobState, providerID string, lastError string, attempts int) (bool, error)
+
 	// GetJobsByState retrieves a list of jobs matching a specific state.
 	// This could be useful for re-processing pending jobs on startup or for monitoring.
 	GetJobsByState(ctx context.Context, state models.SchedulerJobState, limit int) ([]*models.JobRecord, error)
@@ -27,6 +32,22 @@ type JobStore interface {
 	// This is a more specific query that might be useful on startup.
 	GetRetryableJobs(ctx context.Context, limit int) ([]*models.JobRecord, error)
 
+	// GetProviderStats returns completed and failed job counts for the given providers.
+	// It feeds the reliability component of provider scoring, so it only reads the jobs
+	// of the candidates being ranked.
+	GetProviderStats(ctx context.Context, providerIDs []string) (map[string]models.ProviderJobStats, error)
+
+	// GetQueuePosition returns a job's 1-based position among the jobs still waiting for a
+	// provider, in the order the scheduler works through them. It is 0 if the job isn't waiting.
+	GetQueuePosition(ctx context.Context, jobID string) (int, error)
+
+	// CountActiveJobsByUser counts the user's jobs that haven't completed, failed or been cancelled.
+	CountActiveJobsByUser(ctx context.Context, userID string) (int, error)
+
+	// GetAverageRunDuration returns the mean run time of the most recently completed jobs.
+	// ok is false when no job has completed yet.
+	GetAverageRunDuration(ctx context.Context, sampleSize int) (avg time.Duration, ok bool, err error)
+
 	// DeleteJob removes a job from the store (e.g., after successful completion and archival, or for cleanup).
 	// This might be a less frequently used operation in the scheduler itself.
 	DeleteJob(ctx context.Context, jobID string) error
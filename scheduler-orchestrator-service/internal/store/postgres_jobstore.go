@@ -225,6 +225,35 @@ func (pjs *PostgresJobStore) UpdateJobState(ctx context.Context, jobID string, n
 	return nil
 }
 
+// UpdateJobStateFrom updates a job's state like UpdateJobState, but only if it is in one
+// of the from states, and reports whether it was.
+func (pjs *PostgresJobStore) UpdateJobStateFrom(ctx context.Context, jobID string, from []models.SchedulerJobState, newState models.SchedulerJobState, providerID string, lastError string, attempts int) (bool, error) {
+	sqlQuery := `
+	UPDATE jobs
+	SET state = $1, provider_id = $2, last_error = $3, attempts = $4, updated_at = $5
+	WHERE job_id = $6 AND state = ANY($7)
+	`
+	states := make([]string, len(from))
+	for i, state := range from {
+		states[i] = string(state)
+	}
+
+	cmdTag, err := pjs.db.Exec(ctx, sqlQuery,
+		newState,
+		sql.NullString{String: providerID, Valid: providerID != ""},
+		sql.NullString{String: lastError, Valid: lastError != ""},
+		attempts,
+		time.Now().UTC(),
+		jobID,
+		states,
+	)
+	if err != nil {
+		pjs.logger.Error("Failed to update job state in DB", zap.String("job_id", jobID), zap.Error(err))
+		return false, fmt.Errorf("updating job state for %s: %w", jobID, err)
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
 // scanJobRows is a helper function to scan multiple rows into a slice of JobRecord.
 func (pjs *PostgresJobStore) scanJobRows(rows pgx.Rows) ([]*models.JobRecord, error) {
 	var jobs []*models.JobRecord
@@ -313,7 +342,7 @@ func (pjs *PostgresJobStore) GetRetryableJobs(ctx context.Context, limit int) ([
 		last_error, received_at, updated_at, submitted_at, job_name, 
 		job_type, gpu_type_requested, priority
 	FROM jobs 
-	WHERE (state = $1 OR state = $2 OR (state = $3 AND attempts < $4)) 
+	WHERE (state = $1 OR state = $2 OR state = $6 OR (state = $3 AND attempts < $4)) 
 	-- AND updated_at > $5 -- Optional: only retry recently updated ones
 	ORDER BY priority DESC, updated_at ASC -- Prioritize by user priority then by oldest update
 	LIMIT $5
@@ -325,6 +354,7 @@ func (pjs *PostgresJobStore) GetRetryableJobs(ctx context.Context, limit int) ([
 		maxAttempts,
 		// lookbackTime, // if lookback is used
 		limit,
+		models.JobStateNoProviderAvailable,
 	)
 	if err != nil {
 		pjs.logger.Error("Failed to get retryable jobs from DB", zap.Error(err))
@@ -333,6 +363,112 @@ func (pjs *PostgresJobStore) GetRetryableJobs(ctx context.Context, limit int) ([
 	return pjs.scanJobRows(rows)
 }
 
+// GetProviderStats aggregates completed and failed job counts for the given providers,
+// reading only their jobs through the provider_id index.
+func (pjs *PostgresJobStore) GetProviderStats(ctx context.Context, providerIDs []string) (map[string]models.ProviderJobStats, error) {
+	stats := make(map[string]models.ProviderJobStats)
+	if len(providerIDs) == 0 {
+		return stats, nil
+	}
+
+	sqlQuery := `
+	SELECT provider_id,
+		COUNT(*) FILTER (WHERE state = $1) AS completed,
+		COUNT(*) FILTER (WHERE state = $2) AS failed
+	FROM jobs
+	WHERE provider_id = ANY($3)
+	GROUP BY provider_id
+	`
+	rows, err := pjs.db.Query(ctx, sqlQuery, models.JobStateCompleted, models.JobStateFailed, providerIDs)
+	if err != nil {
+		pjs.logger.Error("Failed to get provider job stats from DB", zap.Error(err))
+		return nil, fmt.Errorf("getting provider job stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var providerID string
+		var s models.ProviderJobStats
+		if err := rows.Scan(&providerID, &s.Completed, &s.Failed); err != nil {
+			return nil, fmt.Errorf("scanning provider job stats: %w", err)
+		}
+		stats[providerID] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating provider job stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetQueuePosition counts the waiting jobs ahead of the given one. Waiting jobs are
+// ordered by priority, highest first, then by when the scheduler received them.
+func (pjs *PostgresJobStore) GetQueuePosition(ctx context.Context, jobID string) (int, error) {
+	sqlQuery := `
+	SELECT COUNT(*) + 1
+	FROM jobs j, jobs target
+	WHERE target.job_id = $1
+		AND target.state IN ($2, $3, $4)
+		AND j.state IN ($2, $3, $4)
+		AND (
+			COALESCE(j.priority, 0) > COALESCE(target.priority, 0)
+			OR (COALESCE(j.priority, 0) = COALESCE(target.priority, 0) AND
+				(j.received_at < target.received_at OR (j.received_at = target.received_at AND j.job_id < target.job_id)))
+		)
+	GROUP BY target.job_id
+	`
+	var position int
+	err := pjs.db.QueryRow(ctx, sqlQuery, jobID, models.JobStatePending, models.JobStateSearching, models.JobStateNoProviderAvailable).Scan(&position)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil // Not waiting (or unknown)
+		}
+		pjs.logger.Error("Failed to get queue position from DB", zap.String("job_id", jobID), zap.Error(err))
+		return 0, fmt.Errorf("getting queue position for %s: %w", jobID, err)
+	}
+	return position, nil
+}
+
+// CountActiveJobsByUser counts the user's jobs that are not in a terminal state.
+func (pjs *PostgresJobStore) CountActiveJobsByUser(ctx context.Context, userID string) (int, error) {
+	sqlQuery := `
+	SELECT COUNT(*)
+	FROM jobs
+	WHERE user_id = $1 AND state NOT IN ($2, $3, $4)
+	`
+	var count int
+	err := pjs.db.QueryRow(ctx, sqlQuery, userID, models.JobStateCompleted, models.JobStateFailed, models.JobStateCancelled).Scan(&count)
+	if err != nil {
+		pjs.logger.Error("Failed to count active jobs from DB", zap.String("user_id", userID), zap.Error(err))
+		return 0, fmt.Errorf("counting active jobs for %s: %w", userID, err)
+	}
+	return count, nil
+}
+
+// GetAverageRunDuration averages, over the last sampleSize completed jobs, the time from
+// the scheduler receiving each job to its completion.
+func (pjs *PostgresJobStore) GetAverageRunDuration(ctx context.Context, sampleSize int) (time.Duration, bool, error) {
+	sqlQuery := `
+	SELECT COUNT(*), COALESCE(AVG(EXTRACT(EPOCH FROM (updated_at - received_at))), 0)
+	FROM (
+		SELECT received_at, updated_at
+		FROM jobs
+		WHERE state = $1
+		ORDER BY updated_at DESC
+		LIMIT $2
+	) recent
+	`
+	var count int64
+	var avgSeconds float64
+	if err := pjs.db.QueryRow(ctx, sqlQuery, models.JobStateCompleted, sampleSize).Scan(&count, &avgSeconds); err != nil {
+		pjs.logger.Error("Failed to get average run duration from DB", zap.Error(err))
+		return 0, false, fmt.Errorf("getting average run duration: %w", err)
+	}
+	if count == 0 {
+		return 0, false, nil
+	}
+	return time.Duration(avgSeconds * float64(time.Second)), true, nil
+}
+
 // DeleteJob removes a job from the store.
 func (pjs *PostgresJobStore) DeleteJob(ctx context.Context, jobID string) error {
 	sqlQuery := `DELETE FROM jobs WHERE job_id = $1`
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/dante-gpu/dante-backend/storage-service/internal/api"
 	"github.com/dante-gpu/dante-backend/storage-service/internal/config"
+	"github.com/dante-gpu/dante-backend/storage-service/internal/lifecycle"
 	"github.com/dante-gpu/dante-backend/storage-service/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,6 +25,9 @@ var (
 	Version string = "dev"
 ) // Can be set during build
 
+// healthCheckMinioTimeout bounds the MinIO probe made by the health endpoint.
+const healthCheckMinioTimeout = 800 * time.Millisecond
+
 func main() {
 	// Initialize Logger (basic one until config is loaded)
 	interimLogger, _ := zap.NewDevelopment()
@@ -65,6 +70,14 @@ func main() {
 		}
 	}
 
+	// Start the lifecycle reaper for expired objects and abandoned uploads
+	reaperCtx, cancelReaper := context.WithCancel(context.Background())
+	defer cancelReaper()
+	if cfg.Lifecycle.Enabled {
+		go lifecycle.NewReaper(minioClient, cfg.Lifecycle, logger).Run(reaperCtx)
+		logger.Info("Lifecycle reaper started", zap.Int("rules", len(cfg.Lifecycle.Rules)), zap.Duration("sweep_interval", cfg.Lifecycle.SweepInterval))
+	}
+
 	// Initialize Router and Handlers
 	r := chi.NewRouter()
 
@@ -81,13 +94,27 @@ func main() {
 		healthPath = cfg.Consul.Registration.HealthCheckPath
 	}
 	r.Get(healthPath, func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Add more detailed health checks (e.g., MinIO connectivity)
+		// Keep the MinIO probe well inside the Consul health check timeout
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckMinioTimeout)
+		defer cancel()
+
 		w.Header().Set("Content-Type", "application/json")
+		if err := minioClient.Ping(ctx); err != nil {
+			logger.Warn("Health check failed: MinIO unavailable", zap.Error(err))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status": "DOWN",
+				"minio":  "DOWN",
+				"error":  err.Error(),
+			})
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "{\"status\": \"UP\"}")
+		json.NewEncoder(w).Encode(map[string]string{"status": "UP", "minio": "UP"})
 	})
 
-	storageHandler := api.NewStorageHandler(minioClient, logger)
+	storageHandler := api.NewStorageHandler(minioClient, cfg.Presign, cfg.Minio.DefaultBucket, logger)
 	storageHandler.RegisterRoutes(r)
 	logger.Info("HTTP routes registered")
 
@@ -125,6 +152,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Info("Shutting down server...")
+	cancelReaper()
 
 	if cfg.Consul.Enabled && consulServiceID != "" {
 		logger.Info("Deregistering service from Consul", zap.String("service_id", consulServiceID))
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// compressedContentTypes are media types whose data is already compressed, so gzipping
+// them again only costs CPU. Whole "image/", "video/" and "audio/" types are skipped too.
+var compressedContentTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/x-compressed-tar": true,
+}
+
+// compressedExtensions are object key extensions of already compressed files, for
+// objects stored with a generic content type
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zst": true, ".zip": true, ".bz2": true, ".xz": true,
+	".7z": true, ".rar": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".mp4": true, ".webm": true, ".mp3": true,
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// alreadyCompressed reports whether an object's data is compressed already, judging by
+// its content type and, failing that, its key's extension
+func alreadyCompressed(contentType, objectKey string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if compressedContentTypes[mediaType] {
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(mediaType, prefix) && mediaType != "image/svg+xml" {
+			return true
+		}
+	}
+	return compressedExtensions[strings.ToLower(path.Ext(objectKey))]
+}
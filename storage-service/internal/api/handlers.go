@@ -1,7 +1,9 @@
 package api
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"io"
 	"mime"
 	"net/http"
@@ -10,27 +12,40 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dante-gpu/dante-backend/storage-service/internal/config"
 	"github.com/dante-gpu/dante-backend/storage-service/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
 const (
-	defaultPresignedURLExpiry = 15 * time.Minute
-	maxUploadSize             = 5 * 1024 * 1024 * 1024 // 5 GB, example limit
+	maxUploadSize = 5 * 1024 * 1024 * 1024 // 5 GB, example limit
+
+	// minCompressSize is the smallest download that is gzipped for clients accepting it
+	minCompressSize = 1024
 )
 
 // StorageHandler handles HTTP requests for storage operations.
 type StorageHandler struct {
-	storageClient storage.ObjectStorage
-	logger        *zap.Logger
+	storageClient  storage.ObjectStorage
+	presign        config.PresignConfig
+	presignBuckets map[string]bool // Buckets presigned URLs may be issued for
+	logger         *zap.Logger
 }
 
-// NewStorageHandler creates a new StorageHandler.
-func NewStorageHandler(storageClient storage.ObjectStorage, logger *zap.Logger) *StorageHandler {
+// NewStorageHandler creates a new StorageHandler. Presigned URLs are limited to the
+// buckets in presignCfg.AllowedBuckets plus the default bucket.
+func NewStorageHandler(storageClient storage.ObjectStorage, presignCfg config.PresignConfig, defaultBucket string, logger *zap.Logger) *StorageHandler {
+	presignBuckets := map[string]bool{"": true, defaultBucket: true} // "" selects the default bucket
+	for _, bucket := range presignCfg.AllowedBuckets {
+		presignBuckets[bucket] = true
+	}
+
 	return &StorageHandler{
-		storageClient: storageClient,
-		logger:        logger.Named("storage_handler"),
+		storageClient:  storageClient,
+		presign:        presignCfg,
+		presignBuckets: presignBuckets,
+		logger:         logger.Named("storage_handler"),
 	}
 }
 
@@ -45,9 +60,20 @@ func (h *StorageHandler) RegisterRoutes(r chi.Router) {
 	r.Delete("/objects/{bucketName}/*", h.deleteObjectHandler) // Delete (DELETE with wildcard for object key)
 	r.Head("/objects/{bucketName}/*", h.getObjectInfoHandler)  // Get Info (HEAD with wildcard for object key)
 	r.Get("/objects/{bucketName}/list", h.listObjectsHandler)  // List objects in a bucket (or with prefix if query param used)
+	r.Delete("/objects", h.deleteExpiredObjectsHandler)        // Bulk cleanup: ?prefix=...&older_than=...[&bucket=...]
 
 	// Presigned URL generation
 	r.Post("/presigned-url/{bucketName}/*", h.generatePresignedURLHandler)
+	r.Get("/presign/download", h.presignDownloadHandler)
+	r.Post("/presign/upload", h.presignUploadHandler)
+
+	// Multipart uploads for large objects; each part is a separate request so that
+	// multi-GB uploads aren't bound by the global request timeout
+	r.Post("/upload/multipart/initiate", h.initiateMultipartUploadHandler)
+	r.Put("/upload/multipart/part", h.uploadPartHandler)
+	r.Get("/upload/multipart/parts", h.listUploadedPartsHandler)
+	r.Post("/upload/multipart/complete", h.completeMultipartUploadHandler)
+	r.Post("/upload/multipart/abort", h.abortMultipartUploadHandler)
 
 	// Convenience route for default bucket - uses configured default bucket
 	r.Get("/objects/*", h.downloadObjectFromDefaultBucketHandler)
@@ -163,21 +189,48 @@ func (h *StorageHandler) downloadObjectHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	objStream, info, err := h.storageClient.Download(r.Context(), bucketName, objectKey)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		h.respondWithError(w, r, http.StatusNotFound, "Object not found", err)
+		return
+	}
 	if err != nil {
-		// TODO: Differentiate between "not found" and other errors for status code
 		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to download object", err)
 		return
 	}
 	defer objStream.Close()
 
 	w.Header().Set("Content-Type", info.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
 	w.Header().Set("ETag", info.ETag)
 	w.Header().Set("Last-Modified", info.LastModified.Format(http.TimeFormat))
 	// Consider adding "Content-Disposition" for filename on download
 	// w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(objectKey)))
 
-	if _, err := io.Copy(w, objStream); err != nil {
+	// Range requests, e.g. for tailing a job's logs, are served as is rather than
+	// compressed. The object streams from MinIO are seekable, so ServeContent can
+	// answer them with the partial content.
+	if seeker, ok := objStream.(io.ReadSeeker); ok {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, objectKey, info.LastModified, seeker)
+			return
+		}
+	}
+
+	// Compress on the fly for clients that accept it, unless the data already is.
+	// The compressed length isn't known up front, so the body is chunked.
+	var body io.Writer = w
+	if info.Size >= minCompressSize && acceptsGzip(r.Header.Get("Accept-Encoding")) && !alreadyCompressed(info.ContentType, objectKey) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Set("ETag", "W/"+strings.TrimPrefix(info.ETag, "W/")) // The encoded body isn't byte-identical
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		body = gz
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+
+	if _, err := io.Copy(body, objStream); err != nil {
 		// Error already logged by this point if it's a client-side issue (e.g., connection closed)
 		// For server-side issues during copy, log here.
 		h.logger.Error("Failed to stream object to client", zap.Error(err), zap.String("key", objectKey))
@@ -203,6 +256,39 @@ func (h *StorageHandler) deleteObjectHandler(w http.ResponseWriter, r *http.Requ
 	h.respondWithJSON(w, r, http.StatusNoContent, nil)
 }
 
+// deleteExpiredObjectsHandler deletes every object under a prefix that is older than the
+// given duration, for manual cleanup of workspaces and artifacts.
+func (h *StorageHandler) deleteExpiredObjectsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bucketName := query.Get("bucket")
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		// Refuse to sweep a whole bucket by accident
+		h.respondWithError(w, r, http.StatusBadRequest, "prefix query parameter is required", nil)
+		return
+	}
+
+	olderThan, err := time.ParseDuration(query.Get("older_than"))
+	if err != nil || olderThan <= 0 {
+		h.respondWithError(w, r, http.StatusBadRequest, "older_than must be a positive duration such as 72h", err)
+		return
+	}
+
+	deleted, err := h.storageClient.DeleteObjectsOlderThan(r.Context(), bucketName, prefix, time.Now().Add(-olderThan))
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to delete expired objects", err)
+		return
+	}
+
+	h.logger.Info("Expired objects deleted on request",
+		zap.String("bucket", bucketName),
+		zap.String("prefix", prefix),
+		zap.Duration("older_than", olderThan),
+		zap.Int("deleted", deleted),
+	)
+	h.respondWithJSON(w, r, http.StatusOK, map[string]interface{}{"deleted": deleted, "bucket": bucketName, "prefix": prefix})
+}
+
 // getObjectInfoHandler handles requests for object metadata (HEAD requests).
 func (h *StorageHandler) getObjectInfoHandler(w http.ResponseWriter, r *http.Request) {
 	bucketName := chi.URLParam(r, "bucketName")
@@ -271,25 +357,7 @@ func (h *StorageHandler) generatePresignedURLHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	expiryDuration := defaultPresignedURLExpiry
-	if reqBody.Expiry != "" {
-		parsedExpiry, err := time.ParseDuration(reqBody.Expiry)
-		if err != nil {
-			h.respondWithError(w, r, http.StatusBadRequest, "Invalid expiry duration format", err)
-			return
-		}
-		if parsedExpiry > 0 {
-			expiryDuration = parsedExpiry
-		}
-	}
-
-	presignedURL, err := h.storageClient.GetPresignedURL(r.Context(), bucketName, objectKey, reqBody.Method, expiryDuration)
-	if err != nil {
-		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to generate presigned URL", err)
-		return
-	}
-
-	h.respondWithJSON(w, r, http.StatusOK, map[string]string{"url": presignedURL, "method": reqBody.Method, "key": objectKey, "bucket": bucketName})
+	h.issuePresignedURL(w, r, bucketName, objectKey, reqBody.Method, reqBody.Expiry)
 }
 
 // --- Default Bucket Handler Wrappers --- //
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dante-gpu/dante-backend/storage-service/internal/storage"
+	"go.uber.org/zap"
+)
+
+// recommendedPartSize is the part size suggested to clients. It keeps each part request
+// well inside the global request timeout while allowing objects of up to ~640 GB.
+const recommendedPartSize = 64 * 1024 * 1024
+
+// multipartUploadRequest identifies a multipart upload in initiate, complete and abort requests.
+// An empty bucket means the configured default bucket.
+type multipartUploadRequest struct {
+	Bucket      string                 `json:"bucket"`
+	Key         string                 `json:"key"`
+	UploadID    string                 `json:"upload_id"`
+	ContentType string                 `json:"content_type,omitempty"` // Initiate only
+	Parts       []storage.UploadedPart `json:"parts,omitempty"`        // Complete only; defaults to every uploaded part
+}
+
+// initiateMultipartUploadHandler starts a multipart upload.
+func (h *StorageHandler) initiateMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req multipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Key == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "Object key is required", nil)
+		return
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(req.Key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	uploadID, err := h.storageClient.InitiateMultipartUpload(r.Context(), req.Bucket, req.Key, contentType)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to initiate multipart upload", err)
+		return
+	}
+
+	h.respondWithJSON(w, r, http.StatusCreated, map[string]interface{}{
+		"upload_id":      uploadID,
+		"bucket":         req.Bucket,
+		"key":            req.Key,
+		"part_size":      recommendedPartSize,
+		"min_part_size":  storage.MinPartSize,
+		"max_part_size":  storage.MaxPartSize,
+		"max_part_count": storage.MaxMultipartParts,
+	})
+}
+
+// uploadPartHandler uploads one part. The upload is identified by the bucket, key,
+// upload_id and part_number query parameters and the part data is the request body.
+func (h *StorageHandler) uploadPartHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bucketName, objectKey, uploadID := query.Get("bucket"), query.Get("key"), query.Get("upload_id")
+	if objectKey == "" || uploadID == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "key and upload_id query parameters are required", nil)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(query.Get("part_number"))
+	if err != nil || partNumber < 1 || partNumber > storage.MaxMultipartParts {
+		h.respondWithError(w, r, http.StatusBadRequest,
+			fmt.Sprintf("part_number must be between 1 and %d", storage.MaxMultipartParts), err)
+		return
+	}
+
+	// Parts are signed with their length, so it must be known up front
+	if r.ContentLength <= 0 {
+		h.respondWithError(w, r, http.StatusLengthRequired, "Content-Length is required for part uploads", nil)
+		return
+	}
+	if r.ContentLength > storage.MaxPartSize {
+		h.respondWithError(w, r, http.StatusRequestEntityTooLarge, "Part exceeds maximum part size", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, r.ContentLength)
+	defer r.Body.Close()
+
+	part, err := h.storageClient.UploadPart(r.Context(), bucketName, objectKey, uploadID, partNumber, r.Body, r.ContentLength)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to upload part", err)
+		return
+	}
+	h.respondWithJSON(w, r, http.StatusOK, part)
+}
+
+// listUploadedPartsHandler lists the parts uploaded so far, so that an interrupted
+// upload can be resumed from the first missing part.
+func (h *StorageHandler) listUploadedPartsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bucketName, objectKey, uploadID := query.Get("bucket"), query.Get("key"), query.Get("upload_id")
+	if objectKey == "" || uploadID == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "key and upload_id query parameters are required", nil)
+		return
+	}
+
+	parts, err := h.storageClient.ListUploadedParts(r.Context(), bucketName, objectKey, uploadID)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to list uploaded parts", err)
+		return
+	}
+	if parts == nil {
+		parts = []storage.UploadedPart{} // Encode as [] rather than null
+	}
+	h.respondWithJSON(w, r, http.StatusOK, map[string]interface{}{"upload_id": uploadID, "parts": parts})
+}
+
+// completeMultipartUploadHandler assembles the uploaded parts into the final object.
+// Parts listed in the request must have been uploaded with matching ETags; if none
+// are listed, every uploaded part is used.
+func (h *StorageHandler) completeMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req multipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Key == "" || req.UploadID == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "key and upload_id are required", nil)
+		return
+	}
+
+	uploaded, err := h.storageClient.ListUploadedParts(r.Context(), req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to list uploaded parts", err)
+		return
+	}
+
+	parts, err := selectCompletedParts(req.Parts, uploaded)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	info, err := h.storageClient.CompleteMultipartUpload(r.Context(), req.Bucket, req.Key, req.UploadID, parts)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to complete multipart upload", err)
+		return
+	}
+	h.respondWithJSON(w, r, http.StatusCreated, info)
+}
+
+// abortMultipartUploadHandler cancels a multipart upload and removes its uploaded parts.
+func (h *StorageHandler) abortMultipartUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req multipartUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Key == "" || req.UploadID == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "key and upload_id are required", nil)
+		return
+	}
+
+	if err := h.storageClient.AbortMultipartUpload(r.Context(), req.Bucket, req.Key, req.UploadID); err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to abort multipart upload", err)
+		return
+	}
+
+	h.logger.Info("Multipart upload aborted by client", zap.String("key", req.Key), zap.String("upload_id", req.UploadID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// selectCompletedParts checks the requested parts against those actually uploaded and
+// enforces the MinIO limits: at most MaxMultipartParts parts, and every part except the
+// last at least MinPartSize.
+func selectCompletedParts(requested, uploaded []storage.UploadedPart) ([]storage.UploadedPart, error) {
+	if len(requested) == 0 {
+		requested = uploaded
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("no parts have been uploaded")
+	}
+	if len(requested) > storage.MaxMultipartParts {
+		return nil, fmt.Errorf("too many parts: %d (maximum %d)", len(requested), storage.MaxMultipartParts)
+	}
+
+	byNumber := make(map[int]storage.UploadedPart, len(uploaded))
+	for _, part := range uploaded {
+		byNumber[part.PartNumber] = part
+	}
+
+	parts := make([]storage.UploadedPart, 0, len(requested))
+	last := 0
+	for _, req := range requested {
+		part, ok := byNumber[req.PartNumber]
+		if !ok {
+			return nil, fmt.Errorf("part %d has not been uploaded", req.PartNumber)
+		}
+		if req.ETag != "" && strings.Trim(req.ETag, `"`) != strings.Trim(part.ETag, `"`) {
+			return nil, fmt.Errorf("ETag mismatch for part %d", req.PartNumber)
+		}
+		if req.PartNumber <= last {
+			return nil, fmt.Errorf("parts must be listed in ascending order without duplicates")
+		}
+		last = req.PartNumber
+		parts = append(parts, part)
+	}
+
+	for _, part := range parts[:len(parts)-1] {
+		if part.Size < storage.MinPartSize {
+			return nil, fmt.Errorf("part %d is %d bytes; all parts but the last must be at least %d bytes",
+				part.PartNumber, part.Size, storage.MinPartSize)
+		}
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// presignUploadRequest is the body of a presigned upload URL request.
+// An empty bucket means the configured default bucket.
+type presignUploadRequest struct {
+	Bucket string `json:"bucket"`
+	Object string `json:"object"`
+	Expiry string `json:"expiry"` // Duration string like "15m", "1h"
+}
+
+// presignDownloadHandler issues a time-limited GET URL for an object.
+// Query parameters: object (required), bucket and expiry.
+func (h *StorageHandler) presignDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	objectKey := query.Get("object")
+	if objectKey == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "object query parameter is required", nil)
+		return
+	}
+
+	h.issuePresignedURL(w, r, query.Get("bucket"), objectKey, "GET", query.Get("expiry"))
+}
+
+// presignUploadHandler issues a time-limited PUT URL that a client (such as a provider
+// uploading job outputs) can upload an object to without holding storage credentials.
+func (h *StorageHandler) presignUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req presignUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Object == "" {
+		h.respondWithError(w, r, http.StatusBadRequest, "object is required", nil)
+		return
+	}
+
+	h.issuePresignedURL(w, r, req.Bucket, req.Object, "PUT", req.Expiry)
+}
+
+// issuePresignedURL validates the bucket and expiry of a presigned URL request and
+// responds with the generated URL.
+func (h *StorageHandler) issuePresignedURL(w http.ResponseWriter, r *http.Request, bucketName, objectKey, method, expiryStr string) {
+	if !h.presignBuckets[bucketName] {
+		h.respondWithError(w, r, http.StatusForbidden, fmt.Sprintf("Presigned URLs are not allowed for bucket %q", bucketName), nil)
+		return
+	}
+
+	expiry, err := h.presignExpiry(expiryStr)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusBadRequest, "Invalid expiry: "+err.Error(), err)
+		return
+	}
+
+	presignedURL, err := h.storageClient.GetPresignedURL(r.Context(), bucketName, objectKey, method, expiry)
+	if err != nil {
+		h.respondWithError(w, r, http.StatusInternalServerError, "Failed to generate presigned URL", err)
+		return
+	}
+
+	h.respondWithJSON(w, r, http.StatusOK, map[string]string{
+		"url":        presignedURL,
+		"method":     method,
+		"key":        objectKey,
+		"bucket":     bucketName,
+		"expires_at": time.Now().UTC().Add(expiry).Format(time.RFC3339),
+	})
+}
+
+// presignExpiry parses a requested expiry, applying the configured default and rejecting
+// anything longer than the configured maximum.
+func (h *StorageHandler) presignExpiry(expiryStr string) (time.Duration, error) {
+	if expiryStr == "" {
+		return h.presign.DefaultExpiry, nil
+	}
+
+	expiry, err := time.ParseDuration(expiryStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration format")
+	}
+	if expiry <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	if h.presign.MaxExpiry > 0 && expiry > h.presign.MaxExpiry {
+		return 0, fmt.Errorf("exceeds the maximum of %s", h.presign.MaxExpiry)
+	}
+	return expiry, nil
+}
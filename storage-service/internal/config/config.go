@@ -45,15 +45,41 @@ type MinioConfig struct {
 	AutoCreateDefaultBucket bool   `yaml:"autoCreateDefaultBucket"`
 }
 
+// PresignConfig limits the presigned URLs the service hands out.
+type PresignConfig struct {
+	DefaultExpiry  time.Duration `yaml:"default_expiry"`  // Used when a request doesn't specify an expiry
+	MaxExpiry      time.Duration `yaml:"max_expiry"`      // Requests for longer-lived URLs are rejected
+	AllowedBuckets []string      `yaml:"allowed_buckets"` // Buckets URLs may be issued for; empty means the default bucket only
+}
+
+// LifecycleRule expires objects under a prefix once they are older than TTL.
+type LifecycleRule struct {
+	Bucket string        `yaml:"bucket"` // Empty means the default bucket
+	Prefix string        `yaml:"prefix"` // e.g. "workspaces/"
+	TTL    time.Duration `yaml:"ttl"`
+}
+
+// LifecycleConfig controls automatic cleanup of expired objects and abandoned uploads.
+// Rules with a TTL of whole days are installed as MinIO bucket lifecycle rules; others,
+// and rules for buckets that reject lifecycle configuration, are enforced by a periodic sweep.
+type LifecycleConfig struct {
+	Enabled             bool            `yaml:"enabled"`
+	SweepInterval       time.Duration   `yaml:"sweep_interval"`
+	IncompleteUploadTTL time.Duration   `yaml:"incomplete_upload_ttl"` // Multipart uploads older than this are aborted
+	Rules               []LifecycleRule `yaml:"rules"`
+}
+
 // Config holds the overall application configuration.
 type Config struct {
 	InstanceID     string        `yaml:"instance_id"`     // Unique ID for this service instance
 	LogLevel       string        `yaml:"log_level"`       // e.g., "debug", "info", "warn", "error"
 	RequestTimeout time.Duration `yaml:"request_timeout"` // Default timeout for HTTP server requests
 
-	Server ServerConfig `yaml:"server"`
-	Consul ConsulConfig `yaml:"consul"`
-	Minio  MinioConfig  `yaml:"minio"`
+	Server    ServerConfig    `yaml:"server"`
+	Consul    ConsulConfig    `yaml:"consul"`
+	Minio     MinioConfig     `yaml:"minio"`
+	Presign   PresignConfig   `yaml:"presign"`
+	Lifecycle LifecycleConfig `yaml:"lifecycle"`
 
 	Logger *zap.Logger `yaml:"-"` // Logger is not read from YAML
 }
@@ -164,6 +190,14 @@ func getDefaultConfig() *Config {
 			DefaultBucket:           "dante-storage",
 			AutoCreateDefaultBucket: true,
 		},
+		Presign: PresignConfig{
+			DefaultExpiry: 15 * time.Minute,
+			MaxExpiry:     24 * time.Hour,
+		},
+		Lifecycle: LifecycleConfig{
+			SweepInterval:       time.Hour,
+			IncompleteUploadTTL: 24 * time.Hour,
+		},
 	}
 }
 
@@ -230,6 +264,23 @@ func applyDefaultsIfNotSet(cfg *Config, defaults *Config) {
 	}
 	// AutoCreateDefaultBucket defaults to false. If we want default true, handle as with Consul.Enabled.
 
+	// Presign defaults
+	if cfg.Presign.DefaultExpiry == 0 {
+		cfg.Presign.DefaultExpiry = defaults.Presign.DefaultExpiry
+	}
+	if cfg.Presign.MaxExpiry == 0 {
+		cfg.Presign.MaxExpiry = defaults.Presign.MaxExpiry
+	}
+	// AllowedBuckets defaults to empty, which limits presigned URLs to the default bucket.
+
+	// Lifecycle defaults
+	if cfg.Lifecycle.SweepInterval == 0 {
+		cfg.Lifecycle.SweepInterval = defaults.Lifecycle.SweepInterval
+	}
+	if cfg.Lifecycle.IncompleteUploadTTL == 0 {
+		cfg.Lifecycle.IncompleteUploadTTL = defaults.Lifecycle.IncompleteUploadTTL
+	}
+
 	// InstanceID is handled separately after loading if still empty.
 }
 
@@ -2,10 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 )
 
+// ErrObjectNotFound is returned when the requested object doesn't exist.
+var ErrObjectNotFound = errors.New("object not found")
+
 // ObjectInfo contains metadata about a stored object.
 type ObjectInfo struct {
 	Key          string    `json:"key"`
@@ -15,6 +19,20 @@ type ObjectInfo struct {
 	ETag         string    `json:"etag"`
 }
 
+// Multipart upload limits imposed by MinIO (and S3).
+const (
+	MaxMultipartParts = 10000                  // Maximum number of parts in one upload
+	MinPartSize       = 5 * 1024 * 1024        // Minimum size of every part except the last
+	MaxPartSize       = 5 * 1024 * 1024 * 1024 // Maximum size of a single part
+)
+
+// UploadedPart describes one part of an in-progress multipart upload.
+type UploadedPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
 // ObjectStorage defines the interface for interacting with an object storage backend.
 type ObjectStorage interface {
 	// Upload uploads a file to the specified bucket with the given key.
@@ -40,4 +58,34 @@ type ObjectStorage interface {
 	// GetPresignedURL generates a presigned URL for an object, either for uploading (PUT) or downloading (GET).
 	// expiry is the duration for which the URL will be valid.
 	GetPresignedURL(ctx context.Context, bucketName, key string, method string, expiry time.Duration) (string, error)
+
+	// InitiateMultipartUpload starts a multipart upload and returns its upload ID.
+	InitiateMultipartUpload(ctx context.Context, bucketName, key, contentType string) (string, error)
+
+	// UploadPart uploads one part of a multipart upload. partNumber starts at 1.
+	UploadPart(ctx context.Context, bucketName, key, uploadID string, partNumber int, reader io.Reader, size int64) (*UploadedPart, error)
+
+	// ListUploadedParts lists the parts uploaded so far, ordered by part number.
+	ListUploadedParts(ctx context.Context, bucketName, key, uploadID string) ([]UploadedPart, error)
+
+	// CompleteMultipartUpload assembles the given parts into the final object.
+	CompleteMultipartUpload(ctx context.Context, bucketName, key, uploadID string, parts []UploadedPart) (*ObjectInfo, error)
+
+	// AbortMultipartUpload cancels a multipart upload and discards its uploaded parts.
+	AbortMultipartUpload(ctx context.Context, bucketName, key, uploadID string) error
+
+	// SetExpirationRule installs (or replaces) a bucket lifecycle rule that expires objects
+	// under prefix after the given number of days.
+	SetExpirationRule(ctx context.Context, bucketName, ruleID, prefix string, days int) error
+
+	// DeleteObjectsOlderThan deletes objects under prefix last modified before cutoff
+	// and returns how many were deleted.
+	DeleteObjectsOlderThan(ctx context.Context, bucketName, prefix string, cutoff time.Time) (int, error)
+
+	// AbortUploadsOlderThan aborts multipart uploads under prefix initiated before cutoff
+	// and returns how many were aborted.
+	AbortUploadsOlderThan(ctx context.Context, bucketName, prefix string, cutoff time.Time) (int, error)
+
+	// Ping checks that the storage backend is reachable and the credentials are valid.
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"go.uber.org/zap"
+)
+
+// SetExpirationRule installs a lifecycle rule expiring objects under prefix after the given
+// number of days. Other rules already on the bucket are kept; a rule with the same ID is replaced.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) SetExpirationRule(ctx context.Context, bucketName, ruleID, prefix string, days int) error {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	if days < 1 {
+		return fmt.Errorf("lifecycle expiration must be at least one day")
+	}
+
+	cfg, err := mc.client.GetBucketLifecycle(ctx, targetBucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to get lifecycle configuration for %s: %w", targetBucket, err)
+		}
+		cfg = lifecycle.NewConfiguration()
+	}
+
+	rules := make([]lifecycle.Rule, 0, len(cfg.Rules)+1)
+	for _, rule := range cfg.Rules {
+		if rule.ID != ruleID {
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules, lifecycle.Rule{
+		ID:         ruleID,
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: prefix},
+		Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(days)},
+	})
+	cfg.Rules = rules
+
+	if err := mc.client.SetBucketLifecycle(ctx, targetBucket, cfg); err != nil {
+		return fmt.Errorf("failed to set lifecycle configuration for %s: %w", targetBucket, err)
+	}
+
+	mc.logger.Info("Lifecycle expiration rule set",
+		zap.String("bucket", targetBucket),
+		zap.String("rule_id", ruleID),
+		zap.String("prefix", prefix),
+		zap.Int("days", days),
+	)
+	return nil
+}
+
+// DeleteObjectsOlderThan deletes objects under prefix last modified before cutoff.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) DeleteObjectsOlderThan(ctx context.Context, bucketName, prefix string, cutoff time.Time) (int, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return 0, fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	mc.logger.Debug("Deleting expired objects",
+		zap.String("bucket", targetBucket),
+		zap.String("prefix", prefix),
+		zap.Time("cutoff", cutoff),
+	)
+
+	// Feed expired objects to RemoveObjects, which deletes them in batches. Only objects
+	// handed over for deletion are counted, so a cancelled sweep doesn't report the
+	// objects it never got to as deleted.
+	var listErr error
+	submitted := 0
+	objectsCh := make(chan minio.ObjectInfo)
+	listDone := make(chan struct{})
+	go func() {
+		defer close(listDone)
+		defer close(objectsCh)
+		for object := range mc.client.ListObjects(ctx, targetBucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			if object.LastModified.Before(cutoff) {
+				select {
+				case objectsCh <- object:
+					submitted++
+				case <-ctx.Done():
+					listErr = ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+
+	failed := 0
+	for removeErr := range mc.client.RemoveObjects(ctx, targetBucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		failed++
+		mc.logger.Warn("Failed to delete expired object",
+			zap.String("bucket", targetBucket),
+			zap.String("key", removeErr.ObjectName),
+			zap.Error(removeErr.Err),
+		)
+	}
+
+	// RemoveObjects reports a failure for each submitted object it couldn't delete
+	<-listDone
+	deleted := submitted - failed
+	if listErr != nil {
+		return deleted, fmt.Errorf("error during object listing in %s: %w", targetBucket, listErr)
+	}
+
+	mc.logger.Info("Expired objects deleted",
+		zap.String("bucket", targetBucket),
+		zap.String("prefix", prefix),
+		zap.Int("deleted", deleted),
+		zap.Int("failed", failed),
+	)
+	return deleted, nil
+}
+
+// AbortUploadsOlderThan aborts multipart uploads under prefix initiated before cutoff,
+// reclaiming the parts of uploads that were never completed or aborted by their client.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) AbortUploadsOlderThan(ctx context.Context, bucketName, prefix string, cutoff time.Time) (int, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return 0, fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+
+	var stale []minio.ObjectMultipartInfo
+	for upload := range mc.client.ListIncompleteUploads(ctx, targetBucket, prefix, true) {
+		if upload.Err != nil {
+			return 0, fmt.Errorf("error listing incomplete uploads in %s: %w", targetBucket, upload.Err)
+		}
+		if upload.Initiated.Before(cutoff) {
+			stale = append(stale, upload)
+		}
+	}
+
+	aborted := 0
+	for _, upload := range stale {
+		if err := mc.core.AbortMultipartUpload(ctx, targetBucket, upload.Key, upload.UploadID); err != nil {
+			mc.logger.Warn("Failed to abort stale multipart upload",
+				zap.String("bucket", targetBucket),
+				zap.String("key", upload.Key),
+				zap.String("uploadID", upload.UploadID),
+				zap.Error(err),
+			)
+			continue
+		}
+		aborted++
+	}
+
+	if aborted > 0 {
+		mc.logger.Info("Stale multipart uploads aborted", zap.String("bucket", targetBucket), zap.Int("aborted", aborted))
+	}
+	return aborted, nil
+}
@@ -16,6 +16,7 @@ import (
 // MinioClient wraps the MinIO client and implements the ObjectStorage interface.
 type MinioClient struct {
 	client        *minio.Client
+	core          minio.Core // Low-level API used for multipart uploads
 	logger        *zap.Logger
 	config        config.MinioConfig
 	defaultBucket string
@@ -56,6 +57,7 @@ func NewMinioClient(cfg config.MinioConfig, logger *zap.Logger) (*MinioClient, e
 
 	return &MinioClient{
 		client:        client,
+		core:          minio.Core{Client: client},
 		logger:        logger.Named("minio_storage"),
 		config:        cfg,
 		defaultBucket: cfg.DefaultBucket,
@@ -84,6 +86,26 @@ func (mc *MinioClient) EnsureBucket(ctx context.Context, bucketName string, regi
 	return nil
 }
 
+// Ping checks MinIO connectivity. With a default bucket configured it checks that the
+// bucket exists, which is cheaper than listing every bucket.
+func (mc *MinioClient) Ping(ctx context.Context) error {
+	if mc.defaultBucket == "" {
+		if _, err := mc.client.ListBuckets(ctx); err != nil {
+			return fmt.Errorf("minio unreachable: %w", err)
+		}
+		return nil
+	}
+
+	exists, err := mc.client.BucketExists(ctx, mc.defaultBucket)
+	if err != nil {
+		return fmt.Errorf("minio unreachable: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("default bucket %s does not exist", mc.defaultBucket)
+	}
+	return nil
+}
+
 // getTargetBucket determines the bucket to use, defaulting to the client's default bucket if none is provided.
 func (mc *MinioClient) getTargetBucket(bucketName string) string {
 	if bucketName == "" {
@@ -153,6 +175,9 @@ func (mc *MinioClient) Download(ctx context.Context, bucketName, objectKey strin
 		mc.logger.Error("Failed to get object stats after GetObject", zap.String("bucket", targetBucket), zap.String("key", objectKey), zap.Error(err))
 		// Close the object stream if stat fails, as the caller won't be able to.
 		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil, fmt.Errorf("%s/%s: %w", targetBucket, objectKey, ErrObjectNotFound)
+		}
 		return nil, nil, fmt.Errorf("failed to get object stats for %s/%s: %w", targetBucket, objectKey, err)
 	}
 
@@ -241,11 +266,9 @@ func (mc *MinioClient) GetObjectInfo(ctx context.Context, bucketName, objectKey
 	stat, err := mc.client.StatObject(ctx, targetBucket, objectKey, minio.StatObjectOptions{})
 	if err != nil {
 		mc.logger.Error("Failed to get object info", zap.String("bucket", targetBucket), zap.String("key", objectKey), zap.Error(err))
-		// Handle MinIO's specific error for "not found" if necessary, or let it propagate.
-		// Example:
-		// if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-		// 	 return nil, ErrObjectNotFound // Define your own error for this
-		// }
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s/%s: %w", targetBucket, objectKey, ErrObjectNotFound)
+		}
 		return nil, fmt.Errorf("failed to get object info for %s/%s: %w", targetBucket, objectKey, err)
 	}
 
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// InitiateMultipartUpload starts a multipart upload and returns its upload ID.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) InitiateMultipartUpload(ctx context.Context, bucketName, objectKey, contentType string) (string, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return "", fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	mc.logger.Debug("Initiating multipart upload",
+		zap.String("bucket", targetBucket),
+		zap.String("key", objectKey),
+		zap.String("contentType", contentType),
+	)
+
+	uploadID, err := mc.core.NewMultipartUpload(ctx, targetBucket, objectKey, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		mc.logger.Error("Failed to initiate multipart upload", zap.String("bucket", targetBucket), zap.String("key", objectKey), zap.Error(err))
+		return "", fmt.Errorf("failed to initiate multipart upload for %s/%s: %w", targetBucket, objectKey, err)
+	}
+
+	mc.logger.Info("Multipart upload initiated",
+		zap.String("bucket", targetBucket),
+		zap.String("key", objectKey),
+		zap.String("uploadID", uploadID),
+	)
+	return uploadID, nil
+}
+
+// UploadPart uploads one part of a multipart upload.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) UploadPart(ctx context.Context, bucketName, objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (*UploadedPart, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return nil, fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	mc.logger.Debug("Uploading part",
+		zap.String("bucket", targetBucket),
+		zap.String("key", objectKey),
+		zap.String("uploadID", uploadID),
+		zap.Int("partNumber", partNumber),
+		zap.Int64("size", size),
+	)
+
+	part, err := mc.core.PutObjectPart(ctx, targetBucket, objectKey, uploadID, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		mc.logger.Error("Failed to upload part",
+			zap.String("bucket", targetBucket),
+			zap.String("key", objectKey),
+			zap.String("uploadID", uploadID),
+			zap.Int("partNumber", partNumber),
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("failed to upload part %d of %s/%s: %w", partNumber, targetBucket, objectKey, err)
+	}
+
+	return &UploadedPart{
+		PartNumber: part.PartNumber,
+		ETag:       part.ETag,
+		Size:       part.Size,
+	}, nil
+}
+
+// ListUploadedParts lists the parts uploaded so far, ordered by part number.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) ListUploadedParts(ctx context.Context, bucketName, objectKey, uploadID string) ([]UploadedPart, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return nil, fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+
+	var parts []UploadedPart
+	marker := 0
+	for {
+		result, err := mc.core.ListObjectParts(ctx, targetBucket, objectKey, uploadID, marker, 1000)
+		if err != nil {
+			mc.logger.Error("Failed to list uploaded parts",
+				zap.String("bucket", targetBucket),
+				zap.String("key", objectKey),
+				zap.String("uploadID", uploadID),
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("failed to list parts of %s/%s: %w", targetBucket, objectKey, err)
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, UploadedPart{
+				PartNumber: part.PartNumber,
+				ETag:       part.ETag,
+				Size:       part.Size,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload assembles the given parts into the final object.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) CompleteMultipartUpload(ctx context.Context, bucketName, objectKey, uploadID string, parts []UploadedPart) (*ObjectInfo, error) {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return nil, fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	mc.logger.Debug("Completing multipart upload",
+		zap.String("bucket", targetBucket),
+		zap.String("key", objectKey),
+		zap.String("uploadID", uploadID),
+		zap.Int("parts", len(parts)),
+	)
+
+	completeParts := make([]minio.CompletePart, len(parts))
+	var size int64
+	for i, part := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag}
+		size += part.Size
+	}
+	sort.Slice(completeParts, func(i, j int) bool { return completeParts[i].PartNumber < completeParts[j].PartNumber })
+
+	uploadInfo, err := mc.core.CompleteMultipartUpload(ctx, targetBucket, objectKey, uploadID, completeParts, minio.PutObjectOptions{})
+	if err != nil {
+		mc.logger.Error("Failed to complete multipart upload",
+			zap.String("bucket", targetBucket),
+			zap.String("key", objectKey),
+			zap.String("uploadID", uploadID),
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("failed to complete multipart upload for %s/%s: %w", targetBucket, objectKey, err)
+	}
+
+	mc.logger.Info("Multipart upload completed",
+		zap.String("bucket", uploadInfo.Bucket),
+		zap.String("key", uploadInfo.Key),
+		zap.String("etag", uploadInfo.ETag),
+		zap.Int("parts", len(parts)),
+	)
+
+	return &ObjectInfo{
+		Key:          uploadInfo.Key,
+		Size:         size,
+		ETag:         uploadInfo.ETag,
+		LastModified: time.Now().UTC(),
+	}, nil
+}
+
+// AbortMultipartUpload cancels a multipart upload and discards its uploaded parts.
+// If bucketName is empty, the default bucket is used.
+func (mc *MinioClient) AbortMultipartUpload(ctx context.Context, bucketName, objectKey, uploadID string) error {
+	targetBucket := mc.getTargetBucket(bucketName)
+	if targetBucket == "" {
+		return fmt.Errorf("bucket name is not specified and no default bucket is configured")
+	}
+	mc.logger.Debug("Aborting multipart upload", zap.String("bucket", targetBucket), zap.String("key", objectKey), zap.String("uploadID", uploadID))
+
+	if err := mc.core.AbortMultipartUpload(ctx, targetBucket, objectKey, uploadID); err != nil {
+		mc.logger.Error("Failed to abort multipart upload",
+			zap.String("bucket", targetBucket),
+			zap.String("key", objectKey),
+			zap.String("uploadID", uploadID),
+			zap.Error(err),
+		)
+		return fmt.Errorf("failed to abort multipart upload for %s/%s: %w", targetBucket, objectKey, err)
+	}
+
+	mc.logger.Info("Multipart upload aborted", zap.String("bucket", targetBucket), zap.String("key", objectKey), zap.String("uploadID", uploadID))
+	return nil
+}